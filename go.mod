@@ -75,6 +75,7 @@ require (
 	github.com/viant/toolbox v0.33.2 // indirect
 	github.com/willf/bitset v1.1.10 // indirect
 	github.com/willf/bloom v2.0.3+incompatible
+	go.etcd.io/bbolt v1.3.4
 	go.etcd.io/etcd v3.3.15+incompatible
 	go.mongodb.org/mongo-driver v1.7.0
 	gocloud.dev v0.20.0
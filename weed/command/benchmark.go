@@ -42,6 +42,16 @@ type BenchmarkOptions struct {
 	masterClient     *wdclient.MasterClient
 	fsync            *bool
 	useTcp           *bool
+	mode             *string
+	filer            *string
+	filerPath        *string
+	s3Endpoint       *string
+	s3Bucket         *string
+	s3AccessKey      *string
+	s3SecretKey      *string
+	readPercent      *int
+	sizeDistribution *string
+	concurrencySweep *string
 }
 
 var (
@@ -69,6 +79,16 @@ func init() {
 	b.maxCpu = cmdBenchmark.Flag.Int("maxCpu", 0, "maximum number of CPUs. 0 means all available CPUs")
 	b.fsync = cmdBenchmark.Flag.Bool("fsync", false, "flush data to disk after write")
 	b.useTcp = cmdBenchmark.Flag.Bool("useTcp", false, "send data via tcp")
+	b.mode = cmdBenchmark.Flag.String("mode", "volume", "[volume|filer|s3] write to volume servers directly, or through the filer or the s3 gateway")
+	b.filer = cmdBenchmark.Flag.String("filer", "localhost:8888", "filer address, for -mode=filer")
+	b.filerPath = cmdBenchmark.Flag.String("filer.path", "/benchmark", "filer folder to write to, for -mode=filer")
+	b.s3Endpoint = cmdBenchmark.Flag.String("s3.endpoint", "localhost:8333", "s3 gateway address, for -mode=s3")
+	b.s3Bucket = cmdBenchmark.Flag.String("s3.bucket", "benchmark", "s3 bucket to write to, for -mode=s3")
+	b.s3AccessKey = cmdBenchmark.Flag.String("s3.accessKey", "", "s3 access key, for -mode=s3")
+	b.s3SecretKey = cmdBenchmark.Flag.String("s3.secretKey", "", "s3 secret key, for -mode=s3")
+	b.readPercent = cmdBenchmark.Flag.Int("readPercent", 0, "if positive, run one mixed workload with this percent of reads, for -mode=filer or -mode=s3")
+	b.sizeDistribution = cmdBenchmark.Flag.String("sizes", "", "object size distribution with weights, e.g. 4KB:50,64KB:30,1MB:20, for -mode=filer or -mode=s3")
+	b.concurrencySweep = cmdBenchmark.Flag.String("concurrencySweep", "", "repeat the workload with each concurrency level, e.g. 1,4,16,64, for -mode=filer or -mode=s3")
 	sharedBytes = make([]byte, 1024)
 }
 
@@ -101,6 +121,11 @@ var cmdBenchmark = &Command{
   After benchmarking, you can clean up the written data by deleting the benchmark collection
     http://localhost:9333/col/delete?collection=benchmark
 
+  With "-mode=filer" or "-mode=s3", the objects are written and read through the filer or the s3 gateway,
+  so the numbers include the gateway overhead:
+    weed benchmark -mode=filer -filer=localhost:8888 -n=10000 -sizes=4KB:50,64KB:30,1MB:20
+    weed benchmark -mode=s3 -s3.endpoint=localhost:8333 -readPercent=80 -concurrencySweep=1,4,16,64
+
   `,
 }
 
@@ -129,6 +154,22 @@ func runBenchmark(cmd *Command, args []string) bool {
 		defer pprof.StopCPUProfile()
 	}
 
+	switch *b.mode {
+	case "filer":
+		return runGatewayBenchmark(newFilerBenchmarkTarget(*b.filer, *b.filerPath))
+	case "s3":
+		target, err := newS3BenchmarkTarget(*b.s3Endpoint, *b.s3Bucket, *b.s3AccessKey, *b.s3SecretKey)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return false
+		}
+		return runGatewayBenchmark(target)
+	case "volume":
+	default:
+		fmt.Printf("unknown benchmark mode %s\n", *b.mode)
+		return false
+	}
+
 	b.masterClient = wdclient.NewMasterClient(b.grpcDialOption, "client", "", 0, "", strings.Split(*b.masters, ","))
 	go b.masterClient.KeepConnectedToMaster()
 	b.masterClient.WaitUntilConnected()
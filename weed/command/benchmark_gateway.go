@@ -0,0 +1,316 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// benchmarkTarget is a gateway that objects can be written to and read from by name
+type benchmarkTarget interface {
+	Put(name string, data []byte) error
+	Get(name string) (int64, error)
+}
+
+type filerBenchmarkTarget struct {
+	filerUrl string
+}
+
+func newFilerBenchmarkTarget(filer, dir string) *filerBenchmarkTarget {
+	return &filerBenchmarkTarget{
+		filerUrl: util.NormalizeUrl(filer) + "/" + strings.Trim(dir, "/"),
+	}
+}
+
+func (t *filerBenchmarkTarget) Put(name string, data []byte) error {
+	req, err := http.NewRequest("PUT", t.filerUrl+"/"+name, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "image/bench") // prevent gzip benchmark content
+	resp, err := util.Do(req)
+	if err != nil {
+		return err
+	}
+	defer util.CloseResponse(resp)
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("put %s: %s", name, resp.Status)
+	}
+	return nil
+}
+
+func (t *filerBenchmarkTarget) Get(name string) (int64, error) {
+	resp, err := http.Get(t.filerUrl + "/" + name)
+	if err != nil {
+		return 0, err
+	}
+	defer util.CloseResponse(resp)
+	if resp.StatusCode >= 400 {
+		return 0, fmt.Errorf("get %s: %s", name, resp.Status)
+	}
+	return io.Copy(ioutil.Discard, resp.Body)
+}
+
+type s3BenchmarkTarget struct {
+	conn   *s3.S3
+	bucket string
+}
+
+func newS3BenchmarkTarget(endpoint, bucket, accessKey, secretKey string) (*s3BenchmarkTarget, error) {
+	config := &aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(util.NormalizeUrl(endpoint)),
+		S3ForcePathStyle: aws.Bool(true),
+		DisableSSL:       aws.Bool(!strings.HasPrefix(endpoint, "https://")),
+	}
+	if accessKey != "" && secretKey != "" {
+		config.Credentials = credentials.NewStaticCredentials(accessKey, secretKey, "")
+	} else {
+		config.Credentials = credentials.AnonymousCredentials
+	}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, fmt.Errorf("create aws session: %v", err)
+	}
+	t := &s3BenchmarkTarget{
+		conn:   s3.New(sess),
+		bucket: bucket,
+	}
+	// the bucket may already exist
+	t.conn.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	return t, nil
+}
+
+func (t *s3BenchmarkTarget) Put(name string, data []byte) error {
+	_, err := t.conn.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(t.bucket),
+		Key:         aws.String(name),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("image/bench"),
+	})
+	return err
+}
+
+func (t *s3BenchmarkTarget) Get(name string) (int64, error) {
+	output, err := t.conn.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(t.bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer output.Body.Close()
+	return io.Copy(ioutil.Discard, output.Body)
+}
+
+// objectSizeDistribution picks object sizes by weight, e.g. "4KB:50,64KB:30,1MB:20"
+type objectSizeDistribution struct {
+	sizes       []int64
+	weights     []int
+	totalWeight int
+}
+
+func parseObjectSizeDistribution(spec string, defaultSize int) (*objectSizeDistribution, error) {
+	d := &objectSizeDistribution{}
+	if spec == "" {
+		d.sizes, d.weights, d.totalWeight = []int64{int64(defaultSize)}, []int{1}, 1
+		return d, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		sizeAndWeight := strings.SplitN(strings.TrimSpace(part), ":", 2)
+		size, err := util.ParseBytes(sizeAndWeight[0])
+		if err != nil {
+			return nil, fmt.Errorf("parse size %s: %v", sizeAndWeight[0], err)
+		}
+		weight := 1
+		if len(sizeAndWeight) == 2 {
+			if weight, err = strconv.Atoi(sizeAndWeight[1]); err != nil || weight < 0 {
+				return nil, fmt.Errorf("parse weight %s: %v", sizeAndWeight[1], err)
+			}
+		}
+		d.sizes = append(d.sizes, int64(size))
+		d.weights = append(d.weights, weight)
+		d.totalWeight += weight
+	}
+	if d.totalWeight <= 0 {
+		return nil, fmt.Errorf("size distribution %s has no positive weight", spec)
+	}
+	return d, nil
+}
+
+func (d *objectSizeDistribution) pick(random *rand.Rand) int64 {
+	x := random.Intn(d.totalWeight)
+	for i, w := range d.weights {
+		if x < w {
+			return d.sizes[i]
+		}
+		x -= w
+	}
+	return d.sizes[len(d.sizes)-1]
+}
+
+func (d *objectSizeDistribution) max() (m int64) {
+	for _, size := range d.sizes {
+		if size > m {
+			m = size
+		}
+	}
+	return
+}
+
+// objectNames is the list of written objects, shared by all workers for the mixed workload
+type objectNames struct {
+	sync.RWMutex
+	names []string
+}
+
+func (o *objectNames) add(name string) {
+	o.Lock()
+	o.names = append(o.names, name)
+	o.Unlock()
+}
+
+func (o *objectNames) pick(random *rand.Rand) (string, bool) {
+	o.RLock()
+	defer o.RUnlock()
+	if len(o.names) == 0 {
+		return "", false
+	}
+	return o.names[random.Intn(len(o.names))], true
+}
+
+func runGatewayBenchmark(target benchmarkTarget) bool {
+
+	sizes, err := parseObjectSizeDistribution(*b.sizeDistribution, *b.fileSize)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return false
+	}
+
+	levels := []int{*b.concurrency}
+	if *b.concurrencySweep != "" {
+		levels = nil
+		for _, c := range strings.Split(*b.concurrencySweep, ",") {
+			level, err := strconv.Atoi(strings.TrimSpace(c))
+			if err != nil || level <= 0 {
+				fmt.Printf("invalid concurrency %s in -concurrencySweep\n", c)
+				return false
+			}
+			levels = append(levels, level)
+		}
+	}
+
+	for _, level := range levels {
+		*b.concurrency = level
+		names := &objectNames{}
+		prefix := fmt.Sprintf("c%d-%d", level, time.Now().UnixNano())
+		if *b.readPercent > 0 {
+			benchGatewayMixed(target, sizes, names, prefix)
+			continue
+		}
+		if *b.write {
+			benchGatewayPhase("Writing Benchmark", target, sizes, names, prefix, 0)
+		}
+		if *b.read {
+			benchGatewayPhase("Randomly Reading Benchmark", target, sizes, names, prefix, 100)
+		}
+	}
+	return true
+}
+
+func benchGatewayPhase(testName string, target benchmarkTarget, sizes *objectSizeDistribution, names *objectNames, prefix string, readPercent int) {
+	phaseStats := newStats(*b.concurrency)
+	runGatewayWorkers(testName, target, sizes, names, prefix, readPercent, phaseStats, phaseStats)
+	phaseStats.printStats()
+}
+
+func benchGatewayMixed(target benchmarkTarget, sizes *objectSizeDistribution, names *objectNames, prefix string) {
+	gatewayReadStats, gatewayWriteStats := newStats(*b.concurrency), newStats(*b.concurrency)
+	runGatewayWorkers(fmt.Sprintf("Mixed Benchmark %d%% reads", *b.readPercent), target, sizes, names, prefix, *b.readPercent, gatewayReadStats, gatewayWriteStats)
+	fmt.Printf("\n------------ Reads ----------\n")
+	gatewayReadStats.printStats()
+	fmt.Printf("\n------------ Writes ----------\n")
+	gatewayWriteStats.printStats()
+}
+
+func runGatewayWorkers(testName string, target benchmarkTarget, sizes *objectSizeDistribution, names *objectNames, prefix string, readPercent int, gatewayReadStats, gatewayWriteStats *stats) {
+	finishChan := make(chan bool)
+	idChan := make(chan int)
+	progressStats := gatewayWriteStats
+	if readPercent >= 100 {
+		progressStats = gatewayReadStats
+	}
+	progressStats.total = *b.numberOfFiles
+
+	start := time.Now()
+	gatewayReadStats.start, gatewayWriteStats.start = start, start
+	go progressStats.checkProgress(testName, finishChan)
+
+	for i := 0; i < *b.concurrency; i++ {
+		wait.Add(1)
+		go func(readStat, writeStat *stat) {
+			defer wait.Done()
+			random := rand.New(rand.NewSource(time.Now().UnixNano()))
+			buf := make([]byte, sizes.max())
+			random.Read(buf)
+			for id := range idChan {
+				if readPercent > 0 && random.Intn(100) < readPercent {
+					if name, found := names.pick(random); found {
+						opStart := time.Now()
+						if n, err := target.Get(name); err == nil {
+							readStat.completed++
+							readStat.transferred += n
+							gatewayReadStats.addSample(time.Since(opStart))
+						} else {
+							readStat.failed++
+							fmt.Printf("Failed to read %s error:%v\n", name, err)
+						}
+						continue
+					}
+					if readPercent >= 100 {
+						readStat.failed++
+						continue
+					}
+				}
+				name := fmt.Sprintf("%s-%d", prefix, id)
+				size := sizes.pick(random)
+				opStart := time.Now()
+				if err := target.Put(name, buf[:size]); err == nil {
+					names.add(name)
+					writeStat.completed++
+					writeStat.transferred += size
+					gatewayWriteStats.addSample(time.Since(opStart))
+				} else {
+					writeStat.failed++
+					fmt.Printf("Failed to write %s error:%v\n", name, err)
+				}
+			}
+		}(&gatewayReadStats.localStats[i], &gatewayWriteStats.localStats[i])
+	}
+	for i := 0; i < *b.numberOfFiles; i++ {
+		idChan <- i
+	}
+	close(idChan)
+	wait.Wait()
+
+	end := time.Now()
+	gatewayReadStats.end, gatewayWriteStats.end = end, end
+	wait.Add(1)
+	finishChan <- true
+	wait.Wait()
+	close(finishChan)
+}
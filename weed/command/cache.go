@@ -0,0 +1,96 @@
+package command
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/cache_pb"
+	weed_server "github.com/chrislusf/seaweedfs/weed/server"
+	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/chunk_cache"
+	"github.com/chrislusf/seaweedfs/weed/util/grace"
+)
+
+var (
+	cacheOptions CacheOptions
+)
+
+type CacheOptions struct {
+	dir        *string
+	capacityMB *int64
+	socket     *string
+	socketMode *string
+	cpuprofile *string
+	memprofile *string
+}
+
+func init() {
+	cmdCache.Run = runCache // break init cycle
+	cacheOptions.dir = cmdCache.Flag.String("dir", filepath.Join(os.TempDir(), "seaweedfs_cache"), "directory to store the cached chunks, preferably on a local NVMe drive")
+	cacheOptions.capacityMB = cmdCache.Flag.Int64("capacityMB", 10000, "chunk cache capacity in MB")
+	cacheOptions.socket = cmdCache.Flag.String("socket", "/tmp/seaweedfs_cache.sock", "unix socket to serve the chunk cache")
+	cacheOptions.socketMode = cmdCache.Flag.String("socket.mode", "0660", "octal file mode of the unix socket, to allow other users to use the cache")
+	cacheOptions.cpuprofile = cmdCache.Flag.String("cpuprofile", "", "cpu profile output file")
+	cacheOptions.memprofile = cmdCache.Flag.String("memprofile", "", "memory profile output file")
+}
+
+var cmdCache = &Command{
+	UsageLine: "cache [-dir=/nvme/cache] [-capacityMB=10000] [-socket=/tmp/seaweedfs_cache.sock]",
+	Short:     "start a chunk cache shared by the mounts and webdav servers on the same host",
+	Long: `start a chunk cache shared by the mounts and webdav servers on the same host
+
+	The file chunks are cached in memory and on the local disk, and served via gRPC on a unix socket.
+	Start "weed mount" or "weed webdav" with "-cacheService=<socket>" to use it,
+	so that many containers on one host share a single cache instead of each keeping its own.
+
+	The chunks are identified by their file ids, which never change, so the cache needs no invalidation.
+
+`,
+}
+
+func runCache(cmd *Command, args []string) bool {
+
+	grace.SetupProfiling(*cacheOptions.cpuprofile, *cacheOptions.memprofile)
+
+	socketMode, err := strconv.ParseUint(*cacheOptions.socketMode, 8, 32)
+	if err != nil {
+		glog.Fatalf("invalid -socket.mode %s: %v", *cacheOptions.socketMode, err)
+	}
+
+	if err := os.MkdirAll(*cacheOptions.dir, 0755); err != nil {
+		glog.Fatalf("create cache directory %s: %v", *cacheOptions.dir, err)
+	}
+	chunkCache := chunk_cache.NewTieredChunkCache(256, *cacheOptions.dir, *cacheOptions.capacityMB, 1024*1024)
+
+	// remove the socket left by a previous process
+	if err := os.Remove(*cacheOptions.socket); err != nil && !os.IsNotExist(err) {
+		glog.Fatalf("remove unix socket %s: %v", *cacheOptions.socket, err)
+	}
+	listener, err := net.Listen("unix", *cacheOptions.socket)
+	if err != nil {
+		glog.Fatalf("failed to listen on unix socket %s: %v", *cacheOptions.socket, err)
+	}
+	if err := os.Chmod(*cacheOptions.socket, os.FileMode(socketMode)); err != nil {
+		glog.Fatalf("chmod unix socket %s: %v", *cacheOptions.socket, err)
+	}
+
+	grpcS := pb.NewGrpcServer()
+	cache_pb.RegisterSeaweedCacheServer(grpcS, weed_server.NewCacheServer(chunkCache))
+
+	grace.OnInterrupt(func() {
+		grpcS.Stop()
+		chunkCache.Shutdown()
+		os.Remove(*cacheOptions.socket)
+	})
+
+	glog.V(0).Infof("Start Seaweed Cache %s on %s, caching %d MB in %s", util.Version(), *cacheOptions.socket, *cacheOptions.capacityMB, *cacheOptions.dir)
+	if err := grpcS.Serve(listener); err != nil {
+		glog.Fatalf("cache server on %s: %v", *cacheOptions.socket, err)
+	}
+
+	return true
+}
@@ -10,8 +10,10 @@ import (
 var Commands = []*Command{
 	cmdBenchmark,
 	cmdBackup,
+	cmdCache,
 	cmdCompact,
 	cmdCopy,
+	cmdDockerVolume,
 	cmdDownload,
 	cmdExport,
 	cmdFiler,
@@ -21,11 +23,13 @@ var Commands = []*Command{
 	cmdFilerMetaTail,
 	cmdFilerReplicate,
 	cmdFilerSynchronize,
+	cmdFilerVerify,
 	cmdFix,
 	cmdFuse,
 	cmdGateway,
 	cmdMaster,
 	cmdMount,
+	cmdNbd,
 	cmdS3,
 	cmdIam,
 	cmdMsgBroker,
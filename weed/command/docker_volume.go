@@ -0,0 +1,52 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+)
+
+var (
+	dockerVolumeOptions DockerVolumeOptions
+)
+
+type DockerVolumeOptions struct {
+	filer           *string
+	filerPath       *string
+	socket          *string
+	mountRoot       *string
+	cacheDir        *string
+	cacheSizeMB     *int64
+	mountTimeoutSec *int
+}
+
+func init() {
+	cmdDockerVolume.Run = runDockerVolume // break init cycle
+	dockerVolumeOptions.filer = cmdDockerVolume.Flag.String("filer", "localhost:8888", "filer server address")
+	dockerVolumeOptions.filerPath = cmdDockerVolume.Flag.String("filer.path", "/docker/volumes", "the filer directory of the volumes")
+	dockerVolumeOptions.socket = cmdDockerVolume.Flag.String("socket", "/run/docker/plugins/seaweedfs.sock", "the unix socket of the plugin, which docker finds by its name")
+	dockerVolumeOptions.mountRoot = cmdDockerVolume.Flag.String("mountRoot", "/var/lib/seaweedfs/docker/volumes", "local directory of the volume mountpoints")
+	dockerVolumeOptions.cacheDir = cmdDockerVolume.Flag.String("cacheDir", filepath.Join(os.TempDir(), "docker"), "local cache directory of the volume mounts")
+	dockerVolumeOptions.cacheSizeMB = cmdDockerVolume.Flag.Int64("cacheCapacityMB", 1000, "local file chunk cache capacity in MB of each volume mount")
+	dockerVolumeOptions.mountTimeoutSec = cmdDockerVolume.Flag.Int("mountTimeoutSeconds", 30, "wait for the volume to be mounted or unmounted")
+}
+
+var cmdDockerVolume = &Command{
+	UsageLine: "docker.volume -filer=<ip:port> [-socket=/run/docker/plugins/seaweedfs.sock]",
+	Short:     "run a docker volume plugin, to create and mount volumes for containers",
+	Long: `run a docker volume plugin, to create and mount volumes for containers
+
+	The plugin implements the docker volume plugin protocol on a unix socket. Each volume is a directory
+	under -filer.path, and is mounted with "weed mount" when the first container using it starts,
+	and unmounted when the last container using it stops.
+
+		weed docker.volume -filer=localhost:8888
+		docker volume create -d seaweedfs -o collection=app -o replication=001 appdata
+		docker run -v appdata:/data ...
+
+	The volume options are:
+		collection, replication, disk, ttl, chunkSizeLimitMB, readOnly
+
+	The plugin needs to run as root, and needs FUSE, the same as "weed mount".
+
+`,
+}
@@ -0,0 +1,16 @@
+// +build !linux
+// +build !darwin
+// +build !freebsd
+
+package command
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func runDockerVolume(cmd *Command, args []string) bool {
+	fmt.Printf("Docker volume plugin is not supported on %s %s\n", runtime.GOOS, runtime.GOARCH)
+
+	return true
+}
@@ -0,0 +1,156 @@
+// +build linux darwin freebsd
+
+package command
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/seaweedfs/fuse"
+
+	"github.com/chrislusf/seaweedfs/weed/dockervolume"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/grace"
+)
+
+func runDockerVolume(cmd *Command, args []string) bool {
+
+	util.LoadConfiguration("security", false)
+
+	filerGrpcAddress, err := pb.ParseServerToGrpcAddress(*dockerVolumeOptions.filer)
+	if err != nil {
+		glog.Fatal(err)
+		return false
+	}
+
+	weedBinary, err := os.Executable()
+	if err != nil {
+		glog.Fatalf("find weed executable: %v", err)
+	}
+
+	driver := dockervolume.NewVolumeDriver(&dockervolume.VolumeDriverOption{
+		FilerGrpcAddress: filerGrpcAddress,
+		GrpcDialOption:   security.LoadClientTLS(util.GetViper(), "grpc.client"),
+		FilerPath:        util.FullPath(*dockerVolumeOptions.filerPath),
+		MountRoot:        util.ResolvePath(*dockerVolumeOptions.mountRoot),
+		Mounter: &weedMounter{
+			weedBinary:   weedBinary,
+			filer:        *dockerVolumeOptions.filer,
+			cacheDir:     util.ResolvePath(*dockerVolumeOptions.cacheDir),
+			cacheSizeMB:  *dockerVolumeOptions.cacheSizeMB,
+			mountTimeout: time.Duration(*dockerVolumeOptions.mountTimeoutSec) * time.Second,
+		},
+	})
+	grace.OnInterrupt(driver.UnmountAll)
+
+	socket := util.ResolvePath(*dockerVolumeOptions.socket)
+	if err = os.MkdirAll(filepath.Dir(socket), 0755); err != nil {
+		glog.Fatalf("create socket directory: %v", err)
+	}
+	os.Remove(socket)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		glog.Fatalf("docker volume plugin listener on %s error: %v", socket, err)
+	}
+	grace.OnInterrupt(func() {
+		os.Remove(socket)
+	})
+
+	mux := http.NewServeMux()
+	driver.RegisterHandlers(mux)
+
+	glog.V(0).Infof("Start Seaweed Docker Volume Plugin %s at %s, volumes in %s", util.Version(), socket, *dockerVolumeOptions.filerPath)
+	if err = http.Serve(listener, mux); err != nil {
+		glog.Fatalf("docker volume plugin fail to serve: %v", err)
+	}
+
+	return true
+}
+
+// weedMounter runs "weed mount" as a child process for each mounted volume
+type weedMounter struct {
+	weedBinary   string
+	filer        string
+	cacheDir     string
+	cacheSizeMB  int64
+	mountTimeout time.Duration
+}
+
+func (m *weedMounter) Mount(filerPath util.FullPath, mountpoint string, options map[string]string) (unmount func() error, err error) {
+
+	if !checkMountPointAvailable(mountpoint) {
+		// left over by a previous plugin process that did not exit cleanly
+		fuse.Unmount(mountpoint)
+	}
+
+	args := []string{
+		"mount",
+		"-filer=" + m.filer,
+		"-filer.path=" + string(filerPath),
+		"-dir=" + mountpoint,
+		"-cacheDir=" + m.cacheDir,
+		fmt.Sprintf("-cacheCapacityMB=%d", m.cacheSizeMB),
+	}
+	var keys []string
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, fmt.Sprintf("-%s=%s", key, options[key]))
+	}
+
+	cmd := exec.Command(m.weedBinary, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	// wait for the mountpoint to be mounted
+	deadline := time.Now().Add(m.mountTimeout)
+	for checkMountPointAvailable(mountpoint) {
+		select {
+		case err = <-exited:
+			if err == nil {
+				return nil, fmt.Errorf("weed mount exited before mounting %s", mountpoint)
+			}
+			return nil, fmt.Errorf("weed mount exited: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			return nil, fmt.Errorf("weed mount timed out after %v", m.mountTimeout)
+		}
+	}
+
+	unmount = func() error {
+		// weed mount unmounts the directory when interrupted
+		cmd.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-exited:
+		case <-time.After(m.mountTimeout):
+			cmd.Process.Kill()
+			<-exited
+		}
+		if !checkMountPointAvailable(mountpoint) {
+			return fuse.Unmount(mountpoint)
+		}
+		return nil
+	}
+	return unmount, nil
+}
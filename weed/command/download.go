@@ -1,15 +1,20 @@
 package command
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
@@ -18,14 +23,20 @@ var (
 )
 
 type DownloadOptions struct {
-	server *string
-	dir    *string
+	server      *string
+	dir         *string
+	concurrency *int
+	rangeSizeMB *int
+	verify      *bool
 }
 
 func init() {
 	cmdDownload.Run = runDownload // break init cycle
 	d.server = cmdDownload.Flag.String("server", "localhost:9333", "SeaweedFS master location")
 	d.dir = cmdDownload.Flag.String("dir", ".", "Download the whole folder recursively if specified.")
+	d.concurrency = cmdDownload.Flag.Int("c", 4, "number of concurrent range requests for each file")
+	d.rangeSizeMB = cmdDownload.Flag.Int("rangeSizeMB", 8, "size of each range request")
+	d.verify = cmdDownload.Flag.Bool("verify", true, "verify the downloaded content against the checksum on the volume server")
 }
 
 var cmdDownload = &Command{
@@ -39,6 +50,11 @@ var cmdDownload = &Command{
   What's more, if you use "weed upload -maxMB=..." option to upload a big file divided into chunks, you can
   use this tool to download the chunks and merge them automatically.
 
+  Large files are fetched with "-c" concurrent range requests, spread across all replicas of the volume.
+  The progress is saved next to the file as <filename>.part and <filename>.part.json, so running the
+  same command again resumes an interrupted download instead of starting over.
+  With "-verify", the downloaded content is checked against the needle checksum when it is not compressed.
+
   `,
 }
 
@@ -52,53 +68,303 @@ func runDownload(cmd *Command, args []string) bool {
 }
 
 func downloadToFile(masterFn operation.GetMasterFn, fileId, saveDir string) error {
-	fileUrl, lookupError := operation.LookupFileId(masterFn, fileId)
+	locations, lookupError := lookupFileIdUrls(masterFn, fileId)
 	if lookupError != nil {
 		return lookupError
 	}
-	filename, _, rc, err := util.DownloadFile(fileUrl)
+	info, err := headDownloadFile(locations)
 	if err != nil {
 		return err
 	}
-	defer util.CloseResponse(rc)
+	filename := info.filename
 	if filename == "" {
 		filename = fileId
 	}
-	isFileList := false
 	if strings.HasSuffix(filename, "-list") {
 		// old command compatible
-		isFileList = true
-		filename = filename[0 : len(filename)-len("-list")]
+		return downloadFileList(masterFn, locations[0], path.Join(saveDir, filename[0:len(filename)-len("-list")]))
+	}
+	if !info.acceptRanges || info.size <= 0 {
+		return downloadWhole(locations[0], path.Join(saveDir, filename))
+	}
+	return downloadRanges(fileId, locations, info, path.Join(saveDir, filename))
+}
+
+func lookupFileIdUrls(masterFn operation.GetMasterFn, fileId string) (fileUrls []string, err error) {
+	parts := strings.Split(fileId, ",")
+	if len(parts) != 2 {
+		return nil, errors.New("Invalid fileId " + fileId)
+	}
+	lookup, err := operation.Lookup(masterFn, parts[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, loc := range lookup.Locations {
+		fileUrls = append(fileUrls, "http://"+loc.Url+"/"+fileId)
+	}
+	if len(fileUrls) == 0 {
+		return nil, errors.New("File Not Found")
+	}
+	return
+}
+
+type downloadFileInfo struct {
+	filename     string
+	size         int64
+	etag         string
+	checksum     string // <algorithm>=<hex> of the needle checksum
+	acceptRanges bool
+	isCompressed bool
+	isChunked    bool
+}
+
+func headDownloadFile(fileUrls []string) (info *downloadFileInfo, err error) {
+	for _, fileUrl := range fileUrls {
+		var header, compressedHeader http.Header
+		if header, err = headWithEncoding(fileUrl, "identity"); err != nil {
+			continue
+		}
+		if compressedHeader, err = headWithEncoding(fileUrl, "gzip"); err != nil {
+			continue
+		}
+		info = &downloadFileInfo{
+			filename:     parseContentDispositionFilename(header.Get("Content-Disposition")),
+			etag:         strings.Trim(header.Get("Etag"), "\""),
+			checksum:     header.Get("X-Seaweed-Checksum"),
+			acceptRanges: header.Get("Accept-Ranges") == "bytes",
+			isCompressed: compressedHeader.Get("Content-Encoding") != "",
+			isChunked:    header.Get("X-File-Store") == "chunked",
+		}
+		info.size, _ = strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+		return info, nil
+	}
+	return nil, err
+}
+
+func headWithEncoding(fileUrl string, acceptEncoding string) (http.Header, error) {
+	req, err := http.NewRequest("HEAD", fileUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	resp, err := util.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer util.CloseResponse(resp)
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("%s: %s", fileUrl, resp.Status)
+	}
+	return resp.Header, nil
+}
+
+func parseContentDispositionFilename(contentDisposition string) (filename string) {
+	idx := strings.Index(contentDisposition, "filename=")
+	if idx != -1 {
+		filename = contentDisposition[idx+len("filename="):]
+		filename = strings.Trim(filename, "\"")
+	}
+	return
+}
+
+func downloadFileList(masterFn operation.GetMasterFn, fileUrl, savePath string) error {
+	_, _, rc, err := util.DownloadFile(fileUrl)
+	if err != nil {
+		return err
 	}
-	f, err := os.OpenFile(path.Join(saveDir, filename), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	defer util.CloseResponse(rc)
+	f, err := os.OpenFile(savePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	if isFileList {
-		content, err := ioutil.ReadAll(rc.Body)
+	content, err := ioutil.ReadAll(rc.Body)
+	if err != nil {
+		return err
+	}
+	fids := strings.Split(string(content), "\n")
+	for _, partId := range fids {
+		var n int
+		_, part, err := fetchContent(masterFn, partId)
+		if err == nil {
+			n, err = f.Write(part)
+		}
+		if err == nil && n < len(part) {
+			err = io.ErrShortWrite
+		}
 		if err != nil {
 			return err
 		}
-		fids := strings.Split(string(content), "\n")
-		for _, partId := range fids {
-			var n int
-			_, part, err := fetchContent(masterFn, partId)
-			if err == nil {
-				n, err = f.Write(part)
-			}
-			if err == nil && n < len(part) {
-				err = io.ErrShortWrite
-			}
-			if err != nil {
-				return err
+	}
+	return nil
+}
+
+func downloadWhole(fileUrl, savePath string) error {
+	_, _, rc, err := util.DownloadFile(fileUrl)
+	if err != nil {
+		return err
+	}
+	defer util.CloseResponse(rc)
+	f, err := os.OpenFile(savePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, rc.Body)
+	return err
+}
+
+// downloadState is persisted as <filename>.part.json to resume an interrupted download
+type downloadState struct {
+	FileId    string `json:"fileId"`
+	Size      int64  `json:"size"`
+	Etag      string `json:"etag"`
+	RangeSize int64  `json:"rangeSize"`
+	Done      []bool `json:"done"`
+}
+
+func loadDownloadState(statePath string, fileId string, info *downloadFileInfo, rangeSize int64) *downloadState {
+	rangeCount := int((info.size + rangeSize - 1) / rangeSize)
+	fresh := &downloadState{
+		FileId:    fileId,
+		Size:      info.size,
+		Etag:      info.etag,
+		RangeSize: rangeSize,
+		Done:      make([]bool, rangeCount),
+	}
+	data, err := ioutil.ReadFile(statePath)
+	if err != nil {
+		return fresh
+	}
+	state := &downloadState{}
+	if err = json.Unmarshal(data, state); err != nil {
+		return fresh
+	}
+	if state.FileId != fresh.FileId || state.Size != fresh.Size || state.Etag != fresh.Etag || state.RangeSize != fresh.RangeSize || len(state.Done) != rangeCount {
+		return fresh
+	}
+	return state
+}
+
+func downloadRanges(fileId string, fileUrls []string, info *downloadFileInfo, savePath string) error {
+
+	rangeSize := int64(*d.rangeSizeMB) * 1024 * 1024
+	if rangeSize <= 0 {
+		rangeSize = 8 * 1024 * 1024
+	}
+	partPath, statePath := savePath+".part", savePath+".part.json"
+	state := loadDownloadState(statePath, fileId, info, rangeSize)
+
+	f, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var stateLock sync.Mutex
+	saveState := func(index int) error {
+		stateLock.Lock()
+		defer stateLock.Unlock()
+		state.Done[index] = true
+		data, _ := json.Marshal(state)
+		return ioutil.WriteFile(statePath, data, 0644)
+	}
+
+	concurrency := *d.concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	var wg sync.WaitGroup
+	var errLock sync.Mutex
+	var firstErr error
+	rangeChan := make(chan int, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range rangeChan {
+				offset := int64(index) * rangeSize
+				size := rangeSize
+				if offset+size > info.size {
+					size = info.size - offset
+				}
+				err := downloadOneRange(fileUrls, index, f, offset, size)
+				if err == nil {
+					err = saveState(index)
+				}
+				if err != nil {
+					errLock.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errLock.Unlock()
+				}
 			}
+		}()
+	}
+	for index, done := range state.Done {
+		if !done {
+			rangeChan <- index
 		}
-	} else {
-		if _, err = io.Copy(f, rc.Body); err != nil {
+	}
+	close(rangeChan)
+	wg.Wait()
+	if firstErr != nil {
+		return fmt.Errorf("download %s: %v, run again to resume", fileId, firstErr)
+	}
+
+	if *d.verify && !info.isCompressed && !info.isChunked {
+		var mismatch string
+		if mismatch, err = verifyDownloadChecksum(f, info.checksum); err != nil {
 			return err
 		}
+		if mismatch != "" {
+			os.Remove(statePath)
+			os.Remove(partPath)
+			return fmt.Errorf("download %s: %s", fileId, mismatch)
+		}
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+	os.Remove(statePath)
+	return os.Rename(partPath, savePath)
+}
+
+// downloadOneRange starts from a different replica for each range, and falls back to the other replicas
+func downloadOneRange(fileUrls []string, index int, f *os.File, offset, size int64) (err error) {
+	for i := 0; i < len(fileUrls); i++ {
+		fileUrl := fileUrls[(index+i)%len(fileUrls)]
+		if err = downloadRangeFrom(fileUrl, f, offset, size); err == nil {
+			return nil
+		}
+		fmt.Printf("download range %d-%d from %s: %v\n", offset, offset+size-1, fileUrl, err)
+	}
+	return err
+}
 
+func downloadRangeFrom(fileUrl string, f *os.File, offset, size int64) error {
+	req, err := http.NewRequest("GET", fileUrl, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept-Encoding", "identity")
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+size-1))
+	resp, err := util.Do(req)
+	if err != nil {
+		return err
+	}
+	defer util.CloseResponse(resp)
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("%s: %s", fileUrl, resp.Status)
+	}
+	written, err := io.Copy(&offsetWriter{w: f, offset: offset}, io.LimitReader(resp.Body, size))
+	if err != nil {
+		return err
+	}
+	if written != size {
+		return io.ErrUnexpectedEOF
 	}
 	return nil
 }
@@ -129,3 +395,40 @@ func WriteFile(filename string, data []byte, perm os.FileMode) error {
 	}
 	return err
 }
+
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (o *offsetWriter) Write(p []byte) (n int, err error) {
+	n, err = o.w.WriteAt(p, o.offset)
+	o.offset += int64(n)
+	return
+}
+
+// verifyDownloadChecksum checks the file against the X-Seaweed-Checksum header, <algorithm>=<hex>,
+// with the checksum algorithm of the volume, and describes the mismatch if any. Unknown algorithms are not verified.
+func verifyDownloadChecksum(f *os.File, checksum string) (mismatch string, err error) {
+	parts := strings.SplitN(checksum, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", nil
+	}
+	algorithm, parseErr := needle.ParseChecksumAlgorithm(parts[0])
+	if parseErr != nil {
+		return "", nil
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	h := needle.NewChecksum(algorithm)
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	bits := make([]byte, 4)
+	util.Uint32toBytes(bits, h.Sum32())
+	if actual := fmt.Sprintf("%x", bits); actual != parts[1] {
+		return fmt.Sprintf("%s checksum %s does not match expected %s", algorithm, actual, parts[1]), nil
+	}
+	return "", nil
+}
@@ -13,8 +13,13 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/storage"
+	"github.com/chrislusf/seaweedfs/weed/storage/backend"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle_map"
 	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
@@ -44,6 +49,15 @@ var cmdExport = &Command{
 
 	The format of file name in the tar file can be customized. Default is {{.Mime}}/{{.Id}}:{{.Name}}. Also available is {{.Key}}.
 
+	If -volumeId is not specified, all volumes of the -collection in the -dir are exported.
+	Files can be filtered by -newer, -older, -ttl and -prefix of the file name.
+
+	If the output is s3://bucket/path/prefix, the files are uploaded to the S3 bucket instead,
+	with credentials from the usual AWS environment variables or shared config.
+
+	The volume files are only read, and only the data present when the export starts is exported,
+	so it is safe to export a volume that is being written to by a running volume server.
+
   `,
 }
 
@@ -58,8 +72,13 @@ var (
 	output      = cmdExport.Flag.String("o", "", "output tar file name, must ends with .tar, or just a \"-\" for stdout")
 	format      = cmdExport.Flag.String("fileNameFormat", defaultFnFormat, "filename formatted with {{.Id}} {{.Name}} {{.Ext}}")
 	newer       = cmdExport.Flag.String("newer", "", "export only files newer than this time, default is all files. Must be specified in RFC3339 without timezone, e.g. 2006-01-02T15:04:05")
+	older       = cmdExport.Flag.String("older", "", "export only files older than this time, default is all files. Must be specified in RFC3339 without timezone, e.g. 2006-01-02T15:04:05")
+	ttlFilter   = cmdExport.Flag.String("ttl", "", "export only files with this ttl, e.g. 3d")
+	namePrefix  = cmdExport.Flag.String("prefix", "", "export only files with the name starting with this prefix")
 	showDeleted = cmdExport.Flag.Bool("deleted", false, "export deleted files. only applies if -o is not specified")
 	limit       = cmdExport.Flag.Int("limit", 0, "only show first n entries if specified")
+	s3Endpoint  = cmdExport.Flag.String("s3.endpoint", "", "s3 endpoint, for -o=s3://bucket/prefix, default to AWS")
+	s3Region    = cmdExport.Flag.String("s3.region", "us-east-1", "s3 region, for -o=s3://bucket/prefix")
 
 	tarOutputFile          *tar.Writer
 	tarHeader              tar.Header
@@ -67,7 +86,9 @@ var (
 	fileNameTemplateBuffer = bytes.NewBuffer(nil)
 	newerThan              time.Time
 	newerThanUnix          int64 = -1
-	localLocation, _             = time.LoadLocation("Local")
+	olderThanUnix          int64 = -1
+	s3Output               *exportS3Output
+	localLocation, _       = time.LoadLocation("Local")
 )
 
 func printNeedle(vid needle.VolumeId, n *needle.Needle, version needle.Version, deleted bool, offset int64, onDiskSize int64) {
@@ -119,11 +140,22 @@ func (scanner *VolumeFileScanner4Export) VisitNeedle(n *needle.Needle, offset in
 				n.LastModified, newerThanUnix)
 			return nil
 		}
+		if olderThanUnix >= 0 && n.HasLastModifiedDate() && n.LastModified >= uint64(olderThanUnix) {
+			glog.V(3).Infof("Skipping this file, as it's new enough: LastModified %d vs %d",
+				n.LastModified, olderThanUnix)
+			return nil
+		}
+		if *ttlFilter != "" && n.Ttl.String() != *ttlFilter {
+			return nil
+		}
+		if *namePrefix != "" && !strings.HasPrefix(string(n.Name), *namePrefix) {
+			return nil
+		}
 		scanner.counter++
 		if *limit > 0 && scanner.counter > *limit {
 			return io.EOF
 		}
-		if tarOutputFile != nil {
+		if tarOutputFile != nil || s3Output != nil {
 			return writeFile(vid, n)
 		} else {
 			printNeedle(vid, n, scanner.version, false, offset, n.DiskSize(scanner.version))
@@ -158,20 +190,45 @@ func runExport(cmd *Command, args []string) bool {
 		newerThanUnix = newerThan.Unix()
 	}
 
-	if *export.volumeId == -1 {
-		return false
+	if *older != "" {
+		olderThan, err := time.ParseInLocation(timeFormat, *older, localLocation)
+		if err != nil {
+			fmt.Println("cannot parse 'older' argument: " + err.Error())
+			return false
+		}
+		olderThanUnix = olderThan.Unix()
 	}
 
-	if *output != "" {
-		if *output != "-" && !strings.HasSuffix(*output, ".tar") {
-			fmt.Println("the output file", *output, "should be '-' or end with .tar")
+	if *ttlFilter != "" {
+		ttl, err := needle.ReadTTL(*ttlFilter)
+		if err != nil {
+			fmt.Println("cannot parse 'ttl' argument: " + err.Error())
 			return false
 		}
+		*ttlFilter = ttl.String()
+	}
 
+	if *export.volumeId == -1 && *export.collection == "" {
+		return false
+	}
+
+	if *output != "" {
 		if fileNameTemplate, err = template.New("name").Parse(*format); err != nil {
 			fmt.Println("cannot parse format " + *format + ": " + err.Error())
 			return false
 		}
+	}
+
+	if strings.HasPrefix(*output, "s3://") {
+		if s3Output, err = newExportS3Output(*output, *s3Endpoint, *s3Region); err != nil {
+			fmt.Println(err.Error())
+			return false
+		}
+	} else if *output != "" {
+		if *output != "-" && !strings.HasSuffix(*output, ".tar") {
+			fmt.Println("the output file", *output, "should be '-' or end with .tar, or start with s3://")
+			return false
+		}
 
 		var outputFile *os.File
 		if *output == "-" {
@@ -191,33 +248,170 @@ func runExport(cmd *Command, args []string) bool {
 			AccessTime: t, ChangeTime: t}
 	}
 
-	fileName := strconv.Itoa(*export.volumeId)
-	if *export.collection != "" {
-		fileName = *export.collection + "_" + fileName
+	var vids []needle.VolumeId
+	if *export.volumeId != -1 {
+		vids = append(vids, needle.VolumeId(*export.volumeId))
+	} else if vids, err = listCollectionVolumeIds(util.ResolvePath(*export.dir), *export.collection); err != nil {
+		fmt.Printf("list volumes of collection %s: %v\n", *export.collection, err)
+		return false
+	}
+
+	if tarOutputFile == nil && s3Output == nil {
+		fmt.Printf("key\tname\tsize\tgzip\tmime\tmodified\tttl\tdeleted\tstart\tstop\n")
+	}
+
+	counter := 0
+	for _, vid := range vids {
+		if counter, err = exportVolume(util.ResolvePath(*export.dir), *export.collection, vid, counter); err != nil && err != io.EOF {
+			glog.Errorf("Export Volume File [ERROR] %s\n", err)
+		}
+		if *limit > 0 && counter > *limit {
+			break
+		}
+	}
+	return true
+}
+
+func exportVolume(dir string, collection string, vid needle.VolumeId, counter int) (int, error) {
+	fileName := vid.String()
+	if collection != "" {
+		fileName = collection + "_" + fileName
 	}
-	vid := needle.VolumeId(*export.volumeId)
 
 	needleMap := needle_map.NewMemDb()
 	defer needleMap.Close()
 
-	if err := needleMap.LoadFromIdx(path.Join(util.ResolvePath(*export.dir), fileName+".idx")); err != nil {
-		glog.Fatalf("cannot load needle map from %s.idx: %s", fileName, err)
+	if err := needleMap.LoadFromIdx(path.Join(dir, fileName+".idx")); err != nil {
+		return counter, fmt.Errorf("cannot load needle map from %s.idx: %s", fileName, err)
 	}
 
 	volumeFileScanner := &VolumeFileScanner4Export{
 		needleMap: needleMap,
 		vid:       vid,
+		counter:   counter,
 	}
 
-	if tarOutputFile == nil {
-		fmt.Printf("key\tname\tsize\tgzip\tmime\tmodified\tttl\tdeleted\tstart\tstop\n")
+	err := scanVolumeFileReadOnly(path.Join(dir, fileName+".dat"), volumeFileScanner)
+	return volumeFileScanner.counter, err
+}
+
+// scanVolumeFileReadOnly only reads the data present when the scan starts,
+// so it can run against a volume that is still being appended to.
+func scanVolumeFileReadOnly(dataFileName string, volumeFileScanner storage.VolumeFileScanner) error {
+	dataFile, err := os.Open(dataFileName)
+	if err != nil {
+		return err
 	}
+	datBackend := backend.NewDiskFile(dataFile)
+	defer datBackend.Close()
 
-	err = storage.ScanVolumeFile(util.ResolvePath(*export.dir), *export.collection, vid, storage.NeedleMapInMemory, volumeFileScanner)
-	if err != nil && err != io.EOF {
-		glog.Errorf("Export Volume File [ERROR] %s\n", err)
+	superBlock, err := super_block.ReadSuperBlock(datBackend)
+	if err != nil {
+		return fmt.Errorf("read super block of %s: %v", dataFileName, err)
 	}
-	return true
+	if err = volumeFileScanner.VisitSuperBlock(superBlock); err != nil {
+		return err
+	}
+	fileSize, _, err := datBackend.GetStat()
+	if err != nil {
+		return err
+	}
+	return storage.ScanVolumeFileFrom(superBlock.Version, &sizeLimitedBackend{datBackend, fileSize}, int64(superBlock.BlockSize()), volumeFileScanner)
+}
+
+type sizeLimitedBackend struct {
+	backend.BackendStorageFile
+	size int64
+}
+
+func (b *sizeLimitedBackend) ReadAt(p []byte, off int64) (n int, err error) {
+	if off >= b.size {
+		return 0, io.EOF
+	}
+	if off+int64(len(p)) > b.size {
+		n, err = b.BackendStorageFile.ReadAt(p[:b.size-off], off)
+		if err == nil {
+			err = io.EOF
+		}
+		return
+	}
+	return b.BackendStorageFile.ReadAt(p, off)
+}
+
+func listCollectionVolumeIds(dir string, collection string) (vids []needle.VolumeId, err error) {
+	fileInfos, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fileInfo := range fileInfos {
+		name := fileInfo.Name()
+		if fileInfo.IsDir() || !strings.HasSuffix(name, ".dat") {
+			continue
+		}
+		base := name[:len(name)-len(".dat")]
+		volumeCollection, idString := "", base
+		if i := strings.LastIndex(base, "_"); i >= 0 {
+			volumeCollection, idString = base[:i], base[i+1:]
+		}
+		if volumeCollection != collection {
+			continue
+		}
+		if vid, parseErr := needle.NewVolumeId(idString); parseErr == nil {
+			vids = append(vids, vid)
+		}
+	}
+	return
+}
+
+type exportS3Output struct {
+	conn   *s3.S3
+	bucket string
+	prefix string
+}
+
+func newExportS3Output(output, endpoint, region string) (*exportS3Output, error) {
+	bucketAndPrefix := strings.TrimPrefix(output, "s3://")
+	bucket, prefix := bucketAndPrefix, ""
+	if i := strings.Index(bucketAndPrefix, "/"); i >= 0 {
+		bucket, prefix = bucketAndPrefix[:i], bucketAndPrefix[i+1:]
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("missing bucket in %s", output)
+	}
+	config := &aws.Config{
+		Region: aws.String(region),
+	}
+	if endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, fmt.Errorf("create aws session: %v", err)
+	}
+	return &exportS3Output{
+		conn:   s3.New(sess),
+		bucket: bucket,
+		prefix: prefix,
+	}, nil
+}
+
+func (o *exportS3Output) put(fileName string, n *needle.Needle) error {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(o.bucket),
+		Key:    aws.String(o.prefix + fileName),
+		Body:   bytes.NewReader(n.Data),
+	}
+	if n.MimeSize > 0 {
+		input.ContentType = aws.String(string(n.Mime))
+	}
+	if n.HasLastModifiedDate() {
+		input.Metadata = map[string]*string{
+			"Mtime": aws.String(strconv.FormatUint(n.LastModified, 10)),
+		}
+	}
+	_, err := o.conn.PutObject(input)
+	return err
 }
 
 type nameParams struct {
@@ -252,6 +446,10 @@ func writeFile(vid needle.VolumeId, n *needle.Needle) (err error) {
 		// TODO other compression method
 	}
 
+	if s3Output != nil {
+		return s3Output.put(fileName, n)
+	}
+
 	tarHeader.Name, tarHeader.Size = fileName, int64(len(n.Data))
 	if n.HasLastModifiedDate() {
 		tarHeader.ModTime = time.Unix(int64(n.LastModified), 0)
@@ -4,19 +4,20 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
 	"google.golang.org/grpc/reflection"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/operation"
 	"github.com/chrislusf/seaweedfs/weed/pb"
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/server"
 	stats_collect "github.com/chrislusf/seaweedfs/weed/stats"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/grace"
 )
 
 var (
@@ -50,6 +51,20 @@ type FilerOptions struct {
 	saveToFilerLimit        *int
 	defaultLevelDbDirectory *string
 	concurrentUploadLimitMB *int
+	volumeMaxIdleConns      *int
+	volumeH2c               *bool
+	streamReads             *bool
+	internalNetworks        *string
+	metaCacheSize           *int
+	dedupChunks             *bool
+	replicaSelection        *string
+	concurrentChunkUploads  *int
+	chunkUploadAttempts     *int
+	volumeUploadTimeout     *time.Duration
+	concurrentReads         *int
+	concurrentWrites        *int
+	concurrentDeletes       *int
+	requestQueueTimeout     *time.Duration
 }
 
 func init() {
@@ -57,7 +72,7 @@ func init() {
 	f.masters = cmdFiler.Flag.String("master", "localhost:9333", "comma-separated master servers")
 	f.collection = cmdFiler.Flag.String("collection", "", "all data will be stored in this default collection")
 	f.ip = cmdFiler.Flag.String("ip", util.DetectedHostAddress(), "filer server http listen ip address")
-	f.bindIp = cmdFiler.Flag.String("ip.bind", "", "ip address to bind to")
+	f.bindIp = cmdFiler.Flag.String("ip.bind", "", "ip address to bind to. If empty, default to all the IPv4 and IPv6 addresses")
 	f.port = cmdFiler.Flag.Int("port", 8888, "filer server http listen port")
 	f.publicPort = cmdFiler.Flag.Int("port.readonly", 0, "readonly port opened to public")
 	f.defaultReplicaPlacement = cmdFiler.Flag.String("defaultReplicaPlacement", "", "default replication type. If not specified, use master setting.")
@@ -65,7 +80,7 @@ func init() {
 	f.maxMB = cmdFiler.Flag.Int("maxMB", 4, "split files larger than the limit")
 	f.dirListingLimit = cmdFiler.Flag.Int("dirListLimit", 100000, "limit sub dir listing size")
 	f.dataCenter = cmdFiler.Flag.String("dataCenter", "", "prefer to read and write to volumes in this data center")
-	f.rack = cmdFiler.Flag.String("rack", "", "prefer to write to volumes in this rack")
+	f.rack = cmdFiler.Flag.String("rack", "", "prefer to read and write to volumes in this rack")
 	f.disableHttp = cmdFiler.Flag.Bool("disableHttp", false, "disable http request, only gRpc operations are allowed")
 	f.cipher = cmdFiler.Flag.Bool("encryptVolumeData", false, "encrypt data on volume servers")
 	f.peers = cmdFiler.Flag.String("peers", "", "all filers sharing the same filer store in comma separated ip:port list")
@@ -73,6 +88,20 @@ func init() {
 	f.saveToFilerLimit = cmdFiler.Flag.Int("saveToFilerLimit", 0, "files smaller than this limit will be saved in filer store")
 	f.defaultLevelDbDirectory = cmdFiler.Flag.String("defaultStoreDir", ".", "if filer.toml is empty, use an embedded filer store in the directory")
 	f.concurrentUploadLimitMB = cmdFiler.Flag.Int("concurrentUploadLimitMB", 128, "limit total concurrent upload size")
+	f.volumeMaxIdleConns = cmdFiler.Flag.Int("volume.maxIdleConnsPerHost", 1024, "max idle keep-alive connections to each volume server")
+	f.streamReads = cmdFiler.Flag.Bool("streamReads", false, "stream the file content to the client while reading from volume servers, without holding whole chunks in memory")
+	f.internalNetworks = cmdFiler.Flag.String("internalNetworks", "", "comma separated CIDR list of in-cluster clients, which are redirected to the volume server url instead of the public url")
+	f.metaCacheSize = cmdFiler.Flag.Int("metaCacheSize", 0, "number of entries and listed entries cached in memory in front of slow filer stores, 0 to disable")
+	f.dedupChunks = cmdFiler.Flag.Bool("dedupChunks", false, "reuse the uploaded chunks with the same content, reference counted in the filer store. Only for one filer writing to the filer store.")
+	f.volumeH2c = cmdFiler.Flag.Bool("volume.h2c", false, "send requests to http volume servers as cleartext HTTP/2, multiplexed on one connection per volume server. The https volume servers use HTTP/2 by TLS ALPN.")
+	f.replicaSelection = cmdFiler.Flag.String("replicaSelection", "nearest", "[nearest|random|latency] how to choose the volume replica to read from: same data center and rack first, evenly spread, or lowest probed latency")
+	f.concurrentChunkUploads = cmdFiler.Flag.Int("concurrentChunkUploads", 4, "upload this many chunks of one file in parallel")
+	f.chunkUploadAttempts = cmdFiler.Flag.Int("chunkUploadAttempts", 3, "try uploading a chunk this many times, on another volume server after a failure")
+	f.volumeUploadTimeout = cmdFiler.Flag.Duration("volume.uploadTimeout", 0, "fail an upload to a volume server taking longer than this, to retry on another volume server. 0 means no timeout")
+	f.concurrentReads = cmdFiler.Flag.Int("concurrentReads", 0, "limit concurrent http read requests, 0 for no limit")
+	f.concurrentWrites = cmdFiler.Flag.Int("concurrentWrites", 0, "limit concurrent http write requests, 0 for no limit")
+	f.concurrentDeletes = cmdFiler.Flag.Int("concurrentDeletes", 0, "limit concurrent http delete requests, e.g., so that bulk deletes can not starve the reads. 0 for no limit")
+	f.requestQueueTimeout = cmdFiler.Flag.Duration("requestQueueTimeout", 30*time.Second, "reply 503 to http requests waiting longer than this for the concurrent request limits. 0 to wait forever")
 
 	// start s3 on filer
 	filerStartS3 = cmdFiler.Flag.Bool("s3", false, "whether to start S3 gateway")
@@ -82,6 +111,10 @@ func init() {
 	filerS3Options.tlsCertificate = cmdFiler.Flag.String("s3.cert.file", "", "path to the TLS certificate file")
 	filerS3Options.config = cmdFiler.Flag.String("s3.config", "", "path to the config file")
 	filerS3Options.allowEmptyFolder = cmdFiler.Flag.Bool("s3.allowEmptyFolder", false, "allow empty folders")
+	filerS3Options.region = cmdFiler.Flag.String("s3.region", "", "the region of the buckets, returned by GetBucketLocation, and requests signed for other regions are redirected. Defaults to us-east-1")
+	filerS3Options.websitePort = cmdFiler.Flag.Int("s3.websitePort", 0, "static website http listen port for the buckets with website configuration, 0 to disable")
+	filerS3Options.abortIncompleteMultipartUploadDays = cmdFiler.Flag.Int("s3.abortIncompleteMultipartUploadDays", 0, "abort incomplete multipart uploads after this many days, unless configured by the bucket lifecycle. 0 means never")
+	filerS3Options.metricsPerBucket = cmdFiler.Flag.Bool("s3.metricsPerBucket", false, "break down the s3 API operation metrics by the bucket, adding a label value per bucket")
 
 	// start webdav on filer
 	filerStartWebDav = cmdFiler.Flag.Bool("webdav", false, "whether to start webdav gateway")
@@ -93,6 +126,7 @@ func init() {
 	filerWebDavOptions.tlsCertificate = cmdFiler.Flag.String("webdav.cert.file", "", "path to the TLS certificate file")
 	filerWebDavOptions.cacheDir = cmdFiler.Flag.String("webdav.cacheDir", os.TempDir(), "local cache directory for file chunks")
 	filerWebDavOptions.cacheSizeMB = cmdFiler.Flag.Int64("webdav.cacheCapacityMB", 1000, "local cache capacity in MB")
+	filerWebDavOptions.cacheService = cmdFiler.Flag.String("webdav.cacheService", "", "unix socket of a \"weed cache\" process to share its chunk cache, instead of a local cache")
 
 	// start iam on filer
 	filerStartIam = cmdFiler.Flag.Bool("iam", false, "whether to start IAM service")
@@ -127,7 +161,7 @@ func runFiler(cmd *Command, args []string) bool {
 
 	go stats_collect.StartMetricsServer(*f.metricsHttpPort)
 
-	filerAddress := fmt.Sprintf("%s:%d", *f.ip, *f.port)
+	filerAddress := util.JoinHostPort(*f.ip, *f.port)
 	startDelay := time.Duration(2)
 	if *filerStartS3 {
 		filerS3Options.filer = &filerAddress
@@ -163,6 +197,28 @@ func runFiler(cmd *Command, args []string) bool {
 
 func (fo *FilerOptions) startFiler() {
 
+	fc := fo.newFilerComponent()
+	serveUntilInterrupted("filer", fc, defaultComponentStopTimeout)
+}
+
+// filerComponent is a filer server with the muxes to serve
+type filerComponent struct {
+	fo              *FilerOptions
+	fs              *weed_server.FilerServer
+	defaultMux      *http.ServeMux
+	publicVolumeMux *http.ServeMux
+}
+
+func (fo *FilerOptions) newFilerComponent() *filerComponent {
+
+	operation.ConfigureHttpClient(*fo.volumeMaxIdleConns, *fo.volumeH2c)
+	operation.UploadTimeout = *fo.volumeUploadTimeout
+
+	internalNetworks, err := util.ParseNetworks(*fo.internalNetworks)
+	if err != nil {
+		glog.Fatalf("-internalNetworks: %v", err)
+	}
+
 	defaultMux := http.NewServeMux()
 	publicVolumeMux := defaultMux
 
@@ -178,64 +234,81 @@ func (fo *FilerOptions) startFiler() {
 	}
 
 	fs, nfs_err := weed_server.NewFilerServer(defaultMux, publicVolumeMux, &weed_server.FilerOption{
-		Masters:               strings.Split(*fo.masters, ","),
-		Collection:            *fo.collection,
-		DefaultReplication:    *fo.defaultReplicaPlacement,
-		DisableDirListing:     *fo.disableDirListing,
-		MaxMB:                 *fo.maxMB,
-		DirListingLimit:       *fo.dirListingLimit,
-		DataCenter:            *fo.dataCenter,
-		Rack:                  *fo.rack,
-		DefaultLevelDbDir:     defaultLevelDbDirectory,
-		DisableHttp:           *fo.disableHttp,
-		Host:                  *fo.ip,
-		Port:                  uint32(*fo.port),
-		Cipher:                *fo.cipher,
-		SaveToFilerLimit:      int64(*fo.saveToFilerLimit),
-		Filers:                peers,
-		ConcurrentUploadLimit: int64(*fo.concurrentUploadLimitMB) * 1024 * 1024,
+		Masters:                strings.Split(*fo.masters, ","),
+		Collection:             *fo.collection,
+		DefaultReplication:     *fo.defaultReplicaPlacement,
+		DisableDirListing:      *fo.disableDirListing,
+		MaxMB:                  *fo.maxMB,
+		DirListingLimit:        *fo.dirListingLimit,
+		DataCenter:             *fo.dataCenter,
+		Rack:                   *fo.rack,
+		DefaultLevelDbDir:      defaultLevelDbDirectory,
+		DisableHttp:            *fo.disableHttp,
+		Host:                   *fo.ip,
+		Port:                   uint32(*fo.port),
+		Cipher:                 *fo.cipher,
+		SaveToFilerLimit:       int64(*fo.saveToFilerLimit),
+		Filers:                 peers,
+		ConcurrentUploadLimit:  int64(*fo.concurrentUploadLimitMB) * 1024 * 1024,
+		StreamReads:            *fo.streamReads,
+		InternalNetworks:       internalNetworks,
+		MetaCacheSize:          int64(*fo.metaCacheSize),
+		DedupChunks:            *fo.dedupChunks,
+		ReplicaSelection:       *fo.replicaSelection,
+		ConcurrentChunkUploads: *fo.concurrentChunkUploads,
+		ChunkUploadAttempts:    *fo.chunkUploadAttempts,
+		ConcurrentReads:        *fo.concurrentReads,
+		ConcurrentWrites:       *fo.concurrentWrites,
+		ConcurrentDeletes:      *fo.concurrentDeletes,
+		RequestQueueTimeout:    *fo.requestQueueTimeout,
 	})
 	if nfs_err != nil {
 		glog.Fatalf("Filer startup error: %v", nfs_err)
 	}
+	grace.OnReload(fs.Reload)
+
+	return &filerComponent{
+		fo:              fo,
+		fs:              fs,
+		defaultMux:      defaultMux,
+		publicVolumeMux: publicVolumeMux,
+	}
+}
+
+func (fc *filerComponent) serve(servers *componentServers) error {
+	fo := fc.fo
 
 	if *fo.publicPort != 0 {
-		publicListeningAddress := *fo.bindIp + ":" + strconv.Itoa(*fo.publicPort)
+		publicListeningAddress := util.JoinHostPort(*fo.bindIp, *fo.publicPort)
 		glog.V(0).Infoln("Start Seaweed filer server", util.Version(), "public at", publicListeningAddress)
-		publicListener, e := util.NewListener(publicListeningAddress, 0)
-		if e != nil {
-			glog.Fatalf("Filer server public listener error on port %d:%v", *fo.publicPort, e)
+		if err := servers.serveHttp(publicListeningAddress, 0, &http.Server{Handler: fc.publicVolumeMux}, "", ""); err != nil {
+			return fmt.Errorf("Filer server public listener error on port %d:%v", *fo.publicPort, err)
 		}
-		go func() {
-			if e := http.Serve(publicListener, publicVolumeMux); e != nil {
-				glog.Fatalf("Volume server fail to serve public: %v", e)
-			}
-		}()
 	}
 
 	glog.V(0).Infof("Start Seaweed Filer %s at %s:%d", util.Version(), *fo.ip, *fo.port)
-	filerListener, e := util.NewListener(
-		*fo.bindIp+":"+strconv.Itoa(*fo.port),
-		time.Duration(10)*time.Second,
-	)
-	if e != nil {
-		glog.Fatalf("Filer listener error: %v", e)
+	if err := servers.serveHttp(util.JoinHostPort(*fo.bindIp, *fo.port), time.Duration(10)*time.Second, &http.Server{Handler: fc.defaultMux}, "", ""); err != nil {
+		return fmt.Errorf("Filer listener error: %v", err)
 	}
 
 	// starting grpc server
+	fc.fs.ResumeSubscriptions()
 	grpcPort := *fo.port + 10000
-	grpcL, err := util.NewListener(*fo.bindIp+":"+strconv.Itoa(grpcPort), 0)
-	if err != nil {
-		glog.Fatalf("failed to listen on grpc port %d: %v", grpcPort, err)
-	}
 	grpcS := pb.NewGrpcServer(security.LoadServerTLS(util.GetViper(), "grpc.filer"))
-	filer_pb.RegisterSeaweedFilerServer(grpcS, fs)
+	filer_pb.RegisterSeaweedFilerServer(grpcS, fc.fs)
 	reflection.Register(grpcS)
-	go grpcS.Serve(grpcL)
-
-	httpS := &http.Server{Handler: defaultMux}
-	if err := httpS.Serve(filerListener); err != nil {
-		glog.Fatalf("Filer Fail to serve: %v", e)
+	if err := servers.serveGrpc(util.JoinHostPort(*fo.bindIp, grpcPort), grpcS); err != nil {
+		return fmt.Errorf("failed to listen on grpc port %d: %v", grpcPort, err)
 	}
 
+	return nil
+}
+
+// drain ends the metadata subscriptions, so the grpc server does not wait for them until the stop timeout
+func (fc *filerComponent) drain(exiting bool) {
+	fc.fs.StopSubscriptions()
+}
+
+func (fc *filerComponent) close() {
+	fc.fs.Shutdown()
 }
@@ -1,21 +1,27 @@
 package command
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"github.com/golang/protobuf/jsonpb"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/olivere/elastic/v7"
 	"io"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/chrislusf/seaweedfs/weed/pb"
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/grace"
 )
 
 func init() {
@@ -23,7 +29,7 @@ func init() {
 }
 
 var cmdFilerMetaTail = &Command{
-	UsageLine: "filer.meta.tail [-filer=localhost:8888] [-pathPrefix=/]",
+	UsageLine: "filer.meta.tail [-filer=localhost:8888] [-pathPrefix=/] [-exec=command] [-offsetFile=tail.offset]",
 	Short:     "see continuous changes on a filer",
 	Long: `See continuous changes on a filer.
 
@@ -31,6 +37,16 @@ var cmdFilerMetaTail = &Command{
 	weed filer.meta.tail -timeAgo=30h | jq .
 	weed filer.meta.tail -timeAgo=30h | jq .eventNotification.newEntry.name
 
+	Run a program for each event, with the event json in stdin, and these environment variables:
+	EVENT_TYPE (create, update, delete, or rename), EVENT_PATH, EVENT_NEW_PATH (for rename), and EVENT_TS_NS.
+
+	weed filer.meta.tail -pathPrefix=/buckets -exec='echo $EVENT_TYPE $EVENT_PATH >> events.txt'
+
+	Continue from where the last run stopped with -offsetFile, which keeps the time of the last processed event.
+	A few events just before the offset may be processed again after resuming, but none is skipped.
+
+	weed filer.meta.tail -offsetFile=tail.offset -exec=./handle_event.sh
+
   `,
 }
 
@@ -41,8 +57,12 @@ var (
 	tailPattern = cmdFilerMetaTail.Flag.String("pattern", "", "full path or just filename pattern, ex: \"/home/?opher\", \"*.pdf\", see https://golang.org/pkg/path/filepath/#Match ")
 	esServers   = cmdFilerMetaTail.Flag.String("es", "", "comma-separated elastic servers http://<host:port>")
 	esIndex     = cmdFilerMetaTail.Flag.String("es.index", "seaweedfs", "ES index name")
+	tailExec    = cmdFilerMetaTail.Flag.String("exec", "", "shell command to run for each event, with the event json in stdin")
+	tailOffset  = cmdFilerMetaTail.Flag.String("offsetFile", "", "file to save the time of the last processed event, and to resume from, overriding -timeAgo")
 )
 
+const tailOffsetSaveInterval = 3 * time.Second
+
 func runFilerMetaTail(cmd *Command, args []string) bool {
 
 	grpcDialOption := security.LoadClientTLS(util.GetViper(), "grpc.client")
@@ -102,6 +122,41 @@ func runFilerMetaTail(cmd *Command, args []string) bool {
 			return false
 		}
 	}
+	if *tailExec != "" {
+		eachEntryFunc = execFunc(*tailExec)
+	}
+
+	sinceNs := time.Now().Add(-*tailStart).UnixNano()
+	var lastSavedTsNs int64
+	var lastSaveTime time.Time
+	if *tailOffset != "" {
+		offsetTsNs, err := readTailOffset(*tailOffset)
+		if err != nil {
+			fmt.Printf("read offset file %s: %v\n", *tailOffset, err)
+			return false
+		}
+		if offsetTsNs != 0 {
+			fmt.Fprintf(os.Stderr, "resume from %v\n", time.Unix(0, offsetTsNs))
+			sinceNs = offsetTsNs
+		}
+		lastSavedTsNs, lastSaveTime = offsetTsNs, time.Now()
+	}
+	processedTsNs := sinceNs
+	var offsetLock sync.Mutex
+	saveOffset := func() {
+		offsetLock.Lock()
+		defer offsetLock.Unlock()
+		if *tailOffset == "" || processedTsNs == lastSavedTsNs {
+			return
+		}
+		if err := writeTailOffset(*tailOffset, processedTsNs); err != nil {
+			fmt.Fprintf(os.Stderr, "save offset file %s: %v\n", *tailOffset, err)
+			return
+		}
+		lastSavedTsNs, lastSaveTime = processedTsNs, time.Now()
+	}
+	defer saveOffset()
+	grace.OnInterrupt(saveOffset)
 
 	tailErr := pb.WithFilerClient(*tailFiler, grpcDialOption, func(client filer_pb.SeaweedFilerClient) error {
 
@@ -111,7 +166,7 @@ func runFilerMetaTail(cmd *Command, args []string) bool {
 		stream, err := client.SubscribeMetadata(ctx, &filer_pb.SubscribeMetadataRequest{
 			ClientName: "tail",
 			PathPrefix: *tailTarget,
-			SinceNs:    time.Now().Add(-*tailStart).UnixNano(),
+			SinceNs:    sinceNs,
 		})
 		if err != nil {
 			return fmt.Errorf("listen: %v", err)
@@ -125,11 +180,17 @@ func runFilerMetaTail(cmd *Command, args []string) bool {
 			if listenErr != nil {
 				return listenErr
 			}
-			if !shouldPrint(resp) {
-				continue
+			if shouldPrint(resp) {
+				if err = eachEntryFunc(resp); err != nil {
+					return err
+				}
 			}
-			if err = eachEntryFunc(resp); err != nil {
-				return err
+			offsetLock.Lock()
+			processedTsNs = resp.TsNs
+			shouldSave := time.Since(lastSaveTime) > tailOffsetSaveInterval
+			offsetLock.Unlock()
+			if shouldSave {
+				saveOffset()
 			}
 		}
 
@@ -141,6 +202,76 @@ func runFilerMetaTail(cmd *Command, args []string) bool {
 	return true
 }
 
+// execFunc runs the shell command for each event, and stops tailing if the command fails
+func execFunc(command string) func(resp *filer_pb.SubscribeMetadataResponse) error {
+	jsonpbMarshaler := jsonpb.Marshaler{
+		EmitDefaults: false,
+	}
+	return func(resp *filer_pb.SubscribeMetadataResponse) error {
+		event := resp.EventNotification
+		if event.OldEntry == nil && event.NewEntry == nil {
+			return nil
+		}
+		var input bytes.Buffer
+		if err := jsonpbMarshaler.Marshal(&input, resp); err != nil {
+			return err
+		}
+
+		eventType, path, newPath := "update", "", ""
+		if event.OldEntry != nil {
+			path = string(util.NewFullPath(resp.Directory, event.OldEntry.Name))
+		}
+		if event.NewEntry != nil {
+			newPath = string(util.NewFullPath(event.NewParentPath, event.NewEntry.Name))
+		}
+		switch {
+		case event.OldEntry == nil:
+			eventType, path, newPath = "create", newPath, ""
+		case event.NewEntry == nil:
+			eventType = "delete"
+		case path != newPath:
+			eventType = "rename"
+		default:
+			newPath = ""
+		}
+
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdin = &input
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(),
+			"EVENT_TYPE="+eventType,
+			"EVENT_PATH="+path,
+			"EVENT_NEW_PATH="+newPath,
+			"EVENT_TS_NS="+strconv.FormatInt(resp.TsNs, 10),
+		)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("exec %s for %s %s: %v", command, eventType, path, err)
+		}
+		return nil
+	}
+}
+
+func readTailOffset(offsetFile string) (int64, error) {
+	data, err := ioutil.ReadFile(offsetFile)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// writeTailOffset replaces the offset file by renaming, so it is never half written
+func writeTailOffset(offsetFile string, tsNs int64) error {
+	tmpFile := offsetFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, []byte(strconv.FormatInt(tsNs, 10)+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, offsetFile)
+}
+
 type EsDocument struct {
 	Dir         string `json:"dir,omitempty"`
 	Name        string `json:"name,omitempty"`
@@ -1,7 +1,7 @@
 package command
 
 import (
-	"context"
+	"reflect"
 	"strings"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
@@ -14,11 +14,17 @@ import (
 	_ "github.com/chrislusf/seaweedfs/weed/replication/sink/localsink"
 	_ "github.com/chrislusf/seaweedfs/weed/replication/sink/s3sink"
 	"github.com/chrislusf/seaweedfs/weed/replication/sub"
+	stats_collect "github.com/chrislusf/seaweedfs/weed/stats"
 	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
+var (
+	filerReplicateMetricsHttpPort *int
+)
+
 func init() {
 	cmdFilerReplicate.Run = runFilerReplicate // break init cycle
+	filerReplicateMetricsHttpPort = cmdFilerReplicate.Flag.Int("metricsPort", 0, "Prometheus metrics listen port")
 }
 
 var cmdFilerReplicate = &Command{
@@ -27,7 +33,12 @@ var cmdFilerReplicate = &Command{
 	Long: `replicate file changes to another destination
 
 	filer.replicate listens on filer notifications. If any file is updated, it will fetch the updated content,
-	and write to the other destination.
+	and write to the other destinations.
+
+	All the enabled sinks are replicated to, each in its own queue, so that a slow or failing sink does not
+	hold back the others. Each sink can filter the files by the path prefixes, and retries the failed changes.
+	A notification is acknowledged after all the sinks are done with it.
+	The replication counters, the queue lengths and the lag of the sinks are reported at the -metricsPort.
 
 	Run "weed scaffold -config=replication" to generate a replication.toml file and customize the parameters.
 
@@ -63,29 +74,43 @@ func runFilerReplicate(cmd *Command, args []string) bool {
 		return true
 	}
 
+	dataSinks := findSinks(config)
+
+	if len(dataSinks) == 0 {
+		println("no data sink configured in replication.toml:")
+		for _, sk := range sink.Sinks {
+			println("    " + sk.GetName())
+		}
+		return true
+	}
+
 	// avoid recursive replication
-	if config.GetBool("notification.source.filer.enabled") && config.GetBool("notification.sink.filer.enabled") {
-		if config.GetString("source.filer.grpcAddress") == config.GetString("sink.filer.grpcAddress") {
+	if config.GetBool("source.filer.enabled") {
+		for _, dataSink := range dataSinks {
+			if dataSink.sink.GetName() != "filer" || config.GetString("source.filer.grpcAddress") != config.GetString(dataSink.prefix+"grpcAddress") {
+				continue
+			}
 			fromDir := config.GetString("source.filer.directory")
-			toDir := config.GetString("sink.filer.directory")
+			toDir := config.GetString(dataSink.prefix + "directory")
 			if strings.HasPrefix(toDir, fromDir) {
-				glog.Fatalf("recursive replication! source directory %s includes the sink directory %s", fromDir, toDir)
+				glog.Fatalf("recursive replication! source directory %s includes the sink %s directory %s", fromDir, dataSink.id, toDir)
 			}
 		}
 	}
 
-	dataSink := findSink(config)
+	go stats_collect.StartMetricsServer(*filerReplicateMetricsHttpPort)
 
-	if dataSink == nil {
-		println("no data sink configured in replication.toml:")
-		for _, sk := range sink.Sinks {
-			println("    " + sk.GetName())
+	var replicator *replication.Replicator
+	var queues []*replication.SinkQueue
+	for _, dataSink := range dataSinks {
+		if replicator == nil {
+			replicator = replication.NewReplicator(config, "source.filer.", dataSink.sink)
 		}
-		return true
+		queue := replication.NewSinkQueue(dataSink.id, replicator.ForSink(dataSink.sink), config, dataSink.prefix)
+		go queue.Run()
+		queues = append(queues, queue)
 	}
 
-	replicator := replication.NewReplicator(config, "source.filer.", dataSink)
-
 	for {
 		key, m, onSuccessFn, onFailureFn, err := notificationInput.ReceiveMessage()
 		if err != nil {
@@ -109,19 +134,61 @@ func runFilerReplicate(cmd *Command, args []string) bool {
 		} else {
 			glog.V(1).Infof("modify: %s", key)
 		}
-		if err = replicator.Replicate(context.Background(), key, m); err != nil {
-			glog.Errorf("replicate %s: %+v", key, err)
-			if onFailureFn != nil {
+		task := replication.NewReplicationTask(key, m, len(queues), func(isSuccess bool) {
+			if isSuccess && onSuccessFn != nil {
+				onSuccessFn()
+			}
+			if !isSuccess && onFailureFn != nil {
 				onFailureFn()
 			}
-		} else {
-			glog.V(1).Infof("replicated %s", key)
-			if onSuccessFn != nil {
-				onSuccessFn()
+		})
+		for _, queue := range queues {
+			queue.Enqueue(task)
+		}
+	}
+
+}
+
+type configuredSink struct {
+	// the sink name, or "<sink name>.<id>" for the additional sinks of the same type
+	id     string
+	prefix string
+	sink   sink.ReplicationSink
+}
+
+// findSinks initializes all the enabled sinks, including the additional ones configured as [sink.<sink name>.<id>]
+func findSinks(config *util.ViperProxy) (dataSinks []*configuredSink) {
+	for _, sk := range sink.Sinks {
+		if config.GetBool("sink." + sk.GetName() + ".enabled") {
+			dataSinks = append(dataSinks, initializeSink(config, sk, sk.GetName()))
+		}
+	}
+	for _, key := range config.AllKeys() {
+		parts := strings.Split(key, ".")
+		if len(parts) != 4 || parts[0] != "sink" || parts[3] != "enabled" || !config.GetBool(key) {
+			continue
+		}
+		for _, sk := range sink.Sinks {
+			if sk.GetName() == parts[1] {
+				newSink := reflect.New(reflect.ValueOf(sk).Elem().Type()).Interface().(sink.ReplicationSink)
+				dataSinks = append(dataSinks, initializeSink(config, newSink, parts[1]+"."+parts[2]))
 			}
 		}
 	}
+	return
+}
 
+func initializeSink(config *util.ViperProxy, sk sink.ReplicationSink, id string) *configuredSink {
+	prefix := "sink." + id + "."
+	if err := sk.Initialize(config, prefix); err != nil {
+		glog.Fatalf("Failed to initialize sink for %s: %+v", id, err)
+	}
+	glog.V(0).Infof("Configure sink to %s", id)
+	return &configuredSink{
+		id:     id,
+		prefix: prefix,
+		sink:   sk,
+	}
 }
 
 func findSink(config *util.ViperProxy) sink.ReplicationSink {
@@ -12,6 +12,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/replication/sink/filersink"
 	"github.com/chrislusf/seaweedfs/weed/replication/source"
 	"github.com/chrislusf/seaweedfs/weed/security"
+	stats_collect "github.com/chrislusf/seaweedfs/weed/stats"
 	"github.com/chrislusf/seaweedfs/weed/util"
 	"github.com/chrislusf/seaweedfs/weed/util/grace"
 	"google.golang.org/grpc"
@@ -38,6 +39,9 @@ type SyncOptions struct {
 	bDebug          *bool
 	aProxyByFiler   *bool
 	bProxyByFiler   *bool
+
+	s3BucketReplication *bool
+	metricsHttpPort     *int
 }
 
 var (
@@ -65,6 +69,8 @@ func init() {
 	syncOptions.bProxyByFiler = cmdFilerSynchronize.Flag.Bool("b.filerProxy", false, "read and write file chunks by filer B instead of volume servers")
 	syncOptions.aDebug = cmdFilerSynchronize.Flag.Bool("a.debug", false, "debug mode to print out filer A received files")
 	syncOptions.bDebug = cmdFilerSynchronize.Flag.Bool("b.debug", false, "debug mode to print out filer B received files")
+	syncOptions.s3BucketReplication = cmdFilerSynchronize.Flag.Bool("s3BucketReplication", false, "one directional replication of the S3 buckets from A to B, selected by the bucket replication configurations")
+	syncOptions.metricsHttpPort = cmdFilerSynchronize.Flag.Int("metricsPort", 0, "Prometheus metrics listen port")
 	syncCpuProfile = cmdFilerSynchronize.Flag.String("cpuprofile", "", "cpu profile output file")
 	syncMemProfile = cmdFilerSynchronize.Flag.String("memprofile", "", "memory profile output file")
 }
@@ -84,6 +90,11 @@ var cmdFilerSynchronize = &Command{
 	If restarted, the synchronization will resume from the previous checkpoints, persisted every minute.
 	A fresh sync will start from the earliest metadata logs.
 
+	With -s3BucketReplication, only the S3 objects selected by the bucket replication configurations,
+	which are set by the PutBucketReplication API, are replicated from A to the destination buckets on B.
+	The a.path and b.path default to the buckets folders of the filers.
+	The replication counters and latency are reported at the -metricsPort.
+
 `,
 }
 
@@ -93,10 +104,26 @@ func runFilerSynchronize(cmd *Command, args []string) bool {
 
 	grace.SetupProfiling(*syncCpuProfile, *syncMemProfile)
 
+	go stats_collect.StartMetricsServer(*syncOptions.metricsHttpPort)
+
+	if *syncOptions.s3BucketReplication {
+		go func() {
+			for {
+				err := doSubscribeBucketReplication(grpcDialOption, *syncOptions.filerA, *syncOptions.aPath, *syncOptions.aProxyByFiler, *syncOptions.filerB,
+					*syncOptions.bPath, *syncOptions.bReplication, *syncOptions.bCollection, *syncOptions.bTtlSec, *syncOptions.bProxyByFiler, *syncOptions.bDiskType, *syncOptions.bDebug)
+				if err != nil {
+					glog.Errorf("replicate buckets from %s to %s: %v", *syncOptions.filerA, *syncOptions.filerB, err)
+					time.Sleep(1747 * time.Millisecond)
+				}
+			}
+		}()
+		select {}
+	}
+
 	go func() {
 		for {
 			err := doSubscribeFilerMetaChanges(grpcDialOption, *syncOptions.filerA, *syncOptions.aPath, *syncOptions.aProxyByFiler, *syncOptions.filerB,
-				*syncOptions.bPath, *syncOptions.bReplication, *syncOptions.bCollection, *syncOptions.bTtlSec, *syncOptions.bProxyByFiler, *syncOptions.bDiskType, *syncOptions.bDebug)
+				*syncOptions.bPath, *syncOptions.bReplication, *syncOptions.bCollection, *syncOptions.bTtlSec, *syncOptions.bProxyByFiler, *syncOptions.bDiskType, *syncOptions.bDebug, nil)
 			if err != nil {
 				glog.Errorf("sync from %s to %s: %v", *syncOptions.filerA, *syncOptions.filerB, err)
 				time.Sleep(1747 * time.Millisecond)
@@ -108,7 +135,7 @@ func runFilerSynchronize(cmd *Command, args []string) bool {
 		go func() {
 			for {
 				err := doSubscribeFilerMetaChanges(grpcDialOption, *syncOptions.filerB, *syncOptions.bPath, *syncOptions.bProxyByFiler, *syncOptions.filerA,
-					*syncOptions.aPath, *syncOptions.aReplication, *syncOptions.aCollection, *syncOptions.aTtlSec, *syncOptions.aProxyByFiler, *syncOptions.aDiskType, *syncOptions.aDebug)
+					*syncOptions.aPath, *syncOptions.aReplication, *syncOptions.aCollection, *syncOptions.aTtlSec, *syncOptions.aProxyByFiler, *syncOptions.aDiskType, *syncOptions.aDebug, nil)
 				if err != nil {
 					glog.Errorf("sync from %s to %s: %v", *syncOptions.filerB, *syncOptions.filerA, err)
 					time.Sleep(2147 * time.Millisecond)
@@ -122,8 +149,47 @@ func runFilerSynchronize(cmd *Command, args []string) bool {
 	return true
 }
 
+// doSubscribeBucketReplication replicates the S3 objects by the bucket replication configurations
+func doSubscribeBucketReplication(grpcDialOption grpc.DialOption, sourceFiler, sourcePath string, sourceReadChunkFromFiler bool, targetFiler, targetPath string,
+	replicationStr, collection string, ttlSec int, sinkWriteChunkByFiler bool, diskType string, debug bool) (err error) {
+
+	// default to the buckets folders
+	if sourcePath == "/" {
+		if sourcePath, err = readFilerBucketsPath(grpcDialOption, sourceFiler); err != nil {
+			return err
+		}
+	}
+	if targetPath == "/" {
+		if targetPath, err = readFilerBucketsPath(grpcDialOption, targetFiler); err != nil {
+			return err
+		}
+	}
+
+	return doSubscribeFilerMetaChanges(grpcDialOption, sourceFiler, sourcePath, sourceReadChunkFromFiler, targetFiler, targetPath,
+		replicationStr, collection, ttlSec, sinkWriteChunkByFiler, diskType, debug, replication.NewBucketReplication(sourcePath))
+}
+
+func readFilerBucketsPath(grpcDialOption grpc.DialOption, filer string) (bucketsPath string, err error) {
+	err = pb.WithFilerClient(filer, grpcDialOption, func(client filer_pb.SeaweedFilerClient) error {
+		resp, err := client.GetFilerConfiguration(context.Background(), &filer_pb.GetFilerConfigurationRequest{})
+		if err != nil {
+			return fmt.Errorf("get filer %s configuration: %v", filer, err)
+		}
+		bucketsPath = resp.DirBuckets
+		return nil
+	})
+	return
+}
+
+// doSubscribeFilerMetaChanges syncs the changes under the source path to the target path,
+// or only the S3 objects selected by the bucket replication configurations if bucketReplication is not nil.
 func doSubscribeFilerMetaChanges(grpcDialOption grpc.DialOption, sourceFiler, sourcePath string, sourceReadChunkFromFiler bool, targetFiler, targetPath string,
-	replicationStr, collection string, ttlSec int, sinkWriteChunkByFiler bool, diskType string, debug bool) error {
+	replicationStr, collection string, ttlSec int, sinkWriteChunkByFiler bool, diskType string, debug bool, bucketReplication *replication.BucketReplication) error {
+
+	offsetKeyPrefix := SyncKeyPrefix
+	if bucketReplication != nil {
+		offsetKeyPrefix = BucketReplicationKeyPrefix
+	}
 
 	// read source filer signature
 	sourceFilerSignature, sourceErr := replication.ReadFilerSignature(grpcDialOption, sourceFiler)
@@ -138,7 +204,7 @@ func doSubscribeFilerMetaChanges(grpcDialOption grpc.DialOption, sourceFiler, so
 
 	// if first time, start from now
 	// if has previously synced, resume from that point of time
-	sourceFilerOffsetTsNs, err := getOffset(grpcDialOption, targetFiler, SyncKeyPrefix, sourceFilerSignature)
+	sourceFilerOffsetTsNs, err := getOffset(grpcDialOption, targetFiler, offsetKeyPrefix, sourceFilerSignature)
 	if err != nil {
 		return err
 	}
@@ -153,6 +219,17 @@ func doSubscribeFilerMetaChanges(grpcDialOption grpc.DialOption, sourceFiler, so
 	filerSink.SetSourceFiler(filerSource)
 
 	persistEventFn := genProcessFunction(sourcePath, targetPath, filerSink, debug)
+	if bucketReplication != nil {
+		if err := bucketReplication.LoadBuckets(filerSource); err != nil {
+			return fmt.Errorf("load bucket replication configurations: %v", err)
+		}
+		persistEventFn = func(resp *filer_pb.SubscribeMetadataResponse) error {
+			if debug {
+				glog.V(0).Infof("received %v", resp)
+			}
+			return bucketReplication.Replicate(filerSink, targetPath, resp.Directory, resp.EventNotification, resp.TsNs)
+		}
+	}
 
 	processEventFn := func(resp *filer_pb.SubscribeMetadataResponse) error {
 		message := resp.EventNotification
@@ -200,7 +277,7 @@ func doSubscribeFilerMetaChanges(grpcDialOption grpc.DialOption, sourceFiler, so
 				glog.V(0).Infof("sync %s to %s progressed to %v %0.2f/sec", sourceFiler, targetFiler, time.Unix(0, resp.TsNs), float64(counter)/float64(3))
 				counter = 0
 				lastWriteTime = time.Now()
-				if err := setOffset(grpcDialOption, targetFiler, SyncKeyPrefix, sourceFilerSignature, resp.TsNs); err != nil {
+				if err := setOffset(grpcDialOption, targetFiler, offsetKeyPrefix, sourceFilerSignature, resp.TsNs); err != nil {
 					return err
 				}
 			}
@@ -212,7 +289,8 @@ func doSubscribeFilerMetaChanges(grpcDialOption grpc.DialOption, sourceFiler, so
 }
 
 const (
-	SyncKeyPrefix = "sync."
+	SyncKeyPrefix              = "sync."
+	BucketReplicationKeyPrefix = "s3replication."
 )
 
 func getOffset(grpcDialOption grpc.DialOption, filer string, signaturePrefix string, signature int32) (lastOffsetTsNs int64, readErr error) {
@@ -0,0 +1,299 @@
+package command
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/replication/source"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+type FilerVerifyOptions struct {
+	filer        *string
+	path         *string
+	sink         *string
+	proxyByFiler *bool
+	sample       *float64
+	concurrency  *int
+	output       *string
+}
+
+var (
+	filerVerifyOptions FilerVerifyOptions
+)
+
+func init() {
+	cmdFilerVerify.Run = runFilerVerify // break init cycle
+	filerVerifyOptions.filer = cmdFilerVerify.Flag.String("filer", "localhost:8888", "filer of one SeaweedFS cluster")
+	filerVerifyOptions.path = cmdFilerVerify.Flag.String("filerPath", "/", "directory to verify on filer")
+	filerVerifyOptions.sink = cmdFilerVerify.Flag.String("sink", "", "the sink in replication.toml to verify against, e.g., \"s3\" or \"s3.<id>\", default to the first enabled sink")
+	filerVerifyOptions.proxyByFiler = cmdFilerVerify.Flag.Bool("filerProxy", false, "read file chunks by filer instead of volume servers")
+	filerVerifyOptions.sample = cmdFilerVerify.Flag.Float64("sample", 0, "ratio of the files to compare the content checksums, 1 to compare all, 0 to only compare the existence and the sizes")
+	filerVerifyOptions.concurrency = cmdFilerVerify.Flag.Int("c", 8, "concurrent checksum comparisons")
+	filerVerifyOptions.output = cmdFilerVerify.Flag.String("o", "", "write the divergence report to a file instead of stdout")
+}
+
+var cmdFilerVerify = &Command{
+	UsageLine: "filer.verify -filer=<filerHost>:<filerPort> -filerPath=/buckets [-sink=s3] [-sample=0.01]",
+	Short:     "compare the files on filer with the replication or backup target defined in replication.toml",
+	Long: `compare the files on filer with the replication or backup target defined in replication.toml
+
+	filer.verify walks the directory on filer and the sink directory of the target, which is a filer sink or an s3 sink,
+	and reports the divergences, one per line:
+		missing   <path>                          exists on filer but not on the target
+		extra     <path>                          exists on the target but not on filer
+		type      <path> <filer type> <target type>
+		size      <path> <filer size> <target size>
+		checksum  <path> <filer md5> <target md5>
+		error     <path> <error>
+	followed by a summary line. The paths are relative to -filerPath.
+
+	The existence and the sizes of all the files are compared. The content checksums are compared for
+	a random sample of the files with the same sizes, of the ratio set by "-sample".
+
+	Since the target is written asynchronously, the recently changed files may be reported as divergences.
+	The incremental sinks can not be verified.
+
+`,
+}
+
+func runFilerVerify(cmd *Command, args []string) bool {
+
+	util.LoadConfiguration("security", false)
+	util.LoadConfiguration("replication", true)
+
+	config := util.GetViper()
+	var targetSink *configuredSink
+	for _, dataSink := range findSinks(config) {
+		if *filerVerifyOptions.sink == "" || *filerVerifyOptions.sink == dataSink.id {
+			targetSink = dataSink
+			break
+		}
+	}
+	if targetSink == nil {
+		fmt.Printf("no enabled sink %s in replication.toml\n", *filerVerifyOptions.sink)
+		return true
+	}
+	if targetSink.sink.IsIncremental() {
+		fmt.Printf("sink %s is incremental and can not be verified\n", targetSink.id)
+		return true
+	}
+	target, err := newVerifyTargetTree(config, targetSink)
+	if err != nil {
+		fmt.Printf("sink %s: %v\n", targetSink.id, err)
+		return true
+	}
+
+	filerSource := &source.FilerSource{}
+	filerSource.DoInitialize(*filerVerifyOptions.filer, pb.ServerToGrpcAddress(*filerVerifyOptions.filer), *filerVerifyOptions.path, *filerVerifyOptions.proxyByFiler)
+
+	var writer io.Writer = os.Stdout
+	if *filerVerifyOptions.output != "" {
+		f, err := os.Create(*filerVerifyOptions.output)
+		if err != nil {
+			fmt.Printf("create %s: %v\n", *filerVerifyOptions.output, err)
+			return true
+		}
+		defer f.Close()
+		writer = f
+	}
+
+	v := newFilerVerifier(newFilerVerifyTree(filerSource, *filerVerifyOptions.path), target, writer, *filerVerifyOptions.sample, *filerVerifyOptions.concurrency)
+	glog.V(0).Infof("verify %s%s against sink %s", *filerVerifyOptions.filer, *filerVerifyOptions.path, targetSink.id)
+	v.verify()
+
+	return true
+}
+
+// verifyEntry is a file or a directory on one side of the verification
+type verifyEntry struct {
+	isDirectory bool
+	size        int64
+	md5         []byte // nil if the md5 of the content is not known without reading it
+	// the tree specific details to read the content
+	detail interface{}
+}
+
+// verifyTree lists and reads the files on one side of the verification, by the paths relative to its root
+type verifyTree interface {
+	// ListDirectory returns the direct children of the directory, by their names
+	ListDirectory(dir util.FullPath) (map[string]*verifyEntry, error)
+	// ContentMd5 reads the content of the file to compute the md5
+	ContentMd5(path util.FullPath, entry *verifyEntry) ([]byte, error)
+	// KeepsDirectories is false if the directories only exist implicitly with the files inside, as in s3
+	KeepsDirectories() bool
+}
+
+type filerVerifySummary struct {
+	directories int64
+	files       int64
+	checksummed int64
+	missing     int64
+	extra       int64
+	types       int64
+	sizes       int64
+	checksums   int64
+	errors      int64
+}
+
+// filerVerifier walks the two trees together, directory by directory, and reports the divergences
+type filerVerifier struct {
+	source       verifyTree
+	target       verifyTree
+	sample       float64
+	writer       io.Writer
+	writerLock   sync.Mutex
+	summary      filerVerifySummary
+	checksumJobs chan func()
+}
+
+func newFilerVerifier(sourceTree, targetTree verifyTree, writer io.Writer, sample float64, concurrency int) *filerVerifier {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &filerVerifier{
+		source:       sourceTree,
+		target:       targetTree,
+		sample:       sample,
+		writer:       writer,
+		checksumJobs: make(chan func(), concurrency),
+	}
+}
+
+func (v *filerVerifier) verify() filerVerifySummary {
+	var workers sync.WaitGroup
+	for i := 0; i < cap(v.checksumJobs); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range v.checksumJobs {
+				job()
+			}
+		}()
+	}
+
+	v.verifyDirectory("/", true)
+
+	close(v.checksumJobs)
+	workers.Wait()
+
+	s := v.summary
+	fmt.Fprintf(v.writer, "verified %d directories and %d files, %d checksummed: %d missing, %d extra, %d type, %d size and %d checksum mismatches, %d errors\n",
+		s.directories, s.files, s.checksummed, s.missing, s.extra, s.types, s.sizes, s.checksums, s.errors)
+	return s
+}
+
+func (v *filerVerifier) report(counter *int64, format string, a ...interface{}) {
+	v.writerLock.Lock()
+	defer v.writerLock.Unlock()
+	*counter++
+	fmt.Fprintf(v.writer, format+"\n", a...)
+}
+
+// verifyDirectory compares the directory, listing the target directory only if it exists
+func (v *filerVerifier) verifyDirectory(dir util.FullPath, existsOnTarget bool) {
+	v.summary.directories++
+
+	sourceEntries, err := v.source.ListDirectory(dir)
+	if err != nil {
+		v.report(&v.summary.errors, "error\t%s\tlist filer: %v", dir, err)
+		return
+	}
+	targetEntries := make(map[string]*verifyEntry)
+	if existsOnTarget {
+		if targetEntries, err = v.target.ListDirectory(dir); err != nil {
+			v.report(&v.summary.errors, "error\t%s\tlist target: %v", dir, err)
+			return
+		}
+	}
+
+	for _, name := range sortedVerifyEntryNames(sourceEntries) {
+		sourceEntry, targetEntry, path := sourceEntries[name], targetEntries[name], dir.Child(name)
+		switch {
+		case targetEntry == nil && sourceEntry.isDirectory:
+			if v.target.KeepsDirectories() {
+				v.report(&v.summary.missing, "missing\t%s/", path)
+			}
+			v.verifyDirectory(path, false)
+		case targetEntry == nil:
+			v.summary.files++
+			v.report(&v.summary.missing, "missing\t%s", path)
+		case sourceEntry.isDirectory != targetEntry.isDirectory:
+			v.report(&v.summary.types, "type\t%s\t%s\t%s", path, verifyEntryType(sourceEntry), verifyEntryType(targetEntry))
+		case sourceEntry.isDirectory:
+			v.verifyDirectory(path, true)
+		default:
+			v.summary.files++
+			v.verifyFile(path, sourceEntry, targetEntry)
+		}
+	}
+
+	for _, name := range sortedVerifyEntryNames(targetEntries) {
+		if _, found := sourceEntries[name]; !found {
+			suffix := ""
+			if targetEntries[name].isDirectory {
+				suffix = "/"
+			}
+			v.report(&v.summary.extra, "extra\t%s%s", dir.Child(name), suffix)
+		}
+	}
+}
+
+func (v *filerVerifier) verifyFile(path util.FullPath, sourceEntry, targetEntry *verifyEntry) {
+	if sourceEntry.size != targetEntry.size {
+		v.report(&v.summary.sizes, "size\t%s\t%d\t%d", path, sourceEntry.size, targetEntry.size)
+		return
+	}
+	if v.sample <= 0 || v.sample < 1 && rand.Float64() >= v.sample {
+		return
+	}
+	v.checksumJobs <- func() {
+		sourceMd5, err := verifyEntryMd5(v.source, path, sourceEntry)
+		if err != nil {
+			v.report(&v.summary.errors, "error\t%s\tread filer: %v", path, err)
+			return
+		}
+		targetMd5, err := verifyEntryMd5(v.target, path, targetEntry)
+		if err != nil {
+			v.report(&v.summary.errors, "error\t%s\tread target: %v", path, err)
+			return
+		}
+		isSame := bytes.Equal(sourceMd5, targetMd5)
+		v.writerLock.Lock()
+		v.summary.checksummed++
+		v.writerLock.Unlock()
+		if !isSame {
+			v.report(&v.summary.checksums, "checksum\t%s\t%s\t%s", path, hex.EncodeToString(sourceMd5), hex.EncodeToString(targetMd5))
+		}
+	}
+}
+
+func verifyEntryMd5(tree verifyTree, path util.FullPath, entry *verifyEntry) ([]byte, error) {
+	if entry.md5 != nil {
+		return entry.md5, nil
+	}
+	return tree.ContentMd5(path, entry)
+}
+
+func verifyEntryType(entry *verifyEntry) string {
+	if entry.isDirectory {
+		return "directory"
+	}
+	return "file"
+}
+
+func sortedVerifyEntryNames(entries map[string]*verifyEntry) (names []string) {
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
@@ -0,0 +1,114 @@
+package command
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// memVerifyTree is a tree of files by their full paths, with the directories ending with "/"
+type memVerifyTree struct {
+	files            map[string]string
+	keepsDirectories bool
+	knowsMd5         bool
+}
+
+func (t *memVerifyTree) ListDirectory(dir util.FullPath) (map[string]*verifyEntry, error) {
+	prefix := strings.TrimSuffix(string(dir), "/") + "/"
+	entries := make(map[string]*verifyEntry)
+	for path, content := range t.files {
+		if !strings.HasPrefix(path, prefix) || path == prefix {
+			continue
+		}
+		name := path[len(prefix):]
+		if i := strings.Index(name, "/"); i >= 0 {
+			entries[name[:i]] = &verifyEntry{isDirectory: true}
+			continue
+		}
+		entry := &verifyEntry{size: int64(len(content))}
+		if t.knowsMd5 {
+			sum := md5.Sum([]byte(content))
+			entry.md5 = sum[:]
+		}
+		entries[name] = entry
+	}
+	return entries, nil
+}
+
+func (t *memVerifyTree) ContentMd5(path util.FullPath, entry *verifyEntry) ([]byte, error) {
+	content, found := t.files[string(path)]
+	if !found {
+		return nil, fmt.Errorf("%s not found", path)
+	}
+	sum := md5.Sum([]byte(content))
+	return sum[:], nil
+}
+
+func (t *memVerifyTree) KeepsDirectories() bool {
+	return t.keepsDirectories
+}
+
+func TestFilerVerify(t *testing.T) {
+
+	sourceTree := &memVerifyTree{
+		files: map[string]string{
+			"/a.txt":       "a",
+			"/b.txt":       "b",
+			"/c.txt":       "c",
+			"/d/e.txt":     "e",
+			"/d/f.txt":     "f",
+			"/g/h.txt":     "h",
+			"/empty/":      "",
+			"/i":           "i",
+			"/same/j.txt":  "j",
+			"/same/k.txt":  "k",
+			"/changed.txt": "new",
+		},
+		knowsMd5: true,
+	}
+	targetFiles := map[string]string{
+		"/a.txt":       "a",
+		"/b.txt":       "bb",
+		"/d/e.txt":     "e",
+		"/d/x.txt":     "x",
+		"/i/i.txt":     "i",
+		"/same/j.txt":  "j",
+		"/same/k.txt":  "k",
+		"/changed.txt": "old",
+		"/extra/y.txt": "y",
+	}
+
+	var out bytes.Buffer
+	summary := newFilerVerifier(sourceTree, &memVerifyTree{files: targetFiles}, &out, 1, 2).verify()
+	report := out.String()
+	for _, line := range []string{
+		"size\t/b.txt\t1\t2\n",
+		"missing\t/c.txt\n",
+		"missing\t/d/f.txt\n",
+		"extra\t/d/x.txt\n",
+		"missing\t/g/h.txt\n",
+		"type\t/i\tfile\tdirectory\n",
+		"checksum\t/changed.txt\t" + fmt.Sprintf("%x\t%x", md5.Sum([]byte("new")), md5.Sum([]byte("old"))) + "\n",
+		"extra\t/extra/\n",
+	} {
+		assert.Contains(t, report, line)
+	}
+	// the directories only exist with the files in s3
+	assert.NotContains(t, report, "/g/\n")
+	assert.NotContains(t, report, "/empty/\n")
+	assert.Equal(t, filerVerifySummary{directories: 5, files: 9, checksummed: 5, missing: 3, extra: 2, types: 1, sizes: 1, checksums: 1}, summary)
+
+	// the missing directories are reported for the filer sinks
+	out.Reset()
+	summary = newFilerVerifier(sourceTree, &memVerifyTree{files: targetFiles, keepsDirectories: true}, &out, 0, 1).verify()
+	assert.Contains(t, out.String(), "missing\t/g/\n")
+	assert.Contains(t, out.String(), "missing\t/empty/\n")
+	assert.Equal(t, int64(0), summary.checksummed)
+	assert.Equal(t, int64(5), summary.missing)
+}
@@ -0,0 +1,195 @@
+package command
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/chrislusf/seaweedfs/weed/filer"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/replication/source"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// newVerifyTargetTree reads the target of the sink, at the same keys as the sink writes to
+func newVerifyTargetTree(config *util.ViperProxy, dataSink *configuredSink) (verifyTree, error) {
+	switch dataSink.sink.GetName() {
+	case "filer":
+		filerSource := &source.FilerSource{}
+		filerSource.Initialize(config, dataSink.prefix)
+		return newFilerVerifyTree(filerSource, filerSource.Dir), nil
+	case "s3":
+		return newS3VerifyTree(config, dataSink.prefix)
+	}
+	return nil, fmt.Errorf("verifying the %s sink is not supported", dataSink.sink.GetName())
+}
+
+type filerVerifyTree struct {
+	filerSource *source.FilerSource
+	root        string
+}
+
+func newFilerVerifyTree(filerSource *source.FilerSource, root string) *filerVerifyTree {
+	return &filerVerifyTree{
+		filerSource: filerSource,
+		root:        root,
+	}
+}
+
+func (t *filerVerifyTree) ListDirectory(dir util.FullPath) (map[string]*verifyEntry, error) {
+	entries := make(map[string]*verifyEntry)
+	err := filer_pb.ReadDirAllEntries(t.filerSource, util.JoinPath(t.root, string(dir)), "", func(entry *filer_pb.Entry, isLast bool) error {
+		verifyEntry := &verifyEntry{
+			isDirectory: entry.IsDirectory,
+			detail:      entry,
+		}
+		if !entry.IsDirectory {
+			verifyEntry.size = int64(filer.FileSize(entry))
+			if entry.Attributes != nil && len(entry.Attributes.Md5) > 0 {
+				verifyEntry.md5 = entry.Attributes.Md5
+			}
+		}
+		entries[entry.Name] = verifyEntry
+		return nil
+	})
+	return entries, err
+}
+
+func (t *filerVerifyTree) ContentMd5(path util.FullPath, entry *verifyEntry) ([]byte, error) {
+	filerEntry := entry.detail.(*filer_pb.Entry)
+	h := md5.New()
+	if len(filerEntry.Content) > 0 {
+		h.Write(filerEntry.Content)
+	} else if err := filer.StreamContent(t.filerSource, h, filerEntry.Chunks, 0, entry.size); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func (t *filerVerifyTree) KeepsDirectories() bool {
+	return true
+}
+
+// s3VerifyTree lists the objects by the directory prefixes, with the first folder as the bucket if the bucket is not configured
+type s3VerifyTree struct {
+	conn   s3iface.S3API
+	bucket string
+	dir    string
+}
+
+func newS3VerifyTree(config *util.ViperProxy, prefix string) (*s3VerifyTree, error) {
+	awsConfig := &aws.Config{
+		Region:           aws.String(config.GetString(prefix + "region")),
+		Endpoint:         aws.String(config.GetString(prefix + "endpoint")),
+		S3ForcePathStyle: aws.Bool(true),
+	}
+	awsAccessKeyId, awsSecretAccessKey := config.GetString(prefix+"aws_access_key_id"), config.GetString(prefix+"aws_secret_access_key")
+	if awsAccessKeyId != "" && awsSecretAccessKey != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(awsAccessKeyId, awsSecretAccessKey, "")
+	}
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create aws session: %v", err)
+	}
+	return &s3VerifyTree{
+		conn:   s3.New(sess),
+		bucket: config.GetString(prefix + "bucket"),
+		dir:    config.GetString(prefix + "directory"),
+	}, nil
+}
+
+func (t *s3VerifyTree) bucketAndKey(path util.FullPath) (bucket, key string) {
+	key = strings.TrimPrefix(util.Join(t.dir, string(path)), "/")
+	if t.bucket != "" {
+		return t.bucket, key
+	}
+	if i := strings.Index(key, "/"); i > 0 {
+		return key[:i], key[i+1:]
+	}
+	return key, ""
+}
+
+func (t *s3VerifyTree) ListDirectory(dir util.FullPath) (map[string]*verifyEntry, error) {
+	entries := make(map[string]*verifyEntry)
+
+	bucket, key := t.bucketAndKey(dir)
+	if bucket == "" {
+		resp, err := t.conn.ListBuckets(&s3.ListBucketsInput{})
+		if err != nil {
+			return nil, fmt.Errorf("list buckets: %v", err)
+		}
+		for _, b := range resp.Buckets {
+			entries[aws.StringValue(b.Name)] = &verifyEntry{isDirectory: true}
+		}
+		return entries, nil
+	}
+
+	prefix := key
+	if prefix != "" {
+		prefix += "/"
+	}
+	err := t.conn.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket:    aws.String(bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, commonPrefix := range page.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(aws.StringValue(commonPrefix.Prefix), prefix), "/")
+			entries[name] = &verifyEntry{isDirectory: true}
+		}
+		for _, object := range page.Contents {
+			name := strings.TrimPrefix(aws.StringValue(object.Key), prefix)
+			if name == "" {
+				// the directory marker
+				continue
+			}
+			entries[name] = &verifyEntry{
+				size: aws.Int64Value(object.Size),
+				md5:  etagToMd5(aws.StringValue(object.ETag)),
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list %s/%s: %v", bucket, prefix, err)
+	}
+	return entries, nil
+}
+
+// etagToMd5 returns nil for the multipart uploads, whose etags are not the md5 of the content
+func etagToMd5(etag string) []byte {
+	md5, err := hex.DecodeString(strings.Trim(etag, "\""))
+	if err != nil || len(md5) != 16 {
+		return nil
+	}
+	return md5
+}
+
+func (t *s3VerifyTree) ContentMd5(path util.FullPath, entry *verifyEntry) ([]byte, error) {
+	bucket, key := t.bucketAndKey(path)
+	resp, err := t.conn.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get %s/%s: %v", bucket, key, err)
+	}
+	defer resp.Body.Close()
+	h := md5.New()
+	if _, err = io.Copy(h, resp.Body); err != nil {
+		return nil, fmt.Errorf("read %s/%s: %v", bucket, key, err)
+	}
+	return h.Sum(nil), nil
+}
+
+func (t *s3VerifyTree) KeepsDirectories() bool {
+	return false
+}
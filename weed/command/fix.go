@@ -1,12 +1,16 @@
 package command
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"path"
 	"strconv"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/storage"
+	"github.com/chrislusf/seaweedfs/weed/storage/backend"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle_map"
 	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
@@ -23,6 +27,14 @@ var cmdFix = &Command{
 	Short:     "run weed tool fix on index file if corrupted",
 	Long: `Fix runs the SeaweedFS fix command to re-create the index .idx file.
 
+  With "-validate", each needle's CRC is checked while rebuilding the index.
+  Corrupted needles are skipped, and the scan re-synchronizes on the next valid needle
+  if a needle header is damaged. Every skipped needle is listed in the report,
+  printed as json lines to stdout, or to the "-report" file.
+
+  With "-repair", a new .dat file with only the valid needles is written,
+  the original .dat file is kept as .dat.bak, and the index is rebuilt for the new .dat file.
+
   `,
 }
 
@@ -30,6 +42,9 @@ var (
 	fixVolumePath       = cmdFix.Flag.String("dir", ".", "data directory to store files")
 	fixVolumeCollection = cmdFix.Flag.String("collection", "", "the volume collection name")
 	fixVolumeId         = cmdFix.Flag.Int("volumeId", -1, "a volume id. The volume should already exist in the dir. The volume index file should not exist.")
+	fixValidate         = cmdFix.Flag.Bool("validate", false, "verify needle CRCs, skip corrupted needles and report them")
+	fixReport           = cmdFix.Flag.String("report", "", "write the list of skipped needles to this file, instead of stdout")
+	fixRepair           = cmdFix.Flag.Bool("repair", false, "rewrite the .dat file with only valid needles, keeping the original as .dat.bak. Implies -validate")
 )
 
 type VolumeFileScanner4Fix struct {
@@ -73,14 +88,21 @@ func runFix(cmd *Command, args []string) bool {
 	nm := needle_map.NewMemDb()
 	defer nm.Close()
 
-	vid := needle.VolumeId(*fixVolumeId)
-	scanner := &VolumeFileScanner4Fix{
-		nm: nm,
-	}
+	if *fixValidate || *fixRepair {
+		dataFileName := path.Join(util.ResolvePath(*fixVolumePath), baseFileName+".dat")
+		if err := validateAndFixVolume(dataFileName, nm, *fixRepair); err != nil {
+			glog.Fatalf("validate .dat File: %v", err)
+		}
+	} else {
+		vid := needle.VolumeId(*fixVolumeId)
+		scanner := &VolumeFileScanner4Fix{
+			nm: nm,
+		}
 
-	if err := storage.ScanVolumeFile(util.ResolvePath(*fixVolumePath), *fixVolumeCollection, vid, storage.NeedleMapInMemory, scanner); err != nil {
-		glog.Fatalf("scan .dat File: %v", err)
-		os.Remove(indexFileName)
+		if err := storage.ScanVolumeFile(util.ResolvePath(*fixVolumePath), *fixVolumeCollection, vid, storage.NeedleMapInMemory, scanner); err != nil {
+			glog.Fatalf("scan .dat File: %v", err)
+			os.Remove(indexFileName)
+		}
 	}
 
 	if err := nm.SaveToIdx(indexFileName); err != nil {
@@ -90,3 +112,179 @@ func runFix(cmd *Command, args []string) bool {
 
 	return true
 }
+
+// needleFixReport describes one skipped region of the .dat file
+type needleFixReport struct {
+	Offset   int64  `json:"offset"`
+	Length   int64  `json:"length"`
+	NeedleId string `json:"needleId,omitempty"`
+	Size     int32  `json:"size,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+type needleFixSummary struct {
+	ValidNeedles   int   `json:"validNeedles"`
+	DeletedNeedles int   `json:"deletedNeedles"`
+	Skipped        int   `json:"skipped"`
+	SkippedBytes   int64 `json:"skippedBytes"`
+}
+
+func validateAndFixVolume(dataFileName string, nm *needle_map.MemDb, repair bool) error {
+
+	dataFile, err := os.Open(dataFileName)
+	if err != nil {
+		return err
+	}
+	datBackend := backend.NewDiskFile(dataFile)
+	defer datBackend.Close()
+
+	superBlock, err := super_block.ReadSuperBlock(datBackend)
+	if err != nil {
+		return fmt.Errorf("read super block: %v", err)
+	}
+	fileSize, _, err := datBackend.GetStat()
+	if err != nil {
+		return err
+	}
+
+	reportWriter := io.Writer(os.Stdout)
+	if *fixReport != "" {
+		reportFile, err := os.OpenFile(*fixReport, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return fmt.Errorf("open report file: %v", err)
+		}
+		defer reportFile.Close()
+		reportWriter = reportFile
+	}
+	reportEncoder := json.NewEncoder(reportWriter)
+
+	var repairedFile *os.File
+	var repairedFileName string
+	var repairedOffset int64
+	if repair {
+		repairedFileName = dataFileName + ".repaired"
+		if repairedFile, err = os.OpenFile(repairedFileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+			return fmt.Errorf("create %s: %v", repairedFileName, err)
+		}
+		defer repairedFile.Close()
+		superBlockBytes := superBlock.Bytes()
+		if _, err = repairedFile.Write(superBlockBytes); err != nil {
+			return fmt.Errorf("write %s: %v", repairedFileName, err)
+		}
+		repairedOffset = int64(len(superBlockBytes))
+	}
+
+	version := superBlock.Version
+	checksumAlgorithm := superBlock.ChecksumAlgorithm()
+	summary := &needleFixSummary{}
+	offset := int64(superBlock.BlockSize())
+	for offset+types.NeedleHeaderSize <= fileSize {
+		n, blob, reason := readValidNeedle(datBackend, version, checksumAlgorithm, offset, fileSize)
+		if reason != "" {
+			report := &needleFixReport{Offset: offset, Reason: reason}
+			if n != nil {
+				report.NeedleId, report.Size = n.Id.String(), int32(n.Size)
+			}
+			next := offset + types.NeedlePaddingSize
+			if blob != nil {
+				// the needle header is fine, only skip this needle
+				next = offset + int64(len(blob))
+			} else {
+				// search for the next valid needle, which are aligned to the padding size
+				for ; next+types.NeedleHeaderSize <= fileSize; next += types.NeedlePaddingSize {
+					if candidate, _, candidateReason := readValidNeedle(datBackend, version, checksumAlgorithm, next, fileSize); candidateReason == "" && candidate.Size.IsValid() {
+						break
+					}
+				}
+			}
+			if next+types.NeedleHeaderSize > fileSize {
+				next = fileSize
+			}
+			report.Length = next - offset
+			summary.Skipped++
+			summary.SkippedBytes += report.Length
+			if err = reportEncoder.Encode(report); err != nil {
+				return fmt.Errorf("write report: %v", err)
+			}
+			offset = next
+			continue
+		}
+
+		needleOffset := offset
+		if repair {
+			needleOffset = repairedOffset
+			if _, err = repairedFile.Write(blob); err != nil {
+				return fmt.Errorf("write %s: %v", repairedFileName, err)
+			}
+			repairedOffset += int64(len(blob))
+		}
+		if n.Size.IsValid() {
+			summary.ValidNeedles++
+			if err = nm.Set(n.Id, types.ToOffset(needleOffset), n.Size); err != nil {
+				return err
+			}
+		} else {
+			summary.DeletedNeedles++
+			if err = nm.Delete(n.Id); err != nil {
+				return err
+			}
+		}
+		offset += int64(len(blob))
+	}
+	if offset < fileSize {
+		report := &needleFixReport{Offset: offset, Length: fileSize - offset, Reason: "truncated needle header"}
+		summary.Skipped++
+		summary.SkippedBytes += report.Length
+		if err = reportEncoder.Encode(report); err != nil {
+			return fmt.Errorf("write report: %v", err)
+		}
+	}
+
+	glog.V(0).Infof("%s: %d valid needles, %d deleted needles, %d skipped regions with %d bytes",
+		dataFileName, summary.ValidNeedles, summary.DeletedNeedles, summary.Skipped, summary.SkippedBytes)
+	if err = reportEncoder.Encode(summary); err != nil {
+		return fmt.Errorf("write report: %v", err)
+	}
+
+	if repair {
+		if err = repairedFile.Sync(); err != nil {
+			return err
+		}
+		if err = os.Rename(dataFileName, dataFileName+".bak"); err != nil {
+			return err
+		}
+		if err = os.Rename(repairedFileName, dataFileName); err != nil {
+			return err
+		}
+		glog.V(0).Infof("repaired %s, the original file is saved as %s.bak", dataFileName, dataFileName)
+	}
+
+	return nil
+}
+
+// readValidNeedle reads the whole needle at the offset and verifies it.
+// It returns a non-empty reason if the needle is corrupted,
+// and the needle blob is still returned if only the needle content is corrupted.
+func readValidNeedle(datBackend backend.BackendStorageFile, version needle.Version, checksumAlgorithm needle.ChecksumAlgorithm, offset, fileSize int64) (n *needle.Needle, blob []byte, reason string) {
+	n, _, bodyLength, err := needle.ReadNeedleHeader(datBackend, version, offset)
+	if err != nil || n == nil {
+		return nil, nil, fmt.Sprintf("read needle header: %v", err)
+	}
+	if n.Size < 0 {
+		return n, nil, fmt.Sprintf("invalid needle size %d", n.Size)
+	}
+	if offset+types.NeedleHeaderSize+bodyLength > fileSize {
+		return n, nil, fmt.Sprintf("needle size %d exceeds the file size", n.Size)
+	}
+	blob = make([]byte, types.NeedleHeaderSize+bodyLength)
+	if _, err = datBackend.ReadAt(blob, offset); err != nil && err != io.EOF {
+		return n, nil, fmt.Sprintf("read needle: %v", err)
+	}
+	if !n.Size.IsValid() {
+		return n, blob, ""
+	}
+	if err = n.ReadBytes(blob, offset, n.Size, version, checksumAlgorithm); err != nil {
+		return n, blob, err.Error()
+	}
+	return n, blob, ""
+}
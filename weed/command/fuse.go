@@ -150,8 +150,14 @@ func runFuse(cmd *Command, args []string) bool {
 			} else {
 				panic(fmt.Errorf("cacheCapacityMB: %s", err))
 			}
+		case "cacheService":
+			mountOptions.cacheService = &parameter.value
 		case "dataCenter":
 			mountOptions.dataCenter = &parameter.value
+		case "rack":
+			mountOptions.rack = &parameter.value
+		case "replicaSelection":
+			mountOptions.replicaSelection = &parameter.value
 		case "allowOthers":
 			if parsed, err := strconv.ParseBool(parameter.value); err == nil {
 				mountOptions.allowOthers = &parsed
@@ -178,6 +184,31 @@ func runFuse(cmd *Command, args []string) bool {
 			} else {
 				panic(fmt.Errorf("readOnly: %s", err))
 			}
+		case "keepPageCache":
+			if parsed, err := strconv.ParseBool(parameter.value); err == nil {
+				mountOptions.keepPageCache = &parsed
+			} else {
+				panic(fmt.Errorf("keepPageCache: %s", err))
+			}
+		case "writeBack":
+			if parsed, err := strconv.ParseBool(parameter.value); err == nil {
+				mountOptions.writeBack = &parsed
+			} else {
+				panic(fmt.Errorf("writeBack: %s", err))
+			}
+		case "writeBackFlushers":
+			if parsed, err := strconv.ParseInt(parameter.value, 0, 32); err == nil {
+				intValue := int(parsed)
+				mountOptions.writeBackFlushers = &intValue
+			} else {
+				panic(fmt.Errorf("writeBackFlushers: %s", err))
+			}
+		case "dirtyLimitMB":
+			if parsed, err := strconv.ParseInt(parameter.value, 0, 64); err == nil {
+				mountOptions.dirtyLimitMB = &parsed
+			} else {
+				panic(fmt.Errorf("dirtyLimitMB: %s", err))
+			}
 		case "cpuprofile":
 			mountCpuProfile = &parameter.value
 		case "memprofile":
@@ -2,7 +2,6 @@ package command
 
 import (
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
@@ -78,7 +77,7 @@ func (gw *GatewayOptions) startGateway() {
 
 	glog.V(0).Infof("Start Seaweed Gateway %s at %s:%d", util.Version(), *gw.bindIp, *gw.port)
 	gatewayListener, e := util.NewListener(
-		*gw.bindIp+":"+strconv.Itoa(*gw.port),
+		util.JoinHostPort(*gw.bindIp, *gw.port),
 		time.Duration(10)*time.Second,
 	)
 	if e != nil {
@@ -1,13 +1,13 @@
 package command
 
 import (
+	"fmt"
 	"github.com/chrislusf/raft/protobuf"
 	"github.com/gorilla/mux"
 	"google.golang.org/grpc/reflection"
 	"net/http"
 	"os"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +19,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/server"
 	"github.com/chrislusf/seaweedfs/weed/storage/backend"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
@@ -42,13 +43,22 @@ type MasterOptions struct {
 	metricsAddress     *string
 	metricsIntervalSec *int
 	raftResumeState    *bool
+	internalNetworks   *string
+	nodeSuspectSeconds *int
+	nodeDeadSeconds    *int
+	volumeChecksum     *string
+	volumeVersion      *uint
+	quarantineVolumes  *bool
+	snapshot           *string
+	snapshotVolumeGap  *uint
+	snapshotFileKeyGap *uint64
 }
 
 func init() {
 	cmdMaster.Run = runMaster // break init cycle
 	m.port = cmdMaster.Flag.Int("port", 9333, "http listen port")
 	m.ip = cmdMaster.Flag.String("ip", util.DetectedHostAddress(), "master <ip>|<server> address, also used as identifier")
-	m.ipBind = cmdMaster.Flag.String("ip.bind", "", "ip address to bind to")
+	m.ipBind = cmdMaster.Flag.String("ip.bind", "", "ip address to bind to. If empty, default to all the IPv4 and IPv6 addresses")
 	m.metaFolder = cmdMaster.Flag.String("mdir", os.TempDir(), "data directory to store meta data")
 	m.peers = cmdMaster.Flag.String("peers", "", "all master nodes in comma separated ip:port list, example: 127.0.0.1:9093,127.0.0.1:9094,127.0.0.1:9095")
 	m.volumeSizeLimitMB = cmdMaster.Flag.Uint("volumeSizeLimitMB", 30*1000, "Master stops directing writes to oversized volumes.")
@@ -57,10 +67,19 @@ func init() {
 	m.defaultReplication = cmdMaster.Flag.String("defaultReplication", "000", "Default replication type if not specified.")
 	m.garbageThreshold = cmdMaster.Flag.Float64("garbageThreshold", 0.3, "threshold to vacuum and reclaim spaces")
 	m.whiteList = cmdMaster.Flag.String("whiteList", "", "comma separated Ip addresses having write permission. No limit if empty.")
+	m.internalNetworks = cmdMaster.Flag.String("internalNetworks", "", "comma separated CIDR list of in-cluster clients. If set, other clients get the volume server publicUrl as the url in lookups")
 	m.disableHttp = cmdMaster.Flag.Bool("disableHttp", false, "disable http requests, only gRPC operations are allowed.")
 	m.metricsAddress = cmdMaster.Flag.String("metrics.address", "", "Prometheus gateway address <host>:<port>")
 	m.metricsIntervalSec = cmdMaster.Flag.Int("metrics.intervalSeconds", 15, "Prometheus push interval in seconds")
 	m.raftResumeState = cmdMaster.Flag.Bool("resumeState", false, "resume previous state on start master server")
+	m.nodeSuspectSeconds = cmdMaster.Flag.Int("nodeSuspectSeconds", 15, "stop writing to volume servers without heartbeats for this many seconds")
+	m.nodeDeadSeconds = cmdMaster.Flag.Int("nodeDeadSeconds", 60, "remove volume servers without heartbeats for this many seconds from volume lookups")
+	m.volumeChecksum = cmdMaster.Flag.String("volumeChecksum", "", "needle checksum algorithm of new volumes, crc32c or xxhash. Default to crc32c if this cpu calculates it in hardware, otherwise xxhash")
+	m.volumeVersion = cmdMaster.Flag.Uint("volumeVersion", 3, "needle version of new volumes, 3 or 4. Version 4 stores the needle metadata, and can only be read by upgraded volume servers")
+	m.quarantineVolumes = cmdMaster.Flag.Bool("volumeCollisionQuarantine", false, "quarantine the volumes colliding with the volumes of the same ids registered elsewhere, instead of only alerting")
+	m.snapshot = cmdMaster.Flag.String("snapshot", "", "bootstrap a new master set from this snapshot file, saved by master.snapshot.save in weed shell")
+	m.snapshotVolumeGap = cmdMaster.Flag.Uint("snapshot.volumeIdGap", 100, "skip this many volume ids after the snapshot, for the volumes created after it")
+	m.snapshotFileKeyGap = cmdMaster.Flag.Uint64("snapshot.fileKeyGap", 100000000, "skip this many file keys after the snapshot, for the files created after it")
 }
 
 var cmdMaster = &Command{
@@ -110,18 +129,26 @@ func runMaster(cmd *Command, args []string) bool {
 
 func startMaster(masterOption MasterOptions, masterWhiteList []string) {
 
+	master := newMasterComponent(masterOption, masterWhiteList)
+	serveUntilInterrupted("master", master, masterStopTimeout)
+}
+
+// masterComponent is a master server with its raft server
+type masterComponent struct {
+	option     MasterOptions
+	ms         *weed_server.MasterServer
+	raftServer *weed_server.RaftServer
+	router     *mux.Router
+}
+
+func newMasterComponent(masterOption MasterOptions, masterWhiteList []string) *masterComponent {
+
 	backend.LoadConfiguration(util.GetViper())
 
 	myMasterAddress, peers := checkPeers(*masterOption.ip, *masterOption.port, *masterOption.peers)
 
 	r := mux.NewRouter()
 	ms := weed_server.NewMasterServer(r, masterOption.toMasterOption(masterWhiteList), peers)
-	listeningAddress := *masterOption.ipBind + ":" + strconv.Itoa(*masterOption.port)
-	glog.V(0).Infof("Start Seaweed Master %s at %s", util.Version(), listeningAddress)
-	masterListener, e := util.NewListener(listeningAddress, 0)
-	if e != nil {
-		glog.Fatalf("Master startup error: %v", e)
-	}
 	// start raftServer
 	raftServer, err := weed_server.NewRaftServer(security.LoadClientTLS(util.GetViper(), "grpc.master"),
 		peers, myMasterAddress, util.ResolvePath(*masterOption.metaFolder), ms.Topo, *masterOption.raftResumeState)
@@ -130,18 +157,6 @@ func startMaster(masterOption MasterOptions, masterWhiteList []string) {
 	}
 	ms.SetRaftServer(raftServer)
 	r.HandleFunc("/cluster/status", raftServer.StatusHandler).Methods("GET")
-	// starting grpc server
-	grpcPort := *masterOption.port + 10000
-	grpcL, err := util.NewListener(*masterOption.ipBind+":"+strconv.Itoa(grpcPort), 0)
-	if err != nil {
-		glog.Fatalf("master failed to listen on grpc port %d: %v", grpcPort, err)
-	}
-	grpcS := pb.NewGrpcServer(security.LoadServerTLS(util.GetViper(), "grpc.master"))
-	master_pb.RegisterSeaweedServer(grpcS, ms)
-	protobuf.RegisterRaftServer(grpcS, raftServer)
-	reflection.Register(grpcS)
-	glog.V(0).Infof("Start Seaweed Master %s grpc server at %s:%d", util.Version(), *masterOption.ipBind, grpcPort)
-	go grpcS.Serve(grpcL)
 
 	go func() {
 		time.Sleep(1500 * time.Millisecond)
@@ -154,16 +169,50 @@ func startMaster(masterOption MasterOptions, masterWhiteList []string) {
 
 	go ms.MasterClient.KeepConnectedToMaster()
 
+	grace.OnReload(ms.Reload)
+
+	return &masterComponent{
+		option:     masterOption,
+		ms:         ms,
+		raftServer: raftServer,
+		router:     r,
+	}
+}
+
+func (mc *masterComponent) serve(servers *componentServers) error {
+
 	// start http server
-	httpS := &http.Server{Handler: r}
-	go httpS.Serve(masterListener)
+	listeningAddress := util.JoinHostPort(*mc.option.ipBind, *mc.option.port)
+	glog.V(0).Infof("Start Seaweed Master %s at %s", util.Version(), listeningAddress)
+	if err := servers.serveHttp(listeningAddress, 0, &http.Server{Handler: mc.router}, "", ""); err != nil {
+		return fmt.Errorf("master startup error: %v", err)
+	}
 
-	select {}
+	// starting grpc server
+	grpcPort := *mc.option.port + 10000
+	grpcS := pb.NewGrpcServer(security.LoadServerTLS(util.GetViper(), "grpc.master"))
+	master_pb.RegisterSeaweedServer(grpcS, mc.ms)
+	protobuf.RegisterRaftServer(grpcS, mc.raftServer)
+	reflection.Register(grpcS)
+	glog.V(0).Infof("Start Seaweed Master %s grpc server at %s:%d", util.Version(), *mc.option.ipBind, grpcPort)
+	if err := servers.serveGrpc(util.JoinHostPort(*mc.option.ipBind, grpcPort), grpcS); err != nil {
+		return fmt.Errorf("master failed to listen on grpc port %d: %v", grpcPort, err)
+	}
+
+	return nil
+}
+
+func (mc *masterComponent) drain(exiting bool) {
+}
+
+// close stops the raft server, which flushes the raft log
+func (mc *masterComponent) close() {
+	mc.raftServer.Stop()
 }
 
 func checkPeers(masterIp string, masterPort int, peers string) (masterAddress string, cleanedPeers []string) {
 	glog.V(0).Infof("current: %s:%d peers:%s", masterIp, masterPort, peers)
-	masterAddress = masterIp + ":" + strconv.Itoa(masterPort)
+	masterAddress = util.JoinHostPort(masterIp, masterPort)
 	if peers != "" {
 		cleanedPeers = strings.Split(peers, ",")
 	}
@@ -194,6 +243,21 @@ func isTheFirstOne(self string, peers []string) bool {
 }
 
 func (m *MasterOptions) toMasterOption(whiteList []string) *weed_server.MasterOption {
+	internalNetworks, err := util.ParseNetworks(*m.internalNetworks)
+	if err != nil {
+		glog.Fatalf("-internalNetworks: %v", err)
+	}
+	if *m.nodeDeadSeconds < *m.nodeSuspectSeconds {
+		glog.Fatalf("-nodeDeadSeconds %d should not be less than -nodeSuspectSeconds %d", *m.nodeDeadSeconds, *m.nodeSuspectSeconds)
+	}
+	checksumAlgorithm, err := needle.ParseChecksumAlgorithm(*m.volumeChecksum)
+	if err != nil {
+		glog.Fatalf("-volumeChecksum: %v", err)
+	}
+	volumeVersion, err := needle.ParseVolumeVersion(*m.volumeVersion)
+	if err != nil {
+		glog.Fatalf("-volumeVersion: %v", err)
+	}
 	return &weed_server.MasterOption{
 		Host:              *m.ip,
 		Port:              *m.port,
@@ -207,5 +271,14 @@ func (m *MasterOptions) toMasterOption(whiteList []string) *weed_server.MasterOp
 		DisableHttp:             *m.disableHttp,
 		MetricsAddress:          *m.metricsAddress,
 		MetricsIntervalSec:      *m.metricsIntervalSec,
+		InternalNetworks:        internalNetworks,
+		NodeSuspectSeconds:      *m.nodeSuspectSeconds,
+		NodeDeadSeconds:         *m.nodeDeadSeconds,
+		ChecksumAlgorithm:       checksumAlgorithm,
+		VolumeVersion:           volumeVersion,
+		QuarantineVolumes:       *m.quarantineVolumes,
+		SnapshotFile:            util.ResolvePath(*m.snapshot),
+		SnapshotVolumeIdGap:     uint32(*m.snapshotVolumeGap),
+		SnapshotFileKeyGap:      *m.snapshotFileKeyGap,
 	}
 }
@@ -18,7 +18,10 @@ type MountOptions struct {
 	concurrentWriters  *int
 	cacheDir           *string
 	cacheSizeMB        *int64
+	cacheService       *string
 	dataCenter         *string
+	rack               *string
+	replicaSelection   *string
 	allowOthers        *bool
 	umaskString        *string
 	nonempty           *bool
@@ -26,6 +29,10 @@ type MountOptions struct {
 	uidMap             *string
 	gidMap             *string
 	readOnly           *bool
+	keepPageCache      *bool
+	writeBack          *bool
+	writeBackFlushers  *int
+	dirtyLimitMB       *int64
 }
 
 var (
@@ -49,7 +56,10 @@ func init() {
 	mountOptions.concurrentWriters = cmdMount.Flag.Int("concurrentWriters", 32, "limit concurrent goroutine writers if not 0")
 	mountOptions.cacheDir = cmdMount.Flag.String("cacheDir", os.TempDir(), "local cache directory for file chunks and meta data")
 	mountOptions.cacheSizeMB = cmdMount.Flag.Int64("cacheCapacityMB", 1000, "local file chunk cache capacity in MB (0 will disable cache)")
+	mountOptions.cacheService = cmdMount.Flag.String("cacheService", "", "unix socket of a \"weed cache\" process to share its chunk cache, instead of a local cache")
 	mountOptions.dataCenter = cmdMount.Flag.String("dataCenter", "", "prefer to write to the data center")
+	mountOptions.rack = cmdMount.Flag.String("rack", "", "prefer to read from the rack of the data center, with -replicaSelection=nearest")
+	mountOptions.replicaSelection = cmdMount.Flag.String("replicaSelection", "random", "[nearest|random|latency] how to choose the volume replica to read from: same data center and rack first, evenly spread, or lowest probed latency")
 	mountOptions.allowOthers = cmdMount.Flag.Bool("allowOthers", true, "allows other users to access the file system")
 	mountOptions.umaskString = cmdMount.Flag.String("umask", "022", "octal umask, e.g., 022, 0111")
 	mountOptions.nonempty = cmdMount.Flag.Bool("nonempty", false, "allows the mounting over a non-empty directory")
@@ -57,6 +67,10 @@ func init() {
 	mountOptions.uidMap = cmdMount.Flag.String("map.uid", "", "map local uid to uid on filer, comma-separated <local_uid>:<filer_uid>")
 	mountOptions.gidMap = cmdMount.Flag.String("map.gid", "", "map local gid to gid on filer, comma-separated <local_gid>:<filer_gid>")
 	mountOptions.readOnly = cmdMount.Flag.Bool("readOnly", false, "read only")
+	mountOptions.keepPageCache = cmdMount.Flag.Bool("keepPageCache", false, "keep the kernel page cache of unchanged files between opens, for files read many times")
+	mountOptions.writeBack = cmdMount.Flag.Bool("writeBack", false, "return from closing a file before its data is uploaded, and flush it in the background. Use fsync() to wait for it.")
+	mountOptions.writeBackFlushers = cmdMount.Flag.Int("writeBackFlushers", 16, "the number of closed files flushed in the background at the same time, with -writeBack")
+	mountOptions.dirtyLimitMB = cmdMount.Flag.Int64("dirtyLimitMB", 1024, "upload the written data early, and slow down the writers, if the data not uploaded yet is more than this (0 for no limit)")
 
 	mountCpuProfile = cmdMount.Flag.String("cpuprofile", "", "cpu profile output file")
 	mountMemProfile = cmdMount.Flag.String("memprofile", "", "memory profile output file")
@@ -15,12 +15,14 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
 	"github.com/chrislusf/seaweedfs/weed/storage/types"
 
 	"github.com/chrislusf/seaweedfs/weed/filesys/meta_cache"
 
 	"github.com/seaweedfs/fuse"
 	"github.com/seaweedfs/fuse/fs"
+	"google.golang.org/grpc"
 
 	"github.com/chrislusf/seaweedfs/weed/filesys"
 	"github.com/chrislusf/seaweedfs/weed/glog"
@@ -29,6 +31,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/util"
 	"github.com/chrislusf/seaweedfs/weed/util/grace"
+	"github.com/chrislusf/seaweedfs/weed/wdclient"
 )
 
 func runMount(cmd *Command, args []string) bool {
@@ -159,6 +162,23 @@ func RunMount(option *MountOptions, umask os.FileMode) bool {
 		return false
 	}
 
+	replicaSelector, err := wdclient.NewReplicaSelector(*option.replicaSelection, *option.dataCenter, *option.rack)
+	if err != nil {
+		fmt.Printf("failed to parse -replicaSelection: %v\n", err)
+		return false
+	}
+
+	if *option.replication != "" {
+		if _, err := super_block.NewReplicaPlacementFromString(*option.replication); err != nil {
+			fmt.Printf("failed to parse -replication %s: %v\n", *option.replication, err)
+			return false
+		}
+	}
+	if *option.ttlSec < 0 {
+		fmt.Printf("invalid -ttl %d\n", *option.ttlSec)
+		return false
+	}
+
 	// Ensure target mount point availability
 	if isValid := checkMountPointAvailable(dir); !isValid {
 		glog.Fatalf("Expected mount to still be active, target mount point: %s, please check!", dir)
@@ -201,6 +221,11 @@ func RunMount(option *MountOptions, umask os.FileMode) bool {
 		mountRoot = mountRoot[0 : len(mountRoot)-1]
 	}
 
+	if err := ensureMountRoot(filerGrpcAddresses, grpcDialOption, mountRoot, *option.readOnly); err != nil {
+		fmt.Printf("failed to prepare -filer.path %s: %v\n", mountRoot, err)
+		return false
+	}
+
 	diskType := types.ToDiskType(*option.diskType)
 
 	seaweedFileSystem := filesys.NewSeaweedFileSystem(&filesys.Option{
@@ -217,7 +242,13 @@ func RunMount(option *MountOptions, umask os.FileMode) bool {
 		ConcurrentWriters:  *option.concurrentWriters,
 		CacheDir:           *option.cacheDir,
 		CacheSizeMB:        *option.cacheSizeMB,
+		CacheService:       *option.cacheService,
 		DataCenter:         *option.dataCenter,
+		ReplicaSelector:    replicaSelector,
+		KeepPageCache:      *option.keepPageCache,
+		WriteBack:          *option.writeBack,
+		WriteBackFlushers:  *option.writeBackFlushers,
+		DirtyLimitMB:       *option.dirtyLimitMB,
 		MountUid:           uid,
 		MountGid:           gid,
 		MountMode:          mountMode,
@@ -258,3 +289,44 @@ func RunMount(option *MountOptions, umask os.FileMode) bool {
 
 	return true
 }
+
+// ensureMountRoot creates the mounted folder on the filer if missing, so a mount can start with an empty subtree
+func ensureMountRoot(filerGrpcAddresses []string, grpcDialOption grpc.DialOption, mountRoot string, readOnly bool) error {
+	if mountRoot == "/" {
+		return nil
+	}
+	dir, name := util.FullPath(mountRoot).DirAndName()
+	return pb.WithOneOfGrpcFilerClients(filerGrpcAddresses, grpcDialOption, func(client filer_pb.SeaweedFilerClient) error {
+		resp, err := filer_pb.LookupEntry(client, &filer_pb.LookupDirectoryEntryRequest{
+			Directory: dir,
+			Name:      name,
+		})
+		if err == nil {
+			if !resp.Entry.IsDirectory {
+				return fmt.Errorf("not a directory")
+			}
+			return nil
+		}
+		if err != filer_pb.ErrNotFound {
+			return err
+		}
+		if readOnly {
+			return fmt.Errorf("not found")
+		}
+		glog.V(0).Infof("create mount root %s", mountRoot)
+		return filer_pb.CreateEntry(client, &filer_pb.CreateEntryRequest{
+			Directory: dir,
+			Entry: &filer_pb.Entry{
+				Name:        name,
+				IsDirectory: true,
+				Attributes: &filer_pb.FuseAttributes{
+					Mtime:    time.Now().Unix(),
+					Crtime:   time.Now().Unix(),
+					FileMode: uint32(0777 | os.ModeDir),
+					Uid:      filer_pb.OS_UID,
+					Gid:      filer_pb.OS_GID,
+				},
+			},
+		})
+	})
+}
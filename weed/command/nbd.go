@@ -0,0 +1,160 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/nbd"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/grace"
+)
+
+var (
+	nbdOptions NbdOptions
+)
+
+type NbdOptions struct {
+	filer                *string
+	filePath             *string
+	size                 *string
+	bindIp               *string
+	port                 *int
+	readOnly             *bool
+	collection           *string
+	replication          *string
+	disk                 *string
+	chunkSizeLimitMB     *int
+	journalDir           *string
+	journalSizeLimitMB   *int
+	flushIntervalSeconds *int
+	cacheDir             *string
+	cacheSizeMB          *int64
+}
+
+func init() {
+	cmdNbd.Run = runNbd // break init cycle
+	nbdOptions.filer = cmdNbd.Flag.String("filer", "localhost:8888", "filer server address")
+	nbdOptions.filePath = cmdNbd.Flag.String("path", "", "the file in the filer to export as the block device")
+	nbdOptions.size = cmdNbd.Flag.String("size", "", "create the file with this size if not found, or grow the file to this size, e.g., 10GiB")
+	nbdOptions.bindIp = cmdNbd.Flag.String("ip.bind", "127.0.0.1", "ip address to bind to")
+	nbdOptions.port = cmdNbd.Flag.Int("port", 10809, "nbd server listen port")
+	nbdOptions.readOnly = cmdNbd.Flag.Bool("readOnly", false, "export the block device as read only")
+	nbdOptions.collection = cmdNbd.Flag.String("collection", "", "collection to create the file chunks")
+	nbdOptions.replication = cmdNbd.Flag.String("replication", "", "replication to create the file chunks")
+	nbdOptions.disk = cmdNbd.Flag.String("disk", "", "[hdd|ssd|<tag>] hard drive or solid state drive or any tag")
+	nbdOptions.chunkSizeLimitMB = cmdNbd.Flag.Int("chunkSizeLimitMB", 4, "the largest chunk uploaded when flushing the writes")
+	nbdOptions.journalDir = cmdNbd.Flag.String("journalDir", os.TempDir(), "local directory for the write journal")
+	nbdOptions.journalSizeLimitMB = cmdNbd.Flag.Int("journalSizeLimitMB", 256, "flush the writes to the filer when the write journal is larger than this limit")
+	nbdOptions.flushIntervalSeconds = cmdNbd.Flag.Int("flushIntervalSeconds", 10, "flush the writes to the filer periodically, 0 to flush only when requested by the client or the journal is full")
+	nbdOptions.cacheDir = cmdNbd.Flag.String("cacheDir", os.TempDir(), "local cache directory for file chunks")
+	nbdOptions.cacheSizeMB = cmdNbd.Flag.Int64("cacheCapacityMB", 1000, "local cache capacity in MB")
+}
+
+var cmdNbd = &Command{
+	UsageLine: "nbd -filer=<ip:port> -path=/path/to/disk.img [-size=10GiB]",
+	Short:     "[experimental] export a file in the filer as a network block device",
+	Long: `[experimental] export a file in the filer as a network block device
+
+	The file is served with the NBD protocol, e.g., to attach it as a block device with nbd-client,
+	or as a disk of a virtual machine with qemu:
+
+		weed nbd -filer=localhost:8888 -path=/vm/disk.img -size=10GiB
+		nbd-client -N /vm/disk.img 127.0.0.1 10809 /dev/nbd0
+		qemu-system-x86_64 -drive file=nbd://127.0.0.1:10809/vm/disk.img ...
+
+	The writes are appended to a local write journal first, and are acknowledged once journaled.
+	The journal is uploaded to the filer as file chunks when the client flushes, when it is larger
+	than -journalSizeLimitMB, or every -flushIntervalSeconds. After a crash, the journal is
+	replayed and uploaded when the device is exported again.
+
+	Only one nbd server should export the same file at the same time.
+
+`,
+}
+
+func runNbd(cmd *Command, args []string) bool {
+
+	util.LoadConfiguration("security", false)
+
+	if *nbdOptions.filePath == "" {
+		fmt.Printf("please set the file path with -path\n")
+		return false
+	}
+
+	var size int64
+	if *nbdOptions.size != "" {
+		parsedSize, err := util.ParseBytes(*nbdOptions.size)
+		if err != nil {
+			fmt.Printf("parse size %s: %v\n", *nbdOptions.size, err)
+			return false
+		}
+		size = int64(parsedSize)
+	}
+
+	filerGrpcAddress, err := pb.ParseServerToGrpcAddress(*nbdOptions.filer)
+	if err != nil {
+		glog.Fatal(err)
+		return false
+	}
+	grpcDialOption := security.LoadClientTLS(util.GetViper(), "grpc.client")
+
+	var cipher bool
+	err = pb.WithGrpcFilerClient(filerGrpcAddress, grpcDialOption, func(client filer_pb.SeaweedFilerClient) error {
+		resp, err := client.GetFilerConfiguration(context.Background(), &filer_pb.GetFilerConfigurationRequest{})
+		if err != nil {
+			return fmt.Errorf("get filer %s configuration: %v", filerGrpcAddress, err)
+		}
+		cipher = resp.Cipher
+		return nil
+	})
+	if err != nil {
+		glog.Fatal(err)
+		return false
+	}
+
+	device, err := nbd.NewFilerDevice(&nbd.FilerDeviceOption{
+		FilerGrpcAddress: filerGrpcAddress,
+		GrpcDialOption:   grpcDialOption,
+		Path:             util.FullPath(*nbdOptions.filePath),
+		Size:             size,
+		Collection:       *nbdOptions.collection,
+		Replication:      *nbdOptions.replication,
+		DiskType:         *nbdOptions.disk,
+		Cipher:           cipher,
+		ChunkSizeLimit:   int64(*nbdOptions.chunkSizeLimitMB) * 1024 * 1024,
+		JournalDir:       util.ResolvePath(*nbdOptions.journalDir),
+		JournalSizeLimit: int64(*nbdOptions.journalSizeLimitMB) * 1024 * 1024,
+		FlushInterval:    time.Duration(*nbdOptions.flushIntervalSeconds) * time.Second,
+		CacheDir:         util.ResolvePath(*nbdOptions.cacheDir),
+		CacheSizeMB:      *nbdOptions.cacheSizeMB,
+	})
+	if err != nil {
+		glog.Fatalf("export %s: %v", *nbdOptions.filePath, err)
+	}
+	grace.OnInterrupt(func() {
+		if err := device.Close(); err != nil {
+			glog.Errorf("close %s: %v", *nbdOptions.filePath, err)
+		}
+	})
+
+	listenAddress := util.JoinHostPort(*nbdOptions.bindIp, *nbdOptions.port)
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		glog.Fatalf("nbd server listener on %s error: %v", listenAddress, err)
+	}
+
+	glog.V(0).Infof("Start Seaweed NBD Server %s at %s, exporting %s of %d bytes", util.Version(), listenAddress, *nbdOptions.filePath, device.Size())
+	server := nbd.NewServer(device, *nbdOptions.filePath, *nbdOptions.readOnly)
+	if err = server.Serve(listener); err != nil {
+		glog.Fatalf("nbd server fail to serve: %v", err)
+	}
+
+	return true
+}
@@ -27,10 +27,15 @@ type S3Options struct {
 	port             *int
 	config           *string
 	domainName       *string
+	region           *string
 	tlsPrivateKey    *string
 	tlsCertificate   *string
 	metricsHttpPort  *int
 	allowEmptyFolder *bool
+	websitePort      *int
+
+	abortIncompleteMultipartUploadDays *int
+	metricsPerBucket                   *bool
 }
 
 func init() {
@@ -38,11 +43,15 @@ func init() {
 	s3StandaloneOptions.filer = cmdS3.Flag.String("filer", "localhost:8888", "filer server address")
 	s3StandaloneOptions.port = cmdS3.Flag.Int("port", 8333, "s3 server http listen port")
 	s3StandaloneOptions.domainName = cmdS3.Flag.String("domainName", "", "suffix of the host name in comma separated list, {bucket}.{domainName}")
+	s3StandaloneOptions.region = cmdS3.Flag.String("region", "", "the region of the buckets, returned by GetBucketLocation, and requests signed for other regions are redirected. Defaults to us-east-1")
 	s3StandaloneOptions.config = cmdS3.Flag.String("config", "", "path to the config file")
 	s3StandaloneOptions.tlsPrivateKey = cmdS3.Flag.String("key.file", "", "path to the TLS private key file")
 	s3StandaloneOptions.tlsCertificate = cmdS3.Flag.String("cert.file", "", "path to the TLS certificate file")
 	s3StandaloneOptions.metricsHttpPort = cmdS3.Flag.Int("metricsPort", 0, "Prometheus metrics listen port")
 	s3StandaloneOptions.allowEmptyFolder = cmdS3.Flag.Bool("allowEmptyFolder", false, "allow empty folders")
+	s3StandaloneOptions.websitePort = cmdS3.Flag.Int("websitePort", 0, "static website http listen port for the buckets with website configuration, 0 to disable")
+	s3StandaloneOptions.abortIncompleteMultipartUploadDays = cmdS3.Flag.Int("abortIncompleteMultipartUploadDays", 0, "abort incomplete multipart uploads after this many days, unless configured by the bucket lifecycle. 0 means never")
+	s3StandaloneOptions.metricsPerBucket = cmdS3.Flag.Bool("metricsPerBucket", false, "break down the s3 API operation metrics by the bucket, adding a label value per bucket")
 }
 
 var cmdS3 = &Command{
@@ -137,10 +146,25 @@ func runS3(cmd *Command, args []string) bool {
 
 func (s3opt *S3Options) startS3Server() bool {
 
+	sc := s3opt.newS3Component()
+	serveUntilInterrupted("s3", sc, defaultComponentStopTimeout)
+
+	return true
+
+}
+
+// s3Component is a S3 API server with its router, and the optional static website router
+type s3Component struct {
+	s3opt         *S3Options
+	router        *mux.Router
+	websiteRouter *mux.Router
+}
+
+func (s3opt *S3Options) newS3Component() *s3Component {
+
 	filerGrpcAddress, err := pb.ParseServerToGrpcAddress(*s3opt.filer)
 	if err != nil {
 		glog.Fatal(err)
-		return false
 	}
 
 	filerBucketsPath := "/buckets"
@@ -175,40 +199,66 @@ func (s3opt *S3Options) startS3Server() bool {
 
 	router := mux.NewRouter().SkipClean(true)
 
-	_, s3ApiServer_err := s3api.NewS3ApiServer(router, &s3api.S3ApiServerOption{
+	s3ApiServer, s3ApiServer_err := s3api.NewS3ApiServer(router, &s3api.S3ApiServerOption{
 		Filer:            *s3opt.filer,
 		Port:             *s3opt.port,
 		FilerGrpcAddress: filerGrpcAddress,
 		Config:           *s3opt.config,
 		DomainName:       *s3opt.domainName,
+		Region:           *s3opt.region,
 		BucketsPath:      filerBucketsPath,
 		GrpcDialOption:   grpcDialOption,
 		AllowEmptyFolder: *s3opt.allowEmptyFolder,
+
+		AbortIncompleteMultipartUploadDays: *s3opt.abortIncompleteMultipartUploadDays,
+		MetricsPerBucket:                   *s3opt.metricsPerBucket,
 	})
 	if s3ApiServer_err != nil {
 		glog.Fatalf("S3 API Server startup error: %v", s3ApiServer_err)
 	}
 
-	httpS := &http.Server{Handler: router}
+	var websiteRouter *mux.Router
+	if *s3opt.websitePort > 0 {
+		websiteRouter = mux.NewRouter().SkipClean(true)
+		s3ApiServer.RegisterWebsiteRouter(websiteRouter)
+	}
 
-	listenAddress := fmt.Sprintf(":%d", *s3opt.port)
-	s3ApiListener, err := util.NewListener(listenAddress, time.Duration(10)*time.Second)
-	if err != nil {
-		glog.Fatalf("S3 API Server listener on %s error: %v", listenAddress, err)
+	return &s3Component{
+		s3opt:         s3opt,
+		router:        router,
+		websiteRouter: websiteRouter,
 	}
+}
+
+func (sc *s3Component) serve(servers *componentServers) error {
+	s3opt := sc.s3opt
 
+	var certFile, keyFile string
 	if *s3opt.tlsPrivateKey != "" {
 		glog.V(0).Infof("Start Seaweed S3 API Server %s at https port %d", util.Version(), *s3opt.port)
-		if err = httpS.ServeTLS(s3ApiListener, *s3opt.tlsCertificate, *s3opt.tlsPrivateKey); err != nil {
-			glog.Fatalf("S3 API Server Fail to serve: %v", err)
-		}
+		certFile, keyFile = *s3opt.tlsCertificate, *s3opt.tlsPrivateKey
 	} else {
 		glog.V(0).Infof("Start Seaweed S3 API Server %s at http port %d", util.Version(), *s3opt.port)
-		if err = httpS.Serve(s3ApiListener); err != nil {
-			glog.Fatalf("S3 API Server Fail to serve: %v", err)
+	}
+
+	listenAddress := fmt.Sprintf(":%d", *s3opt.port)
+	if err := servers.serveHttp(listenAddress, time.Duration(10)*time.Second, &http.Server{Handler: sc.router}, certFile, keyFile); err != nil {
+		return fmt.Errorf("S3 API Server listener on %s error: %v", listenAddress, err)
+	}
+
+	if sc.websiteRouter != nil {
+		glog.V(0).Infof("Start Seaweed S3 website endpoint at port %d", *s3opt.websitePort)
+		websiteAddress := fmt.Sprintf(":%d", *s3opt.websitePort)
+		if err := servers.serveHttp(websiteAddress, time.Duration(10)*time.Second, &http.Server{Handler: sc.websiteRouter}, certFile, keyFile); err != nil {
+			return fmt.Errorf("S3 website listener on %s error: %v", websiteAddress, err)
 		}
 	}
 
-	return true
+	return nil
+}
+
+func (sc *s3Component) drain(exiting bool) {
+}
 
+func (sc *s3Component) close() {
 }
@@ -1,9 +1,11 @@
 package command
 
 import (
-	"github.com/chrislusf/seaweedfs/weed/command/scaffold"
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
+
+	"github.com/chrislusf/seaweedfs/weed/command/scaffold"
 )
 
 func init() {
@@ -11,52 +13,79 @@ func init() {
 }
 
 var cmdScaffold = &Command{
-	UsageLine: "scaffold -config=[filer|notification|replication|security|master]",
+	UsageLine: "scaffold -config=[filer|notification|replication|security|master|volume|shell|all]",
 	Short:     "generate basic configuration files",
 	Long: `Generate filer.toml with all possible configurations for you to customize.
 
+	weed scaffold -config=master                # print master.toml
+	weed scaffold -config=all -output=/etc/seaweedfs   # save all configuration files to /etc/seaweedfs
+
 	The options can also be overwritten by environment variables.
 	For example, the filer.toml mysql password can be overwritten by environment variable
 		export WEED_MYSQL_PASSWORD=some_password
 	Environment variable rules:
 		* Prefix the variable name with "WEED_"
-		* Upppercase the reset of variable name.
+		* Uppercase the rest of variable name.
 		* Replace '.' with '_'
+	A list option takes comma-separated values, e.g.,
+		export WEED_MASTER_EVENTS_TYPES=node_leave,replica_lost
+	The overridden options are logged when the configuration files are loaded.
 
   `,
 }
 
 var (
 	outputPath = cmdScaffold.Flag.String("output", "", "if not empty, save the configuration file to this directory")
-	config     = cmdScaffold.Flag.String("config", "filer", "[filer|notification|replication|security|master] the configuration file to generate")
+	config     = cmdScaffold.Flag.String("config", "filer", "[filer|notification|replication|security|master|volume|shell|all] the configuration file to generate")
 )
 
+var scaffoldConfigs = []struct {
+	name    string
+	content string
+}{
+	{"filer", scaffold.Filer},
+	{"notification", scaffold.Notification},
+	{"replication", scaffold.Replication},
+	{"security", scaffold.Security},
+	{"master", scaffold.Master},
+	{"volume", scaffold.Volume},
+	{"shell", scaffold.Shell},
+}
+
 func runScaffold(cmd *Command, args []string) bool {
 
-	content := ""
-	switch *config {
-	case "filer":
-		content = scaffold.Filer
-	case "notification":
-		content = scaffold.Notification
-	case "replication":
-		content = scaffold.Replication
-	case "security":
-		content = scaffold.Security
-	case "master":
-		content = scaffold.Master
-	case "shell":
-		content = scaffold.Shell
+	if *config == "all" {
+		if *outputPath == "" {
+			println("need the -output directory for all configuration files")
+			return false
+		}
+		for _, c := range scaffoldConfigs {
+			if !writeScaffold(c.name, c.content) {
+				return false
+			}
+		}
+		return true
 	}
-	if content == "" {
-		println("need a valid -config option")
-		return false
+
+	for _, c := range scaffoldConfigs {
+		if c.name == *config {
+			return writeScaffold(c.name, c.content)
+		}
 	}
+	println("need a valid -config option")
+	return false
+}
 
-	if *outputPath != "" {
-		ioutil.WriteFile(filepath.Join(*outputPath, *config+".toml"), []byte(content), 0644)
-	} else {
+func writeScaffold(name, content string) bool {
+	if *outputPath == "" {
 		println(content)
+		return true
+	}
+	fileName := filepath.Join(*outputPath, name+".toml")
+	if err := ioutil.WriteFile(fileName, []byte(content), 0644); err != nil {
+		fmt.Printf("write %s: %v\n", fileName, err)
+		return false
 	}
+	fmt.Printf("saved %s\n", fileName)
 	return true
 }
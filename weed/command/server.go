@@ -45,12 +45,22 @@ var cmdServer = &Command{
   Optionally, a filer server can be started.
   Also optionally, a S3 gateway can be started.
 
+  The master, volume server, filer and S3 gateway are supervised. Their listeners are served again
+  if they fail, and their health is checked periodically. On SIGTERM, they are stopped in the order of
+  S3 gateway, filer, volume server and master, each finishing its in-flight requests first.
+
+  With -adminPort, the components can be listed, enabled, disabled or restarted at runtime:
+    curl http://localhost:<adminPort>/components
+    curl -X POST http://localhost:<adminPort>/components/disable?name=s3
+    curl -X POST http://localhost:<adminPort>/components/enable?name=s3
+    curl -X POST http://localhost:<adminPort>/components/restart?name=filer
+
   `,
 }
 
 var (
 	serverIp                  = cmdServer.Flag.String("ip", util.DetectedHostAddress(), "ip or server name, also used as identifier")
-	serverBindIp              = cmdServer.Flag.String("ip.bind", "", "ip address to bind to")
+	serverBindIp              = cmdServer.Flag.String("ip.bind", "", "ip address to bind to. If empty, default to all the IPv4 and IPv6 addresses")
 	serverTimeout             = cmdServer.Flag.Int("idleTimeout", 30, "connection idle seconds")
 	serverDataCenter          = cmdServer.Flag.String("dataCenter", "", "current volume server's data center name")
 	serverRack                = cmdServer.Flag.String("rack", "", "current volume server's rack name")
@@ -61,6 +71,7 @@ var (
 	volumeMinFreeSpacePercent = cmdServer.Flag.String("volume.minFreeSpacePercent", "1", "minimum free disk space (default to 1%). Low disk space will mark all volumes as ReadOnly (deprecated, use minFreeSpace instead).")
 	volumeMinFreeSpace        = cmdServer.Flag.String("volume.minFreeSpace", "", "min free disk space (value<=100 as percentage like 1, other as human readable bytes, like 10GiB). Low disk space will mark all volumes as ReadOnly.")
 	serverMetricsHttpPort     = cmdServer.Flag.Int("metricsPort", 0, "Prometheus metrics listen port")
+	serverAdminPort           = cmdServer.Flag.Int("adminPort", 0, "admin http port to list, enable, disable or restart the master, volume, filer and s3 components. Disabled if 0.")
 
 	// pulseSeconds              = cmdServer.Flag.Int("pulseSeconds", 5, "number of seconds between heartbeats")
 	isStartingMasterServer = cmdServer.Flag.Bool("master", true, "whether to start master server")
@@ -89,6 +100,15 @@ func init() {
 	masterOptions.metricsAddress = cmdServer.Flag.String("metrics.address", "", "Prometheus gateway address")
 	masterOptions.metricsIntervalSec = cmdServer.Flag.Int("metrics.intervalSeconds", 15, "Prometheus push interval in seconds")
 	masterOptions.raftResumeState = cmdServer.Flag.Bool("resumeState", false, "resume previous state on start master server")
+	masterOptions.internalNetworks = cmdServer.Flag.String("master.internalNetworks", "", "comma separated CIDR list of in-cluster clients. If set, other clients get the volume server publicUrl as the url in lookups")
+	masterOptions.nodeSuspectSeconds = cmdServer.Flag.Int("master.nodeSuspectSeconds", 15, "stop writing to volume servers without heartbeats for this many seconds")
+	masterOptions.nodeDeadSeconds = cmdServer.Flag.Int("master.nodeDeadSeconds", 60, "remove volume servers without heartbeats for this many seconds from volume lookups")
+	masterOptions.volumeChecksum = cmdServer.Flag.String("master.volumeChecksum", "", "needle checksum algorithm of new volumes, crc32c or xxhash. Default to crc32c if this cpu calculates it in hardware, otherwise xxhash")
+	masterOptions.volumeVersion = cmdServer.Flag.Uint("master.volumeVersion", 3, "needle version of new volumes, 3 or 4. Version 4 stores the needle metadata, and can only be read by upgraded volume servers")
+	masterOptions.quarantineVolumes = cmdServer.Flag.Bool("master.volumeCollisionQuarantine", false, "quarantine the volumes colliding with the volumes of the same ids registered elsewhere, instead of only alerting")
+	masterOptions.snapshot = cmdServer.Flag.String("master.snapshot", "", "bootstrap a new master set from this snapshot file, saved by master.snapshot.save in weed shell")
+	masterOptions.snapshotVolumeGap = cmdServer.Flag.Uint("master.snapshot.volumeIdGap", 100, "skip this many volume ids after the snapshot, for the volumes created after it")
+	masterOptions.snapshotFileKeyGap = cmdServer.Flag.Uint64("master.snapshot.fileKeyGap", 100000000, "skip this many file keys after the snapshot, for the files created after it")
 
 	filerOptions.collection = cmdServer.Flag.String("filer.collection", "", "all data will be stored in this collection")
 	filerOptions.port = cmdServer.Flag.Int("filer.port", 8888, "filer server http listen port")
@@ -101,21 +121,41 @@ func init() {
 	filerOptions.peers = cmdServer.Flag.String("filer.peers", "", "all filers sharing the same filer store in comma separated ip:port list")
 	filerOptions.saveToFilerLimit = cmdServer.Flag.Int("filer.saveToFilerLimit", 0, "Small files smaller than this limit can be cached in filer store.")
 	filerOptions.concurrentUploadLimitMB = cmdServer.Flag.Int("filer.concurrentUploadLimitMB", 64, "limit total concurrent upload size")
+	filerOptions.volumeMaxIdleConns = cmdServer.Flag.Int("filer.volume.maxIdleConnsPerHost", 1024, "max idle keep-alive connections to each volume server")
+	filerOptions.streamReads = cmdServer.Flag.Bool("filer.streamReads", false, "stream the file content to the client while reading from volume servers, without holding whole chunks in memory")
+	filerOptions.internalNetworks = cmdServer.Flag.String("filer.internalNetworks", "", "comma separated CIDR list of in-cluster clients, which are redirected to the volume server url instead of the public url")
+	filerOptions.metaCacheSize = cmdServer.Flag.Int("filer.metaCacheSize", 0, "number of entries and listed entries cached in memory in front of slow filer stores, 0 to disable")
+	filerOptions.dedupChunks = cmdServer.Flag.Bool("filer.dedupChunks", false, "reuse the uploaded chunks with the same content, reference counted in the filer store. Only for one filer writing to the filer store.")
+	filerOptions.volumeH2c = cmdServer.Flag.Bool("filer.volume.h2c", false, "send requests to http volume servers as cleartext HTTP/2, multiplexed on one connection per volume server. The https volume servers use HTTP/2 by TLS ALPN.")
+	filerOptions.replicaSelection = cmdServer.Flag.String("filer.replicaSelection", "nearest", "[nearest|random|latency] how to choose the volume replica to read from: same data center and rack first, evenly spread, or lowest probed latency")
+	filerOptions.concurrentChunkUploads = cmdServer.Flag.Int("filer.concurrentChunkUploads", 4, "upload this many chunks of one file in parallel")
+	filerOptions.chunkUploadAttempts = cmdServer.Flag.Int("filer.chunkUploadAttempts", 3, "try uploading a chunk this many times, on another volume server after a failure")
+	filerOptions.volumeUploadTimeout = cmdServer.Flag.Duration("filer.volume.uploadTimeout", 0, "fail an upload to a volume server taking longer than this, to retry on another volume server. 0 means no timeout")
+	filerOptions.concurrentReads = cmdServer.Flag.Int("filer.concurrentReads", 0, "limit concurrent http read requests, 0 for no limit")
+	filerOptions.concurrentWrites = cmdServer.Flag.Int("filer.concurrentWrites", 0, "limit concurrent http write requests, 0 for no limit")
+	filerOptions.concurrentDeletes = cmdServer.Flag.Int("filer.concurrentDeletes", 0, "limit concurrent http delete requests, e.g., so that bulk deletes can not starve the reads. 0 for no limit")
+	filerOptions.requestQueueTimeout = cmdServer.Flag.Duration("filer.requestQueueTimeout", 30*time.Second, "reply 503 to http requests waiting longer than this for the concurrent request limits. 0 to wait forever")
 
 	serverOptions.v.port = cmdServer.Flag.Int("volume.port", 8080, "volume server http listen port")
 	serverOptions.v.publicPort = cmdServer.Flag.Int("volume.port.public", 0, "volume server public port")
-	serverOptions.v.indexType = cmdServer.Flag.String("volume.index", "memory", "Choose [memory|leveldb|leveldbMedium|leveldbLarge] mode for memory~performance balance.")
+	serverOptions.v.indexType = cmdServer.Flag.String("volume.index", "memory", "Choose [memory|leveldb|leveldbMedium|leveldbLarge|boltdb] mode for memory~performance balance. boltdb keeps the index in an on-disk b+tree.")
 	serverOptions.v.diskType = cmdServer.Flag.String("volume.disk", "", "[hdd|ssd|<tag>] hard drive or solid state drive or any tag")
 	serverOptions.v.fixJpgOrientation = cmdServer.Flag.Bool("volume.images.fix.orientation", false, "Adjust jpg orientation when uploading.")
+	serverOptions.v.checkLevel = cmdServer.Flag.String("volume.check", "index", "[none|index|full] how much to validate the volumes at startup: nothing, the index file and its last entries, or also every needle's checksum")
 	serverOptions.v.readMode = cmdServer.Flag.String("volume.readMode", "proxy", "[local|proxy|redirect] how to deal with non-local volume: 'not found|read in remote node|redirect volume location'.")
 	serverOptions.v.compactionMBPerSecond = cmdServer.Flag.Int("volume.compactionMBps", 0, "limit compaction speed in mega bytes per second")
 	serverOptions.v.fileSizeLimitMB = cmdServer.Flag.Int("volume.fileSizeLimitMB", 256, "limit file size to avoid out of memory")
 	serverOptions.v.concurrentUploadLimitMB = cmdServer.Flag.Int("volume.concurrentUploadLimitMB", 64, "limit total concurrent upload size")
+	serverOptions.v.deleteGraceMinutes = cmdServer.Flag.Int("volume.deleteGraceMinutes", 0, "keep deleted files through vacuum for this many minutes, during which they can be undeleted by volume.undelete")
+	serverOptions.v.indexMemoryBudgetMB = cmdServer.Flag.Int("volume.index.memoryBudgetMB", 0, "limit the memory of the in-memory indexes of all volumes, by switching the indexes of the least recently accessed volumes to leveldb. 0 for no limit")
+	serverOptions.v.crossDcReplicationQueue = cmdServer.Flag.Int("volume.crossDcReplicationQueue", 0, "replicate to the volumes in other data centers in the background, with at most this many writes queued for each replica. 0 to replicate synchronously")
 	serverOptions.v.publicUrl = cmdServer.Flag.String("volume.publicUrl", "", "publicly accessible address")
 	serverOptions.v.preStopSeconds = cmdServer.Flag.Int("volume.preStopSeconds", 10, "number of seconds between stop send heartbeats and stop volume server")
 	serverOptions.v.pprof = cmdServer.Flag.Bool("volume.pprof", false, "enable pprof http handlers. precludes --memprofile and --cpuprofile")
 	serverOptions.v.idxFolder = cmdServer.Flag.String("volume.dir.idx", "", "directory to store .idx files")
 	serverOptions.v.enableTcp = cmdServer.Flag.Bool("volume.tcp", false, "<exprimental> enable tcp port")
+	serverOptions.v.copyMaxAttempts = cmdServer.Flag.Int("volume.copy.maxAttempts", 5, "attempts to copy a volume from a volume server which is unavailable")
+	serverOptions.v.copyMaxBackoffSeconds = cmdServer.Flag.Int("volume.copy.maxBackoffSeconds", 16, "max seconds to wait between the attempts to copy a volume, doubled from 1 second")
 
 	s3Options.port = cmdServer.Flag.Int("s3.port", 8333, "s3 server http listen port")
 	s3Options.domainName = cmdServer.Flag.String("s3.domainName", "", "suffix of the host name in comma separated list, {bucket}.{domainName}")
@@ -123,6 +163,10 @@ func init() {
 	s3Options.tlsCertificate = cmdServer.Flag.String("s3.cert.file", "", "path to the TLS certificate file")
 	s3Options.config = cmdServer.Flag.String("s3.config", "", "path to the config file")
 	s3Options.allowEmptyFolder = cmdServer.Flag.Bool("s3.allowEmptyFolder", false, "allow empty folders")
+	s3Options.region = cmdServer.Flag.String("s3.region", "", "the region of the buckets, returned by GetBucketLocation, and requests signed for other regions are redirected. Defaults to us-east-1")
+	s3Options.websitePort = cmdServer.Flag.Int("s3.websitePort", 0, "static website http listen port for the buckets with website configuration, 0 to disable")
+	s3Options.abortIncompleteMultipartUploadDays = cmdServer.Flag.Int("s3.abortIncompleteMultipartUploadDays", 0, "abort incomplete multipart uploads after this many days, unless configured by the bucket lifecycle. 0 means never")
+	s3Options.metricsPerBucket = cmdServer.Flag.Bool("s3.metricsPerBucket", false, "break down the s3 API operation metrics by the bucket, adding a label value per bucket")
 
 	webdavOptions.port = cmdServer.Flag.Int("webdav.port", 7333, "webdav server http listen port")
 	webdavOptions.collection = cmdServer.Flag.String("webdav.collection", "", "collection to create the files")
@@ -132,6 +176,7 @@ func init() {
 	webdavOptions.tlsCertificate = cmdServer.Flag.String("webdav.cert.file", "", "path to the TLS certificate file")
 	webdavOptions.cacheDir = cmdServer.Flag.String("webdav.cacheDir", os.TempDir(), "local cache directory for file chunks")
 	webdavOptions.cacheSizeMB = cmdServer.Flag.Int64("webdav.cacheCapacityMB", 1000, "local cache capacity in MB")
+	webdavOptions.cacheService = cmdServer.Flag.String("webdav.cacheService", "", "unix socket of a \"weed cache\" process to share its chunk cache, instead of a local cache")
 
 	msgBrokerOptions.port = cmdServer.Flag.Int("msgBroker.port", 17777, "broker gRPC listen port")
 
@@ -140,6 +185,7 @@ func init() {
 func runServer(cmd *Command, args []string) bool {
 
 	util.LoadConfiguration("security", false)
+	util.LoadConfiguration("volume", false)
 	util.LoadConfiguration("master", false)
 
 	grace.SetupProfiling(*serverOptions.cpuprofile, *serverOptions.memprofile)
@@ -184,7 +230,7 @@ func runServer(cmd *Command, args []string) bool {
 	filerOptions.disableHttp = serverDisableHttp
 	masterOptions.disableHttp = serverDisableHttp
 
-	filerAddress := fmt.Sprintf("%s:%d", *serverIp, *filerOptions.port)
+	filerAddress := util.JoinHostPort(*serverIp, *filerOptions.port)
 	s3Options.filer = &filerAddress
 	webdavOptions.filer = &filerAddress
 	msgBrokerOptions.filer = &filerAddress
@@ -209,22 +255,40 @@ func runServer(cmd *Command, args []string) bool {
 		serverWhiteList = strings.Split(*serverWhiteListOption, ",")
 	}
 
+	// the master, volume server, filer and S3 gateway are supervised, in the order of their dependencies
+	supervisor := &serverSupervisor{}
+	if *isStartingMasterServer {
+		supervisor.addComponent("master", fmt.Sprintf("http://%s/cluster/status", util.JoinHostPort(*serverIp, *masterOptions.port)), masterStopTimeout, func() supervisedServer {
+			return newMasterComponent(masterOptions, serverWhiteList)
+		})
+	}
+	if *isStartingVolumeServer {
+		minFreeSpaces := util.MustParseMinFreeSpace(*volumeMinFreeSpace, *volumeMinFreeSpacePercent)
+		supervisor.addComponent("volume", fmt.Sprintf("http://%s/status", util.JoinHostPort(*serverIp, *serverOptions.v.port)), volumeStopTimeout, func() supervisedServer {
+			return serverOptions.v.newVolumeComponent(*volumeDataFolders, *volumeMaxDataVolumeCounts, *serverWhiteListOption, minFreeSpaces)
+		})
+	}
 	if *isStartingFiler {
-		go func() {
+		supervisor.addComponent("filer", fmt.Sprintf("http://%s/?limit=1", util.JoinHostPort(*serverIp, *filerOptions.port)), defaultComponentStopTimeout, func() supervisedServer {
 			time.Sleep(1 * time.Second)
-
-			filerOptions.startFiler()
-
-		}()
+			return filerOptions.newFilerComponent()
+		})
 	}
-
 	if *isStartingS3 {
-		go func() {
+		s3Scheme := "http"
+		if *s3Options.tlsPrivateKey != "" {
+			s3Scheme = "https"
+		}
+		supervisor.addComponent("s3", fmt.Sprintf("%s://%s/", s3Scheme, util.JoinHostPort(*serverIp, *s3Options.port)), defaultComponentStopTimeout, func() supervisedServer {
 			time.Sleep(2 * time.Second)
+			return s3Options.newS3Component()
+		})
+	}
+	supervisor.start()
+	grace.OnInterrupt(supervisor.shutdown)
 
-			s3Options.startS3Server()
-
-		}()
+	if *serverAdminPort != 0 {
+		go supervisor.serveAdmin(util.JoinHostPort(*serverBindIp, *serverAdminPort), serverWhiteList)
 	}
 
 	if *isStartingWebDav {
@@ -243,15 +307,5 @@ func runServer(cmd *Command, args []string) bool {
 		}()
 	}
 
-	// start volume server
-	if *isStartingVolumeServer {
-		minFreeSpaces := util.MustParseMinFreeSpace(*volumeMinFreeSpace, *volumeMinFreeSpacePercent)
-		go serverOptions.v.startVolumeServer(*volumeDataFolders, *volumeMaxDataVolumeCounts, *serverWhiteListOption, minFreeSpaces)
-	}
-
-	if *isStartingMasterServer {
-		go startMaster(masterOptions, serverWhiteList)
-	}
-
 	select {}
 }
@@ -0,0 +1,521 @@
+package command
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/grace"
+)
+
+const (
+	componentStarting = "starting"
+	componentServing  = "serving"
+	componentStopping = "stopping"
+	componentFailed   = "failed"
+	componentStopped  = "stopped"
+
+	defaultComponentStopTimeout = 30 * time.Second
+	componentHealthCheckPeriod  = 10 * time.Second
+	componentMaxRetryInterval   = time.Minute
+
+	// the master keeps streaming to the volume servers and clients until they disconnect
+	masterStopTimeout = 10 * time.Second
+	// the volume server may be receiving large uploads
+	volumeStopTimeout = 5 * time.Minute
+)
+
+// supervisedServer is a server run as a component of "weed server".
+// The server is created once, and its listeners can be stopped and served again.
+type supervisedServer interface {
+	// serve starts the listeners, and adds them to the servers
+	serve(servers *componentServers) error
+	// drain is called before the listeners are stopped. exiting is true if the process is exiting.
+	drain(exiting bool)
+	// close releases the server resources before the process exits
+	close()
+}
+
+// componentServers are the listeners of one server, stopped together
+type componentServers struct {
+	stopTimeout time.Duration
+	httpServers []*http.Server
+	grpcServers []*grpc.Server
+	listeners   []net.Listener
+	failed      chan error
+}
+
+func newComponentServers(stopTimeout time.Duration) *componentServers {
+	return &componentServers{
+		stopTimeout: stopTimeout,
+		failed:      make(chan error, 1),
+	}
+}
+
+// fail reports the first serving error
+func (s *componentServers) fail(err error) {
+	select {
+	case s.failed <- err:
+	default:
+	}
+}
+
+func (s *componentServers) serveHttp(address string, idleTimeout time.Duration, httpS *http.Server, certFile, keyFile string) error {
+	listener, err := util.NewListener(address, idleTimeout)
+	if err != nil {
+		return err
+	}
+	s.httpServers = append(s.httpServers, httpS)
+	go func() {
+		var err error
+		if certFile != "" || keyFile != "" {
+			err = httpS.ServeTLS(listener, certFile, keyFile)
+		} else {
+			err = httpS.Serve(listener)
+		}
+		if err != http.ErrServerClosed {
+			s.fail(fmt.Errorf("serve http %s: %v", address, err))
+		}
+	}()
+	return nil
+}
+
+func (s *componentServers) serveGrpc(address string, grpcS *grpc.Server) error {
+	listener, err := util.NewListener(address, 0)
+	if err != nil {
+		return err
+	}
+	s.grpcServers = append(s.grpcServers, grpcS)
+	go func() {
+		if err := grpcS.Serve(listener); err != nil {
+			s.fail(fmt.Errorf("serve grpc %s: %v", address, err))
+		}
+	}()
+	return nil
+}
+
+// addListener adds a listener served by the caller, which is closed when stopping
+func (s *componentServers) addListener(listener net.Listener) {
+	s.listeners = append(s.listeners, listener)
+}
+
+// stop stops accepting new requests, and waits for the in-flight requests until the stop timeout
+func (s *componentServers) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.stopTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, httpS := range s.httpServers {
+		wg.Add(1)
+		go func(httpS *http.Server) {
+			defer wg.Done()
+			if err := httpS.Shutdown(ctx); err != nil {
+				glog.Warningf("stop the http server failed, %v", err)
+				httpS.Close()
+			}
+		}(httpS)
+	}
+	for _, grpcS := range s.grpcServers {
+		wg.Add(1)
+		go func(grpcS *grpc.Server) {
+			defer wg.Done()
+			// streaming calls may never finish by themselves
+			stopped := make(chan struct{})
+			go func() {
+				grpcS.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				grpcS.Stop()
+			}
+		}(grpcS)
+	}
+	wg.Wait()
+
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+}
+
+// serveUntilInterrupted runs a standalone server until it fails, or until the process is interrupted.
+// When interrupted, the server is drained, stops accepting new requests,
+// completes the in-flight requests, and then releases its resources before the process exits.
+func serveUntilInterrupted(name string, server supervisedServer, stopTimeout time.Duration) {
+	servers := newComponentServers(stopTimeout)
+	if err := server.serve(servers); err != nil {
+		glog.Fatalf("%v", err)
+	}
+
+	stopped := make(chan struct{})
+	grace.OnInterrupt(func() {
+		glog.V(0).Infof("graceful stop %s ...", name)
+		server.drain(true)
+		servers.stop()
+		server.close()
+		glog.V(0).Infof("%s stopped", name)
+		close(stopped)
+	})
+
+	select {
+	case <-stopped:
+	case err := <-servers.failed:
+		glog.Fatalf("%s fail to serve: %v", name, err)
+	}
+}
+
+type componentAction struct {
+	name string
+	done chan struct{}
+}
+
+const (
+	actionEnable   = "enable"
+	actionDisable  = "disable"
+	actionRestart  = "restart"
+	actionShutdown = "shutdown"
+)
+
+// serverComponent runs one server of "weed server", and restarts its listeners if they fail
+type serverComponent struct {
+	name        string
+	healthUrl   string
+	stopTimeout time.Duration
+	create      func() supervisedServer
+	actions     chan componentAction
+
+	mu          sync.Mutex
+	enabled     bool
+	state       string
+	since       time.Time
+	lastError   string
+	restarts    int
+	healthy     bool
+	healthError string
+	checkedAt   time.Time
+}
+
+type componentStatus struct {
+	Name        string    `json:"name"`
+	Enabled     bool      `json:"enabled"`
+	State       string    `json:"state"`
+	Since       time.Time `json:"since"`
+	LastError   string    `json:"lastError,omitempty"`
+	Restarts    int       `json:"restarts"`
+	Healthy     bool      `json:"healthy"`
+	HealthError string    `json:"healthError,omitempty"`
+	CheckedAt   time.Time `json:"checkedAt"`
+}
+
+func (c *serverComponent) setState(state string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state, c.since = state, time.Now()
+	if err != nil {
+		c.lastError = err.Error()
+	}
+	if state != componentServing {
+		c.healthy, c.healthError = false, ""
+	}
+}
+
+func (c *serverComponent) status() componentStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return componentStatus{
+		Name:        c.name,
+		Enabled:     c.enabled,
+		State:       c.state,
+		Since:       c.since,
+		LastError:   c.lastError,
+		Restarts:    c.restarts,
+		Healthy:     c.healthy,
+		HealthError: c.healthError,
+		CheckedAt:   c.checkedAt,
+	}
+}
+
+// run creates the server, and serves it while enabled
+func (c *serverComponent) run() {
+	server := c.create()
+
+	retryInterval := time.Second
+	for {
+		c.mu.Lock()
+		enabled := c.enabled
+		c.mu.Unlock()
+
+		if !enabled {
+			c.setState(componentStopped, nil)
+			if c.handleIdleAction(server, <-c.actions) {
+				return
+			}
+			continue
+		}
+
+		servers := newComponentServers(c.stopTimeout)
+		err := server.serve(servers)
+		if err == nil {
+			glog.V(0).Infof("%s is serving", c.name)
+			c.setState(componentServing, nil)
+			var isShutdown bool
+			if isShutdown, err = c.whileServing(server, servers); isShutdown {
+				return
+			}
+			if err == nil {
+				retryInterval = time.Second
+				continue
+			}
+			c.mu.Lock()
+			c.restarts++
+			c.mu.Unlock()
+		} else {
+			servers.stop()
+		}
+
+		glog.Errorf("%s failed: %v", c.name, err)
+		c.setState(componentFailed, err)
+		if c.waitToRetry(server, &retryInterval) {
+			return
+		}
+	}
+}
+
+// whileServing handles the actions until the listeners fail or are stopped by an action
+func (c *serverComponent) whileServing(server supervisedServer, servers *componentServers) (isShutdown bool, err error) {
+	for {
+		select {
+		case err = <-servers.failed:
+			servers.stop()
+			return false, err
+		case action := <-c.actions:
+			if action.name == actionEnable {
+				close(action.done)
+				continue
+			}
+			glog.V(0).Infof("%s %s ...", action.name, c.name)
+			c.setState(componentStopping, nil)
+			isShutdown = action.name == actionShutdown
+			server.drain(isShutdown)
+			servers.stop()
+			c.mu.Lock()
+			switch action.name {
+			case actionDisable:
+				c.enabled = false
+			case actionRestart:
+				c.restarts++
+			}
+			c.mu.Unlock()
+			if isShutdown {
+				server.close()
+				c.setState(componentStopped, nil)
+			}
+			close(action.done)
+			return isShutdown, nil
+		}
+	}
+}
+
+// waitToRetry waits before serving again, and returns true if the component is shut down meanwhile
+func (c *serverComponent) waitToRetry(server supervisedServer, retryInterval *time.Duration) (isShutdown bool) {
+	select {
+	case <-time.After(*retryInterval):
+	case action := <-c.actions:
+		if c.handleIdleAction(server, action) {
+			return true
+		}
+	}
+	if *retryInterval *= 2; *retryInterval > componentMaxRetryInterval {
+		*retryInterval = componentMaxRetryInterval
+	}
+	return false
+}
+
+// handleIdleAction handles an action while the server is not serving
+func (c *serverComponent) handleIdleAction(server supervisedServer, action componentAction) (isShutdown bool) {
+	defer close(action.done)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch action.name {
+	case actionEnable, actionRestart:
+		c.enabled = true
+	case actionDisable:
+		c.enabled = false
+	case actionShutdown:
+		server.close()
+		return true
+	}
+	return false
+}
+
+func (c *serverComponent) checkHealth(client *http.Client) {
+	c.mu.Lock()
+	isServing, since := c.state == componentServing, c.since
+	c.mu.Unlock()
+	if !isServing {
+		return
+	}
+
+	var healthError string
+	resp, err := client.Get(c.healthUrl)
+	if err != nil {
+		healthError = err.Error()
+	} else {
+		util.CloseResponse(resp)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			healthError = fmt.Sprintf("%s: %s", c.healthUrl, resp.Status)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != componentServing || c.since != since {
+		// the listeners have been stopped meanwhile
+		return
+	}
+	if healthError != "" && (c.healthy || c.checkedAt.IsZero()) {
+		glog.Warningf("%s is unhealthy: %s", c.name, healthError)
+	} else if healthError == "" && !c.healthy {
+		glog.V(0).Infof("%s is healthy", c.name)
+	}
+	c.healthy, c.healthError, c.checkedAt = healthError == "", healthError, time.Now()
+}
+
+// serverSupervisor runs the components of "weed server"
+type serverSupervisor struct {
+	components []*serverComponent
+}
+
+func (s *serverSupervisor) addComponent(name, healthUrl string, stopTimeout time.Duration, create func() supervisedServer) {
+	s.components = append(s.components, &serverComponent{
+		name:        name,
+		healthUrl:   healthUrl,
+		stopTimeout: stopTimeout,
+		create:      create,
+		actions:     make(chan componentAction),
+		enabled:     true,
+		state:       componentStarting,
+		since:       time.Now(),
+	})
+}
+
+func (s *serverSupervisor) start() {
+	for _, c := range s.components {
+		go c.run()
+	}
+	go s.loopCheckingHealth()
+}
+
+func (s *serverSupervisor) loopCheckingHealth() {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		// the components may use self signed certificates
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	for range time.Tick(componentHealthCheckPeriod) {
+		for _, c := range s.components {
+			c.checkHealth(client)
+		}
+	}
+}
+
+func (s *serverSupervisor) findComponent(name string) *serverComponent {
+	for _, c := range s.components {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// act sends the action to the component, and waits for it to be done
+func (s *serverSupervisor) act(c *serverComponent, action string) error {
+	c.mu.Lock()
+	isStarting := c.state == componentStarting
+	c.mu.Unlock()
+	if isStarting {
+		return fmt.Errorf("%s is still starting", c.name)
+	}
+	done := make(chan struct{})
+	c.actions <- componentAction{name: action, done: done}
+	<-done
+	return nil
+}
+
+// shutdown stops the components in the reverse order of their dependencies,
+// draining the in-flight requests of each component before stopping the next one
+func (s *serverSupervisor) shutdown() {
+	for i := len(s.components) - 1; i >= 0; i-- {
+		c := s.components[i]
+		if err := s.act(c, actionShutdown); err != nil {
+			glog.V(0).Infof("skip stopping: %v", err)
+			continue
+		}
+		glog.V(0).Infof("%s is stopped", c.name)
+	}
+}
+
+func (s *serverSupervisor) serveAdmin(address string, whiteList []string) {
+	guard := security.NewGuard(whiteList, "", 0, "", 0)
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("/components", guard.WhiteList(s.componentsHandler))
+	adminMux.HandleFunc("/components/enable", guard.WhiteList(s.componentActionHandler(actionEnable)))
+	adminMux.HandleFunc("/components/disable", guard.WhiteList(s.componentActionHandler(actionDisable)))
+	adminMux.HandleFunc("/components/restart", guard.WhiteList(s.componentActionHandler(actionRestart)))
+
+	glog.V(0).Infof("Start Seaweed server admin at %s", address)
+	listener, err := util.NewListener(address, 0)
+	if err != nil {
+		glog.Fatalf("server admin listener error: %v", err)
+	}
+	if err := http.Serve(listener, adminMux); err != nil {
+		glog.Fatalf("server admin fail to serve: %v", err)
+	}
+}
+
+func (s *serverSupervisor) componentsHandler(w http.ResponseWriter, r *http.Request) {
+	var statuses []componentStatus
+	for _, c := range s.components {
+		statuses = append(statuses, c.status())
+	}
+	writeComponentsJson(w, http.StatusOK, statuses)
+}
+
+// componentActionHandler enables, disables or restarts the component given by the "name" parameter
+func (s *serverSupervisor) componentActionHandler(action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeComponentsJson(w, http.StatusMethodNotAllowed, map[string]string{"error": "only POST is allowed"})
+			return
+		}
+		c := s.findComponent(r.FormValue("name"))
+		if c == nil {
+			writeComponentsJson(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("component %q not found", r.FormValue("name"))})
+			return
+		}
+		if err := s.act(c, action); err != nil {
+			writeComponentsJson(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+		writeComponentsJson(w, http.StatusOK, c.status())
+	}
+}
+
+func writeComponentsJson(w http.ResponseWriter, httpStatus int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		glog.V(0).Infof("write components json: %v", err)
+	}
+}
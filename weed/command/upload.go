@@ -1,6 +1,7 @@
 package command
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -9,6 +10,8 @@ import (
 	"google.golang.org/grpc"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/chrislusf/seaweedfs/weed/operation"
 	"github.com/chrislusf/seaweedfs/weed/security"
@@ -23,6 +26,9 @@ type UploadOptions struct {
 	master       *string
 	dir          *string
 	include      *string
+	exclude      *string
+	manifest     *string
+	concurrency  *int
 	replication  *string
 	collection   *string
 	dataCenter   *string
@@ -37,7 +43,10 @@ func init() {
 	cmdUpload.IsDebug = cmdUpload.Flag.Bool("debug", false, "verbose debug information")
 	upload.master = cmdUpload.Flag.String("master", "localhost:9333", "SeaweedFS master location")
 	upload.dir = cmdUpload.Flag.String("dir", "", "Upload the whole folder recursively if specified.")
-	upload.include = cmdUpload.Flag.String("include", "", "pattens of files to upload, e.g., *.pdf, *.html, ab?d.txt, works together with -dir")
+	upload.include = cmdUpload.Flag.String("include", "", "comma separated pattens of files to upload, e.g., *.pdf,*.html,ab?d.txt, works together with -dir")
+	upload.exclude = cmdUpload.Flag.String("exclude", "", "comma separated pattens of files or folders to skip, e.g., *.tmp,.git, works together with -dir")
+	upload.manifest = cmdUpload.Flag.String("manifest", "", "append the uploaded path to file id mapping to this file, and skip files already listed in it, works together with -dir")
+	upload.concurrency = cmdUpload.Flag.Int("c", 8, "concurrent upload goroutines, works together with -dir")
 	upload.replication = cmdUpload.Flag.String("replication", "", "replication type")
 	upload.collection = cmdUpload.Flag.String("collection", "", "optional collection name")
 	upload.dataCenter = cmdUpload.Flag.String("dataCenter", "", "optional data center name")
@@ -59,6 +68,10 @@ var cmdUpload = &Command{
   If uploading a whole folder recursively:
   All files under the folder and subfolders will be uploaded, each with its own file key.
   Optional parameter "-include" allows you to specify the file name patterns.
+  Optional parameter "-exclude" allows you to skip files or folders by name patterns.
+  The patterns are matched against both the file name and the path relative to "-dir".
+  Optional parameter "-manifest" saves one json line per uploaded file, mapping its relative path to the file id.
+  Running the same command again with the same manifest file only uploads files not yet listed in it.
 
   If "maxMB" is set to a positive number, files larger than it would be split into chunks and uploaded separately.
   The list of file ids of those chunks would be stored in an additional chunk, and this additional chunk's file id would be returned.
@@ -84,30 +97,7 @@ func runUpload(cmd *Command, args []string) bool {
 		if *upload.dir == "" {
 			return false
 		}
-		err = filepath.Walk(util.ResolvePath(*upload.dir), func(path string, info os.FileInfo, err error) error {
-			if err == nil {
-				if !info.IsDir() {
-					if *upload.include != "" {
-						if ok, _ := filepath.Match(*upload.include, filepath.Base(path)); !ok {
-							return nil
-						}
-					}
-					parts, e := operation.NewFileParts([]string{path})
-					if e != nil {
-						return e
-					}
-					results, e := operation.SubmitFiles(func() string { return *upload.master }, grpcDialOption, parts, *upload.replication, *upload.collection, *upload.dataCenter, *upload.ttl, *upload.diskType, *upload.maxMB, *upload.usePublicUrl)
-					bytes, _ := json.Marshal(results)
-					fmt.Println(string(bytes))
-					if e != nil {
-						return e
-					}
-				}
-			} else {
-				fmt.Println(err)
-			}
-			return err
-		})
+		err = uploadDirectory(grpcDialOption, util.ResolvePath(*upload.dir))
 		if err != nil {
 			fmt.Println(err.Error())
 			return false
@@ -140,3 +130,172 @@ func readMasterConfiguration(grpcDialOption grpc.DialOption, masterAddress strin
 	})
 	return
 }
+
+type uploadManifestEntry struct {
+	Path string `json:"path"`
+	Fid  string `json:"fid"`
+	Size uint32 `json:"size"`
+	Url  string `json:"url,omitempty"`
+}
+
+func uploadDirectory(grpcDialOption grpc.DialOption, dir string) error {
+
+	includes, excludes := splitPatterns(*upload.include), splitPatterns(*upload.exclude)
+
+	var manifestFile *os.File
+	uploaded := make(map[string]bool)
+	if *upload.manifest != "" {
+		entries, err := readUploadManifest(*upload.manifest)
+		if err != nil {
+			return fmt.Errorf("read manifest %s: %v", *upload.manifest, err)
+		}
+		for _, entry := range entries {
+			uploaded[entry.Path] = true
+		}
+		manifestFile, err = os.OpenFile(*upload.manifest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("open manifest %s: %v", *upload.manifest, err)
+		}
+		defer manifestFile.Close()
+	}
+
+	concurrency := *upload.concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var firstErr error
+	pathChan := make(chan string, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range pathChan {
+				relPath, _ := filepath.Rel(dir, path)
+				relPath = filepath.ToSlash(relPath)
+				result, err := uploadOneFile(grpcDialOption, path)
+				lock.Lock()
+				bytes, _ := json.Marshal(result)
+				fmt.Println(string(bytes))
+				if err == nil && manifestFile != nil {
+					err = appendUploadManifest(manifestFile, &uploadManifestEntry{
+						Path: relPath,
+						Fid:  result.Fid,
+						Size: result.Size,
+						Url:  result.FileUrl,
+					})
+				}
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+
+	walkErr := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			fmt.Println(err)
+			return err
+		}
+		relPath, _ := filepath.Rel(dir, path)
+		relPath = filepath.ToSlash(relPath)
+		if relPath != "." && matchAnyPattern(excludes, relPath) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if len(includes) > 0 && !matchAnyPattern(includes, relPath) {
+			return nil
+		}
+		if uploaded[relPath] {
+			return nil
+		}
+		pathChan <- path
+		return nil
+	})
+	close(pathChan)
+	wg.Wait()
+
+	if walkErr != nil {
+		return walkErr
+	}
+	return firstErr
+}
+
+func uploadOneFile(grpcDialOption grpc.DialOption, path string) (operation.SubmitResult, error) {
+	parts, err := operation.NewFileParts([]string{path})
+	if err != nil {
+		return operation.SubmitResult{FileName: filepath.Base(path), Error: err.Error()}, err
+	}
+	results, err := operation.SubmitFiles(func() string { return *upload.master }, grpcDialOption, parts, *upload.replication, *upload.collection, *upload.dataCenter, *upload.ttl, *upload.diskType, *upload.maxMB, *upload.usePublicUrl)
+	if err != nil {
+		return results[0], err
+	}
+	if results[0].Error != "" {
+		return results[0], fmt.Errorf("upload %s: %s", path, results[0].Error)
+	}
+	return results[0], nil
+}
+
+func splitPatterns(patterns string) (ret []string) {
+	for _, pattern := range strings.Split(patterns, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			ret = append(ret, pattern)
+		}
+	}
+	return
+}
+
+// matchAnyPattern matches the patterns against both the base name and the relative path
+func matchAnyPattern(patterns []string, relPath string) bool {
+	baseName := filepath.Base(relPath)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, baseName); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, relPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func readUploadManifest(manifestPath string) (entries []*uploadManifestEntry, err error) {
+	f, err := os.Open(manifestPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		entry := &uploadManifestEntry{}
+		if err = json.Unmarshal([]byte(line), entry); err != nil {
+			return nil, fmt.Errorf("parse %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func appendUploadManifest(manifestFile *os.File, entry *uploadManifestEntry) error {
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = manifestFile.Write(append(bytes, '\n'))
+	return err
+}
@@ -6,23 +6,23 @@ import (
 	"net/http"
 	httppprof "net/http/pprof"
 	"os"
-	"runtime/pprof"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/spf13/viper"
-	"google.golang.org/grpc"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
 	"github.com/chrislusf/seaweedfs/weed/util/grace"
 
 	"github.com/chrislusf/seaweedfs/weed/pb"
 	"github.com/chrislusf/seaweedfs/weed/security"
-	"github.com/chrislusf/seaweedfs/weed/util/httpdown"
 
 	"google.golang.org/grpc/reflection"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/operation"
 	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
 	"github.com/chrislusf/seaweedfs/weed/server"
 	stats_collect "github.com/chrislusf/seaweedfs/weed/stats"
@@ -49,6 +49,7 @@ type VolumeServerOptions struct {
 	rack                    *string
 	whiteList               []string
 	indexType               *string
+	checkLevel              *string
 	diskType                *string
 	fixJpgOrientation       *bool
 	readMode                *string
@@ -57,9 +58,14 @@ type VolumeServerOptions struct {
 	compactionMBPerSecond   *int
 	fileSizeLimitMB         *int
 	concurrentUploadLimitMB *int
+	deleteGraceMinutes      *int
+	crossDcReplicationQueue *int
+	indexMemoryBudgetMB     *int
 	pprof                   *bool
 	preStopSeconds          *int
 	metricsHttpPort         *int
+	copyMaxAttempts         *int
+	copyMaxBackoffSeconds   *int
 	// pulseSeconds          *int
 	enableTcp *bool
 }
@@ -70,14 +76,15 @@ func init() {
 	v.publicPort = cmdVolume.Flag.Int("port.public", 0, "port opened to public")
 	v.ip = cmdVolume.Flag.String("ip", util.DetectedHostAddress(), "ip or server name, also used as identifier")
 	v.publicUrl = cmdVolume.Flag.String("publicUrl", "", "Publicly accessible address")
-	v.bindIp = cmdVolume.Flag.String("ip.bind", "", "ip address to bind to")
+	v.bindIp = cmdVolume.Flag.String("ip.bind", "", "ip address to bind to. If empty, default to all the IPv4 and IPv6 addresses")
 	v.masters = cmdVolume.Flag.String("mserver", "localhost:9333", "comma-separated master servers")
 	v.preStopSeconds = cmdVolume.Flag.Int("preStopSeconds", 10, "number of seconds between stop send heartbeats and stop volume server")
 	// v.pulseSeconds = cmdVolume.Flag.Int("pulseSeconds", 5, "number of seconds between heartbeats, must be smaller than or equal to the master's setting")
 	v.idleConnectionTimeout = cmdVolume.Flag.Int("idleTimeout", 30, "connection idle seconds")
 	v.dataCenter = cmdVolume.Flag.String("dataCenter", "", "current volume server's data center name")
 	v.rack = cmdVolume.Flag.String("rack", "", "current volume server's rack name")
-	v.indexType = cmdVolume.Flag.String("index", "memory", "Choose [memory|leveldb|leveldbMedium|leveldbLarge] mode for memory~performance balance.")
+	v.indexType = cmdVolume.Flag.String("index", "memory", "Choose [memory|leveldb|leveldbMedium|leveldbLarge|boltdb] mode for memory~performance balance. boltdb keeps the index in an on-disk b+tree.")
+	v.checkLevel = cmdVolume.Flag.String("check", "index", "[none|index|full] how much to validate the volumes at startup: nothing, the index file and its last entries, or also every needle's checksum")
 	v.diskType = cmdVolume.Flag.String("disk", "", "[hdd|ssd|<tag>] hard drive or solid state drive or any tag")
 	v.fixJpgOrientation = cmdVolume.Flag.Bool("images.fix.orientation", false, "Adjust jpg orientation when uploading.")
 	v.readMode = cmdVolume.Flag.String("readMode", "proxy", "[local|proxy|redirect] how to deal with non-local volume: 'not found|proxy to remote node|redirect volume location'.")
@@ -86,10 +93,15 @@ func init() {
 	v.compactionMBPerSecond = cmdVolume.Flag.Int("compactionMBps", 0, "limit background compaction or copying speed in mega bytes per second")
 	v.fileSizeLimitMB = cmdVolume.Flag.Int("fileSizeLimitMB", 256, "limit file size to avoid out of memory")
 	v.concurrentUploadLimitMB = cmdVolume.Flag.Int("concurrentUploadLimitMB", 128, "limit total concurrent upload size")
+	v.deleteGraceMinutes = cmdVolume.Flag.Int("deleteGraceMinutes", 0, "keep deleted files through vacuum for this many minutes, during which they can be undeleted by volume.undelete")
+	v.crossDcReplicationQueue = cmdVolume.Flag.Int("crossDcReplicationQueue", 0, "replicate to the volumes in other data centers in the background, with at most this many writes queued for each replica. 0 to replicate synchronously")
+	v.indexMemoryBudgetMB = cmdVolume.Flag.Int("index.memoryBudgetMB", 0, "limit the memory of the in-memory indexes of all volumes, by switching the indexes of the least recently accessed volumes to leveldb. 0 for no limit")
 	v.pprof = cmdVolume.Flag.Bool("pprof", false, "enable pprof http handlers. precludes --memprofile and --cpuprofile")
 	v.metricsHttpPort = cmdVolume.Flag.Int("metricsPort", 0, "Prometheus metrics listen port")
 	v.idxFolder = cmdVolume.Flag.String("dir.idx", "", "directory to store .idx files")
 	v.enableTcp = cmdVolume.Flag.Bool("tcp", false, "<exprimental> enable tcp port")
+	v.copyMaxAttempts = cmdVolume.Flag.Int("copy.maxAttempts", 5, "attempts to copy a volume from a volume server which is unavailable")
+	v.copyMaxBackoffSeconds = cmdVolume.Flag.Int("copy.maxBackoffSeconds", 16, "max seconds to wait between the attempts to copy a volume, doubled from 1 second")
 }
 
 var cmdVolume = &Command{
@@ -111,6 +123,7 @@ var (
 func runVolume(cmd *Command, args []string) bool {
 
 	util.LoadConfiguration("security", false)
+	util.LoadConfiguration("volume", false)
 
 	// If --pprof is set we assume the caller wants to be able to collect
 	// cpu and memory profiles via go tool pprof
@@ -128,6 +141,21 @@ func runVolume(cmd *Command, args []string) bool {
 
 func (v VolumeServerOptions) startVolumeServer(volumeFolders, maxVolumeCounts, volumeWhiteListOption string, minFreeSpaces []util.MinFreeSpace) {
 
+	vc := v.newVolumeComponent(volumeFolders, maxVolumeCounts, volumeWhiteListOption, minFreeSpaces)
+	serveUntilInterrupted("volume server", vc, volumeStopTimeout)
+
+}
+
+// volumeComponent is a volume server with its options
+type volumeComponent struct {
+	v            VolumeServerOptions
+	volumeServer *weed_server.VolumeServer
+	volumeMux    *http.ServeMux
+	publicMux    *http.ServeMux
+}
+
+func (v VolumeServerOptions) newVolumeComponent(volumeFolders, maxVolumeCounts, volumeWhiteListOption string, minFreeSpaces []util.MinFreeSpace) *volumeComponent {
+
 	// Set multiple folders and each folder's max volume count limit'
 	v.folders = strings.Split(volumeFolders, ",")
 	for _, folder := range v.folders {
@@ -192,7 +220,7 @@ func (v VolumeServerOptions) startVolumeServer(volumeFolders, maxVolumeCounts, v
 		*v.publicPort = *v.port
 	}
 	if *v.publicUrl == "" {
-		*v.publicUrl = *v.ip + ":" + strconv.Itoa(*v.publicPort)
+		*v.publicUrl = util.JoinHostPort(*v.ip, *v.publicPort)
 	}
 
 	volumeMux := http.NewServeMux()
@@ -217,85 +245,88 @@ func (v VolumeServerOptions) startVolumeServer(volumeFolders, maxVolumeCounts, v
 		volumeNeedleMapKind = storage.NeedleMapLevelDbMedium
 	case "leveldbLarge":
 		volumeNeedleMapKind = storage.NeedleMapLevelDbLarge
+	case "boltdb":
+		volumeNeedleMapKind = storage.NeedleMapBoltDb
+	}
+
+	volumeCheckLevel, err := storage.ParseVolumeCheckLevel(*v.checkLevel)
+	if err != nil {
+		glog.Fatalf("-check: %v", err)
 	}
 
 	masters := *v.masters
 
+	operation.VolumeCopyRetryPolicy.MaxAttempts = *v.copyMaxAttempts
+	operation.VolumeCopyRetryPolicy.MaxBackoff = time.Duration(*v.copyMaxBackoffSeconds) * time.Second
+
 	volumeServer := weed_server.NewVolumeServer(volumeMux, publicVolumeMux,
 		*v.ip, *v.port, *v.publicUrl,
 		v.folders, v.folderMaxLimits, minFreeSpaces, diskTypes,
 		*v.idxFolder,
 		volumeNeedleMapKind,
+		volumeCheckLevel,
 		strings.Split(masters, ","), 5, *v.dataCenter, *v.rack,
 		v.whiteList,
 		*v.fixJpgOrientation, *v.readMode,
 		*v.compactionMBPerSecond,
 		*v.fileSizeLimitMB,
 		int64(*v.concurrentUploadLimitMB)*1024*1024,
+		*v.deleteGraceMinutes,
+		*v.crossDcReplicationQueue,
+		*v.indexMemoryBudgetMB,
 	)
-	// starting grpc server
-	grpcS := v.startGrpcService(volumeServer)
+	grace.OnReload(volumeServer.Reload)
 
-	// starting public http server
-	var publicHttpDown httpdown.Server
-	if v.isSeparatedPublicPort() {
-		publicHttpDown = v.startPublicHttpService(publicVolumeMux)
-		if nil == publicHttpDown {
-			glog.Fatalf("start public http service failed")
-		}
+	return &volumeComponent{
+		v:            v,
+		volumeServer: volumeServer,
+		volumeMux:    volumeMux,
+		publicMux:    publicVolumeMux,
 	}
+}
 
-	// starting tcp server
-	if *v.enableTcp {
-		go v.startTcpService(volumeServer)
-	}
+func (vc *volumeComponent) serve(servers *componentServers) error {
 
-	// starting the cluster http server
-	clusterHttpServer := v.startClusterHttpService(volumeMux)
+	// resume the heartbeat stopped by drain
+	vc.volumeServer.StartHeartbeat()
 
-	stopChan := make(chan bool)
-	grace.OnInterrupt(func() {
-		fmt.Println("volume server has be killed")
+	// starting grpc server
+	if err := vc.v.startGrpcService(servers, vc.volumeServer); err != nil {
+		return err
+	}
 
-		// Stop heartbeats
-		if !volumeServer.StopHeartbeat() {
-			volumeServer.SetStopping()
-			glog.V(0).Infof("stop send heartbeat and wait %d seconds until shutdown ...", *v.preStopSeconds)
-			time.Sleep(time.Duration(*v.preStopSeconds) * time.Second)
+	// starting public http server
+	if vc.v.isSeparatedPublicPort() {
+		if err := vc.v.startPublicHttpService(servers, vc.publicMux); err != nil {
+			return err
 		}
+	}
 
-		shutdown(publicHttpDown, clusterHttpServer, grpcS, volumeServer)
-		stopChan <- true
-	})
-
-	select {
-	case <-stopChan:
+	// starting tcp server
+	if *vc.v.enableTcp {
+		if err := vc.v.startTcpService(servers, vc.volumeServer); err != nil {
+			return err
+		}
 	}
 
+	// starting the cluster http server
+	return vc.v.startClusterHttpService(servers, vc.volumeMux)
 }
 
-func shutdown(publicHttpDown httpdown.Server, clusterHttpServer httpdown.Server, grpcS *grpc.Server, volumeServer *weed_server.VolumeServer) {
-
-	// firstly, stop the public http service to prevent from receiving new user request
-	if nil != publicHttpDown {
-		glog.V(0).Infof("stop public http server ... ")
-		if err := publicHttpDown.Stop(); err != nil {
-			glog.Warningf("stop the public http server failed, %v", err)
+// drain stops the heartbeat, so that the master stops assigning writes to this volume server,
+// and waits a while for the clients to notice it
+func (vc *volumeComponent) drain(exiting bool) {
+	if !vc.volumeServer.StopHeartbeat() {
+		if exiting {
+			vc.volumeServer.SetStopping()
 		}
+		glog.V(0).Infof("stop send heartbeat and wait %d seconds until shutdown ...", *vc.v.preStopSeconds)
+		time.Sleep(time.Duration(*vc.v.preStopSeconds) * time.Second)
 	}
+}
 
-	glog.V(0).Infof("graceful stop cluster http server ... ")
-	if err := clusterHttpServer.Stop(); err != nil {
-		glog.Warningf("stop the cluster http server failed, %v", err)
-	}
-
-	glog.V(0).Infof("graceful stop gRPC ...")
-	grpcS.GracefulStop()
-
-	volumeServer.Shutdown()
-
-	pprof.StopCPUProfile()
-
+func (vc *volumeComponent) close() {
+	vc.volumeServer.Shutdown()
 }
 
 // check whether configure the public port
@@ -303,43 +334,29 @@ func (v VolumeServerOptions) isSeparatedPublicPort() bool {
 	return *v.publicPort != *v.port
 }
 
-func (v VolumeServerOptions) startGrpcService(vs volume_server_pb.VolumeServerServer) *grpc.Server {
+func (v VolumeServerOptions) startGrpcService(servers *componentServers, vs volume_server_pb.VolumeServerServer) error {
 	grpcPort := *v.port + 10000
-	grpcL, err := util.NewListener(*v.bindIp+":"+strconv.Itoa(grpcPort), 0)
-	if err != nil {
-		glog.Fatalf("failed to listen on grpc port %d: %v", grpcPort, err)
-	}
 	grpcS := pb.NewGrpcServer(security.LoadServerTLS(util.GetViper(), "grpc.volume"))
 	volume_server_pb.RegisterVolumeServerServer(grpcS, vs)
 	reflection.Register(grpcS)
-	go func() {
-		if err := grpcS.Serve(grpcL); err != nil {
-			glog.Fatalf("start gRPC service failed, %s", err)
-		}
-	}()
-	return grpcS
+	if err := servers.serveGrpc(util.JoinHostPort(*v.bindIp, grpcPort), grpcS); err != nil {
+		return fmt.Errorf("failed to listen on grpc port %d: %v", grpcPort, err)
+	}
+	return nil
 }
 
-func (v VolumeServerOptions) startPublicHttpService(handler http.Handler) httpdown.Server {
-	publicListeningAddress := *v.bindIp + ":" + strconv.Itoa(*v.publicPort)
+func (v VolumeServerOptions) startPublicHttpService(servers *componentServers, handler http.Handler) error {
+	publicListeningAddress := util.JoinHostPort(*v.bindIp, *v.publicPort)
 	glog.V(0).Infoln("Start Seaweed volume server", util.Version(), "public at", publicListeningAddress)
-	publicListener, e := util.NewListener(publicListeningAddress, time.Duration(*v.idleConnectionTimeout)*time.Second)
-	if e != nil {
-		glog.Fatalf("Volume server listener error:%v", e)
+	// the public port is not served with TLS, so also accept cleartext HTTP/2 from filers
+	httpS := &http.Server{Handler: h2c.NewHandler(handler, &http2.Server{})}
+	if err := servers.serveHttp(publicListeningAddress, time.Duration(*v.idleConnectionTimeout)*time.Second, httpS, "", ""); err != nil {
+		return fmt.Errorf("Volume server listener error:%v", err)
 	}
-
-	pubHttp := httpdown.HTTP{StopTimeout: 5 * time.Minute, KillTimeout: 5 * time.Minute}
-	publicHttpDown := pubHttp.Serve(&http.Server{Handler: handler}, publicListener)
-	go func() {
-		if err := publicHttpDown.Wait(); err != nil {
-			glog.Errorf("public http down wait failed, %v", err)
-		}
-	}()
-
-	return publicHttpDown
+	return nil
 }
 
-func (v VolumeServerOptions) startClusterHttpService(handler http.Handler) httpdown.Server {
+func (v VolumeServerOptions) startClusterHttpService(servers *componentServers, handler http.Handler) error {
 	var (
 		certFile, keyFile string
 	)
@@ -348,42 +365,36 @@ func (v VolumeServerOptions) startClusterHttpService(handler http.Handler) httpd
 		keyFile = viper.GetString("https.volume.key")
 	}
 
-	listeningAddress := *v.bindIp + ":" + strconv.Itoa(*v.port)
+	listeningAddress := util.JoinHostPort(*v.bindIp, *v.port)
 	glog.V(0).Infof("Start Seaweed volume server %s at %s", util.Version(), listeningAddress)
-	listener, e := util.NewListener(listeningAddress, time.Duration(*v.idleConnectionTimeout)*time.Second)
-	if e != nil {
-		glog.Fatalf("Volume server listener error:%v", e)
+	// with TLS, HTTP/2 is negotiated by ALPN, otherwise also accept cleartext HTTP/2 from filers
+	if certFile == "" {
+		handler = h2c.NewHandler(handler, &http2.Server{})
 	}
-
-	httpDown := httpdown.HTTP{
-		KillTimeout: 5 * time.Minute,
-		StopTimeout: 5 * time.Minute,
-		CertFile:    certFile,
-		KeyFile:     keyFile}
-	clusterHttpServer := httpDown.Serve(&http.Server{Handler: handler}, listener)
-	go func() {
-		if e := clusterHttpServer.Wait(); e != nil {
-			glog.Fatalf("Volume server fail to serve: %v", e)
-		}
-	}()
-	return clusterHttpServer
+	if err := servers.serveHttp(listeningAddress, time.Duration(*v.idleConnectionTimeout)*time.Second, &http.Server{Handler: handler}, certFile, keyFile); err != nil {
+		return fmt.Errorf("Volume server listener error:%v", err)
+	}
+	return nil
 }
 
-func (v VolumeServerOptions) startTcpService(volumeServer *weed_server.VolumeServer) {
-	listeningAddress := *v.bindIp + ":" + strconv.Itoa(*v.port+20000)
+func (v VolumeServerOptions) startTcpService(servers *componentServers, volumeServer *weed_server.VolumeServer) error {
+	listeningAddress := util.JoinHostPort(*v.bindIp, *v.port+20000)
 	glog.V(0).Infoln("Start Seaweed volume server", util.Version(), "tcp at", listeningAddress)
 	listener, e := util.NewListener(listeningAddress, 0)
 	if e != nil {
-		glog.Fatalf("Volume server listener error on %s:%v", listeningAddress, e)
+		return fmt.Errorf("Volume server listener error on %s:%v", listeningAddress, e)
 	}
-	defer listener.Close()
+	servers.addListener(listener)
 
-	for {
-		c, err := listener.Accept()
-		if err != nil {
-			fmt.Println(err)
-			return
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			go volumeServer.HandleTcpConnection(c)
 		}
-		go volumeServer.HandleTcpConnection(c)
-	}
+	}()
+	return nil
 }
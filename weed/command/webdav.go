@@ -31,6 +31,7 @@ type WebDavOption struct {
 	tlsCertificate *string
 	cacheDir       *string
 	cacheSizeMB    *int64
+	cacheService   *string
 }
 
 func init() {
@@ -44,6 +45,7 @@ func init() {
 	webDavStandaloneOptions.tlsCertificate = cmdWebDav.Flag.String("cert.file", "", "path to the TLS certificate file")
 	webDavStandaloneOptions.cacheDir = cmdWebDav.Flag.String("cacheDir", os.TempDir(), "local cache directory for file chunks")
 	webDavStandaloneOptions.cacheSizeMB = cmdWebDav.Flag.Int64("cacheCapacityMB", 1000, "local cache capacity in MB")
+	webDavStandaloneOptions.cacheService = cmdWebDav.Flag.String("cacheService", "", "unix socket of a \"weed cache\" process to share its chunk cache, instead of a local cache")
 }
 
 var cmdWebDav = &Command{
@@ -118,6 +120,7 @@ func (wo *WebDavOption) startWebDav() bool {
 		Cipher:           cipher,
 		CacheDir:         util.ResolvePath(*wo.cacheDir),
 		CacheSizeMB:      *wo.cacheSizeMB,
+		CacheService:     *wo.cacheService,
 	})
 	if webdavServer_err != nil {
 		glog.Fatalf("WebDav Server startup error: %v", webdavServer_err)
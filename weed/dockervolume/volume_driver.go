@@ -0,0 +1,264 @@
+package dockervolume
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// the volume options are saved in the extended attributes of the volume directory
+const volumeOptionsKey = "docker.volume.options"
+
+// Mounter mounts a directory in the filer to a local directory, e.g., by running "weed mount"
+type Mounter interface {
+	Mount(filerPath util.FullPath, mountpoint string, options map[string]string) (unmount func() error, err error)
+}
+
+type VolumeDriverOption struct {
+	FilerGrpcAddress string
+	GrpcDialOption   grpc.DialOption
+	FilerPath        util.FullPath // the filer directory of the volumes
+	MountRoot        string        // the local directory of the mountpoints
+	Mounter          Mounter
+}
+
+// VolumeDriver implements the docker volume plugin protocol.
+// Each volume is a directory in the filer, mounted once no matter how many containers use it.
+type VolumeDriver struct {
+	option *VolumeDriverOption
+	mounts map[string]*volumeMount
+	sync.Mutex
+}
+
+type volumeMount struct {
+	mountpoint string
+	ids        map[string]bool
+	unmount    func() error
+}
+
+func NewVolumeDriver(option *VolumeDriverOption) *VolumeDriver {
+	return &VolumeDriver{
+		option: option,
+		mounts: make(map[string]*volumeMount),
+	}
+}
+
+func (d *VolumeDriver) WithFilerClient(fn func(filer_pb.SeaweedFilerClient) error) error {
+	return pb.WithCachedGrpcClient(func(grpcConnection *grpc.ClientConn) error {
+		client := filer_pb.NewSeaweedFilerClient(grpcConnection)
+		return fn(client)
+	}, d.option.FilerGrpcAddress, d.option.GrpcDialOption)
+}
+
+func (d *VolumeDriver) AdjustedUrl(location *filer_pb.Location) string {
+	return location.Url
+}
+
+func (d *VolumeDriver) Create(name string, options map[string]string) error {
+	if err := checkVolumeName(name); err != nil {
+		return err
+	}
+	if err := checkVolumeOptions(options); err != nil {
+		return err
+	}
+
+	entry, err := filer_pb.GetEntry(d, d.option.FilerPath.Child(name))
+	if err != nil {
+		return fmt.Errorf("lookup volume %s: %v", name, err)
+	}
+	if entry != nil {
+		if !entry.IsDirectory {
+			return fmt.Errorf("volume %s: %s is not a directory", name, d.option.FilerPath.Child(name))
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	if err = filer_pb.Mkdir(d, string(d.option.FilerPath), name, func(entry *filer_pb.Entry) {
+		entry.Extended = map[string][]byte{volumeOptionsKey: data}
+	}); err != nil {
+		return fmt.Errorf("create volume %s: %v", name, err)
+	}
+	glog.V(0).Infof("created volume %s %v", name, options)
+	return nil
+}
+
+func (d *VolumeDriver) Remove(name string) error {
+	if err := checkVolumeName(name); err != nil {
+		return err
+	}
+
+	d.Lock()
+	_, isMounted := d.mounts[name]
+	d.Unlock()
+	if isMounted {
+		return fmt.Errorf("volume %s is in use", name)
+	}
+
+	if err := filer_pb.Remove(d, string(d.option.FilerPath), name, true, true, false, false, nil); err != nil {
+		return fmt.Errorf("remove volume %s: %v", name, err)
+	}
+	glog.V(0).Infof("removed volume %s", name)
+	return nil
+}
+
+// Mount mounts the volume for the container id, or reuses the mount of other containers
+func (d *VolumeDriver) Mount(name, id string) (mountpoint string, err error) {
+	if err := checkVolumeName(name); err != nil {
+		return "", err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if m, found := d.mounts[name]; found {
+		m.ids[id] = true
+		return m.mountpoint, nil
+	}
+
+	options, err := d.readVolumeOptions(name)
+	if err != nil {
+		return "", err
+	}
+
+	mountpoint = filepath.Join(d.option.MountRoot, name)
+	if err = os.MkdirAll(mountpoint, 0755); err != nil {
+		return "", fmt.Errorf("create mountpoint %s: %v", mountpoint, err)
+	}
+	unmount, err := d.option.Mounter.Mount(d.option.FilerPath.Child(name), mountpoint, options)
+	if err != nil {
+		return "", fmt.Errorf("mount volume %s: %v", name, err)
+	}
+	d.mounts[name] = &volumeMount{
+		mountpoint: mountpoint,
+		ids:        map[string]bool{id: true},
+		unmount:    unmount,
+	}
+	glog.V(0).Infof("mounted volume %s to %s", name, mountpoint)
+	return mountpoint, nil
+}
+
+// Unmount unmounts the volume after the last container using it is stopped
+func (d *VolumeDriver) Unmount(name, id string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	m, found := d.mounts[name]
+	if !found {
+		return nil
+	}
+	delete(m.ids, id)
+	if len(m.ids) > 0 {
+		return nil
+	}
+	if err := m.unmount(); err != nil {
+		return fmt.Errorf("unmount volume %s: %v", name, err)
+	}
+	delete(d.mounts, name)
+	glog.V(0).Infof("unmounted volume %s from %s", name, m.mountpoint)
+	return nil
+}
+
+// UnmountAll is called when the plugin exits
+func (d *VolumeDriver) UnmountAll() {
+	d.Lock()
+	defer d.Unlock()
+	for name, m := range d.mounts {
+		if err := m.unmount(); err != nil {
+			glog.Errorf("unmount volume %s: %v", name, err)
+		}
+		delete(d.mounts, name)
+	}
+}
+
+// Get returns the mountpoint if the volume exists, which is empty if the volume is not mounted
+func (d *VolumeDriver) Get(name string) (mountpoint string, err error) {
+	if err := checkVolumeName(name); err != nil {
+		return "", err
+	}
+	entry, err := filer_pb.GetEntry(d, d.option.FilerPath.Child(name))
+	if err != nil {
+		return "", fmt.Errorf("lookup volume %s: %v", name, err)
+	}
+	if entry == nil || !entry.IsDirectory {
+		return "", fmt.Errorf("volume %s not found", name)
+	}
+	return d.mountpoint(name), nil
+}
+
+func (d *VolumeDriver) List() (names []string, err error) {
+	err = filer_pb.ReadDirAllEntries(d, d.option.FilerPath, "", func(entry *filer_pb.Entry, isLast bool) error {
+		if entry.IsDirectory {
+			names = append(names, entry.Name)
+		}
+		return nil
+	})
+	if err == filer_pb.ErrNotFound {
+		err = nil
+	}
+	return
+}
+
+func (d *VolumeDriver) mountpoint(name string) string {
+	d.Lock()
+	defer d.Unlock()
+	if m, found := d.mounts[name]; found {
+		return m.mountpoint
+	}
+	return ""
+}
+
+func (d *VolumeDriver) readVolumeOptions(name string) (options map[string]string, err error) {
+	entry, err := filer_pb.GetEntry(d, d.option.FilerPath.Child(name))
+	if err != nil {
+		return nil, fmt.Errorf("lookup volume %s: %v", name, err)
+	}
+	if entry == nil || !entry.IsDirectory {
+		return nil, fmt.Errorf("volume %s not found", name)
+	}
+	if data, found := entry.Extended[volumeOptionsKey]; found {
+		if err = json.Unmarshal(data, &options); err != nil {
+			return nil, fmt.Errorf("volume %s options: %v", name, err)
+		}
+	}
+	return options, nil
+}
+
+// VolumeOptions are the options accepted by "docker volume create -o", passed to "weed mount"
+var VolumeOptions = map[string]string{
+	"collection":       "collection to create the files",
+	"replication":      "replication to create the files, e.g., 001",
+	"disk":             "[hdd|ssd|<tag>] disk type to create the files",
+	"ttl":              "file ttl in seconds",
+	"chunkSizeLimitMB": "local write buffer size, also chunk large files",
+	"readOnly":         "[true|false] mount the volume read only",
+}
+
+func checkVolumeOptions(options map[string]string) error {
+	for key := range options {
+		if _, found := VolumeOptions[key]; !found {
+			return fmt.Errorf("unknown volume option %s", key)
+		}
+	}
+	return nil
+}
+
+func checkVolumeName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return fmt.Errorf("invalid volume name %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package dockervolume
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+)
+
+// the docker volume plugin protocol
+// https://docs.docker.com/engine/extend/plugins_volume/
+
+const pluginContentType = "application/vnd.docker.plugins.v1.2+json"
+
+type volumeRequest struct {
+	Name string
+	ID   string
+	Opts map[string]string
+}
+
+type volumeInfo struct {
+	Name       string
+	Mountpoint string `json:",omitempty"`
+}
+
+type volumeResponse struct {
+	Mountpoint   string        `json:",omitempty"`
+	Volume       *volumeInfo   `json:",omitempty"`
+	Volumes      []*volumeInfo `json:",omitempty"`
+	Capabilities interface{}   `json:",omitempty"`
+	Err          string
+}
+
+func (d *VolumeDriver) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/Plugin.Activate", func(w http.ResponseWriter, r *http.Request) {
+		writePluginResponse(w, map[string][]string{"Implements": {"VolumeDriver"}})
+	})
+	mux.HandleFunc("/VolumeDriver.Capabilities", func(w http.ResponseWriter, r *http.Request) {
+		writePluginResponse(w, &volumeResponse{Capabilities: map[string]string{"Scope": "global"}})
+	})
+	d.handle(mux, "/VolumeDriver.Create", func(req *volumeRequest, resp *volumeResponse) error {
+		return d.Create(req.Name, req.Opts)
+	})
+	d.handle(mux, "/VolumeDriver.Remove", func(req *volumeRequest, resp *volumeResponse) error {
+		return d.Remove(req.Name)
+	})
+	d.handle(mux, "/VolumeDriver.Mount", func(req *volumeRequest, resp *volumeResponse) (err error) {
+		resp.Mountpoint, err = d.Mount(req.Name, req.ID)
+		return
+	})
+	d.handle(mux, "/VolumeDriver.Unmount", func(req *volumeRequest, resp *volumeResponse) error {
+		return d.Unmount(req.Name, req.ID)
+	})
+	d.handle(mux, "/VolumeDriver.Path", func(req *volumeRequest, resp *volumeResponse) (err error) {
+		resp.Mountpoint, err = d.Get(req.Name)
+		return
+	})
+	d.handle(mux, "/VolumeDriver.Get", func(req *volumeRequest, resp *volumeResponse) error {
+		mountpoint, err := d.Get(req.Name)
+		if err != nil {
+			return err
+		}
+		resp.Volume = &volumeInfo{Name: req.Name, Mountpoint: mountpoint}
+		return nil
+	})
+	d.handle(mux, "/VolumeDriver.List", func(req *volumeRequest, resp *volumeResponse) error {
+		names, err := d.List()
+		if err != nil {
+			return err
+		}
+		resp.Volumes = []*volumeInfo{}
+		for _, name := range names {
+			resp.Volumes = append(resp.Volumes, &volumeInfo{Name: name, Mountpoint: d.mountpoint(name)})
+		}
+		return nil
+	})
+}
+
+func (d *VolumeDriver) handle(mux *http.ServeMux, path string, fn func(req *volumeRequest, resp *volumeResponse) error) {
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		req, resp := &volumeRequest{}, &volumeResponse{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil && err != io.EOF {
+			resp.Err = err.Error()
+		} else if err = fn(req, resp); err != nil {
+			resp.Err = err.Error()
+		}
+		if resp.Err != "" {
+			glog.V(0).Infof("%s %s: %s", path, req.Name, resp.Err)
+		}
+		writePluginResponse(w, resp)
+	})
+}
+
+func writePluginResponse(w http.ResponseWriter, resp interface{}) {
+	w.Header().Set("Content-Type", pluginContentType)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		glog.V(0).Infof("write plugin response: %v", err)
+	}
+}
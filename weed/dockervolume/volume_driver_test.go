@@ -0,0 +1,69 @@
+package dockervolume
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVolumeDriverHandlers(t *testing.T) {
+
+	driver := NewVolumeDriver(&VolumeDriverOption{})
+	mux := http.NewServeMux()
+	driver.RegisterHandlers(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	post := func(path string, req interface{}) (resp map[string]interface{}) {
+		data, _ := json.Marshal(req)
+		r, err := http.Post(server.URL+path, pluginContentType, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("post %s: %v", path, err)
+		}
+		defer r.Body.Close()
+		if err = json.NewDecoder(r.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode %s response: %v", path, err)
+		}
+		return
+	}
+
+	if resp := post("/Plugin.Activate", nil); resp["Implements"].([]interface{})[0] != "VolumeDriver" {
+		t.Errorf("activate: %v", resp)
+	}
+	if resp := post("/VolumeDriver.Capabilities", nil); resp["Capabilities"].(map[string]interface{})["Scope"] != "global" {
+		t.Errorf("capabilities: %v", resp)
+	}
+	if resp := post("/VolumeDriver.Create", &volumeRequest{Name: "../etc"}); resp["Err"] == "" {
+		t.Errorf("created volume with invalid name")
+	}
+	if resp := post("/VolumeDriver.Create", &volumeRequest{Name: "data", Opts: map[string]string{"unknown": "x"}}); resp["Err"] == "" {
+		t.Errorf("created volume with unknown option")
+	}
+
+	// the volume is unmounted after the last container stops
+	unmounted := 0
+	driver.mounts["data"] = &volumeMount{
+		mountpoint: "/mnt/data",
+		ids:        map[string]bool{"c1": true, "c2": true},
+		unmount: func() error {
+			unmounted++
+			return nil
+		},
+	}
+	if resp := post("/VolumeDriver.Mount", &volumeRequest{Name: "data", ID: "c3"}); resp["Mountpoint"] != "/mnt/data" {
+		t.Errorf("mount a mounted volume: %v", resp)
+	}
+	for _, id := range []string{"c1", "c2", "c3"} {
+		if unmounted != 0 {
+			t.Fatalf("unmounted while used by %s", id)
+		}
+		if resp := post("/VolumeDriver.Unmount", &volumeRequest{Name: "data", ID: id}); resp["Err"] != "" {
+			t.Errorf("unmount %s: %v", id, resp)
+		}
+	}
+	if unmounted != 1 || len(driver.mounts) != 0 {
+		t.Errorf("unmounted %d times, %d mounts left", unmounted, len(driver.mounts))
+	}
+}
@@ -0,0 +1,64 @@
+package abstract_sql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+)
+
+var (
+	_ = filer.BackendStatisticsReporter(&AbstractSqlStore{})
+)
+
+// SqlRowCountEstimator is optionally implemented by the sql generators,
+// to estimate the number of rows from the table statistics instead of counting them
+type SqlRowCountEstimator interface {
+	GetSqlEstimateRowCount(tableName string) string
+}
+
+// BackendStatistics reports the connection pool, and the estimated number of entries in all the tables
+func (store *AbstractSqlStore) BackendStatistics(ctx context.Context) (*filer.StoreBackendStatistics, error) {
+	if err := store.DB.PingContext(ctx); err != nil {
+		return nil, err
+	}
+	dbStats := store.DB.Stats()
+	backendStatistics := &filer.StoreBackendStatistics{
+		MaxOpenConnections:  int64(dbStats.MaxOpenConnections),
+		OpenConnections:     int64(dbStats.OpenConnections),
+		InUseConnections:    int64(dbStats.InUse),
+		IdleConnections:     int64(dbStats.Idle),
+		WaitCount:           dbStats.WaitCount,
+		WaitDurationMs:      int64(dbStats.WaitDuration / time.Millisecond),
+		EstimatedEntryCount: -1,
+	}
+
+	estimator, ok := store.SqlGenerator.(SqlRowCountEstimator)
+	if !ok {
+		return backendStatistics, nil
+	}
+	tableNames := []string{DEFAULT_TABLE}
+	store.dbsLock.Lock()
+	for bucket := range store.dbs {
+		tableNames = append(tableNames, bucket)
+	}
+	store.dbsLock.Unlock()
+
+	var total int64
+	for _, tableName := range tableNames {
+		var rowCount sql.NullInt64
+		if err := store.DB.QueryRowContext(ctx, estimator.GetSqlEstimateRowCount(tableName)).Scan(&rowCount); err != nil {
+			glog.V(1).Infof("estimate row count of table %s: %v", tableName, err)
+			return backendStatistics, nil
+		}
+		if !rowCount.Valid || rowCount.Int64 < 0 {
+			// the table has not been analyzed yet
+			return backendStatistics, nil
+		}
+		total += rowCount.Int64
+	}
+	backendStatistics.EstimatedEntryCount = total
+	return backendStatistics, nil
+}
@@ -96,13 +96,13 @@ func (store *CassandraStore) InsertEntry(ctx context.Context, entry *filer.Entry
 		return fmt.Errorf("encode %s: %s", entry.FullPath, err)
 	}
 
-	if len(entry.Chunks) > 50 {
+	if len(entry.Chunks) > filer.CountEntryChunksForGzip {
 		meta = util.MaybeGzipData(meta)
 	}
 
 	if err := store.session.Query(
 		"INSERT INTO filemeta (directory,name,meta) VALUES(?,?,?) USING TTL ? ",
-		dir, name, meta, entry.TtlSec).Exec(); err != nil {
+		dir, name, meta, entry.TtlSec).WithContext(ctx).Exec(); err != nil {
 		return fmt.Errorf("insert %s: %s", entry.FullPath, err)
 	}
 
@@ -124,7 +124,7 @@ func (store *CassandraStore) FindEntry(ctx context.Context, fullpath util.FullPa
 	var data []byte
 	if err := store.session.Query(
 		"SELECT meta FROM filemeta WHERE directory=? AND name=?",
-		dir, name).Scan(&data); err != nil {
+		dir, name).WithContext(ctx).Scan(&data); err != nil {
 		if err != gocql.ErrNotFound {
 			return nil, filer_pb.ErrNotFound
 		}
@@ -154,7 +154,7 @@ func (store *CassandraStore) DeleteEntry(ctx context.Context, fullpath util.Full
 
 	if err := store.session.Query(
 		"DELETE FROM filemeta WHERE directory=? AND name=?",
-		dir, name).Exec(); err != nil {
+		dir, name).WithContext(ctx).Exec(); err != nil {
 		return fmt.Errorf("delete %s : %v", fullpath, err)
 	}
 
@@ -168,7 +168,7 @@ func (store *CassandraStore) DeleteFolderChildren(ctx context.Context, fullpath
 
 	if err := store.session.Query(
 		"DELETE FROM filemeta WHERE directory=?",
-		fullpath).Exec(); err != nil {
+		fullpath).WithContext(ctx).Exec(); err != nil {
 		return fmt.Errorf("delete %s : %v", fullpath, err)
 	}
 
@@ -192,7 +192,7 @@ func (store *CassandraStore) ListDirectoryEntries(ctx context.Context, dirPath u
 
 	var data []byte
 	var name string
-	iter := store.session.Query(cqlStr, string(dirPath), startFileName, limit+1).Iter()
+	iter := store.session.Query(cqlStr, string(dirPath), startFileName, limit+1).WithContext(ctx).Iter()
 	for iter.Scan(&name, &data) {
 		entry := &filer.Entry{
 			FullPath: util.NewFullPath(string(dirPath), name),
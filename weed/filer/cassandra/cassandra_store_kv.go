@@ -13,7 +13,7 @@ func (store *CassandraStore) KvPut(ctx context.Context, key []byte, value []byte
 
 	if err := store.session.Query(
 		"INSERT INTO filemeta (directory,name,meta) VALUES(?,?,?) USING TTL ? ",
-		dir, name, value, 0).Exec(); err != nil {
+		dir, name, value, 0).WithContext(ctx).Exec(); err != nil {
 		return fmt.Errorf("kv insert: %s", err)
 	}
 
@@ -25,7 +25,7 @@ func (store *CassandraStore) KvGet(ctx context.Context, key []byte) (data []byte
 
 	if err := store.session.Query(
 		"SELECT meta FROM filemeta WHERE directory=? AND name=?",
-		dir, name).Consistency(gocql.One).Scan(&data); err != nil {
+		dir, name).Consistency(gocql.One).WithContext(ctx).Scan(&data); err != nil {
 		if err != gocql.ErrNotFound {
 			return nil, filer.ErrKvNotFound
 		}
@@ -43,7 +43,7 @@ func (store *CassandraStore) KvDelete(ctx context.Context, key []byte) (err erro
 
 	if err := store.session.Query(
 		"DELETE FROM filemeta WHERE directory=? AND name=?",
-		dir, name).Exec(); err != nil {
+		dir, name).WithContext(ctx).Exec(); err != nil {
 		return fmt.Errorf("kv delete: %v", err)
 	}
 
@@ -6,12 +6,16 @@ import (
 	"os"
 	"reflect"
 	"strings"
+	"time"
 )
 
 var (
 	Stores []FilerStore
 )
 
+// a replaced store is shut down after the in-flight requests using it are completed
+const replacedStoreShutdownDelay = time.Minute
+
 func (f *Filer) LoadConfiguration(config *util.ViperProxy) {
 
 	validateOneEnabledStore(config)
@@ -24,7 +28,8 @@ func (f *Filer) LoadConfiguration(config *util.ViperProxy) {
 			if err := store.Initialize(config, store.GetName()+"."); err != nil {
 				glog.Fatalf("failed to initialize store for %s: %+v", store.GetName(), err)
 			}
-			f.SetStore(store)
+			f.SetStore(f.maybeGuardStore(store))
+			f.storeSettings[""] = loadStoreSettings(config, store.GetName())
 			glog.V(0).Infof("configured filer store to %s", store.GetName())
 			hasDefaultStoreConfigured = true
 			break
@@ -72,13 +77,22 @@ func (f *Filer) LoadConfiguration(config *util.ViperProxy) {
 			glog.Errorf("path-specific filer store needs %s", key+".location")
 			os.Exit(-1)
 		}
-		f.Store.AddPathSpecificStore(location, storeId, store)
+		f.Store.AddPathSpecificStore(location, storeId, f.maybeGuardStore(store))
+		f.storeSettings[storeId] = loadStoreSettings(config, key)
 
 		glog.V(0).Infof("configure filer %s for %s", store.GetName(), location)
 	}
 
 }
 
+// maybeGuardStore adds the timeout and the circuit breaker to the store, if configured
+func (f *Filer) maybeGuardStore(store FilerStore) FilerStore {
+	if !f.StoreBreakerOption.IsEnabled() {
+		return store
+	}
+	return NewFilerStoreBreaker(store, f.StoreBreakerOption)
+}
+
 func validateOneEnabledStore(config *util.ViperProxy) {
 	enabledStore := ""
 	for _, store := range Stores {
@@ -91,3 +105,72 @@ func validateOneEnabledStore(config *util.ViperProxy) {
 		}
 	}
 }
+
+// ReloadStores initializes the stores whose settings have been changed, e.g., with new credentials,
+// and replaces the running stores with them.
+// The stores should still keep the same data. Enabling another store, or changing the location of
+// a path-specific store, needs a restart. If a store fails to initialize, the running store is kept.
+func (f *Filer) ReloadStores(config *util.ViperProxy) {
+
+	storeNames := make(map[string]FilerStore)
+	for _, store := range Stores {
+		storeNames[store.GetName()] = store
+	}
+
+	for storeId, oldSettings := range f.storeSettings {
+		key := oldSettings.key
+		settings := loadStoreSettings(config, key)
+		if reflect.DeepEqual(settings.values, oldSettings.values) {
+			continue
+		}
+		if !config.GetBool(key + ".enabled") {
+			glog.Warningf("disabling filer store %s needs a restart", key)
+			continue
+		}
+		if storeId != "" && settings.values[key+".location"] != oldSettings.values[key+".location"] {
+			glog.Warningf("changing the location of filer store %s needs a restart", key)
+			continue
+		}
+
+		storeName := strings.Split(key, ".")[0]
+		store := reflect.New(reflect.ValueOf(storeNames[storeName]).Elem().Type()).Interface().(FilerStore)
+		if err := store.Initialize(config, key+"."); err != nil {
+			glog.Errorf("failed to reload filer store %s: %v", key, err)
+			continue
+		}
+		oldStore := f.Store.ReplaceStore(storeId, f.maybeGuardStore(store))
+		f.storeSettings[storeId] = settings
+		glog.V(0).Infof("reloaded filer store %s", key)
+		if oldStore != nil {
+			time.AfterFunc(replacedStoreShutdownDelay, oldStore.Shutdown)
+		}
+	}
+
+	for _, store := range Stores {
+		if config.GetBool(store.GetName()+".enabled") && store.GetName() != f.storeSettings[""].key {
+			glog.Warningf("switching the filer store to %s needs a restart", store.GetName())
+		}
+	}
+
+}
+
+// storeSettings are the settings of one store in filer.toml
+type storeSettings struct {
+	key    string
+	values map[string]interface{}
+}
+
+func loadStoreSettings(config *util.ViperProxy, key string) storeSettings {
+	settings := storeSettings{
+		key:    key,
+		values: make(map[string]interface{}),
+	}
+	prefix := key + "."
+	for _, k := range config.AllKeys() {
+		// skip the path-specific stores under the default store
+		if strings.HasPrefix(k, prefix) && !strings.Contains(k[len(prefix):], ".") {
+			settings.values[k] = config.Get(k)
+		}
+	}
+	return settings
+}
@@ -24,6 +24,7 @@ type Attr struct {
 	SymlinkTarget string
 	Md5           []byte
 	FileSize      uint64
+	Inode         uint64 // assigned when created, and kept when renamed
 }
 
 func (attr Attr) IsDirectory() bool {
@@ -11,6 +11,11 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 )
 
+// CountEntryChunksForGzip is the number of chunks above which the stores gzip the encoded entry,
+// to keep entries with many chunks within the value size limits of the stores.
+// The stores decompress the values transparently when reading.
+const CountEntryChunksForGzip = 50
+
 func (entry *Entry) EncodeAttributesAndChunks() ([]byte, error) {
 	message := &filer_pb.Entry{}
 	entry.ToExistingProtoEntry(message)
@@ -48,6 +53,7 @@ func EntryAttributeToPb(entry *Entry) *filer_pb.FuseAttributes {
 		SymlinkTarget: entry.Attr.SymlinkTarget,
 		Md5:           entry.Attr.Md5,
 		FileSize:      entry.Attr.FileSize,
+		Inode:         entry.Attr.Inode,
 	}
 }
 
@@ -74,6 +80,7 @@ func PbToEntryAttribute(attr *filer_pb.FuseAttributes) Attr {
 	t.SymlinkTarget = attr.SymlinkTarget
 	t.Md5 = attr.Md5
 	t.FileSize = attr.FileSize
+	t.Inode = attr.Inode
 
 	return t
 }
@@ -132,8 +132,113 @@ func retriedFetchChunkData(urlStrings []string, cipherKey []byte, isGzipped bool
 
 }
 
+// retriedStreamFetchChunkData writes the chunk data to the writer while receiving it.
+// When retrying with another url, the bytes already written are skipped.
+func retriedStreamFetchChunkData(writer io.Writer, urlStrings []string, cipherKey []byte, isGzipped bool, isFullChunk bool, offset int64, size int) (err error) {
+
+	var shouldRetry bool
+	var totalWritten int
+	var writeErr error
+
+	for waitTime := time.Second; waitTime < util.RetryWaitTime; waitTime += waitTime / 2 {
+		for _, urlString := range urlStrings {
+			var localProcessed int
+			shouldRetry, err = util.ReadUrlAsStream(urlString+"?readDeleted=true", cipherKey, isGzipped, isFullChunk, offset, size, func(data []byte) {
+				if writeErr != nil {
+					return
+				}
+				if totalWritten > localProcessed {
+					toBeSkipped := totalWritten - localProcessed
+					if len(data) <= toBeSkipped {
+						localProcessed += len(data)
+						return
+					}
+					data = data[toBeSkipped:]
+					localProcessed += toBeSkipped
+				}
+				var n int
+				n, writeErr = writer.Write(data)
+				localProcessed += n
+				totalWritten += n
+			})
+			if writeErr != nil {
+				return writeErr
+			}
+			if !shouldRetry {
+				break
+			}
+			if err != nil {
+				glog.V(0).Infof("read %s failed, err: %v", urlString, err)
+			} else {
+				break
+			}
+		}
+		if err != nil && shouldRetry {
+			glog.V(0).Infof("retry reading in %v", waitTime)
+			time.Sleep(waitTime)
+		} else {
+			break
+		}
+	}
+
+	return err
+
+}
+
+// ResolveChunkFileIds returns the file ids of the chunks, and of all the chunks referenced by the chunk manifests,
+// including the nested chunk manifests. The file ids of the manifests failed to resolve are still returned.
+func ResolveChunkFileIds(lookupFileIdFn wdclient.LookupFileIdFunctionType, chunks []*filer_pb.FileChunk) (fileIds []string, manifestResolveErr error) {
+	for _, chunk := range chunks {
+		if !chunk.IsChunkManifest {
+			fileIds = append(fileIds, chunk.GetFileIdString())
+			continue
+		}
+		resolvedChunks, err := ResolveOneChunkManifest(lookupFileIdFn, chunk)
+		if err != nil {
+			manifestResolveErr = err
+		}
+		subFileIds, subErr := ResolveChunkFileIds(lookupFileIdFn, resolvedChunks)
+		if subErr != nil {
+			manifestResolveErr = subErr
+		}
+		fileIds = append(fileIds, subFileIds...)
+		fileIds = append(fileIds, chunk.GetFileIdString())
+	}
+	return
+}
+
+// MaybeManifestize merges every ManifestBatch data chunks into one chunk manifest.
+// When there are more than ManifestBatch chunk manifests, they are merged again into upper level chunk manifests,
+// so the number of chunks kept in the entry stays under 2*ManifestBatch, however large the file is.
 func MaybeManifestize(saveFunc SaveDataAsChunkFunctionType, inputChunks []*filer_pb.FileChunk) (chunks []*filer_pb.FileChunk, err error) {
-	return doMaybeManifestize(saveFunc, inputChunks, ManifestBatch, mergeIntoManifest)
+	chunks, err = doMaybeManifestize(saveFunc, inputChunks, ManifestBatch, mergeIntoManifest)
+	if err != nil {
+		return
+	}
+	return doMaybeMergeManifests(saveFunc, chunks, ManifestBatch, mergeIntoManifest)
+}
+
+func doMaybeMergeManifests(saveFunc SaveDataAsChunkFunctionType, inputChunks []*filer_pb.FileChunk, mergeFactor int, mergefn func(saveFunc SaveDataAsChunkFunctionType, dataChunks []*filer_pb.FileChunk) (manifestChunk *filer_pb.FileChunk, err error)) (chunks []*filer_pb.FileChunk, err error) {
+
+	manifestChunks, dataChunks := SeparateManifestChunks(inputChunks)
+
+	for len(manifestChunks) > mergeFactor {
+		var mergedChunks []*filer_pb.FileChunk
+		for i := 0; i < len(manifestChunks); i += mergeFactor {
+			if i+mergeFactor > len(manifestChunks) {
+				mergedChunks = append(mergedChunks, manifestChunks[i:]...)
+				break
+			}
+			chunk, mergeErr := mergefn(saveFunc, manifestChunks[i:i+mergeFactor])
+			if mergeErr != nil {
+				return inputChunks, mergeErr
+			}
+			mergedChunks = append(mergedChunks, chunk)
+		}
+		manifestChunks = mergedChunks
+	}
+
+	return append(manifestChunks, dataChunks...), nil
 }
 
 func doMaybeManifestize(saveFunc SaveDataAsChunkFunctionType, inputChunks []*filer_pb.FileChunk, mergeFactor int, mergefn func(saveFunc SaveDataAsChunkFunctionType, dataChunks []*filer_pb.FileChunk) (manifestChunk *filer_pb.FileChunk, err error)) (chunks []*filer_pb.FileChunk, err error) {
@@ -3,8 +3,12 @@ package filer
 import (
 	"bytes"
 	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
@@ -76,6 +80,58 @@ func TestDoMaybeManifestize(t *testing.T) {
 
 }
 
+func TestDoMaybeMergeManifests(t *testing.T) {
+	var manifestTests = []struct {
+		inputs   []*filer_pb.FileChunk
+		expected []*filer_pb.FileChunk
+	}{
+		{
+			inputs: []*filer_pb.FileChunk{
+				{FileId: "1", IsChunkManifest: true},
+				{FileId: "2", IsChunkManifest: true},
+				{FileId: "3", IsChunkManifest: false},
+			},
+			expected: []*filer_pb.FileChunk{
+				{FileId: "1", IsChunkManifest: true},
+				{FileId: "2", IsChunkManifest: true},
+				{FileId: "3", IsChunkManifest: false},
+			},
+		},
+		{
+			inputs: []*filer_pb.FileChunk{
+				{FileId: "1", IsChunkManifest: true},
+				{FileId: "2", IsChunkManifest: true},
+				{FileId: "3", IsChunkManifest: true},
+				{FileId: "4", IsChunkManifest: false},
+			},
+			expected: []*filer_pb.FileChunk{
+				{FileId: "12", IsChunkManifest: true},
+				{FileId: "3", IsChunkManifest: true},
+				{FileId: "4", IsChunkManifest: false},
+			},
+		},
+		{
+			inputs: []*filer_pb.FileChunk{
+				{FileId: "1", IsChunkManifest: true},
+				{FileId: "2", IsChunkManifest: true},
+				{FileId: "3", IsChunkManifest: true},
+				{FileId: "4", IsChunkManifest: true},
+				{FileId: "5", IsChunkManifest: true},
+			},
+			expected: []*filer_pb.FileChunk{
+				{FileId: "1234", IsChunkManifest: true},
+				{FileId: "5", IsChunkManifest: true},
+			},
+		},
+	}
+
+	for _, mtest := range manifestTests {
+		actual, _ := doMaybeMergeManifests(nil, mtest.inputs, 2, mockMerge)
+		assertEqualChunks(t, mtest.expected, actual)
+	}
+
+}
+
 func assertEqualChunks(t *testing.T, expected, actual []*filer_pb.FileChunk) {
 	assert.Equal(t, len(expected), len(actual))
 	for i := 0; i < len(actual); i++ {
@@ -111,3 +167,69 @@ func mockMerge(saveFunc SaveDataAsChunkFunctionType, dataChunks []*filer_pb.File
 
 	return
 }
+
+func TestRetriedStreamFetchChunkDataResume(t *testing.T) {
+
+	data := make([]byte, 200*1024)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	// the first server breaks the connection after sending part of the data
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data[:100*1024])
+		w.(http.Flusher).Flush()
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer broken.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer healthy.Close()
+
+	var buf bytes.Buffer
+	err := retriedStreamFetchChunkData(&buf, []string{broken.URL, healthy.URL}, nil, false, true, 0, len(data))
+	if err != nil {
+		t.Fatalf("stream fetch: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("received %d bytes, expected %d bytes", buf.Len(), len(data))
+	}
+}
+
+func TestMinusChunksWithMergedManifests(t *testing.T) {
+	manifests := make(map[string][]byte)
+	manifest := func(fileId string, offset int64, chunks ...*filer_pb.FileChunk) *filer_pb.FileChunk {
+		data, _ := proto.Marshal(&filer_pb.FileChunkManifest{Chunks: chunks})
+		manifests[fileId] = data
+		return &filer_pb.FileChunk{FileId: fileId, Offset: offset, Size: 2, IsChunkManifest: true}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(manifests[r.URL.Path[1:]])
+	}))
+	defer server.Close()
+	lookupFileIdFn := func(fileId string) ([]string, error) {
+		return []string{server.URL + "/" + fileId}, nil
+	}
+
+	m1 := manifest("1,m1", 0, &filer_pb.FileChunk{FileId: "1,d1", Offset: 0, Size: 1}, &filer_pb.FileChunk{FileId: "1,d2", Offset: 1, Size: 1})
+	m2 := manifest("1,m2", 2, &filer_pb.FileChunk{FileId: "1,d3", Offset: 2, Size: 1}, &filer_pb.FileChunk{FileId: "1,d4", Offset: 3, Size: 1})
+	m3 := manifest("1,m3", 4, &filer_pb.FileChunk{FileId: "1,d5", Offset: 4, Size: 1}, &filer_pb.FileChunk{FileId: "1,d6", Offset: 5, Size: 1})
+	// the manifests merged into an upper level manifest are still referenced
+	m12 := manifest("1,m12", 0, m1, m2)
+	m12.Size = 4
+
+	delta, err := MinusChunks(lookupFileIdFn, []*filer_pb.FileChunk{m1, m2, m3}, []*filer_pb.FileChunk{m12, m3})
+	assert.Nil(t, err)
+	assert.Empty(t, delta)
+
+	delta, err = MinusChunks(lookupFileIdFn, []*filer_pb.FileChunk{m12, m3}, []*filer_pb.FileChunk{m1, m2})
+	assert.Nil(t, err)
+	var fileIds []string
+	for _, chunk := range delta {
+		fileIds = append(fileIds, chunk.GetFileIdString())
+	}
+	assert.ElementsMatch(t, []string{"1,d5", "1,d6", "1,m12", "1,m3"}, fileIds)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/grpc"
@@ -28,20 +29,27 @@ var (
 )
 
 type Filer struct {
-	Store               VirtualFilerStore
-	MasterClient        *wdclient.MasterClient
-	fileIdDeletionQueue *util.UnboundedQueue
-	GrpcDialOption      grpc.DialOption
-	DirBucketsPath      string
-	FsyncBuckets        []string
-	buckets             *FilerBuckets
-	Cipher              bool
-	LocalMetaLogBuffer  *log_buffer.LogBuffer
-	metaLogCollection   string
-	metaLogReplication  string
-	MetaAggregator      *MetaAggregator
-	Signature           int32
-	FilerConf           *FilerConf
+	Store                 VirtualFilerStore
+	MasterClient          *wdclient.MasterClient
+	fileIdDeletionQueue   *util.UnboundedQueue
+	GrpcDialOption        grpc.DialOption
+	DirBucketsPath        string
+	FsyncBuckets          []string
+	buckets               *FilerBuckets
+	DirLogicalVolumesPath string
+	logicalVolumes        *FilerLogicalVolumes
+	Cipher                bool
+	LocalMetaLogBuffer    *log_buffer.LogBuffer
+	metaLogCollection     string
+	metaLogReplication    string
+	MetaAggregator        *MetaAggregator
+	Signature             int32
+	FilerConf             *FilerConf
+	storeSettings         map[string]storeSettings
+	StoreBreakerOption    StoreBreakerOption
+	dedupLock             sync.Mutex
+	isDedupUsed           int32
+	dedupLookupFileId     wdclient.LookupFileIdFunctionType
 }
 
 func NewFiler(masters []string, grpcDialOption grpc.DialOption,
@@ -51,8 +59,13 @@ func NewFiler(masters []string, grpcDialOption grpc.DialOption,
 		fileIdDeletionQueue: util.NewUnboundedQueue(),
 		GrpcDialOption:      grpcDialOption,
 		FilerConf:           NewFilerConf(),
+		logicalVolumes: &FilerLogicalVolumes{
+			volumes: make(map[LogicalVolumeName]*LogicalVolumeStat),
+		},
+		storeSettings: make(map[string]storeSettings),
 	}
 	f.LocalMetaLogBuffer = log_buffer.NewLogBuffer("local", LogFlushInterval, f.logFlushFunc, notifyFn)
+	f.dedupLookupFileId = f.MasterClient.LookupFileId
 	f.metaLogCollection = collection
 	f.metaLogReplication = replication
 
@@ -130,11 +143,26 @@ func (f *Filer) RollbackTransaction(ctx context.Context) error {
 
 func (f *Filer) CreateEntry(ctx context.Context, entry *Entry, o_excl bool, isFromOtherCluster bool, signatures []int32) error {
 
+	oldEntry, err := f.createEntry(ctx, entry, o_excl, isFromOtherCluster, signatures)
+	if err != nil {
+		return err
+	}
+
+	f.deleteChunksIfNotNew(oldEntry, entry)
+
+	glog.V(4).Infof("CreateEntry %s: created", entry.FullPath)
+
+	return nil
+}
+
+// createEntry creates or updates the entry, and returns the replaced entry, whose chunks are not deleted yet
+func (f *Filer) createEntry(ctx context.Context, entry *Entry, o_excl bool, isFromOtherCluster bool, signatures []int32) (oldEntry *Entry, err error) {
+
 	if string(entry.FullPath) == "/" {
-		return nil
+		return nil, nil
 	}
 
-	oldEntry, _ := f.FindEntry(ctx, entry.FullPath)
+	oldEntry, _ = f.FindEntry(ctx, entry.FullPath)
 
 	/*
 		if !hasWritePermission(lastDirectoryEntry, entry) {
@@ -144,38 +172,38 @@ func (f *Filer) CreateEntry(ctx context.Context, entry *Entry, o_excl bool, isFr
 		}
 	*/
 
+	if entry.Attr.Inode == 0 && oldEntry == nil {
+		entry.Attr.Inode = newInode()
+	}
+
 	if oldEntry == nil {
 
 		dirParts := strings.Split(string(entry.FullPath), "/")
 		if err := f.ensureParentDirecotryEntry(ctx, entry, dirParts, len(dirParts)-1, isFromOtherCluster); err != nil {
-			return err
+			return nil, err
 		}
 
 		glog.V(4).Infof("InsertEntry %s: new entry: %v", entry.FullPath, entry.Name())
 		if err := f.Store.InsertEntry(ctx, entry); err != nil {
 			glog.Errorf("insert entry %s: %v", entry.FullPath, err)
-			return fmt.Errorf("insert entry %s: %v", entry.FullPath, err)
+			return nil, fmt.Errorf("insert entry %s: %v", entry.FullPath, err)
 		}
 	} else {
 		if o_excl {
 			glog.V(3).Infof("EEXIST: entry %s already exists", entry.FullPath)
-			return fmt.Errorf("EEXIST: entry %s already exists", entry.FullPath)
+			return nil, fmt.Errorf("EEXIST: entry %s already exists", entry.FullPath)
 		}
 		glog.V(4).Infof("UpdateEntry %s: old entry: %v", entry.FullPath, oldEntry.Name())
 		if err := f.UpdateEntry(ctx, oldEntry, entry); err != nil {
 			glog.Errorf("update entry %s: %v", entry.FullPath, err)
-			return fmt.Errorf("update entry %s: %v", entry.FullPath, err)
+			return nil, fmt.Errorf("update entry %s: %v", entry.FullPath, err)
 		}
 	}
 
 	f.maybeAddBucket(entry)
 	f.NotifyUpdateEvent(ctx, oldEntry, entry, true, isFromOtherCluster, signatures)
 
-	f.deleteChunksIfNotNew(oldEntry, entry)
-
-	glog.V(4).Infof("CreateEntry %s: created", entry.FullPath)
-
-	return nil
+	return oldEntry, nil
 }
 
 func (f *Filer) ensureParentDirecotryEntry(ctx context.Context, entry *Entry, dirParts []string, level int, isFromOtherCluster bool) (err error) {
@@ -214,6 +242,7 @@ func (f *Filer) ensureParentDirecotryEntry(ctx context.Context, entry *Entry, di
 				Replication: entry.Replication,
 				UserName:    entry.UserName,
 				GroupNames:  entry.GroupNames,
+				Inode:       newInode(),
 			},
 		}
 
@@ -240,6 +269,9 @@ func (f *Filer) ensureParentDirecotryEntry(ctx context.Context, entry *Entry, di
 func (f *Filer) UpdateEntry(ctx context.Context, oldEntry, entry *Entry) (err error) {
 	if oldEntry != nil {
 		entry.Attr.Crtime = oldEntry.Attr.Crtime
+		if entry.Attr.Inode == 0 {
+			entry.Attr.Inode = oldEntry.Attr.Inode
+		}
 		if oldEntry.IsDirectory() && !entry.IsDirectory() {
 			glog.Errorf("existing %s is a directory", oldEntry.FullPath)
 			return fmt.Errorf("existing %s is a directory", oldEntry.FullPath)
@@ -252,6 +284,16 @@ func (f *Filer) UpdateEntry(ctx context.Context, oldEntry, entry *Entry) (err er
 	return f.Store.UpdateEntry(ctx, entry)
 }
 
+// newInode allocates the inode of a new entry. Unlike the hash of the path, it is not reused
+// by the entries created later at the path of a renamed entry. 0 and 1 of the mount root are skipped.
+func newInode() uint64 {
+	for {
+		if inode := util.BytesToUint64(util.RandomBytes(8)); inode > 1 {
+			return inode
+		}
+	}
+}
+
 var (
 	Root = &Entry{
 		FullPath: "/",
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"time"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
@@ -105,6 +106,11 @@ func (fc *FilerConf) DeleteLocationConf(locationPrefix string) {
 	return
 }
 
+const (
+	ReadModeProxy    = "proxy"    // the filer reads the content from volume servers
+	ReadModeRedirect = "redirect" // the filer redirects the client to the volume server, if the file has only one chunk
+)
+
 func (fc *FilerConf) MatchStorageRule(path string) (pathConf *filer_pb.FilerConf_PathConf) {
 	pathConf = &filer_pb.FilerConf_PathConf{}
 	fc.rules.MatchPrefix([]byte(path), func(key []byte, value interface{}) bool {
@@ -130,6 +136,13 @@ func mergePathConf(a, b *filer_pb.FilerConf_PathConf) {
 	if b.ReadOnly {
 		a.ReadOnly = b.ReadOnly
 	}
+	a.ReadMode = util.Nvl(b.ReadMode, a.ReadMode)
+	if b.SaveToFilerLimit > 0 {
+		a.SaveToFilerLimit = b.SaveToFilerLimit
+	}
+	if b.MaxMb > 0 {
+		a.MaxMb = b.MaxMb
+	}
 }
 
 func (fc *FilerConf) ToProto() *filer_pb.FilerConf {
@@ -151,3 +164,36 @@ func (fc *FilerConf) ToText(writer io.Writer) error {
 
 	return m.Marshal(writer, fc.ToProto())
 }
+
+// ReadFilerConf reads the latest path-specific configuration from the filer store
+func (f *Filer) ReadFilerConf() (fc *FilerConf, err error) {
+	fc = NewFilerConf()
+	err = fc.loadFromFiler(f)
+	return
+}
+
+// SaveFilerConf saves the path-specific configuration, which is then reloaded by all filers
+func (f *Filer) SaveFilerConf(ctx context.Context, fc *FilerConf) error {
+	var buf bytes.Buffer
+	if err := fc.ToText(&buf); err != nil {
+		return err
+	}
+	now := time.Now()
+	entry := &Entry{
+		FullPath: util.NewFullPath(DirectoryEtcSeaweedFS, FilerConfName),
+		Attr: Attr{
+			Mtime:    now,
+			Crtime:   now,
+			Mode:     0644,
+			Uid:      OS_UID,
+			Gid:      OS_GID,
+			FileSize: uint64(buf.Len()),
+		},
+		Content: buf.Bytes(),
+	}
+	if err := f.CreateEntry(ctx, entry, false, false, nil); err != nil {
+		return err
+	}
+	f.FilerConf = fc
+	return nil
+}
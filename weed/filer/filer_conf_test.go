@@ -36,6 +36,14 @@ func TestFilerConf(t *testing.T) {
 			LocationPrefix: "/buckets/xxx/yyy",
 			ReadOnly:       false,
 		},
+		{
+			LocationPrefix:   "/buckets/icons/",
+			SaveToFilerLimit: 8192,
+		},
+		{
+			LocationPrefix: "/buckets/icons/large/",
+			MaxMb:          8,
+		},
 	}}
 	fc.doLoadConf(conf)
 
@@ -46,4 +54,11 @@ func TestFilerConf(t *testing.T) {
 	assert.Equal(t, true, fc.MatchStorageRule("/buckets/xxx/yyy/zzz").ReadOnly)
 	assert.Equal(t, false, fc.MatchStorageRule("/buckets/other").ReadOnly)
 
+	assert.Equal(t, uint32(8192), fc.MatchStorageRule("/buckets/icons/a.png").SaveToFilerLimit)
+	assert.Equal(t, uint32(0), fc.MatchStorageRule("/buckets/abc/a.png").SaveToFilerLimit)
+
+	assert.Equal(t, uint32(8), fc.MatchStorageRule("/buckets/icons/large/a.png").MaxMb)
+	assert.Equal(t, uint32(8192), fc.MatchStorageRule("/buckets/icons/large/a.png").SaveToFilerLimit)
+	assert.Equal(t, uint32(0), fc.MatchStorageRule("/buckets/icons/a.png").MaxMb)
+
 }
@@ -0,0 +1,270 @@
+package filer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+)
+
+// The chunks with the same content can be shared by many entries.
+// The dedup index in the filer store maps the content hash to the first uploaded chunk,
+// and the chunk file id to its reference count and content hash.
+// A shared chunk is only deleted from volume servers after its last reference is deleted.
+// The whole files uploaded with their content hash are also indexed to their shared chunks.
+// The reference counts are read and written under a lock of this filer, not in a store transaction,
+// so the deduplication only supports one filer writing to the filer store.
+const (
+	dedupUsedKey       = "dedup.used"
+	dedupHashKeyPrefix = "dedup.hash."
+	dedupRefKeyPrefix  = "dedup.ref."
+	dedupFileKeyPrefix = "dedup.file."
+)
+
+// DedupHashKey is the dedup index key of the chunk content, written with the storage options
+func DedupHashKey(data []byte, collection, replication, diskType string) string {
+	hash := sha256.Sum256(data)
+	return dedupHashKeyPrefix + collection + "," + replication + "," + diskType + "," + hex.EncodeToString(hash[:])
+}
+
+// DedupFileKey is the dedup index key of the whole file content by its hex encoded sha256, written with the storage options
+func DedupFileKey(sha256Hex, collection, replication, diskType string) string {
+	return dedupFileKeyPrefix + collection + "," + replication + "," + diskType + "," + sha256Hex
+}
+
+// ReferenceDedupChunk returns a copy of the indexed chunk with the same content, and counts the new reference.
+// It returns nil if no such chunk is found.
+func (f *Filer) ReferenceDedupChunk(hashKey string) *filer_pb.FileChunk {
+	f.dedupLock.Lock()
+	defer f.dedupLock.Unlock()
+
+	ctx := context.Background()
+	data, err := f.Store.KvGet(ctx, []byte(hashKey))
+	if err != nil {
+		return nil
+	}
+	chunk := &filer_pb.FileChunk{}
+	if err = proto.Unmarshal(data, chunk); err != nil {
+		glog.Errorf("unmarshal dedup chunk %s: %v", hashKey, err)
+		return nil
+	}
+	fileId := chunk.GetFileIdString()
+
+	// the volume may be deleted with its collection, without dereferencing its chunks
+	if _, err = f.dedupLookupFileId(fileId); err != nil {
+		glog.V(1).Infof("dedup chunk %s: %v", fileId, err)
+		return nil
+	}
+
+	count, _ := f.readDedupRef(ctx, fileId)
+	if count == 0 {
+		return nil
+	}
+	if err = f.writeDedupRef(ctx, fileId, count+1, hashKey); err != nil {
+		glog.Errorf("reference dedup chunk %s: %v", fileId, err)
+		return nil
+	}
+	return chunk
+}
+
+// AddDedupChunk indexes a newly uploaded chunk by its content, with one reference
+func (f *Filer) AddDedupChunk(hashKey string, chunk *filer_pb.FileChunk) {
+	f.dedupLock.Lock()
+	defer f.dedupLock.Unlock()
+
+	ctx := context.Background()
+	if atomic.LoadInt32(&f.isDedupUsed) == 0 {
+		if err := f.Store.KvPut(ctx, []byte(dedupUsedKey), []byte{1}); err != nil {
+			glog.V(1).Infof("dedup chunk %s: %v", chunk.GetFileIdString(), err)
+			return
+		}
+		atomic.StoreInt32(&f.isDedupUsed, 1)
+	}
+
+	data, err := proto.Marshal(&filer_pb.FileChunk{
+		FileId:       chunk.GetFileIdString(),
+		Size:         chunk.Size,
+		ETag:         chunk.ETag,
+		CipherKey:    chunk.CipherKey,
+		IsCompressed: chunk.IsCompressed,
+	})
+	if err != nil {
+		glog.Errorf("marshal dedup chunk %s: %v", chunk.GetFileIdString(), err)
+		return
+	}
+	if err = f.writeDedupRef(ctx, chunk.GetFileIdString(), 1, hashKey); err != nil {
+		glog.Errorf("add dedup chunk %s: %v", chunk.GetFileIdString(), err)
+		return
+	}
+	if err = f.Store.KvPut(ctx, []byte(hashKey), data); err != nil {
+		glog.Errorf("add dedup chunk %s: %v", chunk.GetFileIdString(), err)
+	}
+}
+
+// ReferenceDedupFile returns copies of the shared chunks of the indexed file, and counts the new references.
+// It returns nil if the file is not found, or any of its chunks is deleted.
+func (f *Filer) ReferenceDedupFile(fileKey string) (chunks []*filer_pb.FileChunk, md5 []byte, fileSize uint64) {
+	f.dedupLock.Lock()
+	defer f.dedupLock.Unlock()
+
+	ctx := context.Background()
+	data, err := f.Store.KvGet(ctx, []byte(fileKey))
+	if err != nil {
+		return nil, nil, 0
+	}
+	file := &filer_pb.Entry{}
+	if err = proto.Unmarshal(data, file); err != nil {
+		glog.Errorf("unmarshal dedup file %s: %v", fileKey, err)
+		return nil, nil, 0
+	}
+
+	counts := make([]uint32, len(file.Chunks))
+	hashKeys := make([]string, len(file.Chunks))
+	for i, chunk := range file.Chunks {
+		fileId := chunk.GetFileIdString()
+		if _, err = f.dedupLookupFileId(fileId); err != nil {
+			glog.V(1).Infof("dedup file chunk %s: %v", fileId, err)
+			return nil, nil, 0
+		}
+		if counts[i], hashKeys[i] = f.readDedupRef(ctx, fileId); counts[i] == 0 {
+			return nil, nil, 0
+		}
+	}
+	for i, chunk := range file.Chunks {
+		// the same chunk may be referenced more than once in the file
+		count, _ := f.readDedupRef(ctx, chunk.GetFileIdString())
+		if err = f.writeDedupRef(ctx, chunk.GetFileIdString(), count+1, hashKeys[i]); err != nil {
+			glog.Errorf("reference dedup file chunk %s: %v", chunk.GetFileIdString(), err)
+			f.dereferenceDedupFileIds(ctx, file.Chunks[:i])
+			return nil, nil, 0
+		}
+	}
+	return file.Chunks, file.Attributes.GetMd5(), file.Attributes.GetFileSize()
+}
+
+// AddDedupFile indexes the file content by its shared chunks
+func (f *Filer) AddDedupFile(fileKey string, chunks []*filer_pb.FileChunk, md5 []byte, fileSize uint64) {
+	f.dedupLock.Lock()
+	defer f.dedupLock.Unlock()
+
+	ctx := context.Background()
+	file := &filer_pb.Entry{
+		Attributes: &filer_pb.FuseAttributes{
+			FileSize: fileSize,
+			Md5:      md5,
+		},
+	}
+	for _, chunk := range chunks {
+		// only the chunks reference counted can be shared
+		if count, _ := f.readDedupRef(ctx, chunk.GetFileIdString()); count == 0 {
+			return
+		}
+		file.Chunks = append(file.Chunks, &filer_pb.FileChunk{
+			FileId:       chunk.GetFileIdString(),
+			Offset:       chunk.Offset,
+			Size:         chunk.Size,
+			ETag:         chunk.ETag,
+			CipherKey:    chunk.CipherKey,
+			IsCompressed: chunk.IsCompressed,
+		})
+	}
+	data, err := proto.Marshal(file)
+	if err != nil {
+		glog.Errorf("marshal dedup file %s: %v", fileKey, err)
+		return
+	}
+	if err = f.Store.KvPut(ctx, []byte(fileKey), data); err != nil {
+		glog.Errorf("add dedup file %s: %v", fileKey, err)
+	}
+}
+
+// DereferenceDedupFile drops the references counted by ReferenceDedupFile, if the file is not created with the chunks
+func (f *Filer) DereferenceDedupFile(chunks []*filer_pb.FileChunk) {
+	f.dedupLock.Lock()
+	defer f.dedupLock.Unlock()
+
+	f.dereferenceDedupFileIds(context.Background(), chunks)
+}
+
+// dereferenceDedupFileIds drops one reference of each chunk, without deleting any chunk
+func (f *Filer) dereferenceDedupFileIds(ctx context.Context, chunks []*filer_pb.FileChunk) {
+	for _, chunk := range chunks {
+		if count, hashKey := f.readDedupRef(ctx, chunk.GetFileIdString()); count > 0 {
+			f.writeDedupRef(ctx, chunk.GetFileIdString(), count-1, hashKey)
+		}
+	}
+}
+
+// dereferenceDedupChunks drops one reference of each shared chunk,
+// and returns the file ids not referenced any more
+func (f *Filer) dereferenceDedupChunks(fileIds []string) (toDelete []string) {
+	if !f.checkDedupUsed() {
+		return fileIds
+	}
+
+	f.dedupLock.Lock()
+	defer f.dedupLock.Unlock()
+
+	ctx := context.Background()
+	for _, fileId := range fileIds {
+		count, hashKey := f.readDedupRef(ctx, fileId)
+		if count > 1 {
+			if err := f.writeDedupRef(ctx, fileId, count-1, hashKey); err != nil {
+				glog.Errorf("dereference dedup chunk %s: %v", fileId, err)
+			}
+			continue
+		}
+		if count == 1 {
+			if err := f.Store.KvDelete(ctx, []byte(hashKey)); err != nil {
+				glog.Errorf("delete dedup chunk %s index: %v", fileId, err)
+			}
+			if err := f.Store.KvDelete(ctx, []byte(dedupRefKeyPrefix+fileId)); err != nil {
+				glog.Errorf("delete dedup chunk %s reference: %v", fileId, err)
+			}
+		}
+		toDelete = append(toDelete, fileId)
+	}
+	return
+}
+
+// isSharedDedupChunk checks whether the chunk is referenced more than once
+func (f *Filer) isSharedDedupChunk(fileId string) bool {
+	if !f.checkDedupUsed() {
+		return false
+	}
+	count, _ := f.readDedupRef(context.Background(), fileId)
+	return count > 1
+}
+
+// checkDedupUsed finds out whether any filer sharing the filer store has indexed a chunk
+func (f *Filer) checkDedupUsed() bool {
+	if atomic.LoadInt32(&f.isDedupUsed) == 1 {
+		return true
+	}
+	if _, err := f.Store.KvGet(context.Background(), []byte(dedupUsedKey)); err != nil {
+		return false
+	}
+	atomic.StoreInt32(&f.isDedupUsed, 1)
+	return true
+}
+
+func (f *Filer) readDedupRef(ctx context.Context, fileId string) (count uint32, hashKey string) {
+	value, err := f.Store.KvGet(ctx, []byte(dedupRefKeyPrefix+fileId))
+	if err != nil || len(value) < 4 {
+		return 0, ""
+	}
+	return binary.BigEndian.Uint32(value), string(value[4:])
+}
+
+func (f *Filer) writeDedupRef(ctx context.Context, fileId string, count uint32, hashKey string) error {
+	value := make([]byte, 4+len(hashKey))
+	binary.BigEndian.PutUint32(value, count)
+	copy(value[4:], hashKey)
+	return f.Store.KvPut(ctx, []byte(dedupRefKeyPrefix+fileId), value)
+}
@@ -0,0 +1,150 @@
+package filer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+)
+
+// kvStore keeps the key values in memory, for the dedup index
+type kvStore struct {
+	*txStore
+	kv map[string][]byte
+}
+
+func (s *kvStore) KvGet(ctx context.Context, key []byte) ([]byte, error) {
+	if value, found := s.kv[string(key)]; found {
+		return value, nil
+	}
+	return nil, ErrKvNotFound
+}
+
+func (s *kvStore) KvPut(ctx context.Context, key []byte, value []byte) error {
+	s.kv[string(key)] = value
+	return nil
+}
+
+func (s *kvStore) KvDelete(ctx context.Context, key []byte) error {
+	delete(s.kv, string(key))
+	return nil
+}
+
+// newDedupTestFiler only finds the volumes in existingVolumes
+func newDedupTestFiler(existingVolumes ...string) *Filer {
+	f := newTestFiler(&kvStore{txStore: newTxStore(), kv: make(map[string][]byte)})
+	f.dedupLookupFileId = func(fileId string) ([]string, error) {
+		for _, vid := range existingVolumes {
+			if strings.HasPrefix(fileId, vid+",") {
+				return []string{"http://127.0.0.1:8080/" + fileId}, nil
+			}
+		}
+		return nil, fmt.Errorf("volume of %s not found", fileId)
+	}
+	return f
+}
+
+func dedupRefCount(f *Filer, fileId string) uint32 {
+	count, _ := f.readDedupRef(context.Background(), fileId)
+	return count
+}
+
+func TestDedupChunkReference(t *testing.T) {
+
+	f := newDedupTestFiler("3")
+	hashKey := DedupHashKey([]byte("hello"), "", "", "")
+	chunk := &filer_pb.FileChunk{FileId: "3,01637037d6", Size: 5}
+
+	if f.ReferenceDedupChunk(hashKey) != nil {
+		t.Fatalf("found a chunk not indexed")
+	}
+
+	f.AddDedupChunk(hashKey, chunk)
+	if !f.checkDedupUsed() || f.isSharedDedupChunk(chunk.FileId) {
+		t.Fatalf("a newly indexed chunk is shared")
+	}
+
+	shared := f.ReferenceDedupChunk(hashKey)
+	if shared == nil || shared.FileId != chunk.FileId || shared.Size != chunk.Size {
+		t.Fatalf("referenced chunk %+v, expected %+v", shared, chunk)
+	}
+	if count := dedupRefCount(f, chunk.FileId); count != 2 || !f.isSharedDedupChunk(chunk.FileId) {
+		t.Fatalf("reference count %d, expected 2", count)
+	}
+
+	if f.ReferenceDedupChunk(DedupHashKey([]byte("hello"), "c1", "", "")) != nil {
+		t.Errorf("found a chunk written with other storage options")
+	}
+
+	if toDelete := f.dereferenceDedupChunks([]string{chunk.FileId}); len(toDelete) != 0 {
+		t.Fatalf("deleting %v still referenced", toDelete)
+	}
+	if toDelete := f.dereferenceDedupChunks([]string{chunk.FileId, "4,0263b2f2a1"}); len(toDelete) != 2 {
+		t.Fatalf("deleting %v, expected the last reference and the chunk not shared", toDelete)
+	}
+	if f.ReferenceDedupChunk(hashKey) != nil {
+		t.Errorf("found a deleted chunk")
+	}
+}
+
+func TestDedupChunkVolumeDeleted(t *testing.T) {
+
+	f := newDedupTestFiler()
+	hashKey := DedupHashKey([]byte("hello"), "", "", "")
+	f.AddDedupChunk(hashKey, &filer_pb.FileChunk{FileId: "3,01637037d6", Size: 5})
+
+	if f.ReferenceDedupChunk(hashKey) != nil {
+		t.Errorf("found a chunk of a deleted volume")
+	}
+	if count := dedupRefCount(f, "3,01637037d6"); count != 1 {
+		t.Errorf("reference count %d, expected 1", count)
+	}
+}
+
+func TestDedupFileReference(t *testing.T) {
+
+	f := newDedupTestFiler("3")
+	chunk1 := &filer_pb.FileChunk{FileId: "3,01637037d6", Offset: 0, Size: 5}
+	chunk2 := &filer_pb.FileChunk{FileId: "3,0263b2f2a1", Offset: 5, Size: 5}
+	f.AddDedupChunk(DedupHashKey([]byte("hello"), "", "", ""), chunk1)
+	f.AddDedupChunk(DedupHashKey([]byte("world"), "", "", ""), chunk2)
+
+	// the same chunk can be referenced more than once in a file
+	fileKey := DedupFileKey("abcd", "", "", "")
+	f.AddDedupFile(fileKey, []*filer_pb.FileChunk{chunk1, chunk2, {FileId: chunk1.FileId, Offset: 10, Size: 5}}, []byte("md5"), 15)
+
+	chunks, md5, fileSize := f.ReferenceDedupFile(fileKey)
+	if len(chunks) != 3 || string(md5) != "md5" || fileSize != 15 {
+		t.Fatalf("referenced %d chunks of %d bytes, expected 3 chunks of 15 bytes", len(chunks), fileSize)
+	}
+	if count1, count2 := dedupRefCount(f, chunk1.FileId), dedupRefCount(f, chunk2.FileId); count1 != 3 || count2 != 2 {
+		t.Fatalf("reference counts %d and %d, expected 3 and 2", count1, count2)
+	}
+
+	f.DereferenceDedupFile(chunks)
+	if count1, count2 := dedupRefCount(f, chunk1.FileId), dedupRefCount(f, chunk2.FileId); count1 != 1 || count2 != 1 {
+		t.Fatalf("reference counts %d and %d after dereferencing, expected 1 and 1", count1, count2)
+	}
+
+	if chunks, _, _ := f.ReferenceDedupFile(DedupFileKey("ef01", "", "", "")); chunks != nil {
+		t.Errorf("found a file not indexed")
+	}
+
+	// a file with a chunk not reference counted is not indexed
+	otherKey := DedupFileKey("2345", "", "", "")
+	f.AddDedupFile(otherKey, []*filer_pb.FileChunk{chunk1, {FileId: "3,03a1b2c3d4", Size: 5}}, nil, 10)
+	if chunks, _, _ := f.ReferenceDedupFile(otherKey); chunks != nil {
+		t.Errorf("found a file with a chunk not reference counted")
+	}
+
+	// a file with a deleted chunk is not found
+	f.dereferenceDedupChunks([]string{chunk2.FileId})
+	if chunks, _, _ := f.ReferenceDedupFile(fileKey); chunks != nil {
+		t.Errorf("found a file with a deleted chunk")
+	}
+	if count := dedupRefCount(f, chunk1.FileId); count != 1 {
+		t.Errorf("reference count %d of a file not found, expected 1", count)
+	}
+}
@@ -50,6 +50,7 @@ func (f *Filer) loopProcessingDeletion() {
 					toDeleteFileIds = fileIds
 					fileIds = fileIds[:0]
 				}
+				toDeleteFileIds = f.dereferenceDedupChunks(toDeleteFileIds)
 				deletionCount = len(toDeleteFileIds)
 				_, err := operation.DeleteFilesWithLookupVolumeId(f.GrpcDialOption, toDeleteFileIds, lookupFunc)
 				if err != nil {
@@ -82,6 +83,7 @@ func (f *Filer) doDeleteFileIds(fileIds []string) {
 			toDeleteFileIds = fileIds
 			fileIds = fileIds[:0]
 		}
+		toDeleteFileIds = f.dereferenceDedupChunks(toDeleteFileIds)
 		deletionCount := len(toDeleteFileIds)
 		_, err := operation.DeleteFilesWithLookupVolumeId(f.GrpcDialOption, toDeleteFileIds, lookupFunc)
 		if err != nil {
@@ -93,42 +95,35 @@ func (f *Filer) doDeleteFileIds(fileIds []string) {
 }
 
 func (f *Filer) DirectDeleteChunks(chunks []*filer_pb.FileChunk) {
-	var fildIdsToDelete []string
-	for _, chunk := range chunks {
-		if !chunk.IsChunkManifest {
-			fildIdsToDelete = append(fildIdsToDelete, chunk.GetFileIdString())
-			continue
-		}
-		dataChunks, manifestResolveErr := ResolveOneChunkManifest(f.MasterClient.LookupFileId, chunk)
-		if manifestResolveErr != nil {
-			glog.V(0).Infof("failed to resolve manifest %s: %v", chunk.FileId, manifestResolveErr)
-		}
-		for _, dChunk := range dataChunks {
-			fildIdsToDelete = append(fildIdsToDelete, dChunk.GetFileIdString())
-		}
-		fildIdsToDelete = append(fildIdsToDelete, chunk.GetFileIdString())
+	fildIdsToDelete, manifestResolveErr := ResolveChunkFileIds(f.MasterClient.LookupFileId, chunks)
+	if manifestResolveErr != nil {
+		glog.V(0).Infof("failed to resolve manifest: %v", manifestResolveErr)
 	}
 
 	f.doDeleteFileIds(fildIdsToDelete)
 }
 
 func (f *Filer) DeleteChunks(chunks []*filer_pb.FileChunk) {
+	fileIds, manifestResolveErr := ResolveChunkFileIds(f.MasterClient.LookupFileId, chunks)
+	if manifestResolveErr != nil {
+		glog.V(0).Infof("failed to resolve manifest: %v", manifestResolveErr)
+	}
+	for _, fileId := range fileIds {
+		f.fileIdDeletionQueue.EnQueue(fileId)
+	}
+}
+
+// DeleteChunksNotRecursive deletes the chunks, without the chunks referenced by the chunk manifests.
+// It is for the chunks already resolved, e.g., by MinusChunks.
+func (f *Filer) DeleteChunksNotRecursive(chunks []*filer_pb.FileChunk) {
 	for _, chunk := range chunks {
-		if !chunk.IsChunkManifest {
-			f.fileIdDeletionQueue.EnQueue(chunk.GetFileIdString())
-			continue
-		}
-		dataChunks, manifestResolveErr := ResolveOneChunkManifest(f.MasterClient.LookupFileId, chunk)
-		if manifestResolveErr != nil {
-			glog.V(0).Infof("failed to resolve manifest %s: %v", chunk.FileId, manifestResolveErr)
-		}
-		for _, dChunk := range dataChunks {
-			f.fileIdDeletionQueue.EnQueue(dChunk.GetFileIdString())
-		}
 		f.fileIdDeletionQueue.EnQueue(chunk.GetFileIdString())
 	}
 }
 
+// deleteChunksIfNotNew deletes the chunks of the old entry no longer referenced by the new entry.
+// The chunk manifests are resolved on both sides, since the chunks, or the chunk manifests, of the old entry
+// may be merged into a chunk manifest of the new entry. Nothing is deleted if any chunk manifest fails to resolve.
 func (f *Filer) deleteChunksIfNotNew(oldEntry, newEntry *Entry) {
 
 	if oldEntry == nil {
@@ -136,18 +131,24 @@ func (f *Filer) deleteChunksIfNotNew(oldEntry, newEntry *Entry) {
 	}
 	if newEntry == nil {
 		f.DeleteChunks(oldEntry.Chunks)
+		return
 	}
 
-	var toDelete []*filer_pb.FileChunk
-	newChunkIds := make(map[string]bool)
-	for _, newChunk := range newEntry.Chunks {
-		newChunkIds[newChunk.GetFileIdString()] = true
+	toDelete, err := MinusChunks(f.MasterClient.LookupFileId, oldEntry.Chunks, newEntry.Chunks)
+	if err != nil {
+		glog.Errorf("chunks no longer used by %s: %v", newEntry.FullPath, err)
+		return
 	}
 
+	newChunks := make(map[string]*filer_pb.FileChunk)
+	for _, newChunk := range newEntry.Chunks {
+		newChunks[newChunk.GetFileIdString()] = newChunk
+	}
 	for _, oldChunk := range oldEntry.Chunks {
-		if _, found := newChunkIds[oldChunk.GetFileIdString()]; !found {
+		// the same content is uploaded again, and the shared chunk is referenced again
+		if newChunk, found := newChunks[oldChunk.GetFileIdString()]; found && newChunk.Mtime != oldChunk.Mtime && f.isSharedDedupChunk(oldChunk.GetFileIdString()) {
 			toDelete = append(toDelete, oldChunk)
 		}
 	}
-	f.DeleteChunks(toDelete)
+	f.DeleteChunksNotRecursive(toDelete)
 }
@@ -0,0 +1,232 @@
+package filer
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// A logical volume is a directory under DirLogicalVolumesPath, provisioned with a capacity
+// and optionally placement attributes, e.g., as a persistent volume of a Kubernetes CSI driver.
+// The capacity is kept in the extended attributes of the directory entry.
+// The usage is counted from the metadata events of all filers, and writes are rejected once the usage reaches the capacity.
+// Since a file is counted after it is written, the writes in flight can exceed the capacity by their sizes.
+
+const LogicalVolumeCapacityKey = "seaweedfs.logical_volume.capacity"
+
+type LogicalVolumeName string
+type LogicalVolumeStat struct {
+	Capacity  uint64
+	UsedBytes uint64
+	FileCount uint64
+}
+type FilerLogicalVolumes struct {
+	volumes map[LogicalVolumeName]*LogicalVolumeStat
+	sync.RWMutex
+}
+
+func GetLogicalVolumeCapacity(entry *Entry) (capacity uint64, isLogicalVolume bool) {
+	data, found := entry.Extended[LogicalVolumeCapacityKey]
+	if !found || len(data) != 8 {
+		return 0, false
+	}
+	return util.BytesToUint64(data), true
+}
+
+func SetLogicalVolumeCapacity(entry *Entry, capacity uint64) {
+	if entry.Extended == nil {
+		entry.Extended = make(map[string][]byte)
+	}
+	data := make([]byte, 8)
+	util.Uint64toBytes(data, capacity)
+	entry.Extended[LogicalVolumeCapacityKey] = data
+}
+
+func (f *Filer) LogicalVolumePath(name string) util.FullPath {
+	return util.NewFullPath(f.DirLogicalVolumesPath, name)
+}
+
+// DetectLogicalVolume returns the logical volume containing the path, or "" if none
+func (f *Filer) DetectLogicalVolume(p util.FullPath) LogicalVolumeName {
+	if f.DirLogicalVolumesPath == "" || !strings.HasPrefix(string(p), f.DirLogicalVolumesPath+"/") {
+		return ""
+	}
+	name := string(p)[len(f.DirLogicalVolumesPath)+1:]
+	if t := strings.Index(name, "/"); t > 0 {
+		name = name[:t]
+	}
+	return LogicalVolumeName(name)
+}
+
+func (f *Filer) LoadLogicalVolumes() {
+
+	entries, _, err := f.ListDirectoryEntries(context.Background(), util.FullPath(f.DirLogicalVolumesPath), "", false, math.MaxInt32, "", "", "")
+	if err != nil {
+		glog.V(1).Infof("no logical volumes found: %v", err)
+		return
+	}
+
+	f.logicalVolumes.Lock()
+	for _, entry := range entries {
+		if capacity, isLogicalVolume := GetLogicalVolumeCapacity(entry); isLogicalVolume {
+			f.logicalVolumes.volumes[LogicalVolumeName(entry.Name())] = &LogicalVolumeStat{Capacity: capacity}
+		}
+	}
+	glog.V(1).Infof("logical volumes found: %d", len(f.logicalVolumes.volumes))
+	f.logicalVolumes.Unlock()
+
+}
+
+// SetLogicalVolumeStat records a created or expanded logical volume, keeping its collected usage
+func (f *Filer) SetLogicalVolumeStat(name LogicalVolumeName, capacity uint64) {
+	f.logicalVolumes.Lock()
+	defer f.logicalVolumes.Unlock()
+	if stat, found := f.logicalVolumes.volumes[name]; found {
+		stat.Capacity = capacity
+		return
+	}
+	f.logicalVolumes.volumes[name] = &LogicalVolumeStat{Capacity: capacity}
+}
+
+func (f *Filer) DeleteLogicalVolumeStat(name LogicalVolumeName) {
+	f.logicalVolumes.Lock()
+	defer f.logicalVolumes.Unlock()
+	delete(f.logicalVolumes.volumes, name)
+}
+
+func (f *Filer) GetLogicalVolumeStat(name LogicalVolumeName) (stat LogicalVolumeStat, found bool) {
+	f.logicalVolumes.RLock()
+	defer f.logicalVolumes.RUnlock()
+	if s, ok := f.logicalVolumes.volumes[name]; ok {
+		return *s, true
+	}
+	return
+}
+
+// ProvisionedLogicalVolumeCapacity is the sum of the capacities of all logical volumes
+func (f *Filer) ProvisionedLogicalVolumeCapacity() (capacity uint64) {
+	f.logicalVolumes.RLock()
+	defer f.logicalVolumes.RUnlock()
+	for _, stat := range f.logicalVolumes.volumes {
+		capacity += stat.Capacity
+	}
+	return
+}
+
+// IsLogicalVolumeFull checks whether the path is inside a logical volume which has used up its capacity
+func (f *Filer) IsLogicalVolumeFull(p util.FullPath) bool {
+	name := f.DetectLogicalVolume(p)
+	if name == "" {
+		return false
+	}
+	stat, found := f.GetLogicalVolumeStat(name)
+	return found && stat.UsedBytes >= stat.Capacity
+}
+
+// updateLogicalVolumeUsage counts the files changed by any filer into the usage of their logical volumes
+func (f *Filer) updateLogicalVolumeUsage(event *filer_pb.SubscribeMetadataResponse) {
+	if f.DirLogicalVolumesPath == "" {
+		return
+	}
+	message := event.EventNotification
+	if message.OldEntry != nil && !message.OldEntry.IsDirectory {
+		f.adjustLogicalVolumeUsage(FromPbEntry(event.Directory, message.OldEntry), false)
+	}
+	if message.NewEntry != nil && !message.NewEntry.IsDirectory {
+		f.adjustLogicalVolumeUsage(FromPbEntry(message.NewParentPath, message.NewEntry), true)
+	}
+}
+
+func (f *Filer) adjustLogicalVolumeUsage(entry *Entry, isAdded bool) {
+	name := f.DetectLogicalVolume(entry.FullPath)
+	if name == "" {
+		return
+	}
+	size := entry.Size()
+	f.logicalVolumes.Lock()
+	defer f.logicalVolumes.Unlock()
+	stat, found := f.logicalVolumes.volumes[name]
+	if !found {
+		return
+	}
+	if isAdded {
+		stat.UsedBytes += size
+		stat.FileCount++
+		return
+	}
+	// the usage could be collected after the file is removed
+	if stat.UsedBytes > size {
+		stat.UsedBytes -= size
+	} else {
+		stat.UsedBytes = 0
+	}
+	if stat.FileCount > 0 {
+		stat.FileCount--
+	}
+}
+
+// CollectLogicalVolumeUsage sums up the file sizes under the logical volume
+func (f *Filer) CollectLogicalVolumeUsage(ctx context.Context, name LogicalVolumeName) (usedBytes, fileCount uint64, err error) {
+	err = f.walkFiles(ctx, f.LogicalVolumePath(string(name)), func(entry *Entry) {
+		usedBytes += entry.Size()
+		fileCount++
+	})
+	return
+}
+
+func (f *Filer) walkFiles(ctx context.Context, dir util.FullPath, fn func(entry *Entry)) error {
+	lastFileName := ""
+	for {
+		entries, hasMore, err := f.ListDirectoryEntries(ctx, dir, lastFileName, false, PaginationSize, "", "", "")
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			lastFileName = entry.Name()
+			if entry.IsDirectory() {
+				if err = f.walkFiles(ctx, entry.FullPath, fn); err != nil {
+					return err
+				}
+				continue
+			}
+			fn(entry)
+		}
+		if !hasMore {
+			return nil
+		}
+	}
+}
+
+// LoopReconcileLogicalVolumeUsage collects the usage on start, and then re-collects it to correct any drift
+// of the counted usage, e.g., from the events missed while the usage is collected
+func (f *Filer) LoopReconcileLogicalVolumeUsage(interval time.Duration) {
+	for {
+		f.logicalVolumes.RLock()
+		var names []LogicalVolumeName
+		for name := range f.logicalVolumes.volumes {
+			names = append(names, name)
+		}
+		f.logicalVolumes.RUnlock()
+
+		for _, name := range names {
+			usedBytes, fileCount, err := f.CollectLogicalVolumeUsage(context.Background(), name)
+			if err != nil {
+				glog.V(0).Infof("collect logical volume %s usage: %v", name, err)
+				continue
+			}
+			f.logicalVolumes.Lock()
+			if stat, found := f.logicalVolumes.volumes[name]; found {
+				stat.UsedBytes, stat.FileCount = usedBytes, fileCount
+			}
+			f.logicalVolumes.Unlock()
+		}
+
+		time.Sleep(interval)
+	}
+}
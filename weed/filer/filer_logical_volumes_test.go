@@ -0,0 +1,110 @@
+package filer
+
+import (
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+func TestLogicalVolumeQuota(t *testing.T) {
+
+	f := &Filer{
+		DirLogicalVolumesPath: "/volumes",
+		logicalVolumes: &FilerLogicalVolumes{
+			volumes: make(map[LogicalVolumeName]*LogicalVolumeStat),
+		},
+	}
+
+	entry := &Entry{FullPath: f.LogicalVolumePath("pv1")}
+	if _, isLogicalVolume := GetLogicalVolumeCapacity(entry); isLogicalVolume {
+		t.Fatalf("a plain directory is not a logical volume")
+	}
+	SetLogicalVolumeCapacity(entry, 1024)
+	capacity, isLogicalVolume := GetLogicalVolumeCapacity(entry)
+	if !isLogicalVolume || capacity != 1024 {
+		t.Fatalf("capacity %d, expected 1024", capacity)
+	}
+	f.SetLogicalVolumeStat("pv1", capacity)
+
+	for path, expected := range map[string]LogicalVolumeName{
+		"/volumes/pv1":         "pv1",
+		"/volumes/pv1/a/b.txt": "pv1",
+		"/volumes":             "",
+		"/volumes2/pv1/a":      "",
+		"/buckets/pv1/a":       "",
+	} {
+		if name := f.DetectLogicalVolume(util.FullPath(path)); name != expected {
+			t.Errorf("%s is in logical volume %q, expected %q", path, name, expected)
+		}
+	}
+
+	if f.IsLogicalVolumeFull("/volumes/pv1/a") {
+		t.Errorf("an empty logical volume is full")
+	}
+	f.logicalVolumes.volumes["pv1"].UsedBytes = 1024
+	if !f.IsLogicalVolumeFull("/volumes/pv1/a") {
+		t.Errorf("a used up logical volume is not full")
+	}
+	f.SetLogicalVolumeStat("pv1", 2048)
+	if f.IsLogicalVolumeFull("/volumes/pv1/a") || f.ProvisionedLogicalVolumeCapacity() != 2048 {
+		t.Errorf("an expanded logical volume is full")
+	}
+	if f.IsLogicalVolumeFull("/volumes/pv2/a") {
+		t.Errorf("an unknown logical volume is full")
+	}
+}
+
+func TestLogicalVolumeUsageEvents(t *testing.T) {
+
+	f := &Filer{
+		DirLogicalVolumesPath: "/volumes",
+		logicalVolumes: &FilerLogicalVolumes{
+			volumes: make(map[LogicalVolumeName]*LogicalVolumeStat),
+		},
+	}
+	f.SetLogicalVolumeStat("pv1", 1024)
+
+	file := func(name string, size uint64) *filer_pb.Entry {
+		return &filer_pb.Entry{Name: name, Attributes: &filer_pb.FuseAttributes{FileSize: size}}
+	}
+	event := func(dir string, oldEntry, newEntry *filer_pb.Entry, newParentPath string) *filer_pb.SubscribeMetadataResponse {
+		return &filer_pb.SubscribeMetadataResponse{
+			Directory: dir,
+			EventNotification: &filer_pb.EventNotification{
+				OldEntry:      oldEntry,
+				NewEntry:      newEntry,
+				NewParentPath: newParentPath,
+			},
+		}
+	}
+	expect := func(step string, usedBytes, fileCount uint64) {
+		stat, _ := f.GetLogicalVolumeStat("pv1")
+		if stat.UsedBytes != usedBytes || stat.FileCount != fileCount {
+			t.Errorf("%s: used %d bytes by %d files, expected %d bytes by %d files", step, stat.UsedBytes, stat.FileCount, usedBytes, fileCount)
+		}
+	}
+
+	f.onLogicalVolumeEvents(event("/volumes/pv1/a", nil, file("x", 600), "/volumes/pv1/a"))
+	f.onLogicalVolumeEvents(event("/volumes/pv1", nil, &filer_pb.Entry{Name: "b", IsDirectory: true}, "/volumes/pv1"))
+	expect("create", 600, 1)
+	if f.IsLogicalVolumeFull("/volumes/pv1/a/y") {
+		t.Errorf("a partly used logical volume is full")
+	}
+
+	f.onLogicalVolumeEvents(event("/volumes/pv1/a", file("x", 600), file("x", 1100), "/volumes/pv1/a"))
+	expect("update", 1100, 1)
+	if !f.IsLogicalVolumeFull("/volumes/pv1/a/y") {
+		t.Errorf("a used up logical volume is not full")
+	}
+
+	f.onLogicalVolumeEvents(event("/volumes/pv1/a", file("x", 1100), file("x", 1100), "/volumes/pv1/b"))
+	expect("rename within the volume", 1100, 1)
+
+	f.onLogicalVolumeEvents(event("/volumes/pv1/b", file("x", 1100), file("x", 1100), "/buckets/b1"))
+	expect("rename out of the volume", 0, 0)
+
+	f.onLogicalVolumeEvents(event("/buckets/b1", file("x", 1100), nil, ""))
+	f.onLogicalVolumeEvents(event("/volumes/pv1/a", file("z", 100), nil, ""))
+	expect("delete", 0, 0)
+}
@@ -0,0 +1,228 @@
+package filer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// Mutation is one of the metadata changes applied together by ApplyMutations. Exactly one of
+// Create, Update and Delete is set.
+type Mutation struct {
+	// the entry to create, or to replace the existing one unless OExcl is set
+	Create *Entry
+	OExcl  bool
+	// the new content of the existing entry
+	Update *Entry
+	// the entry to delete, if it exists
+	Delete       util.FullPath
+	IsRecursive  bool
+	IsDeleteData bool
+}
+
+func (m *Mutation) fullPath() util.FullPath {
+	switch {
+	case m.Create != nil:
+		return m.Create.FullPath
+	case m.Update != nil:
+		return m.Update.FullPath
+	}
+	return m.Delete
+}
+
+// appliedMutation remembers the entry before the mutation, to compensate the mutation if a later one fails
+type appliedMutation struct {
+	*Mutation
+	previous *Entry
+}
+
+// ApplyMutations applies the mutations in order, all or none. If all the paths are in a transactional store,
+// the mutations are applied in one transaction, and their metadata events are only published after the commit.
+// Otherwise, the applied mutations are compensated in the reverse order if a later one fails, by restoring the
+// previous entries. The compensation is best effort: the parent
+// directories created on the way, and the children of the recursively deleted directories, are not restored.
+// The chunks no longer referenced are only deleted after all the mutations are applied.
+func (f *Filer) ApplyMutations(ctx context.Context, mutations []*Mutation, isFromOtherCluster bool, signatures []int32) (isTransactional bool, err error) {
+
+	var fullpaths []util.FullPath
+	for _, m := range mutations {
+		fullpaths = append(fullpaths, m.fullPath())
+	}
+	isTransactional = f.Store.IsTransactional(fullpaths)
+
+	var events *metaEvents
+	if isTransactional {
+		if ctx, err = f.BeginTransaction(ctx); err != nil {
+			return
+		}
+		ctx, events = withMetaEvents(ctx)
+	}
+
+	var applied []*appliedMutation
+	for i, m := range mutations {
+		var previous *Entry
+		if previous, err = f.applyMutation(ctx, m, isFromOtherCluster, signatures); err != nil {
+			err = fmt.Errorf("mutation %d on %s: %v", i, m.fullPath(), err)
+			break
+		}
+		applied = append(applied, &appliedMutation{Mutation: m, previous: previous})
+	}
+
+	if err == nil && isTransactional {
+		if err = f.CommitTransaction(ctx); err != nil {
+			err = fmt.Errorf("commit %d mutations: %v", len(mutations), err)
+		}
+	}
+	if err != nil {
+		glog.V(1).Infof("apply %d mutations: %v", len(mutations), err)
+		if isTransactional {
+			f.RollbackTransaction(ctx)
+		} else {
+			f.compensateMutations(ctx, applied, isFromOtherCluster, signatures)
+		}
+		return
+	}
+	if events != nil {
+		f.publishMetaEvents(ctx, events)
+	}
+
+	for _, a := range applied {
+		switch {
+		case a.Create != nil:
+			f.deleteChunksIfNotNew(a.previous, a.Create)
+		case a.Delete != "" && a.IsDeleteData && a.previous != nil && len(a.previous.HardLinkId) == 0:
+			f.DeleteChunks(a.previous.Chunks)
+		}
+	}
+	return
+}
+
+// EntryCreation is one of the entries created together by CreateEntries
+type EntryCreation struct {
+	Entry              *Entry
+	OExcl              bool
+	IsFromOtherCluster bool
+	Signatures         []int32
+}
+
+// CreateEntries creates the entries in one transaction. An entry failing to create does not fail the others,
+// and its error is returned in errs. If the transaction fails to begin or commit, err fails all the entries.
+// The chunks of the replaced entries are deleted, and the metadata events are published, only after the commit.
+func (f *Filer) CreateEntries(ctx context.Context, creations []*EntryCreation) (errs []error, err error) {
+
+	errs = make([]error, len(creations))
+	if ctx, err = f.BeginTransaction(ctx); err != nil {
+		return errs, fmt.Errorf("begin transaction: %v", err)
+	}
+	ctx, events := withMetaEvents(ctx)
+
+	oldEntries := make([]*Entry, len(creations))
+	for i, c := range creations {
+		oldEntries[i], errs[i] = f.createEntry(ctx, c.Entry, c.OExcl, c.IsFromOtherCluster, c.Signatures)
+	}
+
+	if err = f.CommitTransaction(ctx); err != nil {
+		f.RollbackTransaction(ctx)
+		return errs, fmt.Errorf("commit %d entries: %v", len(creations), err)
+	}
+	f.publishMetaEvents(ctx, events)
+
+	for i, c := range creations {
+		if errs[i] == nil {
+			f.deleteChunksIfNotNew(oldEntries[i], c.Entry)
+		}
+	}
+	return errs, nil
+}
+
+// metaEvents holds the metadata events of a transaction, to publish them only after the transaction is committed
+type metaEvents struct {
+	events []*metaEvent
+}
+
+type metaEvent struct {
+	fullpath          string
+	eventNotification *filer_pb.EventNotification
+}
+
+type metaEventsKey struct{}
+
+func withMetaEvents(ctx context.Context) (context.Context, *metaEvents) {
+	events := &metaEvents{}
+	return context.WithValue(ctx, metaEventsKey{}, events), events
+}
+
+// bufferMetaEvent holds the event if the context is in a transaction
+func bufferMetaEvent(ctx context.Context, fullpath string, eventNotification *filer_pb.EventNotification) bool {
+	events, found := ctx.Value(metaEventsKey{}).(*metaEvents)
+	if !found {
+		return false
+	}
+	events.events = append(events.events, &metaEvent{fullpath: fullpath, eventNotification: eventNotification})
+	return true
+}
+
+func (f *Filer) publishMetaEvents(ctx context.Context, events *metaEvents) {
+	ctx = context.WithValue(ctx, metaEventsKey{}, nil)
+	for _, e := range events.events {
+		f.logMetaEvent(ctx, e.fullpath, e.eventNotification)
+	}
+}
+
+// applyMutation applies the mutation, and returns the entry before the mutation, or nil if it did not exist
+func (f *Filer) applyMutation(ctx context.Context, m *Mutation, isFromOtherCluster bool, signatures []int32) (previous *Entry, err error) {
+
+	previous, err = f.FindEntry(ctx, m.fullPath())
+	if err == filer_pb.ErrNotFound {
+		previous, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case m.Create != nil:
+		_, err = f.createEntry(ctx, m.Create, m.OExcl, isFromOtherCluster, signatures)
+	case m.Update != nil:
+		if previous == nil {
+			return nil, filer_pb.ErrNotFound
+		}
+		if err = f.UpdateEntry(ctx, previous, m.Update); err == nil {
+			f.NotifyUpdateEvent(ctx, previous, m.Update, true, isFromOtherCluster, signatures)
+		}
+	default:
+		if previous == nil {
+			return nil, nil
+		}
+		// the chunks of the children, or the collection of the bucket, can not be restored if a later mutation fails
+		if previous.IsDirectory() && m.IsDeleteData {
+			return nil, fmt.Errorf("deleting the data of directory %s is not supported", m.Delete)
+		}
+		if f.isBucket(previous) {
+			return nil, fmt.Errorf("deleting bucket %s is not supported", m.Delete)
+		}
+		err = f.DeleteEntryMetaAndData(ctx, m.Delete, m.IsRecursive, false, false, isFromOtherCluster, signatures)
+	}
+	return previous, err
+}
+
+func (f *Filer) compensateMutations(ctx context.Context, applied []*appliedMutation, isFromOtherCluster bool, signatures []int32) {
+	for i := len(applied) - 1; i >= 0; i-- {
+		a := applied[i]
+		var err error
+		if a.previous == nil {
+			err = f.DeleteEntryMetaAndData(ctx, a.fullPath(), false, false, false, isFromOtherCluster, signatures)
+			if err == filer_pb.ErrNotFound {
+				err = nil
+			}
+		} else {
+			_, err = f.createEntry(ctx, a.previous, false, isFromOtherCluster, signatures)
+		}
+		if err != nil {
+			glog.Errorf("compensate the mutation on %s: %v", a.fullPath(), err)
+		}
+	}
+}
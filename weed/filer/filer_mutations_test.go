@@ -0,0 +1,202 @@
+package filer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/log_buffer"
+	"github.com/chrislusf/seaweedfs/weed/wdclient"
+)
+
+// txStore keeps the entries in memory, and the writes in a transaction are only visible after the commit
+type txStore struct {
+	FilerStore
+	entries   map[util.FullPath]*Entry
+	pending   map[util.FullPath]*Entry
+	commitErr error
+}
+
+func newTxStore() *txStore {
+	return &txStore{entries: make(map[util.FullPath]*Entry)}
+}
+
+func (s *txStore) GetName() string       { return "tx" }
+func (s *txStore) IsTransactional() bool { return true }
+
+func (s *txStore) InsertEntry(ctx context.Context, entry *Entry) error {
+	if s.pending != nil {
+		s.pending[entry.FullPath] = entry
+		return nil
+	}
+	s.entries[entry.FullPath] = entry
+	return nil
+}
+
+func (s *txStore) UpdateEntry(ctx context.Context, entry *Entry) error {
+	return s.InsertEntry(ctx, entry)
+}
+
+func (s *txStore) FindEntry(ctx context.Context, fp util.FullPath) (*Entry, error) {
+	if entry, found := s.pending[fp]; found {
+		return entry, nil
+	}
+	if entry, found := s.entries[fp]; found {
+		return entry, nil
+	}
+	return nil, filer_pb.ErrNotFound
+}
+
+func (s *txStore) BeginTransaction(ctx context.Context) (context.Context, error) {
+	s.pending = make(map[util.FullPath]*Entry)
+	return ctx, nil
+}
+
+func (s *txStore) CommitTransaction(ctx context.Context) error {
+	if s.commitErr != nil {
+		return s.commitErr
+	}
+	for fp, entry := range s.pending {
+		s.entries[fp] = entry
+	}
+	s.pending = nil
+	return nil
+}
+
+func (s *txStore) RollbackTransaction(ctx context.Context) error {
+	s.pending = nil
+	return nil
+}
+
+func (s *txStore) KvGet(ctx context.Context, key []byte) ([]byte, error) {
+	return nil, ErrKvNotFound
+}
+
+func (s *txStore) KvPut(ctx context.Context, key []byte, value []byte) error {
+	return nil
+}
+
+// newTestFiler does not start deleting the chunks in the background, to check the deletion queue
+func newTestFiler(store FilerStore) *Filer {
+	f := &Filer{
+		MasterClient:        wdclient.NewMasterClient(nil, "filer", "", 0, "", nil),
+		fileIdDeletionQueue: util.NewUnboundedQueue(),
+		FilerConf:           NewFilerConf(),
+		logicalVolumes: &FilerLogicalVolumes{
+			volumes: make(map[LogicalVolumeName]*LogicalVolumeStat),
+		},
+		storeSettings: make(map[string]storeSettings),
+	}
+	f.LocalMetaLogBuffer = log_buffer.NewLogBuffer("local", LogFlushInterval, f.logFlushFunc, nil)
+	f.SetStore(store)
+	return f
+}
+
+func deletedFileIds(f *Filer) (fileIds []string) {
+	f.fileIdDeletionQueue.Consume(func(ids []string) {
+		fileIds = append(fileIds, ids...)
+	})
+	return
+}
+
+func hasMetaEvents(f *Filer) bool {
+	buf, _ := f.LocalMetaLogBuffer.ReadFromBuffer(time.Unix(0, 0))
+	return buf != nil && buf.Len() > 0
+}
+
+func newFileEntry(fullpath string, fileId string) *Entry {
+	return &Entry{
+		FullPath: util.FullPath(fullpath),
+		Attr:     Attr{Mode: 0644},
+		Chunks:   []*filer_pb.FileChunk{{FileId: fileId, Size: 1, Mtime: 1}},
+	}
+}
+
+func TestCreateEntries(t *testing.T) {
+	store := newTxStore()
+	f := newTestFiler(store)
+	ctx := context.Background()
+	store.entries["/dir"] = &Entry{FullPath: "/dir", Attr: Attr{Mode: os.ModeDir | 0755}}
+	store.entries["/dir/old"] = newFileEntry("/dir/old", "1,01")
+
+	errs, err := f.CreateEntries(ctx, []*EntryCreation{
+		{Entry: newFileEntry("/dir/a", "1,02")},
+		{Entry: newFileEntry("/dir/old", "1,03")},
+	})
+	if err != nil || errs[0] != nil || errs[1] != nil {
+		t.Fatalf("create entries: %v %v", errs, err)
+	}
+	if entry := store.entries["/dir/old"]; entry == nil || entry.Chunks[0].FileId != "1,03" {
+		t.Errorf("replaced entry: %+v", entry)
+	}
+	if _, found := store.entries["/dir/a"]; !found {
+		t.Errorf("created entry not found")
+	}
+	if deleted := deletedFileIds(f); len(deleted) != 1 || deleted[0] != "1,01" {
+		t.Errorf("deleted %v, expected the chunk of the replaced entry", deleted)
+	}
+	if !hasMetaEvents(f) {
+		t.Errorf("no events after the commit")
+	}
+}
+
+func TestCreateEntriesPartialFailure(t *testing.T) {
+	store := newTxStore()
+	f := newTestFiler(store)
+	ctx := context.Background()
+	store.entries["/dir"] = &Entry{FullPath: "/dir", Attr: Attr{Mode: os.ModeDir | 0755}}
+	store.entries["/dir/old"] = newFileEntry("/dir/old", "1,01")
+
+	// the entry failing to create does not fail the others
+	errs, err := f.CreateEntries(ctx, []*EntryCreation{
+		{Entry: newFileEntry("/dir/a", "1,02")},
+		{Entry: newFileEntry("/dir/old", "1,03"), OExcl: true},
+		{Entry: newFileEntry("/dir/b", "1,04")},
+	})
+	if err != nil || errs[0] != nil || errs[1] == nil || errs[2] != nil {
+		t.Fatalf("create entries: %v %v", errs, err)
+	}
+	if entry := store.entries["/dir/old"]; entry.Chunks[0].FileId != "1,01" {
+		t.Errorf("existing entry replaced: %+v", entry)
+	}
+	if _, found := store.entries["/dir/b"]; !found {
+		t.Errorf("entry after the failed one not found")
+	}
+	if deleted := deletedFileIds(f); len(deleted) != 0 {
+		t.Errorf("deleted %v", deleted)
+	}
+}
+
+func TestCreateEntriesRollback(t *testing.T) {
+	store := newTxStore()
+	f := newTestFiler(store)
+	ctx := context.Background()
+	store.entries["/dir"] = &Entry{FullPath: "/dir", Attr: Attr{Mode: os.ModeDir | 0755}}
+	store.entries["/dir/old"] = newFileEntry("/dir/old", "1,01")
+	store.commitErr = errors.New("serialization failure")
+
+	// nothing is changed if the commit fails
+	_, err := f.CreateEntries(ctx, []*EntryCreation{
+		{Entry: newFileEntry("/dir/a", "1,02")},
+		{Entry: newFileEntry("/dir/old", "1,03")},
+	})
+	if err == nil {
+		t.Fatalf("commit error not returned")
+	}
+	if entry := store.entries["/dir/old"]; entry.Chunks[0].FileId != "1,01" {
+		t.Errorf("entry replaced after the rollback: %+v", entry)
+	}
+	if _, found := store.entries["/dir/a"]; found {
+		t.Errorf("entry created after the rollback")
+	}
+	if deleted := deletedFileIds(f); len(deleted) != 0 {
+		t.Errorf("deleted %v after the rollback", deleted)
+	}
+	if hasMetaEvents(f) {
+		t.Errorf("events published after the rollback")
+	}
+}
@@ -10,7 +10,6 @@ import (
 	"github.com/golang/protobuf/proto"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
-	"github.com/chrislusf/seaweedfs/weed/notification"
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 	"github.com/chrislusf/seaweedfs/weed/util"
 )
@@ -53,20 +52,17 @@ func (f *Filer) NotifyUpdateEvent(ctx context.Context, oldEntry, newEntry *Entry
 		Signatures:         signatures,
 	}
 
-	if notification.Queue != nil {
-		glog.V(3).Infof("notifying entry update %v", fullpath)
-		if err := notification.Queue.SendMessage(fullpath, eventNotification); err != nil {
-			// throw message
-			glog.Error(err)
-		}
-	}
-
+	// the filer server sends the logged events to the notification message queue
 	f.logMetaEvent(ctx, fullpath, eventNotification)
 
 }
 
 func (f *Filer) logMetaEvent(ctx context.Context, fullpath string, eventNotification *filer_pb.EventNotification) {
 
+	if bufferMetaEvent(ctx, fullpath, eventNotification) {
+		return
+	}
+
 	dir, _ := util.FullPath(fullpath).DirAndName()
 
 	event := &filer_pb.SubscribeMetadataResponse{
@@ -34,7 +34,8 @@ func (f *Filer) appendToFile(targetFile string, data []byte) error {
 			},
 		}
 	} else {
-		offset = int64(TotalSize(entry.Chunks))
+		// the file size includes the trailing holes not stored as chunks
+		offset = int64(entry.Size())
 	}
 
 	// append to existing chunks
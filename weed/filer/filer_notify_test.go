@@ -1,6 +1,7 @@
 package filer
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -51,3 +52,22 @@ func TestProtoMarshalText(t *testing.T) {
 	println(text)
 
 }
+
+func TestMetaEventsPublishedAfterCommit(t *testing.T) {
+	f := NewFiler(nil, nil, "", 0, "", "", "", nil)
+	entry := &Entry{FullPath: util.FullPath("/dir/file"), Attr: Attr{Mode: 0644}}
+
+	ctx, events := withMetaEvents(context.Background())
+	f.NotifyUpdateEvent(ctx, nil, entry, false, false, nil)
+	if len(events.events) != 1 {
+		t.Fatalf("buffered %d events, expected 1", len(events.events))
+	}
+	if buf, _ := f.LocalMetaLogBuffer.ReadFromBuffer(time.Unix(0, 0)); buf != nil && buf.Len() > 0 {
+		t.Fatalf("event published before the commit")
+	}
+
+	f.publishMetaEvents(ctx, events)
+	if buf, _ := f.LocalMetaLogBuffer.ReadFromBuffer(time.Unix(0, 0)); buf == nil || buf.Len() == 0 {
+		t.Errorf("event not published after the commit")
+	}
+}
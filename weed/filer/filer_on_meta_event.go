@@ -11,8 +11,10 @@ import (
 
 // onMetadataChangeEvent is triggered after filer processed change events from local or remote filers
 func (f *Filer) onMetadataChangeEvent(event *filer_pb.SubscribeMetadataResponse) {
+	f.Store.InvalidateMetaCache(event)
 	f.maybeReloadFilerConfiguration(event)
 	f.onBucketEvents(event)
+	f.onLogicalVolumeEvents(event)
 }
 
 func (f *Filer) onBucketEvents(event *filer_pb.SubscribeMetadataResponse) {
@@ -32,6 +34,23 @@ func (f *Filer) onBucketEvents(event *filer_pb.SubscribeMetadataResponse) {
 	}
 }
 
+// onLogicalVolumeEvents keeps track of the logical volumes created, expanded, or deleted by any filer
+func (f *Filer) onLogicalVolumeEvents(event *filer_pb.SubscribeMetadataResponse) {
+	f.updateLogicalVolumeUsage(event)
+	if f.DirLogicalVolumesPath != event.Directory {
+		return
+	}
+	message := event.EventNotification
+	if message.OldEntry != nil && (message.NewEntry == nil || message.NewParentPath != event.Directory || message.NewEntry.Name != message.OldEntry.Name) {
+		f.DeleteLogicalVolumeStat(LogicalVolumeName(message.OldEntry.Name))
+	}
+	if message.NewEntry != nil && message.NewParentPath == event.Directory {
+		if capacity, isLogicalVolume := GetLogicalVolumeCapacity(FromPbEntry(event.Directory, message.NewEntry)); isLogicalVolume {
+			f.SetLogicalVolumeStat(LogicalVolumeName(message.NewEntry.Name), capacity)
+		}
+	}
+}
+
 func (f *Filer) maybeReloadFilerConfiguration(event *filer_pb.SubscribeMetadataResponse) {
 	if DirectoryEtcSeaweedFS != event.Directory {
 		if DirectoryEtcSeaweedFS != event.EventNotification.NewParentPath {
@@ -0,0 +1,45 @@
+package filer
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCreateEntryInode(t *testing.T) {
+	store := newTxStore()
+	f := newTestFiler(store)
+	ctx := context.Background()
+
+	if err := f.CreateEntry(ctx, newFileEntry("/dir/a", "1,01"), false, false, nil); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	a := store.entries["/dir/a"].Attr.Inode
+	if a <= 1 || store.entries["/dir"].Attr.Inode <= 1 {
+		t.Fatalf("inodes not assigned: %d %d", a, store.entries["/dir"].Attr.Inode)
+	}
+
+	// renamed to b, and a new a is created
+	renamed := newFileEntry("/dir/b", "1,01")
+	renamed.Attr.Inode = a
+	if err := f.CreateEntry(ctx, renamed, false, false, nil); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	delete(store.entries, "/dir/a")
+	if err := f.CreateEntry(ctx, newFileEntry("/dir/a", "1,02"), false, false, nil); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if store.entries["/dir/b"].Attr.Inode != a {
+		t.Errorf("renamed inode %d, expected %d", store.entries["/dir/b"].Attr.Inode, a)
+	}
+	if store.entries["/dir/a"].Attr.Inode == a {
+		t.Errorf("new entry reuses the inode %d of the renamed entry", a)
+	}
+
+	// the updates without the inode keep the existing one
+	if err := f.CreateEntry(ctx, newFileEntry("/dir/b", "1,03"), false, false, nil); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if store.entries["/dir/b"].Attr.Inode != a {
+		t.Errorf("updated inode %d, expected %d", store.entries["/dir/b"].Attr.Inode, a)
+	}
+}
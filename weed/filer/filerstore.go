@@ -45,3 +45,8 @@ type BucketAware interface {
 	OnBucketDeletion(bucket string)
 	CanDropWholeBucket() bool
 }
+
+// TransactionalStore is implemented by the stores whose transactions are rolled back, instead of being no-ops
+type TransactionalStore interface {
+	IsTransactional() bool
+}
@@ -0,0 +1,321 @@
+package filer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+var (
+	ErrFilerStoreUnavailable = errors.New("filer store unavailable")
+)
+
+// IsFilerStoreUnavailable checks whether the error is from a filer store timing out, or rejected by its circuit breaker
+func IsFilerStoreUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	return err == ErrFilerStoreUnavailable || err == context.DeadlineExceeded ||
+		strings.Contains(err.Error(), ErrFilerStoreUnavailable.Error()) ||
+		strings.Contains(err.Error(), context.DeadlineExceeded.Error())
+}
+
+type StoreBreakerOption struct {
+	// each store call is cancelled after the timeout, 0 to disable
+	Timeout time.Duration
+	// the breaker opens after this many consecutive failures, 0 to disable
+	FailureThreshold int
+	// the store calls are rejected for this long after the breaker opens,
+	// and then one call is tried to decide whether to close the breaker
+	OpenDuration time.Duration
+}
+
+func (option StoreBreakerOption) IsEnabled() bool {
+	return option.Timeout > 0 || option.FailureThreshold > 0
+}
+
+// FilerStoreBreaker guards a filer store with a timeout on each call, and a circuit breaker.
+// If the store hangs or keeps failing, the calls fail fast instead of piling up.
+type FilerStoreBreaker struct {
+	actualStore FilerStore
+	option      StoreBreakerOption
+
+	lock           sync.Mutex
+	failures       int
+	openUntil      time.Time
+	isTrialRunning bool
+}
+
+func NewFilerStoreBreaker(store FilerStore, option StoreBreakerOption) *FilerStoreBreaker {
+	return &FilerStoreBreaker{
+		actualStore: store,
+		option:      option,
+	}
+}
+
+// allow checks the breaker before a store call.
+// When the breaker has been open long enough, only one trial call is allowed.
+func (b *FilerStoreBreaker) allow() (isTrial bool, err error) {
+	if b.option.FailureThreshold <= 0 {
+		return false, nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.failures < b.option.FailureThreshold {
+		return false, nil
+	}
+	if time.Now().Before(b.openUntil) || b.isTrialRunning {
+		return false, ErrFilerStoreUnavailable
+	}
+	b.isTrialRunning = true
+	return true, nil
+}
+
+func (b *FilerStoreBreaker) done(isTrial bool, err error) {
+	if b.option.FailureThreshold <= 0 {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if isTrial {
+		b.isTrialRunning = false
+	}
+	if !isStoreFailure(err) {
+		if b.failures >= b.option.FailureThreshold {
+			glog.V(0).Infof("filer store %s circuit breaker closed", b.actualStore.GetName())
+		}
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.option.FailureThreshold {
+		if isTrial || b.failures == b.option.FailureThreshold {
+			glog.Errorf("filer store %s circuit breaker opened for %v after %d failures: %v", b.actualStore.GetName(), b.option.OpenDuration, b.failures, err)
+			stats.FilerStoreCounter.WithLabelValues(b.actualStore.GetName(), "breakerOpen").Inc()
+		}
+		b.openUntil = time.Now().Add(b.option.OpenDuration)
+	}
+}
+
+// Statistics reports whether the breaker is open, i.e., the store calls are being rejected
+func (b *FilerStoreBreaker) Statistics() *StoreBreakerStatistics {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return &StoreBreakerStatistics{
+		IsOpen:              b.option.FailureThreshold > 0 && b.failures >= b.option.FailureThreshold,
+		ConsecutiveFailures: int64(b.failures),
+	}
+}
+
+// release ends the call without counting it as a success or a failure, e.g., cancelled by the caller
+func (b *FilerStoreBreaker) release(isTrial bool) {
+	if b.option.FailureThreshold <= 0 || !isTrial {
+		return
+	}
+	b.lock.Lock()
+	b.isTrialRunning = false
+	b.lock.Unlock()
+}
+
+// isStoreFailure tells the store errors from the expected results, e.g., not found
+func isStoreFailure(err error) bool {
+	for _, expected := range []error{filer_pb.ErrNotFound, ErrKvNotFound, ErrKvNotImplemented,
+		ErrUnsupportedListDirectoryPrefixed, ErrUnsupportedSuperLargeDirectoryListing, context.Canceled} {
+		if errors.Is(err, expected) {
+			return false
+		}
+	}
+	return err != nil
+}
+
+// callTimer cancels a store call after the timeout, not counting the time spent in the callbacks of listing
+type callTimer struct {
+	timer     *time.Timer
+	remaining time.Duration
+	startTime time.Time
+	timedOut  int32
+}
+
+// excluding stops the timer while running the callback
+func (t *callTimer) excluding(fn func() bool) bool {
+	if t == nil || !t.timer.Stop() {
+		return fn()
+	}
+	t.remaining -= time.Since(t.startTime)
+	defer func() {
+		t.startTime = time.Now()
+		t.timer.Reset(t.remaining)
+	}()
+	return fn()
+}
+
+func (b *FilerStoreBreaker) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	return b.callListing(ctx, func(ctx context.Context, timer *callTimer) error {
+		return fn(ctx)
+	})
+}
+
+func (b *FilerStoreBreaker) callListing(ctx context.Context, fn func(ctx context.Context, timer *callTimer) error) error {
+	isTrial, err := b.allow()
+	if err != nil {
+		return err
+	}
+	callCtx := ctx
+	var timer *callTimer
+	if b.option.Timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		timer = &callTimer{remaining: b.option.Timeout, startTime: time.Now()}
+		timer.timer = time.AfterFunc(b.option.Timeout, func() {
+			atomic.StoreInt32(&timer.timedOut, 1)
+			cancel()
+		})
+		defer timer.timer.Stop()
+	}
+	err = fn(callCtx, timer)
+	if err != nil && timer != nil && atomic.LoadInt32(&timer.timedOut) == 1 {
+		err = fmt.Errorf("%v after %v: %v", ErrFilerStoreUnavailable, b.option.Timeout, err)
+	} else if err != nil && ctx.Err() != nil {
+		// cancelled, or timed out, by the caller
+		b.release(isTrial)
+		return err
+	}
+	b.done(isTrial, err)
+	return err
+}
+
+func (b *FilerStoreBreaker) GetName() string {
+	return b.actualStore.GetName()
+}
+
+func (b *FilerStoreBreaker) Initialize(configuration util.Configuration, prefix string) error {
+	return b.actualStore.Initialize(configuration, prefix)
+}
+
+func (b *FilerStoreBreaker) InsertEntry(ctx context.Context, entry *Entry) error {
+	return b.call(ctx, func(ctx context.Context) error {
+		return b.actualStore.InsertEntry(ctx, entry)
+	})
+}
+
+func (b *FilerStoreBreaker) UpdateEntry(ctx context.Context, entry *Entry) error {
+	return b.call(ctx, func(ctx context.Context) error {
+		return b.actualStore.UpdateEntry(ctx, entry)
+	})
+}
+
+func (b *FilerStoreBreaker) FindEntry(ctx context.Context, fp util.FullPath) (entry *Entry, err error) {
+	err = b.call(ctx, func(ctx context.Context) (findErr error) {
+		entry, findErr = b.actualStore.FindEntry(ctx, fp)
+		return
+	})
+	return
+}
+
+func (b *FilerStoreBreaker) DeleteEntry(ctx context.Context, fp util.FullPath) error {
+	return b.call(ctx, func(ctx context.Context) error {
+		return b.actualStore.DeleteEntry(ctx, fp)
+	})
+}
+
+func (b *FilerStoreBreaker) DeleteFolderChildren(ctx context.Context, fp util.FullPath) error {
+	return b.call(ctx, func(ctx context.Context) error {
+		return b.actualStore.DeleteFolderChildren(ctx, fp)
+	})
+}
+
+func (b *FilerStoreBreaker) ListDirectoryEntries(ctx context.Context, dirPath util.FullPath, startFileName string, includeStartFile bool, limit int64, eachEntryFunc ListEachEntryFunc) (lastFileName string, err error) {
+	err = b.callListing(ctx, func(ctx context.Context, timer *callTimer) (listErr error) {
+		lastFileName, listErr = b.actualStore.ListDirectoryEntries(ctx, dirPath, startFileName, includeStartFile, limit, func(entry *Entry) bool {
+			return timer.excluding(func() bool {
+				return eachEntryFunc(entry)
+			})
+		})
+		return
+	})
+	return
+}
+
+func (b *FilerStoreBreaker) ListDirectoryPrefixedEntries(ctx context.Context, dirPath util.FullPath, startFileName string, includeStartFile bool, limit int64, prefix string, eachEntryFunc ListEachEntryFunc) (lastFileName string, err error) {
+	err = b.callListing(ctx, func(ctx context.Context, timer *callTimer) (listErr error) {
+		lastFileName, listErr = b.actualStore.ListDirectoryPrefixedEntries(ctx, dirPath, startFileName, includeStartFile, limit, prefix, func(entry *Entry) bool {
+			return timer.excluding(func() bool {
+				return eachEntryFunc(entry)
+			})
+		})
+		return
+	})
+	return
+}
+
+// BeginTransaction is not limited by the timeout, which would roll back the transaction once the call returns
+func (b *FilerStoreBreaker) BeginTransaction(ctx context.Context) (context.Context, error) {
+	isTrial, err := b.allow()
+	if err != nil {
+		return ctx, err
+	}
+	ctx, err = b.actualStore.BeginTransaction(ctx)
+	b.done(isTrial, err)
+	return ctx, err
+}
+
+func (b *FilerStoreBreaker) CommitTransaction(ctx context.Context) error {
+	return b.actualStore.CommitTransaction(ctx)
+}
+
+func (b *FilerStoreBreaker) RollbackTransaction(ctx context.Context) error {
+	return b.actualStore.RollbackTransaction(ctx)
+}
+
+func (b *FilerStoreBreaker) KvPut(ctx context.Context, key []byte, value []byte) error {
+	return b.call(ctx, func(ctx context.Context) error {
+		return b.actualStore.KvPut(ctx, key, value)
+	})
+}
+
+func (b *FilerStoreBreaker) KvGet(ctx context.Context, key []byte) (value []byte, err error) {
+	err = b.call(ctx, func(ctx context.Context) (getErr error) {
+		value, getErr = b.actualStore.KvGet(ctx, key)
+		return
+	})
+	return
+}
+
+func (b *FilerStoreBreaker) KvDelete(ctx context.Context, key []byte) error {
+	return b.call(ctx, func(ctx context.Context) error {
+		return b.actualStore.KvDelete(ctx, key)
+	})
+}
+
+func (b *FilerStoreBreaker) Shutdown() {
+	b.actualStore.Shutdown()
+}
+
+func (b *FilerStoreBreaker) OnBucketCreation(bucket string) {
+	if ba, ok := b.actualStore.(BucketAware); ok {
+		ba.OnBucketCreation(bucket)
+	}
+}
+
+func (b *FilerStoreBreaker) OnBucketDeletion(bucket string) {
+	if ba, ok := b.actualStore.(BucketAware); ok {
+		ba.OnBucketDeletion(bucket)
+	}
+}
+
+func (b *FilerStoreBreaker) CanDropWholeBucket() bool {
+	if ba, ok := b.actualStore.(BucketAware); ok {
+		return ba.CanDropWholeBucket()
+	}
+	return false
+}
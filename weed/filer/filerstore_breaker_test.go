@@ -0,0 +1,133 @@
+package filer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// hangingStore hangs until the context is done, or returns the configured error
+type hangingStore struct {
+	FilerStore
+	isHanging bool
+	err       error
+	calls     int
+}
+
+func (s *hangingStore) GetName() string {
+	return "hanging"
+}
+
+func (s *hangingStore) FindEntry(ctx context.Context, fp util.FullPath) (*Entry, error) {
+	s.calls++
+	if s.isHanging {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &Entry{FullPath: fp}, nil
+}
+
+func (s *hangingStore) ListDirectoryEntries(ctx context.Context, dirPath util.FullPath, startFileName string, includeStartFile bool, limit int64, eachEntryFunc ListEachEntryFunc) (string, error) {
+	s.calls++
+	for i := int64(0); i < limit; i++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if !eachEntryFunc(&Entry{FullPath: dirPath.Child("f")}) {
+			break
+		}
+	}
+	return "f", nil
+}
+
+func TestFilerStoreBreaker(t *testing.T) {
+
+	store := &hangingStore{isHanging: true}
+	breaker := NewFilerStoreBreaker(store, StoreBreakerOption{
+		Timeout:          10 * time.Millisecond,
+		FailureThreshold: 2,
+		OpenDuration:     50 * time.Millisecond,
+	})
+	ctx := context.Background()
+
+	// the hanging calls time out, and then open the breaker
+	for i := 0; i < 2; i++ {
+		if _, err := breaker.FindEntry(ctx, "/a"); !IsFilerStoreUnavailable(err) {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	start := time.Now()
+	if _, err := breaker.FindEntry(ctx, "/a"); err != ErrFilerStoreUnavailable || store.calls != 2 || time.Since(start) > 5*time.Millisecond {
+		t.Fatalf("open breaker: %v, %d calls", err, store.calls)
+	}
+
+	// a failed trial keeps the breaker open
+	time.Sleep(60 * time.Millisecond)
+	store.isHanging, store.err = false, errors.New("connection refused")
+	if _, err := breaker.FindEntry(ctx, "/a"); err == nil || store.calls != 3 {
+		t.Fatalf("failed trial: %v, %d calls", err, store.calls)
+	}
+	if _, err := breaker.FindEntry(ctx, "/a"); err != ErrFilerStoreUnavailable || store.calls != 3 {
+		t.Fatalf("reopened breaker: %v, %d calls", err, store.calls)
+	}
+
+	// a successful trial closes the breaker, and not found is not a failure
+	time.Sleep(60 * time.Millisecond)
+	store.err = nil
+	if _, err := breaker.FindEntry(ctx, "/a"); err != nil {
+		t.Fatalf("successful trial: %v", err)
+	}
+	store.err = filer_pb.ErrNotFound
+	for i := 0; i < 3; i++ {
+		if _, err := breaker.FindEntry(ctx, "/a"); err != filer_pb.ErrNotFound {
+			t.Fatalf("not found %d: %v", i, err)
+		}
+	}
+	if store.calls != 7 {
+		t.Errorf("closed breaker: %d calls, expected 7", store.calls)
+	}
+}
+
+func TestFilerStoreBreakerExcludesCallers(t *testing.T) {
+
+	store := &hangingStore{isHanging: true}
+	breaker := NewFilerStoreBreaker(store, StoreBreakerOption{
+		Timeout:          10 * time.Millisecond,
+		FailureThreshold: 1,
+		OpenDuration:     time.Minute,
+	})
+
+	// the slow callbacks of the listing are not limited by the timeout
+	count := 0
+	if _, err := breaker.ListDirectoryEntries(context.Background(), "/dir", "", false, 3, func(entry *Entry) bool {
+		count++
+		time.Sleep(15 * time.Millisecond)
+		return true
+	}); err != nil || count != 3 {
+		t.Fatalf("slow listing: %v, %d entries", err, count)
+	}
+
+	// the calls cancelled by the callers are not failures
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 2; i++ {
+		if _, err := breaker.FindEntry(ctx, "/a"); err != context.Canceled {
+			t.Fatalf("cancelled call %d: %v", i, err)
+		}
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := breaker.FindEntry(ctx, "/a"); err != context.DeadlineExceeded {
+		t.Fatalf("call timed out by the caller: %v", err)
+	}
+	if stats := breaker.Statistics(); stats.IsOpen || stats.ConsecutiveFailures != 0 {
+		t.Errorf("breaker after the cancelled calls: %+v", stats)
+	}
+}
@@ -0,0 +1,212 @@
+package filer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karlseguin/ccache/v2"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+const (
+	// the cached metadata is also dropped after a while, in case an invalidation is missed
+	metaCacheTtl = 10 * time.Minute
+
+	metaCacheEntryPrefix   = "e:"
+	metaCacheListingPrefix = "l:"
+)
+
+// storeMetaCache keeps the recently read entries and directory listings in memory, for slow filer stores.
+// The cached items of a directory share the directory as the primary key.
+// The cache is invalidated when entries are changed through this filer,
+// and by the metadata change events from the other filers sharing the same filer store.
+type storeMetaCache struct {
+	cache *ccache.LayeredCache
+
+	// invalidations are counted, so that a value read before an invalidation is not cached after it
+	versionLock sync.Mutex
+	version     int64
+}
+
+// cachedEntry is an encoded entry, or nil data if the entry is not found
+type cachedEntry struct {
+	data []byte
+}
+
+type cachedListing struct {
+	entries      []*cachedListingEntry
+	lastFileName string
+}
+
+type cachedListingEntry struct {
+	name string
+	data []byte
+}
+
+// Size counts a listing by its entries towards the cache capacity
+func (l *cachedListing) Size() int64 {
+	return int64(len(l.entries)) + 1
+}
+
+func newStoreMetaCache(maxEntries int64) *storeMetaCache {
+	pruneCount := maxEntries >> 3
+	if pruneCount <= 0 {
+		pruneCount = 500
+	}
+	return &storeMetaCache{
+		cache: ccache.Layered(ccache.Configure().MaxSize(maxEntries).ItemsToPrune(uint32(pruneCount))),
+	}
+}
+
+func (c *storeMetaCache) currentVersion() int64 {
+	c.versionLock.Lock()
+	defer c.versionLock.Unlock()
+	return c.version
+}
+
+// set caches the value read since the version, unless invalidated in between
+func (c *storeMetaCache) set(dir, key string, value interface{}, version int64) {
+	c.versionLock.Lock()
+	defer c.versionLock.Unlock()
+	if c.version != version {
+		return
+	}
+	c.cache.Set(dir, key, value, metaCacheTtl)
+}
+
+func (c *storeMetaCache) findEntry(fp util.FullPath) (entry *Entry, found bool, err error) {
+	dir, name := splitMetaCachePath(fp)
+	item := c.cache.Get(dir, metaCacheEntryPrefix+name)
+	if item == nil || item.Expired() {
+		stats.FilerStoreMetaCacheCounter.WithLabelValues("find", "miss").Inc()
+		return nil, false, nil
+	}
+	stats.FilerStoreMetaCacheCounter.WithLabelValues("find", "hit").Inc()
+	cached := item.Value().(*cachedEntry)
+	if cached.data == nil {
+		return nil, true, filer_pb.ErrNotFound
+	}
+	entry = &Entry{FullPath: fp}
+	if err = entry.DecodeAttributesAndChunks(cached.data); err != nil {
+		return nil, false, err
+	}
+	return entry, true, nil
+}
+
+// setEntry caches the entry read since the version, or a nil entry if it is not found
+func (c *storeMetaCache) setEntry(fp util.FullPath, entry *Entry, version int64) {
+	cached := &cachedEntry{}
+	if entry != nil {
+		// the attributes of hard links are shared with other paths, which are not invalidated together
+		if len(entry.HardLinkId) != 0 {
+			return
+		}
+		data, err := entry.EncodeAttributesAndChunks()
+		if err != nil {
+			glog.V(1).Infof("encode %s for meta cache: %v", fp, err)
+			return
+		}
+		cached.data = data
+	}
+	dir, name := splitMetaCachePath(fp)
+	c.set(dir, metaCacheEntryPrefix+name, cached, version)
+}
+
+func listingKey(startFileName string, includeStartFile bool, limit int64, prefix string) string {
+	return fmt.Sprintf("%s%s\x00%v\x00%d\x00%s", metaCacheListingPrefix, startFileName, includeStartFile, limit, prefix)
+}
+
+func (c *storeMetaCache) getListing(dirPath util.FullPath, key string) *cachedListing {
+	item := c.cache.Get(metaCacheDir(dirPath), key)
+	if item == nil || item.Expired() {
+		stats.FilerStoreMetaCacheCounter.WithLabelValues("list", "miss").Inc()
+		return nil
+	}
+	stats.FilerStoreMetaCacheCounter.WithLabelValues("list", "hit").Inc()
+	return item.Value().(*cachedListing)
+}
+
+// replayListing sends the cached entries to eachEntryFunc, as if listed from the store
+func (c *storeMetaCache) replayListing(dirPath util.FullPath, listing *cachedListing, eachEntryFunc ListEachEntryFunc) (string, error) {
+	for _, cached := range listing.entries {
+		entry := &Entry{FullPath: dirPath.Child(cached.name)}
+		if err := entry.DecodeAttributesAndChunks(cached.data); err != nil {
+			return "", err
+		}
+		if !eachEntryFunc(entry) {
+			break
+		}
+	}
+	return listing.lastFileName, nil
+}
+
+// invalidate drops the cached entry of the path, and the cached listings of its parent directory
+func (c *storeMetaCache) invalidate(fp util.FullPath) {
+	dir, name := splitMetaCachePath(fp)
+	c.versionLock.Lock()
+	defer c.versionLock.Unlock()
+	c.version++
+	c.cache.Delete(dir, metaCacheEntryPrefix+name)
+	c.cache.DeletePrefix(dir, metaCacheListingPrefix)
+}
+
+// invalidateDirectory drops the cached items of a deleted directory, and the directory itself.
+// The sub folders of the directory should be empty.
+func (c *storeMetaCache) invalidateDirectory(fp util.FullPath) {
+	dir, name := splitMetaCachePath(fp)
+	c.versionLock.Lock()
+	defer c.versionLock.Unlock()
+	c.version++
+	c.cache.Delete(dir, metaCacheEntryPrefix+name)
+	c.cache.DeletePrefix(dir, metaCacheListingPrefix)
+	c.cache.DeleteAll(metaCacheDir(fp))
+}
+
+// clear drops all cached items, e.g., after a folder is deleted with all its sub folders
+func (c *storeMetaCache) clear() {
+	c.versionLock.Lock()
+	defer c.versionLock.Unlock()
+	c.version++
+	c.cache.Clear()
+}
+
+// invalidateByEvent drops the cached items changed by a metadata change event from any filer
+func (c *storeMetaCache) invalidateByEvent(event *filer_pb.SubscribeMetadataResponse) {
+	message := event.EventNotification
+	if message.OldEntry != nil {
+		isMoved := message.NewEntry == nil || message.NewParentPath != event.Directory || message.NewEntry.Name != message.OldEntry.Name
+		if message.OldEntry.IsDirectory && isMoved {
+			// the directory is deleted or moved with all its sub folders
+			c.clear()
+			return
+		}
+		c.invalidate(util.NewFullPath(event.Directory, message.OldEntry.Name))
+	}
+	if message.NewEntry != nil {
+		c.invalidate(util.NewFullPath(message.NewParentPath, message.NewEntry.Name))
+	}
+}
+
+// metaCacheDir is the primary cache key of the items in the directory
+func metaCacheDir(dirPath util.FullPath) string {
+	dir := string(dirPath)
+	if len(dir) > 1 && strings.HasSuffix(dir, "/") {
+		dir = dir[:len(dir)-1]
+	}
+	return dir
+}
+
+// splitMetaCachePath splits the path without changing the name, unlike FullPath.DirAndName
+func splitMetaCachePath(fp util.FullPath) (dir, name string) {
+	index := strings.LastIndex(string(fp), "/")
+	if index <= 0 {
+		return "/", string(fp)[index+1:]
+	}
+	return string(fp)[:index], string(fp)[index+1:]
+}
@@ -0,0 +1,79 @@
+package filer
+
+import (
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+func TestStoreMetaCacheInvalidation(t *testing.T) {
+	c := newStoreMetaCache(100)
+
+	fp := util.FullPath("/dir/a.txt")
+	version := c.currentVersion()
+	c.setEntry(fp, &Entry{FullPath: fp, Attr: Attr{Mime: "text/plain"}}, version)
+
+	entry, found, err := c.findEntry(fp)
+	if !found || err != nil || entry.Mime != "text/plain" {
+		t.Fatalf("cached entry: %v %v %v", entry, found, err)
+	}
+
+	key := listingKey("", false, 1024, "")
+	c.set(metaCacheDir("/dir"), key, &cachedListing{entries: []*cachedListingEntry{{name: "a.txt"}}}, version)
+	if c.getListing("/dir/", key) == nil {
+		t.Fatalf("cached listing not found")
+	}
+
+	c.invalidate(util.FullPath("/dir/b.txt"))
+	if c.getListing("/dir", key) != nil {
+		t.Errorf("listing should be invalidated by a changed child")
+	}
+	if _, found, _ = c.findEntry(fp); !found {
+		t.Errorf("other entries should stay cached")
+	}
+
+	// read before the invalidation, should not be cached
+	c.setEntry(fp, nil, version)
+	if _, found, _ = c.findEntry(fp); !found {
+		t.Errorf("stale entry should not replace the cached one")
+	}
+
+	c.invalidate(fp)
+	version = c.currentVersion()
+	c.setEntry(fp, nil, version)
+	if _, found, err = c.findEntry(fp); !found || err != filer_pb.ErrNotFound {
+		t.Errorf("missing entry should be cached as not found: %v %v", found, err)
+	}
+}
+
+func TestStoreMetaCacheInvalidateByEvent(t *testing.T) {
+	c := newStoreMetaCache(100)
+
+	fp := util.FullPath("/dir/sub/a.txt")
+	c.setEntry(fp, &Entry{FullPath: fp}, c.currentVersion())
+
+	c.invalidateByEvent(&filer_pb.SubscribeMetadataResponse{
+		Directory: "/dir",
+		EventNotification: &filer_pb.EventNotification{
+			OldEntry:      &filer_pb.Entry{Name: "sub", IsDirectory: true},
+			NewEntry:      &filer_pb.Entry{Name: "sub", IsDirectory: true},
+			NewParentPath: "/dir",
+		},
+	})
+	if _, found, _ := c.findEntry(fp); !found {
+		t.Errorf("updating a directory should not drop its children")
+	}
+
+	c.invalidateByEvent(&filer_pb.SubscribeMetadataResponse{
+		Directory: "/dir",
+		EventNotification: &filer_pb.EventNotification{
+			OldEntry:      &filer_pb.Entry{Name: "sub", IsDirectory: true},
+			NewEntry:      &filer_pb.Entry{Name: "sub2", IsDirectory: true},
+			NewParentPath: "/dir",
+		},
+	})
+	if _, found, _ := c.findEntry(fp); found {
+		t.Errorf("renaming a directory should drop its children")
+	}
+}
@@ -0,0 +1,172 @@
+package filer
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/stats"
+)
+
+// The filer store statistics tell whether the metadata backend, instead of the filer, is the bottleneck:
+// the latency and the failures of the store calls, the connection pool usage, and the estimated number of entries.
+
+// BackendStatisticsReporter is optionally implemented by the filer stores to report the state of their backends
+type BackendStatisticsReporter interface {
+	BackendStatistics(ctx context.Context) (*StoreBackendStatistics, error)
+}
+
+type StoreBackendStatistics struct {
+	// the connection pool, all zero if the store has none
+	MaxOpenConnections int64
+	OpenConnections    int64
+	InUseConnections   int64
+	IdleConnections    int64
+	// the waits and the timeouts to get a connection from the pool
+	WaitCount      int64
+	WaitDurationMs int64
+	Timeouts       int64
+	// estimated from the backend metadata without scanning the entries, -1 if unknown
+	EstimatedEntryCount int64
+}
+
+type StoreOperationStatistics struct {
+	Count        int64
+	Errors       int64
+	AvgLatencyMs float64
+	MaxLatencyMs float64
+}
+
+type StoreBreakerStatistics struct {
+	IsOpen              bool
+	ConsecutiveFailures int64
+}
+
+type FilerStoreStatistics struct {
+	StoreId  string // empty for the default store
+	Location string
+	Name     string
+	Since    time.Time
+	// the store calls by the operation types, excluding the ones served by the meta cache
+	Operations   map[string]*StoreOperationStatistics
+	Backend      *StoreBackendStatistics `json:",omitempty"`
+	BackendError string                  `json:",omitempty"`
+	Breaker      *StoreBreakerStatistics `json:",omitempty"`
+}
+
+type storeOperationCounter struct {
+	count        int64
+	errors       int64
+	totalLatency time.Duration
+	maxLatency   time.Duration
+}
+
+// storeStatistics counts the store calls by the store ids, and then by the operation types
+type storeStatistics struct {
+	sync.Mutex
+	since      time.Time
+	operations map[string]map[string]*storeOperationCounter
+}
+
+func newStoreStatistics() *storeStatistics {
+	return &storeStatistics{
+		since:      time.Now(),
+		operations: make(map[string]map[string]*storeOperationCounter),
+	}
+}
+
+func (s *storeStatistics) record(storeId, operation string, latency time.Duration, isFailure bool) {
+	s.Lock()
+	defer s.Unlock()
+	storeOperations, found := s.operations[storeId]
+	if !found {
+		storeOperations = make(map[string]*storeOperationCounter)
+		s.operations[storeId] = storeOperations
+	}
+	counter, found := storeOperations[operation]
+	if !found {
+		counter = &storeOperationCounter{}
+		storeOperations[operation] = counter
+	}
+	counter.count++
+	if isFailure {
+		counter.errors++
+	}
+	counter.totalLatency += latency
+	if latency > counter.maxLatency {
+		counter.maxLatency = latency
+	}
+}
+
+func (s *storeStatistics) snapshot(storeId string) map[string]*StoreOperationStatistics {
+	s.Lock()
+	defer s.Unlock()
+	operations := make(map[string]*StoreOperationStatistics)
+	for operation, counter := range s.operations[storeId] {
+		operations[operation] = &StoreOperationStatistics{
+			Count:        counter.count,
+			Errors:       counter.errors,
+			AvgLatencyMs: durationToMs(counter.totalLatency) / float64(counter.count),
+			MaxLatencyMs: durationToMs(counter.maxLatency),
+		}
+	}
+	return operations
+}
+
+func durationToMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// recordStoreCall counts the failed store calls, in addition to the request counter and the latency histogram
+func (fsw *FilerStoreWrapper) recordStoreCall(storeId string, actualStore FilerStore, operation string, start time.Time, err error) {
+	isFailure := isStoreFailure(err)
+	if isFailure {
+		stats.FilerStoreCounter.WithLabelValues(actualStore.GetName(), operation+"Failure").Inc()
+	}
+	fsw.statistics.record(storeId, operation, time.Since(start), isFailure)
+}
+
+// Statistics reports the default store and the path-specific stores, with the state of their backends if available
+func (fsw *FilerStoreWrapper) Statistics(ctx context.Context) (list []*FilerStoreStatistics) {
+	fsw.storesLock.RLock()
+	stores := map[string]FilerStore{"": fsw.defaultStore}
+	for storeId, store := range fsw.storeIdToStore {
+		stores[storeId] = store
+	}
+	fsw.storesLock.RUnlock()
+
+	for storeId, store := range stores {
+		storeStatistics := &FilerStoreStatistics{
+			StoreId:    storeId,
+			Location:   "/",
+			Name:       store.GetName(),
+			Since:      fsw.statistics.since,
+			Operations: fsw.statistics.snapshot(storeId),
+		}
+		if translator, ok := store.(*FilerStorePathTranlator); ok {
+			storeStatistics.Location = translator.storeRoot
+			store = translator.actualStore
+		}
+		if breaker, ok := store.(*FilerStoreBreaker); ok {
+			storeStatistics.Breaker = breaker.Statistics()
+			store = breaker.actualStore
+		}
+		if reporter, ok := store.(BackendStatisticsReporter); ok {
+			backend, err := reporter.BackendStatistics(ctx)
+			if err != nil {
+				glog.V(1).Infof("filer store %s backend statistics: %v", store.GetName(), err)
+				storeStatistics.BackendError = err.Error()
+			} else {
+				storeStatistics.Backend = backend
+			}
+		}
+		list = append(list, storeStatistics)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StoreId < list[j].StoreId
+	})
+	return
+}
@@ -0,0 +1,66 @@
+package filer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+)
+
+type reportingStore struct {
+	hangingStore
+}
+
+func (s *reportingStore) BackendStatistics(ctx context.Context) (*StoreBackendStatistics, error) {
+	return &StoreBackendStatistics{OpenConnections: 3, InUseConnections: 1, IdleConnections: 2, EstimatedEntryCount: 42}, nil
+}
+
+func TestFilerStoreStatistics(t *testing.T) {
+
+	defaultStore := &hangingStore{}
+	pathStore := &reportingStore{}
+	fsw := NewFilerStoreWrapper(defaultStore)
+	fsw.AddPathSpecificStore("/buckets/b1", "b1", NewFilerStoreBreaker(pathStore, StoreBreakerOption{FailureThreshold: 2}))
+	fsw.EnableMetaCache(100)
+	ctx := context.Background()
+
+	// the calls served by the meta cache are not counted
+	for i := 0; i < 3; i++ {
+		if _, err := fsw.FindEntry(ctx, "/a"); err != nil {
+			t.Fatalf("find /a: %v", err)
+		}
+	}
+	// not found is not a failure
+	defaultStore.err = filer_pb.ErrNotFound
+	fsw.FindEntry(ctx, "/b")
+	pathStore.err = errors.New("connection refused")
+	fsw.FindEntry(ctx, "/buckets/b1/c")
+
+	list := fsw.Statistics(ctx)
+	if len(list) != 2 {
+		t.Fatalf("statistics of %d stores", len(list))
+	}
+
+	defaultStatistics := list[0]
+	if defaultStatistics.StoreId != "" || defaultStatistics.Location != "/" || defaultStatistics.Backend != nil || defaultStatistics.Breaker != nil {
+		t.Errorf("default store statistics %+v", defaultStatistics)
+	}
+	if find := defaultStatistics.Operations["find"]; find == nil || find.Count != 2 || find.Errors != 0 {
+		t.Errorf("default store find %+v", find)
+	}
+
+	pathStatistics := list[1]
+	if pathStatistics.StoreId != "b1" || pathStatistics.Location != "/buckets/b1/" || pathStatistics.Name != "hanging" {
+		t.Errorf("path-specific store statistics %+v", pathStatistics)
+	}
+	if find := pathStatistics.Operations["find"]; find == nil || find.Count != 1 || find.Errors != 1 {
+		t.Errorf("path-specific store find %+v", find)
+	}
+	if pathStatistics.Backend == nil || pathStatistics.Backend.EstimatedEntryCount != 42 {
+		t.Errorf("path-specific store backend %+v", pathStatistics.Backend)
+	}
+	if breaker := pathStatistics.Breaker; breaker == nil || breaker.IsOpen || breaker.ConsecutiveFailures != 1 {
+		t.Errorf("path-specific store breaker %+v", breaker)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/viant/ptrie"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
@@ -21,15 +22,23 @@ type VirtualFilerStore interface {
 	DeleteHardLink(ctx context.Context, hardLinkId HardLinkId) error
 	DeleteOneEntry(ctx context.Context, entry *Entry) error
 	AddPathSpecificStore(path string, storeId string, store FilerStore)
+	ReplaceStore(storeId string, store FilerStore) (oldStore FilerStore)
+	EnableMetaCache(maxEntries int64)
+	InvalidateMetaCache(event *filer_pb.SubscribeMetadataResponse)
 	OnBucketCreation(bucket string)
 	OnBucketDeletion(bucket string)
 	CanDropWholeBucket() bool
+	IsTransactional(fullpaths []util.FullPath) bool
+	Statistics(ctx context.Context) []*FilerStoreStatistics
 }
 
 type FilerStoreWrapper struct {
 	defaultStore   FilerStore
 	pathToStore    ptrie.Trie
 	storeIdToStore map[string]FilerStore
+	storesLock     sync.RWMutex
+	metaCache      *storeMetaCache
+	statistics     *storeStatistics
 }
 
 func NewFilerStoreWrapper(store FilerStore) *FilerStoreWrapper {
@@ -40,17 +49,38 @@ func NewFilerStoreWrapper(store FilerStore) *FilerStoreWrapper {
 		defaultStore:   store,
 		pathToStore:    ptrie.New(),
 		storeIdToStore: make(map[string]FilerStore),
+		statistics:     newStoreStatistics(),
 	}
 }
 
 func (fsw *FilerStoreWrapper) CanDropWholeBucket() bool {
-	if ba, ok := fsw.defaultStore.(BucketAware); ok {
+	if ba, ok := fsw.getDefaultStore().(BucketAware); ok {
 		return ba.CanDropWholeBucket()
 	}
 	return false
 }
 
+// IsTransactional tells whether the changes to all the paths can be rolled back together,
+// i.e., the paths are all in the default store, and the default store supports transactions
+func (fsw *FilerStoreWrapper) IsTransactional(fullpaths []util.FullPath) bool {
+	defaultStore := fsw.getDefaultStore()
+	for _, fullpath := range fullpaths {
+		if fsw.getActualStore(fullpath) != defaultStore {
+			return false
+		}
+	}
+	if breaker, ok := defaultStore.(*FilerStoreBreaker); ok {
+		defaultStore = breaker.actualStore
+	}
+	if ts, ok := defaultStore.(TransactionalStore); ok {
+		return ts.IsTransactional()
+	}
+	return false
+}
+
 func (fsw *FilerStoreWrapper) OnBucketCreation(bucket string) {
+	fsw.storesLock.RLock()
+	defer fsw.storesLock.RUnlock()
 	for _, store := range fsw.storeIdToStore {
 		if ba, ok := store.(BucketAware); ok {
 			ba.OnBucketCreation(bucket)
@@ -61,6 +91,8 @@ func (fsw *FilerStoreWrapper) OnBucketCreation(bucket string) {
 	}
 }
 func (fsw *FilerStoreWrapper) OnBucketDeletion(bucket string) {
+	fsw.storesLock.RLock()
+	defer fsw.storesLock.RUnlock()
 	for _, store := range fsw.storeIdToStore {
 		if ba, ok := store.(BucketAware); ok {
 			ba.OnBucketDeletion(bucket)
@@ -72,6 +104,8 @@ func (fsw *FilerStoreWrapper) OnBucketDeletion(bucket string) {
 }
 
 func (fsw *FilerStoreWrapper) AddPathSpecificStore(path string, storeId string, store FilerStore) {
+	fsw.storesLock.Lock()
+	defer fsw.storesLock.Unlock()
 	fsw.storeIdToStore[storeId] = NewFilerStorePathTranlator(path, store)
 	err := fsw.pathToStore.Put([]byte(path), storeId)
 	if err != nil {
@@ -79,12 +113,73 @@ func (fsw *FilerStoreWrapper) AddPathSpecificStore(path string, storeId string,
 	}
 }
 
+// ReplaceStore replaces the default store, or the path-specific store if storeId is not empty.
+// The replaced store is returned, and it is still used by the in-flight requests.
+func (fsw *FilerStoreWrapper) ReplaceStore(storeId string, store FilerStore) (oldStore FilerStore) {
+	fsw.storesLock.Lock()
+	defer fsw.storesLock.Unlock()
+	defer fsw.clearMetaCache()
+	if storeId == "" {
+		oldStore, fsw.defaultStore = fsw.defaultStore, store
+		return
+	}
+	translator, found := fsw.storeIdToStore[storeId].(*FilerStorePathTranlator)
+	if !found {
+		return nil
+	}
+	fsw.storeIdToStore[storeId] = &FilerStorePathTranlator{
+		actualStore: store,
+		storeRoot:   translator.storeRoot,
+	}
+	return translator.actualStore
+}
+
+// EnableMetaCache caches the recently read entries and directory listings in memory.
+// It should be called before the store is used.
+func (fsw *FilerStoreWrapper) EnableMetaCache(maxEntries int64) {
+	if maxEntries <= 0 {
+		return
+	}
+	fsw.metaCache = newStoreMetaCache(maxEntries)
+}
+
+// InvalidateMetaCache drops the cached items changed by other filers sharing the same store
+func (fsw *FilerStoreWrapper) InvalidateMetaCache(event *filer_pb.SubscribeMetadataResponse) {
+	if fsw.metaCache != nil {
+		fsw.metaCache.invalidateByEvent(event)
+	}
+}
+
+func (fsw *FilerStoreWrapper) invalidateMetaCache(fp util.FullPath, isDirectory bool) {
+	if fsw.metaCache == nil {
+		return
+	}
+	if isDirectory {
+		fsw.metaCache.invalidateDirectory(fp)
+	} else {
+		fsw.metaCache.invalidate(fp)
+	}
+}
+
+func (fsw *FilerStoreWrapper) clearMetaCache() {
+	if fsw.metaCache != nil {
+		fsw.metaCache.clear()
+	}
+}
+
 func (fsw *FilerStoreWrapper) getActualStore(path util.FullPath) (store FilerStore) {
+	_, store = fsw.getActualStoreWithId(path)
+	return
+}
+
+// getActualStoreWithId returns the store for the path, and its store id, which is empty for the default store
+func (fsw *FilerStoreWrapper) getActualStoreWithId(path util.FullPath) (storeId string, store FilerStore) {
+	fsw.storesLock.RLock()
+	defer fsw.storesLock.RUnlock()
 	store = fsw.defaultStore
 	if path == "/" {
 		return
 	}
-	var storeId string
 	fsw.pathToStore.MatchPrefix([]byte(path), func(key []byte, value interface{}) bool {
 		storeId = value.(string)
 		return false
@@ -96,6 +191,8 @@ func (fsw *FilerStoreWrapper) getActualStore(path util.FullPath) (store FilerSto
 }
 
 func (fsw *FilerStoreWrapper) getDefaultStore() (store FilerStore) {
+	fsw.storesLock.RLock()
+	defer fsw.storesLock.RUnlock()
 	return fsw.defaultStore
 }
 
@@ -107,8 +204,8 @@ func (fsw *FilerStoreWrapper) Initialize(configuration util.Configuration, prefi
 	return fsw.getDefaultStore().Initialize(configuration, prefix)
 }
 
-func (fsw *FilerStoreWrapper) InsertEntry(ctx context.Context, entry *Entry) error {
-	actualStore := fsw.getActualStore(entry.FullPath)
+func (fsw *FilerStoreWrapper) InsertEntry(ctx context.Context, entry *Entry) (err error) {
+	storeId, actualStore := fsw.getActualStoreWithId(entry.FullPath)
 	stats.FilerStoreCounter.WithLabelValues(actualStore.GetName(), "insert").Inc()
 	start := time.Now()
 	defer func() {
@@ -120,16 +217,19 @@ func (fsw *FilerStoreWrapper) InsertEntry(ctx context.Context, entry *Entry) err
 		entry.Mime = ""
 	}
 
-	if err := fsw.handleUpdateToHardLinks(ctx, entry); err != nil {
+	if err = fsw.handleUpdateToHardLinks(ctx, entry); err != nil {
 		return err
 	}
 
 	glog.V(4).Infof("InsertEntry %s", entry.FullPath)
-	return actualStore.InsertEntry(ctx, entry)
+	defer fsw.invalidateMetaCache(entry.FullPath, false)
+	err = actualStore.InsertEntry(ctx, entry)
+	fsw.recordStoreCall(storeId, actualStore, "insert", start, err)
+	return err
 }
 
-func (fsw *FilerStoreWrapper) UpdateEntry(ctx context.Context, entry *Entry) error {
-	actualStore := fsw.getActualStore(entry.FullPath)
+func (fsw *FilerStoreWrapper) UpdateEntry(ctx context.Context, entry *Entry) (err error) {
+	storeId, actualStore := fsw.getActualStoreWithId(entry.FullPath)
 	stats.FilerStoreCounter.WithLabelValues(actualStore.GetName(), "update").Inc()
 	start := time.Now()
 	defer func() {
@@ -141,24 +241,47 @@ func (fsw *FilerStoreWrapper) UpdateEntry(ctx context.Context, entry *Entry) err
 		entry.Mime = ""
 	}
 
-	if err := fsw.handleUpdateToHardLinks(ctx, entry); err != nil {
+	if err = fsw.handleUpdateToHardLinks(ctx, entry); err != nil {
 		return err
 	}
 
 	glog.V(4).Infof("UpdateEntry %s", entry.FullPath)
-	return actualStore.UpdateEntry(ctx, entry)
+	defer fsw.invalidateMetaCache(entry.FullPath, false)
+	err = actualStore.UpdateEntry(ctx, entry)
+	fsw.recordStoreCall(storeId, actualStore, "update", start, err)
+	return err
 }
 
 func (fsw *FilerStoreWrapper) FindEntry(ctx context.Context, fp util.FullPath) (entry *Entry, err error) {
-	actualStore := fsw.getActualStore(fp)
+	storeId, actualStore := fsw.getActualStoreWithId(fp)
 	stats.FilerStoreCounter.WithLabelValues(actualStore.GetName(), "find").Inc()
 	start := time.Now()
 	defer func() {
 		stats.FilerStoreHistogram.WithLabelValues(actualStore.GetName(), "find").Observe(time.Since(start).Seconds())
 	}()
 
+	var version int64
+	if fsw.metaCache != nil {
+		if entry, found, cacheErr := fsw.metaCache.findEntry(fp); found {
+			if cacheErr != nil {
+				return nil, cacheErr
+			}
+			filer_pb.AfterEntryDeserialization(entry.Chunks)
+			return entry, nil
+		}
+		version = fsw.metaCache.currentVersion()
+	}
+
 	entry, err = actualStore.FindEntry(ctx, fp)
+	fsw.recordStoreCall(storeId, actualStore, "find", start, err)
 	// glog.V(4).Infof("FindEntry %s: %v", fp, err)
+	if fsw.metaCache != nil {
+		if err == nil {
+			fsw.metaCache.setEntry(fp, entry, version)
+		} else if err == filer_pb.ErrNotFound {
+			fsw.metaCache.setEntry(fp, nil, version)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -170,7 +293,7 @@ func (fsw *FilerStoreWrapper) FindEntry(ctx context.Context, fp util.FullPath) (
 }
 
 func (fsw *FilerStoreWrapper) DeleteEntry(ctx context.Context, fp util.FullPath) (err error) {
-	actualStore := fsw.getActualStore(fp)
+	storeId, actualStore := fsw.getActualStoreWithId(fp)
 	stats.FilerStoreCounter.WithLabelValues(actualStore.GetName(), "delete").Inc()
 	start := time.Now()
 	defer func() {
@@ -190,11 +313,14 @@ func (fsw *FilerStoreWrapper) DeleteEntry(ctx context.Context, fp util.FullPath)
 	}
 
 	glog.V(4).Infof("DeleteEntry %s", fp)
-	return actualStore.DeleteEntry(ctx, fp)
+	defer fsw.invalidateMetaCache(fp, existingEntry.IsDirectory())
+	err = actualStore.DeleteEntry(ctx, fp)
+	fsw.recordStoreCall(storeId, actualStore, "delete", start, err)
+	return err
 }
 
 func (fsw *FilerStoreWrapper) DeleteOneEntry(ctx context.Context, existingEntry *Entry) (err error) {
-	actualStore := fsw.getActualStore(existingEntry.FullPath)
+	storeId, actualStore := fsw.getActualStoreWithId(existingEntry.FullPath)
 	stats.FilerStoreCounter.WithLabelValues(actualStore.GetName(), "delete").Inc()
 	start := time.Now()
 	defer func() {
@@ -210,11 +336,14 @@ func (fsw *FilerStoreWrapper) DeleteOneEntry(ctx context.Context, existingEntry
 	}
 
 	glog.V(4).Infof("DeleteOneEntry %s", existingEntry.FullPath)
-	return actualStore.DeleteEntry(ctx, existingEntry.FullPath)
+	defer fsw.invalidateMetaCache(existingEntry.FullPath, existingEntry.IsDirectory())
+	err = actualStore.DeleteEntry(ctx, existingEntry.FullPath)
+	fsw.recordStoreCall(storeId, actualStore, "delete", start, err)
+	return err
 }
 
 func (fsw *FilerStoreWrapper) DeleteFolderChildren(ctx context.Context, fp util.FullPath) (err error) {
-	actualStore := fsw.getActualStore(fp + "/")
+	storeId, actualStore := fsw.getActualStoreWithId(fp + "/")
 	stats.FilerStoreCounter.WithLabelValues(actualStore.GetName(), "deleteFolderChildren").Inc()
 	start := time.Now()
 	defer func() {
@@ -222,11 +351,14 @@ func (fsw *FilerStoreWrapper) DeleteFolderChildren(ctx context.Context, fp util.
 	}()
 
 	glog.V(4).Infof("DeleteFolderChildren %s", fp)
-	return actualStore.DeleteFolderChildren(ctx, fp)
+	defer fsw.clearMetaCache()
+	err = actualStore.DeleteFolderChildren(ctx, fp)
+	fsw.recordStoreCall(storeId, actualStore, "deleteFolderChildren", start, err)
+	return err
 }
 
 func (fsw *FilerStoreWrapper) ListDirectoryEntries(ctx context.Context, dirPath util.FullPath, startFileName string, includeStartFile bool, limit int64, eachEntryFunc ListEachEntryFunc) (string, error) {
-	actualStore := fsw.getActualStore(dirPath + "/")
+	storeId, actualStore := fsw.getActualStoreWithId(dirPath + "/")
 	stats.FilerStoreCounter.WithLabelValues(actualStore.GetName(), "list").Inc()
 	start := time.Now()
 	defer func() {
@@ -234,28 +366,73 @@ func (fsw *FilerStoreWrapper) ListDirectoryEntries(ctx context.Context, dirPath
 	}()
 
 	glog.V(4).Infof("ListDirectoryEntries %s from %s limit %d", dirPath, startFileName, limit)
-	return actualStore.ListDirectoryEntries(ctx, dirPath, startFileName, includeStartFile, limit, func(entry *Entry) bool {
-		fsw.maybeReadHardLink(ctx, entry)
-		filer_pb.AfterEntryDeserialization(entry.Chunks)
-		return eachEntryFunc(entry)
+	return fsw.cachedListDirectoryEntries(dirPath, listingKey(startFileName, includeStartFile, limit, ""), eachEntryFunc, func(eachEntryFunc ListEachEntryFunc) (string, error) {
+		lastFileName, err := actualStore.ListDirectoryEntries(ctx, dirPath, startFileName, includeStartFile, limit, func(entry *Entry) bool {
+			fsw.maybeReadHardLink(ctx, entry)
+			filer_pb.AfterEntryDeserialization(entry.Chunks)
+			return eachEntryFunc(entry)
+		})
+		fsw.recordStoreCall(storeId, actualStore, "list", start, err)
+		return lastFileName, err
 	})
 }
 
 func (fsw *FilerStoreWrapper) ListDirectoryPrefixedEntries(ctx context.Context, dirPath util.FullPath, startFileName string, includeStartFile bool, limit int64, prefix string, eachEntryFunc ListEachEntryFunc) (lastFileName string, err error) {
-	actualStore := fsw.getActualStore(dirPath + "/")
+	storeId, actualStore := fsw.getActualStoreWithId(dirPath + "/")
 	stats.FilerStoreCounter.WithLabelValues(actualStore.GetName(), "prefixList").Inc()
 	start := time.Now()
 	defer func() {
 		stats.FilerStoreHistogram.WithLabelValues(actualStore.GetName(), "prefixList").Observe(time.Since(start).Seconds())
 	}()
 	glog.V(4).Infof("ListDirectoryPrefixedEntries %s from %s prefix %s limit %d", dirPath, startFileName, prefix, limit)
-	lastFileName, err = actualStore.ListDirectoryPrefixedEntries(ctx, dirPath, startFileName, includeStartFile, limit, prefix, eachEntryFunc)
-	if err == ErrUnsupportedListDirectoryPrefixed {
-		lastFileName, err = fsw.prefixFilterEntries(ctx, dirPath, startFileName, includeStartFile, limit, prefix, func(entry *Entry) bool {
-			fsw.maybeReadHardLink(ctx, entry)
-			filer_pb.AfterEntryDeserialization(entry.Chunks)
-			return eachEntryFunc(entry)
-		})
+	return fsw.cachedListDirectoryEntries(dirPath, listingKey(startFileName, includeStartFile, limit, prefix), eachEntryFunc, func(eachEntryFunc ListEachEntryFunc) (lastFileName string, err error) {
+		lastFileName, err = actualStore.ListDirectoryPrefixedEntries(ctx, dirPath, startFileName, includeStartFile, limit, prefix, eachEntryFunc)
+		if err == ErrUnsupportedListDirectoryPrefixed {
+			lastFileName, err = fsw.prefixFilterEntries(ctx, dirPath, startFileName, includeStartFile, limit, prefix, func(entry *Entry) bool {
+				fsw.maybeReadHardLink(ctx, entry)
+				filer_pb.AfterEntryDeserialization(entry.Chunks)
+				return eachEntryFunc(entry)
+			})
+		}
+		fsw.recordStoreCall(storeId, actualStore, "prefixList", start, err)
+		return lastFileName, err
+	})
+}
+
+// cachedListDirectoryEntries replays the cached listing if any,
+// or lists from the store and caches the listing if all the listed entries are consumed.
+func (fsw *FilerStoreWrapper) cachedListDirectoryEntries(dirPath util.FullPath, key string, eachEntryFunc ListEachEntryFunc, list func(eachEntryFunc ListEachEntryFunc) (string, error)) (string, error) {
+	if fsw.metaCache == nil {
+		return list(eachEntryFunc)
+	}
+	if listing := fsw.metaCache.getListing(dirPath, key); listing != nil {
+		return fsw.metaCache.replayListing(dirPath, listing, eachEntryFunc)
+	}
+
+	version := fsw.metaCache.currentVersion()
+	listing := &cachedListing{}
+	isCacheable := true
+	lastFileName, err := list(func(entry *Entry) bool {
+		if isCacheable {
+			isCacheable = len(entry.HardLinkId) == 0
+		}
+		if isCacheable {
+			data, encodeErr := entry.EncodeAttributesAndChunks()
+			if encodeErr != nil {
+				isCacheable = false
+			} else {
+				listing.entries = append(listing.entries, &cachedListingEntry{name: entry.Name(), data: data})
+			}
+		}
+		if !eachEntryFunc(entry) {
+			isCacheable = false
+			return false
+		}
+		return true
+	})
+	if err == nil && isCacheable {
+		listing.lastFileName = lastFileName
+		fsw.metaCache.set(metaCacheDir(dirPath), key, listing, version)
 	}
 	return lastFileName, err
 }
@@ -308,10 +485,12 @@ func (fsw *FilerStoreWrapper) BeginTransaction(ctx context.Context) (context.Con
 }
 
 func (fsw *FilerStoreWrapper) CommitTransaction(ctx context.Context) error {
+	defer fsw.clearMetaCache()
 	return fsw.getDefaultStore().CommitTransaction(ctx)
 }
 
 func (fsw *FilerStoreWrapper) RollbackTransaction(ctx context.Context) error {
+	defer fsw.clearMetaCache()
 	return fsw.getDefaultStore().RollbackTransaction(ctx)
 }
 
@@ -2,11 +2,13 @@ package leveldb
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"testing"
 
 	"github.com/chrislusf/seaweedfs/weed/filer"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
@@ -86,3 +88,102 @@ func TestEmptyRoot(t *testing.T) {
 	}
 
 }
+
+func TestEntryWithManyChunksIsCompressed(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "seaweedfs_filer_test3")
+	defer os.RemoveAll(dir)
+	store := &LevelDB2Store{}
+	store.initialize(dir, 2)
+
+	ctx := context.Background()
+
+	entry1 := &filer.Entry{
+		FullPath: util.FullPath("/home/chris/large.file"),
+		Attr: filer.Attr{
+			Mode: 0440,
+		},
+	}
+	for i := 0; i < 1000; i++ {
+		entry1.Chunks = append(entry1.Chunks, &filer_pb.FileChunk{
+			FileId: fmt.Sprintf("3,%x1234abcd", i),
+			Offset: int64(i) * 4 * 1024 * 1024,
+			Size:   4 * 1024 * 1024,
+		})
+	}
+
+	if err := store.InsertEntry(ctx, entry1); err != nil {
+		t.Fatalf("insert entry %v: %v", entry1.FullPath, err)
+	}
+
+	dirPath, name := entry1.DirAndName()
+	key, partitionId := genKey(dirPath, name, store.dbCount)
+	value, err := store.dbs[partitionId].Get(key, nil)
+	if err != nil {
+		t.Fatalf("get raw value: %v", err)
+	}
+	if !util.IsGzippedContent(value) {
+		t.Errorf("entry with %d chunks is not compressed", len(entry1.Chunks))
+	}
+
+	entry, err := store.FindEntry(ctx, entry1.FullPath)
+	if err != nil {
+		t.Fatalf("find entry: %v", err)
+	}
+	if len(entry.Chunks) != len(entry1.Chunks) {
+		t.Errorf("found %d chunks, expected %d", len(entry.Chunks), len(entry1.Chunks))
+	}
+}
+
+func TestApplyMutations(t *testing.T) {
+	testFiler := filer.NewFiler(nil, nil, "", 0, "", "", "", nil)
+	dir, _ := ioutil.TempDir("", "seaweedfs_filer_test")
+	defer os.RemoveAll(dir)
+	store := &LevelDB2Store{}
+	store.initialize(dir, 2)
+	testFiler.SetStore(store)
+
+	ctx := context.Background()
+	newEntry := func(fullpath string, mode os.FileMode) *filer.Entry {
+		return &filer.Entry{FullPath: util.FullPath(fullpath), Attr: filer.Attr{Mode: mode}}
+	}
+	testFiler.CreateEntry(ctx, newEntry("/dir/file1", 0440), false, false, nil)
+	testFiler.CreateEntry(ctx, newEntry("/dir/file2", 0440), false, false, nil)
+
+	// the failed mutation compensates the applied ones
+	isTransactional, err := testFiler.ApplyMutations(ctx, []*filer.Mutation{
+		{Create: newEntry("/dir/file1", 0600)},
+		{Create: newEntry("/dir/file3", 0600)},
+		{Delete: "/dir/file2"},
+		{Update: newEntry("/dir/missing", 0600)},
+	}, false, nil)
+	if err == nil || isTransactional {
+		t.Fatalf("apply failed mutations: %v, transactional %v", err, isTransactional)
+	}
+	if entry, err := testFiler.FindEntry(ctx, "/dir/file1"); err != nil || entry.Mode != 0440 {
+		t.Errorf("restored file1: %+v, %v", entry, err)
+	}
+	if _, err := testFiler.FindEntry(ctx, "/dir/file2"); err != nil {
+		t.Errorf("restored file2: %v", err)
+	}
+	if _, err := testFiler.FindEntry(ctx, "/dir/file3"); err != filer_pb.ErrNotFound {
+		t.Errorf("removed file3: %v", err)
+	}
+
+	// all the mutations are applied
+	if _, err = testFiler.ApplyMutations(ctx, []*filer.Mutation{
+		{Create: newEntry("/dir/file3", 0600)},
+		{Update: newEntry("/dir/file1", 0600)},
+		{Delete: "/dir/file2"},
+	}, false, nil); err != nil {
+		t.Fatalf("apply mutations: %v", err)
+	}
+	if entry, err := testFiler.FindEntry(ctx, "/dir/file1"); err != nil || entry.Mode != 0600 {
+		t.Errorf("updated file1: %+v, %v", entry, err)
+	}
+	if _, err := testFiler.FindEntry(ctx, "/dir/file2"); err != filer_pb.ErrNotFound {
+		t.Errorf("deleted file2: %v", err)
+	}
+	if _, err := testFiler.FindEntry(ctx, "/dir/file3"); err != nil {
+		t.Errorf("created file3: %v", err)
+	}
+}
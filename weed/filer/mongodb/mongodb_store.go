@@ -22,6 +22,8 @@ type MongodbStore struct {
 	connect        *mongo.Client
 	database       string
 	collectionName string
+	maxPoolSize    uint64
+	poolCounters   mongodbPoolCounters
 }
 
 type Model struct {
@@ -48,6 +50,8 @@ func (store *MongodbStore) connection(uri string, poolSize uint64) (err error) {
 	if poolSize > 0 {
 		opts.SetMaxPoolSize(poolSize)
 	}
+	store.maxPoolSize = poolSize
+	opts.SetPoolMonitor(store.poolCounters.monitor())
 
 	client, err := mongo.Connect(ctx, opts)
 	if err != nil {
@@ -107,7 +111,7 @@ func (store *MongodbStore) UpdateEntry(ctx context.Context, entry *filer.Entry)
 		return fmt.Errorf("encode %s: %s", entry.FullPath, err)
 	}
 
-	if len(entry.Chunks) > 50 {
+	if len(entry.Chunks) > filer.CountEntryChunksForGzip {
 		meta = util.MaybeGzipData(meta)
 	}
 
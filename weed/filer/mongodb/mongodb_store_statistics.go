@@ -0,0 +1,56 @@
+package mongodb
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/event"
+
+	"github.com/chrislusf/seaweedfs/weed/filer"
+)
+
+// mongodbPoolCounters follows the connection pool events, since the driver does not expose the pool usage
+type mongodbPoolCounters struct {
+	open     int64
+	inUse    int64
+	timeouts int64
+}
+
+func (c *mongodbPoolCounters) monitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				atomic.AddInt64(&c.open, 1)
+			case event.ConnectionClosed:
+				atomic.AddInt64(&c.open, -1)
+			case event.GetSucceeded:
+				atomic.AddInt64(&c.inUse, 1)
+			case event.ConnectionReturned:
+				atomic.AddInt64(&c.inUse, -1)
+			case event.GetFailed:
+				if e.Reason == event.ReasonTimedOut {
+					atomic.AddInt64(&c.timeouts, 1)
+				}
+			}
+		},
+	}
+}
+
+// BackendStatistics reports the connection pool, and the number of entries estimated from the collection metadata
+func (store *MongodbStore) BackendStatistics(ctx context.Context) (*filer.StoreBackendStatistics, error) {
+	c := store.connect.Database(store.database).Collection(store.collectionName)
+	count, err := c.EstimatedDocumentCount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	open, inUse := atomic.LoadInt64(&store.poolCounters.open), atomic.LoadInt64(&store.poolCounters.inUse)
+	return &filer.StoreBackendStatistics{
+		MaxOpenConnections:  int64(store.maxPoolSize),
+		OpenConnections:     open,
+		InUseConnections:    inUse,
+		IdleConnections:     open - inUse,
+		Timeouts:            atomic.LoadInt64(&store.poolCounters.timeouts),
+		EstimatedEntryCount: count,
+	}, nil
+}
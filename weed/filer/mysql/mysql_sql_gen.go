@@ -15,6 +15,7 @@ type SqlGenMysql struct {
 
 var (
 	_ = abstract_sql.SqlGenerator(&SqlGenMysql{})
+	_ = abstract_sql.SqlRowCountEstimator(&SqlGenMysql{})
 )
 
 func (gen *SqlGenMysql) GetSqlInsert(tableName string) string {
@@ -56,3 +57,8 @@ func (gen *SqlGenMysql) GetSqlCreateTable(tableName string) string {
 func (gen *SqlGenMysql) GetSqlDropTable(tableName string) string {
 	return fmt.Sprintf(gen.DropTableSqlTemplate, tableName)
 }
+
+// GetSqlEstimateRowCount reads the approximate row count of InnoDB tables, which is refreshed by ANALYZE TABLE
+func (gen *SqlGenMysql) GetSqlEstimateRowCount(tableName string) string {
+	return fmt.Sprintf("SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = '%s'", tableName)
+}
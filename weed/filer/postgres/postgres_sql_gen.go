@@ -15,6 +15,7 @@ type SqlGenPostgres struct {
 
 var (
 	_ = abstract_sql.SqlGenerator(&SqlGenPostgres{})
+	_ = abstract_sql.SqlRowCountEstimator(&SqlGenPostgres{})
 )
 
 func (gen *SqlGenPostgres) GetSqlInsert(tableName string) string {
@@ -56,3 +57,8 @@ func (gen *SqlGenPostgres) GetSqlCreateTable(tableName string) string {
 func (gen *SqlGenPostgres) GetSqlDropTable(tableName string) string {
 	return fmt.Sprintf(gen.DropTableSqlTemplate, tableName)
 }
+
+// GetSqlEstimateRowCount reads the planner's row count estimate, which is refreshed by VACUUM and ANALYZE
+func (gen *SqlGenPostgres) GetSqlEstimateRowCount(tableName string) string {
+	return fmt.Sprintf(`SELECT reltuples::bigint FROM pg_class WHERE oid = to_regclass('"%s"')`, tableName)
+}
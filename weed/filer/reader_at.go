@@ -32,6 +32,11 @@ var _ = io.ReaderAt(&ChunkReadAt{})
 var _ = io.Closer(&ChunkReadAt{})
 
 func LookupFn(filerClient filer_pb.FilerClient) wdclient.LookupFileIdFunctionType {
+	return LookupFnWithReplicaSelector(filerClient, nil)
+}
+
+// LookupFnWithReplicaSelector orders the volume servers by the replica selector, or randomly if the selector is nil
+func LookupFnWithReplicaSelector(filerClient filer_pb.FilerClient, selector *wdclient.ReplicaSelector) wdclient.LookupFileIdFunctionType {
 
 	vidCache := make(map[string]*filer_pb.Locations)
 	var vicCacheLock sync.RWMutex
@@ -70,6 +75,21 @@ func LookupFn(filerClient filer_pb.FilerClient) wdclient.LookupFileIdFunctionTyp
 			return nil, err
 		}
 
+		if selector != nil {
+			var replicas []wdclient.Location
+			for _, loc := range locations.Locations {
+				replicas = append(replicas, wdclient.Location{
+					Url:        filerClient.AdjustedUrl(loc),
+					DataCenter: loc.DataCenter,
+					Rack:       loc.Rack,
+				})
+			}
+			for _, replica := range selector.Sort(replicas) {
+				targetUrls = append(targetUrls, fmt.Sprintf("http://%s/%s", replica.Url, fileId))
+			}
+			return
+		}
+
 		for _, loc := range locations.Locations {
 			volumeServerAddress := filerClient.AdjustedUrl(loc)
 			targetUrl := fmt.Sprintf("http://%s/%s", volumeServerAddress, fileId)
@@ -126,6 +146,7 @@ func (c *ChunkReadAt) doReadAt(p []byte, offset int64) (n int, err error) {
 		if startOffset < chunk.LogicOffset {
 			gap := int(chunk.LogicOffset - startOffset)
 			glog.V(4).Infof("zero [%d,%d)", startOffset, startOffset+int64(gap))
+			zeroFill(p[startOffset-offset : startOffset-offset+min(int64(gap), remaining)])
 			n += int(min(int64(gap), remaining))
 			startOffset, remaining = chunk.LogicOffset, remaining-int64(gap)
 			if remaining <= 0 {
@@ -157,6 +178,7 @@ func (c *ChunkReadAt) doReadAt(p []byte, offset int64) (n int, err error) {
 	if err == nil && remaining > 0 && c.fileSize > startOffset {
 		delta := int(min(remaining, c.fileSize-startOffset))
 		glog.V(4).Infof("zero2 [%d,%d) of file size %d bytes", startOffset, startOffset+int64(delta), c.fileSize)
+		zeroFill(p[startOffset-offset : startOffset-offset+int64(delta)])
 		n += delta
 	}
 
@@ -169,6 +191,13 @@ func (c *ChunkReadAt) doReadAt(p []byte, offset int64) (n int, err error) {
 
 }
 
+// zeroFill clears the holes of sparse files, since the read buffers can be reused
+func zeroFill(p []byte) {
+	for i := range p {
+		p[i] = 0
+	}
+}
+
 func (c *ChunkReadAt) readChunkSlice(chunkView *ChunkView, nextChunkViews *ChunkView, offset, length uint64) ([]byte, error) {
 
 	chunkSlice := c.chunkCache.GetChunkSlice(chunkView.FileId, offset, length)
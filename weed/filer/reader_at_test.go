@@ -159,3 +159,44 @@ func TestReaderAt1(t *testing.T) {
 	testReadAt(t, readerAt, 1, 10, 10, nil)
 
 }
+
+func TestReaderAtSparseHoles(t *testing.T) {
+
+	visibles := []VisibleInterval{
+		{
+			start:     2,
+			stop:      4,
+			fileId:    "1",
+			chunkSize: 2,
+		},
+		{
+			start:     6,
+			stop:      8,
+			fileId:    "2",
+			chunkSize: 2,
+		},
+	}
+
+	readerAt := &ChunkReadAt{
+		chunkViews:   ViewFromVisibleIntervals(visibles, 0, math.MaxInt64),
+		lookupFileId: nil,
+		readerLock:   sync.Mutex{},
+		fileSize:     10,
+		chunkCache:   &mockChunkCache{},
+	}
+
+	// a reused buffer, with stale data in the holes
+	data := []byte{9, 9, 9, 9, 9, 9, 9, 9, 9, 9}
+	n, err := readerAt.ReadAt(data, 0)
+	if n != 10 || err != io.EOF {
+		t.Errorf("unexpected read size %d and error %v", n, err)
+	}
+	expected := []byte{0, 0, 1, 1, 0, 0, 2, 2, 0, 0}
+	for i := range expected {
+		if data[i] != expected[i] {
+			t.Errorf("unexpected data %v, expect %v", data, expected)
+			break
+		}
+	}
+
+}
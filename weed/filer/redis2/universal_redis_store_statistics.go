@@ -0,0 +1,41 @@
+package redis2
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/chrislusf/seaweedfs/weed/filer"
+)
+
+// BackendStatistics reports the connection pool, and the number of keys as the estimated number of entries,
+// which also counts the directory listings and the key-value pairs
+func (store *UniversalRedis2Store) BackendStatistics(ctx context.Context) (*filer.StoreBackendStatistics, error) {
+	var keyCount int64
+	if clusterClient, ok := store.Client.(*redis.ClusterClient); ok {
+		err := clusterClient.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			n, err := client.DBSize(ctx).Result()
+			atomic.AddInt64(&keyCount, n)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		n, err := store.Client.DBSize(ctx).Result()
+		if err != nil {
+			return nil, err
+		}
+		keyCount = n
+	}
+
+	poolStats := store.Client.PoolStats()
+	return &filer.StoreBackendStatistics{
+		OpenConnections:     int64(poolStats.TotalConns),
+		InUseConnections:    int64(poolStats.TotalConns) - int64(poolStats.IdleConns),
+		IdleConnections:     int64(poolStats.IdleConns),
+		Timeouts:            int64(poolStats.Timeouts),
+		EstimatedEntryCount: keyCount,
+	}, nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/tecbot/gorocksdb"
 
 	"github.com/chrislusf/seaweedfs/weed/filer"
+	weed_util "github.com/chrislusf/seaweedfs/weed/util"
 )
 
 type TTLFilter struct {
@@ -25,7 +26,7 @@ func (t *TTLFilter) Filter(level int, key, val []byte) (remove bool, newVal []by
 	// level >0 sst can run compaction in parallel
 	if !t.skipLevel0 || level > 0 {
 		entry := filer.Entry{}
-		if err := entry.DecodeAttributesAndChunks(val); err == nil {
+		if err := entry.DecodeAttributesAndChunks(weed_util.MaybeDecompressData(val)); err == nil {
 			if entry.TtlSec > 0 &&
 				entry.Crtime.Add(time.Duration(entry.TtlSec)*time.Second).Before(time.Now()) {
 				return true, nil
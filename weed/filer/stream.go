@@ -16,6 +16,17 @@ import (
 )
 
 func StreamContent(masterClient wdclient.HasLookupFileIdFunction, w io.Writer, chunks []*filer_pb.FileChunk, offset int64, size int64) error {
+	return streamContent(masterClient, w, chunks, offset, size, false)
+}
+
+// StreamContentUnbuffered writes the chunk data to w as it is received from the volume servers,
+// instead of reading each chunk into memory first. So large chunks do not add to the memory usage.
+// If a volume server fails in the middle of a chunk, the chunk is resumed from another replica.
+func StreamContentUnbuffered(masterClient wdclient.HasLookupFileIdFunction, w io.Writer, chunks []*filer_pb.FileChunk, offset int64, size int64) error {
+	return streamContent(masterClient, w, chunks, offset, size, true)
+}
+
+func streamContent(masterClient wdclient.HasLookupFileIdFunction, w io.Writer, chunks []*filer_pb.FileChunk, offset int64, size int64, unbuffered bool) error {
 
 	glog.V(9).Infof("start to stream content for chunks: %+v\n", chunks)
 	chunkViews := ViewFromChunks(masterClient.GetLookupFileIdFunction(), chunks, offset, size)
@@ -35,29 +46,118 @@ func StreamContent(masterClient wdclient.HasLookupFileIdFunction, w io.Writer, c
 		fileId2Url[chunkView.FileId] = urlStrings
 	}
 
+	// the gaps between the chunks are holes of a sparse file, and read as zeros
+	pos := offset
 	for _, chunkView := range chunkViews {
 
-		urlStrings := fileId2Url[chunkView.FileId]
+		if chunkView.LogicOffset > pos {
+			if err := writeZero(w, chunkView.LogicOffset-pos); err != nil {
+				return fmt.Errorf("write zero: %v", err)
+			}
+		}
+		pos = chunkView.LogicOffset + int64(chunkView.Size)
+
 		start := time.Now()
-		data, err := retriedFetchChunkData(urlStrings, chunkView.CipherKey, chunkView.IsGzipped, chunkView.IsFullChunk(), chunkView.Offset, int(chunkView.Size))
+		err := streamChunkView(masterClient, w, chunkView, fileId2Url[chunkView.FileId], unbuffered)
 		stats.FilerRequestHistogram.WithLabelValues("chunkDownload").Observe(time.Since(start).Seconds())
 		if err != nil {
 			stats.FilerRequestCounter.WithLabelValues("chunkDownloadError").Inc()
-			return fmt.Errorf("read chunk: %v", err)
+			return err
 		}
+		stats.FilerRequestCounter.WithLabelValues("chunkDownload").Inc()
+	}
 
-		_, err = w.Write(data)
-		if err != nil {
-			stats.FilerRequestCounter.WithLabelValues("chunkDownloadedError").Inc()
-			return fmt.Errorf("write chunk: %v", err)
+	// the size is math.MaxInt64 to read all the chunks, without knowing the file size
+	if size != math.MaxInt64 && offset+size > pos {
+		if err := writeZero(w, offset+size-pos); err != nil {
+			return fmt.Errorf("write zero: %v", err)
 		}
-		stats.FilerRequestCounter.WithLabelValues("chunkDownload").Inc()
 	}
 
 	return nil
 
 }
 
+// streamChunkView writes the chunk view to w. If reading the chunk fails, e.g., the volume has moved
+// during a long download, the volume locations are looked up again, and the chunk view is resumed
+// from the failed offset, instead of failing the whole download.
+func streamChunkView(masterClient wdclient.HasLookupFileIdFunction, w io.Writer, chunkView *ChunkView, urlStrings []string, unbuffered bool) (err error) {
+
+	var written int64
+	for waitTime := time.Second; ; waitTime += waitTime / 2 {
+		if unbuffered {
+			cw := &chunkViewWriter{w: w}
+			// resuming reads the rest of the chunk view by its range
+			err = retriedStreamFetchChunkData(cw, urlStrings, chunkView.CipherKey, chunkView.IsGzipped, written == 0 && chunkView.IsFullChunk(),
+				chunkView.Offset+written, int(int64(chunkView.Size)-written))
+			written += cw.written
+			if cw.writeErr != nil {
+				return fmt.Errorf("write chunk: %v", cw.writeErr)
+			}
+			if err == nil {
+				return nil
+			}
+			err = fmt.Errorf("stream chunk: %v", err)
+		} else {
+			var data []byte
+			data, err = retriedFetchChunkData(urlStrings, chunkView.CipherKey, chunkView.IsGzipped, chunkView.IsFullChunk(), chunkView.Offset, int(chunkView.Size))
+			if err == nil {
+				if _, err = w.Write(data); err != nil {
+					stats.FilerRequestCounter.WithLabelValues("chunkDownloadedError").Inc()
+					return fmt.Errorf("write chunk: %v", err)
+				}
+				return nil
+			}
+			err = fmt.Errorf("read chunk: %v", err)
+		}
+
+		if waitTime >= util.RetryWaitTime {
+			return err
+		}
+		glog.V(0).Infof("read %s at %d/%d: %v, look up the volume again in %v", chunkView.FileId, written, chunkView.Size, err, waitTime)
+		time.Sleep(waitTime)
+		if refresher, ok := masterClient.(wdclient.HasRefreshFileIdLocationsFunction); ok {
+			if refreshErr := refresher.RefreshFileIdLocations(chunkView.FileId); refreshErr != nil {
+				glog.V(0).Infof("refresh locations of %s: %v", chunkView.FileId, refreshErr)
+			}
+		}
+		if newUrlStrings, lookupErr := masterClient.GetLookupFileIdFunction()(chunkView.FileId); lookupErr != nil {
+			glog.V(0).Infof("look up %s again: %v", chunkView.FileId, lookupErr)
+		} else if len(newUrlStrings) > 0 {
+			urlStrings = newUrlStrings
+		}
+	}
+}
+
+// chunkViewWriter counts the bytes written, and keeps the write error apart from the read errors
+type chunkViewWriter struct {
+	w        io.Writer
+	written  int64
+	writeErr error
+}
+
+func (cw *chunkViewWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.w.Write(p)
+	cw.written += int64(n)
+	if err != nil {
+		cw.writeErr = err
+	}
+	return
+}
+
+var zeroBuffer = make([]byte, 64*1024)
+
+func writeZero(w io.Writer, size int64) error {
+	for size > 0 {
+		n, err := w.Write(zeroBuffer[:min(size, int64(len(zeroBuffer)))])
+		if err != nil {
+			return err
+		}
+		size -= int64(n)
+	}
+	return nil
+}
+
 // ----------------  ReadAllReader ----------------------------------
 
 func ReadAll(masterClient *wdclient.MasterClient, chunks []*filer_pb.FileChunk) ([]byte, error) {
@@ -71,6 +171,9 @@ func ReadAll(masterClient *wdclient.MasterClient, chunks []*filer_pb.FileChunk)
 	chunkViews := ViewFromChunks(lookupFileIdFn, chunks, 0, math.MaxInt64)
 
 	for _, chunkView := range chunkViews {
+		if gap := chunkView.LogicOffset - int64(buffer.Len()); gap > 0 {
+			writeZero(&buffer, gap)
+		}
 		urlStrings, err := lookupFileIdFn(chunkView.FileId)
 		if err != nil {
 			glog.V(1).Infof("operation LookupFileId %s failed, err: %v", chunkView.FileId, err)
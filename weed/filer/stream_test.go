@@ -0,0 +1,102 @@
+package filer
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/wdclient"
+)
+
+// movingVolumeLookup returns the old volume server until the locations are refreshed
+type movingVolumeLookup struct {
+	sync.Mutex
+	urls      []string
+	newUrls   []string
+	refreshed int
+}
+
+func (l *movingVolumeLookup) GetLookupFileIdFunction() wdclient.LookupFileIdFunctionType {
+	return func(fileId string) ([]string, error) {
+		l.Lock()
+		defer l.Unlock()
+		var urls []string
+		for _, u := range l.urls {
+			urls = append(urls, u+"/"+fileId)
+		}
+		return urls, nil
+	}
+}
+
+func (l *movingVolumeLookup) RefreshFileIdLocations(fileId string) error {
+	l.Lock()
+	defer l.Unlock()
+	l.refreshed++
+	l.urls = l.newUrls
+	return nil
+}
+
+func TestStreamContentAfterVolumeMove(t *testing.T) {
+	data := make([]byte, 512*1024)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	// the old volume server breaks the connection after sending part of the data, and then the volume is gone
+	var oldRequests int
+	oldServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		oldRequests++
+		if oldRequests > 1 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data[:100*1024])
+		w.(http.Flusher).Flush()
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer oldServer.Close()
+	var newRanges []string
+	newServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		newRanges = append(newRanges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer newServer.Close()
+
+	chunks := []*filer_pb.FileChunk{{FileId: "3,01637037d6", Offset: 0, Size: uint64(len(data))}}
+
+	for _, unbuffered := range []bool{true, false} {
+		oldRequests = 0
+		newRanges = nil
+		lookup := &movingVolumeLookup{urls: []string{oldServer.URL}, newUrls: []string{newServer.URL}}
+
+		var buf bytes.Buffer
+		var err error
+		if unbuffered {
+			err = StreamContentUnbuffered(lookup, &buf, chunks, 0, int64(len(data)))
+		} else {
+			err = StreamContent(lookup, &buf, chunks, 0, int64(len(data)))
+		}
+		if err != nil {
+			t.Fatalf("stream content unbuffered=%v: %v", unbuffered, err)
+		}
+		assert.True(t, bytes.Equal(buf.Bytes(), data), "unbuffered=%v received %d bytes", unbuffered, buf.Len())
+		assert.Equal(t, 1, lookup.refreshed)
+		assert.Equal(t, 1, len(newRanges))
+		if unbuffered {
+			// resumed from the failed offset
+			assert.True(t, strings.HasPrefix(newRanges[0], "bytes=") && !strings.HasPrefix(newRanges[0], "bytes=0-"), "range %s", newRanges[0])
+		} else {
+			assert.Equal(t, "", newRanges[0])
+		}
+	}
+}
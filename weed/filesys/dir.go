@@ -62,7 +62,8 @@ func (dir *Dir) Attr(ctx context.Context, attr *fuse.Attr) error {
 
 	// https://github.com/bazil/fuse/issues/196
 	attr.Valid = time.Second
-	attr.Inode = dir.Id()
+	attr.Inode = dir.inode(entry)
+	attr.Nlink = dir.nlink()
 	attr.Mode = os.FileMode(entry.Attributes.FileMode) | os.ModeDir
 	attr.Mtime = time.Unix(entry.Attributes.Mtime, 0)
 	attr.Crtime = time.Unix(entry.Attributes.Crtime, 0)
@@ -314,7 +315,7 @@ func (dir *Dir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.
 		}
 
 		// resp.EntryValid = time.Second
-		resp.Attr.Inode = fullFilePath.AsInode()
+		resp.Attr.Inode = inodeOf(fullFilePath, localEntry.Attr.Inode)
 		resp.Attr.Valid = time.Second
 		resp.Attr.Size = localEntry.FileSize
 		resp.Attr.Mtime = localEntry.Attr.Mtime
@@ -340,10 +341,10 @@ func (dir *Dir) ReadDirAll(ctx context.Context) (ret []fuse.Dirent, err error) {
 
 	processEachEntryFn := func(entry *filer.Entry, isLast bool) {
 		if entry.IsDirectory() {
-			dirent := fuse.Dirent{Name: entry.Name(), Type: fuse.DT_Dir, Inode: dirPath.Child(entry.Name()).AsInode()}
+			dirent := fuse.Dirent{Name: entry.Name(), Type: fuse.DT_Dir, Inode: inodeOf(entry.FullPath, entry.Attr.Inode)}
 			ret = append(ret, dirent)
 		} else {
-			dirent := fuse.Dirent{Name: entry.Name(), Type: findFileType(uint16(entry.Attr.Mode)), Inode: dirPath.Child(entry.Name()).AsInode()}
+			dirent := fuse.Dirent{Name: entry.Name(), Type: findFileType(uint16(entry.Attr.Mode)), Inode: inodeOf(entry.FullPath, entry.Attr.Inode)}
 			ret = append(ret, dirent)
 		}
 	}
@@ -363,7 +364,7 @@ func (dir *Dir) ReadDirAll(ctx context.Context) (ret []fuse.Dirent, err error) {
 
 	// create proper . and .. directories
 	ret = append(ret, fuse.Dirent{
-		Inode: dirPath.AsInode(),
+		Inode: dir.inode(nil),
 		Name:  ".",
 		Type:  fuse.DT_Dir,
 	})
@@ -373,7 +374,7 @@ func (dir *Dir) ReadDirAll(ctx context.Context) (ret []fuse.Dirent, err error) {
 	if string(dirPath) == dir.wfs.option.FilerMountRootPath {
 		inode = dir.wfs.option.MountParentInode
 	} else {
-		inode = util.FullPath(dir.parent.FullPath()).AsInode()
+		inode = dir.parent.inode(nil)
 	}
 
 	ret = append(ret, fuse.Dirent{
@@ -424,10 +425,16 @@ func (dir *Dir) removeOneFile(req *fuse.RemoveRequest) error {
 		return err
 	}
 
+	inodeId := filePath.AsInode()
+	dir.wfs.handlesLock.Lock()
+	_, isOpen := dir.wfs.handles[inodeId]
+	dir.wfs.handlesLock.Unlock()
+
 	// first, ensure the filer store can correctly delete
 	glog.V(3).Infof("remove file: %v", req)
 	isDeleteData := entry != nil && entry.HardLinkCounter <= 1
-	err = filer_pb.Remove(dir.wfs, dirFullPath, req.Name, isDeleteData, false, false, false, []int32{dir.wfs.signature})
+	// the open file handles can still read the data, which is deleted after the last one is closed
+	err = filer_pb.Remove(dir.wfs, dirFullPath, req.Name, isDeleteData && !isOpen, false, false, false, []int32{dir.wfs.signature})
 	if err != nil {
 		glog.V(3).Infof("not found remove file %s: %v", filePath, err)
 		return fuse.ENOENT
@@ -440,13 +447,7 @@ func (dir *Dir) removeOneFile(req *fuse.RemoveRequest) error {
 	}
 
 	// remove current file handle if any
-	dir.wfs.handlesLock.Lock()
-	defer dir.wfs.handlesLock.Unlock()
-	inodeId := filePath.AsInode()
-	if fh, ok := dir.wfs.handles[inodeId]; ok {
-		delete(dir.wfs.handles, inodeId)
-		fh.isDeleted = true
-	}
+	dir.wfs.detachRemovedFileHandle(inodeId, entry.Chunks, isDeleteData && isOpen)
 
 	return nil
 
@@ -557,6 +558,29 @@ func (dir *Dir) Forget() {
 	glog.V(4).Infof("Forget dir %s", dir.FullPath())
 }
 
+// inode returns the inode number reported to the kernel, loading the entry if not given
+func (dir *Dir) inode(entry *filer_pb.Entry) uint64 {
+	if dir.Id() == 1 {
+		return 1
+	}
+	if entry == nil {
+		entry, _ = dir.maybeLoadEntry()
+	}
+	if entry == nil || entry.Attributes == nil {
+		return dir.Id()
+	}
+	return inodeOf(util.FullPath(dir.FullPath()), entry.Attributes.Inode)
+}
+
+// nlink counts the sub directories if the directory is cached, and returns 1 otherwise
+func (dir *Dir) nlink() uint32 {
+	count, err := dir.wfs.metaCache.CountSubDirectories(context.Background(), util.FullPath(dir.FullPath()))
+	if err != nil {
+		return 1
+	}
+	return 2 + count
+}
+
 func (dir *Dir) maybeLoadEntry() (*filer_pb.Entry, error) {
 	parentDirPath, name := util.FullPath(dir.FullPath()).DirAndName()
 	return dir.wfs.maybeLoadEntry(parentDirPath, name)
@@ -40,6 +40,11 @@ func (dir *Dir) Link(ctx context.Context, req *fuse.LinkRequest, old fs.Node) (f
 		return nil, fuse.EIO
 	}
 
+	// the hard links share the same inode
+	if oldEntry.Attributes.Inode == 0 {
+		oldEntry.Attributes.Inode = oldFile.fullpath().AsInode()
+	}
+
 	// update old file to hardlink mode
 	if len(oldEntry.HardLinkId) == 0 {
 		oldEntry.HardLinkId = append(util.RandomBytes(16), HARD_LINK_MARKER)
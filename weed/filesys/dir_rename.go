@@ -30,17 +30,29 @@ func (dir *Dir) Rename(ctx context.Context, req *fuse.RenameRequest, newDirector
 		return fuse.ENOENT
 	}
 
+	// the open file handles of the replaced file can still read its data, deleted after the last one is closed
+	dir.wfs.handlesLock.Lock()
+	_, isTargetOpen := dir.wfs.handles[newPath.AsInode()]
+	dir.wfs.handlesLock.Unlock()
+	var targetEntry *filer.Entry
+	if isTargetOpen {
+		if targetEntry, err = dir.wfs.metaCache.FindEntry(context.Background(), newPath); err != nil || targetEntry.IsDirectory() {
+			isTargetOpen, targetEntry = false, nil
+		}
+	}
+
 	// update remote filer
 	err = dir.wfs.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
 		request := &filer_pb.AtomicRenameEntryRequest{
-			OldDirectory: dir.FullPath(),
-			OldName:      req.OldName,
-			NewDirectory: newDir.FullPath(),
-			NewName:      req.NewName,
-			Signatures:   []int32{dir.wfs.signature},
+			OldDirectory:     dir.FullPath(),
+			OldName:          req.OldName,
+			NewDirectory:     newDir.FullPath(),
+			NewName:          req.NewName,
+			Signatures:       []int32{dir.wfs.signature},
+			KeepReplacedData: isTargetOpen,
 		}
 
 		_, err := client.AtomicRenameEntry(ctx, request)
@@ -57,6 +69,11 @@ func (dir *Dir) Rename(ctx context.Context, req *fuse.RenameRequest, newDirector
 		return fuse.EIO
 	}
 
+	// the local state is changed only after the rename succeeds
+	if targetEntry != nil {
+		dir.wfs.detachRemovedFileHandle(newPath.AsInode(), targetEntry.Chunks, targetEntry.HardLinkCounter <= 1)
+	}
+
 	err = dir.moveEntry(context.Background(), util.FullPath(dir.FullPath()), oldEntry, util.FullPath(newDir.FullPath()), req.NewName)
 	if err != nil {
 		glog.V(0).Infof("dir local Rename %s => %s : %v", oldPath, newPath, err)
@@ -103,10 +120,11 @@ func (dir *Dir) moveEntry(ctx context.Context, oldParent util.FullPath, entry *f
 		// change file handle
 		inodeId := oldPath.AsInode()
 		dir.wfs.handlesLock.Lock()
-		if existingHandle, found := dir.wfs.handles[inodeId]; found && existingHandle == nil {
+		if existingHandle, found := dir.wfs.handles[inodeId]; found && existingHandle != nil {
 			glog.V(4).Infof("opened file handle %s => %s", oldPath, newPath)
 			delete(dir.wfs.handles, inodeId)
 			dir.wfs.handles[newPath.AsInode()] = existingHandle
+			existingHandle.handle = newPath.AsInode()
 		}
 		dir.wfs.handlesLock.Unlock()
 
@@ -153,6 +171,9 @@ func (dir *Dir) moveSelfEntry(ctx context.Context, oldParent util.FullPath, entr
 	newPath := newParent.Child(newName)
 	oldPath := oldParent.Child(entry.Name())
 
+	if entry.Attr.Inode == 0 {
+		entry.Attr.Inode = oldPath.AsInode()
+	}
 	entry.FullPath = newPath
 	if err := dir.wfs.metaCache.InsertEntry(ctx, entry); err != nil {
 		glog.V(0).Infof("dir Rename insert local %s => %s : %v", oldPath, newPath, err)
@@ -7,4 +7,5 @@ type DirtyPages interface {
 	GetStorageOptions() (collection, replication string)
 	SetWriteOnly(writeOnly bool)
 	GetWriteOnly() (writeOnly bool)
+	Destroy()
 }
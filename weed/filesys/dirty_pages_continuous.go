@@ -20,6 +20,7 @@ type ContinuousDirtyPages struct {
 	lastErr        error
 	collection     string
 	replication    string
+	chunkSize      int64
 }
 
 func newContinuousDirtyPages(file *File, writeOnly bool) *ContinuousDirtyPages {
@@ -27,6 +28,7 @@ func newContinuousDirtyPages(file *File, writeOnly bool) *ContinuousDirtyPages {
 		intervals: &ContinuousIntervals{},
 		f:         file,
 		writeOnly: writeOnly,
+		chunkSize: file.wfs.chunkSizeLimit(file.fullpath()),
 	}
 	return dirtyPages
 }
@@ -35,14 +37,14 @@ func (pages *ContinuousDirtyPages) AddPage(offset int64, data []byte) {
 
 	glog.V(4).Infof("%s AddPage [%d,%d)", pages.f.fullpath(), offset, offset+int64(len(data)))
 
-	if len(data) > int(pages.f.wfs.option.ChunkSizeLimit) {
+	if len(data) > int(pages.chunkSize) {
 		// this is more than what buffer can hold.
 		pages.flushAndSave(offset, data)
 	}
 
 	pages.intervals.AddInterval(data, offset)
 
-	if pages.intervals.TotalSize() >= pages.f.wfs.option.ChunkSizeLimit {
+	if pages.intervals.TotalSize() >= pages.chunkSize {
 		pages.saveExistingLargestPageToStorage()
 	}
 
@@ -158,3 +160,6 @@ func (pages *ContinuousDirtyPages) SetWriteOnly(writeOnly bool) {
 func (pages *ContinuousDirtyPages) GetWriteOnly() (writeOnly bool) {
 	return pages.writeOnly
 }
+
+func (pages *ContinuousDirtyPages) Destroy() {
+}
@@ -21,14 +21,19 @@ type TempFileDirtyPages struct {
 	lastErr          error
 	collection       string
 	replication      string
+	chunkSize        int64
+	dirtyBytes       int64 // written but not uploaded yet
+	owner            dirtyFlusher
 }
 
-func newTempFileDirtyPages(file *File, writeOnly bool) *TempFileDirtyPages {
+func newTempFileDirtyPages(file *File, owner dirtyFlusher, writeOnly bool) *TempFileDirtyPages {
 
 	tempFile := &TempFileDirtyPages{
 		f:                file,
+		owner:            owner,
 		writeOnly:        writeOnly,
 		writtenIntervals: &WrittenContinuousIntervals{},
+		chunkSize:        file.wfs.chunkSizeLimit(file.fullpath()),
 	}
 
 	return tempFile
@@ -61,6 +66,8 @@ func (pages *TempFileDirtyPages) AddPage(offset int64, data []byte) {
 	} else {
 		pages.writtenIntervals.AddInterval(writtenOffset, len(data), offset)
 		pages.writtenIntervals.lastOffset += dataSize
+		pages.dirtyBytes += dataSize
+		pages.f.wfs.dirtyLimiter.addDirty(pages.owner, dataSize)
 	}
 
 	// pages.writtenIntervals.debug()
@@ -72,11 +79,23 @@ func (pages *TempFileDirtyPages) FlushData() error {
 
 	pages.saveExistingPagesToStorage()
 	pages.writeWaitGroup.Wait()
+	pages.pageAddLock.Lock()
+	pages.f.wfs.dirtyLimiter.removeDirty(pages.owner, pages.dirtyBytes)
+	pages.dirtyBytes = 0
+	pages.pageAddLock.Unlock()
 	if pages.lastErr != nil {
 		return fmt.Errorf("flush data: %v", pages.lastErr)
 	}
+	pages.Destroy()
+	return nil
+}
+
+// Destroy removes the temp file, and drops the data not uploaded yet
+func (pages *TempFileDirtyPages) Destroy() {
 	pages.pageAddLock.Lock()
 	defer pages.pageAddLock.Unlock()
+	pages.f.wfs.dirtyLimiter.removeDirty(pages.owner, pages.dirtyBytes)
+	pages.dirtyBytes = 0
 	if pages.tf != nil {
 
 		pages.writtenIntervals.tempFile = nil
@@ -86,12 +105,11 @@ func (pages *TempFileDirtyPages) FlushData() error {
 		os.Remove(pages.tf.Name())
 		pages.tf = nil
 	}
-	return nil
 }
 
 func (pages *TempFileDirtyPages) saveExistingPagesToStorage() {
 
-	pageSize := pages.f.wfs.option.ChunkSizeLimit
+	pageSize := pages.chunkSize
 
 	// glog.V(4).Infof("%v saveExistingPagesToStorage %d lists", pages.f.Name, len(pages.writtenIntervals.lists))
 
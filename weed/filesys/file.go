@@ -59,7 +59,7 @@ func (file *File) Attr(ctx context.Context, attr *fuse.Attr) (err error) {
 		return fuse.ENOENT
 	}
 
-	attr.Inode = file.Id()
+	attr.Inode = inodeOf(file.fullpath(), entry.Attributes.Inode)
 	attr.Valid = time.Second
 	attr.Mode = os.FileMode(entry.Attributes.FileMode)
 	attr.Size = filer.FileSize(entry)
@@ -72,7 +72,7 @@ func (file *File) Attr(ctx context.Context, attr *fuse.Attr) (err error) {
 	attr.Gid = entry.Attributes.Gid
 	attr.Uid = entry.Attributes.Uid
 	attr.Blocks = attr.Size/blockSize + 1
-	attr.BlockSize = uint32(file.wfs.option.ChunkSizeLimit)
+	attr.BlockSize = uint32(file.wfs.chunkSizeLimit(file.fullpath()))
 	if entry.HardLinkCounter > 0 {
 		attr.Nlink = uint32(entry.HardLinkCounter)
 	}
@@ -101,6 +101,12 @@ func (file *File) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.Op
 
 	resp.Handle = fuse.HandleID(handle.handle)
 
+	if file.wfs.option.KeepPageCache && req.Flags.IsReadOnly() {
+		if entry, err := file.maybeLoadEntry(ctx); err == nil && entry != nil && file.wfs.isPageCacheUnchanged(file.Id(), entry) {
+			resp.Flags |= fuse.OpenKeepCache
+		}
+	}
+
 	glog.V(4).Infof("%v file open handle id = %d", file.fullpath(), handle.handle)
 
 	return handle, nil
@@ -247,11 +253,17 @@ func (file *File) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, res
 }
 
 func (file *File) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
-	// fsync works at OS level
-	// write the file chunks to the filerGrpcAddress
+	// wait for the open file handle to upload the data and save the metadata to the filer
 	glog.V(4).Infof("%s/%s fsync file %+v", file.dir.FullPath(), file.Name, req)
 
-	return nil
+	file.wfs.handlesLock.Lock()
+	handle, found := file.wfs.handles[file.Id()]
+	file.wfs.handlesLock.Unlock()
+	if !found {
+		return nil
+	}
+
+	return handle.Fsync(ctx, req)
 }
 
 func (file *File) Forget() {
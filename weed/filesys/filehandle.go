@@ -34,16 +34,23 @@ type FileHandle struct {
 	Gid       uint32         // group ID of process making request
 	writeOnly bool
 	isDeleted bool
+	// the file is removed while open, and its data is deleted after the last close
+	deleteChunksOnRelease bool
+
+	// the scheduled background flush with -writeBack, and the error of the flushes in the background,
+	// returned by the next Flush, Fsync, or Release
+	backgroundFlushDone chan struct{}
+	backgroundFlushErr  error
 }
 
 func newFileHandle(file *File, uid, gid uint32, writeOnly bool) *FileHandle {
 	fh := &FileHandle{
-		f: file,
-		// dirtyPages: newContinuousDirtyPages(file, writeOnly),
-		dirtyPages: newTempFileDirtyPages(file, writeOnly),
-		Uid:        uid,
-		Gid:        gid,
+		f:   file,
+		Uid: uid,
+		Gid: gid,
 	}
+	// fh.dirtyPages = newContinuousDirtyPages(file, writeOnly)
+	fh.dirtyPages = newTempFileDirtyPages(file, fh, writeOnly)
 	entry := fh.f.getEntry()
 	if entry != nil {
 		entry.Attributes.FileSize = filer.FileSize(entry)
@@ -158,6 +165,9 @@ func (fh *FileHandle) readFromChunks(buff []byte, offset int64) (int64, error) {
 // Write to the file handle
 func (fh *FileHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
 
+	fh.f.wfs.dirtyLimiter.waitForBackgroundFlushes()
+	fh.f.wfs.dirtyLimiter.flushOverLimit()
+
 	fh.Lock()
 	defer fh.Unlock()
 
@@ -200,23 +210,41 @@ func (fh *FileHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) err
 	fh.Lock()
 	defer fh.Unlock()
 
+	err := fh.takeBackgroundFlushErr()
+
+	fh.releaseOpen()
+
+	if err != nil {
+		glog.Errorf("Release %s: %v", fh.f.fullpath(), err)
+		return fuse.EIO
+	}
+	return nil
+}
+
+// releaseOpen is called with the file handle locked
+func (fh *FileHandle) releaseOpen() {
+
 	fh.f.isOpen--
 
 	if fh.f.isOpen <= 0 {
+		fh.dirtyPages.Destroy()
+		if fh.isDeleted {
+			// the handle is already removed, and another file may be using the same inode
+			if entry := fh.f.getEntry(); fh.deleteChunksOnRelease && entry != nil {
+				fh.f.wfs.deleteFileChunks(entry.Chunks)
+			}
+		} else {
+			fh.f.wfs.ReleaseHandle(fh.f.fullpath(), fuse.HandleID(fh.handle))
+		}
 		fh.f.entry = nil
 		fh.entryViewCache = nil
 		fh.reader = nil
-
-		fh.f.wfs.ReleaseHandle(fh.f.fullpath(), fuse.HandleID(fh.handle))
 	}
 
 	if fh.f.isOpen < 0 {
 		glog.V(0).Infof("Release reset %s open count %d => %d", fh.f.Name, fh.f.isOpen, 0)
 		fh.f.isOpen = 0
-		return nil
 	}
-
-	return nil
 }
 
 func (fh *FileHandle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
@@ -231,15 +259,45 @@ func (fh *FileHandle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
 	fh.Lock()
 	defer fh.Unlock()
 
-	if err := fh.doFlush(ctx, req.Header); err != nil {
+	// the earlier flushes in the background failed
+	backgroundFlushErr := fh.takeBackgroundFlushErr()
+	if backgroundFlushErr != nil {
+		glog.Errorf("Flush %s: %v", fh.f.fullpath(), backgroundFlushErr)
+	}
+
+	if fh.f.wfs.option.WriteBack && fh.f.dirtyMetadata {
+		fh.flushInBackground(req.Header)
+	} else if err := fh.doFlush(ctx, req.Header); err != nil {
 		glog.Errorf("Flush doFlush %s: %v", fh.f.Name, err)
 		return err
 	}
+	if backgroundFlushErr != nil {
+		return fuse.EIO
+	}
 
 	glog.V(4).Infof("Flush %v fh %d success", fh.f.fullpath(), fh.handle)
 	return nil
 }
 
+// Fsync waits until the written data is uploaded and the file metadata is saved on the filer
+func (fh *FileHandle) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
+
+	glog.V(4).Infof("Fsync %v fh %d", fh.f.fullpath(), fh.handle)
+
+	fh.Lock()
+	defer fh.Unlock()
+
+	if err := fh.waitForBackgroundFlush(); err != nil {
+		return fuse.EIO
+	}
+
+	if fh.isDeleted {
+		return nil
+	}
+
+	return fh.doFlush(ctx, req.Header)
+}
+
 func (fh *FileHandle) doFlush(ctx context.Context, header fuse.Header) error {
 	// flush works at fh level
 	// send the data to the OS
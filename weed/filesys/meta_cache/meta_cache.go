@@ -8,7 +8,9 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/util"
 	"github.com/chrislusf/seaweedfs/weed/util/bounded_tree"
+	"math"
 	"os"
+	"sync"
 )
 
 // need to have logic similar to FilerStoreWrapper
@@ -20,6 +22,11 @@ type MetaCache struct {
 	visitedBoundary *bounded_tree.BoundedTree
 	uidGidMapper    *UidGidMapper
 	invalidateFunc  func(util.FullPath)
+
+	// the sub directory counts of the listed directories, forgotten when the entries in them change
+	subDirCounts     map[util.FullPath]uint32
+	subDirCountsGen  uint64
+	subDirCountsLock sync.Mutex
 }
 
 func NewMetaCache(dbFolder string, baseDir util.FullPath, uidGidMapper *UidGidMapper, invalidateFunc func(util.FullPath)) *MetaCache {
@@ -27,6 +34,7 @@ func NewMetaCache(dbFolder string, baseDir util.FullPath, uidGidMapper *UidGidMa
 		localStore:      openMetaStore(dbFolder),
 		visitedBoundary: bounded_tree.NewBoundedTree(baseDir),
 		uidGidMapper:    uidGidMapper,
+		subDirCounts:    make(map[util.FullPath]uint32),
 		invalidateFunc: func(fullpath util.FullPath) {
 			invalidateFunc(fullpath)
 		},
@@ -58,6 +66,7 @@ func (mc *MetaCache) InsertEntry(ctx context.Context, entry *filer.Entry) error
 }
 
 func (mc *MetaCache) doInsertEntry(ctx context.Context, entry *filer.Entry) error {
+	mc.forgetSubDirCount(entry.FullPath)
 	return mc.localStore.InsertEntry(ctx, entry)
 }
 
@@ -73,6 +82,7 @@ func (mc *MetaCache) AtomicUpdateEntryFromFiler(ctx context.Context, oldPath uti
 				// leave the update to the following InsertEntry operation
 			} else {
 				glog.V(3).Infof("DeleteEntry %s", oldPath)
+				mc.forgetSubDirCount(oldPath)
 				if err := mc.localStore.DeleteEntry(ctx, oldPath); err != nil {
 					return err
 				}
@@ -86,6 +96,7 @@ func (mc *MetaCache) AtomicUpdateEntryFromFiler(ctx context.Context, oldPath uti
 		newDir, _ := newEntry.DirAndName()
 		if mc.visitedBoundary.HasVisited(util.FullPath(newDir)) {
 			glog.V(3).Infof("InsertEntry %s/%s", newDir, newEntry.Name())
+			mc.forgetSubDirCount(newEntry.FullPath)
 			if err := mc.localStore.InsertEntry(ctx, newEntry); err != nil {
 				return err
 			}
@@ -97,6 +108,7 @@ func (mc *MetaCache) AtomicUpdateEntryFromFiler(ctx context.Context, oldPath uti
 func (mc *MetaCache) UpdateEntry(ctx context.Context, entry *filer.Entry) error {
 	//mc.Lock()
 	//defer mc.Unlock()
+	mc.forgetSubDirCount(entry.FullPath)
 	return mc.localStore.UpdateEntry(ctx, entry)
 }
 
@@ -114,6 +126,7 @@ func (mc *MetaCache) FindEntry(ctx context.Context, fp util.FullPath) (entry *fi
 func (mc *MetaCache) DeleteEntry(ctx context.Context, fp util.FullPath) (err error) {
 	//mc.Lock()
 	//defer mc.Unlock()
+	mc.forgetSubDirCount(fp)
 	return mc.localStore.DeleteEntry(ctx, fp)
 }
 
@@ -135,6 +148,45 @@ func (mc *MetaCache) ListDirectoryEntries(ctx context.Context, dirPath util.Full
 	return err
 }
 
+// CountSubDirectories counts the sub directories of a cached directory, only listing it again after its entries change
+func (mc *MetaCache) CountSubDirectories(ctx context.Context, dirPath util.FullPath) (uint32, error) {
+	mc.subDirCountsLock.Lock()
+	count, found := mc.subDirCounts[dirPath]
+	gen := mc.subDirCountsGen
+	mc.subDirCountsLock.Unlock()
+	if found {
+		return count, nil
+	}
+
+	err := mc.ListDirectoryEntries(ctx, dirPath, "", false, int64(math.MaxInt32), func(entry *filer.Entry) bool {
+		if entry.IsDirectory() {
+			count++
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	mc.subDirCountsLock.Lock()
+	// the entries changed while listing
+	if gen == mc.subDirCountsGen {
+		mc.subDirCounts[dirPath] = count
+	}
+	mc.subDirCountsLock.Unlock()
+	return count, nil
+}
+
+// forgetSubDirCount forgets the counts of the directory containing the changed entry, and of the entry itself
+func (mc *MetaCache) forgetSubDirCount(fp util.FullPath) {
+	dir, _ := fp.DirAndName()
+	mc.subDirCountsLock.Lock()
+	delete(mc.subDirCounts, util.FullPath(dir))
+	delete(mc.subDirCounts, fp)
+	mc.subDirCountsGen++
+	mc.subDirCountsLock.Unlock()
+}
+
 func (mc *MetaCache) Shutdown() {
 	//mc.Lock()
 	//defer mc.Unlock()
@@ -0,0 +1,27 @@
+package filesys
+
+import (
+	"fmt"
+
+	"github.com/chrislusf/seaweedfs/weed/filer"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+)
+
+// isPageCacheUnchanged checks whether the file is the same as when it was last opened,
+// so the kernel can serve the reads from its page cache without calling the mount.
+// The kernel page cache is invalidated when the file is changed by other clients.
+func (wfs *WFS) isPageCacheUnchanged(inode uint64, entry *filer_pb.Entry) bool {
+	version := fmt.Sprintf("%d-%d-%s", filer.FileSize(entry), entry.Attributes.GetMtime(), filer.ETag(entry))
+
+	wfs.pageCacheVersionsLock.Lock()
+	defer wfs.pageCacheVersionsLock.Unlock()
+	previous, found := wfs.pageCacheVersions[inode]
+	wfs.pageCacheVersions[inode] = version
+	return found && previous == version
+}
+
+func (wfs *WFS) forgetPageCacheVersion(inode uint64) {
+	wfs.pageCacheVersionsLock.Lock()
+	defer wfs.pageCacheVersionsLock.Unlock()
+	delete(wfs.pageCacheVersions, inode)
+}
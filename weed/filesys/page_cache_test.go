@@ -0,0 +1,36 @@
+package filesys
+
+import (
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestPageCacheVersion(t *testing.T) {
+	wfs := &WFS{pageCacheVersions: make(map[uint64]string)}
+	entry := &filer_pb.Entry{
+		Name:       "a.txt",
+		Attributes: &filer_pb.FuseAttributes{FileSize: 6, Mtime: 1},
+		Chunks:     []*filer_pb.FileChunk{{FileId: "1,01", Size: 6, ETag: "sZRqySSS0jR8YjW00mERhA=="}},
+	}
+
+	if wfs.isPageCacheUnchanged(7, entry) {
+		t.Errorf("the first open should not keep the page cache")
+	}
+	if !wfs.isPageCacheUnchanged(7, entry) {
+		t.Errorf("an unchanged file should keep the page cache")
+	}
+
+	entry.Chunks[0].ETag = "1B2M2Y8AsgTpgAmY7PhCfg=="
+	if wfs.isPageCacheUnchanged(7, entry) {
+		t.Errorf("a changed file should not keep the page cache")
+	}
+	if !wfs.isPageCacheUnchanged(7, entry) {
+		t.Errorf("the changed file should keep the page cache after reopening")
+	}
+
+	wfs.forgetPageCacheVersion(7)
+	if wfs.isPageCacheUnchanged(7, entry) {
+		t.Errorf("an invalidated file should not keep the page cache")
+	}
+}
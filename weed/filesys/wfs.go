@@ -9,6 +9,7 @@ import (
 	"path"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chrislusf/seaweedfs/weed/filer"
@@ -44,8 +45,14 @@ type Option struct {
 	ConcurrentWriters  int
 	CacheDir           string
 	CacheSizeMB        int64
+	CacheService       string // the unix socket of a shared chunk cache
 	DataCenter         string
+	ReplicaSelector    *wdclient.ReplicaSelector
 	Umask              os.FileMode
+	KeepPageCache      bool // keep the kernel page cache of unchanged files between opens
+	WriteBack          bool // flush the closed files in the background
+	WriteBackFlushers  int  // the number of closed files flushed in the background at the same time
+	DirtyLimitMB       int64
 
 	MountUid         uint32
 	MountGid         uint32
@@ -79,13 +86,25 @@ type WFS struct {
 	root        fs.Node
 	fsNodeCache *FsCache
 
-	chunkCache *chunk_cache.TieredChunkCache
+	chunkCache chunk_cache.ChunkCache
 	metaCache  *meta_cache.MetaCache
 	signature  int32
 
+	// the storage rules of filer.conf, for the chunk size of each location.
+	// *filer.FilerConf, replaced by the subscription while read by the writes
+	filerConf atomic.Value
+
 	// throttle writers
 	concurrentWriters *util.LimitedConcurrentExecutor
 	Server            *fs.Server
+
+	// bound the data not uploaded yet, and the files flushed in the background
+	dirtyLimiter      *dirtyLimiter
+	writeBackFlushers chan struct{}
+
+	// the file versions in the kernel page cache, by inode
+	pageCacheVersionsLock sync.Mutex
+	pageCacheVersions     map[uint64]string
 }
 type statsCache struct {
 	filer_pb.StatisticsResponse
@@ -101,16 +120,31 @@ func NewSeaweedFileSystem(option *Option) *WFS {
 				return make([]byte, option.ChunkSizeLimit)
 			},
 		},
-		signature: util.RandomInt32(),
+		signature:         util.RandomInt32(),
+		pageCacheVersions: make(map[uint64]string),
+		dirtyLimiter:      newDirtyLimiter(option.DirtyLimitMB * 1024 * 1024),
+	}
+	if option.WriteBack {
+		flushers := option.WriteBackFlushers
+		if flushers <= 0 {
+			flushers = 1
+		}
+		wfs.writeBackFlushers = make(chan struct{}, flushers)
 	}
 	wfs.option.filerIndex = rand.Intn(len(option.FilerAddresses))
 	wfs.option.setupUniqueCacheDirectory()
-	if option.CacheSizeMB > 0 {
-		wfs.chunkCache = chunk_cache.NewTieredChunkCache(256, option.getUniqueCacheDir(), option.CacheSizeMB, 1024*1024)
+	var chunkCache *chunk_cache.TieredChunkCache
+	if option.CacheSizeMB > 0 && option.CacheService == "" {
+		chunkCache = chunk_cache.NewTieredChunkCache(256, option.getUniqueCacheDir(), option.CacheSizeMB, 1024*1024)
+	}
+	wfs.chunkCache = chunkCache
+	if option.CacheService != "" {
+		wfs.chunkCache = chunk_cache.NewRemoteChunkCache(option.CacheService)
 	}
 
 	wfs.metaCache = meta_cache.NewMetaCache(path.Join(option.getUniqueCacheDir(), "meta"), util.FullPath(option.FilerMountRootPath), option.UidGidMapper, func(filePath util.FullPath) {
 
+		wfs.forgetPageCacheVersion(filePath.AsInode())
 		fsNode := NodeWithId(filePath.AsInode())
 		if err := wfs.Server.InvalidateNodeData(fsNode); err != nil {
 			glog.V(4).Infof("InvalidateNodeData %s : %v", filePath, err)
@@ -126,6 +160,7 @@ func NewSeaweedFileSystem(option *Option) *WFS {
 		}
 	})
 	grace.OnInterrupt(func() {
+		wfs.dirtyLimiter.waitForAllFlushes()
 		wfs.metaCache.Shutdown()
 	})
 
@@ -142,6 +177,8 @@ func NewSeaweedFileSystem(option *Option) *WFS {
 func (wfs *WFS) StartBackgroundTasks() {
 	startTime := time.Now()
 	go meta_cache.SubscribeMetaEvents(wfs.metaCache, wfs.signature, wfs, wfs.option.FilerMountRootPath, startTime.UnixNano())
+	wfs.loadFilerConf()
+	go wfs.subscribeFilerConf(startTime.UnixNano())
 }
 
 func (wfs *WFS) Root() (fs.Node, error) {
@@ -272,7 +309,7 @@ func (wfs *WFS) LookupFn() wdclient.LookupFileIdFunctionType {
 			return []string{"http://" + wfs.getCurrentFiler() + "/?proxyChunkId=" + fileId}, nil
 		}
 	}
-	return filer.LookupFn(wfs)
+	return filer.LookupFnWithReplicaSelector(wfs, wfs.option.ReplicaSelector)
 }
 func (wfs *WFS) getCurrentFiler() string {
 	return wfs.option.FilerAddresses[wfs.option.filerIndex]
@@ -292,6 +329,15 @@ func (option *Option) getUniqueCacheDir() string {
 	return option.uniqueCacheDir
 }
 
+// inodeOf returns the inode number reported to the kernel, which is kept when the entry is renamed.
+// The entries created before the inode numbers are assigned use the hash of the path.
+func inodeOf(fullpath util.FullPath, inode uint64) uint64 {
+	if inode != 0 {
+		return inode
+	}
+	return fullpath.AsInode()
+}
+
 type NodeWithId uint64
 
 func (n NodeWithId) Id() uint64 {
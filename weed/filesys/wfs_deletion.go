@@ -0,0 +1,74 @@
+package filesys
+
+import (
+	"context"
+
+	"github.com/chrislusf/seaweedfs/weed/filer"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+)
+
+// detachRemovedFileHandle keeps the open file handle of the removed or replaced file readable until it is closed.
+// With isDeleteData, the file data is deleted after the handle is closed, or right away if it is closed meanwhile.
+func (wfs *WFS) detachRemovedFileHandle(inodeId uint64, chunks []*filer_pb.FileChunk, isDeleteData bool) {
+	wfs.handlesLock.Lock()
+	fh, found := wfs.handles[inodeId]
+	if found {
+		delete(wfs.handles, inodeId)
+		fh.deleteChunksOnRelease = isDeleteData
+		fh.isDeleted = true
+	}
+	wfs.handlesLock.Unlock()
+
+	if isDeleteData && !found {
+		// the file is closed meanwhile
+		wfs.deleteFileChunks(chunks)
+	}
+}
+
+// deleteFileChunks deletes the chunks of a file removed from the filer while it was still open
+func (wfs *WFS) deleteFileChunks(chunks []*filer_pb.FileChunk) {
+	if len(chunks) == 0 {
+		return
+	}
+
+	fileIds, manifestResolveErr := filer.ResolveChunkFileIds(wfs.LookupFn(), chunks)
+	if manifestResolveErr != nil {
+		glog.V(0).Infof("failed to resolve manifest: %v", manifestResolveErr)
+	}
+
+	err := wfs.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		lookupFunc := func(vids []string) (map[string]operation.LookupResult, error) {
+			m := make(map[string]operation.LookupResult)
+			resp, err := client.LookupVolume(context.Background(), &filer_pb.LookupVolumeRequest{
+				VolumeIds: vids,
+			})
+			if err != nil {
+				return m, err
+			}
+			for _, vid := range vids {
+				locations, found := resp.LocationsMap[vid]
+				if !found {
+					continue
+				}
+				lr := operation.LookupResult{
+					VolumeId: vid,
+				}
+				for _, loc := range locations.Locations {
+					lr.Locations = append(lr.Locations, operation.Location{
+						Url:       wfs.AdjustedUrl(loc),
+						PublicUrl: loc.PublicUrl,
+					})
+				}
+				m[vid] = lr
+			}
+			return m, nil
+		}
+		_, err := operation.DeleteFilesWithLookupVolumeId(wfs.option.GrpcDialOption, fileIds, lookupFunc)
+		return err
+	})
+	if err != nil {
+		glog.V(0).Infof("delete %d chunks: %v", len(fileIds), err)
+	}
+}
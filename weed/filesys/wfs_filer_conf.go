@@ -0,0 +1,91 @@
+package filesys
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// chunkSizeLimit is the chunk size configured for the file location in filer.conf, or the mount option by default
+func (wfs *WFS) chunkSizeLimit(fullpath util.FullPath) int64 {
+	if fc, ok := wfs.filerConf.Load().(*filer.FilerConf); ok {
+		if maxMB := fc.MatchStorageRule(string(fullpath)).MaxMb; maxMB > 0 {
+			return int64(maxMB) * 1024 * 1024
+		}
+	}
+	return wfs.option.ChunkSizeLimit
+}
+
+func (wfs *WFS) loadFilerConf() {
+	var content []byte
+	err := wfs.WithFilerClient(func(client filer_pb.SeaweedFilerClient) (err error) {
+		content, err = filer.ReadInsideFiler(client, filer.DirectoryEtcSeaweedFS, filer.FilerConfName)
+		return err
+	})
+	if err != nil && err != filer_pb.ErrNotFound {
+		glog.Errorf("read filer conf: %v", err)
+		return
+	}
+	wfs.reloadFilerConf(content)
+}
+
+func (wfs *WFS) reloadFilerConf(content []byte) {
+	fc := filer.NewFilerConf()
+	if len(content) > 0 {
+		if err := fc.LoadFromBytes(content); err != nil {
+			glog.Errorf("load filer conf: %v", err)
+			return
+		}
+	}
+	wfs.filerConf.Store(fc)
+}
+
+// subscribeFilerConf follows the filer.conf changes, which are usually outside of the mounted directory
+func (wfs *WFS) subscribeFilerConf(lastTsNs int64) {
+	for {
+		err := wfs.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stream, err := client.SubscribeMetadata(ctx, &filer_pb.SubscribeMetadataRequest{
+				ClientName: "mount",
+				PathPrefix: filer.DirectoryEtcSeaweedFS,
+				SinceNs:    lastTsNs,
+			})
+			if err != nil {
+				return fmt.Errorf("subscribe: %v", err)
+			}
+
+			for {
+				resp, listenErr := stream.Recv()
+				if listenErr == io.EOF {
+					return nil
+				}
+				if listenErr != nil {
+					return listenErr
+				}
+				message := resp.EventNotification
+				if message.OldEntry != nil && resp.Directory == filer.DirectoryEtcSeaweedFS && message.OldEntry.Name == filer.FilerConfName {
+					wfs.reloadFilerConf(nil)
+				}
+				newDir := resp.Directory
+				if message.NewParentPath != "" {
+					newDir = message.NewParentPath
+				}
+				if message.NewEntry != nil && newDir == filer.DirectoryEtcSeaweedFS && message.NewEntry.Name == filer.FilerConfName {
+					wfs.reloadFilerConf(message.NewEntry.Content)
+				}
+				lastTsNs = resp.TsNs
+			}
+		})
+		if err != nil {
+			glog.Errorf("subscribing filer conf change: %v", err)
+		}
+		time.Sleep(time.Second)
+	}
+}
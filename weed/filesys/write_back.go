@@ -0,0 +1,214 @@
+package filesys
+
+import (
+	"context"
+	"sync"
+
+	"github.com/seaweedfs/fuse"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+)
+
+// dirtyFlusher uploads the dirty data of a file handle, to bring the dirty bytes under the limit
+type dirtyFlusher interface {
+	flushDirtyData()
+}
+
+// dirtyLimiter bounds the bytes written to the mount but not uploaded to volume servers yet
+type dirtyLimiter struct {
+	sync.Mutex
+	cond         *sync.Cond
+	limit        int64
+	lowWatermark int64 // the dirty bytes are flushed down to it once over the limit
+	dirtyBytes   int64
+	flushing     int                    // the files being flushed in the background
+	dirtyFiles   map[dirtyFlusher]int64 // the dirty bytes of each file handle
+	evicting     map[dirtyFlusher]bool  // the file handles being flushed for the limit
+}
+
+func newDirtyLimiter(limit int64) *dirtyLimiter {
+	l := &dirtyLimiter{
+		limit:        limit,
+		lowWatermark: limit / 4 * 3,
+		dirtyFiles:   make(map[dirtyFlusher]int64),
+		evicting:     make(map[dirtyFlusher]bool),
+	}
+	l.cond = sync.NewCond(&l.Mutex)
+	return l
+}
+
+func (l *dirtyLimiter) addDirty(owner dirtyFlusher, n int64) {
+	l.Lock()
+	l.dirtyBytes += n
+	if owner != nil {
+		l.dirtyFiles[owner] += n
+	}
+	l.Unlock()
+}
+
+func (l *dirtyLimiter) removeDirty(owner dirtyFlusher, n int64) {
+	if n == 0 {
+		return
+	}
+	l.Lock()
+	l.dirtyBytes -= n
+	if owner != nil {
+		if l.dirtyFiles[owner] -= n; l.dirtyFiles[owner] <= 0 {
+			delete(l.dirtyFiles, owner)
+		}
+	}
+	l.cond.Broadcast()
+	l.Unlock()
+}
+
+// flushOverLimit flushes the file handles with the most dirty bytes, until the dirty bytes are under the low watermark.
+// It is called without any file handle locked, since the flushed file handles are locked one by one.
+func (l *dirtyLimiter) flushOverLimit() {
+	if l.limit <= 0 {
+		return
+	}
+	l.Lock()
+	if l.dirtyBytes <= l.limit {
+		l.Unlock()
+		return
+	}
+	for l.dirtyBytes > l.lowWatermark {
+		var largest dirtyFlusher
+		var largestBytes int64
+		for owner, n := range l.dirtyFiles {
+			if n > largestBytes && !l.evicting[owner] {
+				largest, largestBytes = owner, n
+			}
+		}
+		if largest == nil {
+			// the rest are being flushed by the other writers
+			break
+		}
+		l.evicting[largest] = true
+		l.Unlock()
+		largest.flushDirtyData()
+		l.Lock()
+		delete(l.evicting, largest)
+	}
+	l.Unlock()
+}
+
+func (l *dirtyLimiter) isOverLimit() bool {
+	if l.limit <= 0 {
+		return false
+	}
+	l.Lock()
+	defer l.Unlock()
+	return l.dirtyBytes > l.limit
+}
+
+// waitForBackgroundFlushes blocks the writers while there are too many dirty bytes,
+// until the background flushes bring it under the limit
+func (l *dirtyLimiter) waitForBackgroundFlushes() {
+	if l.limit <= 0 {
+		return
+	}
+	l.Lock()
+	for l.dirtyBytes > l.limit && l.flushing > 0 {
+		l.cond.Wait()
+	}
+	l.Unlock()
+}
+
+// waitForAllFlushes blocks until all background flushes are done
+func (l *dirtyLimiter) waitForAllFlushes() {
+	l.Lock()
+	for l.flushing > 0 {
+		l.cond.Wait()
+	}
+	l.Unlock()
+}
+
+func (l *dirtyLimiter) startFlush() {
+	l.Lock()
+	l.flushing++
+	l.Unlock()
+}
+
+func (l *dirtyLimiter) finishFlush() {
+	l.Lock()
+	l.flushing--
+	l.cond.Broadcast()
+	l.Unlock()
+}
+
+// flushInBackground uploads the dirty pages and updates the filer after the file is closed.
+// The file handle is kept open until then, so the file can be opened again with the dirty data.
+// It is called with the file handle locked.
+func (fh *FileHandle) flushInBackground(header fuse.Header) {
+	if fh.backgroundFlushDone != nil {
+		// the scheduled flush has not locked the file handle yet, and will also flush the latest writes
+		return
+	}
+
+	wfs := fh.f.wfs
+	// limit the number of files waiting to be flushed
+	wfs.writeBackFlushers <- struct{}{}
+	wfs.dirtyLimiter.startFlush()
+
+	fh.f.isOpen++
+	done := make(chan struct{})
+	fh.backgroundFlushDone = done
+
+	go func() {
+		defer func() {
+			<-wfs.writeBackFlushers
+			wfs.dirtyLimiter.finishFlush()
+		}()
+
+		fh.Lock()
+		defer fh.Unlock()
+
+		if !fh.isDeleted {
+			if err := fh.doFlush(context.Background(), header); err != nil {
+				glog.Errorf("background flush %s: %v", fh.f.fullpath(), err)
+				fh.backgroundFlushErr = err
+			}
+		}
+		if fh.backgroundFlushErr != nil && fh.f.isOpen <= 1 {
+			glog.Errorf("background flush %s: the error is lost after the file is closed: %v", fh.f.fullpath(), fh.backgroundFlushErr)
+		}
+		fh.backgroundFlushDone = nil
+		close(done)
+
+		fh.releaseOpen()
+	}()
+}
+
+// waitForBackgroundFlush waits for the scheduled background flush, and returns its error if any.
+// It is called with the file handle locked.
+func (fh *FileHandle) waitForBackgroundFlush() error {
+	if done := fh.backgroundFlushDone; done != nil {
+		fh.Unlock()
+		<-done
+		fh.Lock()
+	}
+	return fh.takeBackgroundFlushErr()
+}
+
+// takeBackgroundFlushErr returns the error of the flushes not requested by the file handle owner,
+// i.e., the background flush after close, or the flush for the dirty limit, only once.
+// It is called with the file handle locked.
+func (fh *FileHandle) takeBackgroundFlushErr() error {
+	err := fh.backgroundFlushErr
+	fh.backgroundFlushErr = nil
+	return err
+}
+
+// flushDirtyData uploads the dirty pages for the dirty limit, and the metadata is saved later when flushing
+func (fh *FileHandle) flushDirtyData() {
+	fh.Lock()
+	defer fh.Unlock()
+
+	if err := fh.dirtyPages.FlushData(); err != nil {
+		glog.Errorf("%v flush for the dirty limit: %v", fh.f.fullpath(), err)
+		fh.backgroundFlushErr = err
+	}
+	fh.entryViewCache = nil
+	fh.reader = nil
+}
@@ -0,0 +1,84 @@
+package filesys
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDirtyLimiter(t *testing.T) {
+	l := newDirtyLimiter(100)
+
+	l.addDirty(nil, 80)
+	if l.isOverLimit() {
+		t.Fatalf("80 bytes should be under the limit")
+	}
+	l.addDirty(nil, 40)
+	if !l.isOverLimit() {
+		t.Fatalf("120 bytes should be over the limit")
+	}
+
+	// without background flushes, writers are not blocked
+	l.waitForBackgroundFlushes()
+
+	l.startFlush()
+	waited := make(chan struct{})
+	go func() {
+		l.waitForBackgroundFlushes()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+		t.Fatalf("writers should wait for the background flush")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	l.removeDirty(nil, 40)
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatalf("writers should continue under the limit")
+	}
+
+	l.finishFlush()
+	l.waitForAllFlushes()
+}
+
+// testFlusher flushes all its dirty bytes
+type testFlusher struct {
+	l       *dirtyLimiter
+	dirty   int64
+	flushed bool
+}
+
+func (f *testFlusher) flushDirtyData() {
+	f.l.removeDirty(f, f.dirty)
+	f.dirty = 0
+	f.flushed = true
+}
+
+func TestDirtyLimiterFlushOverLimit(t *testing.T) {
+	l := newDirtyLimiter(100)
+
+	small, medium, large := &testFlusher{l: l, dirty: 10}, &testFlusher{l: l, dirty: 30}, &testFlusher{l: l, dirty: 70}
+	for _, f := range []*testFlusher{small, medium, large} {
+		l.addDirty(f, f.dirty)
+	}
+
+	// flushed from the largest, down to the low watermark 75
+	l.flushOverLimit()
+	if !large.flushed || medium.flushed || small.flushed {
+		t.Errorf("flushed small %v medium %v large %v", small.flushed, medium.flushed, large.flushed)
+	}
+	if l.dirtyBytes != 40 {
+		t.Errorf("dirty bytes %d after flushing", l.dirtyBytes)
+	}
+
+	// under the limit, nothing is flushed
+	l.addDirty(medium, 50)
+	medium.dirty += 50
+	l.flushOverLimit()
+	if medium.flushed {
+		t.Errorf("flushed under the limit")
+	}
+}
@@ -3,11 +3,12 @@ package ftpd
 import (
 	"crypto/tls"
 	"errors"
-	"fmt"
 	"net"
 
 	ftpserver "github.com/fclairamb/ftpserverlib"
 	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
 type FtpServerOption struct {
@@ -51,7 +52,7 @@ func (s *SftpServer) GetSettings() (*ftpserver.Settings, error) {
 
 	return &ftpserver.Settings{
 		Listener:                 s.ftpListener,
-		ListenAddr:               fmt.Sprintf("%s:%d", s.option.IpBind, s.option.Port),
+		ListenAddr:               util.JoinHostPort(s.option.IpBind, s.option.Port),
 		PublicHost:               s.option.IP,
 		PassiveTransferPortRange: portRange,
 		ActiveTransferPortNon20:  true,
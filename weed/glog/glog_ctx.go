@@ -0,0 +1,39 @@
+package glog
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
+)
+
+// the logging functions with a context, prefixing the log lines with the request id of the context, if any
+
+func formatCtx(ctx context.Context, format string, args ...interface{}) string {
+	if id := request_id.Get(ctx); id != "" {
+		return fmt.Sprintf("request_id:%s ", id) + fmt.Sprintf(format, args...)
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// InfofCtx is equivalent to Infof, guarded by the value of v, with the request id of the context.
+func (v Verbose) InfofCtx(ctx context.Context, format string, args ...interface{}) {
+	if v {
+		logging.printDepth(infoLog, 0, formatCtx(ctx, format, args...))
+	}
+}
+
+// InfofCtx is equivalent to Infof, with the request id of the context.
+func InfofCtx(ctx context.Context, format string, args ...interface{}) {
+	logging.printDepth(infoLog, 0, formatCtx(ctx, format, args...))
+}
+
+// WarningfCtx is equivalent to Warningf, with the request id of the context.
+func WarningfCtx(ctx context.Context, format string, args ...interface{}) {
+	logging.printDepth(warningLog, 0, formatCtx(ctx, format, args...))
+}
+
+// ErrorfCtx is equivalent to Errorf, with the request id of the context.
+func ErrorfCtx(ctx context.Context, format string, args ...interface{}) {
+	logging.printDepth(errorLog, 0, formatCtx(ctx, format, args...))
+}
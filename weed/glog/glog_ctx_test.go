@@ -0,0 +1,31 @@
+package glog
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
+)
+
+func TestErrorfCtx(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	ctx := request_id.Set(context.Background(), "abc-123")
+	_, file, line, _ := runtime.Caller(0)
+	ErrorfCtx(ctx, "test %d", 1)
+	if !contains(errorLog, "request_id:abc-123 test 1", t) {
+		t.Errorf("ErrorfCtx missing the request id: %q", contents(errorLog))
+	}
+	// the caller of ErrorfCtx
+	if want := fmt.Sprintf("%s:%d]", file[len(file)-len("glog_ctx_test.go"):], line+1); !contains(errorLog, want, t) {
+		t.Errorf("ErrorfCtx missing %q: %q", want, contents(errorLog))
+	}
+
+	InfofCtx(context.Background(), "no request id")
+	if !contains(infoLog, "] no request id", t) {
+		t.Errorf("InfofCtx without request id: %q", contents(infoLog))
+	}
+}
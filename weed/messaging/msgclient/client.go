@@ -30,26 +30,29 @@ func NewMessagingClient(bootstrapBrokers ...string) *MessagingClient {
 
 func (mc *MessagingClient) findBroker(tp broker.TopicPartition) (*grpc.ClientConn, error) {
 
+	var lastErr error
 	for _, broker := range mc.bootstrapBrokers {
-		grpcConnection, err := pb.GrpcDial(context.Background(), broker, mc.grpcDialOption)
+		var targetBroker string
+		err := pb.WithBrokerGrpcClient(broker, mc.grpcDialOption, func(client messaging_pb.SeaweedMessagingClient) error {
+			resp, err := client.FindBroker(context.Background(),
+				&messaging_pb.FindBrokerRequest{
+					Namespace: tp.Namespace,
+					Topic:     tp.Topic,
+					Parition:  tp.Partition,
+				})
+			if err != nil {
+				return err
+			}
+			targetBroker = resp.Broker
+			return nil
+		})
 		if err != nil {
-			log.Printf("dial broker %s: %v", broker, err)
+			log.Printf("find broker from %s: %v", broker, err)
+			lastErr = err
 			continue
 		}
-		defer grpcConnection.Close()
-
-		resp, err := messaging_pb.NewSeaweedMessagingClient(grpcConnection).FindBroker(context.Background(),
-			&messaging_pb.FindBrokerRequest{
-				Namespace: tp.Namespace,
-				Topic:     tp.Topic,
-				Parition:  tp.Partition,
-			})
-		if err != nil {
-			return nil, err
-		}
 
-		targetBroker := resp.Broker
 		return pb.GrpcDial(context.Background(), targetBroker, mc.grpcDialOption)
 	}
-	return nil, fmt.Errorf("no broker found for %+v", tp)
+	return nil, fmt.Errorf("no broker found for %+v: %v", tp, lastErr)
 }
@@ -2,7 +2,6 @@ package msgclient
 
 import (
 	"context"
-	"log"
 
 	"github.com/chrislusf/seaweedfs/weed/messaging/broker"
 	"github.com/chrislusf/seaweedfs/weed/pb"
@@ -45,14 +44,7 @@ func (mc *MessagingClient) withAnyBroker(fn func(client messaging_pb.SeaweedMess
 
 	var lastErr error
 	for _, broker := range mc.bootstrapBrokers {
-		grpcConnection, err := pb.GrpcDial(context.Background(), broker, mc.grpcDialOption)
-		if err != nil {
-			log.Printf("dial broker %s: %v", broker, err)
-			continue
-		}
-		defer grpcConnection.Close()
-
-		err = fn(messaging_pb.NewSeaweedMessagingClient(grpcConnection))
+		err := pb.WithBrokerGrpcClient(broker, mc.grpcDialOption, fn)
 		if err == nil {
 			return nil
 		}
@@ -0,0 +1,373 @@
+package nbd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/filer"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/chunk_cache"
+	"github.com/chrislusf/seaweedfs/weed/wdclient"
+)
+
+type FilerDeviceOption struct {
+	FilerGrpcAddress string
+	GrpcDialOption   grpc.DialOption
+	Path             util.FullPath
+	Size             int64 // create the file, or grow it, to this size
+	Collection       string
+	Replication      string
+	DiskType         string
+	Cipher           bool
+	ChunkSizeLimit   int64
+	JournalDir       string
+	JournalSizeLimit int64
+	FlushInterval    time.Duration
+	CacheDir         string
+	CacheSizeMB      int64
+}
+
+// FilerDevice is a block device backed by a file in the filer.
+// The writes go to a local write journal first, and are uploaded as chunks of the file
+// when flushed, when the journal is too large, or periodically.
+type FilerDevice struct {
+	option     *FilerDeviceOption
+	lock       sync.Mutex
+	entry      *filer_pb.Entry
+	size       int64
+	journal    *writeJournal
+	lookupFn   wdclient.LookupFileIdFunctionType
+	chunkCache chunk_cache.ChunkCache
+	reader     io.ReaderAt
+}
+
+var _ = filer_pb.FilerClient(&FilerDevice{})
+var _ = Device(&FilerDevice{})
+
+func NewFilerDevice(option *FilerDeviceOption) (*FilerDevice, error) {
+
+	d := &FilerDevice{
+		option: option,
+	}
+	d.lookupFn = filer.LookupFn(d)
+
+	entry, err := d.prepareEntry()
+	if err != nil {
+		return nil, err
+	}
+	d.entry, d.size = entry, int64(filer.FileSize(entry))
+
+	uniqueId := util.Md5String([]byte("nbd" + option.FilerGrpcAddress + string(option.Path)))[0:8]
+	cacheDir := filepath.Join(option.CacheDir, uniqueId)
+	os.MkdirAll(cacheDir, os.FileMode(0755))
+	d.chunkCache = chunk_cache.NewTieredChunkCache(256, cacheDir, option.CacheSizeMB, 1024*1024)
+
+	os.MkdirAll(option.JournalDir, os.FileMode(0755))
+	journalFile := filepath.Join(option.JournalDir, fmt.Sprintf("nbd_%s.journal", uniqueId))
+	if d.journal, err = openWriteJournal(journalFile); err != nil {
+		return nil, err
+	}
+	if !d.journal.isEmpty() {
+		glog.V(0).Infof("flush %d writes left in journal %s", len(d.journal.records), journalFile)
+		if err = d.Flush(); err != nil {
+			d.journal.close()
+			return nil, fmt.Errorf("flush journal %s: %v", journalFile, err)
+		}
+	}
+
+	if option.FlushInterval > 0 {
+		go d.loopFlush()
+	}
+
+	return d, nil
+}
+
+// prepareEntry looks up the file, and creates or grows it to the configured size
+func (d *FilerDevice) prepareEntry() (*filer_pb.Entry, error) {
+	entry, err := filer_pb.GetEntry(d, d.option.Path)
+	if err != nil {
+		return nil, fmt.Errorf("lookup %s: %v", d.option.Path, err)
+	}
+	dir, name := d.option.Path.DirAndName()
+
+	if entry == nil {
+		if d.option.Size <= 0 {
+			return nil, fmt.Errorf("%s not found, set the size to create it", d.option.Path)
+		}
+		glog.V(0).Infof("create %s of %d bytes", d.option.Path, d.option.Size)
+		err = filer_pb.MkFile(d, dir, name, nil, func(entry *filer_pb.Entry) {
+			entry.Attributes.FileMode = uint32(0644)
+			entry.Attributes.FileSize = uint64(d.option.Size)
+			entry.Attributes.Collection = d.option.Collection
+			entry.Attributes.Replication = d.option.Replication
+			entry.Attributes.DiskType = d.option.DiskType
+		})
+		if err != nil {
+			return nil, err
+		}
+		return filer_pb.GetEntry(d, d.option.Path)
+	}
+
+	if entry.IsDirectory {
+		return nil, fmt.Errorf("%s is a directory", d.option.Path)
+	}
+	currentSize := int64(filer.FileSize(entry))
+	if d.option.Size > currentSize {
+		glog.V(0).Infof("grow %s from %d to %d bytes", d.option.Path, currentSize, d.option.Size)
+		entry.Attributes.FileSize = uint64(d.option.Size)
+		err = d.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+			return filer_pb.UpdateEntry(client, &filer_pb.UpdateEntryRequest{
+				Directory: dir,
+				Entry:     entry,
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else if d.option.Size > 0 && d.option.Size < currentSize {
+		return nil, fmt.Errorf("%s has %d bytes, can not shrink to %d bytes", d.option.Path, currentSize, d.option.Size)
+	}
+	return entry, nil
+}
+
+func (d *FilerDevice) WithFilerClient(fn func(filer_pb.SeaweedFilerClient) error) error {
+	return pb.WithCachedGrpcClient(func(grpcConnection *grpc.ClientConn) error {
+		client := filer_pb.NewSeaweedFilerClient(grpcConnection)
+		return fn(client)
+	}, d.option.FilerGrpcAddress, d.option.GrpcDialOption)
+}
+
+func (d *FilerDevice) AdjustedUrl(location *filer_pb.Location) string {
+	return location.Url
+}
+
+func (d *FilerDevice) Size() int64 {
+	return d.size
+}
+
+func (d *FilerDevice) ReadAt(p []byte, offset int64) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.reader == nil {
+		visibles, err := filer.NonOverlappingVisibleIntervals(d.lookupFn, d.entry.Chunks, 0, math.MaxInt64)
+		if err != nil {
+			return fmt.Errorf("resolve chunk manifest: %v", err)
+		}
+		chunkViews := filer.ViewFromVisibleIntervals(visibles, 0, math.MaxInt64)
+		d.reader = filer.NewChunkReaderAtFromClient(d.lookupFn, chunkViews, d.chunkCache, d.size)
+	}
+	if _, err := d.reader.ReadAt(p, offset); err != nil && err != io.EOF {
+		return err
+	}
+
+	return d.journal.overlay(p, offset)
+}
+
+func (d *FilerDevice) WriteAt(p []byte, offset int64, fua bool) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if err := d.journal.append(p, offset); err != nil {
+		return fmt.Errorf("append to journal: %v", err)
+	}
+	return d.afterWrite(fua)
+}
+
+func (d *FilerDevice) WriteZeroes(offset, length int64, fua bool) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if err := d.journal.appendZeroes(offset, length); err != nil {
+		return fmt.Errorf("append to journal: %v", err)
+	}
+	return d.afterWrite(fua)
+}
+
+func (d *FilerDevice) afterWrite(fua bool) error {
+	if d.journal.size >= d.option.JournalSizeLimit {
+		return d.flush()
+	}
+	if fua {
+		return d.journal.sync()
+	}
+	return nil
+}
+
+func (d *FilerDevice) Flush() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.flush()
+}
+
+// flush uploads the dirty regions of the journal as new chunks of the file, and then clears the journal.
+// The new chunks cover the older chunks, which are garbage collected by the filer.
+func (d *FilerDevice) flush() error {
+	if d.journal.isEmpty() {
+		return nil
+	}
+
+	var newChunks []*filer_pb.FileChunk
+	for _, region := range d.journal.dirtyRegions() {
+		for offset := region.offset; offset < region.offset+region.length; offset += d.option.ChunkSizeLimit {
+			data := make([]byte, min(d.option.ChunkSizeLimit, region.offset+region.length-offset))
+			if err := d.journal.overlay(data, offset); err != nil {
+				return fmt.Errorf("read journal: %v", err)
+			}
+			// keep the zeroed ranges without any data as holes
+			if util.IsZeroBytes(data) && !d.hasChunkData(offset, int64(len(data))) {
+				continue
+			}
+			chunk, _, _, err := d.saveDataAsChunk(bytes.NewReader(data), string(d.option.Path), offset)
+			if err != nil {
+				d.deleteChunks(newChunks)
+				return fmt.Errorf("upload [%d,%d): %v", offset, offset+int64(len(data)), err)
+			}
+			newChunks = append(newChunks, chunk)
+		}
+	}
+
+	chunks, err := filer.MaybeManifestize(d.saveDataAsChunk, append(d.entry.Chunks, newChunks...))
+	if err != nil {
+		d.deleteChunks(newChunks)
+		return fmt.Errorf("manifestize: %v", err)
+	}
+
+	entry := proto.Clone(d.entry).(*filer_pb.Entry)
+	entry.Chunks = chunks
+	entry.Attributes.Mtime = time.Now().Unix()
+	entry.Attributes.Md5 = nil
+	dir, _ := d.option.Path.DirAndName()
+	err = d.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		return filer_pb.UpdateEntry(client, &filer_pb.UpdateEntryRequest{
+			Directory: dir,
+			Entry:     entry,
+		})
+	})
+	if err != nil {
+		d.deleteChunks(newChunks)
+		return fmt.Errorf("update %s: %v", d.option.Path, err)
+	}
+	glog.V(1).Infof("flushed %d writes of %s as %d chunks", len(d.journal.records), d.option.Path, len(newChunks))
+
+	d.entry, d.reader = entry, nil
+	return d.journal.reset()
+}
+
+// hasChunkData checks whether any chunk of the file overlaps the range
+func (d *FilerDevice) hasChunkData(offset, length int64) bool {
+	for _, chunk := range d.entry.Chunks {
+		if chunk.Offset < offset+length && offset < chunk.Offset+int64(chunk.Size) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *FilerDevice) deleteChunks(chunks []*filer_pb.FileChunk) {
+	var fileIds []string
+	for _, chunk := range chunks {
+		fileIds = append(fileIds, chunk.GetFileIdString())
+	}
+	if len(fileIds) == 0 {
+		return
+	}
+	d.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		lookupFunc := func(vids []string) (map[string]operation.LookupResult, error) {
+			m := make(map[string]operation.LookupResult)
+			resp, err := client.LookupVolume(context.Background(), &filer_pb.LookupVolumeRequest{
+				VolumeIds: vids,
+			})
+			if err != nil {
+				return m, err
+			}
+			for _, vid := range vids {
+				lr := operation.LookupResult{VolumeId: vid}
+				for _, loc := range resp.LocationsMap[vid].GetLocations() {
+					lr.Locations = append(lr.Locations, operation.Location{Url: loc.Url, PublicUrl: loc.PublicUrl})
+				}
+				m[vid] = lr
+			}
+			return m, nil
+		}
+		_, err := operation.DeleteFilesWithLookupVolumeId(d.option.GrpcDialOption, fileIds, lookupFunc)
+		return err
+	})
+}
+
+func (d *FilerDevice) saveDataAsChunk(reader io.Reader, name string, offset int64) (chunk *filer_pb.FileChunk, collection, replication string, err error) {
+
+	var fileId, host string
+	var auth security.EncodedJwt
+
+	if err = d.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		return util.Retry("assignVolume", func() error {
+			request := &filer_pb.AssignVolumeRequest{
+				Count:       1,
+				Replication: d.option.Replication,
+				Collection:  d.option.Collection,
+				DiskType:    d.option.DiskType,
+				Path:        string(d.option.Path),
+			}
+
+			resp, err := client.AssignVolume(context.Background(), request)
+			if err != nil {
+				glog.V(0).Infof("assign volume failure %v: %v", request, err)
+				return err
+			}
+			if resp.Error != "" {
+				return fmt.Errorf("assign volume failure %v: %v", request, resp.Error)
+			}
+
+			fileId, host, auth = resp.FileId, resp.Url, security.EncodedJwt(resp.Auth)
+			collection, replication = resp.Collection, resp.Replication
+			return nil
+		})
+	}); err != nil {
+		return nil, "", "", fmt.Errorf("filerGrpcAddress assign volume: %v", err)
+	}
+
+	fileUrl := fmt.Sprintf("http://%s/%s", host, fileId)
+	uploadResult, err, _ := operation.Upload(fileUrl, name, d.option.Cipher, reader, false, "", nil, auth)
+	if err != nil {
+		glog.V(0).Infof("upload data %v to %s: %v", name, fileUrl, err)
+		return nil, "", "", fmt.Errorf("upload data: %v", err)
+	}
+	if uploadResult.Error != "" {
+		glog.V(0).Infof("upload failure %v to %s: %v", name, fileUrl, uploadResult.Error)
+		return nil, "", "", fmt.Errorf("upload result: %v", uploadResult.Error)
+	}
+	return uploadResult.ToPbFileChunk(fileId, offset), collection, replication, nil
+}
+
+func (d *FilerDevice) loopFlush() {
+	for range time.Tick(d.option.FlushInterval) {
+		if err := d.Flush(); err != nil {
+			glog.Errorf("flush %s: %v", d.option.Path, err)
+		}
+	}
+}
+
+// Close flushes the journal to the filer
+func (d *FilerDevice) Close() error {
+	if err := d.Flush(); err != nil {
+		return err
+	}
+	return d.journal.close()
+}
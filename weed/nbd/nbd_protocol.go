@@ -0,0 +1,78 @@
+package nbd
+
+// the fixed newstyle network block device protocol
+// https://github.com/NetworkBlockDevice/nbd/blob/master/doc/proto.md
+
+const (
+	nbdMagic         = uint64(0x4e42444d41474943) // "NBDMAGIC"
+	nbdOptionMagic   = uint64(0x49484156454F5054) // "IHAVEOPT"
+	nbdOptReplyMagic = uint64(0x3e889045565a9)
+	nbdRequestMagic  = uint32(0x25609513)
+	nbdReplyMagic    = uint32(0x67446698)
+
+	// handshake flags
+	nbdFlagFixedNewstyle = uint16(1 << 0)
+	nbdFlagNoZeroes      = uint16(1 << 1)
+
+	// client flags
+	nbdFlagCFixedNewstyle = uint32(1 << 0)
+	nbdFlagCNoZeroes      = uint32(1 << 1)
+
+	// options
+	nbdOptExportName = uint32(1)
+	nbdOptAbort      = uint32(2)
+	nbdOptList       = uint32(3)
+	nbdOptInfo       = uint32(6)
+	nbdOptGo         = uint32(7)
+
+	// option replies
+	nbdRepAck        = uint32(1)
+	nbdRepServer     = uint32(2)
+	nbdRepInfo       = uint32(3)
+	nbdRepErrUnsup   = uint32(1<<31 + 1)
+	nbdRepErrInvalid = uint32(1<<31 + 3)
+	nbdRepErrUnknown = uint32(1<<31 + 6)
+	nbdInfoExport    = uint16(0)
+	nbdInfoBlockSize = uint16(3)
+
+	// transmission flags
+	nbdFlagHasFlags        = uint16(1 << 0)
+	nbdFlagReadOnly        = uint16(1 << 1)
+	nbdFlagSendFlush       = uint16(1 << 2)
+	nbdFlagSendFua         = uint16(1 << 3)
+	nbdFlagSendTrim        = uint16(1 << 5)
+	nbdFlagSendWriteZeroes = uint16(1 << 6)
+
+	// commands
+	nbdCmdRead        = uint16(0)
+	nbdCmdWrite       = uint16(1)
+	nbdCmdDisc        = uint16(2)
+	nbdCmdFlush       = uint16(3)
+	nbdCmdTrim        = uint16(4)
+	nbdCmdWriteZeroes = uint16(6)
+
+	// command flags
+	nbdCmdFlagFua = uint16(1 << 0)
+
+	// errors
+	nbdEPERM   = uint32(1)
+	nbdEIO     = uint32(5)
+	nbdEINVAL  = uint32(22)
+	nbdENOSPC  = uint32(28)
+	nbdENOTSUP = uint32(95)
+
+	// the largest read or write request accepted
+	nbdMaxRequestSize = 32 * 1024 * 1024
+)
+
+// Device is the block device exported by the nbd server
+type Device interface {
+	Size() int64
+	ReadAt(p []byte, offset int64) error
+	// WriteAt writes the data. With fua, the data is durable when it returns.
+	WriteAt(p []byte, offset int64, fua bool) error
+	// WriteZeroes zeroes the range, also used to trim the range.
+	WriteZeroes(offset, length int64, fua bool) error
+	// Flush makes all the written data durable.
+	Flush() error
+}
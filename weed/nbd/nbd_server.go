@@ -0,0 +1,255 @@
+package nbd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+)
+
+// Server exports one device with the network block device protocol
+type Server struct {
+	device     Device
+	exportName string
+	readOnly   bool
+}
+
+func NewServer(device Device, exportName string, readOnly bool) *Server {
+	return &Server{
+		device:     device,
+		exportName: exportName,
+		readOnly:   readOnly,
+	}
+}
+
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+
+	ok, err := s.negotiate(r, w)
+	if err != nil {
+		glog.V(0).Infof("nbd negotiation with %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	glog.V(0).Infof("nbd client %s connected", conn.RemoteAddr())
+	if err = s.transmit(r, w); err != nil && err != io.EOF {
+		glog.V(0).Infof("nbd client %s: %v", conn.RemoteAddr(), err)
+	}
+	glog.V(0).Infof("nbd client %s disconnected", conn.RemoteAddr())
+}
+
+func (s *Server) transmissionFlags() uint16 {
+	flags := nbdFlagHasFlags | nbdFlagSendFlush | nbdFlagSendFua
+	if s.readOnly {
+		return flags | nbdFlagReadOnly
+	}
+	return flags | nbdFlagSendTrim | nbdFlagSendWriteZeroes
+}
+
+func (s *Server) isExportName(name string) bool {
+	return name == "" || name == s.exportName
+}
+
+// negotiate runs the fixed newstyle handshake, and returns true if the client chooses the export
+func (s *Server) negotiate(r *bufio.Reader, w *bufio.Writer) (bool, error) {
+
+	binary.Write(w, binary.BigEndian, nbdMagic)
+	binary.Write(w, binary.BigEndian, nbdOptionMagic)
+	binary.Write(w, binary.BigEndian, nbdFlagFixedNewstyle|nbdFlagNoZeroes)
+	if err := w.Flush(); err != nil {
+		return false, err
+	}
+
+	var clientFlags uint32
+	if err := binary.Read(r, binary.BigEndian, &clientFlags); err != nil {
+		return false, fmt.Errorf("read client flags: %v", err)
+	}
+	if clientFlags&nbdFlagCFixedNewstyle == 0 {
+		return false, fmt.Errorf("client does not support fixed newstyle negotiation")
+	}
+	noZeroes := clientFlags&nbdFlagCNoZeroes != 0
+
+	for {
+		var header struct {
+			Magic  uint64
+			Option uint32
+			Length uint32
+		}
+		if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+			return false, fmt.Errorf("read option: %v", err)
+		}
+		if header.Magic != nbdOptionMagic {
+			return false, fmt.Errorf("unexpected option magic %x", header.Magic)
+		}
+		if header.Length > 64*1024 {
+			return false, fmt.Errorf("option %d length %d too large", header.Option, header.Length)
+		}
+		data := make([]byte, header.Length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return false, fmt.Errorf("read option %d: %v", header.Option, err)
+		}
+
+		switch header.Option {
+		case nbdOptExportName:
+			if !s.isExportName(string(data)) {
+				return false, fmt.Errorf("unknown export %s", string(data))
+			}
+			binary.Write(w, binary.BigEndian, uint64(s.device.Size()))
+			binary.Write(w, binary.BigEndian, s.transmissionFlags())
+			if !noZeroes {
+				w.Write(make([]byte, 124))
+			}
+			return true, w.Flush()
+		case nbdOptAbort:
+			writeOptionReply(w, header.Option, nbdRepAck, nil)
+			return false, w.Flush()
+		case nbdOptList:
+			name := make([]byte, 4+len(s.exportName))
+			binary.BigEndian.PutUint32(name, uint32(len(s.exportName)))
+			copy(name[4:], s.exportName)
+			writeOptionReply(w, header.Option, nbdRepServer, name)
+			writeOptionReply(w, header.Option, nbdRepAck, nil)
+		case nbdOptInfo, nbdOptGo:
+			if len(data) < 6 || int(binary.BigEndian.Uint32(data))+6 > len(data) {
+				writeOptionReply(w, header.Option, nbdRepErrInvalid, nil)
+				break
+			}
+			nameLength := binary.BigEndian.Uint32(data)
+			if !s.isExportName(string(data[4 : 4+nameLength])) {
+				writeOptionReply(w, header.Option, nbdRepErrUnknown, nil)
+				break
+			}
+			export := make([]byte, 12)
+			binary.BigEndian.PutUint16(export, nbdInfoExport)
+			binary.BigEndian.PutUint64(export[2:], uint64(s.device.Size()))
+			binary.BigEndian.PutUint16(export[10:], s.transmissionFlags())
+			writeOptionReply(w, header.Option, nbdRepInfo, export)
+			blockSize := make([]byte, 14)
+			binary.BigEndian.PutUint16(blockSize, nbdInfoBlockSize)
+			binary.BigEndian.PutUint32(blockSize[2:], 1)
+			binary.BigEndian.PutUint32(blockSize[6:], 4096)
+			binary.BigEndian.PutUint32(blockSize[10:], nbdMaxRequestSize)
+			writeOptionReply(w, header.Option, nbdRepInfo, blockSize)
+			writeOptionReply(w, header.Option, nbdRepAck, nil)
+			if header.Option == nbdOptGo {
+				return true, w.Flush()
+			}
+		default:
+			writeOptionReply(w, header.Option, nbdRepErrUnsup, nil)
+		}
+		if err := w.Flush(); err != nil {
+			return false, err
+		}
+	}
+}
+
+func writeOptionReply(w io.Writer, option, replyType uint32, data []byte) {
+	binary.Write(w, binary.BigEndian, nbdOptReplyMagic)
+	binary.Write(w, binary.BigEndian, option)
+	binary.Write(w, binary.BigEndian, replyType)
+	binary.Write(w, binary.BigEndian, uint32(len(data)))
+	w.Write(data)
+}
+
+// transmit serves the requests one by one, until the client disconnects
+func (s *Server) transmit(r *bufio.Reader, w *bufio.Writer) error {
+
+	var request struct {
+		Magic  uint32
+		Flags  uint16
+		Type   uint16
+		Handle uint64
+		Offset uint64
+		Length uint32
+	}
+
+	for {
+		if err := binary.Read(r, binary.BigEndian, &request); err != nil {
+			return err
+		}
+		if request.Magic != nbdRequestMagic {
+			return fmt.Errorf("unexpected request magic %x", request.Magic)
+		}
+
+		fua := request.Flags&nbdCmdFlagFua != 0
+		offset, length := int64(request.Offset), int64(request.Length)
+		inRange := offset >= 0 && offset+length <= s.device.Size()
+
+		var errno uint32
+		var data []byte
+
+		switch request.Type {
+		case nbdCmdRead:
+			if !inRange || length > nbdMaxRequestSize {
+				errno = nbdEINVAL
+				break
+			}
+			data = make([]byte, length)
+			if err := s.device.ReadAt(data, offset); err != nil {
+				glog.Errorf("nbd read [%d,%d): %v", offset, offset+length, err)
+				errno, data = nbdEIO, nil
+			}
+		case nbdCmdWrite:
+			if length > nbdMaxRequestSize {
+				return fmt.Errorf("write request of %d bytes too large", length)
+			}
+			data = make([]byte, length)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return fmt.Errorf("read write request data: %v", err)
+			}
+			if s.readOnly {
+				errno = nbdEPERM
+			} else if !inRange {
+				errno = nbdENOSPC
+			} else if err := s.device.WriteAt(data, offset, fua); err != nil {
+				glog.Errorf("nbd write [%d,%d): %v", offset, offset+length, err)
+				errno = nbdEIO
+			}
+			data = nil
+		case nbdCmdDisc:
+			return s.device.Flush()
+		case nbdCmdFlush:
+			if err := s.device.Flush(); err != nil {
+				glog.Errorf("nbd flush: %v", err)
+				errno = nbdEIO
+			}
+		case nbdCmdTrim, nbdCmdWriteZeroes:
+			if s.readOnly {
+				errno = nbdEPERM
+			} else if !inRange {
+				errno = nbdENOSPC
+			} else if err := s.device.WriteZeroes(offset, length, fua); err != nil {
+				glog.Errorf("nbd write zeroes [%d,%d): %v", offset, offset+length, err)
+				errno = nbdEIO
+			}
+		default:
+			errno = nbdENOTSUP
+		}
+
+		binary.Write(w, binary.BigEndian, nbdReplyMagic)
+		binary.Write(w, binary.BigEndian, errno)
+		binary.Write(w, binary.BigEndian, request.Handle)
+		w.Write(data)
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+}
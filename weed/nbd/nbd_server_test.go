@@ -0,0 +1,162 @@
+package nbd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+type memoryDevice struct {
+	data    []byte
+	flushed int
+}
+
+func (m *memoryDevice) Size() int64 {
+	return int64(len(m.data))
+}
+
+func (m *memoryDevice) ReadAt(p []byte, offset int64) error {
+	copy(p, m.data[offset:])
+	return nil
+}
+
+func (m *memoryDevice) WriteAt(p []byte, offset int64, fua bool) error {
+	copy(m.data[offset:], p)
+	return nil
+}
+
+func (m *memoryDevice) WriteZeroes(offset, length int64, fua bool) error {
+	copy(m.data[offset:offset+length], make([]byte, length))
+	return nil
+}
+
+func (m *memoryDevice) Flush() error {
+	m.flushed++
+	return nil
+}
+
+type testClient struct {
+	t *testing.T
+	r *bufio.Reader
+	w io.Writer
+}
+
+func (c *testClient) read(v interface{}) {
+	if err := binary.Read(c.r, binary.BigEndian, v); err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+}
+
+func (c *testClient) write(v ...interface{}) {
+	for _, x := range v {
+		if err := binary.Write(c.w, binary.BigEndian, x); err != nil {
+			c.t.Fatalf("write: %v", err)
+		}
+	}
+}
+
+func (c *testClient) request(cmdType uint16, handle uint64, offset uint64, length uint32, data []byte) (errno uint32, reply []byte) {
+	c.write(nbdRequestMagic, uint16(0), cmdType, handle, offset, length)
+	if data != nil {
+		c.w.Write(data)
+	}
+	var header struct {
+		Magic  uint32
+		Errno  uint32
+		Handle uint64
+	}
+	c.read(&header)
+	if header.Magic != nbdReplyMagic || header.Handle != handle {
+		c.t.Fatalf("unexpected reply %+v", header)
+	}
+	if cmdType == nbdCmdRead && header.Errno == 0 {
+		reply = make([]byte, length)
+		if _, err := io.ReadFull(c.r, reply); err != nil {
+			c.t.Fatalf("read reply data: %v", err)
+		}
+	}
+	return header.Errno, reply
+}
+
+func TestNbdServer(t *testing.T) {
+
+	device := &memoryDevice{data: make([]byte, 1024*1024)}
+	server := NewServer(device, "/test/disk", false)
+
+	clientConn, serverConn := net.Pipe()
+	go server.handleConn(serverConn)
+	defer clientConn.Close()
+
+	c := &testClient{t: t, r: bufio.NewReader(clientConn), w: clientConn}
+
+	var handshake struct {
+		Magic       uint64
+		OptionMagic uint64
+		Flags       uint16
+	}
+	c.read(&handshake)
+	if handshake.Magic != nbdMagic || handshake.OptionMagic != nbdOptionMagic || handshake.Flags&nbdFlagFixedNewstyle == 0 {
+		t.Fatalf("unexpected handshake %+v", handshake)
+	}
+	c.write(nbdFlagCFixedNewstyle | nbdFlagCNoZeroes)
+
+	// an unknown export is rejected
+	name := "/unknown"
+	c.write(nbdOptionMagic, nbdOptGo, uint32(4+len(name)+2), uint32(len(name)), []byte(name), uint16(0))
+	var reply struct {
+		Magic     uint64
+		Option    uint32
+		ReplyType uint32
+		Length    uint32
+	}
+	c.read(&reply)
+	if reply.ReplyType != nbdRepErrUnknown {
+		t.Fatalf("unknown export reply %+v", reply)
+	}
+
+	name = "/test/disk"
+	c.write(nbdOptionMagic, nbdOptGo, uint32(4+len(name)+2), uint32(len(name)), []byte(name), uint16(0))
+	var size uint64
+	for {
+		c.read(&reply)
+		if reply.Magic != nbdOptReplyMagic || reply.Option != nbdOptGo {
+			t.Fatalf("unexpected option reply %+v", reply)
+		}
+		if reply.ReplyType == nbdRepAck {
+			break
+		}
+		info := make([]byte, reply.Length)
+		io.ReadFull(c.r, info)
+		if binary.BigEndian.Uint16(info) == nbdInfoExport {
+			size = binary.BigEndian.Uint64(info[2:])
+		}
+	}
+	if size != uint64(len(device.data)) {
+		t.Fatalf("export size %d, expected %d", size, len(device.data))
+	}
+
+	data := bytes.Repeat([]byte("seaweedfs"), 1000)
+	if errno, _ := c.request(nbdCmdWrite, 1, 4096, uint32(len(data)), data); errno != 0 {
+		t.Fatalf("write errno %d", errno)
+	}
+	errno, read := c.request(nbdCmdRead, 2, 4096, uint32(len(data)), nil)
+	if errno != 0 || !bytes.Equal(read, data) {
+		t.Fatalf("read errno %d, data matched %v", errno, bytes.Equal(read, data))
+	}
+	if errno, _ = c.request(nbdCmdWriteZeroes, 3, 4096, 9, nil); errno != 0 {
+		t.Fatalf("write zeroes errno %d", errno)
+	}
+	if _, read = c.request(nbdCmdRead, 4, 4096, 18, nil); !bytes.Equal(read, append(make([]byte, 9), data[9:18]...)) {
+		t.Fatalf("read after write zeroes: %v", read)
+	}
+	if errno, _ = c.request(nbdCmdWrite, 5, size-4, 8, make([]byte, 8)); errno != nbdENOSPC {
+		t.Fatalf("write beyond the end errno %d", errno)
+	}
+	if errno, _ = c.request(nbdCmdFlush, 6, 0, 0, nil); errno != 0 || device.flushed != 1 {
+		t.Fatalf("flush errno %d, flushed %d", errno, device.flushed)
+	}
+
+}
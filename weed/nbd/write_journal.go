@@ -0,0 +1,214 @@
+package nbd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+)
+
+const (
+	journalRecordMagic      = uint32(0x4e42444a) // "NBDJ"
+	journalRecordHeaderSize = 24
+	journalFlagZeroes       = uint32(1)
+)
+
+// writeJournal keeps the written data in a local append-only file, until it is flushed to the filer.
+// Each record has a header of magic, flags, device offset, length and crc, followed by the data.
+// The records are replayed when the journal is opened again, so the acknowledged writes survive a restart.
+type writeJournal struct {
+	file    *os.File
+	size    int64
+	records []*journalRecord
+}
+
+type journalRecord struct {
+	offset     int64 // the offset in the device
+	length     int64
+	dataOffset int64 // the offset of the data in the journal file
+	isZeroes   bool
+}
+
+type dirtyRegion struct {
+	offset int64
+	length int64
+}
+
+func openWriteJournal(fileName string) (*writeJournal, error) {
+	file, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j := &writeJournal{
+		file: file,
+	}
+	if err = j.replay(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("replay %s: %v", fileName, err)
+	}
+	return j, nil
+}
+
+// replay loads the records, and truncates the torn record of an interrupted write, if any
+func (j *writeJournal) replay() error {
+	stat, err := j.file.Stat()
+	if err != nil {
+		return err
+	}
+	header := make([]byte, journalRecordHeaderSize)
+	for j.size+journalRecordHeaderSize <= stat.Size() {
+		if _, err = j.file.ReadAt(header, j.size); err != nil {
+			return err
+		}
+		if binary.BigEndian.Uint32(header) != journalRecordMagic {
+			break
+		}
+		record := &journalRecord{
+			offset:     int64(binary.BigEndian.Uint64(header[8:])),
+			length:     int64(binary.BigEndian.Uint32(header[16:])),
+			dataOffset: j.size + journalRecordHeaderSize,
+			isZeroes:   binary.BigEndian.Uint32(header[4:])&journalFlagZeroes != 0,
+		}
+		recordSize := int64(journalRecordHeaderSize)
+		if !record.isZeroes {
+			if record.dataOffset+record.length > stat.Size() {
+				break
+			}
+			data := make([]byte, record.length)
+			if _, err = j.file.ReadAt(data, record.dataOffset); err != nil {
+				return err
+			}
+			if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[20:]) {
+				break
+			}
+			recordSize += record.length
+		}
+		j.records = append(j.records, record)
+		j.size += recordSize
+	}
+	if j.size < stat.Size() {
+		glog.Warningf("truncate the torn record of journal %s at %d, size %d", j.file.Name(), j.size, stat.Size())
+		return j.file.Truncate(j.size)
+	}
+	return nil
+}
+
+func (j *writeJournal) append(p []byte, offset int64) error {
+	buf := make([]byte, journalRecordHeaderSize+len(p))
+	binary.BigEndian.PutUint32(buf, journalRecordMagic)
+	binary.BigEndian.PutUint64(buf[8:], uint64(offset))
+	binary.BigEndian.PutUint32(buf[16:], uint32(len(p)))
+	binary.BigEndian.PutUint32(buf[20:], crc32.ChecksumIEEE(p))
+	copy(buf[journalRecordHeaderSize:], p)
+	if _, err := j.file.WriteAt(buf, j.size); err != nil {
+		return err
+	}
+	j.records = append(j.records, &journalRecord{
+		offset:     offset,
+		length:     int64(len(p)),
+		dataOffset: j.size + journalRecordHeaderSize,
+	})
+	j.size += int64(len(buf))
+	return nil
+}
+
+func (j *writeJournal) appendZeroes(offset, length int64) error {
+	buf := make([]byte, journalRecordHeaderSize)
+	binary.BigEndian.PutUint32(buf, journalRecordMagic)
+	binary.BigEndian.PutUint32(buf[4:], journalFlagZeroes)
+	binary.BigEndian.PutUint64(buf[8:], uint64(offset))
+	binary.BigEndian.PutUint32(buf[16:], uint32(length))
+	if _, err := j.file.WriteAt(buf, j.size); err != nil {
+		return err
+	}
+	j.records = append(j.records, &journalRecord{
+		offset:     offset,
+		length:     length,
+		dataOffset: j.size + journalRecordHeaderSize,
+		isZeroes:   true,
+	})
+	j.size += int64(len(buf))
+	return nil
+}
+
+// overlay applies the journal records to the data read at the offset, in the order of the writes
+func (j *writeJournal) overlay(p []byte, offset int64) error {
+	stop := offset + int64(len(p))
+	for _, record := range j.records {
+		start, end := max(offset, record.offset), min(stop, record.offset+record.length)
+		if start >= end {
+			continue
+		}
+		if record.isZeroes {
+			for i := start - offset; i < end-offset; i++ {
+				p[i] = 0
+			}
+			continue
+		}
+		if _, err := j.file.ReadAt(p[start-offset:end-offset], record.dataOffset+start-record.offset); err != nil && err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirtyRegions returns the sorted and merged ranges written in the journal
+func (j *writeJournal) dirtyRegions() (regions []*dirtyRegion) {
+	var sorted []*dirtyRegion
+	for _, record := range j.records {
+		sorted = append(sorted, &dirtyRegion{offset: record.offset, length: record.length})
+	}
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].offset < sorted[b].offset
+	})
+	for _, r := range sorted {
+		if len(regions) > 0 {
+			last := regions[len(regions)-1]
+			if r.offset <= last.offset+last.length {
+				last.length = max(last.length, r.offset+r.length-last.offset)
+				continue
+			}
+		}
+		regions = append(regions, &dirtyRegion{offset: r.offset, length: r.length})
+	}
+	return
+}
+
+func (j *writeJournal) isEmpty() bool {
+	return len(j.records) == 0
+}
+
+func (j *writeJournal) sync() error {
+	return j.file.Sync()
+}
+
+// reset clears the journal after the records are flushed
+func (j *writeJournal) reset() error {
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	j.records, j.size = nil, 0
+	return j.file.Sync()
+}
+
+func (j *writeJournal) close() error {
+	return j.file.Close()
+}
+
+func max(x, y int64) int64 {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+func min(x, y int64) int64 {
+	if x < y {
+		return x
+	}
+	return y
+}
@@ -0,0 +1,61 @@
+package nbd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteJournalReplay(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "nbd_journal")
+	if err != nil {
+		t.Fatalf("temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "test.journal")
+
+	j, err := openWriteJournal(fileName)
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	j.append([]byte("aaaaaaaa"), 0)
+	j.append([]byte("bbbb"), 4)
+	j.appendZeroes(6, 4)
+	j.append([]byte("cccc"), 100)
+	size := j.size
+	j.close()
+
+	// a torn record at the end
+	f, _ := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{0x4e, 0x42, 0x44, 0x4a, 0, 0})
+	f.Close()
+
+	j, err = openWriteJournal(fileName)
+	if err != nil {
+		t.Fatalf("reopen journal: %v", err)
+	}
+	defer j.close()
+	if len(j.records) != 4 || j.size != size {
+		t.Fatalf("replayed %d records of %d bytes, expected 4 records of %d bytes", len(j.records), j.size, size)
+	}
+
+	p := bytes.Repeat([]byte("x"), 12)
+	if err = j.overlay(p, 0); err != nil {
+		t.Fatalf("overlay: %v", err)
+	}
+	if expected := []byte("aaaabb\x00\x00\x00\x00xx"); !bytes.Equal(p, expected) {
+		t.Errorf("overlay %q, expected %q", p, expected)
+	}
+
+	regions := j.dirtyRegions()
+	if len(regions) != 2 || regions[0].offset != 0 || regions[0].length != 10 || regions[1].offset != 100 || regions[1].length != 4 {
+		t.Errorf("unexpected dirty regions %+v %+v", regions[0], regions[1])
+	}
+
+	if err = j.reset(); err != nil || !j.isEmpty() {
+		t.Errorf("reset: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package aws_sqs
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -19,8 +20,10 @@ func init() {
 }
 
 type AwsSqsPub struct {
-	svc      *sqs.SQS
-	queueUrl string
+	svc            *sqs.SQS
+	queueUrl       string
+	queueUrls      map[string]string // the urls of the routed queues by name
+	queueUrlsMutex sync.Mutex
 }
 
 func (k *AwsSqsPub) GetName() string {
@@ -53,22 +56,47 @@ func (k *AwsSqsPub) initialize(awsAccessKeyId, awsSecretAccessKey, region, queue
 	}
 	k.svc = sqs.New(sess)
 
+	k.queueUrls = make(map[string]string)
+	k.queueUrl, err = k.getQueueUrl(queueName)
+
+	return err
+}
+
+func (k *AwsSqsPub) getQueueUrl(queueName string) (string, error) {
+	k.queueUrlsMutex.Lock()
+	defer k.queueUrlsMutex.Unlock()
+	if queueUrl, found := k.queueUrls[queueName]; found {
+		return queueUrl, nil
+	}
+
 	result, err := k.svc.GetQueueUrl(&sqs.GetQueueUrlInput{
 		QueueName: aws.String(queueName),
 	})
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == sqs.ErrCodeQueueDoesNotExist {
-			return fmt.Errorf("unable to find queue %s", queueName)
+			return "", fmt.Errorf("unable to find queue %s", queueName)
 		}
-		return fmt.Errorf("get queue %s url: %v", queueName, err)
+		return "", fmt.Errorf("get queue %s url: %v", queueName, err)
 	}
 
-	k.queueUrl = *result.QueueUrl
-
-	return nil
+	k.queueUrls[queueName] = *result.QueueUrl
+	return *result.QueueUrl, nil
 }
 
 func (k *AwsSqsPub) SendMessage(key string, message proto.Message) (err error) {
+	return k.sendMessage(k.queueUrl, key, message)
+}
+
+// SendMessageToTopic sends to the existing sqs queue named by the topic
+func (k *AwsSqsPub) SendMessageToTopic(queueName string, key string, message proto.Message) (err error) {
+	queueUrl, err := k.getQueueUrl(queueName)
+	if err != nil {
+		return err
+	}
+	return k.sendMessage(queueUrl, key, message)
+}
+
+func (k *AwsSqsPub) sendMessage(queueUrl string, key string, message proto.Message) (err error) {
 
 	text := proto.MarshalTextString(message)
 
@@ -81,11 +109,11 @@ func (k *AwsSqsPub) SendMessage(key string, message proto.Message) (err error) {
 			},
 		},
 		MessageBody: aws.String(text),
-		QueueUrl:    &k.queueUrl,
+		QueueUrl:    &queueUrl,
 	})
 
 	if err != nil {
-		return fmt.Errorf("send message to sqs %s: %v", k.queueUrl, err)
+		return fmt.Errorf("send message to sqs %s: %v", queueUrl, err)
 	}
 
 	return nil
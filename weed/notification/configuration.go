@@ -1,6 +1,10 @@
 package notification
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/util"
 	"github.com/golang/protobuf/proto"
@@ -14,12 +18,43 @@ type MessageQueue interface {
 	SendMessage(key string, message proto.Message) error
 }
 
+// TopicMessageQueue can also send to topics other than the configured one, for the topic routes
+type TopicMessageQueue interface {
+	SendMessageToTopic(topic string, key string, message proto.Message) error
+}
+
+// TopicRoute sends the events under the path prefix to the topic, instead of the configured topic
+type TopicRoute struct {
+	PathPrefix string
+	Topic      string
+}
+
 var (
 	MessageQueues []MessageQueue
 
 	Queue MessageQueue
+
+	// TopicRoutes are sorted by the path prefix length, the longest first
+	TopicRoutes []TopicRoute
 )
 
+// SendMessage sends the message to the topic of the longest matching route, or to the configured topic
+func SendMessage(key string, message proto.Message) error {
+	if topic := findTopic(TopicRoutes, key); topic != "" {
+		return Queue.(TopicMessageQueue).SendMessageToTopic(topic, key, message)
+	}
+	return Queue.SendMessage(key, message)
+}
+
+func findTopic(routes []TopicRoute, key string) string {
+	for _, route := range routes {
+		if strings.HasPrefix(key, route.PathPrefix) {
+			return route.Topic
+		}
+	}
+	return ""
+}
+
 func LoadConfiguration(config *util.ViperProxy, prefix string) {
 
 	if config == nil {
@@ -36,6 +71,14 @@ func LoadConfiguration(config *util.ViperProxy, prefix string) {
 			}
 			Queue = queue
 			glog.V(0).Infof("Configure notification message queue for %s", queue.GetName())
+			routes, err := loadTopicRoutes(config, prefix+"routes")
+			if err != nil {
+				glog.Fatalf("Failed to load notification routes: %v", err)
+			}
+			if _, ok := queue.(TopicMessageQueue); len(routes) > 0 && !ok {
+				glog.Fatalf("Notification message queue %s does not support routes", queue.GetName())
+			}
+			TopicRoutes = routes
 			return
 		}
 	}
@@ -54,3 +97,27 @@ func validateOneEnabledQueue(config *util.ViperProxy) {
 		}
 	}
 }
+
+// loadTopicRoutes reads the [[notification.routes]] tables, each with a path_prefix and a topic
+func loadTopicRoutes(config *util.ViperProxy, key string) (routes []TopicRoute, err error) {
+	items, ok := config.Get(key).([]interface{})
+	if !ok {
+		return nil, nil
+	}
+	for _, item := range items {
+		route, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected route %v", item)
+		}
+		pathPrefix, _ := route["path_prefix"].(string)
+		topic, _ := route["topic"].(string)
+		if pathPrefix == "" || topic == "" {
+			return nil, fmt.Errorf("route %v needs both path_prefix and topic", item)
+		}
+		routes = append(routes, TopicRoute{PathPrefix: pathPrefix, Topic: topic})
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].PathPrefix) > len(routes[j].PathPrefix)
+	})
+	return routes, nil
+}
@@ -0,0 +1,52 @@
+package notification
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+func TestTopicRoutes(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("toml")
+	err := v.ReadConfig(strings.NewReader(`
+[[notification.routes]]
+path_prefix = "/buckets/"
+topic = "buckets"
+
+[[notification.routes]]
+path_prefix = "/buckets/Images/"
+topic = "images"
+`))
+	assert.Equal(t, nil, err)
+
+	routes, err := loadTopicRoutes(&util.ViperProxy{Viper: v}, "notification.routes")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []TopicRoute{
+		{PathPrefix: "/buckets/Images/", Topic: "images"},
+		{PathPrefix: "/buckets/", Topic: "buckets"},
+	}, routes)
+
+	assert.Equal(t, "images", findTopic(routes, "/buckets/Images/a.jpg"))
+	assert.Equal(t, "buckets", findTopic(routes, "/buckets/images/a.jpg"))
+	assert.Equal(t, "", findTopic(routes, "/home/a.txt"))
+
+	routes, err = loadTopicRoutes(&util.ViperProxy{Viper: v}, "notification.missing")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(routes))
+}
+
+func TestTopicRoutesIncomplete(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("toml")
+	v.ReadConfig(strings.NewReader(`
+[[notification.routes]]
+path_prefix = "/buckets/"
+`))
+	_, err := loadTopicRoutes(&util.ViperProxy{Viper: v}, "notification.routes")
+	assert.NotEqual(t, nil, err)
+}
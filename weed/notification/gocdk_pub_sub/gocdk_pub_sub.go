@@ -24,6 +24,7 @@ import (
 	"gocloud.dev/pubsub/rabbitpubsub"
 	"net/url"
 	"path"
+	"sync"
 	"time"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
@@ -46,8 +47,10 @@ func getPath(rawUrl string) string {
 }
 
 type GoCDKPubSub struct {
-	topicURL string
-	topic    *pubsub.Topic
+	topicURL    string
+	topic       *pubsub.Topic
+	topics      map[string]*pubsub.Topic // the routed topics by url
+	topicsMutex sync.Mutex
 }
 
 func (k *GoCDKPubSub) GetName() string {
@@ -84,21 +87,52 @@ func (k *GoCDKPubSub) Initialize(configuration util.Configuration, prefix string
 		glog.Fatalf("Failed to open topic: %v", err)
 	}
 	k.topic = topic
+	k.topics = make(map[string]*pubsub.Topic)
 	k.doReconnect()
 	return nil
 }
 
 func (k *GoCDKPubSub) SendMessage(key string, message proto.Message) error {
+	return k.sendMessage(k.topic, k.topicURL, key, message)
+}
+
+// SendMessageToTopic opens the topic url on the first use, and again after a failed send
+func (k *GoCDKPubSub) SendMessageToTopic(topicURL string, key string, message proto.Message) error {
+	k.topicsMutex.Lock()
+	topic, found := k.topics[topicURL]
+	if !found {
+		var err error
+		if topic, err = pubsub.OpenTopic(context.Background(), topicURL); err != nil {
+			k.topicsMutex.Unlock()
+			return fmt.Errorf("open topic %s: %v", topicURL, err)
+		}
+		k.topics[topicURL] = topic
+	}
+	k.topicsMutex.Unlock()
+
+	err := k.sendMessage(topic, topicURL, key, message)
+	if err != nil {
+		k.topicsMutex.Lock()
+		if k.topics[topicURL] == topic {
+			delete(k.topics, topicURL)
+			topic.Shutdown(context.Background())
+		}
+		k.topicsMutex.Unlock()
+	}
+	return err
+}
+
+func (k *GoCDKPubSub) sendMessage(topic *pubsub.Topic, topicURL string, key string, message proto.Message) error {
 	bytes, err := proto.Marshal(message)
 	if err != nil {
 		return err
 	}
-	err = k.topic.Send(context.Background(), &pubsub.Message{
+	err = topic.Send(context.Background(), &pubsub.Message{
 		Body:     bytes,
 		Metadata: map[string]string{"key": key},
 	})
 	if err != nil {
-		return fmt.Errorf("send message via Go CDK pubsub %s: %v", k.topicURL, err)
+		return fmt.Errorf("send message via Go CDK pubsub %s: %v", topicURL, err)
 	}
 	return nil
 }
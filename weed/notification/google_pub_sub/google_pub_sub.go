@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync"
 
 	"cloud.google.com/go/pubsub"
 	"github.com/chrislusf/seaweedfs/weed/glog"
@@ -18,7 +19,10 @@ func init() {
 }
 
 type GooglePubSub struct {
-	topic *pubsub.Topic
+	client      *pubsub.Client
+	topic       *pubsub.Topic
+	topics      map[string]*pubsub.Topic
+	topicsMutex sync.Mutex
 }
 
 func (k *GooglePubSub) GetName() string {
@@ -52,22 +56,51 @@ func (k *GooglePubSub) initialize(google_application_credentials, projectId, top
 		glog.Fatalf("Failed to create client: %v", err)
 	}
 
-	k.topic = client.Topic(topicName)
-	if exists, err := k.topic.Exists(ctx); err == nil {
-		if !exists {
-			k.topic, err = client.CreateTopic(ctx, topicName)
-			if err != nil {
-				glog.Fatalf("Failed to create topic %s: %v", topicName, err)
-			}
-		}
-	} else {
-		glog.Fatalf("Failed to check topic %s: %v", topicName, err)
+	k.client = client
+	k.topics = make(map[string]*pubsub.Topic)
+	k.topic, err = k.getOrCreateTopic(ctx, topicName)
+	if err != nil {
+		glog.Fatalf("Failed to open topic %s: %v", topicName, err)
 	}
 
 	return nil
 }
 
+func (k *GooglePubSub) getOrCreateTopic(ctx context.Context, topicName string) (*pubsub.Topic, error) {
+	k.topicsMutex.Lock()
+	defer k.topicsMutex.Unlock()
+	if topic, found := k.topics[topicName]; found {
+		return topic, nil
+	}
+
+	topic := k.client.Topic(topicName)
+	exists, err := topic.Exists(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("check topic %s: %v", topicName, err)
+	}
+	if !exists {
+		topic, err = k.client.CreateTopic(ctx, topicName)
+		if err != nil {
+			return nil, fmt.Errorf("create topic %s: %v", topicName, err)
+		}
+	}
+	k.topics[topicName] = topic
+	return topic, nil
+}
+
 func (k *GooglePubSub) SendMessage(key string, message proto.Message) (err error) {
+	return k.sendMessage(k.topic, key, message)
+}
+
+func (k *GooglePubSub) SendMessageToTopic(topicName string, key string, message proto.Message) (err error) {
+	topic, err := k.getOrCreateTopic(context.Background(), topicName)
+	if err != nil {
+		return err
+	}
+	return k.sendMessage(topic, key, message)
+}
+
+func (k *GooglePubSub) sendMessage(topic *pubsub.Topic, key string, message proto.Message) (err error) {
 
 	bytes, err := proto.Marshal(message)
 	if err != nil {
@@ -75,14 +108,14 @@ func (k *GooglePubSub) SendMessage(key string, message proto.Message) (err error
 	}
 
 	ctx := context.Background()
-	result := k.topic.Publish(ctx, &pubsub.Message{
+	result := topic.Publish(ctx, &pubsub.Message{
 		Data:       bytes,
 		Attributes: map[string]string{"key": key},
 	})
 
 	_, err = result.Get(ctx)
 	if err != nil {
-		return fmt.Errorf("send message to google pub sub %s: %v", k.topic.String(), err)
+		return fmt.Errorf("send message to google pub sub %s: %v", topic.String(), err)
 	}
 
 	return nil
@@ -1,6 +1,8 @@
 package kafka
 
 import (
+	"fmt"
+
 	"github.com/Shopify/sarama"
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/notification"
@@ -14,7 +16,7 @@ func init() {
 
 type KafkaQueue struct {
 	topic    string
-	producer sarama.AsyncProducer
+	producer sarama.SyncProducer
 }
 
 func (k *KafkaQueue) GetName() string {
@@ -36,47 +38,36 @@ func (k *KafkaQueue) initialize(hosts []string, topic string) (err error) {
 	config.Producer.Partitioner = sarama.NewHashPartitioner
 	config.Producer.Return.Successes = true
 	config.Producer.Return.Errors = true
-	k.producer, err = sarama.NewAsyncProducer(hosts, config)
+	k.producer, err = sarama.NewSyncProducer(hosts, config)
 	if err != nil {
 		return err
 	}
 	k.topic = topic
-	go k.handleSuccess()
-	go k.handleError()
 	return nil
 }
 
 func (k *KafkaQueue) SendMessage(key string, message proto.Message) (err error) {
+	return k.SendMessageToTopic(k.topic, key, message)
+}
+
+// SendMessageToTopic waits for the acknowledgement, so the failed messages can be sent again
+func (k *KafkaQueue) SendMessageToTopic(topic string, key string, message proto.Message) (err error) {
 	bytes, err := proto.Marshal(message)
 	if err != nil {
 		return
 	}
 
 	msg := &sarama.ProducerMessage{
-		Topic: k.topic,
+		Topic: topic,
 		Key:   sarama.StringEncoder(key),
 		Value: sarama.ByteEncoder(bytes),
 	}
 
-	k.producer.Input() <- msg
-
-	return nil
-}
-
-func (k *KafkaQueue) handleSuccess() {
-	for {
-		pm := <-k.producer.Successes()
-		if pm != nil {
-			glog.V(3).Infof("producer message success, partition:%d offset:%d key:%v", pm.Partition, pm.Offset, pm.Key)
-		}
+	partition, offset, err := k.producer.SendMessage(msg)
+	if err != nil {
+		return fmt.Errorf("send message to kafka topic %s: %v", topic, err)
 	}
-}
+	glog.V(3).Infof("producer message success, partition:%d offset:%d key:%v", partition, offset, key)
 
-func (k *KafkaQueue) handleError() {
-	for {
-		err := <-k.producer.Errors()
-		if err != nil {
-			glog.Errorf("producer message error, partition:%d offset:%d key:%v value:%s error(%v) topic:%s", err.Msg.Partition, err.Msg.Offset, err.Msg.Key, err.Msg.Value, err.Err, k.topic)
-		}
-	}
+	return nil
 }
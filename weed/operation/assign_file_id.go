@@ -23,6 +23,7 @@ type VolumeAssignRequest struct {
 	Rack                string
 	DataNode            string
 	WritableVolumeCount uint32
+	BatchCount          uint32 // assign this many file ids, spread over different volumes
 }
 
 type AssignResult struct {
@@ -32,6 +33,15 @@ type AssignResult struct {
 	Count     uint64              `json:"count,omitempty"`
 	Error     string              `json:"error,omitempty"`
 	Auth      security.EncodedJwt `json:"auth,omitempty"`
+	Batch     []AssignedFileId    `json:"batch,omitempty"`
+}
+
+// AssignedFileId is one of the file ids assigned in a batch
+type AssignedFileId struct {
+	Fid       string              `json:"fid,omitempty"`
+	Url       string              `json:"url,omitempty"`
+	PublicUrl string              `json:"publicUrl,omitempty"`
+	Auth      security.EncodedJwt `json:"auth,omitempty"`
 }
 
 func Assign(masterFn GetMasterFn, grpcDialOption grpc.DialOption, primaryRequest *VolumeAssignRequest, alternativeRequests ...*VolumeAssignRequest) (*AssignResult, error) {
@@ -60,6 +70,7 @@ func Assign(masterFn GetMasterFn, grpcDialOption grpc.DialOption, primaryRequest
 				Rack:                request.Rack,
 				DataNode:            request.DataNode,
 				WritableVolumeCount: request.WritableVolumeCount,
+				BatchCount:          request.BatchCount,
 			}
 			resp, grpcErr := masterClient.Assign(context.Background(), req)
 			if grpcErr != nil {
@@ -72,6 +83,15 @@ func Assign(masterFn GetMasterFn, grpcDialOption grpc.DialOption, primaryRequest
 			ret.PublicUrl = resp.PublicUrl
 			ret.Error = resp.Error
 			ret.Auth = security.EncodedJwt(resp.Auth)
+			ret.Batch = nil
+			for _, assigned := range resp.Batch {
+				ret.Batch = append(ret.Batch, AssignedFileId{
+					Fid:       assigned.Fid,
+					Url:       assigned.Url,
+					PublicUrl: assigned.PublicUrl,
+					Auth:      security.EncodedJwt(assigned.Auth),
+				})
+			}
 
 			return nil
 
@@ -115,6 +135,7 @@ type StorageOption struct {
 	TtlSeconds        int32
 	Fsync             bool
 	VolumeGrowthCount uint32
+	Cipher            bool // encrypt the chunks on the volume servers
 }
 
 func (so *StorageOption) TtlString() string {
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"sort"
+	"strings"
 	"sync"
 
 	"google.golang.org/grpc"
@@ -171,6 +172,7 @@ func (cf *ChunkedFileReader) WriteTo(w io.Writer) (n int64, err error) {
 	if chunkIndex < 0 {
 		return n, ErrInvalidRange
 	}
+	cf.lookupChunkVolumes(chunkIndex)
 	for ; chunkIndex < len(cf.chunkList); chunkIndex++ {
 		ci := cf.chunkList[chunkIndex]
 		// if we need read date from local volume server first?
@@ -192,6 +194,25 @@ func (cf *ChunkedFileReader) WriteTo(w io.Writer) (n int64, err error) {
 	return n, nil
 }
 
+// lookupChunkVolumes resolves the volumes of the remaining chunks with one request,
+// so the chunks do not need to be looked up one by one
+func (cf *ChunkedFileReader) lookupChunkVolumes(chunkIndex int) {
+	var vids []string
+	for _, ci := range cf.chunkList[chunkIndex:] {
+		if commaSep := strings.Index(ci.Fid, ","); commaSep > 0 {
+			vids = append(vids, ci.Fid[0:commaSep])
+		}
+	}
+	if len(vids) <= 1 {
+		return
+	}
+	if _, err := LookupBatch(func() string {
+		return cf.master
+	}, vids); err != nil {
+		glog.V(1).Infof("lookup chunk volumes %v: %v", vids, err)
+	}
+}
+
 func (cf *ChunkedFileReader) ReadAt(p []byte, off int64) (n int, err error) {
 	cf.Seek(off, 0)
 	return cf.Read(p)
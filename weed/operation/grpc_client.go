@@ -1,20 +1,34 @@
 package operation
 
 import (
+	"context"
 	"fmt"
-	"strconv"
 	"strings"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/pb"
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
 	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
 func WithVolumeServerClient(volumeServer string, grpcDialOption grpc.DialOption, fn func(volume_server_pb.VolumeServerClient) error) error {
+	return WithVolumeServerClientContext(context.Background(), volumeServer, grpcDialOption, fn)
+}
+
+// WithVolumeServerClientContext does not start fn if the ctx is already done.
+// The fn should use the same ctx for its calls, so that they are cancelled together.
+func WithVolumeServerClientContext(ctx context.Context, volumeServer string, grpcDialOption grpc.DialOption, fn func(volume_server_pb.VolumeServerClient) error) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	grpcAddress, err := toVolumeServerGrpcAddress(volumeServer)
 	if err != nil {
@@ -28,14 +42,39 @@ func WithVolumeServerClient(volumeServer string, grpcDialOption grpc.DialOption,
 
 }
 
+// VolumeCopyRetryPolicy retries copying the volume files from a volume server which is unavailable for a while
+var VolumeCopyRetryPolicy = util.RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     16 * time.Second,
+	Multiplier:     2,
+	IsRetriable:    IsUnavailable,
+}
+
+// WithVolumeServerClientRetry retries fn by the policy, so fn must be safe to repeat
+func WithVolumeServerClientRetry(ctx context.Context, policy util.RetryPolicy, volumeServer string, grpcDialOption grpc.DialOption, fn func(volume_server_pb.VolumeServerClient) error) error {
+	return policy.Do(ctx, "volume server "+volumeServer, func() error {
+		return WithVolumeServerClientContext(ctx, volumeServer, grpcDialOption, fn)
+	})
+}
+
+// IsUnavailable tells whether the error is from an unavailable server or a broken connection,
+// also when the grpc error is wrapped into other errors
+func IsUnavailable(err error) bool {
+	if status.Code(err) == codes.Unavailable {
+		return true
+	}
+	message := err.Error()
+	return strings.Contains(message, "code = Unavailable") || strings.Contains(message, "transport")
+}
+
 func toVolumeServerGrpcAddress(volumeServer string) (grpcAddress string, err error) {
-	sepIndex := strings.LastIndex(volumeServer, ":")
-	port, err := strconv.Atoi(volumeServer[sepIndex+1:])
+	grpcAddress, err = pb.ParseServerToGrpcAddress(volumeServer)
 	if err != nil {
 		glog.Errorf("failed to parse volume server address: %v", volumeServer)
 		return "", err
 	}
-	return fmt.Sprintf("%s:%d", volumeServer[0:sepIndex], port+10000), nil
+	return grpcAddress, nil
 }
 
 func WithMasterServerClient(masterServer string, grpcDialOption grpc.DialOption, fn func(masterClient master_pb.SeaweedClient) error) error {
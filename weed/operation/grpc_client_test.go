@@ -0,0 +1,28 @@
+package operation
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsUnavailable(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+	for _, tt := range []struct {
+		err      error
+		expected bool
+	}{
+		{unavailable, true},
+		{fmt.Errorf("failed to copy 1.dat file: %v", unavailable), true},
+		{errors.New("transport is closing"), true},
+		{status.Error(codes.NotFound, "volume 1 not found"), false},
+		{status.Error(codes.Canceled, "context canceled"), false},
+	} {
+		if IsUnavailable(tt.err) != tt.expected {
+			t.Errorf("%v is unavailable: %v, expected %v", tt.err, !tt.expected, tt.expected)
+		}
+	}
+}
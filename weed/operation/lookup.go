@@ -16,12 +16,14 @@ import (
 )
 
 type Location struct {
-	Url       string `json:"url,omitempty"`
-	PublicUrl string `json:"publicUrl,omitempty"`
+	Url        string `json:"url,omitempty"`
+	PublicUrl  string `json:"publicUrl,omitempty"`
+	DataCenter string `json:"dataCenter,omitempty"`
 }
 type LookupResult struct {
 	VolumeId  string     `json:"volumeId,omitempty"`
 	Locations []Location `json:"locations,omitempty"`
+	Epoch     uint64     `json:"epoch,omitempty"` // replica membership epoch, if known to the master
 	Error     string     `json:"error,omitempty"`
 }
 
@@ -29,6 +31,11 @@ func (lr *LookupResult) String() string {
 	return fmt.Sprintf("VolumeId:%s, Locations:%v, Error:%s", lr.VolumeId, lr.Locations, lr.Error)
 }
 
+// LookupBatchResult is the result of looking up several volume ids in one request
+type LookupBatchResult struct {
+	VolumeIdLocations map[string]LookupResult `json:"volumeIdLocations,omitempty"`
+}
+
 var (
 	vc VidCache // caching of volume locations, re-check if after 10 minutes
 )
@@ -36,11 +43,16 @@ var (
 func Lookup(masterFn GetMasterFn, vid string) (ret *LookupResult, err error) {
 	locations, cache_err := vc.Get(vid)
 	if cache_err != nil {
-		if ret, err = do_lookup(masterFn, vid); err == nil {
-			vc.Set(vid, ret.Locations, 10*time.Minute)
-		}
-	} else {
-		ret = &LookupResult{VolumeId: vid, Locations: locations}
+		return LookupNoCache(masterFn, vid)
+	}
+	return &LookupResult{VolumeId: vid, Locations: locations, Epoch: vc.GetEpoch(vid)}, nil
+}
+
+// LookupNoCache looks up the volume from the master, and refreshes the cached locations
+func LookupNoCache(masterFn GetMasterFn, vid string) (ret *LookupResult, err error) {
+	if ret, err = do_lookup(masterFn, vid); err == nil {
+		vc.Set(vid, ret.Locations, 10*time.Minute)
+		vc.SetEpoch(vid, ret.Epoch)
 	}
 	return
 }
@@ -64,6 +76,47 @@ func do_lookup(masterFn GetMasterFn, vid string) (*LookupResult, error) {
 	return &ret, nil
 }
 
+// LookupBatch finds the locations of the volume ids by cache,
+// and looks up all the unknown volume ids with one http request
+func LookupBatch(masterFn GetMasterFn, vids []string) (map[string]LookupResult, error) {
+	ret := make(map[string]LookupResult)
+	var unknownVids []string
+	seen := make(map[string]bool)
+	for _, vid := range vids {
+		if seen[vid] {
+			continue
+		}
+		seen[vid] = true
+		if locations, cacheErr := vc.Get(vid); cacheErr == nil {
+			ret[vid] = LookupResult{VolumeId: vid, Locations: locations, Epoch: vc.GetEpoch(vid)}
+		} else {
+			unknownVids = append(unknownVids, vid)
+		}
+	}
+	if len(unknownVids) == 0 {
+		return ret, nil
+	}
+
+	values := make(url.Values)
+	values.Add("volumeIds", strings.Join(unknownVids, ","))
+	jsonBlob, err := util.Post("http://"+masterFn()+"/dir/lookup", values)
+	if err != nil {
+		return nil, err
+	}
+	var batchResult LookupBatchResult
+	if err = json.Unmarshal(jsonBlob, &batchResult); err != nil {
+		return nil, err
+	}
+	for vid, result := range batchResult.VolumeIdLocations {
+		if result.Error == "" {
+			vc.Set(vid, result.Locations, 10*time.Minute)
+			vc.SetEpoch(vid, result.Epoch)
+		}
+		ret[vid] = result
+	}
+	return ret, nil
+}
+
 func LookupFileId(masterFn GetMasterFn, fileId string) (fullUrl string, err error) {
 	parts := strings.Split(fileId, ",")
 	if len(parts) != 2 {
@@ -119,7 +172,7 @@ func LookupVolumeIds(masterFn GetMasterFn, grpcDialOption grpc.DialOption, vids
 					PublicUrl: loc.PublicUrl,
 				})
 			}
-			if vidLocations.Error != "" {
+			if vidLocations.Error == "" {
 				vc.Set(vidLocations.VolumeId, locations, 10*time.Minute)
 			}
 			ret[vidLocations.VolumeId] = LookupResult{
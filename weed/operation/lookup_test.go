@@ -0,0 +1,101 @@
+package operation
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestLookupMaster answers the batch lookups from the volume locations, and records the looked up volume ids
+func newTestLookupMaster(locations map[string][]Location, requests *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		volumeIds := r.FormValue("volumeIds")
+		*requests = append(*requests, volumeIds)
+		if volumeIds == "" {
+			http.Error(w, "no volume ids", http.StatusBadRequest)
+			return
+		}
+		result := LookupBatchResult{VolumeIdLocations: make(map[string]LookupResult)}
+		for _, vid := range strings.Split(volumeIds, ",") {
+			if locs, found := locations[vid]; found {
+				result.VolumeIdLocations[vid] = LookupResult{VolumeId: vid, Locations: locs, Epoch: 7}
+			} else {
+				result.VolumeIdLocations[vid] = LookupResult{VolumeId: vid, Error: "volume id " + vid + " not found"}
+			}
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+}
+
+func TestLookupBatchHitsAndMisses(t *testing.T) {
+
+	var requests []string
+	master := newTestLookupMaster(map[string][]Location{
+		"9101": {{Url: "a.com:8080"}},
+		"9102": {{Url: "b.com:8080"}, {Url: "c.com:8080"}},
+	}, &requests)
+	defer master.Close()
+	masterFn := func() string { return strings.TrimPrefix(master.URL, "http://") }
+
+	results, err := LookupBatch(masterFn, []string{"9101", "9102", "9103", "9101"})
+	if err != nil {
+		t.Fatalf("lookup batch: %v", err)
+	}
+	if len(requests) != 1 || requests[0] != "9101,9102,9103" {
+		t.Fatalf("looked up %v, expected one request for 9101,9102,9103", requests)
+	}
+	if len(results) != 3 {
+		t.Fatalf("%d results, expected 3", len(results))
+	}
+	if r := results["9102"]; r.Error != "" || len(r.Locations) != 2 || r.Epoch != 7 {
+		t.Errorf("volume 9102: %+v", r)
+	}
+	if r := results["9103"]; r.Error == "" || len(r.Locations) != 0 {
+		t.Errorf("missing volume 9103: %+v", r)
+	}
+
+	// the found volumes are cached, and the missing ones are looked up again
+	results, err = LookupBatch(masterFn, []string{"9101", "9102", "9103"})
+	if err != nil {
+		t.Fatalf("lookup batch again: %v", err)
+	}
+	if len(requests) != 2 || requests[1] != "9103" {
+		t.Fatalf("looked up %v, expected the second request only for 9103", requests)
+	}
+	if r := results["9101"]; r.Error != "" || len(r.Locations) != 1 || r.Locations[0].Url != "a.com:8080" || r.Epoch != 7 {
+		t.Errorf("cached volume 9101: %+v", r)
+	}
+
+	// all cached volumes do not need the master
+	if _, err = LookupBatch(masterFn, []string{"9102", "9101"}); err != nil || len(requests) != 2 {
+		t.Errorf("looked up %v for cached volumes: %v", requests, err)
+	}
+}
+
+func TestLookupBatchMasterError(t *testing.T) {
+
+	var requests []string
+	master := newTestLookupMaster(map[string][]Location{
+		"9201": {{Url: "a.com:8080"}},
+	}, &requests)
+	masterFn := func() string { return strings.TrimPrefix(master.URL, "http://") }
+
+	if _, err := LookupBatch(masterFn, []string{"9201"}); err != nil {
+		t.Fatalf("lookup batch: %v", err)
+	}
+	master.Close()
+
+	// the cached volume is not returned with the lookup error of the other volumes
+	results, err := LookupBatch(masterFn, []string{"9201", "9202"})
+	if err == nil || results != nil {
+		t.Errorf("lookup with the master down: %v, %v", results, err)
+	}
+
+	// the cached volume is still found without the master
+	results, err = LookupBatch(masterFn, []string{"9201"})
+	if err != nil || len(results["9201"].Locations) != 1 {
+		t.Errorf("lookup cached volume with the master down: %v, %v", results, err)
+	}
+}
@@ -13,6 +13,7 @@ var ErrorNotFound = errors.New("not found")
 
 type VidInfo struct {
 	Locations       []Location
+	Epoch           uint64
 	NextRefreshTime time.Time
 }
 type VidCache struct {
@@ -57,3 +58,30 @@ func (vc *VidCache) Set(vid string, locations []Location, duration time.Duration
 		vc.cache[id-1].NextRefreshTime = time.Now().Add(duration)
 	}
 }
+
+// SetEpoch records the replica membership epoch of the volume, along with the cached locations
+func (vc *VidCache) SetEpoch(vid string, epoch uint64) {
+	id, err := strconv.Atoi(vid)
+	if err != nil {
+		return
+	}
+	vc.Lock()
+	defer vc.Unlock()
+	if 0 < id && id <= len(vc.cache) {
+		vc.cache[id-1].Epoch = epoch
+	}
+}
+
+// GetEpoch returns the replica membership epoch of the volume, or 0 if unknown
+func (vc *VidCache) GetEpoch(vid string) uint64 {
+	id, err := strconv.Atoi(vid)
+	if err != nil {
+		return 0
+	}
+	vc.RLock()
+	defer vc.RUnlock()
+	if 0 < id && id <= len(vc.cache) {
+		return vc.cache[id-1].Epoch
+	}
+	return 0
+}
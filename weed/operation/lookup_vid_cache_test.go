@@ -24,3 +24,18 @@ func TestCaching(t *testing.T) {
 		t.Fatal("Not found vid 123")
 	}
 }
+
+func TestCachingEpoch(t *testing.T) {
+	var (
+		vc VidCache
+	)
+	vc.SetEpoch("3", 5)
+	if epoch := vc.GetEpoch("3"); epoch != 0 {
+		t.Fatalf("epoch %d of the volume without locations", epoch)
+	}
+	vc.Set("3", []Location{{Url: "a.com:8080"}}, time.Second)
+	vc.SetEpoch("3", 5)
+	if epoch := vc.GetEpoch("3"); epoch != 5 {
+		t.Fatalf("epoch %d, expected 5", epoch)
+	}
+}
@@ -2,9 +2,12 @@ package operation
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -103,6 +106,30 @@ func TestCreateNeedleFromRequest(t *testing.T) {
 
 }
 
+func TestCreateNeedleFromRequestChecksums(t *testing.T) {
+	newRequest := func(header, value string) *http.Request {
+		req, _ := http.NewRequest("PUT", "http://localhost:8080/389,0f084d17353afda0", bytes.NewReader([]byte(textContent)))
+		req.Header.Set(header, value)
+		return req
+	}
+
+	_, _, _, err := needle.CreateNeedleFromRequest(newRequest("Content-MD5", util.Base64Md5([]byte(textContent))), false, 1024*1024, &bytes.Buffer{})
+	assert.Equal(t, nil, err, "matched md5: %v", err)
+
+	_, _, _, err = needle.CreateNeedleFromRequest(newRequest("Content-MD5", util.Base64Md5([]byte("x"))), false, 1024*1024, &bytes.Buffer{})
+	assert.NotEqual(t, nil, err, "mismatched md5")
+
+	sha256Sum := sha256.Sum256([]byte(textContent))
+	_, _, _, err = needle.CreateNeedleFromRequest(newRequest("X-Amz-Content-Sha256", hex.EncodeToString(sha256Sum[:])), false, 1024*1024, &bytes.Buffer{})
+	assert.Equal(t, nil, err, "matched sha256: %v", err)
+
+	_, _, _, err = needle.CreateNeedleFromRequest(newRequest("X-Amz-Content-Sha256", strings.Repeat("0", 64)), false, 1024*1024, &bytes.Buffer{})
+	assert.NotEqual(t, nil, err, "mismatched sha256")
+
+	_, _, _, err = needle.CreateNeedleFromRequest(newRequest("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD"), false, 1024*1024, &bytes.Buffer{})
+	assert.Equal(t, nil, err, "not a sha256: %v", err)
+}
+
 var textContent = `Redistribution and use in source and binary forms, with or without
 modification, are permitted provided that the following conditions are
 met:
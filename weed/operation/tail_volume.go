@@ -27,15 +27,28 @@ func TailVolume(masterFn GetMasterFn, grpcDialOption grpc.DialOption, vid needle
 }
 
 func TailVolumeFromSource(volumeServer string, grpcDialOption grpc.DialOption, vid needle.VolumeId, sinceNs uint64, idleTimeoutSeconds int, fn func(n *needle.Needle) error) error {
+	return tailVolumeFromSource(volumeServer, grpcDialOption, &volume_server_pb.VolumeTailSenderRequest{
+		VolumeId:           uint32(vid),
+		SinceNs:            sinceNs,
+		IdleTimeoutSeconds: uint32(idleTimeoutSeconds),
+	}, fn)
+}
+
+// TailVolumeFromSourceUntilCaughtUp reads the needles since sinceNs, and stops at the end of the volume
+func TailVolumeFromSourceUntilCaughtUp(volumeServer string, grpcDialOption grpc.DialOption, vid needle.VolumeId, sinceNs uint64, fn func(n *needle.Needle) error) error {
+	return tailVolumeFromSource(volumeServer, grpcDialOption, &volume_server_pb.VolumeTailSenderRequest{
+		VolumeId:      uint32(vid),
+		SinceNs:       sinceNs,
+		UntilCaughtUp: true,
+	}, fn)
+}
+
+func tailVolumeFromSource(volumeServer string, grpcDialOption grpc.DialOption, req *volume_server_pb.VolumeTailSenderRequest, fn func(n *needle.Needle) error) error {
 	return WithVolumeServerClient(volumeServer, grpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		stream, err := client.VolumeTailSender(ctx, &volume_server_pb.VolumeTailSenderRequest{
-			VolumeId:           uint32(vid),
-			SinceNs:            sinceNs,
-			IdleTimeoutSeconds: uint32(idleTimeoutSeconds),
-		})
+		stream, err := client.VolumeTailSender(ctx, req)
 		if err != nil {
 			return err
 		}
@@ -2,18 +2,23 @@ package operation
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"mime"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/textproto"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"golang.org/x/net/http2"
+
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 	"github.com/chrislusf/seaweedfs/weed/security"
@@ -53,13 +58,54 @@ type HTTPClient interface {
 
 var (
 	HttpClient HTTPClient
+	// UploadTimeout fails the uploads to volume servers taking longer than it, if not zero
+	UploadTimeout time.Duration
 )
 
 func init() {
-	HttpClient = &http.Client{Transport: &http.Transport{
-		MaxIdleConns:        1024,
-		MaxIdleConnsPerHost: 1024,
-	}}
+	ConfigureHttpClient(1024, false)
+}
+
+// ConfigureHttpClient sets up the keep-alive http client for the volume server traffic.
+// With useH2c, the cleartext requests are sent as HTTP/2, multiplexed on one connection per volume server.
+// The requests to https volume servers use HTTP/2 if negotiated by TLS ALPN.
+func ConfigureHttpClient(maxIdleConnsPerHost int, useH2c bool) {
+	HttpClient = &http.Client{Transport: newVolumeServerTransport(maxIdleConnsPerHost, useH2c)}
+}
+
+func newVolumeServerTransport(maxIdleConnsPerHost int, useH2c bool) http.RoundTripper {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        maxIdleConnsPerHost,
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+		ForceAttemptHTTP2:   true,
+	}
+	if !useH2c {
+		return transport
+	}
+	return &h2cTransport{
+		h2c: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+		tls: transport,
+	}
+}
+
+// h2cTransport only sends the cleartext requests as h2c, since a TLS connection can not carry h2c
+type h2cTransport struct {
+	h2c *http2.Transport
+	tls *http.Transport
+}
+
+func (t *h2cTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.h2c.RoundTrip(req)
+	}
+	return t.tls.RoundTrip(req)
 }
 
 var fileNameEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
@@ -143,6 +189,8 @@ func doUploadData(uploadUrl string, filename string, cipher bool, data []byte, i
 		clearData, err = util.DecompressData(data)
 		if err == nil {
 			clearDataLen = len(clearData)
+		} else {
+			clearData = data
 		}
 	}
 
@@ -161,7 +209,7 @@ func doUploadData(uploadUrl string, filename string, cipher bool, data []byte, i
 		uploadResult, err = upload_content(uploadUrl, func(w io.Writer) (err error) {
 			_, err = w.Write(encryptedData)
 			return
-		}, "", false, len(encryptedData), "", nil, jwt)
+		}, "", false, len(encryptedData), "", nil, jwt, util.Base64Md5(encryptedData))
 		if uploadResult == nil {
 			return
 		}
@@ -170,11 +218,17 @@ func doUploadData(uploadUrl string, filename string, cipher bool, data []byte, i
 		uploadResult.CipherKey = cipherKey
 		uploadResult.Size = uint32(clearDataLen)
 	} else {
+		// the volume server verifies the md5 of the uncompressed data
+		contentMd5 := util.Base64Md5(data)
+		if contentIsGzipped {
+			contentMd5 = util.Base64Md5(clearData)
+		}
+
 		// upload data
 		uploadResult, err = upload_content(uploadUrl, func(w io.Writer) (err error) {
 			_, err = w.Write(data)
 			return
-		}, filename, contentIsGzipped, len(data), mtype, pairMap, jwt)
+		}, filename, contentIsGzipped, len(data), mtype, pairMap, jwt, contentMd5)
 		if uploadResult == nil {
 			return
 		}
@@ -187,7 +241,7 @@ func doUploadData(uploadUrl string, filename string, cipher bool, data []byte, i
 	return uploadResult, err
 }
 
-func upload_content(uploadUrl string, fillBufferFunction func(w io.Writer) error, filename string, isGzipped bool, originalDataSize int, mtype string, pairMap map[string]string, jwt security.EncodedJwt) (*UploadResult, error) {
+func upload_content(uploadUrl string, fillBufferFunction func(w io.Writer) error, filename string, isGzipped bool, originalDataSize int, mtype string, pairMap map[string]string, jwt security.EncodedJwt, contentMd5 string) (*UploadResult, error) {
 	buf := GetBuffer()
 	defer PutBuffer(buf)
 	body_writer := multipart.NewWriter(buf)
@@ -219,7 +273,13 @@ func upload_content(uploadUrl string, fillBufferFunction func(w io.Writer) error
 		return nil, err
 	}
 
-	req, postErr := http.NewRequest("POST", uploadUrl, bytes.NewReader(buf.Bytes()))
+	ctx := context.Background()
+	if UploadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, UploadTimeout)
+		defer cancel()
+	}
+	req, postErr := http.NewRequestWithContext(ctx, "POST", uploadUrl, bytes.NewReader(buf.Bytes()))
 	if postErr != nil {
 		glog.V(1).Infof("create upload request %s: %v", uploadUrl, postErr)
 		return nil, fmt.Errorf("create upload request %s: %v", uploadUrl, postErr)
@@ -231,6 +291,9 @@ func upload_content(uploadUrl string, fillBufferFunction func(w io.Writer) error
 	if jwt != "" {
 		req.Header.Set("Authorization", "BEARER "+string(jwt))
 	}
+	if contentMd5 != "" {
+		req.Header.Set("Content-MD5", contentMd5)
+	}
 	// print("+")
 	resp, post_err := HttpClient.Do(req)
 	if post_err != nil {
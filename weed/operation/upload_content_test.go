@@ -0,0 +1,55 @@
+package operation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestVolumeServerTransportHttp2(t *testing.T) {
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cleartextServer := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer cleartextServer.Close()
+
+	tlsServer := httptest.NewUnstartedServer(handler)
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	for _, useH2c := range []bool{false, true} {
+		transport := newVolumeServerTransport(16, useH2c)
+		tlsTransport, ok := transport.(*http.Transport)
+		if useH2c {
+			tlsTransport = transport.(*h2cTransport).tls
+		} else if !ok {
+			t.Fatalf("unexpected transport %T", transport)
+		}
+		tlsTransport.TLSClientConfig = tlsServer.Client().Transport.(*http.Transport).TLSClientConfig
+		client := &http.Client{Transport: transport}
+
+		expected := map[string]int{
+			cleartextServer.URL: 1,
+			tlsServer.URL:       2,
+		}
+		if useH2c {
+			expected[cleartextServer.URL] = 2
+		}
+		for url, protoMajor := range expected {
+			resp, err := client.Get(url)
+			if err != nil {
+				t.Fatalf("h2c %v get %s: %v", useH2c, url, err)
+			}
+			resp.Body.Close()
+			if resp.ProtoMajor != protoMajor {
+				t.Errorf("h2c %v get %s: HTTP/%d, expected HTTP/%d", useH2c, url, resp.ProtoMajor, protoMajor)
+			}
+		}
+	}
+}
@@ -239,26 +239,9 @@ func Mkdir(filerClient FilerClient, parentDirectoryPath string, dirName string,
 func MkFile(filerClient FilerClient, parentDirectoryPath string, fileName string, chunks []*FileChunk, fn func(entry *Entry)) error {
 	return filerClient.WithFilerClient(func(client SeaweedFilerClient) error {
 
-		entry := &Entry{
-			Name:        fileName,
-			IsDirectory: false,
-			Attributes: &FuseAttributes{
-				Mtime:    time.Now().Unix(),
-				Crtime:   time.Now().Unix(),
-				FileMode: uint32(0770),
-				Uid:      OS_UID,
-				Gid:      OS_GID,
-			},
-			Chunks: chunks,
-		}
-
-		if fn != nil {
-			fn(entry)
-		}
-
 		request := &CreateEntryRequest{
 			Directory: parentDirectoryPath,
-			Entry:     entry,
+			Entry:     NewFileEntry(fileName, chunks, fn),
 		}
 
 		glog.V(1).Infof("create file: %s/%s", parentDirectoryPath, fileName)
@@ -271,6 +254,27 @@ func MkFile(filerClient FilerClient, parentDirectoryPath string, fileName string
 	})
 }
 
+// NewFileEntry returns the entry of a new file with the chunks, as created by MkFile
+func NewFileEntry(fileName string, chunks []*FileChunk, fn func(entry *Entry)) *Entry {
+	entry := &Entry{
+		Name:        fileName,
+		IsDirectory: false,
+		Attributes: &FuseAttributes{
+			Mtime:    time.Now().Unix(),
+			Crtime:   time.Now().Unix(),
+			FileMode: uint32(0770),
+			Uid:      OS_UID,
+			Gid:      OS_GID,
+		},
+		Chunks: chunks,
+	}
+
+	if fn != nil {
+		fn(entry)
+	}
+	return entry
+}
+
 func Remove(filerClient FilerClient, parentDirectoryPath, name string, isDeleteData, isRecursive, ignoreRecursiveErr, isFromOtherCluster bool, signatures []int32) error {
 	return filerClient.WithFilerClient(func(client SeaweedFilerClient) error {
 
@@ -102,11 +102,27 @@ func UpdateEntry(client SeaweedFilerClient, request *UpdateEntryRequest) error {
 	_, err := client.UpdateEntry(context.Background(), request)
 	if err != nil {
 		glog.V(1).Infof("update entry %s/%s :%v", request.Directory, request.Entry.Name, err)
+		if strings.Contains(err.Error(), ErrChunksChanged.Error()) {
+			return ErrChunksChanged
+		}
 		return fmt.Errorf("UpdateEntry: %v", err)
 	}
 	return nil
 }
 
+func ApplyMutations(client SeaweedFilerClient, request *ApplyMutationsRequest) error {
+	resp, err := client.ApplyMutations(context.Background(), request)
+	if err != nil {
+		glog.V(1).Infof("apply %d mutations: %v", len(request.Mutations), err)
+		return fmt.Errorf("ApplyMutations: %v", err)
+	}
+	if resp.Error != "" {
+		glog.V(1).Infof("apply %d mutations: %v", len(request.Mutations), resp.Error)
+		return fmt.Errorf("ApplyMutations: %v", resp.Error)
+	}
+	return nil
+}
+
 func LookupEntry(client SeaweedFilerClient, request *LookupDirectoryEntryRequest) (*LookupDirectoryEntryResponse, error) {
 	resp, err := client.LookupDirectoryEntry(context.Background(), request)
 	if err != nil {
@@ -124,6 +140,9 @@ func LookupEntry(client SeaweedFilerClient, request *LookupDirectoryEntryRequest
 
 var ErrNotFound = errors.New("filer: no entry is found in filer store")
 
+// ErrChunksChanged is returned when the entry chunks are not the expected ones of the UpdateEntryRequest
+var ErrChunksChanged = errors.New("filer: the entry chunks are changed")
+
 func IsCreate(event *SubscribeMetadataResponse) bool {
 	return event.EventNotification.NewEntry != nil && event.EventNotification.OldEntry == nil
 }
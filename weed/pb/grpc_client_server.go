@@ -6,17 +6,22 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"math/rand"
 	"net/http"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
 	"github.com/chrislusf/seaweedfs/weed/pb/messaging_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 )
 
 const (
@@ -25,14 +30,23 @@ const (
 
 var (
 	// cache grpc connections
-	grpcClients     = make(map[string]*versionedGrpcClient)
-	grpcClientsLock sync.Mutex
+	grpcClients            = make(map[string]*versionedGrpcClient)
+	grpcClientsLock        sync.Mutex
+	grpcClientsCleanerOnce sync.Once
+
+	// GrpcClientIdleTimeout is how long an unused cached connection is kept
+	GrpcClientIdleTimeout = 10 * time.Minute
 )
 
+// versionedGrpcClient is a grpc connection shared by all calls to the same address.
+// inUse, lastUsed and removed are protected by grpcClientsLock.
 type versionedGrpcClient struct {
 	*grpc.ClientConn
 	version  int
-	errCount int
+	errCount int32
+	inUse    int
+	lastUsed time.Time
+	removed  bool
 }
 
 func init() {
@@ -54,6 +68,8 @@ func NewGrpcServer(opts ...grpc.ServerOption) *grpc.Server {
 		}),
 		grpc.MaxRecvMsgSize(Max_Message_Size),
 		grpc.MaxSendMsgSize(Max_Message_Size),
+		grpc.ChainUnaryInterceptor(requestIdUnaryServerInterceptor),
+		grpc.ChainStreamInterceptor(requestIdStreamServerInterceptor),
 	)
 	for _, opt := range opts {
 		if opt != nil {
@@ -77,7 +93,10 @@ func GrpcDial(ctx context.Context, address string, opts ...grpc.DialOption) (*gr
 			Time:                30 * time.Second, // client ping server if no activity for this long
 			Timeout:             20 * time.Second,
 			PermitWithoutStream: true,
-		}))
+		}),
+		grpc.WithChainUnaryInterceptor(requestIdUnaryClientInterceptor),
+		grpc.WithChainStreamInterceptor(requestIdStreamClientInterceptor),
+	)
 	for _, opt := range opts {
 		if opt != nil {
 			options = append(options, opt)
@@ -86,6 +105,33 @@ func GrpcDial(ctx context.Context, address string, opts ...grpc.DialOption) (*gr
 	return grpc.DialContext(ctx, address, options...)
 }
 
+// the request id of the context is passed along in the grpc metadata, and set to the context of the grpc handlers
+
+func requestIdUnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(request_id.FromIncomingContext(ctx), req)
+}
+
+func requestIdStreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &requestIdServerStream{ServerStream: ss, ctx: request_id.FromIncomingContext(ss.Context())})
+}
+
+type requestIdServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *requestIdServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func requestIdUnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(request_id.OutgoingContext(ctx), method, req, reply, cc, opts...)
+}
+
+func requestIdStreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(request_id.OutgoingContext(ctx), desc, cc, method, opts...)
+}
+
 func getOrCreateConnection(address string, opts ...grpc.DialOption) (*versionedGrpcClient, error) {
 
 	grpcClientsLock.Lock()
@@ -93,7 +139,14 @@ func getOrCreateConnection(address string, opts ...grpc.DialOption) (*versionedG
 
 	existingConnection, found := grpcClients[address]
 	if found {
-		return existingConnection, nil
+		if existingConnection.GetState() != connectivity.Shutdown {
+			existingConnection.inUse++
+			existingConnection.lastUsed = time.Now()
+			return existingConnection, nil
+		}
+		// the connection has been closed, dial a new one
+		existingConnection.removed = true
+		delete(grpcClients, address)
 	}
 
 	grpcConnection, err := GrpcDial(context.Background(), address, opts...)
@@ -102,41 +155,96 @@ func getOrCreateConnection(address string, opts ...grpc.DialOption) (*versionedG
 	}
 
 	vgc := &versionedGrpcClient{
-		grpcConnection,
-		rand.Int(),
-		0,
+		ClientConn: grpcConnection,
+		version:    rand.Int(),
+		inUse:      1,
+		lastUsed:   time.Now(),
 	}
 	grpcClients[address] = vgc
 
+	startIdleGrpcClientsCleaner()
+
 	return vgc, nil
 }
 
+// releaseConnection closes the connection if it has been removed from the cache and is not used any more
+func releaseConnection(vgc *versionedGrpcClient) {
+	grpcClientsLock.Lock()
+	defer grpcClientsLock.Unlock()
+
+	vgc.inUse--
+	if vgc.removed && vgc.inUse == 0 {
+		vgc.Close()
+	}
+}
+
+// removeConnection removes the connection from the cache, so the next call dials a new one.
+// The connection is closed after the calls still using it are completed.
+func removeConnection(address string, vgc *versionedGrpcClient) {
+	grpcClientsLock.Lock()
+	defer grpcClientsLock.Unlock()
+
+	if t, ok := grpcClients[address]; ok && t.version == vgc.version {
+		vgc.removed = true
+		delete(grpcClients, address)
+	}
+}
+
+// startIdleGrpcClientsCleaner closes the cached connections not used for a while,
+// e.g., connections to removed volume servers
+func startIdleGrpcClientsCleaner() {
+	grpcClientsCleanerOnce.Do(func() {
+		go func() {
+			for range time.Tick(GrpcClientIdleTimeout / 2) {
+				grpcClientsLock.Lock()
+				for address, vgc := range grpcClients {
+					if vgc.inUse == 0 && time.Since(vgc.lastUsed) > GrpcClientIdleTimeout {
+						vgc.Close()
+						delete(grpcClients, address)
+					}
+				}
+				grpcClientsLock.Unlock()
+			}
+		}()
+	})
+}
+
 func WithCachedGrpcClient(fn func(*grpc.ClientConn) error, address string, opts ...grpc.DialOption) error {
 
 	vgc, err := getOrCreateConnection(address, opts...)
 	if err != nil {
 		return fmt.Errorf("getOrCreateConnection %s: %v", address, err)
 	}
+	defer releaseConnection(vgc)
+
 	executionErr := fn(vgc.ClientConn)
-	if executionErr != nil {
-		vgc.errCount++
-		if vgc.errCount > 3 ||
+	if executionErr == nil {
+		atomic.StoreInt32(&vgc.errCount, 0)
+	} else if !isCallCancelled(executionErr) {
+		errCount := atomic.AddInt32(&vgc.errCount, 1)
+		if errCount > 3 ||
 			strings.Contains(executionErr.Error(), "transport") ||
 			strings.Contains(executionErr.Error(), "connection closed") {
-			grpcClientsLock.Lock()
-			if t, ok := grpcClients[address]; ok {
-				if t.version == vgc.version {
-					vgc.Close()
-					delete(grpcClients, address)
-				}
-			}
-			grpcClientsLock.Unlock()
+			removeConnection(address, vgc)
 		}
 	}
 
 	return executionErr
 }
 
+// isCallCancelled tells whether the call is stopped by its own context,
+// which does not indicate a broken connection shared with other calls
+func isCallCancelled(err error) bool {
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
 func ParseServerToGrpcAddress(server string) (serverGrpcAddress string, err error) {
 	return ParseServerAddress(server, 10000)
 }
@@ -158,22 +266,14 @@ func ParseServerAddress(server string, deltaPort int) (newServerAddress string,
 		return "", fmt.Errorf("server port parse error: %v", parseErr)
 	}
 
-	newPort := int(port) + deltaPort
+	newPort := port + deltaPort
 
-	return fmt.Sprintf("%s:%d", host, newPort), nil
+	return util.JoinHostPort(host, newPort), nil
 }
 
-func hostAndPort(address string) (host string, port uint64, err error) {
-	colonIndex := strings.LastIndex(address, ":")
-	if colonIndex < 0 {
-		return "", 0, fmt.Errorf("server should have hostname:port format: %v", address)
-	}
-	port, err = strconv.ParseUint(address[colonIndex+1:], 10, 64)
-	if err != nil {
-		return "", 0, fmt.Errorf("server port parse error: %v", err)
-	}
-
-	return address[:colonIndex], port, err
+// hostAndPort accepts "host:port" and "[ipv6]:port", and returns the host without the brackets
+func hostAndPort(address string) (host string, port int, err error) {
+	return util.SplitHostPort(address)
 }
 
 func ServerToGrpcAddress(server string) (serverGrpcAddress string) {
@@ -183,9 +283,9 @@ func ServerToGrpcAddress(server string) (serverGrpcAddress string) {
 		glog.Fatalf("server address %s parse error: %v", server, parseErr)
 	}
 
-	grpcPort := int(port) + 10000
+	grpcPort := port + 10000
 
-	return fmt.Sprintf("%s:%d", host, grpcPort)
+	return util.JoinHostPort(host, grpcPort)
 }
 
 func GrpcAddressToServerAddress(grpcAddress string) (serverAddress string) {
@@ -194,9 +294,9 @@ func GrpcAddressToServerAddress(grpcAddress string) (serverAddress string) {
 		glog.Fatalf("server grpc address %s parse error: %v", grpcAddress, parseErr)
 	}
 
-	port := int(grpcPort) - 10000
+	port := grpcPort - 10000
 
-	return fmt.Sprintf("%s:%d", host, port)
+	return util.JoinHostPort(host, port)
 }
 
 func WithMasterClient(master string, grpcDialOption grpc.DialOption, fn func(client master_pb.SeaweedClient) error) error {
@@ -0,0 +1,26 @@
+package pb
+
+import "testing"
+
+func TestServerToGrpcAddress(t *testing.T) {
+	for server, expected := range map[string]string{
+		"localhost:8080":       "localhost:18080",
+		"10.0.0.1:9333":        "10.0.0.1:19333",
+		"[::1]:8888":           "[::1]:18888",
+		"[2001:db8::1]:8080":   "[2001:db8::1]:18080",
+		"volume.example:18080": "volume.example:28080",
+	} {
+		if actual := ServerToGrpcAddress(server); actual != expected {
+			t.Errorf("ServerToGrpcAddress(%s) = %s, expected %s", server, actual, expected)
+		}
+		if actual, err := ParseServerToGrpcAddress(server); err != nil || actual != expected {
+			t.Errorf("ParseServerToGrpcAddress(%s) = %s, %v", server, actual, err)
+		}
+		if actual := GrpcAddressToServerAddress(expected); actual != server {
+			t.Errorf("GrpcAddressToServerAddress(%s) = %s, expected %s", expected, actual, server)
+		}
+	}
+	if _, err := ParseServerToGrpcAddress("::1"); err == nil {
+		t.Errorf("expected error for the ipv6 address without port")
+	}
+}
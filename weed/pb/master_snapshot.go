@@ -0,0 +1,48 @@
+package pb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/golang/protobuf/jsonpb"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+)
+
+func LoadMasterSnapshot(fileName string) (*master_pb.MasterSnapshot, error) {
+
+	data, readErr := ioutil.ReadFile(fileName)
+	if readErr != nil {
+		return nil, fmt.Errorf("fail to read %s : %v", fileName, readErr)
+	}
+
+	snapshot := &master_pb.MasterSnapshot{}
+	if err := jsonpb.Unmarshal(bytes.NewReader(data), snapshot); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %v", fileName, err)
+	}
+	if snapshot.SnapshotTsNs == 0 || snapshot.NextFileKey == 0 {
+		return nil, fmt.Errorf("%s is not a master snapshot", fileName)
+	}
+
+	return snapshot, nil
+}
+
+func SaveMasterSnapshot(fileName string, snapshot *master_pb.MasterSnapshot) error {
+
+	m := jsonpb.Marshaler{
+		EmitDefaults: true,
+		Indent:       "  ",
+	}
+
+	text, marshalErr := m.MarshalToString(snapshot)
+	if marshalErr != nil {
+		return fmt.Errorf("marshal to %s: %v", fileName, marshalErr)
+	}
+
+	if writeErr := ioutil.WriteFile(fileName, []byte(text), 0644); writeErr != nil {
+		return fmt.Errorf("fail to write %s : %v", fileName, writeErr)
+	}
+
+	return nil
+}
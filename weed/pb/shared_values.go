@@ -3,3 +3,10 @@ package pb
 const (
 	AdminShellClient = "adminShell"
 )
+
+// the target types of the pings between the servers
+const (
+	MasterType       = "master"
+	VolumeServerType = "volumeServer"
+	FilerType        = "filer"
+)
@@ -0,0 +1,164 @@
+package replication
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/replication/sink"
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3_replication"
+	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// BucketReplication replicates the objects of the S3 buckets, as selected by the bucket replication configurations.
+// An object "/buckets/<bucket>/<key>" is replicated to "<sink directory>/<destination bucket>/<key>".
+type BucketReplication struct {
+	bucketsDir string
+	configs    map[string]*s3_replication.ReplicationConfiguration
+	sync.RWMutex
+}
+
+func NewBucketReplication(bucketsDir string) *BucketReplication {
+	return &BucketReplication{
+		bucketsDir: strings.TrimSuffix(bucketsDir, "/"),
+		configs:    make(map[string]*s3_replication.ReplicationConfiguration),
+	}
+}
+
+// LoadBuckets reads the replication configurations of all buckets
+func (br *BucketReplication) LoadBuckets(filerClient filer_pb.FilerClient) error {
+	return filer_pb.ReadDirAllEntries(filerClient, util.FullPath(br.bucketsDir), "", func(entry *filer_pb.Entry, isLast bool) error {
+		if entry.IsDirectory {
+			br.updateBucket(entry.Name, entry)
+		}
+		return nil
+	})
+}
+
+func (br *BucketReplication) updateBucket(bucket string, bucketEntry *filer_pb.Entry) {
+	var config *s3_replication.ReplicationConfiguration
+	if bucketEntry != nil {
+		var err error
+		if config, err = s3_replication.LoadReplicationConfiguration(bucketEntry); err != nil {
+			glog.Errorf("bucket %s replication configuration: %v", bucket, err)
+		}
+	}
+
+	br.Lock()
+	defer br.Unlock()
+	if config == nil {
+		if _, found := br.configs[bucket]; found {
+			glog.V(0).Infof("stop replicating bucket %s", bucket)
+		}
+		delete(br.configs, bucket)
+		return
+	}
+	if _, found := br.configs[bucket]; !found {
+		glog.V(0).Infof("start replicating bucket %s", bucket)
+	}
+	br.configs[bucket] = config
+}
+
+// route finds the replication rule of the object, and its path in the destination
+func (br *BucketReplication) route(fullpath util.FullPath) (bucket, target string, rule *s3_replication.Rule) {
+	if fullpath == "" || !strings.HasPrefix(string(fullpath), br.bucketsDir+"/") {
+		return
+	}
+	bucketAndKey := string(fullpath)[len(br.bucketsDir)+1:]
+	t := strings.Index(bucketAndKey, "/")
+	if t < 0 {
+		return
+	}
+	bucket, key := bucketAndKey[:t], bucketAndKey[t+1:]
+	if strings.HasPrefix(key, ".uploads/") {
+		// the multipart uploads in progress
+		return
+	}
+
+	br.RLock()
+	config, found := br.configs[bucket]
+	br.RUnlock()
+	if !found {
+		return
+	}
+	if rule = config.MatchRule(key); rule == nil {
+		return
+	}
+	return bucket, util.Join("/", rule.Destination.DestinationBucket(), key), rule
+}
+
+// Replicate applies the object change of the metadata event to the sink, under the target directory.
+// The bucket entry changes update the replication configurations.
+// The tsNs is the event time, to measure the replication latency, or 0 if unknown.
+func (br *BucketReplication) Replicate(dataSink sink.ReplicationSink, targetDir string, dir string, message *filer_pb.EventNotification, tsNs int64) error {
+
+	if strings.TrimSuffix(dir, "/") == br.bucketsDir {
+		if message.NewEntry != nil && message.NewEntry.IsDirectory {
+			br.updateBucket(message.NewEntry.Name, message.NewEntry)
+		}
+		if message.OldEntry != nil && (message.NewEntry == nil || message.OldEntry.Name != message.NewEntry.Name) {
+			br.updateBucket(message.OldEntry.Name, nil)
+		}
+		return nil
+	}
+
+	var oldPath, newPath util.FullPath
+	if message.OldEntry != nil && !message.OldEntry.IsDirectory {
+		oldPath = util.NewFullPath(dir, message.OldEntry.Name)
+	}
+	if message.NewEntry != nil && !message.NewEntry.IsDirectory {
+		newPath = util.NewFullPath(message.NewParentPath, message.NewEntry.Name)
+	}
+	oldBucket, oldTarget, oldRule := br.route(oldPath)
+	newBucket, newTarget, newRule := br.route(newPath)
+
+	// the deleted or renamed object
+	if oldRule != nil && (newRule == nil || oldTarget != newTarget) && oldRule.ReplicatesDeletes() {
+		key := util.Join(targetDir, oldTarget)
+		if err := dataSink.DeleteEntry(key, false, message.DeleteChunks, message.Signatures); err != nil {
+			stats.S3ReplicationCounter.WithLabelValues(oldBucket, "failed").Inc()
+			return fmt.Errorf("replicate deletion %s: %v", key, err)
+		}
+		stats.S3ReplicationCounter.WithLabelValues(oldBucket, "delete").Inc()
+	}
+
+	if newRule == nil {
+		return nil
+	}
+
+	// the created or updated object
+	key := util.Join(targetDir, newTarget)
+	var err error
+	if oldRule != nil && oldTarget == newTarget {
+		var foundExisting bool
+		newParentPath, _ := util.FullPath(key).DirAndName()
+		foundExisting, err = dataSink.UpdateEntry(key, message.OldEntry, newParentPath, message.NewEntry, message.DeleteChunks, message.Signatures)
+		if !foundExisting {
+			err = dataSink.CreateEntry(key, message.NewEntry, message.Signatures)
+		}
+	} else {
+		err = dataSink.CreateEntry(key, message.NewEntry, message.Signatures)
+	}
+	if err != nil {
+		stats.S3ReplicationCounter.WithLabelValues(newBucket, "failed").Inc()
+		return fmt.Errorf("replicate %s: %v", key, err)
+	}
+	stats.S3ReplicationCounter.WithLabelValues(newBucket, "write").Inc()
+	stats.S3ReplicationBytesCounter.WithLabelValues(newBucket).Add(float64(filer.FileSize(message.NewEntry)))
+
+	if tsNs > 0 {
+		latency := time.Since(time.Unix(0, tsNs))
+		stats.S3ReplicationLatencyGauge.WithLabelValues(newBucket).Set(latency.Seconds())
+		if minutes := newRule.ThresholdMinutes(); minutes > 0 && latency > time.Duration(minutes)*time.Minute {
+			stats.S3ReplicationCounter.WithLabelValues(newBucket, "missedThreshold").Inc()
+			glog.Warningf("replicated %s after %v, exceeding the %d minutes threshold", newPath, latency, minutes)
+		}
+	}
+
+	return nil
+}
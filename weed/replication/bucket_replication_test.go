@@ -0,0 +1,102 @@
+package replication
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/replication/source"
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3_replication"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+type recordingSink struct {
+	operations []string
+}
+
+func (s *recordingSink) GetName() string { return "recording" }
+func (s *recordingSink) Initialize(configuration util.Configuration, prefix string) error {
+	return nil
+}
+func (s *recordingSink) DeleteEntry(key string, isDirectory, deleteIncludeChunks bool, signatures []int32) error {
+	s.operations = append(s.operations, "delete "+key)
+	return nil
+}
+func (s *recordingSink) CreateEntry(key string, entry *filer_pb.Entry, signatures []int32) error {
+	s.operations = append(s.operations, "create "+key)
+	return nil
+}
+func (s *recordingSink) UpdateEntry(key string, oldEntry *filer_pb.Entry, newParentPath string, newEntry *filer_pb.Entry, deleteIncludeChunks bool, signatures []int32) (foundExistingEntry bool, err error) {
+	s.operations = append(s.operations, "update "+key)
+	return true, nil
+}
+func (s *recordingSink) GetSinkToDirectory() string            { return "/" }
+func (s *recordingSink) SetSourceFiler(s2 *source.FilerSource) {}
+func (s *recordingSink) IsIncremental() bool                   { return false }
+
+func TestBucketReplication(t *testing.T) {
+
+	config := `<ReplicationConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Rule>
+    <Status>Enabled</Status>
+    <Filter><Prefix>docs/</Prefix></Filter>
+    <Destination><Bucket>arn:aws:s3:::backup</Bucket></Destination>
+    <DeleteMarkerReplication><Status>Enabled</Status></DeleteMarkerReplication>
+  </Rule>
+  <Rule>
+    <Status>Enabled</Status>
+    <Priority>2</Priority>
+    <Filter><Prefix>docs/private/</Prefix></Filter>
+    <Destination><Bucket>arn:aws:s3:::private</Bucket></Destination>
+  </Rule>
+</ReplicationConfiguration>`
+
+	br := NewBucketReplication("/buckets")
+	dataSink := &recordingSink{}
+
+	file := func(name string) *filer_pb.Entry {
+		return &filer_pb.Entry{Name: name, Attributes: &filer_pb.FuseAttributes{}}
+	}
+	create := func(dir, name string) {
+		assert.Nil(t, br.Replicate(dataSink, "/target", dir, &filer_pb.EventNotification{NewEntry: file(name), NewParentPath: dir}, 0))
+	}
+	remove := func(dir, name string) {
+		assert.Nil(t, br.Replicate(dataSink, "/target", dir, &filer_pb.EventNotification{OldEntry: file(name)}, 0))
+	}
+
+	// configure the bucket
+	bucketEntry := &filer_pb.Entry{Name: "b1", IsDirectory: true, Extended: map[string][]byte{s3_replication.ExtendedKey: []byte(config)}}
+	assert.Nil(t, br.Replicate(dataSink, "/target", "/buckets", &filer_pb.EventNotification{NewEntry: bucketEntry, NewParentPath: "/buckets"}, 0))
+
+	create("/buckets/b1/docs", "a.txt")
+	create("/buckets/b1/docs/private", "b.txt")
+	create("/buckets/b1/images", "c.jpg")
+	create("/buckets/b2/docs", "d.txt")
+	create("/buckets/b1/.uploads/xyz", "0001.part")
+	remove("/buckets/b1/docs", "a.txt")
+	remove("/buckets/b1/docs/private", "b.txt")
+
+	// rename within the replicated folder
+	assert.Nil(t, br.Replicate(dataSink, "/target", "/buckets/b1/docs", &filer_pb.EventNotification{
+		OldEntry: file("e.txt"), NewEntry: file("f.txt"), NewParentPath: "/buckets/b1/docs"}, 0))
+	// update in place
+	assert.Nil(t, br.Replicate(dataSink, "/target", "/buckets/b1/docs", &filer_pb.EventNotification{
+		OldEntry: file("g.txt"), NewEntry: file("g.txt"), NewParentPath: "/buckets/b1/docs"}, 0))
+
+	// remove the configuration
+	assert.Nil(t, br.Replicate(dataSink, "/target", "/buckets", &filer_pb.EventNotification{
+		OldEntry: bucketEntry, NewEntry: &filer_pb.Entry{Name: "b1", IsDirectory: true}, NewParentPath: "/buckets"}, 0))
+	create("/buckets/b1/docs", "h.txt")
+
+	assert.Equal(t, []string{
+		"create /target/backup/docs/a.txt",
+		"create /target/private/docs/private/b.txt",
+		"delete /target/backup/docs/a.txt",
+		"delete /target/backup/docs/e.txt",
+		"create /target/backup/docs/f.txt",
+		"update /target/backup/docs/g.txt",
+	}, dataSink.operations, fmt.Sprintf("%v", dataSink.operations))
+
+}
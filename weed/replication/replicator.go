@@ -16,8 +16,9 @@ import (
 )
 
 type Replicator struct {
-	sink   sink.ReplicationSink
-	source *source.FilerSource
+	sink              sink.ReplicationSink
+	source            *source.FilerSource
+	bucketReplication *BucketReplication
 }
 
 func NewReplicator(sourceConfig util.Configuration, configPrefix string, dataSink sink.ReplicationSink) *Replicator {
@@ -27,9 +28,28 @@ func NewReplicator(sourceConfig util.Configuration, configPrefix string, dataSin
 
 	dataSink.SetSourceFiler(source)
 
+	var bucketReplication *BucketReplication
+	if sourceConfig.GetBool(configPrefix + "s3_bucket_replication") {
+		bucketReplication = NewBucketReplication(source.Dir)
+		if err := bucketReplication.LoadBuckets(source); err != nil {
+			glog.Fatalf("load bucket replication configurations under %s: %v", source.Dir, err)
+		}
+	}
+
+	return &Replicator{
+		sink:              dataSink,
+		source:            source,
+		bucketReplication: bucketReplication,
+	}
+}
+
+// ForSink returns the replicator to another sink, sharing the source and the bucket replication configurations
+func (r *Replicator) ForSink(dataSink sink.ReplicationSink) *Replicator {
+	dataSink.SetSourceFiler(r.source)
 	return &Replicator{
-		sink:   dataSink,
-		source: source,
+		sink:              dataSink,
+		source:            r.source,
+		bucketReplication: r.bucketReplication,
 	}
 }
 
@@ -41,6 +61,10 @@ func (r *Replicator) Replicate(ctx context.Context, key string, message *filer_p
 		glog.V(4).Infof("skipping %v outside of %v", key, r.source.Dir)
 		return nil
 	}
+	if r.bucketReplication != nil {
+		dir, _ := util.FullPath(key).DirAndName()
+		return r.bucketReplication.Replicate(r.sink, r.sink.GetSinkToDirectory(), dir, message, 0)
+	}
 	var dateKey string
 	if r.sink.IsIncremental() {
 		var mTime int64
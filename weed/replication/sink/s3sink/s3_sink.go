@@ -93,24 +93,24 @@ func (s3sink *S3Sink) initialize(awsAccessKeyId, awsSecretAccessKey, region, buc
 
 func (s3sink *S3Sink) DeleteEntry(key string, isDirectory, deleteIncludeChunks bool, signatures []int32) error {
 
-	key = cleanKey(key)
+	bucket, key := s3sink.bucketAndKey(key)
 
 	if isDirectory {
 		key = key + "/"
 	}
 
-	return s3sink.deleteObject(key)
+	return s3sink.deleteObject(bucket, key)
 
 }
 
 func (s3sink *S3Sink) CreateEntry(key string, entry *filer_pb.Entry, signatures []int32) error {
-	key = cleanKey(key)
+	bucket, key := s3sink.bucketAndKey(key)
 
 	if entry.IsDirectory {
 		return nil
 	}
 
-	uploadId, err := s3sink.createMultipartUpload(key, entry)
+	uploadId, err := s3sink.createMultipartUpload(bucket, key, entry)
 	if err != nil {
 		return fmt.Errorf("createMultipartUpload: %v", err)
 	}
@@ -126,7 +126,7 @@ func (s3sink *S3Sink) CreateEntry(key string, entry *filer_pb.Entry, signatures
 		wg.Add(1)
 		go func(chunk *filer.ChunkView, index int) {
 			defer wg.Done()
-			if part, uploadErr := s3sink.uploadPart(key, uploadId, partId, chunk); uploadErr != nil {
+			if part, uploadErr := s3sink.uploadPart(bucket, key, uploadId, partId, chunk); uploadErr != nil {
 				err = uploadErr
 				glog.Errorf("uploadPart: %v", uploadErr)
 			} else {
@@ -137,19 +137,31 @@ func (s3sink *S3Sink) CreateEntry(key string, entry *filer_pb.Entry, signatures
 	wg.Wait()
 
 	if err != nil {
-		s3sink.abortMultipartUpload(key, uploadId)
+		s3sink.abortMultipartUpload(bucket, key, uploadId)
 		return fmt.Errorf("uploadPart: %v", err)
 	}
 
-	return s3sink.completeMultipartUpload(context.Background(), key, uploadId, parts)
+	return s3sink.completeMultipartUpload(context.Background(), bucket, key, uploadId, parts)
 
 }
 
 func (s3sink *S3Sink) UpdateEntry(key string, oldEntry *filer_pb.Entry, newParentPath string, newEntry *filer_pb.Entry, deleteIncludeChunks bool, signatures []int32) (foundExistingEntry bool, err error) {
-	key = cleanKey(key)
 	return true, s3sink.CreateEntry(key, newEntry, signatures)
 }
 
+// bucketAndKey uses the configured bucket, or else the first folder of the key as the bucket,
+// e.g., for the replicated objects of the bucket replication
+func (s3sink *S3Sink) bucketAndKey(key string) (bucket, objectKey string) {
+	key = cleanKey(key)
+	if s3sink.bucket != "" {
+		return s3sink.bucket, key
+	}
+	if t := strings.Index(key, "/"); t > 0 {
+		return key[:t], key[t+1:]
+	}
+	return key, ""
+}
+
 func cleanKey(key string) string {
 	if strings.HasPrefix(key, "/") {
 		key = key[1:]
@@ -15,27 +15,27 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
-func (s3sink *S3Sink) deleteObject(key string) error {
+func (s3sink *S3Sink) deleteObject(bucket, key string) error {
 	input := &s3.DeleteObjectInput{
-		Bucket: aws.String(s3sink.bucket),
+		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 	}
 
 	result, err := s3sink.conn.DeleteObject(input)
 
 	if err == nil {
-		glog.V(2).Infof("[%s] delete %s: %v", s3sink.bucket, key, result)
+		glog.V(2).Infof("[%s] delete %s: %v", bucket, key, result)
 	} else {
-		glog.Errorf("[%s] delete %s: %v", s3sink.bucket, key, err)
+		glog.Errorf("[%s] delete %s: %v", bucket, key, err)
 	}
 
 	return err
 
 }
 
-func (s3sink *S3Sink) createMultipartUpload(key string, entry *filer_pb.Entry) (uploadId string, err error) {
+func (s3sink *S3Sink) createMultipartUpload(bucket, key string, entry *filer_pb.Entry) (uploadId string, err error) {
 	input := &s3.CreateMultipartUploadInput{
-		Bucket:      aws.String(s3sink.bucket),
+		Bucket:      aws.String(bucket),
 		Key:         aws.String(key),
 		ContentType: aws.String(entry.Attributes.Mime),
 	}
@@ -43,18 +43,18 @@ func (s3sink *S3Sink) createMultipartUpload(key string, entry *filer_pb.Entry) (
 	result, err := s3sink.conn.CreateMultipartUpload(input)
 
 	if err == nil {
-		glog.V(2).Infof("[%s] createMultipartUpload %s: %v", s3sink.bucket, key, result)
+		glog.V(2).Infof("[%s] createMultipartUpload %s: %v", bucket, key, result)
 	} else {
-		glog.Errorf("[%s] createMultipartUpload %s: %v", s3sink.bucket, key, err)
+		glog.Errorf("[%s] createMultipartUpload %s: %v", bucket, key, err)
 		return "", err
 	}
 
 	return *result.UploadId, err
 }
 
-func (s3sink *S3Sink) abortMultipartUpload(key, uploadId string) error {
+func (s3sink *S3Sink) abortMultipartUpload(bucket, key, uploadId string) error {
 	input := &s3.AbortMultipartUploadInput{
-		Bucket:   aws.String(s3sink.bucket),
+		Bucket:   aws.String(bucket),
 		Key:      aws.String(key),
 		UploadId: aws.String(uploadId),
 	}
@@ -64,27 +64,27 @@ func (s3sink *S3Sink) abortMultipartUpload(key, uploadId string) error {
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			case s3.ErrCodeNoSuchUpload:
-				glog.Errorf("[%s] abortMultipartUpload %s: %v %v", s3sink.bucket, key, s3.ErrCodeNoSuchUpload, aerr.Error())
+				glog.Errorf("[%s] abortMultipartUpload %s: %v %v", bucket, key, s3.ErrCodeNoSuchUpload, aerr.Error())
 			default:
-				glog.Errorf("[%s] abortMultipartUpload %s: %v", s3sink.bucket, key, aerr.Error())
+				glog.Errorf("[%s] abortMultipartUpload %s: %v", bucket, key, aerr.Error())
 			}
 		} else {
 			// Print the error, cast err to awserr.Error to get the Code and
 			// Message from an error.
-			glog.Errorf("[%s] abortMultipartUpload %s: %v", s3sink.bucket, key, aerr.Error())
+			glog.Errorf("[%s] abortMultipartUpload %s: %v", bucket, key, aerr.Error())
 		}
 		return err
 	}
 
-	glog.V(0).Infof("[%s] abortMultipartUpload %s: %v", s3sink.bucket, key, result)
+	glog.V(0).Infof("[%s] abortMultipartUpload %s: %v", bucket, key, result)
 
 	return nil
 }
 
 // To complete multipart upload
-func (s3sink *S3Sink) completeMultipartUpload(ctx context.Context, key, uploadId string, parts []*s3.CompletedPart) error {
+func (s3sink *S3Sink) completeMultipartUpload(ctx context.Context, bucket, key, uploadId string, parts []*s3.CompletedPart) error {
 	input := &s3.CompleteMultipartUploadInput{
-		Bucket:   aws.String(s3sink.bucket),
+		Bucket:   aws.String(bucket),
 		Key:      aws.String(key),
 		UploadId: aws.String(uploadId),
 		MultipartUpload: &s3.CompletedMultipartUpload{
@@ -94,28 +94,28 @@ func (s3sink *S3Sink) completeMultipartUpload(ctx context.Context, key, uploadId
 
 	result, err := s3sink.conn.CompleteMultipartUpload(input)
 	if err == nil {
-		glog.V(2).Infof("[%s] completeMultipartUpload %s: %v", s3sink.bucket, key, result)
+		glog.V(2).Infof("[%s] completeMultipartUpload %s: %v", bucket, key, result)
 	} else {
-		glog.Errorf("[%s] completeMultipartUpload %s: %v", s3sink.bucket, key, err)
-		return fmt.Errorf("[%s] completeMultipartUpload %s: %v", s3sink.bucket, key, err)
+		glog.Errorf("[%s] completeMultipartUpload %s: %v", bucket, key, err)
+		return fmt.Errorf("[%s] completeMultipartUpload %s: %v", bucket, key, err)
 	}
 
 	return nil
 }
 
 // To upload a part
-func (s3sink *S3Sink) uploadPart(key, uploadId string, partId int, chunk *filer.ChunkView) (*s3.CompletedPart, error) {
+func (s3sink *S3Sink) uploadPart(bucket, key, uploadId string, partId int, chunk *filer.ChunkView) (*s3.CompletedPart, error) {
 	var readSeeker io.ReadSeeker
 
 	readSeeker, err := s3sink.buildReadSeeker(chunk)
 	if err != nil {
-		glog.Errorf("[%s] uploadPart %s %d read: %v", s3sink.bucket, key, partId, err)
-		return nil, fmt.Errorf("[%s] uploadPart %s %d read: %v", s3sink.bucket, key, partId, err)
+		glog.Errorf("[%s] uploadPart %s %d read: %v", bucket, key, partId, err)
+		return nil, fmt.Errorf("[%s] uploadPart %s %d read: %v", bucket, key, partId, err)
 	}
 
 	input := &s3.UploadPartInput{
 		Body:       readSeeker,
-		Bucket:     aws.String(s3sink.bucket),
+		Bucket:     aws.String(bucket),
 		Key:        aws.String(key),
 		PartNumber: aws.Int64(int64(partId)),
 		UploadId:   aws.String(uploadId),
@@ -123,9 +123,9 @@ func (s3sink *S3Sink) uploadPart(key, uploadId string, partId int, chunk *filer.
 
 	result, err := s3sink.conn.UploadPart(input)
 	if err == nil {
-		glog.V(2).Infof("[%s] uploadPart %s %d upload: %v", s3sink.bucket, key, partId, result)
+		glog.V(2).Infof("[%s] uploadPart %s %d upload: %v", bucket, key, partId, result)
 	} else {
-		glog.Errorf("[%s] uploadPart %s %d upload: %v", s3sink.bucket, key, partId, err)
+		glog.Errorf("[%s] uploadPart %s %d upload: %v", bucket, key, partId, err)
 	}
 
 	part := &s3.CompletedPart{
@@ -137,10 +137,10 @@ func (s3sink *S3Sink) uploadPart(key, uploadId string, partId int, chunk *filer.
 }
 
 // To upload a part by copying byte range from an existing object as data source
-func (s3sink *S3Sink) uploadPartCopy(key, uploadId string, partId int64, copySource string, sourceStart, sourceStop int) error {
+func (s3sink *S3Sink) uploadPartCopy(bucket, key, uploadId string, partId int64, copySource string, sourceStart, sourceStop int) error {
 	input := &s3.UploadPartCopyInput{
-		Bucket:          aws.String(s3sink.bucket),
-		CopySource:      aws.String(fmt.Sprintf("/%s/%s", s3sink.bucket, copySource)),
+		Bucket:          aws.String(bucket),
+		CopySource:      aws.String(fmt.Sprintf("/%s/%s", bucket, copySource)),
 		CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", sourceStart, sourceStop)),
 		Key:             aws.String(key),
 		PartNumber:      aws.Int64(partId),
@@ -149,9 +149,9 @@ func (s3sink *S3Sink) uploadPartCopy(key, uploadId string, partId int64, copySou
 
 	result, err := s3sink.conn.UploadPartCopy(input)
 	if err == nil {
-		glog.V(0).Infof("[%s] uploadPartCopy %s %d: %v", s3sink.bucket, key, partId, result)
+		glog.V(0).Infof("[%s] uploadPartCopy %s %d: %v", bucket, key, partId, result)
 	} else {
-		glog.Errorf("[%s] uploadPartCopy %s %d: %v", s3sink.bucket, key, partId, err)
+		glog.Errorf("[%s] uploadPartCopy %s %d: %v", bucket, key, partId, err)
 	}
 
 	return err
@@ -0,0 +1,137 @@
+package replication
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+const (
+	sinkQueueSize    = 1024
+	maxRetryInterval = time.Minute
+)
+
+// ReplicationTask is one notification replicated to all the sinks, and acknowledged after all the sinks are done
+type ReplicationTask struct {
+	Key      string
+	Message  *filer_pb.EventNotification
+	pending  int32
+	failures int32
+	onDone   func(isSuccess bool)
+}
+
+func NewReplicationTask(key string, message *filer_pb.EventNotification, sinkCount int, onDone func(isSuccess bool)) *ReplicationTask {
+	return &ReplicationTask{
+		Key:     key,
+		Message: message,
+		pending: int32(sinkCount),
+		onDone:  onDone,
+	}
+}
+
+func (t *ReplicationTask) done(isSuccess bool) {
+	if !isSuccess {
+		atomic.AddInt32(&t.failures, 1)
+	}
+	if atomic.AddInt32(&t.pending, -1) == 0 {
+		t.onDone(atomic.LoadInt32(&t.failures) == 0)
+	}
+}
+
+// SinkQueue replicates the notifications to one sink in order, so that a slow or failing sink does not hold back
+// the other sinks. A failed notification is retried with backoff, holding back the later notifications of the sink
+// to keep them in order, until it succeeds or runs out of retries.
+type SinkQueue struct {
+	id              string
+	replicator      *Replicator
+	includePrefixes []string
+	excludePrefixes []string
+	maxRetries      int
+	retryInterval   time.Duration
+	tasks           chan *ReplicationTask
+}
+
+// NewSinkQueue reads the filtering and the retry options of the sink from the configuration
+func NewSinkQueue(id string, replicator *Replicator, configuration util.Configuration, prefix string) *SinkQueue {
+	configuration.SetDefault(prefix+"max_retries", 5)
+	configuration.SetDefault(prefix+"retry_interval_seconds", 1)
+	return &SinkQueue{
+		id:              id,
+		replicator:      replicator,
+		includePrefixes: configuration.GetStringSlice(prefix + "include_prefixes"),
+		excludePrefixes: configuration.GetStringSlice(prefix + "exclude_prefixes"),
+		maxRetries:      configuration.GetInt(prefix + "max_retries"),
+		retryInterval:   time.Duration(configuration.GetInt(prefix+"retry_interval_seconds")) * time.Second,
+		tasks:           make(chan *ReplicationTask, sinkQueueSize),
+	}
+}
+
+// Enqueue blocks if the sink falls too far behind
+func (q *SinkQueue) Enqueue(task *ReplicationTask) {
+	q.tasks <- task
+	stats.ReplicationQueueGauge.WithLabelValues(q.id).Set(float64(len(q.tasks)))
+}
+
+func (q *SinkQueue) Run() {
+	for task := range q.tasks {
+		stats.ReplicationQueueGauge.WithLabelValues(q.id).Set(float64(len(q.tasks)))
+		task.done(q.replicate(task))
+	}
+}
+
+// isIncluded matches the notification key, i.e., the old path of the renamed entries
+func (q *SinkQueue) isIncluded(key string) bool {
+	for _, prefix := range q.excludePrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return false
+		}
+	}
+	if len(q.includePrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range q.includePrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *SinkQueue) replicate(task *ReplicationTask) bool {
+	if !q.isIncluded(task.Key) {
+		stats.ReplicationCounter.WithLabelValues(q.id, "skipped").Inc()
+		return true
+	}
+
+	retryInterval := q.retryInterval
+	for retries := 0; ; retries++ {
+		err := q.replicator.Replicate(context.Background(), task.Key, task.Message)
+		if err == nil {
+			stats.ReplicationCounter.WithLabelValues(q.id, "replicated").Inc()
+			// the notifications from older filers, or from fs.meta.notify, have no event time
+			if task.Message.TsNs != 0 {
+				lag := time.Since(time.Unix(0, task.Message.TsNs))
+				stats.ReplicationLagGauge.WithLabelValues(q.id).Set(lag.Seconds())
+			}
+			glog.V(1).Infof("replicated %s to %s", task.Key, q.id)
+			return true
+		}
+		if retries >= q.maxRetries {
+			stats.ReplicationCounter.WithLabelValues(q.id, "failed").Inc()
+			glog.Errorf("replicate %s to %s, given up after %d retries: %v", task.Key, q.id, retries, err)
+			return false
+		}
+		stats.ReplicationCounter.WithLabelValues(q.id, "retried").Inc()
+		glog.Warningf("replicate %s to %s, retry in %v: %v", task.Key, q.id, retryInterval, err)
+		time.Sleep(retryInterval)
+		if retryInterval *= 2; retryInterval > maxRetryInterval {
+			retryInterval = maxRetryInterval
+		}
+	}
+}
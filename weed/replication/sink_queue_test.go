@@ -0,0 +1,83 @@
+package replication
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/replication/source"
+)
+
+// failingSink fails the first creations
+type failingSink struct {
+	recordingSink
+	failures int
+}
+
+func (s *failingSink) CreateEntry(key string, entry *filer_pb.Entry, signatures []int32) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("sink unavailable")
+	}
+	return s.recordingSink.CreateEntry(key, entry, signatures)
+}
+
+func TestSinkQueue(t *testing.T) {
+
+	v := viper.New()
+	v.Set("sink.failing.include_prefixes", []string{"/buckets/b1/"})
+	v.Set("sink.failing.exclude_prefixes", []string{"/buckets/b1/tmp/"})
+	v.Set("sink.failing.max_retries", 2)
+
+	recording := &recordingSink{}
+	failing := &failingSink{}
+	replicator := &Replicator{sink: recording, source: &source.FilerSource{Dir: "/buckets"}}
+	queues := []*SinkQueue{
+		NewSinkQueue("recording", replicator, v, "sink.recording."),
+		NewSinkQueue("failing", replicator.ForSink(failing), v, "sink.failing."),
+	}
+	for _, q := range queues {
+		q.retryInterval = time.Millisecond
+		go q.Run()
+	}
+
+	replicate := func(dir, name string) bool {
+		results := make(chan bool, 1)
+		task := NewReplicationTask(dir+"/"+name, &filer_pb.EventNotification{
+			NewEntry:      &filer_pb.Entry{Name: name, Attributes: &filer_pb.FuseAttributes{Mtime: time.Now().Unix()}},
+			NewParentPath: dir,
+			TsNs:          time.Now().UnixNano(),
+		}, len(queues), func(isSuccess bool) {
+			results <- isSuccess
+		})
+		for _, q := range queues {
+			q.Enqueue(task)
+		}
+		select {
+		case isSuccess := <-results:
+			return isSuccess
+		case <-time.After(10 * time.Second):
+			t.Fatalf("replicate %s/%s timed out", dir, name)
+		}
+		return false
+	}
+
+	// filtered out by the failing sink
+	assert.True(t, replicate("/buckets/b2", "a.txt"))
+	assert.True(t, replicate("/buckets/b1/tmp", "b.txt"))
+
+	// succeeded after the retries
+	failing.failures = 2
+	assert.True(t, replicate("/buckets/b1", "c.txt"))
+
+	// given up after the retries
+	failing.failures = 3
+	assert.False(t, replicate("/buckets/b1", "d.txt"))
+
+	assert.Equal(t, []string{"create /b2/a.txt", "create /b1/tmp/b.txt", "create /b1/c.txt", "create /b1/d.txt"}, recording.operations)
+	assert.Equal(t, []string{"create /b1/c.txt"}, failing.operations)
+}
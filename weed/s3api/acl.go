@@ -0,0 +1,208 @@
+package s3api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	xhttp "github.com/chrislusf/seaweedfs/weed/s3api/http"
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3_constants"
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// The canned ACLs of the buckets and the objects are saved in the entry extended attributes,
+// the same as the x-amz-acl header. Only the canned ACLs are supported, not the grants to other accounts.
+const (
+	CannedAclPrivate                = "private"
+	CannedAclPublicRead             = "public-read"
+	CannedAclPublicReadWrite        = "public-read-write"
+	CannedAclAuthenticatedRead      = "authenticated-read"
+	CannedAclBucketOwnerRead        = "bucket-owner-read"
+	CannedAclBucketOwnerFullControl = "bucket-owner-full-control"
+
+	aclGroupAllUsers           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	aclGroupAuthenticatedUsers = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+
+	aclPermissionFullControl = "FULL_CONTROL"
+	aclPermissionRead        = "READ"
+	aclPermissionWrite       = "WRITE"
+)
+
+// AclPolicy is the AccessControlPolicy of the Get/Put Bucket/Object ACL APIs
+type AclPolicy struct {
+	XMLName           xml.Name      `xml:"http://s3.amazonaws.com/doc/2006-03-01/ AccessControlPolicy"`
+	Owner             CanonicalUser `xml:"Owner"`
+	AccessControlList struct {
+		Grants []AclGrant `xml:"Grant"`
+	} `xml:"AccessControlList"`
+}
+
+type AclGrant struct {
+	Grantee    AclGrantee `xml:"Grantee"`
+	Permission string     `xml:"Permission"`
+}
+
+type AclGrantee struct {
+	XMLNS       string `xml:"xmlns:xsi,attr"`
+	Type        string `xml:"xsi:type,attr"`
+	ID          string `xml:"ID,omitempty"`
+	DisplayName string `xml:"DisplayName,omitempty"`
+	URI         string `xml:"URI,omitempty"`
+}
+
+func newCanonicalUserGrant(id, permission string) AclGrant {
+	return AclGrant{
+		Grantee: AclGrantee{
+			XMLNS:       "http://www.w3.org/2001/XMLSchema-instance",
+			Type:        "CanonicalUser",
+			ID:          id,
+			DisplayName: id,
+		},
+		Permission: permission,
+	}
+}
+
+func newGroupGrant(uri, permission string) AclGrant {
+	return AclGrant{
+		Grantee: AclGrantee{
+			XMLNS: "http://www.w3.org/2001/XMLSchema-instance",
+			Type:  "Group",
+			URI:   uri,
+		},
+		Permission: permission,
+	}
+}
+
+func isValidCannedAcl(acl string) bool {
+	switch acl {
+	case CannedAclPrivate, CannedAclPublicRead, CannedAclPublicReadWrite, CannedAclAuthenticatedRead,
+		CannedAclBucketOwnerRead, CannedAclBucketOwnerFullControl:
+		return true
+	}
+	return false
+}
+
+// validateCannedAclHeader checks the x-amz-acl header, if any, of the bucket or object creation
+func validateCannedAclHeader(r *http.Request) s3err.ErrorCode {
+	if acl := r.Header.Get(xhttp.AmzAcl); acl != "" && !isValidCannedAcl(acl) {
+		return s3err.ErrInvalidCannedAcl
+	}
+	for header := range r.Header {
+		if strings.HasPrefix(header, "X-Amz-Grant-") {
+			return s3err.ErrNotImplemented
+		}
+	}
+	return s3err.ErrNone
+}
+
+// getCannedAcl reads the canned ACL of the bucket or object entry, private if not set
+func getCannedAcl(entry *filer_pb.Entry) string {
+	if acl, found := entry.Extended[xhttp.AmzAcl]; found && len(acl) > 0 {
+		return string(acl)
+	}
+	return CannedAclPrivate
+}
+
+// toAclPolicy lists the grants of the canned ACL
+func toAclPolicy(acl, ownerId string) *AclPolicy {
+	policy := &AclPolicy{
+		Owner: CanonicalUser{
+			ID:          ownerId,
+			DisplayName: ownerId,
+		},
+	}
+	grants := []AclGrant{newCanonicalUserGrant(ownerId, aclPermissionFullControl)}
+	switch acl {
+	case CannedAclPublicRead:
+		grants = append(grants, newGroupGrant(aclGroupAllUsers, aclPermissionRead))
+	case CannedAclPublicReadWrite:
+		grants = append(grants, newGroupGrant(aclGroupAllUsers, aclPermissionRead), newGroupGrant(aclGroupAllUsers, aclPermissionWrite))
+	case CannedAclAuthenticatedRead:
+		grants = append(grants, newGroupGrant(aclGroupAuthenticatedUsers, aclPermissionRead))
+	}
+	policy.AccessControlList.Grants = grants
+	return policy
+}
+
+// toCannedAcl finds the canned ACL with the same grants as the access control policy
+func (policy *AclPolicy) toCannedAcl() (string, s3err.ErrorCode) {
+	var allUsersRead, allUsersWrite, authenticatedUsersRead bool
+	for _, grant := range policy.AccessControlList.Grants {
+		switch {
+		case grant.Grantee.URI == aclGroupAllUsers && grant.Permission == aclPermissionRead:
+			allUsersRead = true
+		case grant.Grantee.URI == aclGroupAllUsers && grant.Permission == aclPermissionWrite:
+			allUsersWrite = true
+		case grant.Grantee.URI == aclGroupAuthenticatedUsers && grant.Permission == aclPermissionRead:
+			authenticatedUsersRead = true
+		case grant.Grantee.URI == "" && grant.Grantee.ID == policy.Owner.ID && grant.Permission == aclPermissionFullControl:
+		default:
+			// the grants to other accounts
+			return "", s3err.ErrNotImplemented
+		}
+	}
+	switch {
+	case allUsersRead && allUsersWrite && !authenticatedUsersRead:
+		return CannedAclPublicReadWrite, s3err.ErrNone
+	case allUsersRead && !allUsersWrite && !authenticatedUsersRead:
+		return CannedAclPublicRead, s3err.ErrNone
+	case authenticatedUsersRead && !allUsersRead && !allUsersWrite:
+		return CannedAclAuthenticatedRead, s3err.ErrNone
+	case !allUsersRead && !allUsersWrite && !authenticatedUsersRead:
+		return CannedAclPrivate, s3err.ErrNone
+	}
+	return "", s3err.ErrNotImplemented
+}
+
+// isGrantedByCannedAcl checks the canned ACLs when the identity is not allowed by its actions,
+// for the anonymous requests or the identities without the action.
+//   - the objects are readable by all users if public-read or public-read-write,
+//     or by the authenticated users if authenticated-read
+//   - the buckets are listable likewise
+//   - the objects can be written and deleted by all users if the bucket is public-read-write
+//
+// The ACLs and the tags are not granted by the canned ACLs.
+func (s3a *S3ApiServer) isGrantedByCannedAcl(r *http.Request, identity *Identity, action Action) bool {
+	bucket, object := getBucketAndObject(r)
+	if bucket == "" {
+		return false
+	}
+	query := r.URL.Query()
+	if _, found := query["acl"]; found {
+		return false
+	}
+	if _, found := query["tagging"]; found {
+		return false
+	}
+	isAuthenticated := identity != nil && identity.Name != "anonymous"
+
+	var entry *filer_pb.Entry
+	var err error
+	switch {
+	case action == s3_constants.ACTION_READ && object != "" && object != "/":
+		target := util.FullPath(fmt.Sprintf("%s/%s%s", s3a.option.BucketsPath, bucket, object))
+		dir, name := target.DirAndName()
+		entry, err = s3a.getEntry(dir, name)
+	case action == s3_constants.ACTION_LIST && (object == "" || object == "/"):
+		entry, err = s3a.getCachedBucketEntry(bucket)
+	case action == s3_constants.ACTION_WRITE && object != "" && object != "/" && r.Header.Get("X-Amz-Copy-Source") == "":
+		entry, err = s3a.getCachedBucketEntry(bucket)
+		return err == nil && entry != nil && getCannedAcl(entry) == CannedAclPublicReadWrite
+	default:
+		return false
+	}
+	if err != nil || entry == nil {
+		return false
+	}
+
+	switch getCannedAcl(entry) {
+	case CannedAclPublicRead, CannedAclPublicReadWrite:
+		return true
+	case CannedAclAuthenticatedRead:
+		return isAuthenticated
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package s3api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3_constants"
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+)
+
+func TestCannedAclPolicy(t *testing.T) {
+	for _, acl := range []string{CannedAclPrivate, CannedAclPublicRead, CannedAclPublicReadWrite, CannedAclAuthenticatedRead} {
+		data, err := xml.Marshal(toAclPolicy(acl, "owner"))
+		assert.NoError(t, err)
+
+		policy := &AclPolicy{}
+		assert.NoError(t, xml.Unmarshal(data, policy))
+		cannedAcl, errCode := policy.toCannedAcl()
+		assert.Equal(t, s3err.ErrNone, errCode)
+		assert.Equal(t, acl, cannedAcl, string(data))
+	}
+
+	input := `<AccessControlPolicy xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Owner><ID>owner</ID></Owner>
+  <AccessControlList>
+    <Grant>
+      <Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="CanonicalUser"><ID>someone</ID></Grantee>
+      <Permission>READ</Permission>
+    </Grant>
+  </AccessControlList>
+</AccessControlPolicy>`
+	policy := &AclPolicy{}
+	assert.NoError(t, xml.Unmarshal([]byte(input), policy))
+	_, errCode := policy.toCannedAcl()
+	assert.Equal(t, s3err.ErrNotImplemented, errCode)
+}
+
+func TestValidateCannedAclHeader(t *testing.T) {
+	r := httptest.NewRequest("PUT", "/bucket/object", nil)
+	assert.Equal(t, s3err.ErrNone, validateCannedAclHeader(r))
+	r.Header.Set("x-amz-acl", CannedAclPublicRead)
+	assert.Equal(t, s3err.ErrNone, validateCannedAclHeader(r))
+	r.Header.Set("x-amz-acl", "public")
+	assert.Equal(t, s3err.ErrInvalidCannedAcl, validateCannedAclHeader(r))
+	r.Header.Del("x-amz-acl")
+	r.Header.Set("x-amz-grant-read", "uri=http://acs.amazonaws.com/groups/global/AllUsers")
+	assert.Equal(t, s3err.ErrNotImplemented, validateCannedAclHeader(r))
+}
+
+func TestAuthGrantedByAcl(t *testing.T) {
+	iam := &IdentityAccessManagement{
+		identities: []*Identity{{Name: "admin", Actions: []Action{s3_constants.ACTION_ADMIN}}},
+	}
+	r := mux.SetURLVars(httptest.NewRequest("GET", "/bucket/object", nil), map[string]string{"bucket": "bucket", "object": "object"})
+
+	_, errCode := iam.authRequest(r, s3_constants.ACTION_READ)
+	assert.Equal(t, s3err.ErrAccessDenied, errCode)
+
+	iam.isGrantedByAcl = func(r *http.Request, identity *Identity, action Action) bool {
+		return identity == nil && action == s3_constants.ACTION_READ
+	}
+	_, errCode = iam.authRequest(r, s3_constants.ACTION_READ)
+	assert.Equal(t, s3err.ErrNone, errCode)
+	_, errCode = iam.authRequest(r, s3_constants.ACTION_WRITE)
+	assert.Equal(t, s3err.ErrAccessDenied, errCode)
+}
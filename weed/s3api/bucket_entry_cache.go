@@ -0,0 +1,70 @@
+package s3api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+)
+
+// bucketEntryCacheTtl bounds how long a bucket configuration changed through another s3 gateway is not seen by this one
+const bucketEntryCacheTtl = 3 * time.Second
+
+type cachedBucketEntry struct {
+	entry     *filer_pb.Entry
+	expiresAt time.Time
+}
+
+// bucketEntryCache keeps the bucket entries read on every object request, e.g., for the default encryption and the acl.
+// The entries changed through this gateway are invalidated right away, and the missing buckets are not cached,
+// so a bucket created through another gateway can be used right away.
+type bucketEntryCache struct {
+	sync.RWMutex
+	entries map[string]*cachedBucketEntry
+}
+
+func (c *bucketEntryCache) get(bucket string, now time.Time) *filer_pb.Entry {
+	c.RLock()
+	defer c.RUnlock()
+	if cached, found := c.entries[bucket]; found && now.Before(cached.expiresAt) {
+		return cached.entry
+	}
+	return nil
+}
+
+func (c *bucketEntryCache) set(bucket string, entry *filer_pb.Entry, now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*cachedBucketEntry)
+	}
+	c.entries[bucket] = &cachedBucketEntry{entry: entry, expiresAt: now.Add(bucketEntryCacheTtl)}
+}
+
+func (c *bucketEntryCache) invalidate(bucket string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.entries, bucket)
+}
+
+// getCachedBucketEntry reads the bucket entry for the object requests, which must not change the returned entry.
+// The bucket configuration requests read the bucket entry from the filer by getBucketEntry.
+func (s3a *S3ApiServer) getCachedBucketEntry(bucket string) (*filer_pb.Entry, error) {
+	now := time.Now()
+	if entry := s3a.bucketEntries.get(bucket, now); entry != nil {
+		return entry, nil
+	}
+	entry, err := s3a.getEntry(s3a.option.BucketsPath, bucket)
+	if err != nil || entry == nil {
+		return entry, err
+	}
+	s3a.bucketEntries.set(bucket, entry, now)
+	return entry, nil
+}
+
+// invalidateBucketEntry is called when the entry is changed through this gateway, in case it is a bucket
+func (s3a *S3ApiServer) invalidateBucketEntry(parentDirectoryPath, entryName string) {
+	if parentDirectoryPath == s3a.option.BucketsPath {
+		s3a.bucketEntries.invalidate(entryName)
+	}
+}
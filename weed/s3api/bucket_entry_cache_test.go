@@ -0,0 +1,37 @@
+package s3api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestBucketEntryCache(t *testing.T) {
+	s3a := &S3ApiServer{option: &S3ApiServerOption{BucketsPath: "/buckets"}}
+	now := time.Now()
+
+	if entry := s3a.bucketEntries.get("b1", now); entry != nil {
+		t.Fatalf("empty cache returns %v", entry)
+	}
+	s3a.bucketEntries.set("b1", &filer_pb.Entry{Name: "b1"}, now)
+	if entry := s3a.bucketEntries.get("b1", now.Add(time.Second)); entry == nil || entry.Name != "b1" {
+		t.Errorf("cached entry %v", entry)
+	}
+
+	// the change through another gateway is seen after the ttl
+	if entry := s3a.bucketEntries.get("b1", now.Add(bucketEntryCacheTtl)); entry != nil {
+		t.Errorf("expired entry %v", entry)
+	}
+
+	// the change through this gateway is seen right away
+	s3a.bucketEntries.set("b1", &filer_pb.Entry{Name: "b1"}, now)
+	s3a.invalidateBucketEntry("/buckets/b1", "object")
+	if entry := s3a.bucketEntries.get("b1", now); entry == nil {
+		t.Errorf("entry invalidated by the object change")
+	}
+	s3a.invalidateBucketEntry("/buckets", "b1")
+	if entry := s3a.bucketEntries.get("b1", now); entry != nil {
+		t.Errorf("entry %v not invalidated", entry)
+	}
+}
@@ -145,6 +145,9 @@ var errLineTooLong = errors.New("header line too long")
 // Malformed encoding is generated when chunk header is wrongly formed.
 var errMalformedEncoding = errors.New("malformed chunked encoding")
 
+// errChunkSignatureMismatch is generated when the chunk signature does not match the chunk data.
+var errChunkSignatureMismatch = errors.New("chunk signature does not match")
+
 // newSignV4ChunkedReader returns a new s3ChunkedReader that translates the data read from r
 // out of HTTP "chunked" format before returning it.
 // The s3ChunkedReader returns io.EOF when the final 0-length chunk is read.
@@ -164,10 +167,20 @@ func (iam *IdentityAccessManagement) newSignV4ChunkedReader(req *http.Request) (
 	}, s3err.ErrNone
 }
 
+// newUnverifiedChunkedReader returns a new s3ChunkedReader that decodes the "aws-chunked" format
+// without verifying the chunk signatures, when the authentication is not set up.
+func newUnverifiedChunkedReader(req *http.Request) io.ReadCloser {
+	return &s3ChunkedReader{
+		reader:            bufio.NewReader(req.Body),
+		chunkSHA256Writer: sha256.New(),
+		state:             readChunkHeader,
+	}
+}
+
 // Represents the overall state that is required for decoding a
 // AWS Signature V4 chunked reader.
 type s3ChunkedReader struct {
-	cred              *Credential
+	cred              *Credential // nil to skip the chunk signature verification
 	reader            *bufio.Reader
 	seedSignature     string
 	seedDate          time.Time
@@ -291,18 +304,20 @@ func (cr *s3ChunkedReader) Read(buf []byte) (n int, err error) {
 				continue
 			}
 		case verifyChunk:
-			// Calculate the hashed chunk.
-			hashedChunk := hex.EncodeToString(cr.chunkSHA256Writer.Sum(nil))
-			// Calculate the chunk signature.
-			newSignature := getChunkSignature(cr.cred.SecretKey, cr.seedSignature, cr.region, cr.seedDate, hashedChunk)
-			if !compareSignatureV4(cr.chunkSignature, newSignature) {
-				// Chunk signature doesn't match we return signature does not match.
-				cr.err = errors.New("chunk signature does not match")
-				return 0, cr.err
+			if cr.cred != nil {
+				// Calculate the hashed chunk.
+				hashedChunk := hex.EncodeToString(cr.chunkSHA256Writer.Sum(nil))
+				// Calculate the chunk signature.
+				newSignature := getChunkSignature(cr.cred.SecretKey, cr.seedSignature, cr.region, cr.seedDate, hashedChunk)
+				if !compareSignatureV4(cr.chunkSignature, newSignature) {
+					// Chunk signature doesn't match we return signature does not match.
+					cr.err = errChunkSignatureMismatch
+					return 0, cr.err
+				}
+				// Newly calculated signature becomes the seed for the next chunk
+				// this follows the chaining.
+				cr.seedSignature = newSignature
 			}
-			// Newly calculated signature becomes the seed for the next chunk
-			// this follows the chaining.
-			cr.seedSignature = newSignature
 			cr.chunkSHA256Writer.Reset()
 			if cr.lastChunk {
 				cr.state = eofChunk
@@ -0,0 +1,129 @@
+package s3api
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	xhttp "github.com/chrislusf/seaweedfs/weed/s3api/http"
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+)
+
+const (
+	// the bucket default encryption configuration is saved in the bucket entry extended attributes
+	s3EncryptionExtendedKey = "s3-encryption"
+
+	// the objects are encrypted by the volume data cipher, with a key per chunk kept in the filer
+	SSEAlgorithmAES256 = "AES256"
+	SSEAlgorithmKMS    = "aws:kms"
+)
+
+// ServerSideEncryptionConfiguration is the bucket default encryption,
+// applied to the objects written without the x-amz-server-side-encryption header
+type ServerSideEncryptionConfiguration struct {
+	XMLName xml.Name                   `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ServerSideEncryptionConfiguration"`
+	Rules   []ServerSideEncryptionRule `xml:"Rule"`
+}
+
+type ServerSideEncryptionRule struct {
+	ApplyServerSideEncryptionByDefault *ServerSideEncryptionByDefault `xml:"ApplyServerSideEncryptionByDefault,omitempty"`
+	BucketKeyEnabled                   bool                           `xml:"BucketKeyEnabled,omitempty"`
+}
+
+type ServerSideEncryptionByDefault struct {
+	SSEAlgorithm   string `xml:"SSEAlgorithm"`
+	KMSMasterKeyID string `xml:"KMSMasterKeyID,omitempty"`
+}
+
+// Validate checks the configuration has one rule with a supported algorithm
+func (c *ServerSideEncryptionConfiguration) Validate() s3err.ErrorCode {
+	if len(c.Rules) != 1 || c.Rules[0].ApplyServerSideEncryptionByDefault == nil {
+		return s3err.ErrMalformedXML
+	}
+	return validateSSEAlgorithm(c.Rules[0].ApplyServerSideEncryptionByDefault.SSEAlgorithm)
+}
+
+// SSEAlgorithm is the default encryption of the bucket
+func (c *ServerSideEncryptionConfiguration) SSEAlgorithm() string {
+	if c == nil || len(c.Rules) == 0 || c.Rules[0].ApplyServerSideEncryptionByDefault == nil {
+		return ""
+	}
+	return c.Rules[0].ApplyServerSideEncryptionByDefault.SSEAlgorithm
+}
+
+// validateSSEAlgorithm only accepts AES256, the keys managed by a KMS are not supported
+func validateSSEAlgorithm(algorithm string) s3err.ErrorCode {
+	switch algorithm {
+	case SSEAlgorithmAES256:
+		return s3err.ErrNone
+	case SSEAlgorithmKMS:
+		return s3err.ErrNotImplemented
+	}
+	return s3err.ErrInvalidEncryptionAlgorithm
+}
+
+// loadEncryption reads the default encryption of the bucket entry, or nil if not configured
+func loadEncryption(bucketEntry *filer_pb.Entry) (*ServerSideEncryptionConfiguration, error) {
+	data, found := bucketEntry.Extended[s3EncryptionExtendedKey]
+	if !found {
+		return nil, nil
+	}
+	encryption := &ServerSideEncryptionConfiguration{}
+	if err := xml.Unmarshal(data, encryption); err != nil {
+		return nil, err
+	}
+	return encryption, nil
+}
+
+// setServerSideEncryption checks the x-amz-server-side-encryption header of the object write,
+// or else sets it from the bucket default encryption, so the filer encrypts the object data.
+func (s3a *S3ApiServer) setServerSideEncryption(w http.ResponseWriter, r *http.Request, bucket string) s3err.ErrorCode {
+	if r.Header.Get(xhttp.AmzServerSideEncryptionCustomerAlgorithm) != "" {
+		return s3err.ErrNotImplemented
+	}
+
+	algorithm := r.Header.Get(xhttp.AmzServerSideEncryption)
+	if algorithm == "" {
+		bucketEntry, err := s3a.getCachedBucketEntry(bucket)
+		if err != nil || bucketEntry == nil {
+			// the missing bucket is reported by the write itself
+			return s3err.ErrNone
+		}
+		encryption, err := loadEncryption(bucketEntry)
+		if err != nil {
+			glog.Errorf("load bucket %s encryption: %v", bucket, err)
+			return s3err.ErrInternalError
+		}
+		algorithm = encryption.SSEAlgorithm()
+		if algorithm == "" {
+			return s3err.ErrNone
+		}
+	}
+
+	return applySSEAlgorithm(w, r, algorithm)
+}
+
+// setUploadServerSideEncryption encrypts the parts as the multipart upload,
+// whose encryption is decided when the upload is created
+func (s3a *S3ApiServer) setUploadServerSideEncryption(w http.ResponseWriter, r *http.Request, bucket, uploadID string) s3err.ErrorCode {
+	uploadEntry, err := s3a.getEntry(s3a.genUploadsFolder(bucket), uploadID)
+	if err != nil || uploadEntry == nil {
+		return s3err.ErrNoSuchUpload
+	}
+	algorithm := string(uploadEntry.Extended[xhttp.AmzServerSideEncryption])
+	if algorithm == "" {
+		r.Header.Del(xhttp.AmzServerSideEncryption)
+		return s3err.ErrNone
+	}
+	return applySSEAlgorithm(w, r, algorithm)
+}
+
+func applySSEAlgorithm(w http.ResponseWriter, r *http.Request, algorithm string) s3err.ErrorCode {
+	if errCode := validateSSEAlgorithm(algorithm); errCode != s3err.ErrNone {
+		return errCode
+	}
+	r.Header.Set(xhttp.AmzServerSideEncryption, algorithm)
+	w.Header().Set(xhttp.AmzServerSideEncryption, algorithm)
+	return s3err.ErrNone
+}
@@ -0,0 +1,37 @@
+package s3api
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+)
+
+func TestServerSideEncryptionConfiguration(t *testing.T) {
+
+	input := `<ServerSideEncryptionConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Rule>
+    <ApplyServerSideEncryptionByDefault>
+      <SSEAlgorithm>AES256</SSEAlgorithm>
+    </ApplyServerSideEncryptionByDefault>
+  </Rule>
+</ServerSideEncryptionConfiguration>`
+
+	encryption := &ServerSideEncryptionConfiguration{}
+	assert.NoError(t, xml.Unmarshal([]byte(input), encryption))
+	assert.Equal(t, s3err.ErrNone, encryption.Validate())
+	assert.Equal(t, SSEAlgorithmAES256, encryption.SSEAlgorithm())
+
+	encryption.Rules[0].ApplyServerSideEncryptionByDefault.SSEAlgorithm = SSEAlgorithmKMS
+	assert.Equal(t, s3err.ErrNotImplemented, encryption.Validate())
+
+	encryption.Rules[0].ApplyServerSideEncryptionByDefault.SSEAlgorithm = "DES"
+	assert.Equal(t, s3err.ErrInvalidEncryptionAlgorithm, encryption.Validate())
+
+	assert.Equal(t, s3err.ErrMalformedXML, (&ServerSideEncryptionConfiguration{}).Validate())
+
+	var notConfigured *ServerSideEncryptionConfiguration
+	assert.Equal(t, "", notConfigured.SSEAlgorithm())
+}
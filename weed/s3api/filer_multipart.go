@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -18,6 +19,18 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 )
 
+// the upload id is kept in the completed object, to answer the retried completion of the same upload
+const s3UploadIdExtendedKey = "s3-upload-id"
+
+// the upload folder is marked with the ETag of the completed object, together with the object creation,
+// in case the upload folder is not removed after the completion
+const s3UploadCompletedExtendedKey = "s3-upload-completed"
+
+func isCompletedUpload(uploadEntry *filer_pb.Entry) bool {
+	_, found := uploadEntry.Extended[s3UploadCompletedExtendedKey]
+	return found
+}
+
 type InitiateMultipartUploadResult struct {
 	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
 	s3.CreateMultipartUploadOutput
@@ -59,44 +72,136 @@ type CompleteMultipartUploadResult struct {
 	s3.CompleteMultipartUploadOutput
 }
 
+// CompleteMultipartUpload is the request body listing the parts to assemble
+type CompleteMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []CompletedPart `xml:"Part"`
+}
+
+type CompletedPart struct {
+	PartNumber int64  `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// completeMultipartUpload only uses the upload state kept in the filer, so the parts can be uploaded
+// through any of the s3 gateways sharing the filer, and the completion retried on another gateway.
 func (s3a *S3ApiServer) completeMultipartUpload(input *s3.CompleteMultipartUploadInput) (output *CompleteMultipartUploadResult, code s3err.ErrorCode) {
 
 	glog.V(2).Infof("completeMultipartUpload input %v", input)
 
-	uploadDirectory := s3a.genUploadsFolder(*input.Bucket) + "/" + *input.UploadId
+	entryName, dirName := s3a.getEntryNameAndDir(input)
 
-	entries, _, err := s3a.list(uploadDirectory, "", "", false, 0)
-	if err != nil || len(entries) == 0 {
-		glog.Errorf("completeMultipartUpload %s %s error: %v, entries:%d", *input.Bucket, *input.UploadId, err, len(entries))
+	pentry, err := s3a.getEntry(s3a.genUploadsFolder(*input.Bucket), *input.UploadId)
+	if err != nil || pentry == nil {
+		// the upload may be already completed, e.g., by the previous request through another gateway
+		if entry, _ := s3a.getEntry(dirName, entryName); entry != nil && string(entry.Extended[s3UploadIdExtendedKey]) == *input.UploadId {
+			glog.V(1).Infof("completeMultipartUpload %s %s is already completed", *input.Bucket, *input.UploadId)
+			return newCompleteMultipartUploadResult(s3a.option.Filer, input, dirName, entryName, filer.ETag(entry)), s3err.ErrNone
+		}
+		glog.Errorf("completeMultipartUpload %s %s error: %v", *input.Bucket, *input.UploadId, err)
 		return nil, s3err.ErrNoSuchUpload
 	}
+	if isCompletedUpload(pentry) {
+		glog.V(1).Infof("completeMultipartUpload %s %s is already completed", *input.Bucket, *input.UploadId)
+		s3a.removeCompletedUpload(*input.Bucket, *input.UploadId)
+		return newCompleteMultipartUploadResult(s3a.option.Filer, input, dirName, entryName, string(pentry.Extended[s3UploadCompletedExtendedKey])), s3err.ErrNone
+	}
 
-	pentry, err := s3a.getEntry(s3a.genUploadsFolder(*input.Bucket), *input.UploadId)
+	entries, err := s3a.listAllEntries(s3a.genUploadsFolder(*input.Bucket) + "/" + *input.UploadId)
 	if err != nil {
 		glog.Errorf("completeMultipartUpload %s %s error: %v", *input.Bucket, *input.UploadId, err)
 		return nil, s3err.ErrNoSuchUpload
 	}
 
+	var completed []*s3.CompletedPart
+	if input.MultipartUpload != nil {
+		completed = input.MultipartUpload.Parts
+	}
+	partEntries, code := selectCompletedParts(entries, completed)
+	if code != s3err.ErrNone {
+		glog.V(1).Infof("completeMultipartUpload %s %s: %v", *input.Bucket, *input.UploadId, s3err.GetAPIError(code).Code)
+		return nil, code
+	}
+
 	var finalParts []*filer_pb.FileChunk
 	var offset int64
 
-	for _, entry := range entries {
-		if strings.HasSuffix(entry.Name, ".part") && !entry.IsDirectory {
-			for _, chunk := range entry.Chunks {
-				p := &filer_pb.FileChunk{
-					FileId:    chunk.GetFileIdString(),
-					Offset:    offset,
-					Size:      chunk.Size,
-					Mtime:     chunk.Mtime,
-					CipherKey: chunk.CipherKey,
-					ETag:      chunk.ETag,
-				}
-				finalParts = append(finalParts, p)
-				offset += int64(chunk.Size)
+	for _, entry := range partEntries {
+		for _, chunk := range entry.Chunks {
+			p := &filer_pb.FileChunk{
+				FileId:    chunk.GetFileIdString(),
+				Offset:    offset + chunk.Offset,
+				Size:      chunk.Size,
+				Mtime:     chunk.Mtime,
+				CipherKey: chunk.CipherKey,
+				ETag:      chunk.ETag,
 			}
+			finalParts = append(finalParts, p)
+		}
+		// the part size includes the holes of all-zero data, not stored as chunks
+		offset += int64(filer.FileSize(entry))
+	}
+
+	finalEntry := filer_pb.NewFileEntry(entryName, finalParts, func(entry *filer_pb.Entry) {
+		entry.Attributes.FileSize = uint64(offset)
+		if entry.Extended == nil {
+			entry.Extended = make(map[string][]byte)
 		}
+		for k, v := range pentry.Extended {
+			if k != "key" {
+				entry.Extended[k] = v
+			}
+		}
+		entry.Extended[s3UploadIdExtendedKey] = []byte(*input.UploadId)
+	})
+	etag := filer.ETagChunks(finalParts)
+	if pentry.Extended == nil {
+		pentry.Extended = make(map[string][]byte)
+	}
+	pentry.Extended[s3UploadCompletedExtendedKey] = []byte(etag)
+
+	// the object is created and the upload is marked completed together, so that the upload can not be
+	// aborted, or its parts deleted, after the object referencing the chunks of the parts is created.
+	// The parts not listed in the request are deleted with their data, since the upload folder is removed without the data.
+	mutations := []*filer_pb.ApplyMutationsRequest_Mutation{
+		{CreateEntry: &filer_pb.CreateEntryRequest{Directory: dirName, Entry: finalEntry}},
+		{UpdateEntry: &filer_pb.UpdateEntryRequest{Directory: s3a.genUploadsFolder(*input.Bucket), Entry: pentry}},
 	}
+	for _, entry := range unselectedParts(entries, partEntries) {
+		mutations = append(mutations, &filer_pb.ApplyMutationsRequest_Mutation{
+			DeleteEntry: &filer_pb.DeleteEntryRequest{
+				Directory:    s3a.genUploadsFolder(*input.Bucket) + "/" + *input.UploadId,
+				Name:         entry.Name,
+				IsDeleteData: true,
+			},
+		})
+	}
+	err = s3a.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		return filer_pb.ApplyMutations(client, &filer_pb.ApplyMutationsRequest{
+			Mutations: mutations,
+		})
+	})
+	if err != nil {
+		glog.Errorf("completeMultipartUpload %s/%s error: %v", dirName, entryName, err)
+		return nil, s3err.ErrInternalError
+	}
+
+	output = newCompleteMultipartUploadResult(s3a.option.Filer, input, dirName, entryName, etag)
+
+	s3a.removeCompletedUpload(*input.Bucket, *input.UploadId)
 
+	return
+}
+
+// removeCompletedUpload removes the upload folder, without the data of the parts used by the completed object.
+// The parts not used are already deleted with their data when the upload is completed.
+func (s3a *S3ApiServer) removeCompletedUpload(bucket, uploadId string) {
+	if err := s3a.rm(s3a.genUploadsFolder(bucket), uploadId, false, true); err != nil {
+		glog.V(1).Infof("completeMultipartUpload cleanup %s upload %s: %v", bucket, uploadId, err)
+	}
+}
+
+func (s3a *S3ApiServer) getEntryNameAndDir(input *s3.CompleteMultipartUploadInput) (string, string) {
 	entryName := filepath.Base(*input.Key)
 	dirName := filepath.Dir(*input.Key)
 	if dirName == "." {
@@ -111,36 +216,65 @@ func (s3a *S3ApiServer) completeMultipartUpload(input *s3.CompleteMultipartUploa
 	if strings.HasSuffix(dirName, "/") {
 		dirName = dirName[:len(dirName)-1]
 	}
+	return entryName, dirName
+}
 
-	err = s3a.mkFile(dirName, entryName, finalParts, func(entry *filer_pb.Entry) {
-		if entry.Extended == nil {
-			entry.Extended = make(map[string][]byte)
-		}
-		for k, v := range pentry.Extended {
-			if k != "key" {
-				entry.Extended[k] = v
-			}
-		}
-	})
-
-	if err != nil {
-		glog.Errorf("completeMultipartUpload %s/%s error: %v", dirName, entryName, err)
-		return nil, s3err.ErrInternalError
-	}
-
-	output = &CompleteMultipartUploadResult{
+func newCompleteMultipartUploadResult(filerAddress string, input *s3.CompleteMultipartUploadInput, dirName, entryName, etag string) *CompleteMultipartUploadResult {
+	return &CompleteMultipartUploadResult{
 		CompleteMultipartUploadOutput: s3.CompleteMultipartUploadOutput{
-			Location: aws.String(fmt.Sprintf("http://%s%s/%s", s3a.option.Filer, dirName, entryName)),
+			Location: aws.String(fmt.Sprintf("http://%s%s/%s", filerAddress, dirName, entryName)),
 			Bucket:   input.Bucket,
-			ETag:     aws.String("\"" + filer.ETagChunks(finalParts) + "\""),
+			ETag:     aws.String("\"" + etag + "\""),
 			Key:      objectKey(input.Key),
 		},
 	}
+}
 
-	if err = s3a.rm(s3a.genUploadsFolder(*input.Bucket), *input.UploadId, false, true); err != nil {
-		glog.V(1).Infof("completeMultipartUpload cleanup %s upload %s: %v", *input.Bucket, *input.UploadId, err)
+// selectCompletedParts picks the uploaded parts listed in the request, which must be in ascending order
+// and match the ETags of the uploaded parts. The part entries are matched by the part numbers,
+// since the part file names are not sorted by the part number beyond 4 digits.
+func selectCompletedParts(entries []*filer_pb.Entry, completed []*s3.CompletedPart) (partEntries []*filer_pb.Entry, code s3err.ErrorCode) {
+	if len(completed) == 0 {
+		return nil, s3err.ErrMalformedXML
+	}
+	uploaded := make(map[int64]*filer_pb.Entry)
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name, ".part") || entry.IsDirectory {
+			continue
+		}
+		partNumber, err := strconv.ParseInt(strings.TrimSuffix(entry.Name, ".part"), 10, 64)
+		if err != nil {
+			continue
+		}
+		uploaded[partNumber] = entry
 	}
 
+	var lastPartNumber int64
+	for _, part := range completed {
+		if part.PartNumber == nil || *part.PartNumber <= lastPartNumber {
+			return nil, s3err.ErrInvalidPartOrder
+		}
+		lastPartNumber = *part.PartNumber
+		entry, found := uploaded[*part.PartNumber]
+		if !found || part.ETag == nil || strings.Trim(*part.ETag, "\"") != filer.ETag(entry) {
+			return nil, s3err.ErrInvalidPart
+		}
+		partEntries = append(partEntries, entry)
+	}
+	return partEntries, s3err.ErrNone
+}
+
+// unselectedParts returns the uploaded parts not used by the completed object
+func unselectedParts(entries []*filer_pb.Entry, partEntries []*filer_pb.Entry) (unselected []*filer_pb.Entry) {
+	selected := make(map[string]bool)
+	for _, entry := range partEntries {
+		selected[entry.Name] = true
+	}
+	for _, entry := range entries {
+		if !entry.IsDirectory && !selected[entry.Name] {
+			unselected = append(unselected, entry)
+		}
+	}
 	return
 }
 
@@ -148,12 +282,16 @@ func (s3a *S3ApiServer) abortMultipartUpload(input *s3.AbortMultipartUploadInput
 
 	glog.V(2).Infof("abortMultipartUpload input %v", input)
 
-	exists, err := s3a.exists(s3a.genUploadsFolder(*input.Bucket), *input.UploadId, true)
+	uploadEntry, err := s3a.getEntry(s3a.genUploadsFolder(*input.Bucket), *input.UploadId)
 	if err != nil {
 		glog.V(1).Infof("bucket %s abort upload %s: %v", *input.Bucket, *input.UploadId, err)
 		return nil, s3err.ErrNoSuchUpload
 	}
-	if exists {
+	if uploadEntry != nil && isCompletedUpload(uploadEntry) {
+		s3a.removeCompletedUpload(*input.Bucket, *input.UploadId)
+		return nil, s3err.ErrNoSuchUpload
+	}
+	if uploadEntry != nil {
 		err = s3a.rm(s3a.genUploadsFolder(*input.Bucket), *input.UploadId, true, true)
 	}
 	if err != nil {
@@ -179,6 +317,7 @@ type ListMultipartUploadsResult struct {
 	Prefix             *string               `type:"string"`
 	UploadIdMarker     *string               `type:"string"`
 	Upload             []*s3.MultipartUpload `locationName:"Upload" type:"list" flattened:"true"`
+	CommonPrefixes     []PrefixEntry         `xml:"CommonPrefixes,omitempty"`
 }
 
 func (s3a *S3ApiServer) listMultipartUploads(input *s3.ListMultipartUploadsInput) (output *ListMultipartUploadsResult, code s3err.ErrorCode) {
@@ -187,43 +326,116 @@ func (s3a *S3ApiServer) listMultipartUploads(input *s3.ListMultipartUploadsInput
 	glog.V(2).Infof("listMultipartUploads input %v", input)
 
 	output = &ListMultipartUploadsResult{
-		Bucket:       input.Bucket,
-		Delimiter:    input.Delimiter,
-		EncodingType: input.EncodingType,
-		KeyMarker:    input.KeyMarker,
-		MaxUploads:   input.MaxUploads,
-		Prefix:       input.Prefix,
+		Bucket:         input.Bucket,
+		Delimiter:      input.Delimiter,
+		EncodingType:   input.EncodingType,
+		KeyMarker:      input.KeyMarker,
+		MaxUploads:     input.MaxUploads,
+		Prefix:         input.Prefix,
+		UploadIdMarker: input.UploadIdMarker,
+		IsTruncated:    aws.Bool(false),
 	}
 
-	entries, isLast, err := s3a.list(s3a.genUploadsFolder(*input.Bucket), "", *input.UploadIdMarker, false, uint32(*input.MaxUploads))
+	entries, err := s3a.listAllEntries(s3a.genUploadsFolder(*input.Bucket))
 	if err != nil {
 		glog.Errorf("listMultipartUploads %s error: %v", *input.Bucket, err)
-		return
+		return nil, s3err.ErrInternalError
 	}
-	output.IsTruncated = aws.Bool(!isLast)
 
+	// the uploads are sorted by the object key, and then by the upload id
+	var uploads []*filer_pb.Entry
 	for _, entry := range entries {
-		if entry.Extended != nil {
-			key := string(entry.Extended["key"])
-			if *input.KeyMarker != "" && *input.KeyMarker != key {
-				continue
+		if entry.IsDirectory && entry.Extended != nil && !isCompletedUpload(entry) {
+			uploads = append(uploads, entry)
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		ki, kj := string(uploads[i].Extended["key"]), string(uploads[j].Extended["key"])
+		if ki != kj {
+			return ki < kj
+		}
+		return uploads[i].Name < uploads[j].Name
+	})
+
+	prefix, delimiter := *input.Prefix, *input.Delimiter
+	keyMarker, uploadIdMarker := *input.KeyMarker, *input.UploadIdMarker
+	maxUploads := int(*input.MaxUploads)
+	var count int
+	var lastKey, lastUploadId string
+	for _, entry := range uploads {
+		key := string(entry.Extended["key"])
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		// the keys with the delimiter after the prefix are rolled up into one common prefix
+		var commonPrefix string
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				commonPrefix = key[:len(prefix)+i+len(delimiter)]
 			}
-			if *input.Prefix != "" && !strings.HasPrefix(key, *input.Prefix) {
+		}
+		if commonPrefix != "" && (commonPrefix == lastKey || commonPrefix == keyMarker) {
+			continue
+		}
+
+		// the upload id marker is only used together with the key marker
+		if keyMarker != "" {
+			if key < keyMarker || key == keyMarker && (uploadIdMarker == "" || entry.Name <= uploadIdMarker) {
 				continue
 			}
-			output.Upload = append(output.Upload, &s3.MultipartUpload{
-				Key:      objectKey(aws.String(key)),
-				UploadId: aws.String(entry.Name),
-			})
-			if !isLast {
-				output.NextUploadIdMarker = aws.String(entry.Name)
-			}
 		}
+
+		if count >= maxUploads {
+			output.IsTruncated = aws.Bool(true)
+			break
+		}
+		count++
+
+		if commonPrefix != "" {
+			output.CommonPrefixes = append(output.CommonPrefixes, PrefixEntry{Prefix: commonPrefix})
+			lastKey, lastUploadId = commonPrefix, ""
+			continue
+		}
+		upload := &s3.MultipartUpload{
+			Key:          objectKey(aws.String(key)),
+			UploadId:     aws.String(entry.Name),
+			StorageClass: aws.String("STANDARD"),
+		}
+		if entry.Attributes != nil {
+			upload.Initiated = aws.Time(time.Unix(entry.Attributes.Crtime, 0).UTC())
+		}
+		output.Upload = append(output.Upload, upload)
+		lastKey, lastUploadId = key, entry.Name
+	}
+
+	if *output.IsTruncated {
+		output.NextKeyMarker = aws.String(lastKey)
+		output.NextUploadIdMarker = aws.String(lastUploadId)
+	}
+
+	if *input.EncodingType == "url" {
+		output.encodeUrl()
 	}
 
 	return
 }
 
+// encodeUrl encodes the object keys in the response, as requested by encoding-type=url
+func (output *ListMultipartUploadsResult) encodeUrl() {
+	for _, field := range []**string{&output.Delimiter, &output.KeyMarker, &output.NextKeyMarker, &output.Prefix} {
+		if *field != nil {
+			*field = aws.String(s3EncodeName(**field))
+		}
+	}
+	for _, upload := range output.Upload {
+		upload.Key = aws.String(s3EncodeName(*upload.Key))
+	}
+	for i := range output.CommonPrefixes {
+		output.CommonPrefixes[i].Prefix = s3EncodeName(output.CommonPrefixes[i].Prefix)
+	}
+}
+
 type ListPartsResult struct {
 	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListPartsResult"`
 
@@ -251,16 +463,26 @@ func (s3a *S3ApiServer) listObjectParts(input *s3.ListPartsInput) (output *ListP
 		MaxParts:         input.MaxParts,         // the maximum number of parts to return.
 		PartNumberMarker: input.PartNumberMarker, // the part number starts after this, exclusive
 		StorageClass:     aws.String("STANDARD"),
+		IsTruncated:      aws.Bool(false),
 	}
 
-	entries, isLast, err := s3a.list(s3a.genUploadsFolder(*input.Bucket)+"/"+*input.UploadId, "", fmt.Sprintf("%04d.part", *input.PartNumberMarker), false, uint32(*input.MaxParts))
+	uploadEntry, err := s3a.getEntry(s3a.genUploadsFolder(*input.Bucket), *input.UploadId)
+	if err != nil || uploadEntry == nil || !uploadEntry.IsDirectory {
+		glog.V(1).Infof("listObjectParts %s %s error: %v", *input.Bucket, *input.UploadId, err)
+		return nil, s3err.ErrNoSuchUpload
+	}
+	if key, found := uploadEntry.Extended["key"]; found && string(key) != *output.Key {
+		glog.V(1).Infof("listObjectParts %s %s is for %s, not %s", *input.Bucket, *input.UploadId, key, *output.Key)
+		return nil, s3err.ErrNoSuchUpload
+	}
+
+	entries, err := s3a.listAllEntries(s3a.genUploadsFolder(*input.Bucket) + "/" + *input.UploadId)
 	if err != nil {
 		glog.Errorf("listObjectParts %s %s error: %v", *input.Bucket, *input.UploadId, err)
 		return nil, s3err.ErrNoSuchUpload
 	}
 
-	output.IsTruncated = aws.Bool(!isLast)
-
+	// the part file names are not sorted by the part number beyond 4 digits
 	for _, entry := range entries {
 		if strings.HasSuffix(entry.Name, ".part") && !entry.IsDirectory {
 			partNumberString := entry.Name[:len(entry.Name)-len(".part")]
@@ -269,15 +491,28 @@ func (s3a *S3ApiServer) listObjectParts(input *s3.ListPartsInput) (output *ListP
 				glog.Errorf("listObjectParts %s %s parse %s: %v", *input.Bucket, *input.UploadId, entry.Name, err)
 				continue
 			}
+			if int64(partNumber) <= *input.PartNumberMarker {
+				continue
+			}
 			output.Part = append(output.Part, &s3.Part{
 				PartNumber:   aws.Int64(int64(partNumber)),
 				LastModified: aws.Time(time.Unix(entry.Attributes.Mtime, 0).UTC()),
 				Size:         aws.Int64(int64(filer.FileSize(entry))),
 				ETag:         aws.String("\"" + filer.ETag(entry) + "\""),
 			})
-			if !isLast {
-				output.NextPartNumberMarker = aws.Int64(int64(partNumber))
-			}
+		}
+	}
+	sort.Slice(output.Part, func(i, j int) bool {
+		return *output.Part[i].PartNumber < *output.Part[j].PartNumber
+	})
+
+	if int64(len(output.Part)) > *input.MaxParts {
+		output.Part = output.Part[:*input.MaxParts]
+		output.IsTruncated = aws.Bool(true)
+		if len(output.Part) > 0 {
+			output.NextPartNumberMarker = output.Part[len(output.Part)-1].PartNumber
+		} else {
+			output.NextPartNumberMarker = input.PartNumberMarker
 		}
 	}
 
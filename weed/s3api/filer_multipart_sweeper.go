@@ -0,0 +1,85 @@
+package s3api
+
+import (
+	"math"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+)
+
+const multipartSweepInterval = time.Hour
+
+// loopSweepIncompleteMultipartUploads periodically aborts the multipart uploads not completed in time,
+// as configured by the AbortIncompleteMultipartUpload rules of the bucket lifecycle, or the server default.
+func (s3a *S3ApiServer) loopSweepIncompleteMultipartUploads() {
+	for {
+		time.Sleep(multipartSweepInterval)
+		s3a.sweepIncompleteMultipartUploads(time.Now())
+	}
+}
+
+func (s3a *S3ApiServer) sweepIncompleteMultipartUploads(now time.Time) {
+
+	buckets, _, err := s3a.list(s3a.option.BucketsPath, "", "", false, math.MaxInt32)
+	if err != nil {
+		glog.V(0).Infof("sweep incomplete multipart uploads, list buckets: %v", err)
+		return
+	}
+
+	for _, bucketEntry := range buckets {
+		if !bucketEntry.IsDirectory {
+			continue
+		}
+		lifecycle, err := loadLifecycle(bucketEntry)
+		if err != nil {
+			glog.Errorf("sweep incomplete multipart uploads, bucket %s lifecycle: %v", bucketEntry.Name, err)
+			continue
+		}
+		if lifecycle == nil && s3a.option.AbortIncompleteMultipartUploadDays <= 0 {
+			continue
+		}
+		s3a.sweepBucketIncompleteMultipartUploads(bucketEntry.Name, lifecycle, now)
+	}
+}
+
+func (s3a *S3ApiServer) sweepBucketIncompleteMultipartUploads(bucket string, lifecycle *Lifecycle, now time.Time) {
+
+	uploadsFolder := s3a.genUploadsFolder(bucket)
+	entries, err := s3a.listAllEntries(uploadsFolder)
+	if err != nil {
+		glog.V(1).Infof("sweep incomplete multipart uploads, list %s: %v", uploadsFolder, err)
+		return
+	}
+
+	for _, entry := range entries {
+		if isCompletedUpload(entry) {
+			s3a.removeCompletedUpload(bucket, entry.Name)
+			continue
+		}
+		if !s3a.isIncompleteMultipartUploadExpired(entry, lifecycle, now) {
+			continue
+		}
+		glog.V(0).Infof("abort incomplete multipart upload %s of bucket %s", entry.Name, bucket)
+		if err := s3a.rm(uploadsFolder, entry.Name, true, true); err != nil {
+			glog.Errorf("abort incomplete multipart upload %s of bucket %s: %v", entry.Name, bucket, err)
+		}
+	}
+}
+
+func (s3a *S3ApiServer) isIncompleteMultipartUploadExpired(uploadEntry *filer_pb.Entry, lifecycle *Lifecycle, now time.Time) bool {
+	if !uploadEntry.IsDirectory || uploadEntry.Attributes == nil {
+		return false
+	}
+	days := s3a.option.AbortIncompleteMultipartUploadDays
+	if lifecycle != nil {
+		if d := lifecycle.AbortIncompleteMultipartUploadDays(string(uploadEntry.Extended["key"])); d > 0 {
+			days = d
+		}
+	}
+	if days <= 0 {
+		return false
+	}
+	initiated := time.Unix(uploadEntry.Attributes.Crtime, 0)
+	return now.Sub(initiated) > time.Duration(days)*24*time.Hour
+}
@@ -1,8 +1,10 @@
 package s3api
 
 import (
+	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
 	"testing"
 	"time"
@@ -48,3 +50,70 @@ func TestListPartsResult(t *testing.T) {
 	}
 
 }
+
+func TestListMultipartUploadsResult(t *testing.T) {
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<ListMultipartUploadsResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Bucket>example-bucket</Bucket><IsTruncated>true</IsTruncated><NextKeyMarker>photos/</NextKeyMarker><NextUploadIdMarker></NextUploadIdMarker><Upload><Initiated>1970-01-01T00:00:00Z</Initiated><Key>a+b.txt</Key><UploadId>some-upload-id</UploadId></Upload><CommonPrefixes><Prefix>photos/</Prefix></CommonPrefixes></ListMultipartUploadsResult>`
+	response := &ListMultipartUploadsResult{
+		Bucket:             aws.String("example-bucket"),
+		IsTruncated:        aws.Bool(true),
+		NextKeyMarker:      aws.String("photos/"),
+		NextUploadIdMarker: aws.String(""),
+		Upload: []*s3.MultipartUpload{
+			{
+				Key:       aws.String("a b.txt"),
+				UploadId:  aws.String("some-upload-id"),
+				Initiated: aws.Time(time.Unix(0, 0).UTC()),
+			},
+		},
+		CommonPrefixes: []PrefixEntry{{Prefix: "photos/"}},
+	}
+	response.encodeUrl()
+
+	encoded := string(s3err.EncodeXMLResponse(response))
+	if encoded != expected {
+		t.Errorf("unexpected output: %s\nexpecting:%s", encoded, expected)
+	}
+
+}
+
+func TestSelectCompletedParts(t *testing.T) {
+	newPart := func(name string, md5 byte) *filer_pb.Entry {
+		return &filer_pb.Entry{Name: name, Attributes: &filer_pb.FuseAttributes{Md5: []byte{md5}}}
+	}
+	entries := []*filer_pb.Entry{newPart("0001.part", 1), newPart("10000.part", 3), newPart("0002.part", 2), newPart("0003.part", 4)}
+	completed := func(parts ...int64) (completed []*s3.CompletedPart) {
+		for _, partNumber := range parts {
+			completed = append(completed, &s3.CompletedPart{PartNumber: aws.Int64(partNumber), ETag: aws.String(fmt.Sprintf("\"%02x\"", partNumber))})
+		}
+		return
+	}
+
+	// the etag of part 3 does not match
+	if _, code := selectCompletedParts(entries, completed(1, 2, 3)); code != s3err.ErrInvalidPart {
+		t.Errorf("expect invalid part for mismatched etag, got %v", code)
+	}
+
+	// part 3 is not listed, and part 10000 is assembled after part 2
+	c := completed(1, 2)
+	c = append(c, &s3.CompletedPart{PartNumber: aws.Int64(10000), ETag: aws.String("03")})
+	partEntries, code := selectCompletedParts(entries, c)
+	if code != s3err.ErrNone || len(partEntries) != 3 || partEntries[2].Name != "10000.part" {
+		t.Errorf("select parts: %v %+v", code, partEntries)
+	}
+
+	if _, code = selectCompletedParts(entries, completed(2, 1)); code != s3err.ErrInvalidPartOrder {
+		t.Errorf("expect invalid part order, got %v", code)
+	}
+	if _, code = selectCompletedParts(entries, completed(1, 5)); code != s3err.ErrInvalidPart {
+		t.Errorf("expect invalid part for missing part, got %v", code)
+	}
+	if _, code = selectCompletedParts(entries, nil); code != s3err.ErrMalformedXML {
+		t.Errorf("expect malformed xml for no parts, got %v", code)
+	}
+	// the part not listed is deleted with its data after the completion
+	if unselected := unselectedParts(entries, partEntries); len(unselected) != 1 || unselected[0].Name != "0003.part" {
+		t.Errorf("unselected parts: %+v", unselected)
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"net/url"
 	"strings"
 )
 
+const listAllEntriesBatchSize = 1024
+
 func (s3a *S3ApiServer) mkdir(parentDirectoryPath string, dirName string, fn func(entry *filer_pb.Entry)) error {
 
 	return filer_pb.Mkdir(s3a, parentDirectoryPath, dirName, fn)
@@ -39,8 +42,28 @@ func (s3a *S3ApiServer) list(parentDirectoryPath, prefix, startFrom string, incl
 
 }
 
+// listAllEntries lists all entries of the directory, page by page
+func (s3a *S3ApiServer) listAllEntries(parentDirectoryPath string) (entries []*filer_pb.Entry, err error) {
+
+	startFrom := ""
+	for {
+		page, isLast, err := s3a.list(parentDirectoryPath, "", startFrom, false, listAllEntriesBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page...)
+		if isLast || len(page) == 0 {
+			return entries, nil
+		}
+		startFrom = page[len(page)-1].Name
+	}
+
+}
+
 func (s3a *S3ApiServer) rm(parentDirectoryPath, entryName string, isDeleteData, isRecursive bool) error {
 
+	s3a.invalidateBucketEntry(parentDirectoryPath, entryName)
+
 	return s3a.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
 
 		err := doDeleteEntry(client, parentDirectoryPath, entryName, isDeleteData, isRecursive)
@@ -85,11 +108,29 @@ func (s3a *S3ApiServer) touch(parentDirectoryPath string, entryName string, entr
 
 }
 
+func (s3a *S3ApiServer) updateEntry(parentDirectoryPath string, entry *filer_pb.Entry) (err error) {
+
+	defer s3a.invalidateBucketEntry(parentDirectoryPath, entry.Name)
+
+	return s3a.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		return filer_pb.UpdateEntry(client, &filer_pb.UpdateEntryRequest{
+			Directory: parentDirectoryPath,
+			Entry:     entry,
+		})
+	})
+
+}
+
 func (s3a *S3ApiServer) getEntry(parentDirectoryPath, entryName string) (entry *filer_pb.Entry, err error) {
 	fullPath := util.NewFullPath(parentDirectoryPath, entryName)
 	return filer_pb.GetEntry(s3a, fullPath)
 }
 
+// s3EncodeName encodes the object key for encoding-type=url, keeping the "/" readable
+func s3EncodeName(name string) string {
+	return strings.ReplaceAll(url.QueryEscape(name), "%2F", "/")
+}
+
 func objectKey(key *string) *string {
 	if strings.HasPrefix(*key, "/") {
 		t := (*key)[1:]
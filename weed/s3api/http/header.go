@@ -27,6 +27,19 @@ const (
 	// S3 object tagging
 	AmzObjectTagging = "X-Amz-Tagging"
 	AmzTagCount      = "x-amz-tagging-count"
+
+	// S3 streaming payload, i.e., the "aws-chunked" content encoding
+	AmzDecodedContentLength = "X-Amz-Decoded-Content-Length"
+
+	// S3 bucket region, returned by HeadBucket
+	AmzBucketRegion = "X-Amz-Bucket-Region"
+
+	// S3 canned ACL
+	AmzAcl = "X-Amz-Acl"
+
+	// S3 server side encryption
+	AmzServerSideEncryption                  = "X-Amz-Server-Side-Encryption"
+	AmzServerSideEncryptionCustomerAlgorithm = "X-Amz-Server-Side-Encryption-Customer-Algorithm"
 )
 
 // Non-Standard S3 HTTP request constants
@@ -0,0 +1,108 @@
+package s3api
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+)
+
+const (
+	// the bucket lifecycle configuration is saved in the bucket entry extended attributes
+	s3LifecycleExtendedKey = "s3-lifecycle"
+
+	maxLifecycleRules = 1000
+
+	LifecycleStatusEnabled  = "Enabled"
+	LifecycleStatusDisabled = "Disabled"
+)
+
+// Lifecycle is the bucket lifecycle configuration.
+// Only the AbortIncompleteMultipartUpload action is supported.
+type Lifecycle struct {
+	XMLName xml.Name        `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LifecycleConfiguration"`
+	Rules   []LifecycleRule `xml:"Rule"`
+}
+
+type LifecycleRule struct {
+	ID                             string                          `xml:"ID,omitempty"`
+	Status                         string                          `xml:"Status"`
+	Prefix                         *string                         `xml:"Prefix,omitempty"` // deprecated, replaced by Filter
+	Filter                         *LifecycleFilter                `xml:"Filter,omitempty"`
+	AbortIncompleteMultipartUpload *AbortIncompleteMultipartUpload `xml:"AbortIncompleteMultipartUpload,omitempty"`
+
+	// not supported actions
+	Expiration                  *lifecycleElement `xml:"Expiration,omitempty"`
+	Transition                  *lifecycleElement `xml:"Transition,omitempty"`
+	NoncurrentVersionExpiration *lifecycleElement `xml:"NoncurrentVersionExpiration,omitempty"`
+	NoncurrentVersionTransition *lifecycleElement `xml:"NoncurrentVersionTransition,omitempty"`
+}
+
+type LifecycleFilter struct {
+	Prefix *string           `xml:"Prefix,omitempty"`
+	Tag    *lifecycleElement `xml:"Tag,omitempty"`
+	And    *lifecycleElement `xml:"And,omitempty"`
+}
+
+type AbortIncompleteMultipartUpload struct {
+	DaysAfterInitiation int `xml:"DaysAfterInitiation"`
+}
+
+type lifecycleElement struct {
+	Inner string `xml:",innerxml"`
+}
+
+// Validate checks the rules are supported
+func (lc *Lifecycle) Validate() s3err.ErrorCode {
+	if len(lc.Rules) == 0 || len(lc.Rules) > maxLifecycleRules {
+		return s3err.ErrMalformedXML
+	}
+	for _, rule := range lc.Rules {
+		if rule.Status != LifecycleStatusEnabled && rule.Status != LifecycleStatusDisabled {
+			return s3err.ErrMalformedXML
+		}
+		if len(rule.ID) > 255 {
+			return s3err.ErrInvalidRequest
+		}
+		if rule.Expiration != nil || rule.Transition != nil || rule.NoncurrentVersionExpiration != nil || rule.NoncurrentVersionTransition != nil {
+			return s3err.ErrNotImplemented
+		}
+		if rule.Filter != nil && (rule.Filter.Tag != nil || rule.Filter.And != nil) {
+			return s3err.ErrNotImplemented
+		}
+		if rule.Prefix != nil && rule.Filter != nil {
+			return s3err.ErrMalformedXML
+		}
+		if rule.AbortIncompleteMultipartUpload == nil || rule.AbortIncompleteMultipartUpload.DaysAfterInitiation <= 0 {
+			return s3err.ErrInvalidRequest
+		}
+	}
+	return s3err.ErrNone
+}
+
+func (rule *LifecycleRule) prefix() string {
+	if rule.Filter != nil && rule.Filter.Prefix != nil {
+		return *rule.Filter.Prefix
+	}
+	if rule.Prefix != nil {
+		return *rule.Prefix
+	}
+	return ""
+}
+
+// AbortIncompleteMultipartUploadDays returns the least days after initiation of the enabled rules for the object key,
+// or 0 if no rule applies
+func (lc *Lifecycle) AbortIncompleteMultipartUploadDays(key string) (days int) {
+	for _, rule := range lc.Rules {
+		if rule.Status != LifecycleStatusEnabled || rule.AbortIncompleteMultipartUpload == nil {
+			continue
+		}
+		if !strings.HasPrefix(key, rule.prefix()) {
+			continue
+		}
+		if d := rule.AbortIncompleteMultipartUpload.DaysAfterInitiation; d > 0 && (days == 0 || d < days) {
+			days = d
+		}
+	}
+	return
+}
@@ -0,0 +1,90 @@
+package s3api
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+)
+
+func TestLifecycleAbortIncompleteMultipartUpload(t *testing.T) {
+
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<LifecycleConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+   <Rule>
+      <ID>all</ID>
+      <Filter>
+         <Prefix></Prefix>
+      </Filter>
+      <Status>Enabled</Status>
+      <AbortIncompleteMultipartUpload>
+         <DaysAfterInitiation>7</DaysAfterInitiation>
+      </AbortIncompleteMultipartUpload>
+   </Rule>
+   <Rule>
+      <ID>logs</ID>
+      <Prefix>logs/</Prefix>
+      <Status>Enabled</Status>
+      <AbortIncompleteMultipartUpload>
+         <DaysAfterInitiation>1</DaysAfterInitiation>
+      </AbortIncompleteMultipartUpload>
+   </Rule>
+   <Rule>
+      <ID>videos</ID>
+      <Filter>
+         <Prefix>videos/</Prefix>
+      </Filter>
+      <Status>Disabled</Status>
+      <AbortIncompleteMultipartUpload>
+         <DaysAfterInitiation>2</DaysAfterInitiation>
+      </AbortIncompleteMultipartUpload>
+   </Rule>
+</LifecycleConfiguration>
+`
+
+	lifecycle := &Lifecycle{}
+	assert.Nil(t, xml.Unmarshal([]byte(input), lifecycle))
+	assert.Equal(t, s3err.ErrNone, lifecycle.Validate())
+
+	assert.Equal(t, 7, lifecycle.AbortIncompleteMultipartUploadDays("a/b.txt"))
+	assert.Equal(t, 1, lifecycle.AbortIncompleteMultipartUploadDays("logs/b.txt"))
+	assert.Equal(t, 7, lifecycle.AbortIncompleteMultipartUploadDays("videos/b.mp4"))
+
+	s3a := &S3ApiServer{option: &S3ApiServerOption{}}
+	now := time.Now()
+	upload := &filer_pb.Entry{
+		Name:        "some-upload-id",
+		IsDirectory: true,
+		Attributes:  &filer_pb.FuseAttributes{Crtime: now.Add(-50 * time.Hour).Unix()},
+		Extended:    map[string][]byte{"key": []byte("logs/b.txt")},
+	}
+	assert.True(t, s3a.isIncompleteMultipartUploadExpired(upload, lifecycle, now))
+	upload.Extended["key"] = []byte("a/b.txt")
+	assert.False(t, s3a.isIncompleteMultipartUploadExpired(upload, lifecycle, now))
+	assert.False(t, s3a.isIncompleteMultipartUploadExpired(upload, nil, now))
+	s3a.option.AbortIncompleteMultipartUploadDays = 2
+	assert.True(t, s3a.isIncompleteMultipartUploadExpired(upload, nil, now))
+
+}
+
+func TestLifecycleNotSupported(t *testing.T) {
+
+	input := `<LifecycleConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+   <Rule>
+      <Status>Enabled</Status>
+      <Expiration>
+         <Days>30</Days>
+      </Expiration>
+   </Rule>
+</LifecycleConfiguration>
+`
+
+	lifecycle := &Lifecycle{}
+	assert.Nil(t, xml.Unmarshal([]byte(input), lifecycle))
+	assert.Equal(t, s3err.ErrNotImplemented, lifecycle.Validate())
+
+}
@@ -0,0 +1,187 @@
+package s3_replication
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+)
+
+const (
+	// the bucket replication configuration is saved in the bucket entry extended attributes
+	ExtendedKey = "s3-replication"
+
+	StatusEnabled  = "Enabled"
+	StatusDisabled = "Disabled"
+
+	BucketArnPrefix = "arn:aws:s3:::"
+
+	maxRules = 1000
+)
+
+// ReplicationConfiguration is the bucket replication configuration.
+// The objects are replicated by "weed filer.sync -s3BucketReplication" to the buckets of another SeaweedFS cluster,
+// or by "weed filer.replicate" with "s3_bucket_replication" enabled to any replication sink, e.g., a S3 endpoint.
+type ReplicationConfiguration struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ReplicationConfiguration"`
+	Role    string   `xml:"Role,omitempty"`
+	Rules   []Rule   `xml:"Rule"`
+}
+
+type Rule struct {
+	ID                      string                   `xml:"ID,omitempty"`
+	Priority                int                      `xml:"Priority,omitempty"`
+	Status                  string                   `xml:"Status"`
+	Prefix                  *string                  `xml:"Prefix,omitempty"` // deprecated, replaced by Filter
+	Filter                  *Filter                  `xml:"Filter,omitempty"`
+	Destination             Destination              `xml:"Destination"`
+	DeleteMarkerReplication *DeleteMarkerReplication `xml:"DeleteMarkerReplication,omitempty"`
+
+	// not supported
+	SourceSelectionCriteria   *element `xml:"SourceSelectionCriteria,omitempty"`
+	ExistingObjectReplication *element `xml:"ExistingObjectReplication,omitempty"`
+}
+
+type Filter struct {
+	Prefix *string  `xml:"Prefix,omitempty"`
+	Tag    *element `xml:"Tag,omitempty"`
+	And    *element `xml:"And,omitempty"`
+}
+
+type Destination struct {
+	Bucket          string           `xml:"Bucket"`
+	StorageClass    string           `xml:"StorageClass,omitempty"`
+	ReplicationTime *ReplicationTime `xml:"ReplicationTime,omitempty"`
+	Metrics         *Metrics         `xml:"Metrics,omitempty"`
+
+	// not supported
+	Account                  *element `xml:"Account,omitempty"`
+	AccessControlTranslation *element `xml:"AccessControlTranslation,omitempty"`
+	EncryptionConfiguration  *element `xml:"EncryptionConfiguration,omitempty"`
+}
+
+// ReplicationTime is the time threshold to replicate the objects, reported by the replication metrics
+type ReplicationTime struct {
+	Status string    `xml:"Status"`
+	Time   TimeValue `xml:"Time"`
+}
+
+type Metrics struct {
+	Status         string     `xml:"Status"`
+	EventThreshold *TimeValue `xml:"EventThreshold,omitempty"`
+}
+
+type TimeValue struct {
+	Minutes int `xml:"Minutes"`
+}
+
+type DeleteMarkerReplication struct {
+	Status string `xml:"Status"`
+}
+
+type element struct {
+	Inner string `xml:",innerxml"`
+}
+
+// LoadReplicationConfiguration reads the replication configuration of the bucket entry, or nil if not configured
+func LoadReplicationConfiguration(bucketEntry *filer_pb.Entry) (*ReplicationConfiguration, error) {
+	data, found := bucketEntry.Extended[ExtendedKey]
+	if !found {
+		return nil, nil
+	}
+	rc := &ReplicationConfiguration{}
+	if err := xml.Unmarshal(data, rc); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// Validate checks the rules are supported
+func (rc *ReplicationConfiguration) Validate() s3err.ErrorCode {
+	if len(rc.Rules) == 0 || len(rc.Rules) > maxRules {
+		return s3err.ErrMalformedXML
+	}
+	for _, rule := range rc.Rules {
+		if !isValidStatus(rule.Status) {
+			return s3err.ErrMalformedXML
+		}
+		if len(rule.ID) > 255 {
+			return s3err.ErrInvalidRequest
+		}
+		if rule.SourceSelectionCriteria != nil || rule.ExistingObjectReplication != nil {
+			return s3err.ErrNotImplemented
+		}
+		if rule.Filter != nil && (rule.Filter.Tag != nil || rule.Filter.And != nil) {
+			return s3err.ErrNotImplemented
+		}
+		if rule.Prefix != nil && rule.Filter != nil {
+			return s3err.ErrMalformedXML
+		}
+		destination := rule.Destination
+		if destination.Account != nil || destination.AccessControlTranslation != nil || destination.EncryptionConfiguration != nil {
+			return s3err.ErrNotImplemented
+		}
+		if !strings.HasPrefix(destination.Bucket, BucketArnPrefix) || destination.DestinationBucket() == "" || strings.Contains(destination.DestinationBucket(), "/") {
+			return s3err.ErrInvalidRequest
+		}
+		if rule.DeleteMarkerReplication != nil && !isValidStatus(rule.DeleteMarkerReplication.Status) {
+			return s3err.ErrMalformedXML
+		}
+		if rt := destination.ReplicationTime; rt != nil && (!isValidStatus(rt.Status) || rt.Time.Minutes <= 0) {
+			return s3err.ErrInvalidRequest
+		}
+		if m := destination.Metrics; m != nil && (!isValidStatus(m.Status) || m.EventThreshold != nil && m.EventThreshold.Minutes <= 0) {
+			return s3err.ErrInvalidRequest
+		}
+	}
+	return s3err.ErrNone
+}
+
+func isValidStatus(status string) bool {
+	return status == StatusEnabled || status == StatusDisabled
+}
+
+// DestinationBucket is the bucket name of the destination bucket ARN
+func (d *Destination) DestinationBucket() string {
+	return strings.TrimPrefix(d.Bucket, BucketArnPrefix)
+}
+
+func (rule *Rule) prefix() string {
+	if rule.Filter != nil && rule.Filter.Prefix != nil {
+		return *rule.Filter.Prefix
+	}
+	if rule.Prefix != nil {
+		return *rule.Prefix
+	}
+	return ""
+}
+
+// ReplicatesDeletes tells whether the object deletions are also replicated
+func (rule *Rule) ReplicatesDeletes() bool {
+	return rule.DeleteMarkerReplication != nil && rule.DeleteMarkerReplication.Status == StatusEnabled
+}
+
+// ThresholdMinutes is the replication time threshold, or 0 if not enabled
+func (rule *Rule) ThresholdMinutes() int {
+	if rt := rule.Destination.ReplicationTime; rt != nil && rt.Status == StatusEnabled {
+		return rt.Time.Minutes
+	}
+	if m := rule.Destination.Metrics; m != nil && m.Status == StatusEnabled && m.EventThreshold != nil {
+		return m.EventThreshold.Minutes
+	}
+	return 0
+}
+
+// MatchRule returns the enabled rule with the highest priority for the object key, or nil if none applies
+func (rc *ReplicationConfiguration) MatchRule(key string) (matched *Rule) {
+	for i, rule := range rc.Rules {
+		if rule.Status != StatusEnabled || !strings.HasPrefix(key, rule.prefix()) {
+			continue
+		}
+		if matched == nil || rule.Priority > matched.Priority {
+			matched = &rc.Rules[i]
+		}
+	}
+	return
+}
@@ -0,0 +1,168 @@
+package s3api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	xhttp "github.com/chrislusf/seaweedfs/weed/s3api/http"
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// GetBucketAclHandler Get Bucket ACL
+// API reference: https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketAcl.html
+func (s3a *S3ApiServer) GetBucketAclHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	entry, errCode := s3a.getBucketEntry(r, bucket)
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	writeSuccessResponseXML(w, toAclPolicy(getCannedAcl(entry), bucketOwnerId(r, entry)))
+}
+
+// PutBucketAclHandler Put Bucket ACL, only the canned ACLs are supported
+// API reference: https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketAcl.html
+func (s3a *S3ApiServer) PutBucketAclHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	entry, errCode := s3a.getBucketEntry(r, bucket)
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	acl, errCode := readCannedAcl(r, bucketOwnerId(r, entry))
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	if entry.Extended == nil {
+		entry.Extended = make(map[string][]byte)
+	}
+	entry.Extended[xhttp.AmzAcl] = []byte(acl)
+
+	if err := s3a.updateEntry(s3a.option.BucketsPath, entry); err != nil {
+		glog.Errorf("PutBucketAclHandler update %s: %v", bucket, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+
+	writeSuccessResponseEmpty(w)
+}
+
+// GetObjectAclHandler Get Object ACL
+// API reference: https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetObjectAcl.html
+func (s3a *S3ApiServer) GetObjectAclHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, object := getBucketAndObject(r)
+
+	bucketEntry, errCode := s3a.getBucketEntry(r, bucket)
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	target := util.FullPath(fmt.Sprintf("%s/%s%s", s3a.option.BucketsPath, bucket, object))
+	dir, name := target.DirAndName()
+	entry, err := s3a.getEntry(dir, name)
+	if err != nil || entry == nil {
+		if err == nil || err == filer_pb.ErrNotFound {
+			s3err.WriteErrorResponse(w, s3err.ErrNoSuchKey, r)
+		} else {
+			glog.Errorf("GetObjectAclHandler %s: %v", r.URL, err)
+			s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		}
+		return
+	}
+
+	writeSuccessResponseXML(w, toAclPolicy(getCannedAcl(entry), bucketOwnerId(r, bucketEntry)))
+}
+
+// PutObjectAclHandler Put Object ACL, only the canned ACLs are supported
+// API reference: https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutObjectAcl.html
+func (s3a *S3ApiServer) PutObjectAclHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, object := getBucketAndObject(r)
+
+	bucketEntry, errCode := s3a.getBucketEntry(r, bucket)
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	acl, errCode := readCannedAcl(r, bucketOwnerId(r, bucketEntry))
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	target := util.FullPath(fmt.Sprintf("%s/%s%s", s3a.option.BucketsPath, bucket, object))
+	dir, name := target.DirAndName()
+	entry, err := s3a.getEntry(dir, name)
+	if err != nil || entry == nil {
+		if err == nil || err == filer_pb.ErrNotFound {
+			s3err.WriteErrorResponse(w, s3err.ErrNoSuchKey, r)
+		} else {
+			glog.Errorf("PutObjectAclHandler %s: %v", r.URL, err)
+			s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		}
+		return
+	}
+
+	if entry.Extended == nil {
+		entry.Extended = make(map[string][]byte)
+	}
+	entry.Extended[xhttp.AmzAcl] = []byte(acl)
+
+	if err = s3a.updateEntry(dir, entry); err != nil {
+		glog.Errorf("PutObjectAclHandler update %s: %v", r.URL, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+
+	writeSuccessResponseEmpty(w)
+}
+
+// readCannedAcl reads the canned ACL from the x-amz-acl header, or else from the access control policy in the body
+func readCannedAcl(r *http.Request, ownerId string) (string, s3err.ErrorCode) {
+	if errCode := validateCannedAclHeader(r); errCode != s3err.ErrNone {
+		return "", errCode
+	}
+	if acl := r.Header.Get(xhttp.AmzAcl); acl != "" {
+		return acl, s3err.ErrNone
+	}
+
+	input, err := ioutil.ReadAll(io.LimitReader(r.Body, r.ContentLength))
+	if err != nil {
+		glog.Errorf("read acl input %s: %v", r.URL, err)
+		return "", s3err.ErrInternalError
+	}
+	policy := &AclPolicy{}
+	if err = xml.Unmarshal(input, policy); err != nil {
+		glog.V(1).Infof("unmarshal acl %s: %v", r.URL, err)
+		return "", s3err.ErrMalformedXML
+	}
+	if policy.Owner.ID == "" {
+		policy.Owner.ID = ownerId
+	}
+	return policy.toCannedAcl()
+}
+
+// bucketOwnerId is the identity created the bucket, or else the current identity
+func bucketOwnerId(r *http.Request, bucketEntry *filer_pb.Entry) string {
+	if id, found := bucketEntry.Extended[xhttp.AmzIdentityId]; found {
+		return string(id)
+	}
+	return r.Header.Get(xhttp.AmzIdentityId)
+}
@@ -3,6 +3,8 @@ package s3api
 import (
 	"net/http"
 	"strings"
+
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
 )
 
 // AWS Signature Version '4' constants.
@@ -90,3 +92,18 @@ func getRequestAuthType(r *http.Request) authType {
 	}
 	return authTypeUnknown
 }
+
+// getRequestRegion returns the region of the signature v4 credential scope, or empty if not signed with v4
+func getRequestRegion(r *http.Request) string {
+	switch getRequestAuthType(r) {
+	case authTypeSigned, authTypeStreamingSigned:
+		if signV4Values, errCode := parseSignV4(r.Header.Get("Authorization")); errCode == s3err.ErrNone {
+			return signV4Values.Credential.scope.region
+		}
+	case authTypePresigned:
+		if credential, errCode := parseCredentialHeader("Credential=" + r.URL.Query().Get("X-Amz-Credential")); errCode == s3err.ErrNone {
+			return credential.scope.region
+		}
+	}
+	return ""
+}
@@ -0,0 +1,110 @@
+package s3api
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+)
+
+// GetBucketEncryptionHandler Get Bucket Encryption configuration
+// API reference: https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketEncryption.html
+func (s3a *S3ApiServer) GetBucketEncryptionHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	entry, errCode := s3a.getBucketEntry(r, bucket)
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	encryption, err := loadEncryption(entry)
+	if err != nil {
+		glog.Errorf("GetBucketEncryptionHandler %s: %v", bucket, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+	if encryption == nil {
+		s3err.WriteErrorResponse(w, s3err.ErrNoSuchServerSideEncryptionConfiguration, r)
+		return
+	}
+
+	writeSuccessResponseXML(w, encryption)
+}
+
+// PutBucketEncryptionHandler Put Bucket Encryption configuration
+// API reference: https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketEncryption.html
+func (s3a *S3ApiServer) PutBucketEncryptionHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	entry, errCode := s3a.getBucketEntry(r, bucket)
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	input, err := ioutil.ReadAll(io.LimitReader(r.Body, r.ContentLength))
+	if err != nil {
+		glog.Errorf("PutBucketEncryptionHandler read input %s: %v", r.URL, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+	encryption := &ServerSideEncryptionConfiguration{}
+	if err = xml.Unmarshal(input, encryption); err != nil {
+		glog.V(1).Infof("PutBucketEncryptionHandler Unmarshal %s: %v", r.URL, err)
+		s3err.WriteErrorResponse(w, s3err.ErrMalformedXML, r)
+		return
+	}
+	if errCode = encryption.Validate(); errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	data, err := xml.Marshal(encryption)
+	if err != nil {
+		glog.Errorf("PutBucketEncryptionHandler marshal %s: %v", bucket, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+	if entry.Extended == nil {
+		entry.Extended = make(map[string][]byte)
+	}
+	entry.Extended[s3EncryptionExtendedKey] = data
+
+	if err = s3a.updateEntry(s3a.option.BucketsPath, entry); err != nil {
+		glog.Errorf("PutBucketEncryptionHandler update %s: %v", bucket, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+
+	writeSuccessResponseEmpty(w)
+}
+
+// DeleteBucketEncryptionHandler Delete Bucket Encryption
+// API reference: https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteBucketEncryption.html
+func (s3a *S3ApiServer) DeleteBucketEncryptionHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	entry, errCode := s3a.getBucketEntry(r, bucket)
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	if _, found := entry.Extended[s3EncryptionExtendedKey]; found {
+		delete(entry.Extended, s3EncryptionExtendedKey)
+		if err := s3a.updateEntry(s3a.option.BucketsPath, entry); err != nil {
+			glog.Errorf("DeleteBucketEncryptionHandler update %s: %v", bucket, err)
+			s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+			return
+		}
+	}
+
+	s3err.WriteEmptyResponse(w, http.StatusNoContent)
+}
@@ -105,14 +105,21 @@ func (s3a *S3ApiServer) PutBucketHandler(w http.ResponseWriter, r *http.Request)
 		s3err.WriteErrorResponse(w, errCode, r)
 		return
 	}
+	if errCode = validateCannedAclHeader(r); errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
 
 	fn := func(entry *filer_pb.Entry) {
+		if entry.Extended == nil {
+			entry.Extended = make(map[string][]byte)
+		}
 		if identityId := r.Header.Get(xhttp.AmzIdentityId); identityId != "" {
-			if entry.Extended == nil {
-				entry.Extended = make(map[string][]byte)
-			}
 			entry.Extended[xhttp.AmzIdentityId] = []byte(identityId)
 		}
+		if acl := r.Header.Get(xhttp.AmzAcl); acl != "" {
+			entry.Extended[xhttp.AmzAcl] = []byte(acl)
+		}
 	}
 
 	// create the folder for bucket, but lazily create actual collection
@@ -163,7 +170,14 @@ func (s3a *S3ApiServer) HeadBucketHandler(w http.ResponseWriter, r *http.Request
 
 	bucket, _ := getBucketAndObject(r)
 
-	if err := s3a.checkBucket(r, bucket); err != s3err.ErrNone {
+	err := s3a.checkBucket(r, bucket)
+	if err == s3err.ErrNone && !s3a.isBucketRegion(r) {
+		err = s3err.ErrPermanentRedirect
+	}
+	if err != s3err.ErrNoSuchBucket {
+		w.Header().Set(xhttp.AmzBucketRegion, s3a.bucketRegion())
+	}
+	if err != s3err.ErrNone {
 		s3err.WriteErrorResponse(w, err, r)
 		return
 	}
@@ -171,16 +185,104 @@ func (s3a *S3ApiServer) HeadBucketHandler(w http.ResponseWriter, r *http.Request
 	writeSuccessResponseEmpty(w)
 }
 
+// LocationConstraintResponse is empty for the default region us-east-1
+type LocationConstraintResponse struct {
+	XMLName            xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LocationConstraint"`
+	LocationConstraint string   `xml:",chardata"`
+}
+
+// GetBucketLocationHandler returns the region of the bucket, which can be requested from any region
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketLocation.html
+func (s3a *S3ApiServer) GetBucketLocationHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	if err := s3a.checkBucket(r, bucket); err != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, err, r)
+		return
+	}
+
+	response := LocationConstraintResponse{}
+	if region := s3a.bucketRegion(); region != defaultRegion {
+		response.LocationConstraint = region
+	}
+
+	writeSuccessResponseXML(w, response)
+}
+
+type VersioningConfigurationResponse struct {
+	XMLName xml.Name         `xml:"http://s3.amazonaws.com/doc/2006-03-01/ VersioningConfiguration"`
+	Status  VersioningStatus `xml:"Status,omitempty"`
+}
+
+// GetBucketVersioningHandler returns the empty versioning configuration, since the versioning is never enabled
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketVersioning.html
+func (s3a *S3ApiServer) GetBucketVersioningHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	if err := s3a.checkBucket(r, bucket); err != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, err, r)
+		return
+	}
+	if !s3a.isBucketRegion(r) {
+		w.Header().Set(xhttp.AmzBucketRegion, s3a.bucketRegion())
+		s3err.WriteErrorResponse(w, s3err.ErrPermanentRedirect, r)
+		return
+	}
+
+	writeSuccessResponseXML(w, VersioningConfigurationResponse{})
+}
+
+// PutBucketVersioningHandler rejects enabling the versioning, which is not supported
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketVersioning.html
+func (s3a *S3ApiServer) PutBucketVersioningHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	if err := s3a.checkBucket(r, bucket); err != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, err, r)
+		return
+	}
+
+	s3err.WriteErrorResponse(w, s3err.ErrNotImplemented, r)
+}
+
+const defaultRegion = "us-east-1"
+
+// bucketRegion is the configured region of all buckets, or us-east-1 by default
+func (s3a *S3ApiServer) bucketRegion() string {
+	if s3a.option.Region == "" {
+		return defaultRegion
+	}
+	return s3a.option.Region
+}
+
+// isBucketRegion checks the region in the signature v4 credential scope, if any, is the bucket region.
+// Any region is accepted if the region is not configured.
+func (s3a *S3ApiServer) isBucketRegion(r *http.Request) bool {
+	if s3a.option.Region == "" {
+		return true
+	}
+	region := getRequestRegion(r)
+	return region == "" || region == s3a.option.Region
+}
+
 func (s3a *S3ApiServer) checkBucket(r *http.Request, bucket string) s3err.ErrorCode {
+	_, errCode := s3a.getBucketEntry(r, bucket)
+	return errCode
+}
+
+func (s3a *S3ApiServer) getBucketEntry(r *http.Request, bucket string) (*filer_pb.Entry, s3err.ErrorCode) {
 	entry, err := s3a.getEntry(s3a.option.BucketsPath, bucket)
 	if entry == nil || err == filer_pb.ErrNotFound {
-		return s3err.ErrNoSuchBucket
+		return nil, s3err.ErrNoSuchBucket
 	}
 
 	if !s3a.hasAccess(r, entry) {
-		return s3err.ErrAccessDenied
+		return nil, s3err.ErrAccessDenied
 	}
-	return s3err.ErrNone
+	return entry, s3err.ErrNone
 }
 
 func (s3a *S3ApiServer) hasAccess(r *http.Request, entry *filer_pb.Entry) bool {
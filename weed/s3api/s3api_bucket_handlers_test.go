@@ -2,6 +2,7 @@ package s3api
 
 import (
 	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+	"net/http"
 	"testing"
 	"time"
 
@@ -38,3 +39,45 @@ func TestListBucketsHandler(t *testing.T) {
 		t.Errorf("unexpected output: %s\nexpecting:%s", encoded, expected)
 	}
 }
+
+func TestGetBucketLocationResponse(t *testing.T) {
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">eu-west-1</LocationConstraint>`
+	encoded := string(s3err.EncodeXMLResponse(LocationConstraintResponse{LocationConstraint: "eu-west-1"}))
+	if encoded != expected {
+		t.Errorf("unexpected output: %s\nexpecting:%s", encoded, expected)
+	}
+
+	expected = `<?xml version="1.0" encoding="UTF-8"?>
+<VersioningConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"></VersioningConfiguration>`
+	encoded = string(s3err.EncodeXMLResponse(VersioningConfigurationResponse{}))
+	if encoded != expected {
+		t.Errorf("unexpected output: %s\nexpecting:%s", encoded, expected)
+	}
+}
+
+func TestIsBucketRegion(t *testing.T) {
+	s3a := &S3ApiServer{option: &S3ApiServerOption{Region: "eu-west-1"}}
+
+	r, _ := http.NewRequest("HEAD", "http://localhost:8333/bucket", nil)
+	if !s3a.isBucketRegion(r) {
+		t.Errorf("unsigned request should be accepted")
+	}
+
+	r.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=key/20210101/us-west-2/s3/aws4_request, SignedHeaders=host, Signature=abc")
+	if s3a.isBucketRegion(r) {
+		t.Errorf("request signed for us-west-2 should be redirected")
+	}
+
+	r, _ = http.NewRequest("HEAD", "http://localhost:8333/bucket?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Credential=key%2F20210101%2Feu-west-1%2Fs3%2Faws4_request", nil)
+	if !s3a.isBucketRegion(r) {
+		t.Errorf("request presigned for eu-west-1 should be accepted")
+	}
+
+	s3a.option.Region = ""
+	r.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=key/20210101/us-west-2/s3/aws4_request, SignedHeaders=host, Signature=abc")
+	if !s3a.isBucketRegion(r) {
+		t.Errorf("any region should be accepted if not configured")
+	}
+}
@@ -0,0 +1,124 @@
+package s3api
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+)
+
+// GetBucketLifecycleConfigurationHandler Get Bucket Lifecycle configuration
+// API reference: https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketLifecycleConfiguration.html
+func (s3a *S3ApiServer) GetBucketLifecycleConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	entry, errCode := s3a.getBucketEntry(r, bucket)
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	lifecycle, err := loadLifecycle(entry)
+	if err != nil {
+		glog.Errorf("GetBucketLifecycleConfigurationHandler %s: %v", bucket, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+	if lifecycle == nil {
+		s3err.WriteErrorResponse(w, s3err.ErrNoSuchLifecycleConfiguration, r)
+		return
+	}
+
+	writeSuccessResponseXML(w, lifecycle)
+}
+
+// PutBucketLifecycleConfigurationHandler Put Bucket Lifecycle configuration
+// API reference: https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketLifecycleConfiguration.html
+func (s3a *S3ApiServer) PutBucketLifecycleConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	entry, errCode := s3a.getBucketEntry(r, bucket)
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	input, err := ioutil.ReadAll(io.LimitReader(r.Body, r.ContentLength))
+	if err != nil {
+		glog.Errorf("PutBucketLifecycleConfigurationHandler read input %s: %v", r.URL, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+	lifecycle := &Lifecycle{}
+	if err = xml.Unmarshal(input, lifecycle); err != nil {
+		glog.V(1).Infof("PutBucketLifecycleConfigurationHandler Unmarshal %s: %v", r.URL, err)
+		s3err.WriteErrorResponse(w, s3err.ErrMalformedXML, r)
+		return
+	}
+	if errCode = lifecycle.Validate(); errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	data, err := xml.Marshal(lifecycle)
+	if err != nil {
+		glog.Errorf("PutBucketLifecycleConfigurationHandler marshal %s: %v", bucket, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+	if entry.Extended == nil {
+		entry.Extended = make(map[string][]byte)
+	}
+	entry.Extended[s3LifecycleExtendedKey] = data
+
+	if err = s3a.updateEntry(s3a.option.BucketsPath, entry); err != nil {
+		glog.Errorf("PutBucketLifecycleConfigurationHandler update %s: %v", bucket, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+
+	writeSuccessResponseEmpty(w)
+}
+
+// DeleteBucketLifecycleHandler Delete Bucket Lifecycle
+// API reference: https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteBucketLifecycle.html
+func (s3a *S3ApiServer) DeleteBucketLifecycleHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	entry, errCode := s3a.getBucketEntry(r, bucket)
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	if _, found := entry.Extended[s3LifecycleExtendedKey]; found {
+		delete(entry.Extended, s3LifecycleExtendedKey)
+		if err := s3a.updateEntry(s3a.option.BucketsPath, entry); err != nil {
+			glog.Errorf("DeleteBucketLifecycleHandler update %s: %v", bucket, err)
+			s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+			return
+		}
+	}
+
+	s3err.WriteEmptyResponse(w, http.StatusNoContent)
+}
+
+// loadLifecycle reads the lifecycle configuration of the bucket entry, or nil if not configured
+func loadLifecycle(bucketEntry *filer_pb.Entry) (*Lifecycle, error) {
+	data, found := bucketEntry.Extended[s3LifecycleExtendedKey]
+	if !found {
+		return nil, nil
+	}
+	lifecycle := &Lifecycle{}
+	if err := xml.Unmarshal(data, lifecycle); err != nil {
+		return nil, err
+	}
+	return lifecycle, nil
+}
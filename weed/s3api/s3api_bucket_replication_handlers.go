@@ -0,0 +1,111 @@
+package s3api
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3_replication"
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+)
+
+// GetBucketReplicationHandler Get Bucket Replication configuration
+// API reference: https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketReplication.html
+func (s3a *S3ApiServer) GetBucketReplicationHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	entry, errCode := s3a.getBucketEntry(r, bucket)
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	replication, err := s3_replication.LoadReplicationConfiguration(entry)
+	if err != nil {
+		glog.Errorf("GetBucketReplicationHandler %s: %v", bucket, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+	if replication == nil {
+		s3err.WriteErrorResponse(w, s3err.ErrReplicationConfigurationNotFound, r)
+		return
+	}
+
+	writeSuccessResponseXML(w, replication)
+}
+
+// PutBucketReplicationHandler Put Bucket Replication configuration
+// API reference: https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketReplication.html
+func (s3a *S3ApiServer) PutBucketReplicationHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	entry, errCode := s3a.getBucketEntry(r, bucket)
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	input, err := ioutil.ReadAll(io.LimitReader(r.Body, r.ContentLength))
+	if err != nil {
+		glog.Errorf("PutBucketReplicationHandler read input %s: %v", r.URL, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+	replication := &s3_replication.ReplicationConfiguration{}
+	if err = xml.Unmarshal(input, replication); err != nil {
+		glog.V(1).Infof("PutBucketReplicationHandler Unmarshal %s: %v", r.URL, err)
+		s3err.WriteErrorResponse(w, s3err.ErrMalformedXML, r)
+		return
+	}
+	if errCode = replication.Validate(); errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	data, err := xml.Marshal(replication)
+	if err != nil {
+		glog.Errorf("PutBucketReplicationHandler marshal %s: %v", bucket, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+	if entry.Extended == nil {
+		entry.Extended = make(map[string][]byte)
+	}
+	entry.Extended[s3_replication.ExtendedKey] = data
+
+	if err = s3a.updateEntry(s3a.option.BucketsPath, entry); err != nil {
+		glog.Errorf("PutBucketReplicationHandler update %s: %v", bucket, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+
+	writeSuccessResponseEmpty(w)
+}
+
+// DeleteBucketReplicationHandler Delete Bucket Replication
+// API reference: https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteBucketReplication.html
+func (s3a *S3ApiServer) DeleteBucketReplicationHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	entry, errCode := s3a.getBucketEntry(r, bucket)
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	if _, found := entry.Extended[s3_replication.ExtendedKey]; found {
+		delete(entry.Extended, s3_replication.ExtendedKey)
+		if err := s3a.updateEntry(s3a.option.BucketsPath, entry); err != nil {
+			glog.Errorf("DeleteBucketReplicationHandler update %s: %v", bucket, err)
+			s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+			return
+		}
+	}
+
+	s3err.WriteEmptyResponse(w, http.StatusNoContent)
+}
@@ -0,0 +1,124 @@
+package s3api
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+)
+
+// GetBucketWebsiteHandler Get Bucket Website configuration
+// API reference: https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketWebsite.html
+func (s3a *S3ApiServer) GetBucketWebsiteHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	entry, errCode := s3a.getBucketEntry(r, bucket)
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	website, err := loadWebsite(entry)
+	if err != nil {
+		glog.Errorf("GetBucketWebsiteHandler %s: %v", bucket, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+	if website == nil {
+		s3err.WriteErrorResponse(w, s3err.ErrNoSuchWebsiteConfiguration, r)
+		return
+	}
+
+	writeSuccessResponseXML(w, website)
+}
+
+// PutBucketWebsiteHandler Put Bucket Website configuration
+// API reference: https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketWebsite.html
+func (s3a *S3ApiServer) PutBucketWebsiteHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	entry, errCode := s3a.getBucketEntry(r, bucket)
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	input, err := ioutil.ReadAll(io.LimitReader(r.Body, r.ContentLength))
+	if err != nil {
+		glog.Errorf("PutBucketWebsiteHandler read input %s: %v", r.URL, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+	website := &WebsiteConfiguration{}
+	if err = xml.Unmarshal(input, website); err != nil {
+		glog.V(1).Infof("PutBucketWebsiteHandler Unmarshal %s: %v", r.URL, err)
+		s3err.WriteErrorResponse(w, s3err.ErrMalformedXML, r)
+		return
+	}
+	if errCode = website.Validate(); errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	data, err := xml.Marshal(website)
+	if err != nil {
+		glog.Errorf("PutBucketWebsiteHandler marshal %s: %v", bucket, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+	if entry.Extended == nil {
+		entry.Extended = make(map[string][]byte)
+	}
+	entry.Extended[s3WebsiteExtendedKey] = data
+
+	if err = s3a.updateEntry(s3a.option.BucketsPath, entry); err != nil {
+		glog.Errorf("PutBucketWebsiteHandler update %s: %v", bucket, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+
+	writeSuccessResponseEmpty(w)
+}
+
+// DeleteBucketWebsiteHandler Delete Bucket Website
+// API reference: https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteBucketWebsite.html
+func (s3a *S3ApiServer) DeleteBucketWebsiteHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, _ := getBucketAndObject(r)
+
+	entry, errCode := s3a.getBucketEntry(r, bucket)
+	if errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	if _, found := entry.Extended[s3WebsiteExtendedKey]; found {
+		delete(entry.Extended, s3WebsiteExtendedKey)
+		if err := s3a.updateEntry(s3a.option.BucketsPath, entry); err != nil {
+			glog.Errorf("DeleteBucketWebsiteHandler update %s: %v", bucket, err)
+			s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+			return
+		}
+	}
+
+	s3err.WriteEmptyResponse(w, http.StatusNoContent)
+}
+
+// loadWebsite reads the website configuration of the bucket entry, or nil if not configured
+func loadWebsite(bucketEntry *filer_pb.Entry) (*WebsiteConfiguration, error) {
+	data, found := bucketEntry.Extended[s3WebsiteExtendedKey]
+	if !found {
+		return nil, nil
+	}
+	website := &WebsiteConfiguration{}
+	if err := xml.Unmarshal(data, website); err != nil {
+		return nil, err
+	}
+	return website, nil
+}
@@ -2,6 +2,7 @@ package s3api
 
 import (
 	"fmt"
+	"github.com/chrislusf/seaweedfs/weed/filer"
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
 	weed_server "github.com/chrislusf/seaweedfs/weed/server"
@@ -27,6 +28,18 @@ func (s3a *S3ApiServer) CopyObjectHandler(w http.ResponseWriter, r *http.Request
 
 	srcBucket, srcObject := pathToBucketAndObject(cpSrcPath)
 
+	if errCode := validateCannedAclHeader(r); errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
+	if cpSrcPath != "" {
+		if errCode := s3a.checkCopySourcePreconditions(r, srcBucket, srcObject); errCode != s3err.ErrNone {
+			s3err.WriteErrorResponse(w, errCode, r)
+			return
+		}
+	}
+
 	if (srcBucket == dstBucket && srcObject == dstObject || cpSrcPath == "") && isReplace(r) {
 		fullPath := util.FullPath(fmt.Sprintf("%s/%s%s", s3a.option.BucketsPath, dstBucket, dstObject))
 		dir, name := fullPath.DirAndName()
@@ -57,6 +70,11 @@ func (s3a *S3ApiServer) CopyObjectHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if errCode := s3a.setServerSideEncryption(w, r, dstBucket); errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
 	dstUrl := fmt.Sprintf("http://%s%s/%s%s?collection=%s",
 		s3a.option.Filer, s3a.option.BucketsPath, dstBucket, dstObject, dstBucket)
 	srcUrl := fmt.Sprintf("http://%s%s/%s%s",
@@ -121,6 +139,11 @@ func (s3a *S3ApiServer) CopyObjectPartHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if errCode := s3a.checkCopySourcePreconditions(r, srcBucket, srcObject); errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
 	uploadID := r.URL.Query().Get("uploadId")
 	partIDString := r.URL.Query().Get("partNumber")
 
@@ -138,6 +161,11 @@ func (s3a *S3ApiServer) CopyObjectPartHandler(w http.ResponseWriter, r *http.Req
 
 	rangeHeader := r.Header.Get("x-amz-copy-source-range")
 
+	if errCode := s3a.setUploadServerSideEncryption(w, r, dstBucket, uploadID); errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
 	dstUrl := fmt.Sprintf("http://%s%s/%s/%04d.part?collection=%s",
 		s3a.option.Filer, s3a.genUploadsFolder(dstBucket), uploadID, partID, dstBucket)
 	srcUrl := fmt.Sprintf("http://%s%s/%s%s",
@@ -169,6 +197,26 @@ func (s3a *S3ApiServer) CopyObjectPartHandler(w http.ResponseWriter, r *http.Req
 
 }
 
+// checkCopySourcePreconditions evaluates the x-amz-copy-source-if-* headers against the source object
+func (s3a *S3ApiServer) checkCopySourcePreconditions(r *http.Request, srcBucket, srcObject string) s3err.ErrorCode {
+	preconditions := weed_server.NewPreconditions(r.Header, "X-Amz-Copy-Source-")
+	if preconditions.IsEmpty() {
+		return s3err.ErrNone
+	}
+
+	fullPath := util.FullPath(fmt.Sprintf("%s/%s%s", s3a.option.BucketsPath, srcBucket, srcObject))
+	dir, name := fullPath.DirAndName()
+	entry, err := s3a.getEntry(dir, name)
+	if err != nil || entry == nil || entry.IsDirectory {
+		return s3err.ErrInvalidCopySource
+	}
+
+	if preconditions.Evaluate(true, filer.ETag(entry), time.Unix(entry.Attributes.Mtime, 0), http.StatusPreconditionFailed) != http.StatusOK {
+		return s3err.ErrPreconditionFailed
+	}
+	return s3err.ErrNone
+}
+
 func isReplace(r *http.Request) bool {
 	return r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE"
 }
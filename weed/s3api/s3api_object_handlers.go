@@ -12,9 +12,11 @@ import (
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	xhttp "github.com/chrislusf/seaweedfs/weed/s3api/http"
 	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
 
 	"github.com/gorilla/mux"
@@ -23,6 +25,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 	weed_server "github.com/chrislusf/seaweedfs/weed/server"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 )
 
 var (
@@ -55,6 +58,11 @@ func (s3a *S3ApiServer) PutObjectHandler(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	if errCode := validateCannedAclHeader(r); errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
 	if r.Header.Get("Expires") != "" {
 		if _, err = time.Parse(http.TimeFormat, r.Header.Get("Expires")); err != nil {
 			s3err.WriteErrorResponse(w, s3err.ErrInvalidDigest, r)
@@ -80,8 +88,7 @@ func (s3a *S3ApiServer) PutObjectHandler(w http.ResponseWriter, r *http.Request)
 		}
 	} else {
 		if authTypeStreamingSigned == rAuthType {
-			s3err.WriteErrorResponse(w, s3err.ErrAuthNotSetup, r)
-			return
+			dataReader = newUnverifiedChunkedReader(r)
 		}
 	}
 	defer dataReader.Close()
@@ -92,6 +99,11 @@ func (s3a *S3ApiServer) PutObjectHandler(w http.ResponseWriter, r *http.Request)
 			return
 		}
 	} else {
+		if errCode := s3a.setServerSideEncryption(w, r, bucket); errCode != s3err.ErrNone {
+			s3err.WriteErrorResponse(w, errCode, r)
+			return
+		}
+
 		uploadUrl := fmt.Sprintf("http://%s%s/%s%s", s3a.option.Filer, s3a.option.BucketsPath, bucket, urlPathEscape(object))
 
 		etag, errCode := s3a.putToFiler(r, uploadUrl, dataReader)
@@ -124,8 +136,8 @@ func (s3a *S3ApiServer) GetObjectHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	destUrl := fmt.Sprintf("http://%s%s/%s%s",
-		s3a.option.Filer, s3a.option.BucketsPath, bucket, urlPathEscape(object))
+	destUrl := fmt.Sprintf("http://%s%s/%s%s%s",
+		s3a.option.Filer, s3a.option.BucketsPath, bucket, urlPathEscape(object), responseOverrideQuery(r))
 
 	s3a.proxyToFiler(w, r, destUrl, passThroughResponse)
 
@@ -135,8 +147,8 @@ func (s3a *S3ApiServer) HeadObjectHandler(w http.ResponseWriter, r *http.Request
 
 	bucket, object := getBucketAndObject(r)
 
-	destUrl := fmt.Sprintf("http://%s%s/%s%s",
-		s3a.option.Filer, s3a.option.BucketsPath, bucket, urlPathEscape(object))
+	destUrl := fmt.Sprintf("http://%s%s/%s%s%s",
+		s3a.option.Filer, s3a.option.BucketsPath, bucket, urlPathEscape(object), responseOverrideQuery(r))
 
 	s3a.proxyToFiler(w, r, destUrl, passThroughResponse)
 
@@ -280,7 +292,7 @@ func (s3a *S3ApiServer) doDeleteEmptyDirectories(client filer_pb.SeaweedFilerCli
 	return
 }
 
-var passThroughHeaders = []string{
+var responseOverrideParameters = []string{
 	"response-cache-control",
 	"response-content-disposition",
 	"response-content-encoding",
@@ -289,14 +301,29 @@ var passThroughHeaders = []string{
 	"response-expires",
 }
 
+// responseOverrideQuery passes the response header overrides, e.g., "response-content-disposition", to the filer
+func responseOverrideQuery(r *http.Request) string {
+	query := r.URL.Query()
+	overrides := url.Values{}
+	for _, p := range responseOverrideParameters {
+		if v := query.Get(p); v != "" {
+			overrides.Set(p, v)
+		}
+	}
+	if len(overrides) == 0 {
+		return ""
+	}
+	return "?" + overrides.Encode()
+}
+
 func (s3a *S3ApiServer) proxyToFiler(w http.ResponseWriter, r *http.Request, destUrl string, responseFn func(proxyResponse *http.Response, w http.ResponseWriter)) {
 
-	glog.V(2).Infof("s3 proxying %s to %s", r.Method, destUrl)
+	glog.V(2).InfofCtx(r.Context(), "s3 proxying %s to %s", r.Method, destUrl)
 
 	proxyReq, err := http.NewRequest(r.Method, destUrl, r.Body)
 
 	if err != nil {
-		glog.Errorf("NewRequest %s: %v", destUrl, err)
+		glog.ErrorfCtx(r.Context(), "NewRequest %s: %v", destUrl, err)
 		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
 		return
 	}
@@ -305,28 +332,16 @@ func (s3a *S3ApiServer) proxyToFiler(w http.ResponseWriter, r *http.Request, des
 	proxyReq.Header.Set("X-Forwarded-For", r.RemoteAddr)
 
 	for header, values := range r.Header {
-		// handle s3 related headers
-		passed := false
-		for _, h := range passThroughHeaders {
-			if strings.ToLower(header) == h && len(values) > 0 {
-				proxyReq.Header.Add(header[len("response-"):], values[0])
-				passed = true
-				break
-			}
-		}
-		if passed {
-			continue
-		}
-		// handle other headers
 		for _, value := range values {
 			proxyReq.Header.Add(header, value)
 		}
 	}
+	request_id.InjectToRequest(r.Context(), proxyReq)
 
 	resp, postErr := client.Do(proxyReq)
 
 	if postErr != nil {
-		glog.Errorf("post to filer: %v", postErr)
+		glog.ErrorfCtx(r.Context(), "post to filer: %v", postErr)
 		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
 		return
 	}
@@ -337,6 +352,14 @@ func (s3a *S3ApiServer) proxyToFiler(w http.ResponseWriter, r *http.Request, des
 		return
 	}
 
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		if contentRange := resp.Header.Get("Content-Range"); contentRange != "" {
+			w.Header().Set("Content-Range", contentRange)
+		}
+		s3err.WriteErrorResponse(w, s3err.ErrInvalidRange, r)
+		return
+	}
+
 	if (resp.ContentLength == -1 || resp.StatusCode == 404) && resp.StatusCode != 304 {
 		if r.Method != "DELETE" {
 			s3err.WriteErrorResponse(w, s3err.ErrNoSuchKey, r)
@@ -368,7 +391,7 @@ func (s3a *S3ApiServer) putToFiler(r *http.Request, uploadUrl string, dataReader
 	proxyReq, err := http.NewRequest("PUT", uploadUrl, body)
 
 	if err != nil {
-		glog.Errorf("NewRequest %s: %v", uploadUrl, err)
+		glog.ErrorfCtx(r.Context(), "NewRequest %s: %v", uploadUrl, err)
 		return "", s3err.ErrInternalError
 	}
 
@@ -380,11 +403,30 @@ func (s3a *S3ApiServer) putToFiler(r *http.Request, uploadUrl string, dataReader
 			proxyReq.Header.Add(header, value)
 		}
 	}
+	request_id.InjectToRequest(r.Context(), proxyReq)
+
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		// the checksums of the copy request do not apply to the copied content
+		proxyReq.Header.Del("Content-Md5")
+		proxyReq.Header.Del("X-Amz-Content-Sha256")
+	}
+
+	if isRequestSignStreamingV4(r) {
+		// the "aws-chunked" payload is decoded by the dataReader
+		removeAwsChunkedEncoding(proxyReq.Header)
+		if decodedLength, err := strconv.ParseInt(r.Header.Get(xhttp.AmzDecodedContentLength), 10, 64); err == nil {
+			proxyReq.ContentLength = decodedLength
+		}
+		proxyReq.Header.Del(xhttp.AmzDecodedContentLength)
+	}
 
 	resp, postErr := client.Do(proxyReq)
 
 	if postErr != nil {
-		glog.Errorf("post to filer: %v", postErr)
+		glog.ErrorfCtx(r.Context(), "post to filer: %v", postErr)
+		if strings.Contains(postErr.Error(), errChunkSignatureMismatch.Error()) {
+			return "", s3err.ErrSignatureDoesNotMatch
+		}
 		return "", s3err.ErrInternalError
 	}
 	defer resp.Body.Close()
@@ -393,23 +435,38 @@ func (s3a *S3ApiServer) putToFiler(r *http.Request, uploadUrl string, dataReader
 
 	resp_body, ra_err := ioutil.ReadAll(resp.Body)
 	if ra_err != nil {
-		glog.Errorf("upload to filer response read %d: %v", resp.StatusCode, ra_err)
+		glog.ErrorfCtx(r.Context(), "upload to filer response read %d: %v", resp.StatusCode, ra_err)
 		return etag, s3err.ErrInternalError
 	}
 	var ret weed_server.FilerPostResult
 	unmarshal_err := json.Unmarshal(resp_body, &ret)
 	if unmarshal_err != nil {
-		glog.Errorf("failing to read upload to %s : %v", uploadUrl, string(resp_body))
+		glog.ErrorfCtx(r.Context(), "failing to read upload to %s : %v", uploadUrl, string(resp_body))
 		return "", s3err.ErrInternalError
 	}
 	if ret.Error != "" {
-		glog.Errorf("upload to filer error: %v", ret.Error)
+		glog.ErrorfCtx(r.Context(), "upload to filer error: %v", ret.Error)
 		return "", filerErrorToS3Error(ret.Error)
 	}
 
 	return etag, s3err.ErrNone
 }
 
+// removeAwsChunkedEncoding removes "aws-chunked" from the Content-Encoding, keeping the other encodings, e.g., gzip
+func removeAwsChunkedEncoding(h http.Header) {
+	var encodings []string
+	for _, encoding := range strings.Split(h.Get("Content-Encoding"), ",") {
+		if encoding = strings.TrimSpace(encoding); encoding != "" && encoding != "aws-chunked" {
+			encodings = append(encodings, encoding)
+		}
+	}
+	if len(encodings) == 0 {
+		h.Del("Content-Encoding")
+	} else {
+		h.Set("Content-Encoding", strings.Join(encodings, ","))
+	}
+}
+
 func setEtag(w http.ResponseWriter, etag string) {
 	if etag != "" {
 		if strings.HasPrefix(etag, "\"") {
@@ -435,5 +492,14 @@ func filerErrorToS3Error(errString string) s3err.ErrorCode {
 	if strings.HasPrefix(errString, "existing ") && strings.HasSuffix(errString, "is a directory") {
 		return s3err.ErrExistingObjectIsDirectory
 	}
+	if errString == weed_server.ErrPreconditionFailed.Error() {
+		return s3err.ErrPreconditionFailed
+	}
+	if strings.HasPrefix(errString, weed_server.ErrContentMd5Mismatch.Error()) {
+		return s3err.ErrBadDigest
+	}
+	if strings.HasPrefix(errString, weed_server.ErrContentHashMismatch.Error()) {
+		return s3err.ErrContentSHA256Mismatch
+	}
 	return s3err.ErrInternalError
 }
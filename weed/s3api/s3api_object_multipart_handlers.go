@@ -1,14 +1,16 @@
 package s3api
 
 import (
+	"encoding/xml"
 	"fmt"
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
 	weed_server "github.com/chrislusf/seaweedfs/weed/server"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -19,6 +21,9 @@ const (
 	maxUploadsList         = 10000 // Limit number of uploads in a listUploadsResponse.
 	maxPartsList           = 10000 // Limit number of parts in a listPartsResponse.
 	globalMaxPartID        = 100000
+
+	// the request body listing up to globalMaxPartID parts
+	maxCompleteMultipartUploadSize = 16 << 20
 )
 
 // NewMultipartUploadHandler - New multipart upload.
@@ -31,6 +36,15 @@ func (s3a *S3ApiServer) NewMultipartUploadHandler(w http.ResponseWriter, r *http
 		Metadata: make(map[string]*string),
 	}
 
+	if errCode := validateCannedAclHeader(r); errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+	if errCode := s3a.setServerSideEncryption(w, r, bucket); errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
+		return
+	}
+
 	metadata := weed_server.SaveAmzMetaData(r, nil, false)
 	for k, v := range metadata {
 		createMultipartUploadInput.Metadata[k] = aws.String(string(v))
@@ -56,10 +70,31 @@ func (s3a *S3ApiServer) CompleteMultipartUploadHandler(w http.ResponseWriter, r
 	// Get upload id.
 	uploadID, _, _, _ := getObjectResources(r.URL.Query())
 
+	input, err := ioutil.ReadAll(io.LimitReader(r.Body, maxCompleteMultipartUploadSize))
+	if err != nil {
+		glog.Errorf("CompleteMultipartUploadHandler read input %s: %v", r.URL, err)
+		s3err.WriteErrorResponse(w, s3err.ErrInternalError, r)
+		return
+	}
+	completeUpload := &CompleteMultipartUpload{}
+	if err = xml.Unmarshal(input, completeUpload); err != nil {
+		glog.V(1).Infof("CompleteMultipartUploadHandler Unmarshal %s: %v", r.URL, err)
+		s3err.WriteErrorResponse(w, s3err.ErrMalformedXML, r)
+		return
+	}
+	var parts []*s3.CompletedPart
+	for _, part := range completeUpload.Parts {
+		parts = append(parts, &s3.CompletedPart{
+			PartNumber: aws.Int64(part.PartNumber),
+			ETag:       aws.String(part.ETag),
+		})
+	}
+
 	response, errCode := s3a.completeMultipartUpload(&s3.CompleteMultipartUploadInput{
-		Bucket:   aws.String(bucket),
-		Key:      objectKey(aws.String(object)),
-		UploadId: aws.String(uploadID),
+		Bucket:          aws.String(bucket),
+		Key:             objectKey(aws.String(object)),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
 	})
 
 	glog.V(2).Info("CompleteMultipartUploadHandler", string(s3err.EncodeXMLResponse(response)), errCode)
@@ -106,13 +141,6 @@ func (s3a *S3ApiServer) ListMultipartUploadsHandler(w http.ResponseWriter, r *ht
 		s3err.WriteErrorResponse(w, s3err.ErrInvalidMaxUploads, r)
 		return
 	}
-	if keyMarker != "" {
-		// Marker not common with prefix is not implemented.
-		if !strings.HasPrefix(keyMarker, prefix) {
-			s3err.WriteErrorResponse(w, s3err.ErrNotImplemented, r)
-			return
-		}
-	}
 
 	response, errCode := s3a.listMultipartUploads(&s3.ListMultipartUploadsInput{
 		Bucket:         aws.String(bucket),
@@ -131,8 +159,6 @@ func (s3a *S3ApiServer) ListMultipartUploadsHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
-	// TODO handle encodingType
-
 	writeSuccessResponseXML(w, response)
 }
 
@@ -174,9 +200,8 @@ func (s3a *S3ApiServer) PutObjectPartHandler(w http.ResponseWriter, r *http.Requ
 	bucket, _ := getBucketAndObject(r)
 
 	uploadID := r.URL.Query().Get("uploadId")
-	exists, err := s3a.exists(s3a.genUploadsFolder(bucket), uploadID, true)
-	if !exists {
-		s3err.WriteErrorResponse(w, s3err.ErrNoSuchUpload, r)
+	if errCode := s3a.setUploadServerSideEncryption(w, r, bucket, uploadID); errCode != s3err.ErrNone {
+		s3err.WriteErrorResponse(w, errCode, r)
 		return
 	}
 
@@ -207,6 +232,8 @@ func (s3a *S3ApiServer) PutObjectPartHandler(w http.ResponseWriter, r *http.Requ
 			s3err.WriteErrorResponse(w, s3ErrCode, r)
 			return
 		}
+	} else if getRequestAuthType(r) == authTypeStreamingSigned {
+		dataReader = newUnverifiedChunkedReader(r)
 	}
 	defer dataReader.Close()
 
@@ -238,6 +265,9 @@ func getBucketMultipartResources(values url.Values) (prefix, keyMarker, uploadID
 	delimiter = values.Get("delimiter")
 	if values.Get("max-uploads") != "" {
 		maxUploads, _ = strconv.Atoi(values.Get("max-uploads"))
+		if maxUploads > maxUploadsList {
+			maxUploads = maxUploadsList
+		}
 	} else {
 		maxUploads = maxUploadsList
 	}
@@ -251,6 +281,9 @@ func getObjectResources(values url.Values) (uploadID string, partNumberMarker, m
 	partNumberMarker, _ = strconv.Atoi(values.Get("part-number-marker"))
 	if values.Get("max-parts") != "" {
 		maxParts, _ = strconv.Atoi(values.Get("max-parts"))
+		if maxParts > maxPartsList {
+			maxParts = maxPartsList
+		}
 	} else {
 		maxParts = maxPartsList
 	}
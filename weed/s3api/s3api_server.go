@@ -5,6 +5,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/filer"
 	. "github.com/chrislusf/seaweedfs/weed/s3api/s3_constants"
 	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 	"net/http"
 	"strings"
 	"time"
@@ -19,14 +20,22 @@ type S3ApiServerOption struct {
 	FilerGrpcAddress string
 	Config           string
 	DomainName       string
+	Region           string
 	BucketsPath      string
 	GrpcDialOption   grpc.DialOption
 	AllowEmptyFolder bool
+
+	// abort incomplete multipart uploads after this many days, unless configured by the bucket lifecycle
+	AbortIncompleteMultipartUploadDays int
+
+	// break down the operation metrics by the bucket
+	MetricsPerBucket bool
 }
 
 type S3ApiServer struct {
-	option *S3ApiServerOption
-	iam    *IdentityAccessManagement
+	option        *S3ApiServerOption
+	iam           *IdentityAccessManagement
+	bucketEntries bucketEntryCache
 }
 
 func NewS3ApiServer(router *mux.Router, option *S3ApiServerOption) (s3ApiServer *S3ApiServer, err error) {
@@ -34,17 +43,21 @@ func NewS3ApiServer(router *mux.Router, option *S3ApiServerOption) (s3ApiServer
 		option: option,
 		iam:    NewIdentityAccessManagement(option),
 	}
+	s3ApiServer.iam.isGrantedByAcl = s3ApiServer.isGrantedByCannedAcl
 
 	s3ApiServer.registerRouter(router)
 
 	go s3ApiServer.subscribeMetaEvents("s3", filer.IamConfigDirecotry+"/"+filer.IamIdentityFile, time.Now().UnixNano())
 
+	go s3ApiServer.loopSweepIncompleteMultipartUploads()
+
 	return s3ApiServer, nil
 }
 
 func (s3a *S3ApiServer) registerRouter(router *mux.Router) {
 	// API Router
 	apiRouter := router.PathPrefix("/").Subrouter()
+	apiRouter.Use(request_id.Middleware)
 	var routers []*mux.Router
 	if s3a.option.DomainName != "" {
 		domainNames := strings.Split(s3a.option.DomainName, ",")
@@ -60,67 +73,105 @@ func (s3a *S3ApiServer) registerRouter(router *mux.Router) {
 	for _, bucket := range routers {
 
 		// HeadObject
-		bucket.Methods("HEAD").Path("/{object:.+}").HandlerFunc(track(s3a.iam.Auth(s3a.HeadObjectHandler, ACTION_READ), "GET"))
+		bucket.Methods("HEAD").Path("/{object:.+}").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.HeadObjectHandler, ACTION_READ), "GET", "HeadObject"))
 		// HeadBucket
-		bucket.Methods("HEAD").HandlerFunc(track(s3a.iam.Auth(s3a.HeadBucketHandler, ACTION_ADMIN), "GET"))
+		bucket.Methods("HEAD").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.HeadBucketHandler, ACTION_LIST), "GET", "HeadBucket"))
 
 		// CopyObjectPart
-		bucket.Methods("PUT").Path("/{object:.+}").HeadersRegexp("X-Amz-Copy-Source", `.*?(\/|%2F).*?`).HandlerFunc(track(s3a.iam.Auth(s3a.CopyObjectPartHandler, ACTION_WRITE), "PUT")).Queries("partNumber", "{partNumber:[0-9]+}", "uploadId", "{uploadId:.*}")
+		bucket.Methods("PUT").Path("/{object:.+}").HeadersRegexp("X-Amz-Copy-Source", `.*?(\/|%2F).*?`).HandlerFunc(s3a.track(s3a.iam.Auth(s3a.CopyObjectPartHandler, ACTION_WRITE), "PUT", "CopyObjectPart")).Queries("partNumber", "{partNumber:[0-9]+}", "uploadId", "{uploadId:.*}")
 		// PutObjectPart
-		bucket.Methods("PUT").Path("/{object:.+}").HandlerFunc(track(s3a.iam.Auth(s3a.PutObjectPartHandler, ACTION_WRITE), "PUT")).Queries("partNumber", "{partNumber:[0-9]+}", "uploadId", "{uploadId:.*}")
+		bucket.Methods("PUT").Path("/{object:.+}").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.PutObjectPartHandler, ACTION_WRITE), "PUT", "PutObjectPart")).Queries("partNumber", "{partNumber:[0-9]+}", "uploadId", "{uploadId:.*}")
 		// CompleteMultipartUpload
-		bucket.Methods("POST").Path("/{object:.+}").HandlerFunc(track(s3a.iam.Auth(s3a.CompleteMultipartUploadHandler, ACTION_WRITE), "POST")).Queries("uploadId", "{uploadId:.*}")
+		bucket.Methods("POST").Path("/{object:.+}").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.CompleteMultipartUploadHandler, ACTION_WRITE), "POST", "CompleteMultipartUpload")).Queries("uploadId", "{uploadId:.*}")
 		// NewMultipartUpload
-		bucket.Methods("POST").Path("/{object:.+}").HandlerFunc(track(s3a.iam.Auth(s3a.NewMultipartUploadHandler, ACTION_WRITE), "POST")).Queries("uploads", "")
+		bucket.Methods("POST").Path("/{object:.+}").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.NewMultipartUploadHandler, ACTION_WRITE), "POST", "NewMultipartUpload")).Queries("uploads", "")
 		// AbortMultipartUpload
-		bucket.Methods("DELETE").Path("/{object:.+}").HandlerFunc(track(s3a.iam.Auth(s3a.AbortMultipartUploadHandler, ACTION_WRITE), "DELETE")).Queries("uploadId", "{uploadId:.*}")
+		bucket.Methods("DELETE").Path("/{object:.+}").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.AbortMultipartUploadHandler, ACTION_WRITE), "DELETE", "AbortMultipartUpload")).Queries("uploadId", "{uploadId:.*}")
 		// ListObjectParts
-		bucket.Methods("GET").Path("/{object:.+}").HandlerFunc(track(s3a.iam.Auth(s3a.ListObjectPartsHandler, ACTION_READ), "GET")).Queries("uploadId", "{uploadId:.*}")
+		bucket.Methods("GET").Path("/{object:.+}").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.ListObjectPartsHandler, ACTION_READ), "GET", "ListObjectParts")).Queries("uploadId", "{uploadId:.*}")
 		// ListMultipartUploads
-		bucket.Methods("GET").HandlerFunc(track(s3a.iam.Auth(s3a.ListMultipartUploadsHandler, ACTION_READ), "GET")).Queries("uploads", "")
+		bucket.Methods("GET").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.ListMultipartUploadsHandler, ACTION_READ), "GET", "ListMultipartUploads")).Queries("uploads", "")
+
+		// GetBucketLifecycleConfiguration
+		bucket.Methods("GET").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.GetBucketLifecycleConfigurationHandler, ACTION_READ), "GET", "GetBucketLifecycleConfiguration")).Queries("lifecycle", "")
+		// PutBucketLifecycleConfiguration
+		bucket.Methods("PUT").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.PutBucketLifecycleConfigurationHandler, ACTION_ADMIN), "PUT", "PutBucketLifecycleConfiguration")).Queries("lifecycle", "")
+		// DeleteBucketLifecycle
+		bucket.Methods("DELETE").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.DeleteBucketLifecycleHandler, ACTION_ADMIN), "DELETE", "DeleteBucketLifecycle")).Queries("lifecycle", "")
+
+		// GetBucketWebsite
+		bucket.Methods("GET").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.GetBucketWebsiteHandler, ACTION_READ), "GET", "GetBucketWebsite")).Queries("website", "")
+		// PutBucketWebsite
+		bucket.Methods("PUT").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.PutBucketWebsiteHandler, ACTION_ADMIN), "PUT", "PutBucketWebsite")).Queries("website", "")
+		// DeleteBucketWebsite
+		bucket.Methods("DELETE").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.DeleteBucketWebsiteHandler, ACTION_ADMIN), "DELETE", "DeleteBucketWebsite")).Queries("website", "")
+
+		// GetBucketReplication
+		bucket.Methods("GET").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.GetBucketReplicationHandler, ACTION_READ), "GET", "GetBucketReplication")).Queries("replication", "")
+		// PutBucketReplication
+		bucket.Methods("PUT").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.PutBucketReplicationHandler, ACTION_ADMIN), "PUT", "PutBucketReplication")).Queries("replication", "")
+		// DeleteBucketReplication
+		bucket.Methods("DELETE").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.DeleteBucketReplicationHandler, ACTION_ADMIN), "DELETE", "DeleteBucketReplication")).Queries("replication", "")
+
+		// GetBucketEncryption
+		bucket.Methods("GET").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.GetBucketEncryptionHandler, ACTION_READ), "GET", "GetBucketEncryption")).Queries("encryption", "")
+		// PutBucketEncryption
+		bucket.Methods("PUT").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.PutBucketEncryptionHandler, ACTION_ADMIN), "PUT", "PutBucketEncryption")).Queries("encryption", "")
+		// DeleteBucketEncryption
+		bucket.Methods("DELETE").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.DeleteBucketEncryptionHandler, ACTION_ADMIN), "DELETE", "DeleteBucketEncryption")).Queries("encryption", "")
+
+		// GetBucketLocation
+		bucket.Methods("GET").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.GetBucketLocationHandler, ACTION_READ), "GET", "GetBucketLocation")).Queries("location", "")
+		// GetBucketVersioning
+		bucket.Methods("GET").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.GetBucketVersioningHandler, ACTION_READ), "GET", "GetBucketVersioning")).Queries("versioning", "")
+		// PutBucketVersioning
+		bucket.Methods("PUT").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.PutBucketVersioningHandler, ACTION_ADMIN), "PUT", "PutBucketVersioning")).Queries("versioning", "")
 
 		// GetObjectTagging
-		bucket.Methods("GET").Path("/{object:.+}").HandlerFunc(track(s3a.iam.Auth(s3a.GetObjectTaggingHandler, ACTION_READ), "GET")).Queries("tagging", "")
+		bucket.Methods("GET").Path("/{object:.+}").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.GetObjectTaggingHandler, ACTION_READ), "GET", "GetObjectTagging")).Queries("tagging", "")
 		// PutObjectTagging
-		bucket.Methods("PUT").Path("/{object:.+}").HandlerFunc(track(s3a.iam.Auth(s3a.PutObjectTaggingHandler, ACTION_TAGGING), "PUT")).Queries("tagging", "")
+		bucket.Methods("PUT").Path("/{object:.+}").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.PutObjectTaggingHandler, ACTION_TAGGING), "PUT", "PutObjectTagging")).Queries("tagging", "")
 		// DeleteObjectTagging
-		bucket.Methods("DELETE").Path("/{object:.+}").HandlerFunc(track(s3a.iam.Auth(s3a.DeleteObjectTaggingHandler, ACTION_TAGGING), "DELETE")).Queries("tagging", "")
+		bucket.Methods("DELETE").Path("/{object:.+}").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.DeleteObjectTaggingHandler, ACTION_TAGGING), "DELETE", "DeleteObjectTagging")).Queries("tagging", "")
+
+		// GetObjectAcl
+		bucket.Methods("GET").Path("/{object:.+}").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.GetObjectAclHandler, ACTION_READ), "GET", "GetObjectAcl")).Queries("acl", "")
+		// PutObjectAcl
+		bucket.Methods("PUT").Path("/{object:.+}").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.PutObjectAclHandler, ACTION_WRITE), "PUT", "PutObjectAcl")).Queries("acl", "")
+		// GetBucketAcl
+		bucket.Methods("GET").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.GetBucketAclHandler, ACTION_READ), "GET", "GetBucketAcl")).Queries("acl", "")
+		// PutBucketAcl
+		bucket.Methods("PUT").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.PutBucketAclHandler, ACTION_ADMIN), "PUT", "PutBucketAcl")).Queries("acl", "")
 
 		// CopyObject
-		bucket.Methods("PUT").Path("/{object:.+}").HeadersRegexp("X-Amz-Copy-Source", ".*?(\\/|%2F).*?").HandlerFunc(track(s3a.iam.Auth(s3a.CopyObjectHandler, ACTION_WRITE), "COPY"))
+		bucket.Methods("PUT").Path("/{object:.+}").HeadersRegexp("X-Amz-Copy-Source", ".*?(\\/|%2F).*?").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.CopyObjectHandler, ACTION_WRITE), "COPY", "CopyObject"))
 		// PutObject
-		bucket.Methods("PUT").Path("/{object:.+}").HandlerFunc(track(s3a.iam.Auth(s3a.PutObjectHandler, ACTION_WRITE), "PUT"))
+		bucket.Methods("PUT").Path("/{object:.+}").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.PutObjectHandler, ACTION_WRITE), "PUT", "PutObject"))
 		// PutBucket
-		bucket.Methods("PUT").HandlerFunc(track(s3a.iam.Auth(s3a.PutBucketHandler, ACTION_ADMIN), "PUT"))
+		bucket.Methods("PUT").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.PutBucketHandler, ACTION_ADMIN), "PUT", "PutBucket"))
 
 		// DeleteObject
-		bucket.Methods("DELETE").Path("/{object:.+}").HandlerFunc(track(s3a.iam.Auth(s3a.DeleteObjectHandler, ACTION_WRITE), "DELETE"))
+		bucket.Methods("DELETE").Path("/{object:.+}").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.DeleteObjectHandler, ACTION_WRITE), "DELETE", "DeleteObject"))
 		// DeleteBucket
-		bucket.Methods("DELETE").HandlerFunc(track(s3a.iam.Auth(s3a.DeleteBucketHandler, ACTION_WRITE), "DELETE"))
+		bucket.Methods("DELETE").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.DeleteBucketHandler, ACTION_WRITE), "DELETE", "DeleteBucket"))
 
 		// ListObjectsV2
-		bucket.Methods("GET").HandlerFunc(track(s3a.iam.Auth(s3a.ListObjectsV2Handler, ACTION_LIST), "LIST")).Queries("list-type", "2")
+		bucket.Methods("GET").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.ListObjectsV2Handler, ACTION_LIST), "LIST", "ListObjectsV2")).Queries("list-type", "2")
 		// GetObject, but directory listing is not supported
-		bucket.Methods("GET").Path("/{object:.+}").HandlerFunc(track(s3a.iam.Auth(s3a.GetObjectHandler, ACTION_READ), "GET"))
+		bucket.Methods("GET").Path("/{object:.+}").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.GetObjectHandler, ACTION_READ), "GET", "GetObject"))
 		// ListObjectsV1 (Legacy)
-		bucket.Methods("GET").HandlerFunc(track(s3a.iam.Auth(s3a.ListObjectsV1Handler, ACTION_LIST), "LIST"))
+		bucket.Methods("GET").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.ListObjectsV1Handler, ACTION_LIST), "LIST", "ListObjectsV1"))
 
 		// PostPolicy
-		bucket.Methods("POST").HeadersRegexp("Content-Type", "multipart/form-data*").HandlerFunc(track(s3a.iam.Auth(s3a.PostPolicyBucketHandler, ACTION_WRITE), "POST"))
+		bucket.Methods("POST").HeadersRegexp("Content-Type", "multipart/form-data*").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.PostPolicyBucketHandler, ACTION_WRITE), "POST", "PostPolicy"))
 
 		// DeleteMultipleObjects
-		bucket.Methods("POST").HandlerFunc(track(s3a.iam.Auth(s3a.DeleteMultipleObjectsHandler, ACTION_WRITE), "DELETE")).Queries("delete", "")
+		bucket.Methods("POST").HandlerFunc(s3a.track(s3a.iam.Auth(s3a.DeleteMultipleObjectsHandler, ACTION_WRITE), "DELETE", "DeleteMultipleObjects")).Queries("delete", "")
 		/*
 
 			// not implemented
-			// GetBucketLocation
-			bucket.Methods("GET").HandlerFunc(s3a.GetBucketLocationHandler).Queries("location", "")
 			// GetBucketPolicy
 			bucket.Methods("GET").HandlerFunc(s3a.GetBucketPolicyHandler).Queries("policy", "")
-			// GetObjectACL
-			bucket.Methods("GET").Path("/{object:.+}").HandlerFunc(s3a.GetObjectACLHandler).Queries("acl", "")
-			// GetBucketACL
-			bucket.Methods("GET").HandlerFunc(s3a.GetBucketACLHandler).Queries("acl", "")
 			// PutBucketPolicy
 			bucket.Methods("PUT").HandlerFunc(s3a.PutBucketPolicyHandler).Queries("policy", "")
 			// DeleteBucketPolicy
@@ -130,7 +181,7 @@ func (s3a *S3ApiServer) registerRouter(router *mux.Router) {
 	}
 
 	// ListBuckets
-	apiRouter.Methods("GET").Path("/").HandlerFunc(track(s3a.ListBucketsHandler, "LIST"))
+	apiRouter.Methods("GET").Path("/").HandlerFunc(s3a.track(s3a.ListBucketsHandler, "LIST", "ListBuckets"))
 
 	// NotFound
 	apiRouter.NotFoundHandler = http.HandlerFunc(s3err.NotFoundHandler)
@@ -0,0 +1,179 @@
+package s3api
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+const websiteErrorTemplate = `<html>
+<head><title>%d %s</title></head>
+<body>
+<h1>%d %s</h1>
+<ul>
+<li>Code: %s</li>
+<li>Message: %s</li>
+</ul>
+</body>
+</html>
+`
+
+// RegisterWebsiteRouter serves the buckets with a website configuration as static websites.
+// The bucket is the host name before the domain name, or the host name itself, or else the first path segment.
+func (s3a *S3ApiServer) RegisterWebsiteRouter(router *mux.Router) {
+	router.Methods("GET", "HEAD").HandlerFunc(s3a.track(s3a.WebsiteHandler, "WEBSITE", "GetWebsiteObject"))
+
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeWebsiteError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+	})
+	router.NotFoundHandler = router.MethodNotAllowedHandler
+}
+
+// WebsiteHandler serves the index and error documents, and the redirects, of the bucket website configuration
+func (s3a *S3ApiServer) WebsiteHandler(w http.ResponseWriter, r *http.Request) {
+
+	bucket, key, sitePrefix := s3a.websiteBucketAndKey(r)
+	if bucket == "" {
+		writeWebsiteError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.")
+		return
+	}
+
+	bucketEntry, err := s3a.getCachedBucketEntry(bucket)
+	if err != nil || bucketEntry == nil || !bucketEntry.IsDirectory {
+		writeWebsiteError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.")
+		return
+	}
+
+	website, err := loadWebsite(bucketEntry)
+	if err != nil {
+		glog.Errorf("WebsiteHandler %s: %v", bucket, err)
+		writeWebsiteError(w, http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again.")
+		return
+	}
+	if website == nil {
+		writeWebsiteError(w, http.StatusNotFound, "NoSuchWebsiteConfiguration", "The specified bucket does not have a website configuration.")
+		return
+	}
+
+	if sitePrefix != "" && r.URL.Path == "/"+bucket {
+		// the relative links of the website root need the trailing slash
+		http.Redirect(w, r, urlPathEscape("/"+sitePrefix), http.StatusFound)
+		return
+	}
+
+	if redirectAll := website.RedirectAllRequestsTo; redirectAll != nil {
+		http.Redirect(w, r, redirectUrl(r, redirectAll.Protocol, redirectAll.HostName, sitePrefix, key), http.StatusMovedPermanently)
+		return
+	}
+
+	if rule := website.matchRoutingRule(key, 0); rule != nil {
+		location, code := rule.redirectLocation(r, sitePrefix, key)
+		http.Redirect(w, r, location, code)
+		return
+	}
+
+	objectKey := key
+	if objectKey == "" || strings.HasSuffix(objectKey, "/") {
+		objectKey += website.IndexDocument.Suffix
+	}
+
+	if s3a.getWebsiteObject(bucket, objectKey) == nil {
+		// a folder without the trailing slash is redirected to the folder
+		if objectKey == key && s3a.getWebsiteObject(bucket, key+"/"+website.IndexDocument.Suffix) != nil {
+			http.Redirect(w, r, urlPathEscape("/"+sitePrefix+key+"/"), http.StatusFound)
+			return
+		}
+		if rule := website.matchRoutingRule(key, http.StatusNotFound); rule != nil {
+			location, code := rule.redirectLocation(r, sitePrefix, key)
+			http.Redirect(w, r, location, code)
+			return
+		}
+		s3a.writeWebsiteErrorDocument(w, r, bucket, website, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+
+	destUrl := fmt.Sprintf("http://%s%s/%s%s",
+		s3a.option.Filer, s3a.option.BucketsPath, bucket, urlPathEscape("/"+objectKey))
+
+	s3a.proxyToFiler(w, r, destUrl, passThroughResponse)
+}
+
+// websiteBucketAndKey finds the bucket from the host name, or else from the path.
+// The sitePrefix is the path to the website root, i.e., "bucket/" for the path style requests.
+func (s3a *S3ApiServer) websiteBucketAndKey(r *http.Request) (bucket, key, sitePrefix string) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+
+	if s3a.option.DomainName != "" {
+		for _, domainName := range strings.Split(s3a.option.DomainName, ",") {
+			if strings.HasSuffix(host, "."+domainName) {
+				return strings.TrimSuffix(host, "."+domainName), path, ""
+			}
+		}
+	}
+
+	if entry, err := s3a.getCachedBucketEntry(host); err == nil && entry != nil && entry.IsDirectory {
+		return host, path, ""
+	}
+
+	if i := strings.Index(path, "/"); i >= 0 {
+		return path[:i], path[i+1:], path[:i+1]
+	}
+	return path, "", path + "/"
+}
+
+// getWebsiteObject returns the object entry, or nil if not found
+func (s3a *S3ApiServer) getWebsiteObject(bucket, key string) *filer_pb.Entry {
+	fullPath := util.FullPath(fmt.Sprintf("%s/%s/%s", s3a.option.BucketsPath, bucket, key))
+	dir, name := fullPath.DirAndName()
+	entry, err := s3a.getEntry(dir, name)
+	if err != nil || entry == nil || entry.IsDirectory {
+		return nil
+	}
+	return entry
+}
+
+// writeWebsiteErrorDocument responds with the error document of the website configuration, if it exists
+func (s3a *S3ApiServer) writeWebsiteErrorDocument(w http.ResponseWriter, r *http.Request, bucket string, website *WebsiteConfiguration, statusCode int, code, message string) {
+	if website.ErrorDocument == nil || s3a.getWebsiteObject(bucket, website.ErrorDocument.Key) == nil {
+		writeWebsiteError(w, statusCode, code, message)
+		return
+	}
+
+	// the error document is read without the conditional or range headers of the original request
+	errorDocumentRequest, err := http.NewRequest(r.Method, r.URL.String(), nil)
+	if err != nil {
+		writeWebsiteError(w, statusCode, code, message)
+		return
+	}
+	errorDocumentRequest.RemoteAddr = r.RemoteAddr
+
+	destUrl := fmt.Sprintf("http://%s%s/%s%s",
+		s3a.option.Filer, s3a.option.BucketsPath, bucket, urlPathEscape("/"+website.ErrorDocument.Key))
+
+	s3a.proxyToFiler(w, errorDocumentRequest, destUrl, func(proxyResponse *http.Response, w http.ResponseWriter) {
+		for k, v := range proxyResponse.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(statusCode)
+		io.Copy(w, proxyResponse.Body)
+	})
+}
+
+func writeWebsiteError(w http.ResponseWriter, statusCode int, code, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statusCode)
+	statusText := http.StatusText(statusCode)
+	fmt.Fprintf(w, websiteErrorTemplate, statusCode, statusText, statusCode, statusText, code, message)
+}
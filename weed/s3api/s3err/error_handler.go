@@ -5,6 +5,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 	"github.com/gorilla/mux"
 	"net/http"
 	"strconv"
@@ -27,6 +28,11 @@ func WriteEmptyResponse(w http.ResponseWriter, statusCode int) {
 	WriteResponse(w, statusCode, []byte{}, mimeNone)
 }
 
+// ErrorCodeRecorder is implemented by the response writers keeping the error code for the metrics
+type ErrorCodeRecorder interface {
+	RecordErrorCode(code string)
+}
+
 func WriteErrorResponse(w http.ResponseWriter, errorCode ErrorCode, r *http.Request) {
 	vars := mux.Vars(r)
 	bucket := vars["bucket"]
@@ -36,20 +42,36 @@ func WriteErrorResponse(w http.ResponseWriter, errorCode ErrorCode, r *http.Requ
 	}
 
 	apiError := GetAPIError(errorCode)
-	errorResponse := getRESTErrorResponse(apiError, r.URL.Path, bucket, object)
+	if recorder, ok := w.(ErrorCodeRecorder); ok {
+		recorder.RecordErrorCode(apiError.Code)
+	}
+	if r.Method == http.MethodHead {
+		// the responses to HEAD requests have no body
+		WriteEmptyResponse(w, apiError.HTTPStatusCode)
+		return
+	}
+	errorResponse := getRESTErrorResponse(apiError, r.URL.Path, bucket, object, requestId(w))
 	encodedErrorResponse := EncodeXMLResponse(errorResponse)
 	WriteResponse(w, apiError.HTTPStatusCode, encodedErrorResponse, MimeXML)
 }
 
-func getRESTErrorResponse(err APIError, resource string, bucket, object string) RESTErrorResponse {
+func getRESTErrorResponse(err APIError, resource string, bucket, object, requestId string) RESTErrorResponse {
 	return RESTErrorResponse{
 		Code:       err.Code,
 		BucketName: bucket,
 		Key:        object,
 		Message:    err.Description,
 		Resource:   resource,
-		RequestID:  fmt.Sprintf("%d", time.Now().UnixNano()),
+		RequestID:  requestId,
+	}
+}
+
+// requestId is the request id set by the request id middleware, or else a new one
+func requestId(w http.ResponseWriter) string {
+	if id := w.Header().Get(request_id.Header); id != "" {
+		return id
 	}
+	return fmt.Sprintf("%d", time.Now().UnixNano())
 }
 
 // Encodes the response headers into XML format.
@@ -62,7 +84,7 @@ func EncodeXMLResponse(response interface{}) []byte {
 }
 
 func setCommonHeaders(w http.ResponseWriter) {
-	w.Header().Set("x-amz-request-id", fmt.Sprintf("%d", time.Now().UnixNano()))
+	w.Header().Set("x-amz-request-id", requestId(w))
 	w.Header().Set("Accept-Ranges", "bytes")
 }
 
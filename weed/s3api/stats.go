@@ -1,20 +1,26 @@
 package s3api
 
 import (
-	stats_collect "github.com/chrislusf/seaweedfs/weed/stats"
-	"github.com/chrislusf/seaweedfs/weed/util"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
+
+	"github.com/gorilla/mux"
+
+	stats_collect "github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
 type StatusRecorder struct {
 	http.ResponseWriter
-	Status int
+	Status    int
+	ErrorCode string
+	BytesOut  int64
 }
 
 func NewStatusResponseWriter(w http.ResponseWriter) *StatusRecorder {
-	return &StatusRecorder{w, http.StatusOK}
+	return &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
 }
 
 func (r *StatusRecorder) WriteHeader(status int) {
@@ -22,10 +28,33 @@ func (r *StatusRecorder) WriteHeader(status int) {
 	r.ResponseWriter.WriteHeader(status)
 }
 
+func (r *StatusRecorder) Write(data []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(data)
+	r.BytesOut += int64(n)
+	return n, err
+}
+
 func (r *StatusRecorder) Flush() {
 	r.ResponseWriter.(http.Flusher).Flush()
 }
 
+// RecordErrorCode keeps the S3 error code written by s3err.WriteErrorResponse
+func (r *StatusRecorder) RecordErrorCode(code string) {
+	r.ErrorCode = code
+}
+
+// bytesCounter counts the request body bytes read by the handler
+type bytesCounter struct {
+	io.ReadCloser
+	count int64
+}
+
+func (c *bytesCounter) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
 func track(f http.HandlerFunc, action string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Server", "SeaweedFS S3 "+util.VERSION)
@@ -36,3 +65,31 @@ func track(f http.HandlerFunc, action string) http.HandlerFunc {
 		stats_collect.S3RequestCounter.WithLabelValues(action, strconv.Itoa(recorder.Status)).Inc()
 	}
 }
+
+// track records the request type metrics, and the metrics of the S3 API operation,
+// optionally broken down by the bucket if MetricsPerBucket is set.
+func (s3a *S3ApiServer) track(f http.HandlerFunc, action, operation string) http.HandlerFunc {
+	return track(func(w http.ResponseWriter, r *http.Request) {
+		recorder := w.(*StatusRecorder)
+		var bytesIn *bytesCounter
+		if r.Body != nil {
+			bytesIn = &bytesCounter{ReadCloser: r.Body}
+			r.Body = bytesIn
+		}
+		start := time.Now()
+		f(recorder, r)
+
+		bucket := ""
+		if s3a.option.MetricsPerBucket {
+			bucket = mux.Vars(r)["bucket"]
+		}
+		stats_collect.S3OperationHistogram.WithLabelValues(operation, bucket).Observe(time.Since(start).Seconds())
+		stats_collect.S3OperationCounter.WithLabelValues(operation, bucket, strconv.Itoa(recorder.Status), recorder.ErrorCode).Inc()
+		if bytesIn != nil && bytesIn.count > 0 {
+			stats_collect.S3OperationBytesCounter.WithLabelValues(operation, bucket, "in").Add(float64(bytesIn.count))
+		}
+		if recorder.BytesOut > 0 {
+			stats_collect.S3OperationBytesCounter.WithLabelValues(operation, bucket, "out").Add(float64(recorder.BytesOut))
+		}
+	}, action)
+}
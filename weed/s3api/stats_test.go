@@ -0,0 +1,49 @@
+package s3api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+	stats_collect "github.com/chrislusf/seaweedfs/weed/stats"
+)
+
+func TestTrackOperation(t *testing.T) {
+	s3a := &S3ApiServer{option: &S3ApiServerOption{MetricsPerBucket: true}}
+
+	router := mux.NewRouter()
+	router.Methods("PUT").Path("/{bucket}/{object:.+}").HandlerFunc(s3a.track(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		s3err.WriteErrorResponse(w, s3err.ErrNoSuchBucket, r)
+	}, "PUT", "TestPutObject"))
+
+	r := httptest.NewRequest("PUT", "/metrics-bucket/a.txt", strings.NewReader("hello"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status %d", w.Code)
+	}
+	if count := testutil.ToFloat64(stats_collect.S3OperationCounter.WithLabelValues("TestPutObject", "metrics-bucket", "404", "NoSuchBucket")); count != 1 {
+		t.Errorf("operation count %v", count)
+	}
+	if bytesIn := testutil.ToFloat64(stats_collect.S3OperationBytesCounter.WithLabelValues("TestPutObject", "metrics-bucket", "in")); bytesIn != 5 {
+		t.Errorf("bytes in %v", bytesIn)
+	}
+	if bytesOut := testutil.ToFloat64(stats_collect.S3OperationBytesCounter.WithLabelValues("TestPutObject", "metrics-bucket", "out")); int(bytesOut) != w.Body.Len() {
+		t.Errorf("bytes out %v, expected %d", bytesOut, w.Body.Len())
+	}
+
+	// without the bucket label
+	s3a.option.MetricsPerBucket = false
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/metrics-bucket/a.txt", strings.NewReader("hello")))
+	if count := testutil.ToFloat64(stats_collect.S3OperationCounter.WithLabelValues("TestPutObject", "", "404", "NoSuchBucket")); count != 1 {
+		t.Errorf("operation count without bucket %v", count)
+	}
+}
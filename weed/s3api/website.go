@@ -0,0 +1,173 @@
+package s3api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+)
+
+const (
+	// the bucket website configuration is saved in the bucket entry extended attributes
+	s3WebsiteExtendedKey = "s3-website"
+
+	maxWebsiteRoutingRules = 50
+)
+
+// WebsiteConfiguration is the bucket website configuration, served by the website endpoint
+type WebsiteConfiguration struct {
+	XMLName               xml.Name              `xml:"http://s3.amazonaws.com/doc/2006-03-01/ WebsiteConfiguration"`
+	ErrorDocument         *WebsiteErrorDocument `xml:"ErrorDocument,omitempty"`
+	IndexDocument         *WebsiteIndexDocument `xml:"IndexDocument,omitempty"`
+	RedirectAllRequestsTo *WebsiteRedirectAll   `xml:"RedirectAllRequestsTo,omitempty"`
+	RoutingRules          *WebsiteRoutingRules  `xml:"RoutingRules,omitempty"`
+}
+
+type WebsiteErrorDocument struct {
+	Key string `xml:"Key"`
+}
+
+type WebsiteIndexDocument struct {
+	Suffix string `xml:"Suffix"`
+}
+
+type WebsiteRedirectAll struct {
+	HostName string `xml:"HostName"`
+	Protocol string `xml:"Protocol,omitempty"`
+}
+
+type WebsiteRoutingRules struct {
+	RoutingRule []WebsiteRoutingRule `xml:"RoutingRule"`
+}
+
+type WebsiteRoutingRule struct {
+	Condition *WebsiteCondition `xml:"Condition,omitempty"`
+	Redirect  WebsiteRedirect   `xml:"Redirect"`
+}
+
+type WebsiteCondition struct {
+	HttpErrorCodeReturnedEquals string `xml:"HttpErrorCodeReturnedEquals,omitempty"`
+	KeyPrefixEquals             string `xml:"KeyPrefixEquals,omitempty"`
+}
+
+type WebsiteRedirect struct {
+	HostName             string `xml:"HostName,omitempty"`
+	HttpRedirectCode     string `xml:"HttpRedirectCode,omitempty"`
+	Protocol             string `xml:"Protocol,omitempty"`
+	ReplaceKeyPrefixWith string `xml:"ReplaceKeyPrefixWith,omitempty"`
+	ReplaceKeyWith       string `xml:"ReplaceKeyWith,omitempty"`
+}
+
+// Validate checks the website configuration is complete and consistent
+func (wc *WebsiteConfiguration) Validate() s3err.ErrorCode {
+	if wc.RedirectAllRequestsTo != nil {
+		if wc.IndexDocument != nil || wc.ErrorDocument != nil || wc.RoutingRules != nil {
+			return s3err.ErrInvalidRequest
+		}
+		if wc.RedirectAllRequestsTo.HostName == "" || !isValidRedirectProtocol(wc.RedirectAllRequestsTo.Protocol) {
+			return s3err.ErrInvalidRequest
+		}
+		return s3err.ErrNone
+	}
+	if wc.IndexDocument == nil || wc.IndexDocument.Suffix == "" || strings.Contains(wc.IndexDocument.Suffix, "/") {
+		return s3err.ErrInvalidRequest
+	}
+	if wc.ErrorDocument != nil && wc.ErrorDocument.Key == "" {
+		return s3err.ErrInvalidRequest
+	}
+	if wc.RoutingRules != nil {
+		if len(wc.RoutingRules.RoutingRule) == 0 || len(wc.RoutingRules.RoutingRule) > maxWebsiteRoutingRules {
+			return s3err.ErrMalformedXML
+		}
+		for _, rule := range wc.RoutingRules.RoutingRule {
+			redirect := rule.Redirect
+			if redirect.ReplaceKeyPrefixWith != "" && redirect.ReplaceKeyWith != "" {
+				return s3err.ErrInvalidRequest
+			}
+			if !isValidRedirectProtocol(redirect.Protocol) {
+				return s3err.ErrInvalidRequest
+			}
+			if redirect.HttpRedirectCode != "" {
+				if code, err := strconv.Atoi(redirect.HttpRedirectCode); err != nil || code < 300 || code > 399 {
+					return s3err.ErrInvalidRequest
+				}
+			}
+			if rule.Condition != nil && rule.Condition.HttpErrorCodeReturnedEquals != "" {
+				if code, err := strconv.Atoi(rule.Condition.HttpErrorCodeReturnedEquals); err != nil || code < 400 || code > 599 {
+					return s3err.ErrInvalidRequest
+				}
+			}
+		}
+	}
+	return s3err.ErrNone
+}
+
+func isValidRedirectProtocol(protocol string) bool {
+	return protocol == "" || protocol == "http" || protocol == "https"
+}
+
+// matchRoutingRule returns the first routing rule for the key, or nil if none applies.
+// The httpErrorCode is 0 before the object is read, when only the rules without the error code condition apply.
+func (wc *WebsiteConfiguration) matchRoutingRule(key string, httpErrorCode int) *WebsiteRoutingRule {
+	if wc.RoutingRules == nil {
+		return nil
+	}
+	for i, rule := range wc.RoutingRules.RoutingRule {
+		var errorCodeCondition, keyPrefixCondition string
+		if rule.Condition != nil {
+			errorCodeCondition, keyPrefixCondition = rule.Condition.HttpErrorCodeReturnedEquals, rule.Condition.KeyPrefixEquals
+		}
+		if httpErrorCode == 0 && errorCodeCondition != "" {
+			continue
+		}
+		if httpErrorCode != 0 && errorCodeCondition != strconv.Itoa(httpErrorCode) {
+			continue
+		}
+		if !strings.HasPrefix(key, keyPrefixCondition) {
+			continue
+		}
+		return &wc.RoutingRules.RoutingRule[i]
+	}
+	return nil
+}
+
+// redirectLocation builds the redirect url and status code of the routing rule for the object key.
+// The sitePrefix is added to the new key when redirecting to the same host.
+func (rule *WebsiteRoutingRule) redirectLocation(r *http.Request, sitePrefix, key string) (location string, code int) {
+	redirect := rule.Redirect
+
+	newKey := key
+	if redirect.ReplaceKeyWith != "" {
+		newKey = redirect.ReplaceKeyWith
+	} else if redirect.ReplaceKeyPrefixWith != "" {
+		keyPrefix := ""
+		if rule.Condition != nil {
+			keyPrefix = rule.Condition.KeyPrefixEquals
+		}
+		newKey = redirect.ReplaceKeyPrefixWith + strings.TrimPrefix(key, keyPrefix)
+	}
+
+	code = http.StatusMovedPermanently
+	if redirect.HttpRedirectCode != "" {
+		code, _ = strconv.Atoi(redirect.HttpRedirectCode)
+	}
+
+	return redirectUrl(r, redirect.Protocol, redirect.HostName, sitePrefix, newKey), code
+}
+
+// redirectUrl builds the url to the key, defaulting to the protocol and host of the request
+func redirectUrl(r *http.Request, protocol, hostName, sitePrefix, key string) string {
+	if protocol == "" {
+		protocol = "http"
+		if r.TLS != nil {
+			protocol = "https"
+		}
+	}
+	if hostName == "" {
+		hostName = r.Host
+		key = sitePrefix + key
+	}
+	return protocol + "://" + hostName + urlPathEscape("/"+key)
+}
@@ -0,0 +1,89 @@
+package s3api
+
+import (
+	"encoding/xml"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chrislusf/seaweedfs/weed/s3api/s3err"
+)
+
+func TestWebsiteRoutingRules(t *testing.T) {
+
+	input := `<WebsiteConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <IndexDocument>
+    <Suffix>index.html</Suffix>
+  </IndexDocument>
+  <ErrorDocument>
+    <Key>error.html</Key>
+  </ErrorDocument>
+  <RoutingRules>
+    <RoutingRule>
+      <Condition>
+        <KeyPrefixEquals>docs/</KeyPrefixEquals>
+      </Condition>
+      <Redirect>
+        <ReplaceKeyPrefixWith>documents/</ReplaceKeyPrefixWith>
+      </Redirect>
+    </RoutingRule>
+    <RoutingRule>
+      <Condition>
+        <HttpErrorCodeReturnedEquals>404</HttpErrorCodeReturnedEquals>
+      </Condition>
+      <Redirect>
+        <HostName>example.com</HostName>
+        <Protocol>https</Protocol>
+        <HttpRedirectCode>302</HttpRedirectCode>
+        <ReplaceKeyWith>missing.html</ReplaceKeyWith>
+      </Redirect>
+    </RoutingRule>
+  </RoutingRules>
+</WebsiteConfiguration>`
+
+	website := &WebsiteConfiguration{}
+	assert.Nil(t, xml.Unmarshal([]byte(input), website))
+	assert.Equal(t, s3err.ErrNone, website.Validate())
+
+	r := httptest.NewRequest("GET", "http://localhost:8000/site/docs/a.html", nil)
+
+	rule := website.matchRoutingRule("docs/a.html", 0)
+	assert.NotNil(t, rule)
+	location, code := rule.redirectLocation(r, "site/", "docs/a.html")
+	assert.Equal(t, "http://localhost:8000/site/documents/a.html", location)
+	assert.Equal(t, 301, code)
+
+	assert.Nil(t, website.matchRoutingRule("about.html", 0))
+
+	rule = website.matchRoutingRule("about.html", 404)
+	assert.NotNil(t, rule)
+	location, code = rule.redirectLocation(r, "site/", "about.html")
+	assert.Equal(t, "https://example.com/missing.html", location)
+	assert.Equal(t, 302, code)
+
+	assert.Nil(t, website.matchRoutingRule("about.html", 403))
+
+}
+
+func TestWebsiteValidate(t *testing.T) {
+
+	assert.Equal(t, s3err.ErrInvalidRequest, (&WebsiteConfiguration{}).Validate())
+	assert.Equal(t, s3err.ErrInvalidRequest, (&WebsiteConfiguration{
+		IndexDocument: &WebsiteIndexDocument{Suffix: "a/index.html"},
+	}).Validate())
+	assert.Equal(t, s3err.ErrNone, (&WebsiteConfiguration{
+		RedirectAllRequestsTo: &WebsiteRedirectAll{HostName: "example.com"},
+	}).Validate())
+	assert.Equal(t, s3err.ErrInvalidRequest, (&WebsiteConfiguration{
+		IndexDocument:         &WebsiteIndexDocument{Suffix: "index.html"},
+		RedirectAllRequestsTo: &WebsiteRedirectAll{HostName: "example.com"},
+	}).Validate())
+	assert.Equal(t, s3err.ErrInvalidRequest, (&WebsiteConfiguration{
+		IndexDocument: &WebsiteIndexDocument{Suffix: "index.html"},
+		RoutingRules: &WebsiteRoutingRules{RoutingRule: []WebsiteRoutingRule{
+			{Redirect: WebsiteRedirect{HttpRedirectCode: "200"}},
+		}},
+	}).Validate())
+
+}
@@ -6,8 +6,11 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
 var (
@@ -41,32 +44,129 @@ https://github.com/pkieltyka/jwtauth/blob/master/jwtauth.go
 
 */
 type Guard struct {
+	sync.RWMutex
 	whiteList           []string
-	SigningKey          SigningKey
-	ExpiresAfterSec     int
-	ReadSigningKey      SigningKey
-	ReadExpiresAfterSec int
-
-	isWriteActive bool
+	signingKey          SigningKey
+	expiresAfterSec     int
+	readSigningKey      SigningKey
+	readExpiresAfterSec int
+
+	// the keys replaced by Update are still accepted until the jwt signed by them expire
+	previousSigningKey     SigningKey
+	previousReadSigningKey SigningKey
+	keysUpdatedAt          time.Time
+
+	// signs the urls to read from the public port of the volume servers
+	urlSigningKey SigningKey
 }
 
 func NewGuard(whiteList []string, signingKey string, expiresAfterSec int, readSigningKey string, readExpiresAfterSec int) *Guard {
 	g := &Guard{
 		whiteList:           whiteList,
-		SigningKey:          SigningKey(signingKey),
-		ExpiresAfterSec:     expiresAfterSec,
-		ReadSigningKey:      SigningKey(readSigningKey),
-		ReadExpiresAfterSec: readExpiresAfterSec,
+		signingKey:          SigningKey(signingKey),
+		expiresAfterSec:     expiresAfterSec,
+		readSigningKey:      SigningKey(readSigningKey),
+		readExpiresAfterSec: readExpiresAfterSec,
 	}
-	g.isWriteActive = len(g.whiteList) != 0 || len(g.SigningKey) != 0
 	return g
 }
 
-func (g *Guard) WhiteList(f http.HandlerFunc) http.HandlerFunc {
-	if !g.isWriteActive {
-		//if no security needed, just skip all checking
-		return f
+// LoadGuard creates the guard with the white list option, and the white list and jwt signing keys in security.toml
+func LoadGuard(config util.Configuration, whiteList []string) *Guard {
+	g := &Guard{}
+	if err := g.Reload(config, whiteList); err != nil {
+		glog.Fatalf("%v", err)
+	}
+	return g
+}
+
+// Reload updates the guard with the white list option, and the white list, the jwt signing keys and the url signing key in security.toml
+func (g *Guard) Reload(config util.Configuration, whiteList []string) error {
+	config.SetDefault("jwt.signing.expires_after_seconds", 10)
+	config.SetDefault("jwt.signing.read.expires_after_seconds", 60)
+	allWhiteList := append([]string{}, whiteList...)
+	for _, ip := range strings.Split(config.GetString("guard.white_list"), ",") {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			allWhiteList = append(allWhiteList, ip)
+		}
+	}
+	if err := g.Update(allWhiteList,
+		config.GetString("jwt.signing.key"), config.GetInt("jwt.signing.expires_after_seconds"),
+		config.GetString("jwt.signing.read.key"), config.GetInt("jwt.signing.read.expires_after_seconds")); err != nil {
+		return err
+	}
+	g.Lock()
+	g.urlSigningKey = SigningKey(config.GetString("url.signing.key"))
+	g.Unlock()
+	return nil
+}
+
+// Update replaces the white list and the jwt signing keys, e.g., after the configuration is reloaded.
+// The white list is validated first, and nothing is changed if it is invalid.
+func (g *Guard) Update(whiteList []string, signingKey string, expiresAfterSec int, readSigningKey string, readExpiresAfterSec int) error {
+	for _, ip := range whiteList {
+		if strings.Contains(ip, "/") {
+			if _, _, err := net.ParseCIDR(ip); err != nil {
+				return fmt.Errorf("white list %s: %v", ip, err)
+			}
+		}
+	}
+
+	g.Lock()
+	defer g.Unlock()
+	if string(g.signingKey) != signingKey || string(g.readSigningKey) != readSigningKey {
+		g.previousSigningKey, g.previousReadSigningKey = g.signingKey, g.readSigningKey
+		g.keysUpdatedAt = time.Now()
 	}
+	g.whiteList = whiteList
+	g.signingKey = SigningKey(signingKey)
+	g.expiresAfterSec = expiresAfterSec
+	g.readSigningKey = SigningKey(readSigningKey)
+	g.readExpiresAfterSec = readExpiresAfterSec
+	return nil
+}
+
+// GetSigningKey returns the key to sign the jwt for writes, and the seconds until the jwt expires
+func (g *Guard) GetSigningKey() (SigningKey, int) {
+	g.RLock()
+	defer g.RUnlock()
+	return g.signingKey, g.expiresAfterSec
+}
+
+// GetReadSigningKey returns the key to sign the jwt for reads, and the seconds until the jwt expires
+func (g *Guard) GetReadSigningKey() (SigningKey, int) {
+	g.RLock()
+	defer g.RUnlock()
+	return g.readSigningKey, g.readExpiresAfterSec
+}
+
+// GetUrlSigningKey returns the key of the signed urls, which are not required if it is empty
+func (g *Guard) GetUrlSigningKey() SigningKey {
+	g.RLock()
+	defer g.RUnlock()
+	return g.urlSigningKey
+}
+
+// VerifyingKeys returns the keys to verify the jwt for writes or reads.
+// No jwt is required if it is empty.
+func (g *Guard) VerifyingKeys(isWrite bool) (keys []SigningKey) {
+	g.RLock()
+	defer g.RUnlock()
+	key, previousKey, expiresAfterSec := g.readSigningKey, g.previousReadSigningKey, g.readExpiresAfterSec
+	if isWrite {
+		key, previousKey, expiresAfterSec = g.signingKey, g.previousSigningKey, g.expiresAfterSec
+	}
+	if len(key) == 0 {
+		return nil
+	}
+	keys = append(keys, key)
+	if len(previousKey) != 0 && time.Since(g.keysUpdatedAt) < time.Duration(expiresAfterSec)*time.Second {
+		keys = append(keys, previousKey)
+	}
+	return keys
+}
+
+func (g *Guard) WhiteList(f http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := g.checkWhiteList(w, r); err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
@@ -91,7 +191,10 @@ func GetActualRemoteHost(r *http.Request) (host string, err error) {
 }
 
 func (g *Guard) checkWhiteList(w http.ResponseWriter, r *http.Request) error {
+	g.RLock()
+	defer g.RUnlock()
 	if len(g.whiteList) == 0 {
+		//if no security needed, just skip all checking
 		return nil
 	}
 
@@ -0,0 +1,49 @@
+package security
+
+import (
+	"testing"
+)
+
+func TestGuardUpdateKeepsPreviousKey(t *testing.T) {
+	g := NewGuard(nil, "k1", 10, "", 0)
+
+	if keys := g.VerifyingKeys(false); len(keys) != 0 {
+		t.Errorf("read jwt should not be required: %v", keys)
+	}
+
+	if err := g.Update(nil, "k2", 10, "", 0); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	keys := g.VerifyingKeys(true)
+	if len(keys) != 2 || string(keys[0]) != "k2" || string(keys[1]) != "k1" {
+		t.Errorf("unexpected keys after rotation: %q", keys)
+	}
+	if key, expiresAfterSec := g.GetSigningKey(); string(key) != "k2" || expiresAfterSec != 10 {
+		t.Errorf("unexpected signing key %q %d", key, expiresAfterSec)
+	}
+
+	if err := g.Update(nil, "k3", 0, "", 0); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if keys := g.VerifyingKeys(true); len(keys) != 1 || string(keys[0]) != "k3" {
+		t.Errorf("the previous key should not be accepted without expiration: %q", keys)
+	}
+
+	if err := g.Update(nil, "", 0, "", 0); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if keys := g.VerifyingKeys(true); len(keys) != 0 {
+		t.Errorf("jwt should not be required after removing the key: %q", keys)
+	}
+}
+
+func TestGuardUpdateInvalidWhiteList(t *testing.T) {
+	g := NewGuard([]string{"10.0.0.0/8"}, "", 0, "", 0)
+
+	if err := g.Update([]string{"10.0.0.0/99"}, "k1", 10, "", 0); err == nil {
+		t.Fatalf("invalid white list should be rejected")
+	}
+	if key, _ := g.GetSigningKey(); len(key) != 0 {
+		t.Errorf("nothing should change with an invalid white list, got key %q", key)
+	}
+}
@@ -0,0 +1,67 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signed urls allow reading a file from the public port of the volume servers until the expiry,
+// e.g., for volume servers behind a CDN. The file id and the expiry are signed by the url.signing.key
+// in security.toml, and appended to the url as "?expires=<unix seconds>&signature=<signature>".
+
+const (
+	SignedUrlExpiresParam   = "expires"
+	SignedUrlSignatureParam = "signature"
+)
+
+var (
+	ErrSignedUrlMissing = errors.New("missing url signature")
+	ErrSignedUrlExpired = errors.New("url signature expired")
+	ErrSignedUrlInvalid = errors.New("invalid url signature")
+)
+
+// SignFileIdUrl returns the query parameters to read the file id until the expiry
+func SignFileIdUrl(signingKey SigningKey, fileId string, expiresAt time.Time) url.Values {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	return url.Values{
+		SignedUrlExpiresParam:   []string{expires},
+		SignedUrlSignatureParam: []string{signFileIdUrl(signingKey, fileId, expires)},
+	}
+}
+
+// VerifyFileIdUrl checks the signature and the expiry of the url to read the file id
+func VerifyFileIdUrl(signingKey SigningKey, fileId string, query url.Values, now time.Time) error {
+	expires, signature := query.Get(SignedUrlExpiresParam), query.Get(SignedUrlSignatureParam)
+	if expires == "" || signature == "" {
+		return ErrSignedUrlMissing
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%v: expires %s", ErrSignedUrlInvalid, expires)
+	}
+	if !hmac.Equal([]byte(signature), []byte(signFileIdUrl(signingKey, fileId, expires))) {
+		return ErrSignedUrlInvalid
+	}
+	if now.Unix() > expiresAt {
+		return ErrSignedUrlExpired
+	}
+	return nil
+}
+
+// signFileIdUrl signs the file id without the delta suffix, so that the signature applies to all the urls of the file,
+// e.g., "/3,01637037d6", "/3/01637037d6/name.jpg", and "/3,01637037d6_1"
+func signFileIdUrl(signingKey SigningKey, fileId string, expires string) string {
+	if sepIndex := strings.LastIndex(fileId, "_"); sepIndex > 0 {
+		fileId = fileId[:sepIndex]
+	}
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(fileId + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,39 @@
+package security
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignedUrl(t *testing.T) {
+	key := SigningKey("secret")
+	now := time.Unix(1600000000, 0)
+	query := SignFileIdUrl(key, "3,01637037d6", now.Add(time.Hour))
+
+	if err := VerifyFileIdUrl(key, "3,01637037d6", query, now); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	// the same signature for the delta of the file
+	if err := VerifyFileIdUrl(key, "3,01637037d6_1", query, now); err != nil {
+		t.Errorf("verify with delta: %v", err)
+	}
+	if err := VerifyFileIdUrl(key, "3,01637037d6", query, now.Add(2*time.Hour)); err != ErrSignedUrlExpired {
+		t.Errorf("expired: %v", err)
+	}
+	if err := VerifyFileIdUrl(key, "3,01637037d7", query, now); err != ErrSignedUrlInvalid {
+		t.Errorf("other file: %v", err)
+	}
+	if err := VerifyFileIdUrl(SigningKey("other"), "3,01637037d6", query, now); err != ErrSignedUrlInvalid {
+		t.Errorf("other key: %v", err)
+	}
+
+	// extending the expiry invalidates the signature
+	query.Set(SignedUrlExpiresParam, "1700000000")
+	if err := VerifyFileIdUrl(key, "3,01637037d6", query, now); err != ErrSignedUrlInvalid {
+		t.Errorf("modified expiry: %v", err)
+	}
+	query.Del(SignedUrlSignatureParam)
+	if err := VerifyFileIdUrl(key, "3,01637037d6", query, now); err != ErrSignedUrlMissing {
+		t.Errorf("missing signature: %v", err)
+	}
+}
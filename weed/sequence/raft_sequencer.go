@@ -0,0 +1,124 @@
+package sequence
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+)
+
+const DefaultRaftReserveCount uint64 = 10000
+
+// RaftSequencer hands out the file keys reserved in ranges through the raft log of the masters.
+// A new leader continues after the keys reserved by the previous leaders,
+// instead of waiting for the volume servers to report their max file keys.
+type RaftSequencer struct {
+	// serializes the reservations
+	sequenceLock sync.Mutex
+
+	// guards the counter and the reserved, also changed when the raft log is applied
+	stateLock sync.Mutex
+	counter   uint64
+	reserved  uint64 // the max file key reserved by this master
+
+	reserveCount uint64
+	reserve      func(maxFileKey uint64) error
+
+	// tells the reservations of this process apart from the ones of the same master before a restart,
+	// which are replayed from the raft log and only skipped
+	incarnation string
+}
+
+func NewRaftSequencer(reserveCount uint64) *RaftSequencer {
+	if reserveCount == 0 {
+		reserveCount = DefaultRaftReserveCount
+	}
+	return &RaftSequencer{
+		counter:      1,
+		reserveCount: reserveCount,
+		incarnation:  fmt.Sprintf("%x-%x", time.Now().UnixNano(), rand.Uint32()),
+	}
+}
+
+// SetReserveFunc sets the function to reserve the file keys up to maxFileKey through the raft log.
+// Once committed, the log entry is applied with ApplyReservation on all the masters.
+func (m *RaftSequencer) SetReserveFunc(fn func(maxFileKey uint64) error) {
+	m.reserve = fn
+}
+
+func (m *RaftSequencer) NextFileId(count uint64) uint64 {
+	m.sequenceLock.Lock()
+	defer m.sequenceLock.Unlock()
+
+	for {
+		m.stateLock.Lock()
+		ret := m.counter
+		if ret+count-1 <= m.reserved {
+			m.counter += count
+			m.stateLock.Unlock()
+			return ret
+		}
+		m.stateLock.Unlock()
+
+		if m.reserve == nil {
+			glog.Errorf("file keys from %d are not reserved", ret)
+			return 0
+		}
+		if err := m.reserve(ret + count - 1 + m.reserveCount); err != nil {
+			glog.Errorf("reserve file keys from %d: %v", ret, err)
+			return 0
+		}
+		// check again in case the counter is moved by other masters or the volume servers
+	}
+}
+
+// Incarnation is the reserver of the file keys reserved by this process
+func (m *RaftSequencer) Incarnation() string {
+	return m.incarnation
+}
+
+// ApplyReservation applies the file keys reserved in the raft log. Only the keys reserved by this process
+// are handed out by it, and the keys reserved by the other masters, or by this master before a restart, are skipped.
+func (m *RaftSequencer) ApplyReservation(maxFileKey uint64, reserver string) {
+	if reserver == m.incarnation {
+		m.SetReserved(maxFileKey)
+	} else {
+		m.SetMax(maxFileKey)
+	}
+}
+
+// SetReserved records the file keys reserved by this master
+func (m *RaftSequencer) SetReserved(maxFileKey uint64) {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	if m.reserved < maxFileKey {
+		m.reserved = maxFileKey
+	}
+}
+
+// SetMax skips the file keys seen on the volume servers, or reserved by the other masters
+func (m *RaftSequencer) SetMax(seenValue uint64) {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	if m.counter <= seenValue {
+		m.counter = seenValue + 1
+	}
+}
+
+func (m *RaftSequencer) Peek() uint64 {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	return m.counter
+}
+
+// GetMaxReserved is the max file key reserved in the raft log, kept in the raft snapshot
+func (m *RaftSequencer) GetMaxReserved() uint64 {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	if m.counter-1 > m.reserved {
+		return m.counter - 1
+	}
+	return m.reserved
+}
@@ -0,0 +1,91 @@
+package sequence
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRaftSequencerReserve(t *testing.T) {
+	var reserved []uint64
+	seq := NewRaftSequencer(100)
+	seq.SetReserveFunc(func(maxFileKey uint64) error {
+		reserved = append(reserved, maxFileKey)
+		seq.SetReserved(maxFileKey)
+		return nil
+	})
+
+	if key := seq.NextFileId(10); key != 1 {
+		t.Errorf("first key %d", key)
+	}
+	if key := seq.NextFileId(10); key != 11 {
+		t.Errorf("second key %d", key)
+	}
+	if len(reserved) != 1 || reserved[0] != 110 {
+		t.Errorf("reserved %v", reserved)
+	}
+
+	// a larger count than the reserve count
+	if key := seq.NextFileId(500); key != 21 {
+		t.Errorf("large key %d", key)
+	}
+	if len(reserved) != 2 || reserved[1] != 620 {
+		t.Errorf("reserved %v", reserved)
+	}
+}
+
+func TestRaftSequencerFollowOtherLeader(t *testing.T) {
+	seq := NewRaftSequencer(100)
+	seq.SetReserveFunc(func(maxFileKey uint64) error {
+		seq.SetReserved(maxFileKey)
+		return nil
+	})
+	seq.NextFileId(1)
+
+	// another leader reserved up to 1000 while this master was a follower
+	seq.SetMax(1000)
+	if key := seq.NextFileId(1); key != 1001 {
+		t.Errorf("key %d after other leader", key)
+	}
+	if max := seq.GetMaxReserved(); max != 1101 {
+		t.Errorf("max reserved %d", max)
+	}
+}
+
+func TestRaftSequencerNotLeader(t *testing.T) {
+	seq := NewRaftSequencer(100)
+	seq.SetReserveFunc(func(maxFileKey uint64) error {
+		return fmt.Errorf("not leader")
+	})
+	if key := seq.NextFileId(1); key != 0 {
+		t.Errorf("key %d without reservation", key)
+	}
+	if key := seq.Peek(); key != 1 {
+		t.Errorf("counter moved to %d", key)
+	}
+}
+
+func TestRaftSequencerReplayAfterRestart(t *testing.T) {
+	var log []uint64
+	seq := NewRaftSequencer(100)
+	seq.SetReserveFunc(func(maxFileKey uint64) error {
+		log = append(log, maxFileKey)
+		seq.ApplyReservation(maxFileKey, seq.Incarnation())
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		seq.NextFileId(60)
+	}
+
+	// the same master restarts, and replays its own reservations from the raft log
+	restarted := NewRaftSequencer(100)
+	for _, maxFileKey := range log {
+		restarted.ApplyReservation(maxFileKey, seq.Incarnation())
+	}
+	restarted.SetReserveFunc(func(maxFileKey uint64) error {
+		restarted.ApplyReservation(maxFileKey, restarted.Incarnation())
+		return nil
+	})
+	if key := restarted.NextFileId(1); key <= log[len(log)-1] {
+		t.Errorf("key %d already reserved before the restart, up to %d", key, log[len(log)-1])
+	}
+}
@@ -0,0 +1,36 @@
+package weed_server
+
+import (
+	"context"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/cache_pb"
+	"github.com/chrislusf/seaweedfs/weed/util/chunk_cache"
+)
+
+// CacheServer shares one chunk cache with the mount and webdav processes on the same host
+type CacheServer struct {
+	chunkCache *chunk_cache.TieredChunkCache
+}
+
+func NewCacheServer(chunkCache *chunk_cache.TieredChunkCache) *CacheServer {
+	return &CacheServer{
+		chunkCache: chunkCache,
+	}
+}
+
+func (cs *CacheServer) GetChunk(ctx context.Context, req *cache_pb.GetChunkRequest) (*cache_pb.GetChunkResponse, error) {
+	return &cache_pb.GetChunkResponse{
+		Data: cs.chunkCache.GetChunk(req.FileId, req.MinSize),
+	}, nil
+}
+
+func (cs *CacheServer) GetChunkSlice(ctx context.Context, req *cache_pb.GetChunkSliceRequest) (*cache_pb.GetChunkResponse, error) {
+	return &cache_pb.GetChunkResponse{
+		Data: cs.chunkCache.GetChunkSlice(req.FileId, req.Offset, req.Length),
+	}, nil
+}
+
+func (cs *CacheServer) SetChunk(ctx context.Context, req *cache_pb.SetChunkRequest) (*cache_pb.SetChunkResponse, error) {
+	cs.chunkCache.SetChunk(req.FileId, req.Data)
+	return &cache_pb.SetChunkResponse{}, nil
+}
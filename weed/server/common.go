@@ -223,8 +223,13 @@ func handleStaticResources2(r *mux.Router) {
 	r.PathPrefix("/seaweedfsstatic/").Handler(http.StripPrefix("/seaweedfsstatic", http.FileServer(http.FS(StaticFS))))
 }
 
+// adjustHeaderContentDisposition sets the Content-Disposition with the file name,
+// unless the Content-Disposition was specified at upload time and the "dl" parameter is not set.
 func adjustHeaderContentDisposition(w http.ResponseWriter, r *http.Request, filename string) {
 	if filename != "" {
+		if w.Header().Get("Content-Disposition") != "" && r.FormValue("dl") == "" {
+			return
+		}
 		contentDisposition := "inline"
 		if r.FormValue("dl") != "" {
 			if dl, _ := strconv.ParseBool(r.FormValue("dl")); dl {
@@ -235,8 +240,55 @@ func adjustHeaderContentDisposition(w http.ResponseWriter, r *http.Request, file
 	}
 }
 
+const (
+	// the checksum of the file content, as "<algorithm>=<hex value>", e.g., "crc32c=4a17b156" or "md5=..."
+	SeaweedChecksumHeader = "X-Seaweed-Checksum"
+	// the time to live of the file, e.g., "3d", and the remaining seconds before it expires
+	SeaweedTtlHeader          = "X-Seaweed-Ttl"
+	SeaweedTtlRemainingHeader = "X-Seaweed-Ttl-Remaining"
+)
+
+func setChecksumHeader(w http.ResponseWriter, algorithm string, checksum []byte) {
+	if len(checksum) > 0 {
+		w.Header().Set(SeaweedChecksumHeader, fmt.Sprintf("%s=%x", algorithm, checksum))
+	}
+}
+
+// setTtlHeaders sets the ttl and the remaining seconds, which is 0 after the expiry
+func setTtlHeaders(w http.ResponseWriter, ttl string, expiresAt time.Time, now time.Time) {
+	w.Header().Set(SeaweedTtlHeader, ttl)
+	remaining := int64(expiresAt.Sub(now) / time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+	w.Header().Set(SeaweedTtlRemainingHeader, strconv.FormatInt(remaining, 10))
+}
+
+var responseHeaderOverrides = map[string]string{
+	"response-cache-control":       "Cache-Control",
+	"response-content-disposition": "Content-Disposition",
+	"response-content-encoding":    "Content-Encoding",
+	"response-content-language":    "Content-Language",
+	"response-content-type":        "Content-Type",
+	"response-expires":             "Expires",
+}
+
+// adjustHeaderResponseOverrides overrides the response headers by the "response-*" parameters,
+// e.g., "response-content-disposition=attachment" or "response-content-type=text/plain"
+func adjustHeaderResponseOverrides(w http.ResponseWriter, r *http.Request) {
+	for parameter, header := range responseHeaderOverrides {
+		if value := r.FormValue(parameter); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+}
+
 func processRangeRequest(r *http.Request, w http.ResponseWriter, totalSize int64, mimeType string, writeFn func(writer io.Writer, offset int64, size int64) error) {
 	rangeReq := r.Header.Get("Range")
+	if rangeReq != "" && !checkIfRange(r, w.Header()) {
+		// the content has changed since the If-Range validator, send the whole content
+		rangeReq = ""
+	}
 
 	if rangeReq == "" {
 		w.Header().Set("Content-Length", strconv.FormatInt(totalSize, 10))
@@ -251,17 +303,21 @@ func processRangeRequest(r *http.Request, w http.ResponseWriter, totalSize int64
 	//mostly copy from src/pkg/net/http/fs.go
 	ranges, err := parseRange(rangeReq, totalSize)
 	if err != nil {
+		if err == errNoOverlap {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", totalSize))
+		}
 		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
 		return
 	}
-	if sumRangesSize(ranges) > totalSize {
+	if len(ranges) == 0 || sumRangesSize(ranges) > totalSize {
 		// The total number of bytes in all the ranges
 		// is larger than the size of the file by
 		// itself, so this is probably an attack, or a
 		// dumb client.  Ignore the range request.
-		return
-	}
-	if len(ranges) == 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(totalSize, 10))
+		if err := writeFn(w, 0, totalSize); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 	if len(ranges) == 1 {
@@ -289,13 +345,7 @@ func processRangeRequest(r *http.Request, w http.ResponseWriter, totalSize int64
 		return
 	}
 
-	// process multiple ranges
-	for _, ra := range ranges {
-		if ra.start > totalSize {
-			http.Error(w, "Out of Range", http.StatusRequestedRangeNotSatisfiable)
-			return
-		}
-	}
+	// process multiple ranges, each part only reads the chunks covering its range
 	sendSize := rangesMIMESize(ranges, mimeType, totalSize)
 	pr, pw := io.Pipe()
 	mw := multipart.NewWriter(pw)
@@ -1,8 +1,11 @@
 package weed_server
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseURL(t *testing.T) {
@@ -29,3 +32,66 @@ func TestParseURL(t *testing.T) {
 		}
 	}
 }
+
+func TestAdjustHeaderContentDisposition(t *testing.T) {
+	r := httptest.NewRequest("GET", "/dir/file.txt", nil)
+	w := httptest.NewRecorder()
+	adjustHeaderContentDisposition(w, r, "file.txt")
+	if cd := w.Header().Get("Content-Disposition"); cd != `inline; filename="file.txt"` {
+		t.Errorf("unexpected Content-Disposition: %s", cd)
+	}
+
+	// the Content-Disposition specified at upload time
+	w = httptest.NewRecorder()
+	w.Header().Set("Content-Disposition", `attachment; filename="report.pdf"`)
+	adjustHeaderContentDisposition(w, r, "file.txt")
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="report.pdf"` {
+		t.Errorf("unexpected Content-Disposition: %s", cd)
+	}
+
+	r = httptest.NewRequest("GET", "/dir/file.txt?dl=true", nil)
+	adjustHeaderContentDisposition(w, r, "file.txt")
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="file.txt"` {
+		t.Errorf("unexpected Content-Disposition: %s", cd)
+	}
+}
+
+func TestAdjustHeaderResponseOverrides(t *testing.T) {
+	r := httptest.NewRequest("GET", "/dir/file.txt?response-content-type=text%2Fcsv&response-content-disposition=attachment", nil)
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Cache-Control", "max-age=60")
+	adjustHeaderResponseOverrides(w, r)
+	expected := http.Header{
+		"Content-Type":        []string{"text/csv"},
+		"Content-Disposition": []string{"attachment"},
+		"Cache-Control":       []string{"max-age=60"},
+	}
+	for k := range expected {
+		if w.Header().Get(k) != expected.Get(k) {
+			t.Errorf("unexpected %s: %s", k, w.Header().Get(k))
+		}
+	}
+}
+
+func TestSetTtlHeaders(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+
+	w := httptest.NewRecorder()
+	setTtlHeaders(w, "1h", now.Add(90*time.Second), now)
+	if ttl, remaining := w.Header().Get(SeaweedTtlHeader), w.Header().Get(SeaweedTtlRemainingHeader); ttl != "1h" || remaining != "90" {
+		t.Errorf("unexpected ttl %s remaining %s", ttl, remaining)
+	}
+
+	w = httptest.NewRecorder()
+	setTtlHeaders(w, "1h", now.Add(-time.Second), now)
+	if remaining := w.Header().Get(SeaweedTtlRemainingHeader); remaining != "0" {
+		t.Errorf("unexpected remaining %s after the expiry", remaining)
+	}
+
+	w = httptest.NewRecorder()
+	setChecksumHeader(w, "crc32c", []byte{0x4a, 0x17, 0xb1, 0x56})
+	if checksum := w.Header().Get(SeaweedChecksumHeader); checksum != "crc32c=4a17b156" {
+		t.Errorf("unexpected checksum %s", checksum)
+	}
+}
@@ -92,21 +92,33 @@ func (fs *FilerServer) LookupVolume(ctx context.Context, req *filer_pb.LookupVol
 		LocationsMap: make(map[string]*filer_pb.Locations),
 	}
 
+	var vids []uint32
 	for _, vidString := range req.VolumeIds {
 		vid, err := strconv.Atoi(vidString)
 		if err != nil {
 			glog.V(1).Infof("Unknown volume id %d", vid)
 			return nil, err
 		}
+		vids = append(vids, uint32(vid))
+	}
+	// look up all the volumes not yet known to the filer with one request
+	if err := fs.filer.MasterClient.LookupVolumeIds(vids); err != nil {
+		glog.V(1).Infof("lookup volumes %v: %v", req.VolumeIds, err)
+	}
+
+	for i, vidString := range req.VolumeIds {
+		vid := vids[i]
 		var locs []*filer_pb.Location
-		locations, found := fs.filer.MasterClient.GetLocations(uint32(vid))
+		locations, found := fs.filer.MasterClient.GetLocations(vid)
 		if !found {
 			continue
 		}
 		for _, loc := range locations {
 			locs = append(locs, &filer_pb.Location{
-				Url:       loc.Url,
-				PublicUrl: loc.PublicUrl,
+				Url:        loc.Url,
+				PublicUrl:  loc.PublicUrl,
+				DataCenter: loc.DataCenter,
+				Rack:       loc.Rack,
 			})
 		}
 		resp.LocationsMap[vidString] = &filer_pb.Locations{
@@ -149,7 +161,7 @@ func (fs *FilerServer) CreateEntry(ctx context.Context, req *filer_pb.CreateEntr
 	createErr := fs.filer.CreateEntry(ctx, newEntry, req.OExcl, req.IsFromOtherCluster, req.Signatures)
 
 	if createErr == nil {
-		fs.filer.DeleteChunks(garbage)
+		fs.filer.DeleteChunksNotRecursive(garbage)
 	} else {
 		glog.V(3).Infof("CreateEntry %s: %v", filepath.Join(req.Directory, req.Entry.Name), createErr)
 		resp.Error = createErr.Error()
@@ -167,6 +179,9 @@ func (fs *FilerServer) UpdateEntry(ctx context.Context, req *filer_pb.UpdateEntr
 	if err != nil {
 		return &filer_pb.UpdateEntryResponse{}, fmt.Errorf("not found %s: %v", fullpath, err)
 	}
+	if !hasExpectedChunks(entry, req.ExpectedChunkFileIds) {
+		return &filer_pb.UpdateEntryResponse{}, fmt.Errorf("update %s: %v", fullpath, filer_pb.ErrChunksChanged)
+	}
 
 	chunks, garbage, err2 := fs.cleanupChunks(fullpath, entry, req.Entry)
 	if err2 != nil {
@@ -181,7 +196,7 @@ func (fs *FilerServer) UpdateEntry(ctx context.Context, req *filer_pb.UpdateEntr
 	}
 
 	if err = fs.filer.UpdateEntry(ctx, entry, newEntry); err == nil {
-		fs.filer.DeleteChunks(garbage)
+		fs.filer.DeleteChunksNotRecursive(garbage)
 
 		fs.filer.NotifyUpdateEvent(ctx, entry, newEntry, true, req.IsFromOtherCluster, req.Signatures)
 
@@ -192,6 +207,22 @@ func (fs *FilerServer) UpdateEntry(ctx context.Context, req *filer_pb.UpdateEntr
 	return &filer_pb.UpdateEntryResponse{}, err
 }
 
+// hasExpectedChunks checks the chunks of the entry to update, if the update expects them
+func hasExpectedChunks(entry *filer.Entry, expectedChunkFileIds []string) bool {
+	if len(expectedChunkFileIds) == 0 {
+		return true
+	}
+	if len(entry.Chunks) != len(expectedChunkFileIds) {
+		return false
+	}
+	for i, chunk := range entry.Chunks {
+		if chunk.GetFileIdString() != expectedChunkFileIds[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (fs *FilerServer) cleanupChunks(fullpath string, existingEntry *filer.Entry, newEntry *filer_pb.Entry) (chunks, garbage []*filer_pb.FileChunk, err error) {
 
 	// remove old chunks if not included in the new ones
@@ -248,7 +279,8 @@ func (fs *FilerServer) AppendToEntry(ctx context.Context, req *filer_pb.AppendTo
 			},
 		}
 	} else {
-		offset = int64(filer.TotalSize(entry.Chunks))
+		// the file size includes the trailing holes not stored as chunks
+		offset = int64(entry.Size())
 	}
 
 	for _, chunk := range req.Chunks {
@@ -382,10 +414,56 @@ func (fs *FilerServer) Statistics(ctx context.Context, req *filer_pb.StatisticsR
 	}, nil
 }
 
+// the backends failing to report in time are reported with the errors
+const storeStatisticsTimeout = 10 * time.Second
+
+// FilerStoreStatistics reports the calls to the filer stores since the filer started, and the state of their backends
+func (fs *FilerServer) FilerStoreStatistics(ctx context.Context, req *filer_pb.FilerStoreStatisticsRequest) (*filer_pb.FilerStoreStatisticsResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, storeStatisticsTimeout)
+	defer cancel()
+	resp := &filer_pb.FilerStoreStatisticsResponse{}
+	for _, storeStatistics := range fs.filer.Store.Statistics(ctx) {
+		store := &filer_pb.FilerStoreStatisticsResponse_StoreStatistics{
+			StoreId:      storeStatistics.StoreId,
+			Location:     storeStatistics.Location,
+			Name:         storeStatistics.Name,
+			SinceNs:      storeStatistics.Since.UnixNano(),
+			Operations:   make(map[string]*filer_pb.FilerStoreStatisticsResponse_OperationStatistics),
+			BackendError: storeStatistics.BackendError,
+		}
+		for operation, op := range storeStatistics.Operations {
+			store.Operations[operation] = &filer_pb.FilerStoreStatisticsResponse_OperationStatistics{
+				Count:        op.Count,
+				Errors:       op.Errors,
+				AvgLatencyMs: op.AvgLatencyMs,
+				MaxLatencyMs: op.MaxLatencyMs,
+			}
+		}
+		if backend := storeStatistics.Backend; backend != nil {
+			store.Backend = &filer_pb.FilerStoreStatisticsResponse_BackendStatistics{
+				MaxOpenConnections:  backend.MaxOpenConnections,
+				OpenConnections:     backend.OpenConnections,
+				InUseConnections:    backend.InUseConnections,
+				IdleConnections:     backend.IdleConnections,
+				WaitCount:           backend.WaitCount,
+				WaitDurationMs:      backend.WaitDurationMs,
+				Timeouts:            backend.Timeouts,
+				EstimatedEntryCount: backend.EstimatedEntryCount,
+			}
+		}
+		if breaker := storeStatistics.Breaker; breaker != nil {
+			store.IsBreakerOpen = breaker.IsOpen
+			store.BreakerConsecutiveFailures = breaker.ConsecutiveFailures
+		}
+		resp.Stores = append(resp.Stores, store)
+	}
+	return resp, nil
+}
+
 func (fs *FilerServer) GetFilerConfiguration(ctx context.Context, req *filer_pb.GetFilerConfigurationRequest) (resp *filer_pb.GetFilerConfigurationResponse, err error) {
 
 	t := &filer_pb.GetFilerConfigurationResponse{
-		Masters:            fs.option.Masters,
+		Masters:            util.ResolveServerAddresses(fs.option.Masters),
 		Collection:         fs.option.Collection,
 		Replication:        fs.option.DefaultReplication,
 		MaxMb:              uint32(fs.option.MaxMB),
@@ -409,7 +487,7 @@ func (fs *FilerServer) KeepConnected(stream filer_pb.SeaweedFiler_KeepConnectedS
 		return err
 	}
 
-	clientName := fmt.Sprintf("%s:%d", req.Name, req.GrpcPort)
+	clientName := util.JoinHostPort(req.Name, int(req.GrpcPort))
 	m := make(map[string]bool)
 	for _, tp := range req.Resources {
 		m[tp] = true
@@ -0,0 +1,187 @@
+package weed_server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/chrislusf/seaweedfs/weed/filer"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// at most this many entries received together are written to the filer store in one transaction
+const createEntriesBatchSize = 256
+
+// CreateEntries creates the streamed entries, and responds to each request in the same order.
+// The requests already received are created together in one filer store transaction.
+// The entry content smaller than the configured saveToFilerLimit is saved in the filer store,
+// and larger content is uploaded to volume servers, split into chunks of the configured maxMB.
+func (fs *FilerServer) CreateEntries(stream filer_pb.SeaweedFiler_CreateEntriesServer) error {
+
+	ctx := stream.Context()
+	requests := make(chan *filer_pb.CreateEntryRequest, createEntriesBatchSize)
+	var recvErr error
+	go func() {
+		defer close(requests)
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				if err != io.EOF {
+					recvErr = err
+				}
+				return
+			}
+			select {
+			case requests <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for req := range requests {
+		batch := []*filer_pb.CreateEntryRequest{req}
+	drain:
+		for len(batch) < createEntriesBatchSize {
+			select {
+			case req, ok := <-requests:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, req)
+			default:
+				break drain
+			}
+		}
+
+		for _, resp := range fs.createEntries(ctx, batch) {
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+		}
+	}
+
+	return recvErr
+}
+
+func (fs *FilerServer) createEntries(ctx context.Context, batch []*filer_pb.CreateEntryRequest) (responses []*filer_pb.CreateEntryResponse) {
+
+	glog.V(4).Infof("CreateEntries %d entries", len(batch))
+
+	responses = make([]*filer_pb.CreateEntryResponse, len(batch))
+	var creations []*filer.EntryCreation
+	var prepared []int
+	garbages := make([][]*filer_pb.FileChunk, len(batch))
+	uploads := make([][]*filer_pb.FileChunk, len(batch))
+	for i, req := range batch {
+		responses[i] = &filer_pb.CreateEntryResponse{}
+		newEntry, garbage, uploaded, err := fs.prepareEntryToCreate(ctx, req)
+		if err != nil {
+			glog.V(3).Infof("CreateEntries %s: %v", req.Directory, err)
+			responses[i].Error = err.Error()
+			continue
+		}
+		creations = append(creations, &filer.EntryCreation{
+			Entry:              newEntry,
+			OExcl:              req.OExcl,
+			IsFromOtherCluster: req.IsFromOtherCluster,
+			Signatures:         req.Signatures,
+		})
+		prepared = append(prepared, i)
+		garbages[i], uploads[i] = garbage, uploaded
+	}
+	if len(creations) == 0 {
+		return
+	}
+
+	errs, err := fs.filer.CreateEntries(ctx, creations)
+	if err != nil {
+		glog.Errorf("CreateEntries: %v", err)
+	}
+	for j, i := range prepared {
+		createErr := errs[j]
+		if createErr == nil {
+			createErr = err
+		}
+		if createErr != nil {
+			glog.V(3).Infof("CreateEntries %s: %v", creations[j].Entry.FullPath, createErr)
+			responses[i].Error = createErr.Error()
+			fs.filer.DeleteChunksNotRecursive(uploads[i])
+			continue
+		}
+		fs.filer.DeleteChunksNotRecursive(garbages[i])
+	}
+
+	return
+}
+
+// prepareEntryToCreate uploads the entry content as chunks if too large to save in the filer store, and cleans up the chunks.
+// The uploaded chunks, including the new chunk manifests, are to delete if the entry fails to create.
+func (fs *FilerServer) prepareEntryToCreate(ctx context.Context, req *filer_pb.CreateEntryRequest) (newEntry *filer.Entry, garbage, uploaded []*filer_pb.FileChunk, err error) {
+
+	if req.Entry == nil {
+		return nil, nil, nil, fmt.Errorf("missing entry")
+	}
+	fullpath := util.Join(req.Directory, req.Entry.Name)
+
+	contentSize := int64(len(req.Entry.Content))
+	if contentSize > 0 && contentSize >= fs.saveToFilerLimit(fullpath) && !strings.HasPrefix(fullpath, filer.DirectoryEtcRoot) {
+		if len(req.Entry.Chunks) > 0 {
+			return nil, nil, nil, fmt.Errorf("%s has both content and chunks", fullpath)
+		}
+		attr := req.Entry.Attributes
+		so, err := fs.detectStorageOption(fullpath, attr.GetCollection(), attr.GetReplication(), attr.GetTtlSec(), attr.GetDiskType(), "", "")
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s: %v", fullpath, err)
+		}
+		chunkSize := int64(fs.maxMB(fullpath)) * 1024 * 1024
+		if chunkSize <= 0 {
+			chunkSize = contentSize
+		}
+		var chunks []*filer_pb.FileChunk
+		for offset := int64(0); offset < contentSize; offset += chunkSize {
+			stop := offset + chunkSize
+			if stop > contentSize {
+				stop = contentSize
+			}
+			data := req.Entry.Content[offset:stop]
+			chunk, err := fs.dataToChunk(ctx, req.Entry.Name, attr.GetMime(), data, offset, so)
+			if err != nil {
+				fs.filer.DeleteChunks(chunks)
+				return nil, nil, nil, fmt.Errorf("upload %s content: %v", fullpath, err)
+			}
+			if chunk != nil {
+				chunks = append(chunks, chunk)
+			}
+		}
+		if attr != nil && attr.Md5 == nil {
+			attr.Md5 = util.Md5(req.Entry.Content)
+		}
+		if attr != nil {
+			// the all-zero chunks are not stored
+			attr.FileSize = uint64(contentSize)
+		}
+		req.Entry.Chunks = chunks
+		req.Entry.Content = nil
+		uploaded = chunks
+	}
+	if len(req.Entry.Content) > 0 && req.Entry.Attributes != nil && req.Entry.Attributes.Md5 == nil {
+		req.Entry.Attributes.Md5 = util.Md5(req.Entry.Content)
+	}
+
+	inputManifestChunks, _ := filer.SeparateManifestChunks(req.Entry.Chunks)
+	chunks, garbage, err := fs.cleanupChunks(fullpath, nil, req.Entry)
+	if err != nil {
+		fs.filer.DeleteChunksNotRecursive(uploaded)
+		return nil, nil, nil, fmt.Errorf("cleanupChunks %s: %v", fullpath, err)
+	}
+	manifestChunks, _ := filer.SeparateManifestChunks(chunks)
+	uploaded = append(uploaded, filer.DoMinusChunks(manifestChunks, inputManifestChunks)...)
+
+	newEntry = filer.FromPbEntry(req.Directory, req.Entry)
+	newEntry.Chunks = chunks
+	return newEntry, garbage, uploaded, nil
+}
@@ -0,0 +1,271 @@
+package weed_server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+const (
+	// the usage is kept up to date by the metadata events, and only re-collected to correct any drift
+	LogicalVolumeUsageReconcileInterval = time.Hour
+	LogicalVolumesLockName              = "logical_volumes"
+)
+
+func (fs *FilerServer) CreateLogicalVolume(ctx context.Context, req *filer_pb.CreateLogicalVolumeRequest) (*filer_pb.CreateLogicalVolumeResponse, error) {
+
+	if err := checkLogicalVolumeName(req.Name); err != nil {
+		return nil, err
+	}
+	if req.CapacityBytes == 0 {
+		return nil, fmt.Errorf("logical volume %s: capacity is required", req.Name)
+	}
+	if req.Replication != "" {
+		if _, err := super_block.NewReplicaPlacementFromString(req.Replication); err != nil {
+			return nil, fmt.Errorf("logical volume %s replication %s: %v", req.Name, req.Replication, err)
+		}
+	}
+
+	diskType := string(types.ToDiskType(req.DiskType))
+
+	defer fs.lockLogicalVolumes()()
+
+	volumePath := fs.filer.LogicalVolumePath(req.Name)
+	locationPrefix := string(volumePath) + "/"
+
+	fc, err := fs.filer.ReadFilerConf()
+	if err != nil {
+		return nil, fmt.Errorf("read filer conf: %v", err)
+	}
+
+	// creating an existing volume with the same settings succeeds, so that the call can be retried
+	if entry, err := fs.filer.FindEntry(ctx, volumePath); err == nil {
+		capacity, isLogicalVolume := filer.GetLogicalVolumeCapacity(entry)
+		if !isLogicalVolume {
+			return nil, fmt.Errorf("logical volume %s: %s already exists", req.Name, volumePath)
+		}
+		placement := findLocationConf(fc, locationPrefix)
+		if capacity != req.CapacityBytes || placement.Collection != req.Collection || placement.Replication != req.Replication || placement.DiskType != diskType {
+			return nil, fmt.Errorf("logical volume %s already exists with different capacity or placement", req.Name)
+		}
+		return &filer_pb.CreateLogicalVolumeResponse{
+			Volume: fs.toLogicalVolume(entry),
+		}, nil
+	} else if err != filer_pb.ErrNotFound {
+		return nil, fmt.Errorf("find logical volume %s: %v", req.Name, err)
+	}
+
+	if req.Collection != "" || req.Replication != "" || diskType != "" {
+		if err = fc.AddLocationConf(&filer_pb.FilerConf_PathConf{
+			LocationPrefix: locationPrefix,
+			Collection:     req.Collection,
+			Replication:    req.Replication,
+			DiskType:       diskType,
+		}); err != nil {
+			return nil, fmt.Errorf("add logical volume %s placement: %v", req.Name, err)
+		}
+		if err = fs.filer.SaveFilerConf(ctx, fc); err != nil {
+			return nil, fmt.Errorf("save filer conf: %v", err)
+		}
+	}
+
+	// the placement is saved first, so that no file is written to the volume before its placement applies
+	now := time.Now()
+	entry := &filer.Entry{
+		FullPath: volumePath,
+		Attr: filer.Attr{
+			Mtime:  now,
+			Crtime: now,
+			Mode:   os.ModeDir | 0777,
+			Uid:    filer.OS_UID,
+			Gid:    filer.OS_GID,
+		},
+	}
+	filer.SetLogicalVolumeCapacity(entry, req.CapacityBytes)
+	if err := fs.filer.CreateEntry(ctx, entry, true, false, nil); err != nil {
+		if findLocationConf(fc, locationPrefix).LocationPrefix != "" {
+			fc.DeleteLocationConf(locationPrefix)
+			if undoErr := fs.filer.SaveFilerConf(ctx, fc); undoErr != nil {
+				glog.Errorf("undo logical volume %s placement: %v", req.Name, undoErr)
+			}
+		}
+		return nil, fmt.Errorf("create logical volume %s: %v", req.Name, err)
+	}
+	fs.filer.SetLogicalVolumeStat(filer.LogicalVolumeName(req.Name), req.CapacityBytes)
+
+	glog.V(0).Infof("created logical volume %s of %d bytes", volumePath, req.CapacityBytes)
+
+	return &filer_pb.CreateLogicalVolumeResponse{
+		Volume: fs.toLogicalVolume(entry),
+	}, nil
+}
+
+func (fs *FilerServer) ExpandLogicalVolume(ctx context.Context, req *filer_pb.ExpandLogicalVolumeRequest) (*filer_pb.ExpandLogicalVolumeResponse, error) {
+
+	if err := checkLogicalVolumeName(req.Name); err != nil {
+		return nil, err
+	}
+
+	defer fs.lockLogicalVolumes()()
+
+	entry, err := fs.findLogicalVolume(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	capacity, _ := filer.GetLogicalVolumeCapacity(entry)
+	if req.CapacityBytes < capacity {
+		return nil, fmt.Errorf("logical volume %s: can not shrink from %d to %d bytes", req.Name, capacity, req.CapacityBytes)
+	}
+	if req.CapacityBytes > capacity {
+		filer.SetLogicalVolumeCapacity(entry, req.CapacityBytes)
+		entry.Mtime = time.Now()
+		if err = fs.filer.CreateEntry(ctx, entry, false, false, nil); err != nil {
+			return nil, fmt.Errorf("expand logical volume %s: %v", req.Name, err)
+		}
+		fs.filer.SetLogicalVolumeStat(filer.LogicalVolumeName(req.Name), req.CapacityBytes)
+		glog.V(0).Infof("expanded logical volume %s from %d to %d bytes", entry.FullPath, capacity, req.CapacityBytes)
+	}
+
+	return &filer_pb.ExpandLogicalVolumeResponse{
+		Volume: fs.toLogicalVolume(entry),
+	}, nil
+}
+
+func (fs *FilerServer) DeleteLogicalVolume(ctx context.Context, req *filer_pb.DeleteLogicalVolumeRequest) (*filer_pb.DeleteLogicalVolumeResponse, error) {
+
+	if err := checkLogicalVolumeName(req.Name); err != nil {
+		return nil, err
+	}
+
+	defer fs.lockLogicalVolumes()()
+
+	// deleting a missing volume succeeds, so that the call can be retried
+	volumePath := fs.filer.LogicalVolumePath(req.Name)
+	if _, err := fs.findLogicalVolume(ctx, req.Name); err == nil {
+		if err = fs.filer.DeleteEntryMetaAndData(ctx, volumePath, true, false, true, false, nil); err != nil {
+			return nil, fmt.Errorf("delete logical volume %s: %v", req.Name, err)
+		}
+		glog.V(0).Infof("deleted logical volume %s", volumePath)
+	} else if err != filer_pb.ErrNotFound {
+		return nil, err
+	}
+	fs.filer.DeleteLogicalVolumeStat(filer.LogicalVolumeName(req.Name))
+
+	locationPrefix := string(volumePath) + "/"
+	fc, err := fs.filer.ReadFilerConf()
+	if err != nil {
+		return nil, fmt.Errorf("read filer conf: %v", err)
+	}
+	if findLocationConf(fc, locationPrefix).LocationPrefix != "" {
+		fc.DeleteLocationConf(locationPrefix)
+		if err = fs.filer.SaveFilerConf(ctx, fc); err != nil {
+			return nil, fmt.Errorf("save filer conf: %v", err)
+		}
+	}
+
+	return &filer_pb.DeleteLogicalVolumeResponse{}, nil
+}
+
+func (fs *FilerServer) GetLogicalVolume(ctx context.Context, req *filer_pb.GetLogicalVolumeRequest) (*filer_pb.GetLogicalVolumeResponse, error) {
+
+	if err := checkLogicalVolumeName(req.Name); err != nil {
+		return nil, err
+	}
+
+	entry, err := fs.findLogicalVolume(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &filer_pb.GetLogicalVolumeResponse{
+		Volume: fs.toLogicalVolume(entry),
+	}, nil
+}
+
+// GetCapacity reports the storage capacity of the volume servers, for the placement attributes if specified
+func (fs *FilerServer) GetCapacity(ctx context.Context, req *filer_pb.GetCapacityRequest) (*filer_pb.GetCapacityResponse, error) {
+
+	statistics, err := fs.Statistics(ctx, &filer_pb.StatisticsRequest{
+		Collection:  req.Collection,
+		Replication: req.Replication,
+		DiskType:    req.DiskType,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &filer_pb.GetCapacityResponse{
+		TotalBytes:       statistics.TotalSize,
+		UsedBytes:        statistics.UsedSize,
+		ProvisionedBytes: fs.filer.ProvisionedLogicalVolumeCapacity(),
+	}
+	if statistics.TotalSize > statistics.UsedSize {
+		resp.AvailableBytes = statistics.TotalSize - statistics.UsedSize
+	}
+
+	return resp, nil
+}
+
+// lockLogicalVolumes serializes the provisioning within this filer, and across the filers by the lock leased from the master
+func (fs *FilerServer) lockLogicalVolumes() (unlock func()) {
+	fs.logicalVolumesLock.Lock()
+	fs.logicalVolumesLocker.RequestLock(util.JoinHostPort(fs.option.Host, int(fs.option.Port)))
+	return func() {
+		fs.logicalVolumesLocker.ReleaseLock()
+		fs.logicalVolumesLock.Unlock()
+	}
+}
+
+func (fs *FilerServer) findLogicalVolume(ctx context.Context, name string) (*filer.Entry, error) {
+	entry, err := fs.filer.FindEntry(ctx, fs.filer.LogicalVolumePath(name))
+	if err != nil {
+		return nil, err
+	}
+	if _, isLogicalVolume := filer.GetLogicalVolumeCapacity(entry); !isLogicalVolume {
+		return nil, filer_pb.ErrNotFound
+	}
+	return entry, nil
+}
+
+func (fs *FilerServer) toLogicalVolume(entry *filer.Entry) *filer_pb.LogicalVolume {
+	capacity, _ := filer.GetLogicalVolumeCapacity(entry)
+	stat, _ := fs.filer.GetLogicalVolumeStat(filer.LogicalVolumeName(entry.Name()))
+	rule := fs.filer.FilerConf.MatchStorageRule(string(entry.FullPath) + "/")
+	return &filer_pb.LogicalVolume{
+		Name:          entry.Name(),
+		Path:          string(entry.FullPath),
+		CapacityBytes: capacity,
+		UsedBytes:     stat.UsedBytes,
+		FileCount:     stat.FileCount,
+		Collection:    rule.Collection,
+		Replication:   rule.Replication,
+		DiskType:      rule.DiskType,
+	}
+}
+
+// findLocationConf returns the configuration of exactly the location prefix, or an empty one
+func findLocationConf(fc *filer.FilerConf, locationPrefix string) *filer_pb.FilerConf_PathConf {
+	for _, location := range fc.ToProto().Locations {
+		if location.LocationPrefix == locationPrefix {
+			return location
+		}
+	}
+	return &filer_pb.FilerConf_PathConf{}
+}
+
+func checkLogicalVolumeName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return fmt.Errorf("invalid logical volume name %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package weed_server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chrislusf/seaweedfs/weed/filer"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// ApplyMutations applies a batch of entry creations, updates and deletions, all or none,
+// e.g., to create the object and mark the multipart upload as completed together
+func (fs *FilerServer) ApplyMutations(ctx context.Context, req *filer_pb.ApplyMutationsRequest) (*filer_pb.ApplyMutationsResponse, error) {
+
+	glog.V(4).Infof("ApplyMutations %d mutations", len(req.Mutations))
+
+	var mutations []*filer.Mutation
+	var garbage, uploaded []*filer_pb.FileChunk
+	for i, m := range req.Mutations {
+		mutation, mutationGarbage, err := fs.toMutation(ctx, m)
+		if mutation != nil {
+			uploaded = append(uploaded, uploadedManifestChunks(m, mutation)...)
+		}
+		if err != nil {
+			fs.filer.DeleteChunksNotRecursive(uploaded)
+			return &filer_pb.ApplyMutationsResponse{Error: fmt.Sprintf("mutation %d: %v", i, err)}, nil
+		}
+		mutations = append(mutations, mutation)
+		garbage = append(garbage, mutationGarbage...)
+	}
+
+	isTransactional, err := fs.filer.ApplyMutations(ctx, mutations, req.IsFromOtherCluster, req.Signatures)
+	resp := &filer_pb.ApplyMutationsResponse{IsTransactional: isTransactional}
+	if err != nil {
+		glog.V(3).Infof("ApplyMutations: %v", err)
+		// the manifest chunks uploaded by cleanupChunks are not referenced by any entry
+		fs.filer.DeleteChunksNotRecursive(uploaded)
+		resp.Error = err.Error()
+		return resp, nil
+	}
+
+	fs.filer.DeleteChunksNotRecursive(garbage)
+
+	return resp, nil
+}
+
+// toMutation resolves the chunks of the created or updated entry, and returns the chunks to delete after the mutation
+func (fs *FilerServer) toMutation(ctx context.Context, m *filer_pb.ApplyMutationsRequest_Mutation) (mutation *filer.Mutation, garbage []*filer_pb.FileChunk, err error) {
+	if m.CreateEntry != nil && m.CreateEntry.Entry == nil || m.UpdateEntry != nil && m.UpdateEntry.Entry == nil {
+		return nil, nil, fmt.Errorf("missing entry")
+	}
+	switch {
+	case m.CreateEntry != nil && m.UpdateEntry == nil && m.DeleteEntry == nil:
+		req := m.CreateEntry
+		chunks, garbage, err := fs.cleanupChunks(util.Join(req.Directory, req.Entry.Name), nil, req.Entry)
+		if err != nil {
+			return nil, nil, fmt.Errorf("create %s/%s cleanupChunks: %v", req.Directory, req.Entry.Name, err)
+		}
+		newEntry := filer.FromPbEntry(req.Directory, req.Entry)
+		newEntry.Chunks = chunks
+		return &filer.Mutation{Create: newEntry, OExcl: req.OExcl}, garbage, nil
+	case m.UpdateEntry != nil && m.CreateEntry == nil && m.DeleteEntry == nil:
+		req := m.UpdateEntry
+		fullpath := util.Join(req.Directory, req.Entry.Name)
+		entry, err := fs.filer.FindEntry(ctx, util.FullPath(fullpath))
+		if err != nil {
+			return nil, nil, fmt.Errorf("not found %s: %v", fullpath, err)
+		}
+		if !hasExpectedChunks(entry, req.ExpectedChunkFileIds) {
+			return nil, nil, fmt.Errorf("update %s: %v", fullpath, filer_pb.ErrChunksChanged)
+		}
+		chunks, garbage, err := fs.cleanupChunks(fullpath, entry, req.Entry)
+		if err != nil {
+			return nil, nil, fmt.Errorf("update %s cleanupChunks: %v", fullpath, err)
+		}
+		newEntry := filer.FromPbEntry(req.Directory, req.Entry)
+		newEntry.Chunks = chunks
+		return &filer.Mutation{Update: newEntry}, garbage, nil
+	case m.DeleteEntry != nil && m.CreateEntry == nil && m.UpdateEntry == nil:
+		req := m.DeleteEntry
+		return &filer.Mutation{
+			Delete:       util.JoinPath(req.Directory, req.Name),
+			IsRecursive:  req.IsRecursive,
+			IsDeleteData: req.IsDeleteData,
+		}, nil, nil
+	}
+	return nil, nil, fmt.Errorf("needs exactly one of create_entry, update_entry and delete_entry")
+}
+
+// uploadedManifestChunks returns the manifest chunks of the resolved entry which are not in the request,
+// i.e., uploaded when resolving the chunks
+func uploadedManifestChunks(m *filer_pb.ApplyMutationsRequest_Mutation, mutation *filer.Mutation) (uploaded []*filer_pb.FileChunk) {
+	var requested *filer_pb.Entry
+	var resolved *filer.Entry
+	switch {
+	case mutation.Create != nil:
+		requested, resolved = m.CreateEntry.Entry, mutation.Create
+	case mutation.Update != nil:
+		requested, resolved = m.UpdateEntry.Entry, mutation.Update
+	default:
+		return nil
+	}
+	fileIds := make(map[string]bool)
+	for _, chunk := range requested.Chunks {
+		fileIds[chunk.GetFileIdString()] = true
+	}
+	for _, chunk := range resolved.Chunks {
+		if chunk.IsChunkManifest && !fileIds[chunk.GetFileIdString()] {
+			uploaded = append(uploaded, chunk)
+		}
+	}
+	return
+}
@@ -33,6 +33,17 @@ func (fs *FilerServer) AtomicRenameEntry(ctx context.Context, req *filer_pb.Atom
 		return nil, fmt.Errorf("%s/%s not found: %v", req.OldDirectory, req.OldName, err)
 	}
 
+	if req.KeepReplacedData {
+		// remove the replaced file in the same transaction, without its data
+		newPath := newParent.Child(req.NewName)
+		if replacedEntry, findErr := fs.filer.FindEntry(ctx, newPath); findErr == nil && !replacedEntry.IsDirectory() && newPath != oldParent.Child(req.OldName) {
+			if err = fs.filer.DeleteEntryMetaAndData(ctx, newPath, false, false, false, false, req.Signatures); err != nil {
+				fs.filer.RollbackTransaction(ctx)
+				return nil, fmt.Errorf("remove replaced %s: %v", newPath, err)
+			}
+		}
+	}
+
 	moveErr := fs.moveEntry(ctx, oldParent, oldEntry, newParent, req.NewName, req.Signatures)
 	if moveErr != nil {
 		fs.filer.RollbackTransaction(ctx)
@@ -107,6 +118,11 @@ func (fs *FilerServer) moveSelfEntry(ctx context.Context, oldParent util.FullPat
 		return nil
 	}
 
+	// keep the inode of the entries created before inodes are assigned
+	if entry.Attr.Inode == 0 {
+		entry.Attr.Inode = oldPath.AsInode()
+	}
+
 	// add to new directory
 	newEntry := &filer.Entry{
 		FullPath: newPath,
@@ -60,10 +60,16 @@ func (fs *FilerServer) SubscribeMetadata(req *filer_pb.SubscribeMetadataRequest,
 
 		lastReadTime, readInMemoryLogErr = fs.filer.MetaAggregator.MetaLogBuffer.LoopProcessLogData("aggMeta:"+clientName, lastReadTime, func() bool {
 			fs.filer.MetaAggregator.ListenersLock.Lock()
+			defer fs.filer.MetaAggregator.ListenersLock.Unlock()
+			if fs.isSubscriptionStopped() {
+				return false
+			}
 			fs.filer.MetaAggregator.ListenersCond.Wait()
-			fs.filer.MetaAggregator.ListenersLock.Unlock()
-			return true
+			return !fs.isSubscriptionStopped()
 		}, eachLogEntryFn)
+		if fs.isSubscriptionStopped() {
+			return nil
+		}
 		if readInMemoryLogErr != nil {
 			if readInMemoryLogErr == log_buffer.ResumeFromDiskError {
 				continue
@@ -121,10 +127,16 @@ func (fs *FilerServer) SubscribeLocalMetadata(req *filer_pb.SubscribeMetadataReq
 
 		lastReadTime, readInMemoryLogErr = fs.filer.LocalMetaLogBuffer.LoopProcessLogData("localMeta:"+clientName, lastReadTime, func() bool {
 			fs.listenersLock.Lock()
+			defer fs.listenersLock.Unlock()
+			if fs.isSubscriptionStopped() {
+				return false
+			}
 			fs.listenersCond.Wait()
-			fs.listenersLock.Unlock()
-			return true
+			return !fs.isSubscriptionStopped()
 		}, eachLogEntryFn)
+		if fs.isSubscriptionStopped() {
+			return nil
+		}
 		if readInMemoryLogErr != nil {
 			if readInMemoryLogErr == log_buffer.ResumeFromDiskError {
 				continue
@@ -3,21 +3,23 @@ package weed_server
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chrislusf/seaweedfs/weed/stats"
 
 	"google.golang.org/grpc"
 
-	"github.com/chrislusf/seaweedfs/weed/util/grace"
-
 	"github.com/chrislusf/seaweedfs/weed/operation"
 	"github.com/chrislusf/seaweedfs/weed/pb"
 	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
+	"github.com/chrislusf/seaweedfs/weed/wdclient/exclusive_locks"
 
 	"github.com/chrislusf/seaweedfs/weed/filer"
 	_ "github.com/chrislusf/seaweedfs/weed/filer/cassandra"
@@ -46,23 +48,34 @@ import (
 )
 
 type FilerOption struct {
-	Masters               []string
-	Collection            string
-	DefaultReplication    string
-	DisableDirListing     bool
-	MaxMB                 int
-	DirListingLimit       int
-	DataCenter            string
-	Rack                  string
-	DefaultLevelDbDir     string
-	DisableHttp           bool
-	Host                  string
-	Port                  uint32
-	recursiveDelete       bool
-	Cipher                bool
-	SaveToFilerLimit      int64
-	Filers                []string
-	ConcurrentUploadLimit int64
+	Masters                []string
+	Collection             string
+	DefaultReplication     string
+	DisableDirListing      bool
+	MaxMB                  int
+	DirListingLimit        int
+	DataCenter             string
+	Rack                   string
+	DefaultLevelDbDir      string
+	DisableHttp            bool
+	Host                   string
+	Port                   uint32
+	recursiveDelete        bool
+	Cipher                 bool
+	SaveToFilerLimit       int64
+	Filers                 []string
+	ConcurrentUploadLimit  int64
+	StreamReads            bool
+	InternalNetworks       []*net.IPNet
+	MetaCacheSize          int64
+	DedupChunks            bool
+	ReplicaSelection       string
+	ConcurrentChunkUploads int
+	ChunkUploadAttempts    int
+	ConcurrentReads        int
+	ConcurrentWrites       int
+	ConcurrentDeletes      int
+	RequestQueueTimeout    time.Duration
 }
 
 type FilerServer struct {
@@ -76,14 +89,36 @@ type FilerServer struct {
 	metricsIntervalSec int
 
 	// notifying clients
-	listenersLock sync.Mutex
-	listenersCond *sync.Cond
+	listenersLock        sync.Mutex
+	listenersCond        *sync.Cond
+	subscriptionsStopped int32
+
+	// sending to the notification message queue
+	notificationStopped int32
+	notificationDone    chan struct{}
 
 	brokers     map[string]map[string]bool
 	brokersLock sync.Mutex
 
 	inFlightDataSize      int64
 	inFlightDataLimitCond *sync.Cond
+
+	// serializing the http writes to the same path, for the conditional writes
+	writeLocks pathLocks
+
+	// serializing the logical volume provisioning, which also updates the filer.conf,
+	// within this filer and, by the lock leased from the master, across the filers
+	logicalVolumesLock   sync.Mutex
+	logicalVolumesLocker *exclusive_locks.ExclusiveLocker
+
+	// separate http request pools, so that one kind of requests can not starve the others
+	readLimiter   *util.ConcurrencyLimiter
+	writeLimiter  *util.ConcurrencyLimiter
+	deleteLimiter *util.ConcurrencyLimiter
+
+	// the CORS configuration and the custom response headers, reloaded with filer.toml
+	httpConf     *FilerHttpConf
+	httpConfLock sync.RWMutex
 }
 
 func NewFilerServer(defaultMux, readonlyMux *http.ServeMux, option *FilerOption) (fs *FilerServer, err error) {
@@ -93,6 +128,9 @@ func NewFilerServer(defaultMux, readonlyMux *http.ServeMux, option *FilerOption)
 		grpcDialOption:        security.LoadClientTLS(util.GetViper(), "grpc.filer"),
 		brokers:               make(map[string]map[string]bool),
 		inFlightDataLimitCond: sync.NewCond(new(sync.Mutex)),
+		readLimiter:           util.NewConcurrencyLimiter(option.ConcurrentReads, option.RequestQueueTimeout),
+		writeLimiter:          util.NewConcurrencyLimiter(option.ConcurrentWrites, option.RequestQueueTimeout),
+		deleteLimiter:         util.NewConcurrencyLimiter(option.ConcurrentDeletes, option.RequestQueueTimeout),
 	}
 	fs.listenersCond = sync.NewCond(&fs.listenersLock)
 
@@ -104,6 +142,9 @@ func NewFilerServer(defaultMux, readonlyMux *http.ServeMux, option *FilerOption)
 		fs.listenersCond.Broadcast()
 	})
 	fs.filer.Cipher = option.Cipher
+	if err := fs.filer.MasterClient.SetReplicaSelection(option.ReplicaSelection, option.Rack); err != nil {
+		return nil, err
+	}
 
 	fs.checkWithMaster()
 
@@ -127,35 +168,102 @@ func NewFilerServer(defaultMux, readonlyMux *http.ServeMux, option *FilerOption)
 	fs.option.recursiveDelete = v.GetBool("filer.options.recursive_delete")
 	v.SetDefault("filer.options.buckets_folder", "/buckets")
 	fs.filer.DirBucketsPath = v.GetString("filer.options.buckets_folder")
+	v.SetDefault("filer.options.logical_volumes_folder", "/volumes")
+	fs.filer.DirLogicalVolumesPath = v.GetString("filer.options.logical_volumes_folder")
 	// TODO deprecated, will be be removed after 2020-12-31
 	// replaced by https://github.com/chrislusf/seaweedfs/wiki/Path-Specific-Configuration
 	// fs.filer.FsyncBuckets = v.GetStringSlice("filer.options.buckets_fsync")
+	v.SetDefault("filer.options.store_timeout_seconds", 30)
+	v.SetDefault("filer.options.store_breaker_failures", 5)
+	v.SetDefault("filer.options.store_breaker_open_seconds", 10)
+	fs.filer.StoreBreakerOption = filer.StoreBreakerOption{
+		Timeout:          time.Duration(v.GetInt("filer.options.store_timeout_seconds")) * time.Second,
+		FailureThreshold: v.GetInt("filer.options.store_breaker_failures"),
+		OpenDuration:     time.Duration(v.GetInt("filer.options.store_breaker_open_seconds")) * time.Second,
+	}
+	if err := fs.loadHttpConf(); err != nil {
+		return nil, err
+	}
 	fs.filer.LoadConfiguration(v)
+	fs.filer.Store.EnableMetaCache(option.MetaCacheSize)
 
 	notification.LoadConfiguration(v, "notification.")
 
 	handleStaticResources(defaultMux)
 	if !option.DisableHttp {
-		defaultMux.HandleFunc("/", fs.filerHandler)
+		defaultMux.Handle("/", request_id.Middleware(http.HandlerFunc(fs.filerHandler)))
 	}
 	if defaultMux != readonlyMux {
 		handleStaticResources(readonlyMux)
-		readonlyMux.HandleFunc("/", fs.readonlyFilerHandler)
+		readonlyMux.Handle("/", request_id.Middleware(http.HandlerFunc(fs.readonlyFilerHandler)))
 	}
 
-	fs.filer.AggregateFromPeers(fmt.Sprintf("%s:%d", option.Host, option.Port), option.Filers)
+	fs.filer.AggregateFromPeers(util.JoinHostPort(option.Host, int(option.Port)), option.Filers)
+	if option.DedupChunks && len(option.Filers) > 0 {
+		glog.Warningf("chunk deduplication only supports one filer writing to the filer store, but filer peers %v are set", option.Filers)
+	}
 
 	fs.filer.LoadBuckets()
 
+	fs.logicalVolumesLocker = exclusive_locks.NewExclusiveLocker(fs.filer.MasterClient, LogicalVolumesLockName)
+	fs.filer.LoadLogicalVolumes()
+	go fs.filer.LoopReconcileLogicalVolumeUsage(LogicalVolumeUsageReconcileInterval)
+
 	fs.filer.LoadFilerConf()
 
-	grace.OnInterrupt(func() {
-		fs.filer.Shutdown()
-	})
+	fs.startNotifying()
 
 	return fs, nil
 }
 
+// StopSubscriptions ends the metadata subscriptions, which would never complete by themselves,
+// so that the grpc server can be stopped gracefully
+func (fs *FilerServer) StopSubscriptions() {
+	atomic.StoreInt32(&fs.subscriptionsStopped, 1)
+	// the subscribers check the flag while holding the lock, so none of them starts to wait after the broadcast
+	fs.listenersLock.Lock()
+	fs.listenersCond.Broadcast()
+	fs.listenersLock.Unlock()
+	if aggregator := fs.filer.MetaAggregator; aggregator != nil {
+		aggregator.ListenersLock.Lock()
+		aggregator.ListenersCond.Broadcast()
+		aggregator.ListenersLock.Unlock()
+	}
+}
+
+// ResumeSubscriptions accepts metadata subscriptions again after StopSubscriptions
+func (fs *FilerServer) ResumeSubscriptions() {
+	atomic.StoreInt32(&fs.subscriptionsStopped, 0)
+}
+
+func (fs *FilerServer) isSubscriptionStopped() bool {
+	return atomic.LoadInt32(&fs.subscriptionsStopped) == 1
+}
+
+// Reload replaces the filer stores whose settings in filer.toml have been changed,
+// and reloads the http configuration and the path-specific configuration
+func (fs *FilerServer) Reload() {
+	glog.V(0).Infoln("Reload filer server...")
+	loaded, err := util.ReloadConfiguration("filer")
+	if err != nil {
+		glog.Errorf("reload filer configuration: %v", err)
+		return
+	}
+	if loaded {
+		fs.filer.ReloadStores(util.GetViper())
+		if err := fs.loadHttpConf(); err != nil {
+			glog.Errorf("reload filer http configuration: %v", err)
+		}
+	}
+	fs.filer.LoadFilerConf()
+}
+
+// Shutdown flushes the meta logs and closes the filer store
+func (fs *FilerServer) Shutdown() {
+	fs.stopNotifying()
+	fs.filer.Shutdown()
+}
+
 func (fs *FilerServer) checkWithMaster() {
 
 	for _, master := range fs.option.Masters {
@@ -167,7 +275,11 @@ func (fs *FilerServer) checkWithMaster() {
 
 	isConnected := false
 	for !isConnected {
-		for _, master := range fs.option.Masters {
+		masters := util.ResolveServerAddresses(fs.option.Masters)
+		if len(masters) == 0 {
+			time.Sleep(7 * time.Second)
+		}
+		for _, master := range masters {
 			readErr := operation.WithMasterServerClient(master, fs.grpcDialOption, func(masterClient master_pb.SeaweedClient) error {
 				resp, err := masterClient.GetMasterConfiguration(context.Background(), &master_pb.GetMasterConfigurationRequest{})
 				if err != nil {
@@ -1,9 +1,13 @@
 package weed_server
 
 import (
+	"context"
+	"fmt"
+	"github.com/chrislusf/seaweedfs/weed/filer"
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/util"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -22,26 +26,41 @@ func (fs *FilerServer) filerHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	if fileId != "" {
 		stats.FilerRequestCounter.WithLabelValues("proxy").Inc()
+		if !fs.acquireRequestSlot(w, r, fs.readLimiter, "read") {
+			return
+		}
+		defer fs.readLimiter.Release()
 		fs.proxyToVolumeServer(w, r, fileId)
 		stats.FilerRequestHistogram.WithLabelValues("proxy").Observe(time.Since(start).Seconds())
 		return
 	}
 
 	w.Header().Set("Server", "SeaweedFS Filer "+util.VERSION)
-	if r.Header.Get("Origin") != "" {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	if r.Method == "GET" && r.RequestURI == "/?status" {
+		fs.statusHandler(w, r)
+		return
+	}
+	if r.Method == "GET" && r.RequestURI == "/?statistics" {
+		fs.storeStatisticsHandler(w, r)
+		return
 	}
+	pathConf := fs.matchHttpPathConf(r)
+	pathConf.setResponseHeaders(w, r)
 	switch r.Method {
-	case "GET":
-		stats.FilerRequestCounter.WithLabelValues("get").Inc()
-		fs.GetOrHeadHandler(w, r)
-		stats.FilerRequestHistogram.WithLabelValues("get").Observe(time.Since(start).Seconds())
-	case "HEAD":
-		stats.FilerRequestCounter.WithLabelValues("head").Inc()
+	case "GET", "HEAD":
+		if !fs.acquireRequestSlot(w, r, fs.readLimiter, "read") {
+			return
+		}
+		defer fs.readLimiter.Release()
+		requestType := strings.ToLower(r.Method)
+		stats.FilerRequestCounter.WithLabelValues(requestType).Inc()
 		fs.GetOrHeadHandler(w, r)
-		stats.FilerRequestHistogram.WithLabelValues("head").Observe(time.Since(start).Seconds())
+		stats.FilerRequestHistogram.WithLabelValues(requestType).Observe(time.Since(start).Seconds())
 	case "DELETE":
+		if !fs.acquireRequestSlot(w, r, fs.deleteLimiter, "delete") {
+			return
+		}
+		defer fs.deleteLimiter.Release()
 		stats.FilerRequestCounter.WithLabelValues("delete").Inc()
 		if _, ok := r.URL.Query()["tagging"]; ok {
 			fs.DeleteTaggingHandler(w, r)
@@ -50,6 +69,10 @@ func (fs *FilerServer) filerHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		stats.FilerRequestHistogram.WithLabelValues("delete").Observe(time.Since(start).Seconds())
 	case "POST", "PUT":
+		if !fs.acquireRequestSlot(w, r, fs.writeLimiter, "write") {
+			return
+		}
+		defer fs.writeLimiter.Release()
 
 		// wait until in flight data is less than the limit
 		contentLength := getContentLength(r)
@@ -80,39 +103,75 @@ func (fs *FilerServer) filerHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	case "OPTIONS":
 		stats.FilerRequestCounter.WithLabelValues("options").Inc()
-		OptionsHandler(w, r, false)
+		pathConf.setPreflightHeaders(w, r, false)
 		stats.FilerRequestHistogram.WithLabelValues("head").Observe(time.Since(start).Seconds())
 	}
 }
 
 func (fs *FilerServer) readonlyFilerHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Server", "SeaweedFS Filer "+util.VERSION)
-	if r.Header.Get("Origin") != "" {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-	}
+	pathConf := fs.matchHttpPathConf(r)
+	pathConf.setResponseHeaders(w, r)
 	start := time.Now()
 	switch r.Method {
-	case "GET":
-		stats.FilerRequestCounter.WithLabelValues("get").Inc()
-		fs.GetOrHeadHandler(w, r)
-		stats.FilerRequestHistogram.WithLabelValues("get").Observe(time.Since(start).Seconds())
-	case "HEAD":
-		stats.FilerRequestCounter.WithLabelValues("head").Inc()
+	case "GET", "HEAD":
+		if !fs.acquireRequestSlot(w, r, fs.readLimiter, "read") {
+			return
+		}
+		defer fs.readLimiter.Release()
+		requestType := strings.ToLower(r.Method)
+		stats.FilerRequestCounter.WithLabelValues(requestType).Inc()
 		fs.GetOrHeadHandler(w, r)
-		stats.FilerRequestHistogram.WithLabelValues("head").Observe(time.Since(start).Seconds())
+		stats.FilerRequestHistogram.WithLabelValues(requestType).Observe(time.Since(start).Seconds())
 	case "OPTIONS":
 		stats.FilerRequestCounter.WithLabelValues("options").Inc()
-		OptionsHandler(w, r, true)
+		pathConf.setPreflightHeaders(w, r, true)
 		stats.FilerRequestHistogram.WithLabelValues("head").Observe(time.Since(start).Seconds())
 	}
 }
 
-func OptionsHandler(w http.ResponseWriter, r *http.Request, isReadOnly bool) {
-	if isReadOnly {
-		w.Header().Add("Access-Control-Allow-Methods", "GET, OPTIONS")
-	} else {
-		w.Header().Add("Access-Control-Allow-Methods", "PUT, POST, GET, DELETE, OPTIONS")
+// statusHandler reports the configured masters, and the master currently used to assign file ids
+func (fs *FilerServer) statusHandler(w http.ResponseWriter, r *http.Request) {
+	m := make(map[string]interface{})
+	m["Version"] = util.Version()
+	m["Masters"] = fs.option.Masters
+	m["CurrentMaster"] = fs.filer.MasterClient.GetCurrentMaster()
+	writeJsonQuiet(w, r, http.StatusOK, m)
+}
+
+// storeStatisticsHandler reports the filer stores, to tell whether the metadata backend is the bottleneck
+func (fs *FilerServer) storeStatisticsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), storeStatisticsTimeout)
+	defer cancel()
+	m := make(map[string]interface{})
+	m["Version"] = util.Version()
+	m["Stores"] = fs.filer.Store.Statistics(ctx)
+	writeJsonQuiet(w, r, http.StatusOK, m)
+}
+
+// acquireRequestSlot waits in the queue of the request pool, or replies 503 if the wait times out
+func (fs *FilerServer) acquireRequestSlot(w http.ResponseWriter, r *http.Request, limiter *util.ConcurrencyLimiter, requestType string) bool {
+	if limiter.Acquire(r.Context()) {
+		return true
+	}
+	glog.V(1).Infof("%s %s: too many concurrent %s requests", r.Method, r.URL.Path, requestType)
+	stats.FilerRequestCounter.WithLabelValues(requestType + ".queueTimeout").Inc()
+	w.Header().Set("Retry-After", "1")
+	writeJsonError(w, r, http.StatusServiceUnavailable, fmt.Errorf("too many concurrent %s requests", requestType))
+	return false
+}
+
+// writeStoreUnavailable replies 503 with Retry-After, if the error is from an unavailable filer store
+func (fs *FilerServer) writeStoreUnavailable(w http.ResponseWriter, r *http.Request, err error) bool {
+	if !filer.IsFilerStoreUnavailable(err) {
+		return false
+	}
+	stats.FilerRequestCounter.WithLabelValues("storeUnavailable").Inc()
+	retryAfter := fs.filer.StoreBreakerOption.OpenDuration
+	if retryAfter < time.Second {
+		retryAfter = time.Second
 	}
-	w.Header().Add("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	writeJsonError(w, r, http.StatusServiceUnavailable, err)
+	return true
 }
@@ -3,7 +3,9 @@ package weed_server
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
+	"math/rand"
 	"mime"
 	"net/http"
 	"net/url"
@@ -18,6 +20,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 	xhttp "github.com/chrislusf/seaweedfs/weed/s3api/http"
 	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
@@ -36,11 +39,13 @@ func (fs *FilerServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 			return
 		}
 		if err == filer_pb.ErrNotFound {
-			glog.V(1).Infof("Not found %s: %v", path, err)
+			glog.V(1).InfofCtx(r.Context(), "Not found %s: %v", path, err)
 			stats.FilerRequestCounter.WithLabelValues("read.notfound").Inc()
 			w.WriteHeader(http.StatusNotFound)
+		} else if fs.writeStoreUnavailable(w, r, err) {
+			glog.ErrorfCtx(r.Context(), "Unavailable %s: %v", path, err)
 		} else {
-			glog.Errorf("Internal %s: %v", path, err)
+			glog.ErrorfCtx(r.Context(), "Internal %s: %v", path, err)
 			stats.FilerRequestCounter.WithLabelValues("read.internalerror").Inc()
 			w.WriteHeader(http.StatusInternalServerError)
 		}
@@ -63,10 +68,6 @@ func (fs *FilerServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 
 	// set etag
 	etag := filer.ETagEntry(entry)
-	if ifm := r.Header.Get("If-Match"); ifm != "" && ifm != "\""+etag+"\"" {
-		w.WriteHeader(http.StatusPreconditionFailed)
-		return
-	}
 
 	w.Header().Set("Accept-Ranges", "bytes")
 
@@ -81,17 +82,13 @@ func (fs *FilerServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 		w.Header().Set("Content-Type", mimeType)
 	}
 
-	// if modified since
 	if !entry.Attr.Mtime.IsZero() {
 		w.Header().Set("Last-Modified", entry.Attr.Mtime.UTC().Format(http.TimeFormat))
-		if r.Header.Get("If-Modified-Since") != "" {
-			if t, parseError := time.Parse(http.TimeFormat, r.Header.Get("If-Modified-Since")); parseError == nil {
-				if !t.Before(entry.Attr.Mtime) {
-					w.WriteHeader(http.StatusNotModified)
-					return
-				}
-			}
-		}
+	}
+
+	setChecksumHeader(w, "md5", entry.Attr.Md5)
+	if entry.Attr.TtlSec > 0 {
+		setTtlHeaders(w, needle.SecondsToTTL(entry.Attr.TtlSec), entry.Attr.Crtime.Add(time.Duration(entry.Attr.TtlSec)*time.Second), time.Now())
 	}
 
 	// print out the header from extended properties
@@ -102,11 +99,14 @@ func (fs *FilerServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 	//Seaweed custom header are not visible to Vue or javascript
 	seaweedHeaders := []string{}
 	for header, _ := range w.Header() {
-		if strings.HasPrefix(header, "Seaweed-") {
+		if strings.HasPrefix(header, "Seaweed-") || strings.HasPrefix(header, "X-Seaweed-") {
 			seaweedHeaders = append(seaweedHeaders, header)
 		}
 	}
 	seaweedHeaders = append(seaweedHeaders, "Content-Disposition")
+	if exposeHeaders := w.Header().Get("Access-Control-Expose-Headers"); exposeHeaders != "" {
+		seaweedHeaders = append(seaweedHeaders, exposeHeaders)
+	}
 	w.Header().Set("Access-Control-Expose-Headers", strings.Join(seaweedHeaders, ","))
 
 	//set tag count
@@ -122,15 +122,22 @@ func (fs *FilerServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	if inm := r.Header.Get("If-None-Match"); inm == "\""+etag+"\"" {
-		w.WriteHeader(http.StatusNotModified)
+	setEtag(w, etag)
+
+	// conditional requests
+	preconditions := NewPreconditions(r.Header, "")
+	if entry.Attr.Mtime.IsZero() {
+		preconditions.IfModifiedSince, preconditions.IfUnmodifiedSince = "", ""
+	}
+	if status := preconditions.Evaluate(true, etag, entry.Attr.Mtime, http.StatusNotModified); status != http.StatusOK {
+		w.WriteHeader(status)
 		return
 	}
-	setEtag(w, etag)
 
 	filename := entry.Name()
 	filename = url.QueryEscape(filename)
 	adjustHeaderContentDisposition(w, r, filename)
+	adjustHeaderResponseOverrides(w, r)
 
 	totalSize := int64(entry.Size())
 
@@ -139,13 +146,23 @@ func (fs *FilerServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if fs.readMode(r, path) == filer.ReadModeRedirect {
+		if redirectUrl, ok := fs.redirectUrl(r, entry); ok {
+			http.Redirect(w, r, redirectUrl, http.StatusFound)
+			return
+		}
+	}
+
 	if rangeReq := r.Header.Get("Range"); rangeReq == "" {
 		ext := filepath.Ext(filename)
 		width, height, mode, shouldResize := shouldResizeImages(ext, r)
 		if shouldResize {
-			data, err := filer.ReadAll(fs.filer.MasterClient, entry.Chunks)
+			data, err := entry.Content, error(nil)
+			if len(data) == 0 {
+				data, err = filer.ReadAll(fs.filer.MasterClient, entry.Chunks)
+			}
 			if err != nil {
-				glog.Errorf("failed to read %s: %v", path, err)
+				glog.ErrorfCtx(r.Context(), "failed to read %s: %v", path, err)
 				w.WriteHeader(http.StatusNotModified)
 				return
 			}
@@ -159,14 +176,53 @@ func (fs *FilerServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 		if offset+size <= int64(len(entry.Content)) {
 			_, err := writer.Write(entry.Content[offset : offset+size])
 			if err != nil {
-				glog.Errorf("failed to write entry content: %v", err)
+				glog.ErrorfCtx(r.Context(), "failed to write entry content: %v", err)
 			}
 			return err
 		}
-		err = filer.StreamContent(fs.filer.MasterClient, writer, entry.Chunks, offset, size)
+		if fs.option.StreamReads {
+			err = filer.StreamContentUnbuffered(fs.filer.MasterClient, writer, entry.Chunks, offset, size)
+		} else {
+			err = filer.StreamContent(fs.filer.MasterClient, writer, entry.Chunks, offset, size)
+		}
 		if err != nil {
-			glog.Errorf("failed to stream content %s: %v", r.URL, err)
+			glog.ErrorfCtx(r.Context(), "failed to stream content %s: %v", r.URL, err)
 		}
 		return err
 	})
 }
+
+// readMode is chosen by the "readMode" request parameter, or else by the path-specific configuration
+func (fs *FilerServer) readMode(r *http.Request, path string) string {
+	if readMode := r.FormValue("readMode"); readMode != "" {
+		return readMode
+	}
+	return fs.filer.FilerConf.MatchStorageRule(path).ReadMode
+}
+
+// redirectUrl returns the volume server url of the file, if the file content is exactly one plain chunk.
+// Clients in the internal networks get the volume server url, and other clients get the public url.
+func (fs *FilerServer) redirectUrl(r *http.Request, entry *filer.Entry) (string, bool) {
+	if len(entry.Content) > 0 || len(entry.Chunks) != 1 {
+		return "", false
+	}
+	chunk := entry.Chunks[0]
+	if chunk.IsChunkManifest || len(chunk.CipherKey) > 0 || chunk.Offset != 0 || chunk.Size != entry.Size() {
+		return "", false
+	}
+	fid, err := needle.ParseFileIdFromString(chunk.GetFileIdString())
+	if err != nil {
+		return "", false
+	}
+	locations, found := fs.filer.MasterClient.GetLocations(uint32(fid.VolumeId))
+	if !found || len(locations) == 0 {
+		return "", false
+	}
+	location := locations[rand.Intn(len(locations))]
+	serverUrl := location.PublicUrl
+	if serverUrl == "" || util.IsInNetworks(r.RemoteAddr, fs.option.InternalNetworks) {
+		serverUrl = location.Url
+	}
+	// use the "/volumeId/needleIdCookie/fileName" form, so the file name is kept
+	return fmt.Sprintf("http://%s/%d/%s/%s", serverUrl, fid.VolumeId, fid.GetNeedleIdCookie(), url.PathEscape(entry.Name())), true
+}
@@ -41,7 +41,9 @@ func (fs *FilerServer) listDirectoryHandler(w http.ResponseWriter, r *http.Reque
 
 	if err != nil {
 		glog.V(0).Infof("listDirectory %s %s %d: %s", path, lastFileName, limit, err)
-		w.WriteHeader(http.StatusNotFound)
+		if !fs.writeStoreUnavailable(w, r, err) {
+			w.WriteHeader(http.StatusNotFound)
+		}
 		return
 	}
 
@@ -73,7 +75,7 @@ func (fs *FilerServer) listDirectoryHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	var qrImageString string
-	img, err := qrcode.Encode(fmt.Sprintf("http://%s:%d%s", fs.option.Host, fs.option.Port, r.URL.Path), qrcode.Medium, 128)
+	img, err := qrcode.Encode(fmt.Sprintf("http://%s%s", util.JoinHostPort(fs.option.Host, int(fs.option.Port)), r.URL.Path), qrcode.Medium, 128)
 	if err == nil {
 		qrImageString = base64.StdEncoding.EncodeToString(img)
 	}
@@ -11,32 +11,50 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/operation"
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	xhttp "github.com/chrislusf/seaweedfs/weed/s3api/http"
 	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/stats"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 )
 
 var (
 	OS_UID = uint32(os.Getuid())
 	OS_GID = uint32(os.Getgid())
 
-	ErrReadOnly = errors.New("read only")
+	ErrReadOnly          = errors.New("read only")
+	ErrLogicalVolumeFull = errors.New("logical volume capacity exceeded")
 )
 
 type FilerPostResult struct {
 	Name  string `json:"name,omitempty"`
 	Size  int64  `json:"size,omitempty"`
 	Error string `json:"error,omitempty"`
+	// the file is created with the same content already uploaded
+	Deduplicated bool `json:"deduplicated,omitempty"`
 }
 
 func (fs *FilerServer) assignNewFileInfo(so *operation.StorageOption) (fileId, urlLocation string, auth security.EncodedJwt, err error) {
+	fileId, urlLocation, _, auth, err = fs.assignNewFileInfoAvoiding(so, nil)
+	return
+}
+
+// assignNewFileInfoAvoiding assigns a file id, preferably not on the avoided volume servers
+func (fs *FilerServer) assignNewFileInfoAvoiding(so *operation.StorageOption, avoidedServers map[string]bool) (fileId, urlLocation, server string, auth security.EncodedJwt, err error) {
 
 	stats.FilerRequestCounter.WithLabelValues("assign").Inc()
 	start := time.Now()
 	defer func() { stats.FilerRequestHistogram.WithLabelValues("assign").Observe(time.Since(start).Seconds()) }()
 
 	ar, altRequest := so.ToAssignRequests(1)
+	if len(avoidedServers) > 0 {
+		// the file ids in a batch are on different volumes, likely some on other volume servers
+		ar.BatchCount = uint32(len(avoidedServers) + 2)
+		if altRequest != nil {
+			altRequest.BatchCount = ar.BatchCount
+		}
+	}
 
 	assignResult, ae := operation.Assign(fs.filer.GetMaster, fs.grpcDialOption, ar, altRequest)
 	if ae != nil {
@@ -44,18 +62,24 @@ func (fs *FilerServer) assignNewFileInfo(so *operation.StorageOption) (fileId, u
 		err = ae
 		return
 	}
-	fileId = assignResult.Fid
-	urlLocation = "http://" + assignResult.Url + "/" + assignResult.Fid
+	fileId, server, auth = assignResult.Fid, assignResult.Url, assignResult.Auth
+	for _, assigned := range assignResult.Batch {
+		if !avoidedServers[assigned.Url] {
+			fileId, server, auth = assigned.Fid, assigned.Url, assigned.Auth
+			break
+		}
+	}
+	urlLocation = "http://" + server + "/" + fileId
 	if so.Fsync {
 		urlLocation += "?fsync=true"
 	}
-	auth = assignResult.Auth
 	return
 }
 
 func (fs *FilerServer) PostHandler(w http.ResponseWriter, r *http.Request, contentLength int64) {
 
-	ctx := context.Background()
+	// not canceled with the request, but carrying its request id
+	ctx := request_id.Set(context.Background(), request_id.Get(r.Context()))
 
 	query := r.URL.Query()
 	so, err := fs.detectStorageOption0(r.RequestURI,
@@ -67,15 +91,33 @@ func (fs *FilerServer) PostHandler(w http.ResponseWriter, r *http.Request, conte
 		query.Get("rack"),
 	)
 	if err != nil {
-		if err == ErrReadOnly {
+		if err == ErrReadOnly || err == ErrLogicalVolumeFull {
 			w.WriteHeader(http.StatusInsufficientStorage)
 		} else {
-			glog.V(1).Infoln("post", r.RequestURI, ":", err.Error())
+			glog.V(1).InfofCtx(ctx, "post %s: %v", r.RequestURI, err)
 			w.WriteHeader(http.StatusInternalServerError)
 		}
 		return
 	}
 
+	// the S3 server side encryption, requested by the client or the bucket default encryption
+	if r.Header.Get(xhttp.AmzServerSideEncryption) != "" {
+		so.Cipher = true
+	}
+
+	// the preconditions must still hold when the file is written
+	defer fs.writeLocks.lock(r.URL.Path)()
+
+	if err = fs.checkWritePreconditions(ctx, r); err != nil {
+		glog.V(1).InfofCtx(ctx, "post %s: %v", r.RequestURI, err)
+		if err == ErrPreconditionFailed {
+			writeJsonError(w, r, http.StatusPreconditionFailed, err)
+		} else if !fs.writeStoreUnavailable(w, r, err) {
+			writeJsonError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
 	fs.autoChunk(ctx, w, r, contentLength, so)
 	util.CloseRequest(r)
 
@@ -103,7 +145,10 @@ func (fs *FilerServer) DeleteHandler(w http.ResponseWriter, r *http.Request) {
 
 	err := fs.filer.DeleteEntryMetaAndData(context.Background(), util.FullPath(objectPath), isRecursive, ignoreRecursiveError, !skipChunkDeletion, false, nil)
 	if err != nil {
-		glog.V(1).Infoln("deleting", objectPath, ":", err.Error())
+		glog.V(1).InfofCtx(r.Context(), "deleting %s: %v", objectPath, err)
+		if fs.writeStoreUnavailable(w, r, err) {
+			return
+		}
 		httpStatus := http.StatusInternalServerError
 		if err == filer_pb.ErrNotFound {
 			httpStatus = http.StatusNoContent
@@ -135,6 +180,10 @@ func (fs *FilerServer) detectStorageOption(requestURI, qCollection, qReplication
 		return nil, ErrReadOnly
 	}
 
+	if fs.filer.IsLogicalVolumeFull(util.FullPath(requestURI)) {
+		return nil, ErrLogicalVolumeFull
+	}
+
 	if ttlSeconds == 0 {
 		ttl, err := needle.ReadTTL(rule.GetTtl())
 		if err != nil {
@@ -152,9 +201,27 @@ func (fs *FilerServer) detectStorageOption(requestURI, qCollection, qReplication
 		DiskType:          util.Nvl(diskType, rule.DiskType),
 		Fsync:             fsync || rule.Fsync,
 		VolumeGrowthCount: rule.VolumeGrowthCount,
+		Cipher:            fs.option.Cipher,
 	}, nil
 }
 
+// saveToFilerLimit is the size under which files are saved in the filer entry,
+// from the path-specific configuration, or else the -saveToFilerLimit option
+func (fs *FilerServer) saveToFilerLimit(path string) int64 {
+	if limit := fs.filer.FilerConf.MatchStorageRule(path).SaveToFilerLimit; limit > 0 {
+		return int64(limit)
+	}
+	return fs.option.SaveToFilerLimit
+}
+
+// maxMB is the chunk size in MB of the files written to the path
+func (fs *FilerServer) maxMB(path string) int32 {
+	if maxMB := fs.filer.FilerConf.MatchStorageRule(path).MaxMb; maxMB > 0 {
+		return int32(maxMB)
+	}
+	return int32(fs.option.MaxMB)
+}
+
 func (fs *FilerServer) detectStorageOption0(requestURI, qCollection, qReplication string, qTtl string, diskType string, dataCenter, rack string) (*operation.StorageOption, error) {
 
 	ttl, err := needle.ReadTTL(qTtl)
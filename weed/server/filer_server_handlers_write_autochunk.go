@@ -2,8 +2,11 @@ package weed_server
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
@@ -16,6 +19,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/operation"
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 	xhttp "github.com/chrislusf/seaweedfs/weed/s3api/http"
+	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/stats"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/util"
@@ -23,13 +27,14 @@ import (
 
 func (fs *FilerServer) autoChunk(ctx context.Context, w http.ResponseWriter, r *http.Request, contentLength int64, so *operation.StorageOption) {
 
-	// autoChunking can be set at the command-line level or as a query param. Query param overrides command-line
+	// autoChunking can be set at the command-line level, for the path in filer.conf, or as a query param.
+	// Query param overrides the path configuration, which overrides command-line
 	query := r.URL.Query()
 
 	parsedMaxMB, _ := strconv.ParseInt(query.Get("maxMB"), 10, 32)
 	maxMB := int32(parsedMaxMB)
-	if maxMB <= 0 && fs.option.MaxMB > 0 {
-		maxMB = int32(fs.option.MaxMB)
+	if maxMB <= 0 {
+		maxMB = fs.maxMB(r.URL.Path)
 	}
 
 	chunkSize := 1024 * 1024 * maxMB
@@ -55,9 +60,13 @@ func (fs *FilerServer) autoChunk(ctx context.Context, w http.ResponseWriter, r *
 	if err != nil {
 		if strings.HasPrefix(err.Error(), "read input:") {
 			writeJsonError(w, r, 499, err)
+		} else if strings.HasPrefix(err.Error(), ErrContentHashMismatch.Error()) || strings.HasPrefix(err.Error(), ErrContentMd5Mismatch.Error()) || strings.HasPrefix(err.Error(), "invalid "+ContentSha256Header) {
+			writeJsonError(w, r, http.StatusBadRequest, err)
+		} else if err == ErrContentNotFound {
+			writeJsonError(w, r, http.StatusNotFound, err)
 		} else if strings.HasSuffix(err.Error(), "is a file") {
 			writeJsonError(w, r, http.StatusConflict, err)
-		} else {
+		} else if !fs.writeStoreUnavailable(w, r, err) {
 			writeJsonError(w, r, http.StatusInternalServerError, err)
 		}
 	} else if reply != nil {
@@ -89,12 +98,28 @@ func (fs *FilerServer) doPostAutoChunk(ctx context.Context, w http.ResponseWrite
 		contentType = ""
 	}
 
-	fileChunks, md5Hash, chunkOffset, err, smallContent := fs.uploadReaderToChunks(w, r, part1, chunkSize, fileName, contentType, contentLength, so)
+	var reader io.Reader = part1
+	var contentHash hash.Hash
+	sha256Hex := needle.AmzContentSha256(r.Header)
+	if sha256Hex != "" {
+		contentHash = sha256.New()
+		reader = io.TeeReader(part1, contentHash)
+	}
+
+	fileChunks, md5Hash, chunkOffset, err, smallContent := fs.uploadReaderToChunks(w, r, reader, chunkSize, fileName, contentType, contentLength, so)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	md5bytes = md5Hash.Sum(nil)
+	if err = fs.verifyContentMd5(r, fileChunks, md5bytes); err != nil {
+		return nil, nil, err
+	}
+	if contentHash != nil {
+		if err = fs.verifyContentHash(contentHash, sha256Hex, so, fileChunks, md5bytes, chunkOffset); err != nil {
+			return nil, nil, err
+		}
+	}
 	filerResult, replyerr = fs.saveMetaData(ctx, r, fileName, contentType, so, md5bytes, fileChunks, chunkOffset, smallContent)
 
 	return
@@ -102,18 +127,52 @@ func (fs *FilerServer) doPostAutoChunk(ctx context.Context, w http.ResponseWrite
 
 func (fs *FilerServer) doPutAutoChunk(ctx context.Context, w http.ResponseWriter, r *http.Request, chunkSize int32, contentLength int64, so *operation.StorageOption) (filerResult *FilerPostResult, md5bytes []byte, replyerr error) {
 
+	sha256Hex, err := contentSha256(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sha256Hex != "" {
+		filerResult, md5bytes, found, err := fs.saveByContentHash(ctx, r, so, sha256Hex)
+		if found || err != nil {
+			return filerResult, md5bytes, err
+		}
+		if contentLength == 0 && sha256Hex != emptySha256Hex {
+			return nil, nil, ErrContentNotFound
+		}
+	}
+
 	fileName := path.Base(r.URL.Path)
 	contentType := r.Header.Get("Content-Type")
 	if contentType == "application/octet-stream" {
 		contentType = ""
 	}
 
-	fileChunks, md5Hash, chunkOffset, err, smallContent := fs.uploadReaderToChunks(w, r, r.Body, chunkSize, fileName, contentType, contentLength, so)
+	// the client supplied sha256 is only verified, not used to find the same content
+	if sha256Hex == "" {
+		sha256Hex = needle.AmzContentSha256(r.Header)
+	}
+
+	var reader io.Reader = r.Body
+	var contentHash hash.Hash
+	if sha256Hex != "" {
+		contentHash = sha256.New()
+		reader = io.TeeReader(r.Body, contentHash)
+	}
+
+	fileChunks, md5Hash, chunkOffset, err, smallContent := fs.uploadReaderToChunks(w, r, reader, chunkSize, fileName, contentType, contentLength, so)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	md5bytes = md5Hash.Sum(nil)
+	if err = fs.verifyContentMd5(r, fileChunks, md5bytes); err != nil {
+		return nil, nil, err
+	}
+	if contentHash != nil {
+		if err = fs.verifyContentHash(contentHash, sha256Hex, so, fileChunks, md5bytes, chunkOffset); err != nil {
+			return nil, nil, err
+		}
+	}
 	filerResult, replyerr = fs.saveMetaData(ctx, r, fileName, contentType, so, md5bytes, fileChunks, chunkOffset, smallContent)
 
 	return
@@ -132,7 +191,7 @@ func (fs *FilerServer) saveMetaData(ctx context.Context, r *http.Request, fileNa
 	}
 	mode, err := strconv.ParseUint(modeStr, 8, 32)
 	if err != nil {
-		glog.Errorf("Invalid mode format: %s, use 0660 by default", modeStr)
+		glog.ErrorfCtx(ctx, "Invalid mode format: %s, use 0660 by default", modeStr)
 		mode = 0660
 	}
 
@@ -158,7 +217,7 @@ func (fs *FilerServer) saveMetaData(ctx context.Context, r *http.Request, fileNa
 	if isAppend(r) {
 		existingEntry, findErr := fs.filer.FindEntry(ctx, util.FullPath(path))
 		if findErr != nil && findErr != filer_pb.ErrNotFound {
-			glog.V(0).Infof("failing to find %s: %v", path, findErr)
+			glog.V(0).InfofCtx(ctx, "failing to find %s: %v", path, findErr)
 		}
 		entry = existingEntry
 	}
@@ -204,7 +263,7 @@ func (fs *FilerServer) saveMetaData(ctx context.Context, r *http.Request, fileNa
 	// maybe compact entry chunks
 	mergedChunks, replyerr = filer.MaybeManifestize(fs.saveAsChunk(so), mergedChunks)
 	if replyerr != nil {
-		glog.V(0).Infof("manifestize %s: %v", r.RequestURI, replyerr)
+		glog.V(0).InfofCtx(ctx, "manifestize %s: %v", r.RequestURI, replyerr)
 		return
 	}
 	entry.Chunks = mergedChunks
@@ -226,7 +285,7 @@ func (fs *FilerServer) saveMetaData(ctx context.Context, r *http.Request, fileNa
 		fs.filer.DeleteChunks(fileChunks)
 		replyerr = dbErr
 		filerResult.Error = dbErr.Error()
-		glog.V(0).Infof("failing to write %s to filer server : %v", path, dbErr)
+		glog.V(0).InfofCtx(ctx, "failing to write %s to filer server : %v", path, dbErr)
 	}
 	return filerResult, replyerr
 }
@@ -234,14 +293,15 @@ func (fs *FilerServer) saveMetaData(ctx context.Context, r *http.Request, fileNa
 func (fs *FilerServer) saveAsChunk(so *operation.StorageOption) filer.SaveDataAsChunkFunctionType {
 
 	return func(reader io.Reader, name string, offset int64) (*filer_pb.FileChunk, string, string, error) {
-		// assign one file id for one chunk
-		fileId, urlLocation, auth, assignErr := fs.assignNewFileInfo(so)
-		if assignErr != nil {
-			return nil, "", "", assignErr
+		data, readErr := ioutil.ReadAll(reader)
+		if readErr != nil {
+			return nil, "", "", readErr
 		}
 
 		// upload the chunk to the volume server
-		uploadResult, uploadErr, _ := operation.Upload(urlLocation, name, fs.option.Cipher, reader, false, "", nil, auth)
+		fileId, uploadResult, uploadErr := fs.retriedUpload(so, func(urlLocation string, auth security.EncodedJwt) (*operation.UploadResult, error) {
+			return operation.UploadData(urlLocation, name, so.Cipher, data, false, "", nil, auth)
+		})
 		if uploadErr != nil {
 			return nil, "", "", uploadErr
 		}
@@ -259,7 +319,7 @@ func (fs *FilerServer) mkdir(ctx context.Context, w http.ResponseWriter, r *http
 	}
 	mode, err := strconv.ParseUint(modeStr, 8, 32)
 	if err != nil {
-		glog.Errorf("Invalid mode format: %s, use 0660 by default", modeStr)
+		glog.ErrorfCtx(ctx, "Invalid mode format: %s, use 0660 by default", modeStr)
 		mode = 0660
 	}
 
@@ -294,7 +354,7 @@ func (fs *FilerServer) mkdir(ctx context.Context, w http.ResponseWriter, r *http
 	if dbErr := fs.filer.CreateEntry(ctx, entry, false, false, nil); dbErr != nil {
 		replyerr = dbErr
 		filerResult.Error = dbErr.Error()
-		glog.V(0).Infof("failing to create dir %s on filer server : %v", path, dbErr)
+		glog.V(0).InfofCtx(ctx, "failing to create dir %s on filer server : %v", path, dbErr)
 	}
 	return filerResult, replyerr
 }
@@ -312,6 +372,18 @@ func SaveAmzMetaData(r *http.Request, existing map[string][]byte, isReplace bool
 		metadata[xhttp.AmzStorageClass] = []byte(sc)
 	}
 
+	if acl := r.Header.Get(xhttp.AmzAcl); acl != "" {
+		metadata[xhttp.AmzAcl] = []byte(acl)
+	}
+
+	if sse := r.Header.Get(xhttp.AmzServerSideEncryption); sse != "" {
+		metadata[xhttp.AmzServerSideEncryption] = []byte(sse)
+	}
+
+	if cd := r.Header.Get("Content-Disposition"); cd != "" {
+		metadata["Content-Disposition"] = []byte(cd)
+	}
+
 	if tags := r.Header.Get(xhttp.AmzObjectTagging); tags != "" {
 		for _, v := range strings.Split(tags, "&") {
 			tag := strings.Split(v, "=")
@@ -12,6 +12,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/operation"
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/util"
 )
@@ -19,14 +20,6 @@ import (
 // handling single chunk POST or PUT upload
 func (fs *FilerServer) encrypt(ctx context.Context, w http.ResponseWriter, r *http.Request, so *operation.StorageOption) (filerResult *FilerPostResult, err error) {
 
-	fileId, urlLocation, auth, err := fs.assignNewFileInfo(so)
-
-	if err != nil || fileId == "" || urlLocation == "" {
-		return nil, fmt.Errorf("fail to allocate volume for %s, collection:%s, datacenter:%s", r.URL.Path, so.Collection, so.DataCenter)
-	}
-
-	glog.V(4).Infof("write %s to %v", r.URL.Path, urlLocation)
-
 	// Note: encrypt(gzip(data)), encrypt data first, then gzip
 
 	sizeLimit := int64(fs.option.MaxMB) * 1024 * 1024
@@ -44,9 +37,12 @@ func (fs *FilerServer) encrypt(ctx context.Context, w http.ResponseWriter, r *ht
 		// println("detect2 mimetype to", pu.MimeType)
 	}
 
-	uploadResult, uploadError := operation.UploadData(urlLocation, pu.FileName, true, uncompressedData, false, pu.MimeType, pu.PairMap, auth)
+	fileId, uploadResult, uploadError := fs.retriedUpload(so, func(urlLocation string, auth security.EncodedJwt) (*operation.UploadResult, error) {
+		glog.V(4).Infof("write %s to %v", r.URL.Path, urlLocation)
+		return operation.UploadData(urlLocation, pu.FileName, true, uncompressedData, false, pu.MimeType, pu.PairMap, auth)
+	})
 	if uploadError != nil {
-		return nil, fmt.Errorf("upload to volume server: %v", uploadError)
+		return nil, fmt.Errorf("upload %s to volume server, collection:%s, datacenter:%s: %v", r.URL.Path, so.Collection, so.DataCenter, uploadError)
 	}
 
 	// Save to chunk manifest structure
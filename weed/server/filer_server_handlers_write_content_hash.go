@@ -0,0 +1,106 @@
+package weed_server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// ContentSha256Header carries the hex encoded sha256 of the whole file content,
+// to create the file from the same content already uploaded, or to verify the uploaded content.
+const ContentSha256Header = "Seaweed-Content-Sha256"
+
+const emptySha256Hex = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+var (
+	ErrContentHashMismatch = errors.New("content sha256 mismatch")
+	ErrContentMd5Mismatch  = errors.New("content md5 mismatch")
+	ErrContentNotFound     = errors.New("content not found, send it in the request body")
+)
+
+// contentSha256 returns the normalized content hash from the request header, if any
+func contentSha256(r *http.Request) (string, error) {
+	sha256Hex := strings.ToLower(r.Header.Get(ContentSha256Header))
+	if sha256Hex == "" {
+		return "", nil
+	}
+	if decoded, err := hex.DecodeString(sha256Hex); err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid %s: %s", ContentSha256Header, sha256Hex)
+	}
+	return sha256Hex, nil
+}
+
+// saveByContentHash creates the file with the shared chunks of the same content already uploaded,
+// without reading the request body. Clients sending "Expect: 100-continue" only send the body if not found.
+func (fs *FilerServer) saveByContentHash(ctx context.Context, r *http.Request, so *operation.StorageOption, sha256Hex string) (filerResult *FilerPostResult, md5bytes []byte, found bool, err error) {
+
+	if !fs.option.DedupChunks || so.TtlSeconds != 0 || isAppend(r) {
+		return nil, nil, false, nil
+	}
+
+	fileKey := filer.DedupFileKey(sha256Hex, so.Collection, so.Replication, so.DiskType)
+	chunks, md5bytes, fileSize := fs.filer.ReferenceDedupFile(fileKey)
+	if chunks == nil {
+		return nil, nil, false, nil
+	}
+	stats.FilerRequestCounter.WithLabelValues("contentDedup").Inc()
+	glog.V(4).Infof("create %s with the same content %s", r.URL.Path, sha256Hex)
+
+	mtime := time.Now().UnixNano()
+	for _, chunk := range chunks {
+		chunk.Mtime = mtime
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "application/octet-stream" {
+		contentType = ""
+	}
+	filerResult, err = fs.saveMetaData(ctx, r, path.Base(r.URL.Path), contentType, so, md5bytes, chunks, int64(fileSize), nil)
+	if err != nil {
+		fs.filer.DereferenceDedupFile(chunks)
+	}
+	if filerResult != nil {
+		filerResult.Deduplicated = true
+	}
+	return filerResult, md5bytes, true, err
+}
+
+// verifyContentHash checks the uploaded content against the requested hash,
+// and indexes the file by its content hash to share its chunks later.
+func (fs *FilerServer) verifyContentHash(contentHash hash.Hash, sha256Hex string, so *operation.StorageOption, fileChunks []*filer_pb.FileChunk, md5bytes []byte, fileSize int64) error {
+	if actual := hex.EncodeToString(contentHash.Sum(nil)); actual != sha256Hex {
+		fs.filer.DeleteChunks(fileChunks)
+		return fmt.Errorf("%v: expected %s, actual %s", ErrContentHashMismatch, sha256Hex, actual)
+	}
+	if fs.option.DedupChunks && so.TtlSeconds == 0 && len(fileChunks) > 0 {
+		fs.filer.AddDedupFile(filer.DedupFileKey(sha256Hex, so.Collection, so.Replication, so.DiskType), fileChunks, md5bytes, uint64(fileSize))
+	}
+	return nil
+}
+
+// verifyContentMd5 checks the uploaded content against the base64 encoded md5 of the "Content-MD5" header, if any
+func (fs *FilerServer) verifyContentMd5(r *http.Request, fileChunks []*filer_pb.FileChunk, md5bytes []byte) error {
+	expected := r.Header.Get("Content-MD5")
+	if expected == "" {
+		return nil
+	}
+	if actual := util.Base64Encode(md5bytes); actual != expected {
+		fs.filer.DeleteChunks(fileChunks)
+		return fmt.Errorf("%v: expected %s, actual %s", ErrContentMd5Mismatch, expected, actual)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package weed_server
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"hash"
 	"io"
@@ -10,16 +11,17 @@ import (
 	"sort"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/chrislusf/seaweedfs/weed/filer"
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/operation"
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	xhttp "github.com/chrislusf/seaweedfs/weed/s3api/http"
 	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/stats"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 )
 
 var bufPool = sync.Pool{
@@ -28,28 +30,35 @@ var bufPool = sync.Pool{
 	},
 }
 
+// uploadReaderToChunks reads the request body into chunks, and uploads up to ConcurrentChunkUploads chunks in parallel.
+// Reading waits for a free upload slot, so at most ConcurrentChunkUploads chunk buffers are in memory.
+// The returned chunks are ordered by offset.
 func (fs *FilerServer) uploadReaderToChunks(w http.ResponseWriter, r *http.Request, reader io.Reader, chunkSize int32, fileName, contentType string, contentLength int64, so *operation.StorageOption) (fileChunks []*filer_pb.FileChunk, md5Hash hash.Hash, chunkOffset int64, uploadErr error, smallContent []byte) {
 
 	md5Hash = md5.New()
 	var partReader = ioutil.NopCloser(io.TeeReader(reader, md5Hash))
 
+	concurrentChunkUploads := fs.option.ConcurrentChunkUploads
+	if concurrentChunkUploads <= 0 {
+		concurrentChunkUploads = 1
+	}
+	uploadSlots := make(chan struct{}, concurrentChunkUploads)
+
 	var wg sync.WaitGroup
-	var bytesBufferCounter int64
-	bytesBufferLimitCond := sync.NewCond(new(sync.Mutex))
-	var fileChunksLock sync.Mutex
-	for {
-
-		// need to throttle used byte buffer
-		bytesBufferLimitCond.L.Lock()
-		for atomic.LoadInt64(&bytesBufferCounter) >= 4 {
-			glog.V(4).Infof("waiting for byte buffer %d", bytesBufferCounter)
-			bytesBufferLimitCond.Wait()
-		}
-		atomic.AddInt64(&bytesBufferCounter, 1)
-		bytesBufferLimitCond.L.Unlock()
+	var uploadLock sync.Mutex
+	hasUploadError := func() bool {
+		uploadLock.Lock()
+		defer uploadLock.Unlock()
+		return uploadErr != nil
+	}
+
+	for !hasUploadError() {
+
+		// wait for a free upload slot, to limit the used byte buffers
+		uploadSlots <- struct{}{}
 
 		bytesBuffer := bufPool.Get().(*bytes.Buffer)
-		glog.V(4).Infof("received byte buffer %d", bytesBufferCounter)
+		glog.V(4).Infof("received byte buffer %d", len(uploadSlots))
 
 		limitedReader := io.LimitReader(partReader, int64(chunkSize))
 
@@ -60,18 +69,17 @@ func (fs *FilerServer) uploadReaderToChunks(w http.ResponseWriter, r *http.Reque
 		// data, err := ioutil.ReadAll(limitedReader)
 		if err != nil || dataSize == 0 {
 			bufPool.Put(bytesBuffer)
-			atomic.AddInt64(&bytesBufferCounter, -1)
-			bytesBufferLimitCond.Signal()
+			<-uploadSlots
 			break
 		}
-		if chunkOffset == 0 && !isAppend(r) {
-			if dataSize < fs.option.SaveToFilerLimit || strings.HasPrefix(r.URL.Path, filer.DirectoryEtcRoot) {
+		// the encrypted objects are not saved in the filer store
+		if chunkOffset == 0 && !isAppend(r) && r.Header.Get(xhttp.AmzServerSideEncryption) == "" {
+			if dataSize < fs.saveToFilerLimit(r.URL.Path) || strings.HasPrefix(r.URL.Path, filer.DirectoryEtcRoot) {
 				chunkOffset += dataSize
 				smallContent = make([]byte, dataSize)
 				bytesBuffer.Read(smallContent)
 				bufPool.Put(bytesBuffer)
-				atomic.AddInt64(&bytesBufferCounter, -1)
-				bytesBufferLimitCond.Signal()
+				<-uploadSlots
 				break
 			}
 		}
@@ -80,19 +88,20 @@ func (fs *FilerServer) uploadReaderToChunks(w http.ResponseWriter, r *http.Reque
 		go func(offset int64) {
 			defer func() {
 				bufPool.Put(bytesBuffer)
-				atomic.AddInt64(&bytesBufferCounter, -1)
-				bytesBufferLimitCond.Signal()
+				<-uploadSlots
 				wg.Done()
 			}()
 
-			chunk, toChunkErr := fs.dataToChunk(fileName, contentType, bytesBuffer.Bytes(), offset, so)
+			chunk, toChunkErr := fs.dataToChunk(r.Context(), fileName, contentType, bytesBuffer.Bytes(), offset, so)
+
+			uploadLock.Lock()
+			defer uploadLock.Unlock()
 			if toChunkErr != nil {
+				// stop reading the following chunks
 				uploadErr = toChunkErr
 			}
 			if chunk != nil {
-				fileChunksLock.Lock()
 				fileChunks = append(fileChunks, chunk)
-				fileChunksLock.Unlock()
 				glog.V(4).Infof("uploaded %s chunk %d to %s [%d,%d)", fileName, len(fileChunks), chunk.FileId, offset, offset+int64(chunk.Size))
 			}
 		}(chunkOffset)
@@ -119,7 +128,7 @@ func (fs *FilerServer) uploadReaderToChunks(w http.ResponseWriter, r *http.Reque
 	return fileChunks, md5Hash, chunkOffset, nil, smallContent
 }
 
-func (fs *FilerServer) doUpload(urlLocation string, limitedReader io.Reader, fileName string, contentType string, pairMap map[string]string, auth security.EncodedJwt) (*operation.UploadResult, error, []byte) {
+func (fs *FilerServer) doUpload(urlLocation string, limitedReader io.Reader, fileName string, contentType string, cipher bool, pairMap map[string]string, auth security.EncodedJwt) (*operation.UploadResult, error, []byte) {
 
 	stats.FilerRequestCounter.WithLabelValues("chunkUpload").Inc()
 	start := time.Now()
@@ -127,41 +136,44 @@ func (fs *FilerServer) doUpload(urlLocation string, limitedReader io.Reader, fil
 		stats.FilerRequestHistogram.WithLabelValues("chunkUpload").Observe(time.Since(start).Seconds())
 	}()
 
-	uploadResult, err, data := operation.Upload(urlLocation, fileName, fs.option.Cipher, limitedReader, false, contentType, pairMap, auth)
+	uploadResult, err, data := operation.Upload(urlLocation, fileName, cipher, limitedReader, false, contentType, pairMap, auth)
 	if uploadResult != nil && uploadResult.RetryCount > 0 {
 		stats.FilerRequestCounter.WithLabelValues("chunkUploadRetry").Add(float64(uploadResult.RetryCount))
 	}
 	return uploadResult, err, data
 }
 
-func (fs *FilerServer) dataToChunk(fileName, contentType string, data []byte, chunkOffset int64, so *operation.StorageOption) (*filer_pb.FileChunk, error) {
-	dataReader := util.NewBytesReader(data)
-
-	// retry to assign a different file id
-	var fileId, urlLocation string
-	var auth security.EncodedJwt
-	var uploadErr error
-	var uploadResult *operation.UploadResult
-	for i := 0; i < 3; i++ {
-		// assign one file id for one chunk
-		fileId, urlLocation, auth, uploadErr = fs.assignNewFileInfo(so)
-		if uploadErr != nil {
-			glog.V(4).Infof("retry later due to assign error: %v", uploadErr)
-			time.Sleep(time.Duration(i+1) * 251 * time.Millisecond)
-			continue
-		}
+func (fs *FilerServer) dataToChunk(ctx context.Context, fileName, contentType string, data []byte, chunkOffset int64, so *operation.StorageOption) (*filer_pb.FileChunk, error) {
 
-		// upload the chunk to the volume server
-		uploadResult, uploadErr, _ = fs.doUpload(urlLocation, dataReader, fileName, contentType, nil, auth)
-		if uploadErr != nil {
-			glog.V(4).Infof("retry later due to upload error: %v", uploadErr)
-			time.Sleep(time.Duration(i+1) * 251 * time.Millisecond)
-			continue
+	// the all-zero data is kept as a hole of the sparse file, without allocating storage
+	if util.IsZeroBytes(data) {
+		stats.FilerRequestCounter.WithLabelValues("chunkZero").Inc()
+		return nil, nil
+	}
+
+	// the chunks on expiring volumes are not shared, nor the chunks encrypted only for some objects
+	var dedupHashKey string
+	if fs.option.DedupChunks && so.TtlSeconds == 0 && so.Cipher == fs.option.Cipher {
+		dedupHashKey = filer.DedupHashKey(data, so.Collection, so.Replication, so.DiskType)
+		if chunk := fs.filer.ReferenceDedupChunk(dedupHashKey); chunk != nil {
+			stats.FilerRequestCounter.WithLabelValues("chunkDedup").Inc()
+			chunk.Offset = chunkOffset
+			chunk.Mtime = time.Now().UnixNano()
+			return chunk, nil
 		}
-		break
 	}
+
+	// the request id is passed along in the upload request header, which is not saved with the needle
+	var pairMap map[string]string
+	if id := request_id.Get(ctx); id != "" {
+		pairMap = map[string]string{request_id.Header: id}
+	}
+	fileId, uploadResult, uploadErr := fs.retriedUpload(so, func(urlLocation string, auth security.EncodedJwt) (uploadResult *operation.UploadResult, err error) {
+		uploadResult, err, _ = fs.doUpload(urlLocation, util.NewBytesReader(data), fileName, contentType, so.Cipher, pairMap, auth)
+		return
+	})
 	if uploadErr != nil {
-		glog.Errorf("upload error: %v", uploadErr)
+		glog.ErrorfCtx(ctx, "upload error: %v", uploadErr)
 		return nil, uploadErr
 	}
 
@@ -170,5 +182,44 @@ func (fs *FilerServer) dataToChunk(fileName, contentType string, data []byte, ch
 		return nil, nil
 	}
 
-	return uploadResult.ToPbFileChunk(fileId, chunkOffset), nil
+	chunk := uploadResult.ToPbFileChunk(fileId, chunkOffset)
+	if dedupHashKey != "" {
+		fs.filer.AddDedupChunk(dedupHashKey, chunk)
+	}
+	return chunk, nil
+}
+
+// retriedUpload assigns a file id and uploads to it, up to ChunkUploadAttempts times.
+// After an upload fails or times out, the file id is assigned on another volume server if possible.
+func (fs *FilerServer) retriedUpload(so *operation.StorageOption, upload func(urlLocation string, auth security.EncodedJwt) (*operation.UploadResult, error)) (fileId string, uploadResult *operation.UploadResult, err error) {
+
+	attempts := fs.option.ChunkUploadAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+	failedServers := make(map[string]bool)
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(i) * 251 * time.Millisecond)
+		}
+
+		var urlLocation, server string
+		var auth security.EncodedJwt
+		fileId, urlLocation, server, auth, err = fs.assignNewFileInfoAvoiding(so, failedServers)
+		if err != nil {
+			glog.V(4).Infof("retry later due to assign error: %v", err)
+			continue
+		}
+
+		uploadResult, err = upload(urlLocation, auth)
+		if err == nil {
+			if i > 0 {
+				stats.FilerRequestCounter.WithLabelValues("chunkUploadReassign").Add(float64(i))
+			}
+			return
+		}
+		glog.V(0).Infof("upload %s to %s, attempt %d of %d: %v", fileId, server, i+1, attempts, err)
+		failedServers[server] = true
+	}
+	return
 }
@@ -0,0 +1,233 @@
+package weed_server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// FilerHttpConf is the CORS configuration and the custom response headers of the filer http endpoints,
+// configured in the [filer.http] section of filer.toml, with optional per-path overrides.
+type FilerHttpConf struct {
+	global *HttpPathConf
+	// sorted by the path prefix, the longest first
+	locations []*HttpPathConf
+}
+
+type HttpPathConf struct {
+	PathPrefix string
+
+	// the origins allowed for the cross-origin requests, "*" for all, empty to disable CORS
+	CorsAllowedOrigins   []string
+	CorsAllowedMethods   []string
+	CorsAllowedHeaders   []string
+	CorsExposeHeaders    []string
+	CorsMaxAgeSeconds    int
+	CorsAllowCredentials bool
+
+	// added to the responses, e.g., Cache-Control or X-Frame-Options.
+	// The headers saved with the files, e.g., Cache-Control, take precedence.
+	Headers map[string]string
+}
+
+// LoadFilerHttpConf reads the [filer.http] section of filer.toml, and the [[filer.http.locations]] overriding it by the path prefixes
+func LoadFilerHttpConf(v *util.ViperProxy) (*FilerHttpConf, error) {
+	v.SetDefault("filer.http.cors_allowed_origins", []string{"*"})
+	v.SetDefault("filer.http.cors_allowed_methods", []string{"PUT", "POST", "GET", "DELETE", "OPTIONS"})
+	v.SetDefault("filer.http.cors_allowed_headers", []string{"*"})
+	v.SetDefault("filer.http.cors_allow_credentials", true)
+	global := &HttpPathConf{
+		CorsAllowedOrigins:   v.GetStringSlice("filer.http.cors_allowed_origins"),
+		CorsAllowedMethods:   toUpper(v.GetStringSlice("filer.http.cors_allowed_methods")),
+		CorsAllowedHeaders:   v.GetStringSlice("filer.http.cors_allowed_headers"),
+		CorsExposeHeaders:    v.GetStringSlice("filer.http.cors_expose_headers"),
+		CorsMaxAgeSeconds:    v.GetInt("filer.http.cors_max_age_seconds"),
+		CorsAllowCredentials: v.GetBool("filer.http.cors_allow_credentials"),
+		Headers:              make(map[string]string),
+	}
+	for name, value := range v.GetStringMapString("filer.http.headers") {
+		global.Headers[http.CanonicalHeaderKey(name)] = value
+	}
+	conf := &FilerHttpConf{global: global}
+
+	items, _ := v.Get("filer.http.locations").([]interface{})
+	for _, item := range items {
+		values, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected filer.http.locations %v", item)
+		}
+		pathConf := global.clone()
+		if err := pathConf.load(values); err != nil {
+			return nil, fmt.Errorf("filer.http.locations %v: %v", item, err)
+		}
+		if pathConf.PathPrefix == "" {
+			return nil, fmt.Errorf("filer.http.locations %v needs path_prefix", item)
+		}
+		conf.locations = append(conf.locations, pathConf)
+	}
+	sort.SliceStable(conf.locations, func(i, j int) bool {
+		return len(conf.locations[i].PathPrefix) > len(conf.locations[j].PathPrefix)
+	})
+
+	return conf, nil
+}
+
+func (fs *FilerServer) loadHttpConf() error {
+	conf, err := LoadFilerHttpConf(util.GetViper())
+	if err != nil {
+		return err
+	}
+	fs.httpConfLock.Lock()
+	fs.httpConf = conf
+	fs.httpConfLock.Unlock()
+	return nil
+}
+
+// matchHttpPathConf finds the http configuration of the request path
+func (fs *FilerServer) matchHttpPathConf(r *http.Request) *HttpPathConf {
+	fs.httpConfLock.RLock()
+	defer fs.httpConfLock.RUnlock()
+	return fs.httpConf.MatchPath(r.URL.Path)
+}
+
+// MatchPath finds the configuration with the longest path prefix of the path, or the global configuration
+func (conf *FilerHttpConf) MatchPath(path string) *HttpPathConf {
+	for _, location := range conf.locations {
+		if strings.HasPrefix(path, location.PathPrefix) {
+			return location
+		}
+	}
+	return conf.global
+}
+
+func (pc *HttpPathConf) clone() *HttpPathConf {
+	c := *pc
+	c.Headers = make(map[string]string, len(pc.Headers))
+	for k, v := range pc.Headers {
+		c.Headers[k] = v
+	}
+	return &c
+}
+
+// load applies the configured values, the headers are merged with the inherited ones
+func (pc *HttpPathConf) load(values map[string]interface{}) (err error) {
+	for key, value := range values {
+		switch key {
+		case "path_prefix":
+			pc.PathPrefix = fmt.Sprint(value)
+		case "cors_allowed_origins":
+			pc.CorsAllowedOrigins = toStringSlice(value)
+		case "cors_allowed_methods":
+			pc.CorsAllowedMethods = toUpper(toStringSlice(value))
+		case "cors_allowed_headers":
+			pc.CorsAllowedHeaders = toStringSlice(value)
+		case "cors_expose_headers":
+			pc.CorsExposeHeaders = toStringSlice(value)
+		case "cors_max_age_seconds":
+			if pc.CorsMaxAgeSeconds, err = strconv.Atoi(fmt.Sprint(value)); err != nil {
+				return fmt.Errorf("cors_max_age_seconds: %v", err)
+			}
+		case "cors_allow_credentials":
+			if pc.CorsAllowCredentials, err = strconv.ParseBool(fmt.Sprint(value)); err != nil {
+				return fmt.Errorf("cors_allow_credentials: %v", err)
+			}
+		case "headers":
+			headers, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("headers: not a table")
+			}
+			for name, headerValue := range headers {
+				pc.Headers[http.CanonicalHeaderKey(name)] = fmt.Sprint(headerValue)
+			}
+		default:
+			glog.Warningf("unknown filer http option %s", key)
+		}
+	}
+	return nil
+}
+
+func toUpper(values []string) []string {
+	for i, value := range values {
+		values[i] = strings.ToUpper(value)
+	}
+	return values
+}
+
+// toStringSlice accepts a list, or a comma-separated string as from the environment variables
+func toStringSlice(value interface{}) (values []string) {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, s := range v {
+			values = append(values, fmt.Sprint(s))
+		}
+	case []string:
+		values = v
+	default:
+		for _, s := range strings.Split(fmt.Sprint(v), ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	return
+}
+
+func (pc *HttpPathConf) isOriginAllowed(origin string) (allowed, anyOrigin bool) {
+	for _, allowedOrigin := range pc.CorsAllowedOrigins {
+		if allowedOrigin == "*" {
+			return true, true
+		}
+		if strings.EqualFold(allowedOrigin, origin) {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// setResponseHeaders sets the custom headers, and the CORS headers if the origin of the request is allowed
+func (pc *HttpPathConf) setResponseHeaders(w http.ResponseWriter, r *http.Request) {
+	for name, value := range pc.Headers {
+		w.Header().Set(name, value)
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+	allowed, anyOrigin := pc.isOriginAllowed(origin)
+	if !allowed {
+		return
+	}
+	if anyOrigin {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+	}
+	if pc.CorsAllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+	if len(pc.CorsExposeHeaders) > 0 {
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(pc.CorsExposeHeaders, ","))
+	}
+}
+
+// setPreflightHeaders answers the CORS preflight requests, only with the read methods for the read-only endpoint
+func (pc *HttpPathConf) setPreflightHeaders(w http.ResponseWriter, r *http.Request, isReadOnly bool) {
+	var methods []string
+	for _, method := range pc.CorsAllowedMethods {
+		if !isReadOnly || method == "GET" || method == "HEAD" || method == "OPTIONS" {
+			methods = append(methods, method)
+		}
+	}
+	w.Header().Add("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	w.Header().Add("Access-Control-Allow-Headers", strings.Join(pc.CorsAllowedHeaders, ", "))
+	if pc.CorsMaxAgeSeconds > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(pc.CorsMaxAgeSeconds))
+	}
+}
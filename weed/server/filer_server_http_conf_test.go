@@ -0,0 +1,96 @@
+package weed_server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+func loadTestHttpConf(t *testing.T, toml string) *FilerHttpConf {
+	v := viper.New()
+	v.SetConfigType("toml")
+	assert.Equal(t, nil, v.ReadConfig(strings.NewReader(toml)))
+	conf, err := LoadFilerHttpConf(&util.ViperProxy{Viper: v})
+	assert.Equal(t, nil, err)
+	return conf
+}
+
+func TestFilerHttpConfDefault(t *testing.T) {
+	conf := loadTestHttpConf(t, "")
+
+	r := httptest.NewRequest("OPTIONS", "/a/b.txt", nil)
+	r.Header.Set("Origin", "https://example.com")
+	w := httptest.NewRecorder()
+	pathConf := conf.MatchPath(r.URL.Path)
+	pathConf.setResponseHeaders(w, r)
+	pathConf.setPreflightHeaders(w, r, true)
+
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "", w.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestFilerHttpConfLocations(t *testing.T) {
+	conf := loadTestHttpConf(t, `
+[filer.http]
+cors_allowed_origins = ["https://example.com"]
+cors_max_age_seconds = 600
+
+[filer.http.headers]
+X-Frame-Options = "DENY"
+
+[[filer.http.locations]]
+path_prefix = "/static/"
+cors_allowed_origins = ["*"]
+cors_allowed_methods = ["get"]
+cors_allow_credentials = false
+headers = { "Cache-Control" = "public, max-age=86400" }
+`)
+
+	// the global configuration only allows the configured origin
+	r := httptest.NewRequest("GET", "/a/b.txt", nil)
+	r.Header.Set("Origin", "https://other.com")
+	w := httptest.NewRecorder()
+	conf.MatchPath(r.URL.Path).setResponseHeaders(w, r)
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "", w.Header().Get("Cache-Control"))
+
+	r.Header.Set("Origin", "https://example.com")
+	w = httptest.NewRecorder()
+	conf.MatchPath(r.URL.Path).setResponseHeaders(w, r)
+	assert.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+
+	// the location inherits the headers and the max age
+	r = httptest.NewRequest("OPTIONS", "/static/app.js", nil)
+	r.Header.Set("Origin", "https://other.com")
+	w = httptest.NewRecorder()
+	pathConf := conf.MatchPath(r.URL.Path)
+	pathConf.setResponseHeaders(w, r)
+	pathConf.setPreflightHeaders(w, r, false)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "public, max-age=86400", w.Header().Get("Cache-Control"))
+}
+
+func TestFilerHttpConfLocationWithoutPrefix(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("toml")
+	v.ReadConfig(strings.NewReader(`
+[[filer.http.locations]]
+cors_allowed_origins = ["*"]
+`))
+	_, err := LoadFilerHttpConf(&util.ViperProxy{Viper: v})
+	assert.NotEqual(t, nil, err)
+}
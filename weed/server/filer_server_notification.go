@@ -0,0 +1,177 @@
+package weed_server
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/notification"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/log_buffer"
+)
+
+const (
+	// followed by the filer address, since the filers sharing a store also share the store signature
+	notificationOffsetKey          = "notification.offset"
+	notificationOffsetSaveInterval = 3 * time.Second
+	notificationMaxRetryWait       = time.Minute
+)
+
+var errNotificationStopped = fmt.Errorf("notification stopped")
+
+// startNotifying sends the events in the local metadata log to the notification message queue.
+// The events are read again since the last saved offset after the filer restarts,
+// and a failed event is retried until it is sent, so each event is sent at least once.
+func (fs *FilerServer) startNotifying() {
+	if notification.Queue == nil {
+		return
+	}
+
+	lastTsNs, err := fs.loadNotificationOffset()
+	if err != nil {
+		glog.Fatalf("load notification offset: %v", err)
+	}
+	if lastTsNs == 0 {
+		lastTsNs = time.Now().UnixNano()
+	}
+	glog.V(0).Infof("notify %s since %v", notification.Queue.GetName(), time.Unix(0, lastTsNs))
+
+	fs.notificationDone = make(chan struct{})
+	go func() {
+		defer close(fs.notificationDone)
+		fs.loopNotifying(lastTsNs)
+	}()
+}
+
+// stopNotifying waits for the notification loop to save the offset
+func (fs *FilerServer) stopNotifying() {
+	if fs.notificationDone == nil {
+		return
+	}
+	atomic.StoreInt32(&fs.notificationStopped, 1)
+	fs.listenersLock.Lock()
+	fs.listenersCond.Broadcast()
+	fs.listenersLock.Unlock()
+	<-fs.notificationDone
+}
+
+func (fs *FilerServer) isNotificationStopped() bool {
+	return atomic.LoadInt32(&fs.notificationStopped) == 1
+}
+
+func (fs *FilerServer) loopNotifying(lastTsNs int64) {
+
+	savedTsNs := lastTsNs
+	lastSaveTime := time.Now()
+	saveOffset := func() {
+		if lastTsNs == savedTsNs {
+			return
+		}
+		if err := fs.saveNotificationOffset(lastTsNs); err != nil {
+			glog.Errorf("save notification offset: %v", err)
+			return
+		}
+		savedTsNs, lastSaveTime = lastTsNs, time.Now()
+	}
+	defer saveOffset()
+
+	eachLogEntryFn := eachLogEntryFn(func(dirPath string, eventNotification *filer_pb.EventNotification, tsNs int64) error {
+		eventNotification.TsNs = tsNs
+		if err := fs.sendNotification(dirPath, eventNotification); err != nil {
+			return err
+		}
+		lastTsNs = tsNs
+		if time.Since(lastSaveTime) > notificationOffsetSaveInterval {
+			saveOffset()
+		}
+		return nil
+	})
+
+	lastReadTime := time.Unix(0, lastTsNs)
+	var readInMemoryLogErr error
+	for !fs.isNotificationStopped() {
+
+		processedTsNs, readPersistedLogErr := fs.filer.ReadPersistedLogBuffer(lastReadTime, eachLogEntryFn)
+		if readPersistedLogErr != nil {
+			if readPersistedLogErr != errNotificationStopped {
+				glog.Errorf("notify from persisted logs since %v: %v", lastReadTime, readPersistedLogErr)
+				time.Sleep(1127 * time.Millisecond)
+			}
+			continue
+		}
+		if processedTsNs != 0 {
+			lastReadTime = time.Unix(0, processedTsNs)
+		}
+
+		lastReadTime, readInMemoryLogErr = fs.filer.LocalMetaLogBuffer.LoopProcessLogData("notification", lastReadTime, func() bool {
+			fs.listenersLock.Lock()
+			defer fs.listenersLock.Unlock()
+			if fs.isNotificationStopped() {
+				return false
+			}
+			fs.listenersCond.Wait()
+			return !fs.isNotificationStopped()
+		}, eachLogEntryFn)
+		if readInMemoryLogErr != nil && readInMemoryLogErr != log_buffer.ResumeFromDiskError && readInMemoryLogErr != errNotificationStopped {
+			glog.Errorf("notify since %v: %v", lastReadTime, readInMemoryLogErr)
+			time.Sleep(1127 * time.Millisecond)
+		}
+	}
+
+}
+
+// sendNotification retries until the event is sent, or the filer stops
+func (fs *FilerServer) sendNotification(dirPath string, eventNotification *filer_pb.EventNotification) error {
+	name := eventNotification.NewEntry.GetName()
+	if eventNotification.OldEntry != nil {
+		name = eventNotification.OldEntry.Name
+	}
+	fullpath := string(util.NewFullPath(dirPath, name))
+
+	waitTime := time.Second
+	for {
+		err := notification.SendMessage(fullpath, eventNotification)
+		if err == nil {
+			return nil
+		}
+		glog.Errorf("notify %s, retry in %v: %v", fullpath, waitTime, err)
+		for deadline := time.Now().Add(waitTime); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+			if fs.isNotificationStopped() {
+				return errNotificationStopped
+			}
+		}
+		if waitTime *= 2; waitTime > notificationMaxRetryWait {
+			waitTime = notificationMaxRetryWait
+		}
+	}
+}
+
+// notificationOffsetKeyOfFiler is different for each of the filers sharing a store, which send their own local events
+func (fs *FilerServer) notificationOffsetKeyOfFiler() []byte {
+	return []byte(notificationOffsetKey + "." + util.JoinHostPort(fs.option.Host, int(fs.option.Port)))
+}
+
+func (fs *FilerServer) loadNotificationOffset() (int64, error) {
+	value, err := fs.filer.Store.KvGet(context.Background(), fs.notificationOffsetKeyOfFiler())
+	if err == filer.ErrKvNotFound {
+		// saved by the previous versions without the filer address
+		value, err = fs.filer.Store.KvGet(context.Background(), []byte(notificationOffsetKey))
+	}
+	if err == filer.ErrKvNotFound || err == nil && len(value) < 8 {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int64(util.BytesToUint64(value)), nil
+}
+
+func (fs *FilerServer) saveNotificationOffset(tsNs int64) error {
+	value := make([]byte, 8)
+	util.Uint64toBytes(value, uint64(tsNs))
+	return fs.filer.Store.KvPut(context.Background(), fs.notificationOffsetKeyOfFiler(), value)
+}
@@ -0,0 +1,147 @@
+package weed_server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// Preconditions are the conditional request headers, see https://tools.ietf.org/html/rfc7232
+type Preconditions struct {
+	IfMatch           string
+	IfNoneMatch       string
+	IfModifiedSince   string
+	IfUnmodifiedSince string
+}
+
+// NewPreconditions reads the conditional request headers, optionally with a prefix, e.g., "X-Amz-Copy-Source-"
+func NewPreconditions(h http.Header, prefix string) Preconditions {
+	return Preconditions{
+		IfMatch:           h.Get(prefix + "If-Match"),
+		IfNoneMatch:       h.Get(prefix + "If-None-Match"),
+		IfModifiedSince:   h.Get(prefix + "If-Modified-Since"),
+		IfUnmodifiedSince: h.Get(prefix + "If-Unmodified-Since"),
+	}
+}
+
+func (p Preconditions) IsEmpty() bool {
+	return p.IfMatch == "" && p.IfNoneMatch == "" && p.IfModifiedSince == "" && p.IfUnmodifiedSince == ""
+}
+
+// Evaluate checks the preconditions against the current file, in the order of RFC 7232 section 6.
+// It returns http.StatusOK if all preconditions hold, http.StatusPreconditionFailed if If-Match or If-Unmodified-Since fails,
+// or notModifiedStatus if If-None-Match or If-Modified-Since fails.
+// The If-Unmodified-Since is ignored with If-Match, and the If-Modified-Since is ignored with If-None-Match.
+func (p Preconditions) Evaluate(exists bool, etag string, mtime time.Time, notModifiedStatus int) int {
+
+	if p.IfMatch != "" {
+		if !exists || !matchEtag(p.IfMatch, etag) {
+			return http.StatusPreconditionFailed
+		}
+	} else if p.IfUnmodifiedSince != "" && exists {
+		if t, err := time.Parse(http.TimeFormat, p.IfUnmodifiedSince); err == nil && mtime.Unix() > t.Unix() {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if p.IfNoneMatch != "" {
+		if exists && matchEtag(p.IfNoneMatch, etag) {
+			return notModifiedStatus
+		}
+	} else if p.IfModifiedSince != "" && exists {
+		if t, err := time.Parse(http.TimeFormat, p.IfModifiedSince); err == nil && mtime.Unix() <= t.Unix() {
+			return notModifiedStatus
+		}
+	}
+
+	return http.StatusOK
+}
+
+// matchEtag checks the etag against a list of entity tags, or "*" for any existing file
+func matchEtag(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		tag = strings.TrimPrefix(tag, "W/")
+		if strings.Trim(tag, "\"") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWritePreconditions checks the conditional headers of a write request against the existing file
+func (fs *FilerServer) checkWritePreconditions(ctx context.Context, r *http.Request) error {
+
+	preconditions := NewPreconditions(r.Header, "")
+	// only applicable to reads
+	preconditions.IfModifiedSince = ""
+	if preconditions.IsEmpty() || strings.HasSuffix(r.URL.Path, "/") {
+		return nil
+	}
+
+	var etag string
+	var mtime time.Time
+	entry, err := fs.filer.FindEntry(ctx, util.FullPath(r.URL.Path))
+	if err != nil && err != filer_pb.ErrNotFound {
+		return err
+	}
+	exists := entry != nil && !entry.IsDirectory()
+	if exists {
+		etag, mtime = filer.ETagEntry(entry), entry.Attr.Mtime
+	}
+
+	if preconditions.Evaluate(exists, etag, mtime, http.StatusPreconditionFailed) != http.StatusOK {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// pathLocks serializes the writes to the same path through this filer,
+// so that no other write to the file can happen between checking its preconditions and writing it.
+// The writes through other filers sharing the store are not serialized.
+type pathLocks struct {
+	sync.Mutex
+	locks map[string]*pathLock
+}
+
+type pathLock struct {
+	sync.Mutex
+	waiters int
+}
+
+func (l *pathLocks) lock(path string) (unlock func()) {
+	l.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*pathLock)
+	}
+	pl, found := l.locks[path]
+	if !found {
+		pl = &pathLock{}
+		l.locks[path] = pl
+	}
+	pl.waiters++
+	l.Unlock()
+
+	pl.Lock()
+	return func() {
+		pl.Unlock()
+		l.Lock()
+		pl.waiters--
+		if pl.waiters == 0 {
+			delete(l.locks, path)
+		}
+		l.Unlock()
+	}
+}
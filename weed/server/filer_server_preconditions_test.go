@@ -0,0 +1,77 @@
+package weed_server
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreconditionsEvaluate(t *testing.T) {
+
+	mtime := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	before := mtime.Add(-time.Hour).Format(http.TimeFormat)
+	after := mtime.Add(time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		p      Preconditions
+		exists bool
+		status int
+	}{
+		{Preconditions{}, true, http.StatusOK},
+		{Preconditions{IfMatch: `"abc"`}, true, http.StatusOK},
+		{Preconditions{IfMatch: `"xyz", "abc"`}, true, http.StatusOK},
+		{Preconditions{IfMatch: `"xyz"`}, true, http.StatusPreconditionFailed},
+		{Preconditions{IfMatch: "*"}, false, http.StatusPreconditionFailed},
+		{Preconditions{IfMatch: `"abc"`, IfUnmodifiedSince: before}, true, http.StatusOK},
+		{Preconditions{IfUnmodifiedSince: before}, true, http.StatusPreconditionFailed},
+		{Preconditions{IfUnmodifiedSince: after}, true, http.StatusOK},
+		{Preconditions{IfNoneMatch: `W/"abc"`}, true, http.StatusNotModified},
+		{Preconditions{IfNoneMatch: "*"}, true, http.StatusNotModified},
+		{Preconditions{IfNoneMatch: "*"}, false, http.StatusOK},
+		{Preconditions{IfNoneMatch: `"xyz"`, IfModifiedSince: after}, true, http.StatusOK},
+		{Preconditions{IfModifiedSince: after}, true, http.StatusNotModified},
+		{Preconditions{IfModifiedSince: before}, true, http.StatusOK},
+		{Preconditions{IfMatch: `"xyz"`, IfNoneMatch: `"abc"`}, true, http.StatusPreconditionFailed},
+	}
+
+	for i, tt := range tests {
+		assert.Equal(t, tt.status, tt.p.Evaluate(tt.exists, "abc", mtime, http.StatusNotModified), "case %d", i)
+	}
+
+}
+
+func TestPathLocks(t *testing.T) {
+
+	var locks pathLocks
+	var wg sync.WaitGroup
+	var running, maxRunning int
+	var counterLock sync.Mutex
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := locks.lock("/a/b.txt")
+			defer unlock()
+			counterLock.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			counterLock.Unlock()
+			time.Sleep(time.Millisecond)
+			counterLock.Lock()
+			running--
+			counterLock.Unlock()
+		}()
+	}
+
+	// a different path is not blocked
+	locks.lock("/a/c.txt")()
+
+	wg.Wait()
+	assert.Equal(t, 1, maxRunning, "concurrent writes to the same path")
+	assert.Equal(t, 0, len(locks.locks), "unused locks are kept")
+}
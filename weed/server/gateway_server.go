@@ -63,8 +63,12 @@ func NewGatewayServer(defaultMux *http.ServeMux, option *GatewayOption) (fs *Gat
 }
 
 func (fs *GatewayServer) getMaster() string {
-	randMaster := rand.Intn(len(fs.option.Masters))
-	return fs.option.Masters[randMaster]
+	masters := util.ResolveServerAddresses(fs.option.Masters)
+	if len(masters) == 0 {
+		masters = fs.option.Masters
+	}
+	randMaster := rand.Intn(len(masters))
+	return masters[randMaster]
 }
 
 func (fs *GatewayServer) blobsHandler(w http.ResponseWriter, r *http.Request) {
@@ -15,6 +15,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/topology"
+	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
 func (ms *MasterServer) SendHeartbeat(stream master_pb.Seaweed_SendHeartbeatServer) error {
@@ -22,31 +23,8 @@ func (ms *MasterServer) SendHeartbeat(stream master_pb.Seaweed_SendHeartbeatServ
 
 	defer func() {
 		if dn != nil {
-
-			// if the volume server disconnects and reconnects quickly
-			//  the unregister and register can race with each other
-			ms.Topo.UnRegisterDataNode(dn)
-			glog.V(0).Infof("unregister disconnected volume server %s:%d", dn.Ip, dn.Port)
-
-			message := &master_pb.VolumeLocation{
-				Url:       dn.Url(),
-				PublicUrl: dn.PublicUrl,
-			}
-			for _, v := range dn.GetVolumes() {
-				message.DeletedVids = append(message.DeletedVids, uint32(v.Id))
-			}
-			for _, s := range dn.GetEcShards() {
-				message.DeletedVids = append(message.DeletedVids, uint32(s.VolumeId))
-			}
-
-			if len(message.DeletedVids) > 0 {
-				ms.clientChansLock.RLock()
-				for _, ch := range ms.clientChans {
-					ch <- message
-				}
-				ms.clientChansLock.RUnlock()
-			}
-
+			// keep the volume locations for the grace period, in case the volume server reconnects soon
+			ms.Topo.DataNodeDisconnected(dn)
 		}
 	}()
 
@@ -67,7 +45,12 @@ func (ms *MasterServer) SendHeartbeat(stream master_pb.Seaweed_SendHeartbeatServ
 			dcName, rackName := ms.Topo.Configuration.Locate(heartbeat.Ip, heartbeat.DataCenter, heartbeat.Rack)
 			dc := ms.Topo.GetOrCreateDataCenter(dcName)
 			rack := dc.GetOrCreateRack(rackName)
+			isNewDataNode := rack.FindDataNode(heartbeat.Ip, int(heartbeat.Port)) == nil
 			dn = rack.GetOrCreateDataNode(heartbeat.Ip, int(heartbeat.Port), heartbeat.PublicUrl, heartbeat.MaxVolumeCounts)
+			ms.Topo.DataNodeConnected(dn)
+			if isNewDataNode {
+				ms.Topo.NotifyDataNodeJoin(dn)
+			}
 			glog.V(0).Infof("added volume server %v:%d", heartbeat.GetIp(), heartbeat.GetPort())
 			if err := stream.Send(&master_pb.HeartbeatResponse{
 				VolumeSizeLimit: uint64(ms.option.VolumeSizeLimitMB) * 1024 * 1024,
@@ -77,17 +60,25 @@ func (ms *MasterServer) SendHeartbeat(stream master_pb.Seaweed_SendHeartbeatServ
 			}
 		}
 
+		if dn.GetState() == topology.NodeStateDead {
+			// the volume server reconnects to register again with a full heartbeat
+			return fmt.Errorf("volume server %s:%d was not seen for too long", dn.Ip, dn.Port)
+		}
+		ms.Topo.DataNodeHeartbeat(dn)
+
 		dn.AdjustMaxVolumeCounts(heartbeat.MaxVolumeCounts)
 
 		glog.V(4).Infof("master received heartbeat %s", heartbeat.String())
-		var dataCenter string
+		var dataCenter, rack string
 		if dc := dn.GetDataCenter(); dc != nil {
 			dataCenter = string(dc.Id())
+			rack = string(dn.GetRack().Id())
 		}
 		message := &master_pb.VolumeLocation{
 			Url:        dn.Url(),
 			PublicUrl:  dn.PublicUrl,
 			DataCenter: dataCenter,
+			Rack:       rack,
 		}
 		if len(heartbeat.NewVolumes) > 0 || len(heartbeat.DeletedVolumes) > 0 {
 			// process delta volume ids if exists for fast volume id updates
@@ -101,6 +92,14 @@ func (ms *MasterServer) SendHeartbeat(stream master_pb.Seaweed_SendHeartbeatServ
 			ms.Topo.IncrementalSyncDataNodeRegistration(heartbeat.NewVolumes, heartbeat.DeletedVolumes, dn)
 		}
 
+		if len(heartbeat.UpdatedVolumes) > 0 {
+			// process volumes with changed status in an incremental heartbeat
+			for _, v := range ms.Topo.IncrementalSyncDataNodeVolumes(heartbeat.UpdatedVolumes, dn) {
+				glog.V(0).Infof("master see new volume %d from %s", uint32(v.Id), dn.Url())
+				message.NewVids = append(message.NewVids, uint32(v.Id))
+			}
+		}
+
 		if len(heartbeat.Volumes) > 0 || heartbeat.HasNoVolumes {
 			// process heartbeat.Volumes
 			newVolumes, deletedVolumes := ms.Topo.SyncDataNodeRegistration(heartbeat.Volumes, dn)
@@ -115,6 +114,11 @@ func (ms *MasterServer) SendHeartbeat(stream master_pb.Seaweed_SendHeartbeatServ
 			}
 		}
 
+		if len(heartbeat.MaxVolumeCounts) > 0 || len(heartbeat.Volumes) > 0 || heartbeat.HasNoVolumes {
+			// the full and the periodic incremental heartbeats carry the collection caps
+			ms.Topo.SyncDataNodeCollectionCaps(heartbeat.CollectionCaps, dn)
+		}
+
 		if len(heartbeat.NewEcShards) > 0 || len(heartbeat.DeletedEcShards) > 0 {
 
 			// update master internal volume layouts
@@ -157,14 +161,16 @@ func (ms *MasterServer) SendHeartbeat(stream master_pb.Seaweed_SendHeartbeatServ
 			ms.clientChansLock.RUnlock()
 		}
 
-		// tell the volume servers about the leader
+		// tell the volume servers about the leader, the newer replica membership epochs, and the volumes to quarantine
 		newLeader, err := ms.Topo.Leader()
 		if err != nil {
 			glog.Warningf("SendHeartbeat find leader: %v", err)
 			return err
 		}
 		if err := stream.Send(&master_pb.HeartbeatResponse{
-			Leader: newLeader,
+			Leader:             newLeader,
+			VolumeEpochs:       ms.Topo.NewerVolumeEpochs(dn),
+			QuarantinedVolumes: dn.TakeQuarantinedVolumes(),
 		}); err != nil {
 			glog.Warningf("SendHeartbeat.Send response to to %s:%d %v", dn.Ip, dn.Port, err)
 			return err
@@ -172,6 +178,38 @@ func (ms *MasterServer) SendHeartbeat(stream master_pb.Seaweed_SendHeartbeatServ
 	}
 }
 
+// loopCollectingDeadDataNodes removes the volume servers not seen for the grace period,
+// and tells the clients to forget their volume locations
+func (ms *MasterServer) loopCollectingDeadDataNodes() {
+	for range time.Tick(time.Second) {
+		if !ms.Topo.IsLeader() {
+			continue
+		}
+		for _, dn := range ms.Topo.CollectDeadDataNodes(time.Now()) {
+			glog.V(0).Infof("unregister dead volume server %s:%d", dn.Ip, dn.Port)
+
+			message := &master_pb.VolumeLocation{
+				Url:       dn.Url(),
+				PublicUrl: dn.PublicUrl,
+			}
+			for _, v := range dn.GetVolumes() {
+				message.DeletedVids = append(message.DeletedVids, uint32(v.Id))
+			}
+			for _, s := range dn.GetEcShards() {
+				message.DeletedVids = append(message.DeletedVids, uint32(s.VolumeId))
+			}
+
+			if len(message.DeletedVids) > 0 {
+				ms.clientChansLock.RLock()
+				for _, ch := range ms.clientChans {
+					ch <- message
+				}
+				ms.clientChansLock.RUnlock()
+			}
+		}
+	}
+}
+
 // KeepConnected keep a stream gRPC call to the master. Used by clients to know the master is up.
 // And clients gets the up-to-date list of volume locations
 func (ms *MasterServer) KeepConnected(stream master_pb.Seaweed_KeepConnectedServer) error {
@@ -244,6 +282,23 @@ func (ms *MasterServer) informNewLeader(stream master_pb.Seaweed_KeepConnectedSe
 	return nil
 }
 
+// redirectClientsToLeader tells the connected clients about the new leader right away,
+// so they do not keep using this master after it lost the leadership
+func (ms *MasterServer) redirectClientsToLeader(leader string) {
+	message := &master_pb.VolumeLocation{
+		Leader: leader,
+	}
+	ms.clientChansLock.RLock()
+	defer ms.clientChansLock.RUnlock()
+	for clientName, ch := range ms.clientChans {
+		select {
+		case ch <- message:
+		default:
+			glog.V(0).Infof("skip redirecting client %v to leader %s", clientName, leader)
+		}
+	}
+}
+
 func (ms *MasterServer) addClient(clientType string, clientAddress string) (clientName string, messageChan chan *master_pb.VolumeLocation) {
 	clientName = clientType + "@" + clientAddress
 	glog.V(0).Infof("+ client %v", clientName)
@@ -284,7 +339,7 @@ func findClientAddress(ctx context.Context, grpcPort uint32) string {
 	}
 	if tcpAddr, ok := pr.Addr.(*net.TCPAddr); ok {
 		externalIP := tcpAddr.IP
-		return fmt.Sprintf("%s:%d", externalIP, grpcPort)
+		return util.JoinHostPort(externalIP.String(), int(grpcPort))
 	}
 	return pr.Addr.String()
 
@@ -0,0 +1,92 @@
+package weed_server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chrislusf/raft"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/topology"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// A master snapshot keeps the max volume id and the file key sequence of the master set,
+// and the topology for reference. It is saved by "master.snapshot.save" in "weed shell",
+// and bootstraps a new master set with "weed master -snapshot=<file>" when the masters and their mdir are lost.
+// The volume servers report their volumes and max file keys after joining the new masters,
+// the snapshot covers the window before all of them have joined.
+
+func (ms *MasterServer) GetMasterSnapshot(ctx context.Context, req *master_pb.GetMasterSnapshotRequest) (*master_pb.MasterSnapshot, error) {
+
+	if !ms.Topo.IsLeader() {
+		return nil, raft.NotLeaderError
+	}
+
+	return &master_pb.MasterSnapshot{
+		SnapshotTsNs:      time.Now().UnixNano(),
+		Version:           util.Version(),
+		Leader:            ms.Topo.RaftServer.Name(),
+		MaxVolumeId:       uint32(ms.Topo.GetMaxVolumeId()),
+		NextFileKey:       ms.Topo.Sequence.Peek(),
+		SequencerType:     sequencerType(),
+		VolumeSizeLimitMb: uint64(ms.option.VolumeSizeLimitMB),
+		TopologyInfo:      ms.Topo.ToTopologyInfo(),
+	}, nil
+}
+
+func sequencerType() string {
+	seqType := strings.ToLower(util.GetViper().GetString(SequencerType))
+	if seqType != "etcd" && seqType != "snowflake" && seqType != "memory" {
+		return "raft"
+	}
+	return seqType
+}
+
+// restoreSnapshot continues the max volume id and the file key sequence after the snapshot,
+// skipping the gaps for the volumes and files created after the snapshot was taken.
+// It is called after the raft state in mdir is recovered.
+func (ms *MasterServer) restoreSnapshot(snapshot *master_pb.MasterSnapshot) error {
+
+	maxVolumeId := needle.VolumeId(snapshot.MaxVolumeId + ms.option.SnapshotVolumeIdGap)
+	if current := ms.Topo.GetMaxVolumeId(); current >= maxVolumeId {
+		glog.V(0).Infof("skip restoring snapshot: max volume id %d in %s is already after the snapshot %d", current, ms.option.MetaFolder, snapshot.MaxVolumeId)
+		return nil
+	}
+
+	snapshotTime := time.Unix(0, snapshot.SnapshotTsNs)
+	glog.V(0).Infof("restore snapshot taken at %v from leader %s: max volume id %d, next file key %d, sequencer %s",
+		snapshotTime, snapshot.Leader, snapshot.MaxVolumeId, snapshot.NextFileKey, snapshot.SequencerType)
+	if age := time.Since(snapshotTime); age > 24*time.Hour {
+		glog.Warningf("the snapshot is %v old, the files created after it beyond the gap of %d file keys may get duplicated file ids before all volume servers join",
+			age.Truncate(time.Minute), ms.option.SnapshotFileKeyGap)
+	}
+	if seqType := sequencerType(); seqType != snapshot.SequencerType {
+		glog.Warningf("the snapshot is from a %s sequencer, but the master uses a %s sequencer", snapshot.SequencerType, seqType)
+	}
+
+	ms.Topo.UpAdjustMaxVolumeId(maxVolumeId)
+	ms.restoredMaxVolumeId = maxVolumeId
+
+	ms.Topo.Sequence.SetMax(snapshot.NextFileKey + ms.option.SnapshotFileKeyGap)
+	if next := ms.Topo.Sequence.Peek(); next <= snapshot.NextFileKey {
+		return fmt.Errorf("the %s sequencer would reuse file keys: next file key %d, but %d in the snapshot", sequencerType(), next, snapshot.NextFileKey)
+	}
+
+	glog.V(0).Infof("restored snapshot: max volume id %d, next file key %d", ms.Topo.GetMaxVolumeId(), ms.Topo.Sequence.Peek())
+	return nil
+}
+
+// replicateRestoredMaxVolumeId lets the other masters, possibly started without the snapshot, follow the restored max volume id
+func (ms *MasterServer) replicateRestoredMaxVolumeId() {
+	if ms.restoredMaxVolumeId == 0 {
+		return
+	}
+	if _, err := ms.Topo.RaftServer.Do(topology.NewMaxVolumeIdCommand(ms.restoredMaxVolumeId)); err != nil {
+		glog.Errorf("replicate restored max volume id %d: %v", ms.restoredMaxVolumeId, err)
+	}
+}
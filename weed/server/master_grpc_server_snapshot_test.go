@@ -0,0 +1,74 @@
+package weed_server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/sequence"
+	"github.com/chrislusf/seaweedfs/weed/topology"
+)
+
+func newSnapshotTestMasterServer() *MasterServer {
+	return &MasterServer{
+		option: &MasterOption{
+			SnapshotVolumeIdGap: 10,
+			SnapshotFileKeyGap:  1000,
+		},
+		Topo: topology.NewTopology("weedfs", sequence.NewMemorySequencer(), 32*1024*1024, 5, false),
+	}
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	ms := newSnapshotTestMasterServer()
+	snapshot := &master_pb.MasterSnapshot{
+		SnapshotTsNs:  time.Now().UnixNano(),
+		MaxVolumeId:   7,
+		NextFileKey:   5000,
+		SequencerType: "memory",
+	}
+	if err := ms.restoreSnapshot(snapshot); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if maxVolumeId := ms.Topo.GetMaxVolumeId(); maxVolumeId != 17 {
+		t.Errorf("max volume id %d, expected 17", maxVolumeId)
+	}
+	if next := ms.Topo.Sequence.Peek(); next != 6001 {
+		t.Errorf("next file key %d, expected 6001", next)
+	}
+
+	// restoring again, e.g., restarting with the same flags, keeps the current state
+	ms.Topo.Sequence.NextFileId(100)
+	if err := ms.restoreSnapshot(snapshot); err != nil {
+		t.Fatalf("restore again: %v", err)
+	}
+	if next := ms.Topo.Sequence.Peek(); next != 6101 {
+		t.Errorf("next file key %d after restoring again, expected 6101", next)
+	}
+}
+
+func TestRestoreSnapshotSequenceContinuation(t *testing.T) {
+	ms := newSnapshotTestMasterServer()
+	ms.Topo.Sequence = &fixedSequencer{next: 1}
+	err := ms.restoreSnapshot(&master_pb.MasterSnapshot{
+		SnapshotTsNs: time.Now().UnixNano(),
+		MaxVolumeId:  7,
+		NextFileKey:  5000,
+	})
+	if err == nil {
+		t.Errorf("expect error for a sequencer not continuing after the snapshot")
+	}
+}
+
+// fixedSequencer ignores SetMax
+type fixedSequencer struct {
+	next uint64
+}
+
+func (s *fixedSequencer) NextFileId(count uint64) uint64 {
+	ret := s.next
+	s.next += count
+	return ret
+}
+func (s *fixedSequencer) SetMax(uint64) {}
+func (s *fixedSequencer) Peek() uint64  { return s.next }
@@ -93,6 +93,31 @@ func (ms *MasterServer) LookupVolume(ctx context.Context, req *master_pb.LookupV
 	return resp, nil
 }
 
+func (ms *MasterServer) LookupVolumeBatch(ctx context.Context, req *master_pb.LookupVolumeBatchRequest) (*master_pb.LookupVolumeBatchResponse, error) {
+
+	resp := &master_pb.LookupVolumeBatchResponse{
+		VolumeIdLocations: make(map[string]*master_pb.LookupVolumeResponse_VolumeIdLocation),
+	}
+	volumeLocations := ms.lookupVolumeId(req.VolumeOrFileIds, req.Collection)
+
+	for vid, result := range volumeLocations {
+		var locations []*master_pb.Location
+		for _, loc := range result.Locations {
+			locations = append(locations, &master_pb.Location{
+				Url:       loc.Url,
+				PublicUrl: loc.PublicUrl,
+			})
+		}
+		resp.VolumeIdLocations[vid] = &master_pb.LookupVolumeResponse_VolumeIdLocation{
+			VolumeId:  result.VolumeId,
+			Locations: locations,
+			Error:     result.Error,
+		}
+	}
+
+	return resp, nil
+}
+
 func (ms *MasterServer) Assign(ctx context.Context, req *master_pb.AssignRequest) (*master_pb.AssignResponse, error) {
 
 	if !ms.Topo.IsLeader() {
@@ -115,6 +140,9 @@ func (ms *MasterServer) Assign(ctx context.Context, req *master_pb.AssignRequest
 		return nil, err
 	}
 	diskType := types.ToDiskType(req.DiskType)
+	if req.BatchCount > topology.MaxAssignBatchCount {
+		return nil, fmt.Errorf("batch count %d exceeds the limit %d", req.BatchCount, topology.MaxAssignBatchCount)
+	}
 
 	option := &topology.VolumeGrowOption{
 		Collection:         req.Collection,
@@ -132,9 +160,13 @@ func (ms *MasterServer) Assign(ctx context.Context, req *master_pb.AssignRequest
 		if ms.Topo.AvailableSpaceFor(option) <= 0 {
 			return nil, fmt.Errorf("no free volumes left for " + option.String())
 		}
-		ms.vgCh <- &topology.VolumeGrowRequest{
+		select {
+		case ms.vgCh <- &topology.VolumeGrowRequest{
 			Option: option,
 			Count:  int(req.WritableVolumeCount),
+		}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		}
 	}
 
@@ -145,23 +177,54 @@ func (ms *MasterServer) Assign(ctx context.Context, req *master_pb.AssignRequest
 	)
 
 	for time.Now().Sub(startTime) < maxTimeout {
-		fid, count, dn, err := ms.Topo.PickForWrite(req.Count, option)
-		if err == nil {
-			return &master_pb.AssignResponse{
-				Fid:       fid,
-				Url:       dn.Url(),
-				PublicUrl: dn.PublicUrl,
-				Count:     count,
-				Auth:      string(security.GenJwt(ms.guard.SigningKey, ms.guard.ExpiresAfterSec, fid)),
-			}, nil
+		if req.BatchCount > 1 {
+			fids, dns, err := ms.Topo.PickForWriteBatch(req.Count, int(req.BatchCount), option)
+			if err == nil {
+				return ms.toAssignBatchResponse(req.Count, fids, dns), nil
+			}
+			lastErr = err
+		} else {
+			fid, count, dn, err := ms.Topo.PickForWrite(req.Count, option)
+			if err == nil {
+				signingKey, expiresAfterSec := ms.guard.GetSigningKey()
+				return &master_pb.AssignResponse{
+					Fid:       fid,
+					Url:       dn.Url(),
+					PublicUrl: dn.PublicUrl,
+					Count:     count,
+					Auth:      string(security.GenJwt(signingKey, expiresAfterSec, fid)),
+				}, nil
+			}
+			lastErr = err
 		}
 		//glog.V(4).Infoln("waiting for volume growing...")
-		lastErr = err
-		time.Sleep(200 * time.Millisecond)
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 	return nil, lastErr
 }
 
+// toAssignBatchResponse returns the first file id in the top level fields, and all file ids in the batch
+func (ms *MasterServer) toAssignBatchResponse(count uint64, fids []string, dns []*topology.DataNode) *master_pb.AssignResponse {
+	signingKey, expiresAfterSec := ms.guard.GetSigningKey()
+	resp := &master_pb.AssignResponse{
+		Count: count,
+	}
+	for i, fid := range fids {
+		resp.Batch = append(resp.Batch, &master_pb.AssignResponse_AssignedFileId{
+			Fid:       fid,
+			Url:       dns[i].Url(),
+			PublicUrl: dns[i].PublicUrl,
+			Auth:      string(security.GenJwt(signingKey, expiresAfterSec, fid)),
+		})
+	}
+	resp.Fid, resp.Url, resp.PublicUrl, resp.Auth = resp.Batch[0].Fid, resp.Batch[0].Url, resp.Batch[0].PublicUrl, resp.Batch[0].Auth
+	return resp
+}
+
 func (ms *MasterServer) Statistics(ctx context.Context, req *master_pb.StatisticsRequest) (*master_pb.StatisticsResponse, error) {
 
 	if !ms.Topo.IsLeader() {
@@ -244,9 +307,35 @@ func (ms *MasterServer) VacuumVolume(ctx context.Context, req *master_pb.VacuumV
 		return nil, raft.NotLeaderError
 	}
 
+	if ms.Topo.IsVacuumDisabled() {
+		return nil, fmt.Errorf("vacuum is disabled")
+	}
+
 	resp := &master_pb.VacuumVolumeResponse{}
 
 	ms.Topo.Vacuum(ms.grpcDialOption, float64(req.GarbageThreshold), ms.preallocateSize)
 
 	return resp, nil
 }
+
+func (ms *MasterServer) DisableVacuum(ctx context.Context, req *master_pb.DisableVacuumRequest) (*master_pb.DisableVacuumResponse, error) {
+
+	if !ms.Topo.IsLeader() {
+		return nil, raft.NotLeaderError
+	}
+
+	ms.Topo.DisableVacuum()
+	resp := &master_pb.DisableVacuumResponse{}
+	return resp, nil
+}
+
+func (ms *MasterServer) EnableVacuum(ctx context.Context, req *master_pb.EnableVacuumRequest) (*master_pb.EnableVacuumResponse, error) {
+
+	if !ms.Topo.IsLeader() {
+		return nil, raft.NotLeaderError
+	}
+
+	ms.Topo.EnableVacuum()
+	resp := &master_pb.EnableVacuumResponse{}
+	return resp, nil
+}
@@ -2,6 +2,7 @@ package weed_server
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -16,18 +17,22 @@ import (
 	"google.golang.org/grpc"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb"
 	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
 	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/sequence"
 	"github.com/chrislusf/seaweedfs/weed/shell"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/topology"
 	"github.com/chrislusf/seaweedfs/weed/util"
 	"github.com/chrislusf/seaweedfs/weed/wdclient"
+	"github.com/chrislusf/seaweedfs/weed/wdclient/exclusive_locks"
 )
 
 const (
-	SequencerType     = "master.sequencer.type"
-	SequencerEtcdUrls = "master.sequencer.sequencer_etcd_urls"
+	SequencerType             = "master.sequencer.type"
+	SequencerEtcdUrls         = "master.sequencer.sequencer_etcd_urls"
+	SequencerRaftReserveCount = "master.sequencer.raft_reserve_count"
 )
 
 type MasterOption struct {
@@ -43,6 +48,16 @@ type MasterOption struct {
 	DisableHttp             bool
 	MetricsAddress          string
 	MetricsIntervalSec      int
+	InternalNetworks        []*net.IPNet
+	NodeSuspectSeconds      int
+	NodeDeadSeconds         int
+	ChecksumAlgorithm       needle.ChecksumAlgorithm
+	VolumeVersion           needle.Version
+	QuarantineVolumes       bool // quarantine the colliding volumes, instead of only alerting
+	// bootstrap a new master set from the snapshot file, skipping the gaps after its max volume id and file key
+	SnapshotFile        string
+	SnapshotVolumeIdGap uint32
+	SnapshotFileKeyGap  uint64
 }
 
 type MasterServer struct {
@@ -66,18 +81,14 @@ type MasterServer struct {
 	MasterClient *wdclient.MasterClient
 
 	adminLocks *AdminLocks
+
+	snapshot            *master_pb.MasterSnapshot
+	restoredMaxVolumeId needle.VolumeId
 }
 
 func NewMasterServer(r *mux.Router, option *MasterOption, peers []string) *MasterServer {
 
 	v := util.GetViper()
-	signingKey := v.GetString("jwt.signing.key")
-	v.SetDefault("jwt.signing.expires_after_seconds", 10)
-	expiresAfterSec := v.GetInt("jwt.signing.expires_after_seconds")
-
-	readSigningKey := v.GetString("jwt.signing.read.key")
-	v.SetDefault("jwt.signing.read.expires_after_seconds", 60)
-	readExpiresAfterSec := v.GetInt("jwt.signing.read.expires_after_seconds")
 
 	v.SetDefault("master.replication.treat_replication_as_minimums", false)
 	replicationAsMin := v.GetBool("master.replication.treat_replication_as_minimums")
@@ -105,15 +116,33 @@ func NewMasterServer(r *mux.Router, option *MasterOption, peers []string) *Maste
 	}
 	ms.boundedLeaderChan = make(chan int, 16)
 
+	if option.SnapshotFile != "" {
+		snapshot, err := pb.LoadMasterSnapshot(option.SnapshotFile)
+		if err != nil {
+			glog.Fatalf("load master snapshot: %v", err)
+		}
+		ms.snapshot = snapshot
+	}
+
 	seq := ms.createSequencer(option)
 	if nil == seq {
 		glog.Fatalf("create sequencer failed.")
 	}
 	ms.Topo = topology.NewTopology("topo", seq, uint64(ms.option.VolumeSizeLimitMB)*1024*1024, 5, replicationAsMin)
+	ms.Topo.SetNodeTimeouts(time.Duration(option.NodeSuspectSeconds)*time.Second, time.Duration(option.NodeDeadSeconds)*time.Second)
+	ms.Topo.SetChecksumAlgorithm(option.ChecksumAlgorithm)
+	ms.Topo.SetVolumeVersion(option.VolumeVersion)
+	ms.Topo.SetVolumeCollisionQuarantine(option.QuarantineVolumes)
+	ms.Topo.DeferVolumeCollisions()
 	ms.vg = topology.NewDefaultVolumeGrowth()
 	glog.V(0).Infoln("Volume Size Limit is", ms.option.VolumeSizeLimitMB, "MB")
 
-	ms.guard = security.NewGuard(ms.option.WhiteList, signingKey, expiresAfterSec, readSigningKey, readExpiresAfterSec)
+	ms.guard = security.LoadGuard(v, ms.option.WhiteList)
+
+	if webhookUrls := v.GetStringSlice("master.events.webhook_urls"); len(webhookUrls) > 0 {
+		notifier := newTopologyEventWebhook(webhookUrls, v.GetStringSlice("master.events.types"))
+		ms.Topo.SetEventListener(notifier.notify)
+	}
 
 	handleStaticResources2(r)
 	r.HandleFunc("/", ms.proxyToLeader(ms.uiStatusHandler))
@@ -126,6 +155,7 @@ func NewMasterServer(r *mux.Router, option *MasterOption, peers []string) *Maste
 		r.HandleFunc("/vol/grow", ms.proxyToLeader(ms.guard.WhiteList(ms.volumeGrowHandler)))
 		r.HandleFunc("/vol/status", ms.proxyToLeader(ms.guard.WhiteList(ms.volumeStatusHandler)))
 		r.HandleFunc("/vol/vacuum", ms.proxyToLeader(ms.guard.WhiteList(ms.volumeVacuumHandler)))
+		r.HandleFunc("/vol/simulate", ms.proxyToLeader(ms.guard.WhiteList(ms.volumeSimulateHandler)))
 		r.HandleFunc("/submit", ms.guard.WhiteList(ms.submitFromMasterServerHandler))
 		/*
 			r.HandleFunc("/stats/health", ms.guard.WhiteList(statsHealthHandler))
@@ -140,8 +170,13 @@ func NewMasterServer(r *mux.Router, option *MasterOption, peers []string) *Maste
 		ms.option.GarbageThreshold,
 		v.GetFloat64("master.volume_growth.threshold"),
 		ms.preallocateSize,
+		func() (string, bool) {
+			return ms.adminLocks.isLocked(exclusive_locks.AdminLockName)
+		},
 	)
 
+	go ms.loopCollectingDeadDataNodes()
+
 	ms.ProcessGrowRequest()
 
 	ms.startAdminScripts()
@@ -151,10 +186,25 @@ func NewMasterServer(r *mux.Router, option *MasterOption, peers []string) *Maste
 
 func (ms *MasterServer) SetRaftServer(raftServer *RaftServer) {
 	ms.Topo.RaftServer = raftServer.raftServer
+	if seq, ok := ms.Topo.Sequence.(*sequence.RaftSequencer); ok {
+		seq.SetReserveFunc(ms.Topo.ReserveFileKeys)
+	}
+	if ms.snapshot != nil {
+		if err := ms.restoreSnapshot(ms.snapshot); err != nil {
+			glog.Fatalf("restore master snapshot %s: %v", ms.option.SnapshotFile, err)
+		}
+	}
 	ms.Topo.RaftServer.AddEventListener(raft.LeaderChangeEventType, func(e raft.Event) {
 		glog.V(0).Infof("leader change event: %+v => %+v", e.PrevValue(), e.Value())
 		if ms.Topo.RaftServer.Leader() != "" {
 			glog.V(0).Infoln("[", ms.Topo.RaftServer.Name(), "]", ms.Topo.RaftServer.Leader(), "becomes leader.")
+			// the event is dispatched with the raft server locked, so not to check by ms.Topo.IsLeader()
+			if ms.Topo.RaftServer.Leader() != ms.Topo.RaftServer.Name() {
+				ms.redirectClientsToLeader(ms.Topo.RaftServer.Leader())
+			} else {
+				ms.Topo.DeferVolumeCollisions()
+				go ms.replicateRestoredMaxVolumeId()
+			}
 		}
 	})
 	if ms.Topo.IsLeader() {
@@ -166,6 +216,18 @@ func (ms *MasterServer) SetRaftServer(raftServer *RaftServer) {
 	}
 }
 
+// Reload updates the white list and the jwt signing keys from security.toml
+func (ms *MasterServer) Reload() {
+	glog.V(0).Infoln("Reload master server...")
+	if _, err := util.ReloadConfiguration("security"); err != nil {
+		glog.Errorf("reload security configuration: %v", err)
+		return
+	}
+	if err := ms.guard.Reload(util.GetViper(), ms.option.WhiteList); err != nil {
+		glog.Errorf("reload master server guard: %v", err)
+	}
+}
+
 func (ms *MasterServer) proxyToLeader(f http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if ms.Topo.IsLeader() {
@@ -220,7 +282,7 @@ func (ms *MasterServer) startAdminScripts() {
 		scriptLines = append(scriptLines, "unlock")
 	}
 
-	masterAddress := fmt.Sprintf("%s:%d", ms.option.Host, ms.option.Port)
+	masterAddress := util.JoinHostPort(ms.option.Host, ms.option.Port)
 
 	var shellOptions shell.ShellOptions
 	shellOptions.GrpcDialOption = security.LoadClientTLS(v, "grpc.master")
@@ -293,13 +355,15 @@ func (ms *MasterServer) createSequencer(option *MasterOption) sequence.Sequencer
 		}
 	case "snowflake":
 		var err error
-		seq, err = sequence.NewSnowflakeSequencer(fmt.Sprintf("%s:%d", option.Host, option.Port))
+		seq, err = sequence.NewSnowflakeSequencer(util.JoinHostPort(option.Host, option.Port))
 		if err != nil {
 			glog.Error(err)
 			seq = nil
 		}
-	default:
+	case "memory":
 		seq = sequence.NewMemorySequencer()
+	default:
+		seq = sequence.NewRaftSequencer(v.GetUint64(SequencerRaftReserveCount))
 	}
 	return seq
 }
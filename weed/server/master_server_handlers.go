@@ -11,6 +11,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/stats"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/topology"
+	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
 func (ms *MasterServer) lookupVolumeId(vids []string, collection string) (volumeLocations map[string]operation.LookupResult) {
@@ -30,7 +31,12 @@ func (ms *MasterServer) lookupVolumeId(vids []string, collection string) (volume
 
 // If "fileId" is provided, this returns the fileId location and a JWT to update or delete the file.
 // If "volumeId" is provided, this only returns the volumeId location
+// If "volumeIds" is provided, this returns the locations of all the comma separated volume ids, keyed by volume id
 func (ms *MasterServer) dirLookupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("volumeIds") != "" {
+		ms.dirLookupBatchHandler(w, r)
+		return
+	}
 	vid := r.FormValue("volumeId")
 	if vid != "" {
 		// backward compatible
@@ -48,6 +54,7 @@ func (ms *MasterServer) dirLookupHandler(w http.ResponseWriter, r *http.Request)
 	}
 	collection := r.FormValue("collection") // optional, but can be faster if too many collections
 	location := ms.findVolumeLocation(collection, vid)
+	ms.adjustLocationsForClient(r, location.Locations)
 	httpStatus := http.StatusOK
 	if location.Error != "" || location.Locations == nil {
 		httpStatus = http.StatusNotFound
@@ -59,10 +66,59 @@ func (ms *MasterServer) dirLookupHandler(w http.ResponseWriter, r *http.Request)
 	writeJsonQuiet(w, r, httpStatus, location)
 }
 
+func (ms *MasterServer) dirLookupBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var vids []string
+	for _, volumeIds := range r.Form["volumeIds"] {
+		for _, vid := range strings.Split(volumeIds, ",") {
+			if vid = strings.TrimSpace(vid); vid != "" {
+				vids = append(vids, vid)
+			}
+		}
+	}
+	collection := r.FormValue("collection") // optional, but can be faster if too many collections
+	volumeLocations := ms.lookupVolumeId(vids, collection)
+	for _, location := range volumeLocations {
+		ms.adjustLocationsForClient(r, location.Locations)
+	}
+	writeJsonQuiet(w, r, http.StatusOK, operation.LookupBatchResult{
+		VolumeIdLocations: volumeLocations,
+	})
+}
+
+// isExternalClient tells whether the request comes from outside of the internal networks.
+// For requests proxied by internal servers, e.g., follower masters, the X-Forwarded-For client is checked.
+func (ms *MasterServer) isExternalClient(r *http.Request) bool {
+	if len(ms.option.InternalNetworks) == 0 {
+		return false
+	}
+	if !util.IsInNetworks(r.RemoteAddr, ms.option.InternalNetworks) {
+		return true
+	}
+	if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+		client := strings.TrimSpace(strings.Split(forwardedFor, ",")[0])
+		return !util.IsInNetworks(client, ms.option.InternalNetworks)
+	}
+	return false
+}
+
+// adjustLocationsForClient gives external clients the public url as the url,
+// since the volume server url may not be reachable from outside, e.g., behind NAT or in Kubernetes
+func (ms *MasterServer) adjustLocationsForClient(r *http.Request, locations []operation.Location) {
+	if !ms.isExternalClient(r) {
+		return
+	}
+	for i := range locations {
+		if locations[i].PublicUrl != "" {
+			locations[i].Url = locations[i].PublicUrl
+		}
+	}
+}
+
 // findVolumeLocation finds the volume location from master topo if it is leader,
 // or from master client if not leader
 func (ms *MasterServer) findVolumeLocation(collection, vid string) operation.LookupResult {
 	var locations []operation.Location
+	var epoch uint64
 	var err error
 	if ms.Topo.IsLeader() {
 		volumeId, newVolumeIdErr := needle.NewVolumeId(vid)
@@ -71,13 +127,18 @@ func (ms *MasterServer) findVolumeLocation(collection, vid string) operation.Loo
 		} else {
 			machines := ms.Topo.Lookup(collection, volumeId)
 			for _, loc := range machines {
-				locations = append(locations, operation.Location{Url: loc.Url(), PublicUrl: loc.PublicUrl})
+				var dataCenter string
+				if dc := loc.GetDataCenter(); dc != nil {
+					dataCenter = string(dc.Id())
+				}
+				locations = append(locations, operation.Location{Url: loc.Url(), PublicUrl: loc.PublicUrl, DataCenter: dataCenter})
 			}
+			epoch = ms.Topo.LookupEpoch(collection, volumeId)
 		}
 	} else {
 		machines, getVidLocationsErr := ms.MasterClient.GetVidLocations(vid)
 		for _, loc := range machines {
-			locations = append(locations, operation.Location{Url: loc.Url, PublicUrl: loc.PublicUrl})
+			locations = append(locations, operation.Location{Url: loc.Url, PublicUrl: loc.PublicUrl, DataCenter: loc.DataCenter})
 		}
 		err = getVidLocationsErr
 	}
@@ -87,6 +148,7 @@ func (ms *MasterServer) findVolumeLocation(collection, vid string) operation.Loo
 	ret := operation.LookupResult{
 		VolumeId:  vid,
 		Locations: locations,
+		Epoch:     epoch,
 	}
 	if err != nil {
 		ret.Error = err.Error()
@@ -106,6 +168,15 @@ func (ms *MasterServer) dirAssignHandler(w http.ResponseWriter, r *http.Request)
 		writableVolumeCount = 0
 	}
 
+	batchCount, e := strconv.Atoi(r.FormValue("batch"))
+	if e != nil {
+		batchCount = 1
+	}
+	if batchCount > topology.MaxAssignBatchCount {
+		writeJsonQuiet(w, r, http.StatusBadRequest, operation.AssignResult{Error: fmt.Sprintf("batch %d exceeds the limit %d", batchCount, topology.MaxAssignBatchCount)})
+		return
+	}
+
 	option, err := ms.getVolumeGrowOption(r)
 	if err != nil {
 		writeJsonQuiet(w, r, http.StatusNotAcceptable, operation.AssignResult{Error: err.Error()})
@@ -128,24 +199,56 @@ func (ms *MasterServer) dirAssignHandler(w http.ResponseWriter, r *http.Request)
 			return
 		}
 	}
+	if batchCount > 1 {
+		fids, dns, err := ms.Topo.PickForWriteBatch(requestedCount, batchCount, option)
+		if err != nil {
+			writeJsonQuiet(w, r, http.StatusNotAcceptable, operation.AssignResult{Error: err.Error()})
+			return
+		}
+		writeJsonQuiet(w, r, http.StatusOK, ms.toAssignBatchResult(r, requestedCount, fids, dns))
+		return
+	}
 	fid, count, dn, err := ms.Topo.PickForWrite(requestedCount, option)
 	if err == nil {
 		ms.maybeAddJwtAuthorization(w, fid, true)
-		writeJsonQuiet(w, r, http.StatusOK, operation.AssignResult{Fid: fid, Url: dn.Url(), PublicUrl: dn.PublicUrl, Count: count})
+		location := []operation.Location{{Url: dn.Url(), PublicUrl: dn.PublicUrl}}
+		ms.adjustLocationsForClient(r, location)
+		writeJsonQuiet(w, r, http.StatusOK, operation.AssignResult{Fid: fid, Url: location[0].Url, PublicUrl: dn.PublicUrl, Count: count})
 	} else {
 		writeJsonQuiet(w, r, http.StatusNotAcceptable, operation.AssignResult{Error: err.Error()})
 	}
 }
 
+// toAssignBatchResult returns the first file id in the top level fields, and all file ids in the batch.
+// The jwt of each file id is in the batch, instead of the Authorization header.
+func (ms *MasterServer) toAssignBatchResult(r *http.Request, count uint64, fids []string, dns []*topology.DataNode) operation.AssignResult {
+	signingKey, expiresAfterSec := ms.guard.GetSigningKey()
+	ret := operation.AssignResult{Count: count}
+	for i, fid := range fids {
+		location := []operation.Location{{Url: dns[i].Url(), PublicUrl: dns[i].PublicUrl}}
+		ms.adjustLocationsForClient(r, location)
+		ret.Batch = append(ret.Batch, operation.AssignedFileId{
+			Fid:       fid,
+			Url:       location[0].Url,
+			PublicUrl: dns[i].PublicUrl,
+			Auth:      security.GenJwt(signingKey, expiresAfterSec, fid),
+		})
+	}
+	ret.Fid, ret.Url, ret.PublicUrl, ret.Auth = ret.Batch[0].Fid, ret.Batch[0].Url, ret.Batch[0].PublicUrl, ret.Batch[0].Auth
+	return ret
+}
+
 func (ms *MasterServer) maybeAddJwtAuthorization(w http.ResponseWriter, fileId string, isWrite bool) {
 	if fileId == "" {
 		return
 	}
 	var encodedJwt security.EncodedJwt
 	if isWrite {
-		encodedJwt = security.GenJwt(ms.guard.SigningKey, ms.guard.ExpiresAfterSec, fileId)
+		signingKey, expiresAfterSec := ms.guard.GetSigningKey()
+		encodedJwt = security.GenJwt(signingKey, expiresAfterSec, fileId)
 	} else {
-		encodedJwt = security.GenJwt(ms.guard.ReadSigningKey, ms.guard.ReadExpiresAfterSec, fileId)
+		readSigningKey, readExpiresAfterSec := ms.guard.GetReadSigningKey()
+		encodedJwt = security.GenJwt(readSigningKey, readExpiresAfterSec, fileId)
 	}
 	if encodedJwt == "" {
 		return
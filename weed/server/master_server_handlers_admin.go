@@ -2,14 +2,17 @@ package weed_server
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/operation"
 	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/shell"
 	"github.com/chrislusf/seaweedfs/weed/storage/backend/memory_map"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
@@ -99,17 +102,51 @@ func (ms *MasterServer) volumeStatusHandler(w http.ResponseWriter, r *http.Reque
 	writeJsonQuiet(w, r, http.StatusOK, m)
 }
 
+// volumeSimulateHandler reports the impact of a hypothetical topology change, e.g., before a maintenance.
+// The change is the json of shell.TopologyChange in the request body,
+// or the removeNode, removeRack, removeDataCenter and collection parameters.
+func (ms *MasterServer) volumeSimulateHandler(w http.ResponseWriter, r *http.Request) {
+	change := &shell.TopologyChange{}
+	if r.Method == "POST" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(change); err != nil {
+			writeJsonError(w, r, http.StatusBadRequest, fmt.Errorf("parse topology change: %v", err))
+			return
+		}
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJsonError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	change.RemoveDataNodes = append(change.RemoveDataNodes, r.Form["removeNode"]...)
+	change.RemoveRacks = append(change.RemoveRacks, r.Form["removeRack"]...)
+	change.RemoveDataCenters = append(change.RemoveDataCenters, r.Form["removeDataCenter"]...)
+	if collection := r.FormValue("collection"); collection != "" {
+		change.Collection = collection
+	}
+
+	result, err := shell.SimulateTopologyChange(ms.Topo.ToTopologyInfo(), change, uint64(ms.option.VolumeSizeLimitMB)*1024*1024)
+	if err != nil {
+		writeJsonError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	writeJsonQuiet(w, r, http.StatusOK, result)
+}
+
 func (ms *MasterServer) redirectHandler(w http.ResponseWriter, r *http.Request) {
 	vid, _, _, _, _ := parseURLPath(r.URL.Path)
 	collection := r.FormValue("collection")
 	location := ms.findVolumeLocation(collection, vid)
 	if location.Error == "" {
 		loc := location.Locations[rand.Intn(len(location.Locations))]
+		serverUrl := loc.PublicUrl
+		if len(ms.option.InternalNetworks) > 0 && !ms.isExternalClient(r) {
+			serverUrl = loc.Url
+		}
 		var url string
 		if r.URL.RawQuery != "" {
-			url = util.NormalizeUrl(loc.PublicUrl) + r.URL.Path + "?" + r.URL.RawQuery
+			url = util.NormalizeUrl(serverUrl) + r.URL.Path + "?" + r.URL.RawQuery
 		} else {
-			url = util.NormalizeUrl(loc.PublicUrl) + r.URL.Path
+			url = util.NormalizeUrl(serverUrl) + r.URL.Path
 		}
 		http.Redirect(w, r, url, http.StatusPermanentRedirect)
 	} else {
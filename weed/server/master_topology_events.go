@@ -0,0 +1,85 @@
+package weed_server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/topology"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// topologyEventWebhook posts the topology events as json to the configured urls, e.g., to page the operators.
+// The events are queued and posted in the background, so the topology changes are not blocked by slow webhooks.
+type topologyEventWebhook struct {
+	urls   []string
+	types  map[string]bool
+	queue  chan *topology.TopologyEvent
+	client *http.Client
+}
+
+func newTopologyEventWebhook(urls []string, eventTypes []string) *topologyEventWebhook {
+	w := &topologyEventWebhook{
+		urls:   urls,
+		queue:  make(chan *topology.TopologyEvent, 1024),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if len(eventTypes) > 0 {
+		w.types = make(map[string]bool)
+		for _, t := range eventTypes {
+			w.types[t] = true
+		}
+	}
+	glog.V(0).Infof("posting topology events %v to %v", eventTypes, urls)
+	go w.loop()
+	return w
+}
+
+func (w *topologyEventWebhook) notify(event *topology.TopologyEvent) {
+	if w.types != nil && !w.types[event.Type] {
+		return
+	}
+	select {
+	case w.queue <- event:
+	default:
+		glog.Warningf("drop topology event %+v, %d events waiting to be posted", event, len(w.queue))
+	}
+}
+
+func (w *topologyEventWebhook) loop() {
+	for event := range w.queue {
+		body, err := json.Marshal(event)
+		if err != nil {
+			glog.Errorf("marshal topology event %+v: %v", event, err)
+			continue
+		}
+		for _, url := range w.urls {
+			for i := 0; i < 3; i++ {
+				if i > 0 {
+					time.Sleep(time.Duration(i) * time.Second)
+				}
+				if err = w.post(url, body); err == nil {
+					break
+				}
+			}
+			if err != nil {
+				glog.Errorf("post topology event %s to %s: %v", body, url, err)
+			}
+		}
+	}
+}
+
+func (w *topologyEventWebhook) post(url string, body []byte) error {
+	resp, err := w.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer util.CloseResponse(resp)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
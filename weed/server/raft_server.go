@@ -15,6 +15,8 @@ import (
 	"github.com/chrislusf/raft"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/sequence"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/topology"
 )
 
@@ -32,22 +34,34 @@ type StateMachine struct {
 	topo *topology.Topology
 }
 
+// raftState is saved in the raft snapshots
+type raftState struct {
+	MaxVolumeId needle.VolumeId `json:"maxVolumeId"`
+	MaxFileKey  uint64          `json:"maxFileKey,omitempty"`
+}
+
 func (s StateMachine) Save() ([]byte, error) {
-	state := topology.MaxVolumeIdCommand{
+	state := raftState{
 		MaxVolumeId: s.topo.GetMaxVolumeId(),
 	}
+	if seq, ok := s.topo.Sequence.(*sequence.RaftSequencer); ok {
+		state.MaxFileKey = seq.GetMaxReserved()
+	}
 	glog.V(1).Infof("Save raft state %+v", state)
 	return json.Marshal(state)
 }
 
 func (s StateMachine) Recovery(data []byte) error {
-	state := topology.MaxVolumeIdCommand{}
+	state := raftState{}
 	err := json.Unmarshal(data, &state)
 	if err != nil {
 		return err
 	}
 	glog.V(1).Infof("Recovery raft state %+v", state)
 	s.topo.UpAdjustMaxVolumeId(state.MaxVolumeId)
+	if state.MaxFileKey > 0 {
+		s.topo.Sequence.SetMax(state.MaxFileKey)
+	}
 	return nil
 }
 
@@ -64,6 +78,7 @@ func NewRaftServer(grpcDialOption grpc.DialOption, peers []string, serverAddr, d
 	}
 
 	raft.RegisterCommand(&topology.MaxVolumeIdCommand{})
+	raft.RegisterCommand(&topology.MaxFileKeyCommand{})
 
 	var err error
 	transporter := raft.NewGrpcTransporter(grpcDialOption)
@@ -131,6 +146,13 @@ func NewRaftServer(grpcDialOption grpc.DialOption, peers []string, serverAddr, d
 	return s, nil
 }
 
+// Stop stops the raft server and closes its log
+func (s *RaftServer) Stop() {
+	if s.raftServer.Running() {
+		s.raftServer.Stop()
+	}
+}
+
 func (s *RaftServer) Peers() (members []string) {
 	peers := s.raftServer.Peers()
 
@@ -0,0 +1,85 @@
+package weed_server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// pingTarget pings the target server from this server, to check the grpc connectivity between the two servers,
+// and returns the clock and the version of the target. Without a target, it returns the clock and the version of this server.
+func pingTarget(ctx context.Context, grpcDialOption grpc.DialOption, target, targetType string) (remoteTimeNs int64, version string, err error) {
+	if target == "" {
+		return time.Now().UnixNano(), util.Version(), nil
+	}
+
+	switch targetType {
+	case pb.MasterType:
+		err = operation.WithMasterServerClient(target, grpcDialOption, func(client master_pb.SeaweedClient) error {
+			resp, pingErr := client.Ping(ctx, &master_pb.PingRequest{})
+			if pingErr == nil {
+				remoteTimeNs, version = resp.RemoteTimeNs, resp.Version
+			}
+			return pingErr
+		})
+	case pb.VolumeServerType:
+		err = operation.WithVolumeServerClient(target, grpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
+			resp, pingErr := client.Ping(ctx, &volume_server_pb.PingRequest{})
+			if pingErr == nil {
+				remoteTimeNs, version = resp.RemoteTimeNs, resp.Version
+			}
+			return pingErr
+		})
+	case pb.FilerType:
+		err = operation.WithFilerServerClient(target, grpcDialOption, func(client filer_pb.SeaweedFilerClient) error {
+			resp, pingErr := client.Ping(ctx, &filer_pb.PingRequest{})
+			if pingErr == nil {
+				remoteTimeNs, version = resp.RemoteTimeNs, resp.Version
+			}
+			return pingErr
+		})
+	default:
+		return 0, "", fmt.Errorf("unknown target type %q", targetType)
+	}
+
+	if err != nil {
+		err = fmt.Errorf("ping %s %s: %v", targetType, target, err)
+	}
+	return
+}
+
+func (ms *MasterServer) Ping(ctx context.Context, req *master_pb.PingRequest) (resp *master_pb.PingResponse, err error) {
+	resp = &master_pb.PingResponse{
+		StartTimeNs: time.Now().UnixNano(),
+	}
+	resp.RemoteTimeNs, resp.Version, err = pingTarget(ctx, ms.grpcDialOption, req.Target, req.TargetType)
+	resp.StopTimeNs = time.Now().UnixNano()
+	return
+}
+
+func (vs *VolumeServer) Ping(ctx context.Context, req *volume_server_pb.PingRequest) (resp *volume_server_pb.PingResponse, err error) {
+	resp = &volume_server_pb.PingResponse{
+		StartTimeNs: time.Now().UnixNano(),
+	}
+	resp.RemoteTimeNs, resp.Version, err = pingTarget(ctx, vs.grpcDialOption, req.Target, req.TargetType)
+	resp.StopTimeNs = time.Now().UnixNano()
+	return
+}
+
+func (fs *FilerServer) Ping(ctx context.Context, req *filer_pb.PingRequest) (resp *filer_pb.PingResponse, err error) {
+	resp = &filer_pb.PingResponse{
+		StartTimeNs: time.Now().UnixNano(),
+	}
+	resp.RemoteTimeNs, resp.Version, err = pingTarget(ctx, fs.grpcDialOption, req.Target, req.TargetType)
+	resp.StopTimeNs = time.Now().UnixNano()
+	return
+}
@@ -39,9 +39,12 @@ func (vs *VolumeServer) AllocateVolume(ctx context.Context, req *volume_server_p
 		vs.needleMapKind,
 		req.Replication,
 		req.Ttl,
+		needle.ChecksumAlgorithm(req.ChecksumAlgorithm),
+		needle.Version(req.Version),
 		req.Preallocate,
 		req.MemoryMapMaxSizeMb,
 		types.ToDiskType(req.DiskType),
+		req.Uuid,
 	)
 
 	if err != nil {
@@ -167,6 +170,38 @@ func (vs *VolumeServer) VolumeMarkWritable(ctx context.Context, req *volume_serv
 	return resp, err
 }
 
+// VolumeMarkReplicasInSync clears the volume mark of failed replications, after volume.check.disk has synced the replicas
+func (vs *VolumeServer) VolumeMarkReplicasInSync(ctx context.Context, req *volume_server_pb.VolumeMarkReplicasInSyncRequest) (*volume_server_pb.VolumeMarkReplicasInSyncResponse, error) {
+
+	resp := &volume_server_pb.VolumeMarkReplicasInSyncResponse{}
+
+	err := vs.store.MarkVolumeReplicasOutOfSync(needle.VolumeId(req.VolumeId), false)
+
+	if err != nil {
+		glog.Errorf("volume mark replicas in sync %v: %v", req, err)
+	} else {
+		glog.V(2).Infof("volume mark replicas in sync %v", req)
+	}
+
+	return resp, err
+}
+
+// VolumeMarkReplicasOutOfSync marks the volume for volume.check.disk to repair, e.g., after the replicas failed to commit a vacuum
+func (vs *VolumeServer) VolumeMarkReplicasOutOfSync(ctx context.Context, req *volume_server_pb.VolumeMarkReplicasOutOfSyncRequest) (*volume_server_pb.VolumeMarkReplicasOutOfSyncResponse, error) {
+
+	resp := &volume_server_pb.VolumeMarkReplicasOutOfSyncResponse{}
+
+	err := vs.store.MarkVolumeReplicasOutOfSync(needle.VolumeId(req.VolumeId), true)
+
+	if err != nil {
+		glog.Errorf("volume mark replicas out of sync %v: %v", req, err)
+	} else {
+		glog.V(2).Infof("volume mark replicas out of sync %v", req)
+	}
+
+	return resp, err
+}
+
 func (vs *VolumeServer) VolumeStatus(ctx context.Context, req *volume_server_pb.VolumeStatusRequest) (*volume_server_pb.VolumeStatusResponse, error) {
 
 	resp := &volume_server_pb.VolumeStatusResponse{}
@@ -247,3 +282,22 @@ func (vs *VolumeServer) VolumeNeedleStatus(ctx context.Context, req *volume_serv
 	return resp, nil
 
 }
+
+func (vs *VolumeServer) VolumeNeedleUndelete(ctx context.Context, req *volume_server_pb.VolumeNeedleUndeleteRequest) (*volume_server_pb.VolumeNeedleUndeleteResponse, error) {
+
+	resp := &volume_server_pb.VolumeNeedleUndeleteResponse{}
+
+	n := &needle.Needle{
+		Id:     types.NeedleId(req.NeedleId),
+		Cookie: types.Cookie(req.Cookie),
+	}
+
+	size, err := vs.store.UndeleteVolumeNeedle(needle.VolumeId(req.VolumeId), n)
+	if err != nil {
+		return nil, fmt.Errorf("undelete needle %d in volume %d: %v", req.NeedleId, req.VolumeId, err)
+	}
+	resp.Size = uint32(size)
+
+	return resp, nil
+
+}
@@ -5,12 +5,14 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/operation"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"google.golang.org/grpc"
 
 	"github.com/chrislusf/seaweedfs/weed/pb"
 	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/storage/backend"
 	"github.com/chrislusf/seaweedfs/weed/storage/erasure_coding"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 
 	"golang.org/x/net/context"
 
@@ -19,6 +21,10 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
+// a full heartbeat is sent every fullHeartbeatPulses pulses to reconcile the master's view,
+// and only the changed volumes are sent in between.
+const fullHeartbeatPulses = 20
+
 func (vs *VolumeServer) GetMaster() string {
 	return vs.currentMaster
 }
@@ -26,7 +32,7 @@ func (vs *VolumeServer) GetMaster() string {
 func (vs *VolumeServer) checkWithMaster() (err error) {
 	isConnected := false
 	for !isConnected {
-		for _, master := range vs.SeedMasterNodes {
+		for _, master := range util.ResolveServerAddresses(vs.SeedMasterNodes) {
 			err = operation.WithMasterServerClient(master, vs.grpcDialOption, func(masterClient master_pb.SeaweedClient) error {
 				resp, err := masterClient.GetMasterConfiguration(context.Background(), &master_pb.GetMasterConfigurationRequest{})
 				if err != nil {
@@ -48,6 +54,7 @@ func (vs *VolumeServer) checkWithMaster() (err error) {
 }
 
 func (vs *VolumeServer) heartbeat() {
+	defer close(vs.heartbeatStopped)
 
 	glog.V(0).Infof("Volume server start with seed master nodes: %v", vs.SeedMasterNodes)
 	vs.store.SetDataCenter(vs.dataCenter)
@@ -58,7 +65,14 @@ func (vs *VolumeServer) heartbeat() {
 	var err error
 	var newLeader string
 	for vs.isHeartbeating {
-		for _, master := range vs.SeedMasterNodes {
+		masters := util.ResolveServerAddresses(vs.SeedMasterNodes)
+		if len(masters) == 0 {
+			// not to spin while the master names can not be resolved
+			glog.V(0).Infof("no master resolved from %v", vs.SeedMasterNodes)
+			time.Sleep(time.Duration(vs.pulseSeconds) * time.Second)
+			continue
+		}
+		for _, master := range masters {
 			if newLeader != "" {
 				// the new leader may actually is the same master
 				// need to wait a bit before adding itself
@@ -94,6 +108,18 @@ func (vs *VolumeServer) StopHeartbeat() (isAlreadyStopping bool) {
 	return false
 }
 
+// StartHeartbeat resumes the heartbeat stopped by StopHeartbeat
+func (vs *VolumeServer) StartHeartbeat() {
+	if vs.isHeartbeating {
+		return
+	}
+	<-vs.heartbeatStopped
+	vs.isHeartbeating = true
+	vs.stopChan = make(chan bool)
+	vs.heartbeatStopped = make(chan struct{})
+	go vs.heartbeat()
+}
+
 func (vs *VolumeServer) doHeartbeat(masterNode, masterGrpcAddress string, grpcDialOption grpc.DialOption, sleepInterval time.Duration) (newLeader string, err error) {
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -131,6 +157,14 @@ func (vs *VolumeServer) doHeartbeat(masterNode, masterGrpcAddress string, grpcDi
 					}
 				}
 			}
+			for vid, epoch := range in.GetVolumeEpochs() {
+				vs.store.SetVolumeEpoch(needle.VolumeId(vid), epoch)
+			}
+			for vid, reason := range in.GetQuarantinedVolumes() {
+				if err := vs.store.QuarantineVolume(needle.VolumeId(vid), reason); err != nil {
+					glog.Errorf("quarantine volume %d: %v", vid, err)
+				}
+			}
 			if in.GetLeader() != "" && vs.currentMaster != in.GetLeader() {
 				glog.V(0).Infof("Volume Server found a new master newLeader: %v instead of %v", in.GetLeader(), vs.currentMaster)
 				newLeader = in.GetLeader()
@@ -140,7 +174,10 @@ func (vs *VolumeServer) doHeartbeat(masterNode, masterGrpcAddress string, grpcDi
 		}
 	}()
 
-	if err = stream.Send(vs.store.CollectHeartbeat()); err != nil {
+	lastVolumes := make(map[uint32]*master_pb.VolumeInformationMessage)
+	heartbeat := vs.store.CollectHeartbeat()
+	toIncrementalHeartbeat(lastVolumes, heartbeat)
+	if err = stream.Send(heartbeat); err != nil {
 		glog.V(0).Infof("Volume Server Failed to talk with master %s: %v", masterNode, err)
 		return "", err
 	}
@@ -152,6 +189,7 @@ func (vs *VolumeServer) doHeartbeat(masterNode, masterGrpcAddress string, grpcDi
 
 	volumeTickChan := time.Tick(sleepInterval)
 	ecShardTickChan := time.Tick(17 * sleepInterval)
+	pulseCount := 0
 
 	for {
 		select {
@@ -185,6 +223,19 @@ func (vs *VolumeServer) doHeartbeat(masterNode, masterGrpcAddress string, grpcDi
 				},
 			}
 			glog.V(1).Infof("volume server %s:%d deletes volume %d", vs.store.Ip, vs.store.Port, volumeMessage.Id)
+			delete(lastVolumes, volumeMessage.Id)
+			if err = stream.Send(deltaBeat); err != nil {
+				glog.V(0).Infof("Volume Server Failed to update to master %s: %v", masterNode, err)
+				return "", err
+			}
+		case volumeMessage := <-vs.store.UpdatedVolumesChan:
+			deltaBeat := &master_pb.Heartbeat{
+				UpdatedVolumes: []*master_pb.VolumeInformationMessage{
+					volumeMessage,
+				},
+			}
+			glog.V(1).Infof("volume server %s:%d updates volume %d", vs.store.Ip, vs.store.Port, volumeMessage.Id)
+			lastVolumes[volumeMessage.Id] = volumeMessage
 			if err = stream.Send(deltaBeat); err != nil {
 				glog.V(0).Infof("Volume Server Failed to update to master %s: %v", masterNode, err)
 				return "", err
@@ -204,10 +255,21 @@ func (vs *VolumeServer) doHeartbeat(masterNode, masterGrpcAddress string, grpcDi
 		case <-volumeTickChan:
 			glog.V(4).Infof("volume server %s:%d heartbeat", vs.store.Ip, vs.store.Port)
 			vs.store.MaybeAdjustVolumeMax()
-			if err = stream.Send(vs.store.CollectHeartbeat()); err != nil {
+			heartbeat := vs.store.CollectHeartbeat()
+			pulseCount++
+			if incrementalHeartbeat := toIncrementalHeartbeat(lastVolumes, heartbeat); pulseCount%fullHeartbeatPulses != 0 {
+				heartbeat = incrementalHeartbeat
+			}
+			if err = stream.Send(heartbeat); err != nil {
 				glog.V(0).Infof("Volume Server Failed to talk with master %s: %v", masterNode, err)
 				return "", err
 			}
+		case <-vs.store.DiskSpaceLowChanged:
+			glog.V(0).Infof("volume server %s:%d updates read only volumes", vs.store.Ip, vs.store.Port)
+			if err = stream.Send(toIncrementalHeartbeat(lastVolumes, vs.store.CollectHeartbeat())); err != nil {
+				glog.V(0).Infof("Volume Server Failed to update to master %s: %v", masterNode, err)
+				return "", err
+			}
 		case <-ecShardTickChan:
 			glog.V(4).Infof("volume server %s:%d ec heartbeat", vs.store.Ip, vs.store.Port)
 			if err = stream.Send(vs.store.CollectErasureCodingHeartbeat()); err != nil {
@@ -237,3 +299,41 @@ func (vs *VolumeServer) doHeartbeat(masterNode, masterGrpcAddress string, grpcDi
 		}
 	}
 }
+
+// toIncrementalHeartbeat creates a heartbeat with only the volumes changed since the last reported volumes,
+// and remembers the volumes in the full heartbeat as the last reported volumes.
+func toIncrementalHeartbeat(lastVolumes map[uint32]*master_pb.VolumeInformationMessage, heartbeat *master_pb.Heartbeat) *master_pb.Heartbeat {
+	incrementalHeartbeat := &master_pb.Heartbeat{
+		Ip:              heartbeat.Ip,
+		Port:            heartbeat.Port,
+		PublicUrl:       heartbeat.PublicUrl,
+		MaxFileKey:      heartbeat.MaxFileKey,
+		DataCenter:      heartbeat.DataCenter,
+		Rack:            heartbeat.Rack,
+		MaxVolumeCounts: heartbeat.MaxVolumeCounts,
+		CollectionCaps:  heartbeat.CollectionCaps,
+	}
+	currentVolumes := make(map[uint32]bool)
+	for _, v := range heartbeat.Volumes {
+		currentVolumes[v.Id] = true
+		if last, found := lastVolumes[v.Id]; !found || !proto.Equal(last, v) {
+			incrementalHeartbeat.UpdatedVolumes = append(incrementalHeartbeat.UpdatedVolumes, v)
+			lastVolumes[v.Id] = v
+		}
+	}
+	for vid, v := range lastVolumes {
+		if currentVolumes[vid] {
+			continue
+		}
+		incrementalHeartbeat.DeletedVolumes = append(incrementalHeartbeat.DeletedVolumes, &master_pb.VolumeShortInformationMessage{
+			Id:               v.Id,
+			Collection:       v.Collection,
+			ReplicaPlacement: v.ReplicaPlacement,
+			Version:          v.Version,
+			Ttl:              v.Ttl,
+			DiskType:         v.DiskType,
+		})
+		delete(lastVolumes, vid)
+	}
+	return incrementalHeartbeat
+}
@@ -21,8 +21,20 @@ import (
 
 const BufferSizeLimit = 1024 * 1024 * 2
 
-// VolumeCopy copy the .idx .dat .vif files, and mount the volume
-func (vs *VolumeServer) VolumeCopy(ctx context.Context, req *volume_server_pb.VolumeCopyRequest) (*volume_server_pb.VolumeCopyResponse, error) {
+// volumeCopyProgressInterval is how many bytes are copied between the progress responses of VolumeCopy
+const volumeCopyProgressInterval = 64 * 1024 * 1024
+
+// copyProgressFunc is called with the bytes written so far to a copied file.
+// Returning false stops the copying.
+type copyProgressFunc func(processed int64) bool
+
+// VolumeCopy copy the .idx .dat .vif files, and mount the volume unless req.SkipMount.
+// The progress is streamed back while copying, and the last response has the LastAppendAtNs after mounting.
+// With req.SkipMount, the source volume can stay writable. The .note file is kept until VolumeTail catches up and mounts the volume,
+// so the partial volume is discarded if this server restarts meanwhile.
+func (vs *VolumeServer) VolumeCopy(req *volume_server_pb.VolumeCopyRequest, stream volume_server_pb.VolumeServer_VolumeCopyServer) error {
+
+	ctx := stream.Context()
 
 	v := vs.store.GetVolume(needle.VolumeId(req.VolumeId))
 	if v != nil {
@@ -31,7 +43,7 @@ func (vs *VolumeServer) VolumeCopy(ctx context.Context, req *volume_server_pb.Vo
 
 		err := vs.store.DeleteVolume(needle.VolumeId(req.VolumeId))
 		if err != nil {
-			return nil, fmt.Errorf("failed to delete existing volume %d: %v", req.VolumeId, err)
+			return fmt.Errorf("failed to delete existing volume %d: %v", req.VolumeId, err)
 		}
 
 		glog.V(0).Infof("deleted existing volume %d before copying.", req.VolumeId)
@@ -43,11 +55,14 @@ func (vs *VolumeServer) VolumeCopy(ctx context.Context, req *volume_server_pb.Vo
 	//   send .idx file
 	//   send .dat file
 	//   confirm size and timestamp
+	// the copying stops if the request is cancelled, e.g., the shell command is aborted,
+	// and starts over if the source volume server is unavailable for a while
 	var volFileInfoResp *volume_server_pb.ReadVolumeFileStatusResponse
+	var sendErr error
 	var dataBaseFileName, indexBaseFileName, idxFileName, datFileName string
-	err := operation.WithVolumeServerClient(req.SourceDataNode, vs.grpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
+	err := operation.WithVolumeServerClientRetry(ctx, operation.VolumeCopyRetryPolicy, req.SourceDataNode, vs.grpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
 		var err error
-		volFileInfoResp, err = client.ReadVolumeFileStatus(context.Background(),
+		volFileInfoResp, err = client.ReadVolumeFileStatus(ctx,
 			&volume_server_pb.ReadVolumeFileStatusRequest{
 				VolumeId: req.VolumeId,
 			})
@@ -69,60 +84,90 @@ func (vs *VolumeServer) VolumeCopy(ctx context.Context, req *volume_server_pb.Vo
 
 		ioutil.WriteFile(dataBaseFileName+".note", []byte(fmt.Sprintf("copying from %s", req.SourceDataNode)), 0755)
 
+		// report the progress of the .dat and .idx files, the .vif file is tiny
+		var copiedBytes, nextReportAt int64
+		totalBytes := volFileInfoResp.DatFileSize + volFileInfoResp.IdxFileSize
+		reportProgress := func(processed int64) bool {
+			if copiedBytes+processed < nextReportAt {
+				return true
+			}
+			nextReportAt = copiedBytes + processed + volumeCopyProgressInterval
+			sendErr = stream.Send(&volume_server_pb.VolumeCopyResponse{
+				ProcessedBytes: uint64(copiedBytes + processed),
+				TotalBytes:     totalBytes,
+			})
+			return sendErr == nil
+		}
+
 		// println("source:", volFileInfoResp.String())
-		if err := vs.doCopyFile(client, false, req.Collection, req.VolumeId, volFileInfoResp.CompactionRevision, volFileInfoResp.DatFileSize, dataBaseFileName, ".dat", false, true); err != nil {
+		if err := vs.doCopyFile(ctx, client, false, req.Collection, req.VolumeId, volFileInfoResp.CompactionRevision, volFileInfoResp.DatFileSize, dataBaseFileName, ".dat", false, true, reportProgress); err != nil {
 			return err
 		}
+		copiedBytes = int64(volFileInfoResp.DatFileSize)
 
-		if err := vs.doCopyFile(client, false, req.Collection, req.VolumeId, volFileInfoResp.CompactionRevision, volFileInfoResp.IdxFileSize, indexBaseFileName, ".idx", false, false); err != nil {
+		if err := vs.doCopyFile(ctx, client, false, req.Collection, req.VolumeId, volFileInfoResp.CompactionRevision, volFileInfoResp.IdxFileSize, indexBaseFileName, ".idx", false, false, reportProgress); err != nil {
 			return err
 		}
 
-		if err := vs.doCopyFile(client, false, req.Collection, req.VolumeId, volFileInfoResp.CompactionRevision, volFileInfoResp.DatFileSize, dataBaseFileName, ".vif", false, true); err != nil {
+		if err := vs.doCopyFile(ctx, client, false, req.Collection, req.VolumeId, volFileInfoResp.CompactionRevision, volFileInfoResp.DatFileSize, dataBaseFileName, ".vif", false, true, nil); err != nil {
 			return err
 		}
 
-		os.Remove(dataBaseFileName + ".note")
+		if req.SkipMount {
+			ioutil.WriteFile(dataBaseFileName+".note", []byte(fmt.Sprintf("copied from %s, waiting for tailing", req.SourceDataNode)), 0755)
+		} else {
+			os.Remove(dataBaseFileName + ".note")
+		}
 
 		return nil
 	})
 
+	if dataBaseFileName != "" {
+		idxFileName = indexBaseFileName + ".idx"
+		datFileName = dataBaseFileName + ".dat"
+		defer func() {
+			if err != nil {
+				os.Remove(idxFileName)
+				os.Remove(datFileName)
+				os.Remove(dataBaseFileName + ".vif")
+				os.Remove(dataBaseFileName + ".note")
+			}
+		}()
+	}
+
+	if sendErr != nil {
+		err = fmt.Errorf("send copy progress: %v", sendErr)
+	}
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if dataBaseFileName == "" {
-		return nil, fmt.Errorf("not found volume %d file", req.VolumeId)
+		return fmt.Errorf("not found volume %d file", req.VolumeId)
 	}
 
-	idxFileName = indexBaseFileName + ".idx"
-	datFileName = dataBaseFileName + ".dat"
-
-	defer func() {
-		if err != nil && dataBaseFileName != "" {
-			os.Remove(idxFileName)
-			os.Remove(datFileName)
-			os.Remove(dataBaseFileName + ".vif")
-		}
-	}()
-
 	if err = checkCopyFiles(volFileInfoResp, idxFileName, datFileName); err != nil { // added by panyc16
-		return nil, err
+		return err
 	}
 
 	// mount the volume
-	err = vs.store.MountVolume(needle.VolumeId(req.VolumeId))
-	if err != nil {
-		return nil, fmt.Errorf("failed to mount volume %d: %v", req.VolumeId, err)
+	if !req.SkipMount {
+		err = vs.store.MountVolume(needle.VolumeId(req.VolumeId))
+		if err != nil {
+			return fmt.Errorf("failed to mount volume %d: %v", req.VolumeId, err)
+		}
 	}
 
-	return &volume_server_pb.VolumeCopyResponse{
+	totalBytes := volFileInfoResp.DatFileSize + volFileInfoResp.IdxFileSize
+	return stream.Send(&volume_server_pb.VolumeCopyResponse{
 		LastAppendAtNs: volFileInfoResp.DatFileTimestampSeconds * uint64(time.Second),
-	}, err
+		ProcessedBytes: totalBytes,
+		TotalBytes:     totalBytes,
+	})
 }
 
-func (vs *VolumeServer) doCopyFile(client volume_server_pb.VolumeServerClient, isEcVolume bool, collection string, vid, compactRevision uint32, stopOffset uint64, baseFileName, ext string, isAppend, ignoreSourceFileNotFound bool) error {
+func (vs *VolumeServer) doCopyFile(ctx context.Context, client volume_server_pb.VolumeServerClient, isEcVolume bool, collection string, vid, compactRevision uint32, stopOffset uint64, baseFileName, ext string, isAppend, ignoreSourceFileNotFound bool, progressFn copyProgressFunc) error {
 
-	copyFileClient, err := client.CopyFile(context.Background(), &volume_server_pb.CopyFileRequest{
+	copyFileClient, err := client.CopyFile(ctx, &volume_server_pb.CopyFileRequest{
 		VolumeId:                 vid,
 		Ext:                      ext,
 		CompactionRevision:       compactRevision,
@@ -135,7 +180,7 @@ func (vs *VolumeServer) doCopyFile(client volume_server_pb.VolumeServerClient, i
 		return fmt.Errorf("failed to start copying volume %d %s file: %v", vid, ext, err)
 	}
 
-	err = writeToFile(copyFileClient, baseFileName+ext, util.NewWriteThrottler(vs.compactionBytePerSecond), isAppend)
+	err = writeToFile(copyFileClient, baseFileName+ext, util.NewWriteThrottler(vs.compactionBytePerSecond), isAppend, progressFn)
 	if err != nil {
 		return fmt.Errorf("failed to copy %s file: %v", baseFileName+ext, err)
 	}
@@ -169,7 +214,7 @@ func checkCopyFiles(originFileInf *volume_server_pb.ReadVolumeFileStatusResponse
 	return nil
 }
 
-func writeToFile(client volume_server_pb.VolumeServer_CopyFileClient, fileName string, wt *util.WriteThrottler, isAppend bool) error {
+func writeToFile(client volume_server_pb.VolumeServer_CopyFileClient, fileName string, wt *util.WriteThrottler, isAppend bool, progressFn copyProgressFunc) error {
 	glog.V(4).Infof("writing to %s", fileName)
 	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
 	if isAppend {
@@ -181,6 +226,7 @@ func writeToFile(client volume_server_pb.VolumeServer_CopyFileClient, fileName s
 	}
 	defer dst.Close()
 
+	var processed int64
 	for {
 		resp, receiveErr := client.Recv()
 		if receiveErr == io.EOF {
@@ -189,7 +235,13 @@ func writeToFile(client volume_server_pb.VolumeServer_CopyFileClient, fileName s
 		if receiveErr != nil {
 			return fmt.Errorf("receiving %s: %v", fileName, receiveErr)
 		}
-		dst.Write(resp.FileContent)
+		if _, writeErr := dst.Write(resp.FileContent); writeErr != nil {
+			return fmt.Errorf("writing %s: %v", fileName, writeErr)
+		}
+		processed += int64(len(resp.FileContent))
+		if progressFn != nil && !progressFn(processed) {
+			return fmt.Errorf("writing %s: stopped at %d bytes", fileName, processed)
+		}
 		wt.MaybeSlowdown(int64(len(resp.FileContent)))
 	}
 	return nil
@@ -265,6 +317,11 @@ func (vs *VolumeServer) CopyFile(req *volume_server_pb.CopyFileRequest, stream v
 	buffer := make([]byte, BufferSizeLimit)
 
 	for bytesToRead > 0 {
+		// stop reading if the client has cancelled or timed out
+		if ctxErr := stream.Context().Err(); ctxErr != nil {
+			return ctxErr
+		}
+
 		bytesread, err := file.Read(buffer)
 
 		// println(fileName, "read", bytesread, "bytes, with target", bytesToRead)
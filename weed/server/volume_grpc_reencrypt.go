@@ -0,0 +1,69 @@
+package weed_server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// VolumeNeedleReencrypt decrypts a needle with its current cipher key,
+// and uploads it to the target file id encrypted with a new cipher key.
+// The original needle is not changed, so it can still be read until the file meta data points to the new file id.
+func (vs *VolumeServer) VolumeNeedleReencrypt(ctx context.Context, req *volume_server_pb.VolumeNeedleReencryptRequest) (*volume_server_pb.VolumeNeedleReencryptResponse, error) {
+
+	resp := &volume_server_pb.VolumeNeedleReencryptResponse{}
+
+	volumeId := needle.VolumeId(req.VolumeId)
+
+	n := &needle.Needle{
+		Id: types.NeedleId(req.NeedleId),
+	}
+
+	var count int
+	var err error
+	hasVolume := vs.store.HasVolume(volumeId)
+	if !hasVolume {
+		_, hasEcVolume := vs.store.FindEcVolume(volumeId)
+		if !hasEcVolume {
+			return nil, fmt.Errorf("volume not found %d", req.VolumeId)
+		}
+		count, err = vs.store.ReadEcShardNeedle(volumeId, n)
+	} else {
+		count, err = vs.store.ReadVolumeNeedle(volumeId, n, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read needle %d in volume %d: %v", req.NeedleId, req.VolumeId, err)
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("needle not found %d", n.Id)
+	}
+	if n.Cookie != types.Cookie(req.Cookie) {
+		return nil, fmt.Errorf("needle %d cookie mismatch: %x expected %x", n.Id, n.Cookie, req.Cookie)
+	}
+
+	clearData, err := util.Decrypt(n.Data, util.CipherKey(req.CipherKey))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt needle %d in volume %d: %v", req.NeedleId, req.VolumeId, err)
+	}
+
+	targetUrl := fmt.Sprintf("http://%s/%s", req.TargetUrl, req.TargetFileId)
+	uploadResult, err := operation.UploadData(targetUrl, "", true, clearData, false, "", nil, security.EncodedJwt(req.TargetAuth))
+	if err != nil {
+		return nil, fmt.Errorf("upload to %s: %v", targetUrl, err)
+	}
+	glog.V(1).Infof("reencrypted needle %d in volume %d to %s", req.NeedleId, req.VolumeId, req.TargetFileId)
+
+	resp.CipherKey = uploadResult.CipherKey
+	resp.Size = uint64(uploadResult.Size)
+	resp.ETag = uploadResult.ContentMd5
+
+	return resp, nil
+
+}
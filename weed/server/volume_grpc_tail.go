@@ -3,6 +3,7 @@ package weed_server
 import (
 	"context"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
@@ -13,6 +14,9 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
 )
 
+// volumeTailMaxPasses limits the passes of VolumeTail to catch up with a busy source volume
+const volumeTailMaxPasses = 10
+
 func (vs *VolumeServer) VolumeTailSender(req *volume_server_pb.VolumeTailSenderRequest, stream volume_server_pb.VolumeServer_VolumeTailSenderServer) error {
 
 	v := vs.store.GetVolume(needle.VolumeId(req.VolumeId))
@@ -31,6 +35,9 @@ func (vs *VolumeServer) VolumeTailSender(req *volume_server_pb.VolumeTailSenderR
 			glog.Infof("sendNeedlesSince: %v", err)
 			return fmt.Errorf("streamFollow: %v", err)
 		}
+		if req.UntilCaughtUp {
+			return nil
+		}
 		time.Sleep(2 * time.Second)
 
 		if req.IdleTimeoutSeconds == 0 {
@@ -96,6 +103,62 @@ func (vs *VolumeServer) VolumeTailReceiver(ctx context.Context, req *volume_serv
 
 }
 
+// VolumeTail applies the updates of the source volume since req.SinceNs to the copied volume, which is not mounted yet.
+// It follows the source volume until caught up, or until the source volume is idle for req.IdleTimeoutSeconds if set.
+// Since the copied volume is not mounted, it is not visible to the master and the clients during the tailing.
+func (vs *VolumeServer) VolumeTail(ctx context.Context, req *volume_server_pb.VolumeTailRequest) (*volume_server_pb.VolumeTailResponse, error) {
+
+	v, err := vs.store.LoadUnmountedVolume(needle.VolumeId(req.VolumeId))
+	if err != nil {
+		return nil, err
+	}
+	defer v.Close()
+
+	resp := &volume_server_pb.VolumeTailResponse{
+		LastAppendAtNs: req.SinceNs,
+	}
+	applyNeedle := func(n *needle.Needle) error {
+		appendAtNs := n.AppendAtNs
+		if err := v.WriteTailedNeedle(n); err != nil {
+			return fmt.Errorf("apply needle %d: %v", n.Id, err)
+		}
+		resp.LastAppendAtNs = appendAtNs
+		resp.NeedleCount++
+		return nil
+	}
+
+	if req.IdleTimeoutSeconds > 0 {
+		err = operation.TailVolumeFromSource(req.SourceVolumeServer, vs.grpcDialOption, v.Id, req.SinceNs, int(req.IdleTimeoutSeconds), applyNeedle)
+	} else {
+		// the source volume may be written meanwhile, so repeat until one pass is quick enough
+		for i := 0; i < volumeTailMaxPasses; i++ {
+			startTime, needleCount := time.Now(), resp.NeedleCount
+			if err = operation.TailVolumeFromSourceUntilCaughtUp(req.SourceVolumeServer, vs.grpcDialOption, v.Id, resp.LastAppendAtNs, applyNeedle); err != nil {
+				break
+			}
+			if resp.NeedleCount == needleCount || time.Since(startTime) < time.Second {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tail volume %d from %s: %v", req.VolumeId, req.SourceVolumeServer, err)
+	}
+	glog.V(0).Infof("tailed volume %d from %s: %d needles", req.VolumeId, req.SourceVolumeServer, resp.NeedleCount)
+
+	if !req.Mount {
+		return resp, nil
+	}
+
+	v.Close()
+	os.Remove(v.FileName(".note"))
+	if err = vs.store.MountVolume(v.Id); err != nil {
+		return nil, fmt.Errorf("failed to mount volume %d: %v", req.VolumeId, err)
+	}
+
+	return resp, nil
+}
+
 // generate the volume idx
 type VolumeFileScanner4Tailing struct {
 	stream                   volume_server_pb.VolumeServer_VolumeTailSenderServer
@@ -81,5 +81,7 @@ func (vs *VolumeServer) VolumeTierMoveDatFromRemote(req *volume_server_pb.Volume
 	v.DataBackend.Close()
 	v.DataBackend = nil
 
+	vs.store.NotifyVolumeUpdated(v.Id)
+
 	return nil
 }
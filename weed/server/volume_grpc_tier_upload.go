@@ -96,5 +96,7 @@ func (vs *VolumeServer) VolumeTierMoveDatToRemote(req *volume_server_pb.VolumeTi
 		os.Remove(v.FileName(".dat"))
 	}
 
+	vs.store.NotifyVolumeUpdated(v.Id)
+
 	return nil
 }
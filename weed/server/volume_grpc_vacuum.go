@@ -2,10 +2,17 @@ package weed_server
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"math"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/operation"
 	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage/idx"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle_map"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
 )
 
 func (vs *VolumeServer) VacuumVolumeCheck(ctx context.Context, req *volume_server_pb.VacuumVolumeCheckRequest) (*volume_server_pb.VacuumVolumeCheckResponse, error) {
@@ -28,7 +35,7 @@ func (vs *VolumeServer) VacuumVolumeCompact(ctx context.Context, req *volume_ser
 
 	resp := &volume_server_pb.VacuumVolumeCompactResponse{}
 
-	err := vs.store.CompactVolume(needle.VolumeId(req.VolumeId), req.Preallocate, vs.compactionBytePerSecond)
+	err := vs.store.CompactVolume(needle.VolumeId(req.VolumeId), req.Preallocate, vs.compactionBytePerSecond, vs.deleteGracePeriod)
 
 	if err != nil {
 		glog.Errorf("compact volume %d: %v", req.VolumeId, err)
@@ -40,6 +47,69 @@ func (vs *VolumeServer) VacuumVolumeCompact(ctx context.Context, req *volume_ser
 
 }
 
+func (vs *VolumeServer) VacuumVolumeVerify(ctx context.Context, req *volume_server_pb.VacuumVolumeVerifyRequest) (*volume_server_pb.VacuumVolumeVerifyResponse, error) {
+
+	resp := &volume_server_pb.VacuumVolumeVerifyResponse{}
+
+	siblingNm := needle_map.NewMemDb()
+	defer siblingNm.Close()
+	err := operation.WithVolumeServerClient(req.SiblingDataNode, vs.grpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
+		// the sibling may have been compacted already
+		copyFileClient, err := client.CopyFile(ctx, &volume_server_pb.CopyFileRequest{
+			VolumeId:           req.VolumeId,
+			Ext:                ".idx",
+			CompactionRevision: math.MaxUint32,
+			StopOffset:         math.MaxInt64,
+		})
+		if err != nil {
+			return err
+		}
+		return readIndexEntries(copyFileClient, func(key types.NeedleId, offset types.Offset, size types.Size) error {
+			if offset.IsZero() || size.IsDeleted() {
+				return siblingNm.Delete(key)
+			}
+			return siblingNm.Set(key, offset, size)
+		})
+	})
+	if err != nil {
+		glog.Errorf("read index of volume %d from %s: %v", req.VolumeId, req.SiblingDataNode, err)
+		return nil, fmt.Errorf("read index of volume %d from %s: %v", req.VolumeId, req.SiblingDataNode, err)
+	}
+
+	resp.CheckedCount, resp.InconsistentCount, err = vs.store.VerifyCompactVolume(needle.VolumeId(req.VolumeId), siblingNm)
+
+	if err != nil {
+		glog.Errorf("verify compacted volume %d with %s: %v", req.VolumeId, req.SiblingDataNode, err)
+	} else {
+		glog.V(1).Infof("verify compacted volume %d with %s: %d checked, %d inconsistent", req.VolumeId, req.SiblingDataNode, resp.CheckedCount, resp.InconsistentCount)
+	}
+
+	return resp, err
+
+}
+
+// readIndexEntries calls fn with each entry of the .idx file streamed by CopyFile
+func readIndexEntries(client volume_server_pb.VolumeServer_CopyFileClient, fn func(key types.NeedleId, offset types.Offset, size types.Size) error) error {
+	var buf []byte
+	for {
+		resp, receiveErr := client.Recv()
+		if receiveErr == io.EOF {
+			return nil
+		}
+		if receiveErr != nil {
+			return receiveErr
+		}
+		buf = append(buf, resp.FileContent...)
+		i := 0
+		for ; i+types.NeedleMapEntrySize <= len(buf); i += types.NeedleMapEntrySize {
+			if err := fn(idx.IdxFileEntry(buf[i : i+types.NeedleMapEntrySize])); err != nil {
+				return err
+			}
+		}
+		buf = append(buf[:0], buf[i:]...)
+	}
+}
+
 func (vs *VolumeServer) VacuumVolumeCommit(ctx context.Context, req *volume_server_pb.VacuumVolumeCommitRequest) (*volume_server_pb.VacuumVolumeCommitResponse, error) {
 
 	resp := &volume_server_pb.VacuumVolumeCommitResponse{}
@@ -1,25 +1,31 @@
 package weed_server
 
 import (
-	"fmt"
 	"github.com/chrislusf/seaweedfs/weed/storage/types"
 	"net/http"
 	"sync"
+	"time"
 
 	"google.golang.org/grpc"
 
 	"github.com/chrislusf/seaweedfs/weed/stats"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/storage"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/topology"
 )
 
+const indexMemoryBudgetCheckInterval = time.Minute
+
 type VolumeServer struct {
 	inFlightDataSize      int64
 	concurrentUploadLimit int64
 	inFlightDataLimitCond *sync.Cond
+	asyncReplicator       *topology.AsyncReplicator
 
 	SeedMasterNodes []string
 	currentMaster   string
@@ -28,17 +34,24 @@ type VolumeServer struct {
 	rack            string
 	store           *storage.Store
 	guard           *security.Guard
+	whiteList       []string
 	grpcDialOption  grpc.DialOption
 
 	needleMapKind           storage.NeedleMapKind
 	FixJpgOrientation       bool
 	ReadMode                string
 	compactionBytePerSecond int64
+	deleteGracePeriod       time.Duration
 	metricsAddress          string
 	metricsIntervalSec      int
 	fileSizeLimitBytes      int64
 	isHeartbeating          bool
 	stopChan                chan bool
+	heartbeatStopped        chan struct{}
+
+	// the Cache-Control and Expires headers of the reads, reloaded with volume.toml
+	cacheConf     *VolumeCacheConf
+	cacheConfLock sync.RWMutex
 }
 
 func NewVolumeServer(adminMux, publicMux *http.ServeMux, ip string,
@@ -46,6 +59,7 @@ func NewVolumeServer(adminMux, publicMux *http.ServeMux, ip string,
 	folders []string, maxCounts []int, minFreeSpaces []util.MinFreeSpace, diskTypes []types.DiskType,
 	idxFolder string,
 	needleMapKind storage.NeedleMapKind,
+	checkLevel storage.VolumeCheckLevel,
 	masterNodes []string, pulseSeconds int,
 	dataCenter string, rack string,
 	whiteList []string,
@@ -54,18 +68,15 @@ func NewVolumeServer(adminMux, publicMux *http.ServeMux, ip string,
 	compactionMBPerSecond int,
 	fileSizeLimitMB int,
 	concurrentUploadLimit int64,
+	deleteGraceMinutes int,
+	crossDcReplicationQueue int,
+	indexMemoryBudgetMB int,
 ) *VolumeServer {
 
 	v := util.GetViper()
 	signingKey := v.GetString("jwt.signing.key")
-	v.SetDefault("jwt.signing.expires_after_seconds", 10)
-	expiresAfterSec := v.GetInt("jwt.signing.expires_after_seconds")
 	enableUiAccess := v.GetBool("access.ui")
 
-	readSigningKey := v.GetString("jwt.signing.read.key")
-	v.SetDefault("jwt.signing.read.expires_after_seconds", 60)
-	readExpiresAfterSec := v.GetInt("jwt.signing.read.expires_after_seconds")
-
 	vs := &VolumeServer{
 		pulseSeconds:            pulseSeconds,
 		dataCenter:              dataCenter,
@@ -76,8 +87,10 @@ func NewVolumeServer(adminMux, publicMux *http.ServeMux, ip string,
 		grpcDialOption:          security.LoadClientTLS(util.GetViper(), "grpc.volume"),
 		compactionBytePerSecond: int64(compactionMBPerSecond) * 1024 * 1024,
 		fileSizeLimitBytes:      int64(fileSizeLimitMB) * 1024 * 1024,
+		deleteGracePeriod:       time.Duration(deleteGraceMinutes) * time.Minute,
 		isHeartbeating:          true,
 		stopChan:                make(chan bool),
+		heartbeatStopped:        make(chan struct{}),
 		inFlightDataLimitCond:   sync.NewCond(new(sync.Mutex)),
 		concurrentUploadLimit:   concurrentUploadLimit,
 	}
@@ -85,8 +98,24 @@ func NewVolumeServer(adminMux, publicMux *http.ServeMux, ip string,
 
 	vs.checkWithMaster()
 
-	vs.store = storage.NewStore(vs.grpcDialOption, port, ip, publicUrl, folders, maxCounts, minFreeSpaces, idxFolder, vs.needleMapKind, diskTypes)
-	vs.guard = security.NewGuard(whiteList, signingKey, expiresAfterSec, readSigningKey, readExpiresAfterSec)
+	vs.store = storage.NewStore(vs.grpcDialOption, port, ip, publicUrl, folders, maxCounts, minFreeSpaces, idxFolder, vs.needleMapKind, checkLevel, diskTypes)
+	vs.store.IndexMemoryBudget = uint64(indexMemoryBudgetMB) * 1024 * 1024
+	vs.whiteList = whiteList
+	vs.guard = security.LoadGuard(v, whiteList)
+	if err := vs.loadCacheConf(); err != nil {
+		glog.Fatalf("load volume.toml: %v", err)
+	}
+	if err := vs.loadPreallocation(); err != nil {
+		glog.Fatalf("load volume.toml: %v", err)
+	}
+	if err := vs.loadCollectionCaps(); err != nil {
+		glog.Fatalf("load volume.toml: %v", err)
+	}
+	if crossDcReplicationQueue > 0 {
+		vs.asyncReplicator = topology.NewAsyncReplicator(crossDcReplicationQueue, vs.guard.GetSigningKey, func(volumeId needle.VolumeId) error {
+			return vs.store.MarkVolumeReplicasOutOfSync(volumeId, true)
+		})
+	}
 
 	handleStaticResources(adminMux)
 	adminMux.HandleFunc("/status", vs.statusHandler)
@@ -99,15 +128,18 @@ func NewVolumeServer(adminMux, publicMux *http.ServeMux, ip string,
 			adminMux.HandleFunc("/stats/disk", vs.guard.WhiteList(vs.statsDiskHandler))
 		*/
 	}
-	adminMux.HandleFunc("/", vs.privateStoreHandler)
+	adminMux.Handle("/", request_id.Middleware(http.HandlerFunc(vs.privateStoreHandler)))
 	if publicMux != adminMux {
 		// separated admin and public port
 		handleStaticResources(publicMux)
-		publicMux.HandleFunc("/", vs.publicReadOnlyHandler)
+		publicMux.Handle("/", request_id.Middleware(http.HandlerFunc(vs.publicReadOnlyHandler)))
 	}
 
 	go vs.heartbeat()
-	go stats.LoopPushingMetric("volumeServer", fmt.Sprintf("%s:%d", ip, port), vs.metricsAddress, vs.metricsIntervalSec)
+	if vs.store.IndexMemoryBudget > 0 {
+		go vs.loopEnforceIndexMemoryBudget()
+	}
+	go stats.LoopPushingMetric("volumeServer", util.JoinHostPort(ip, port), vs.metricsAddress, vs.metricsIntervalSec)
 
 	return vs
 }
@@ -117,8 +149,41 @@ func (vs *VolumeServer) SetStopping() {
 	vs.store.SetStopping()
 }
 
+// Reload updates the white list and the signing keys from security.toml, and the cache headers, the preallocation and the collection caps from volume.toml
+func (vs *VolumeServer) Reload() {
+	glog.V(0).Infoln("Reload volume server...")
+	if loaded, err := util.ReloadConfiguration("volume"); err != nil {
+		glog.Errorf("reload volume configuration: %v", err)
+	} else if loaded {
+		if err = vs.loadCacheConf(); err != nil {
+			glog.Errorf("reload volume cache headers: %v", err)
+		}
+		if err = vs.loadPreallocation(); err != nil {
+			glog.Errorf("reload volume preallocation: %v", err)
+		}
+		if err = vs.loadCollectionCaps(); err != nil {
+			glog.Errorf("reload volume collection caps: %v", err)
+		}
+	}
+	if _, err := util.ReloadConfiguration("security"); err != nil {
+		glog.Errorf("reload security configuration: %v", err)
+		return
+	}
+	if err := vs.guard.Reload(util.GetViper(), vs.whiteList); err != nil {
+		glog.Errorf("reload volume server guard: %v", err)
+	}
+}
+
 func (vs *VolumeServer) Shutdown() {
 	glog.V(0).Infoln("Shutting down volume server...")
 	vs.store.Close()
 	glog.V(0).Infoln("Shut down successfully!")
 }
+
+// loopEnforceIndexMemoryBudget checks the index memory periodically, since the in-memory indexes grow with the writes
+func (vs *VolumeServer) loopEnforceIndexMemoryBudget() {
+	for {
+		vs.store.EnforceIndexMemoryBudget()
+		time.Sleep(indexMemoryBudgetCheckInterval)
+	}
+}
@@ -0,0 +1,91 @@
+package weed_server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// VolumeCacheConf is the Cache-Control and Expires headers of the reads from the volume servers,
+// configured in the [volume.http] section of volume.toml, with optional overrides by the collections.
+type VolumeCacheConf struct {
+	global      *CollectionCacheConf
+	collections map[string]*CollectionCacheConf
+}
+
+type CollectionCacheConf struct {
+	// e.g., "public, max-age=86400" for the files never changed under the same file id
+	CacheControl        string
+	ExpiresAfterSeconds int
+}
+
+// LoadVolumeCacheConf reads the [volume.http] section of volume.toml, and the [[volume.http.collections]] overriding it
+func LoadVolumeCacheConf(v *util.ViperProxy) (*VolumeCacheConf, error) {
+	conf := &VolumeCacheConf{
+		global: &CollectionCacheConf{
+			CacheControl:        v.GetString("volume.http.cache_control"),
+			ExpiresAfterSeconds: v.GetInt("volume.http.expires_after_seconds"),
+		},
+		collections: make(map[string]*CollectionCacheConf),
+	}
+
+	items, _ := v.Get("volume.http.collections").([]interface{})
+	for _, item := range items {
+		values, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected volume.http.collections %v", item)
+		}
+		collection, found := values["collection"].(string)
+		if !found {
+			return nil, fmt.Errorf("volume.http.collections %v needs collection", item)
+		}
+		collectionConf := *conf.global
+		if cacheControl, found := values["cache_control"]; found {
+			collectionConf.CacheControl = fmt.Sprint(cacheControl)
+		}
+		if expiresAfterSeconds, found := values["expires_after_seconds"]; found {
+			seconds, err := strconv.Atoi(fmt.Sprint(expiresAfterSeconds))
+			if err != nil {
+				return nil, fmt.Errorf("volume.http.collections %v expires_after_seconds: %v", item, err)
+			}
+			collectionConf.ExpiresAfterSeconds = seconds
+		}
+		conf.collections[collection] = &collectionConf
+	}
+
+	return conf, nil
+}
+
+// setCacheHeaders sets the Cache-Control and Expires headers of the collection, if configured
+func (conf *VolumeCacheConf) setCacheHeaders(w http.ResponseWriter, collection string, now time.Time) {
+	collectionConf, found := conf.collections[collection]
+	if !found {
+		collectionConf = conf.global
+	}
+	if collectionConf.CacheControl != "" {
+		w.Header().Set("Cache-Control", collectionConf.CacheControl)
+	}
+	if collectionConf.ExpiresAfterSeconds > 0 {
+		w.Header().Set("Expires", now.Add(time.Duration(collectionConf.ExpiresAfterSeconds)*time.Second).UTC().Format(http.TimeFormat))
+	}
+}
+
+func (vs *VolumeServer) loadCacheConf() error {
+	conf, err := LoadVolumeCacheConf(util.GetViper())
+	if err != nil {
+		return err
+	}
+	vs.cacheConfLock.Lock()
+	vs.cacheConf = conf
+	vs.cacheConfLock.Unlock()
+	return nil
+}
+
+func (vs *VolumeServer) getCacheConf() *VolumeCacheConf {
+	vs.cacheConfLock.RLock()
+	defer vs.cacheConfLock.RUnlock()
+	return vs.cacheConf
+}
@@ -0,0 +1,51 @@
+package weed_server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+func TestVolumeCacheConf(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("toml")
+	assert.Equal(t, nil, v.ReadConfig(strings.NewReader(`
+[volume.http]
+cache_control = "public, max-age=86400"
+expires_after_seconds = 86400
+
+[[volume.http.collections]]
+collection = "private"
+cache_control = "private, no-store"
+expires_after_seconds = 0
+
+[[volume.http.collections]]
+collection = "images"
+expires_after_seconds = 60
+`)))
+	conf, err := LoadVolumeCacheConf(&util.ViperProxy{Viper: v})
+	assert.Equal(t, nil, err)
+	now := time.Unix(1600000000, 0)
+
+	w := httptest.NewRecorder()
+	conf.setCacheHeaders(w, "", now)
+	assert.Equal(t, "public, max-age=86400", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "Mon, 14 Sep 2020 12:26:40 GMT", w.Header().Get("Expires"))
+
+	w = httptest.NewRecorder()
+	conf.setCacheHeaders(w, "private", now)
+	assert.Equal(t, "private, no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "", w.Header().Get("Expires"))
+
+	// the collection inherits the cache control
+	w = httptest.NewRecorder()
+	conf.setCacheHeaders(w, "images", now)
+	assert.Equal(t, "public, max-age=86400", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "Sun, 13 Sep 2020 12:27:40 GMT", w.Header().Get("Expires"))
+}
@@ -0,0 +1,53 @@
+package weed_server
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/chrislusf/seaweedfs/weed/storage"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// LoadCollectionCaps reads the [[volume.collection_caps]] of volume.toml
+func LoadCollectionCaps(v *util.ViperProxy) (map[string]storage.CollectionCap, error) {
+	collectionCaps := make(map[string]storage.CollectionCap)
+
+	items, _ := v.Get("volume.collection_caps").([]interface{})
+	for _, item := range items {
+		values, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected volume.collection_caps %v", item)
+		}
+		collection, found := values["collection"].(string)
+		if !found {
+			return nil, fmt.Errorf("volume.collection_caps %v needs collection", item)
+		}
+		var collectionCap storage.CollectionCap
+		if value, found := values["max_volume_count"]; found {
+			count, err := strconv.Atoi(fmt.Sprint(value))
+			if err != nil || count < 0 {
+				return nil, fmt.Errorf("volume.collection_caps %v max_volume_count: %v", item, value)
+			}
+			collectionCap.MaxVolumeCount = count
+		}
+		if value, found := values["max_disk_usage_gb"]; found {
+			gb, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+			if err != nil || gb < 0 {
+				return nil, fmt.Errorf("volume.collection_caps %v max_disk_usage_gb: %v", item, value)
+			}
+			collectionCap.MaxDiskUsage = uint64(gb * 1024 * 1024 * 1024)
+		}
+		collectionCaps[collection] = collectionCap
+	}
+
+	return collectionCaps, nil
+}
+
+func (vs *VolumeServer) loadCollectionCaps() error {
+	collectionCaps, err := LoadCollectionCaps(util.GetViper())
+	if err != nil {
+		return err
+	}
+	vs.store.SetCollectionCaps(collectionCaps)
+	return nil
+}
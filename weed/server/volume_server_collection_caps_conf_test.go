@@ -0,0 +1,42 @@
+package weed_server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chrislusf/seaweedfs/weed/storage"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+func TestLoadCollectionCaps(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("toml")
+	assert.Equal(t, nil, v.ReadConfig(strings.NewReader(`
+[[volume.collection_caps]]
+collection = "logs"
+max_disk_usage_gb = 2000
+
+[[volume.collection_caps]]
+collection = "tenant1"
+max_volume_count = 10
+max_disk_usage_gb = 0.5
+`)))
+	collectionCaps, err := LoadCollectionCaps(&util.ViperProxy{Viper: v})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[string]storage.CollectionCap{
+		"logs":    {MaxDiskUsage: 2000 << 30},
+		"tenant1": {MaxVolumeCount: 10, MaxDiskUsage: 512 << 20},
+	}, collectionCaps)
+
+	v = viper.New()
+	v.SetConfigType("toml")
+	assert.Equal(t, nil, v.ReadConfig(strings.NewReader(`
+[[volume.collection_caps]]
+max_volume_count = 10
+`)))
+	_, err = LoadCollectionCaps(&util.ViperProxy{Viper: v})
+	assert.NotEqual(t, nil, err)
+}
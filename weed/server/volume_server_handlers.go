@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/chrislusf/seaweedfs/weed/util"
 
@@ -87,11 +88,11 @@ func (vs *VolumeServer) publicReadOnlyHandler(w http.ResponseWriter, r *http.Req
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 	}
 	switch r.Method {
-	case "GET":
-		stats.ReadRequest()
-		vs.GetOrHeadHandler(w, r)
-	case "HEAD":
+	case "GET", "HEAD":
 		stats.ReadRequest()
+		if !vs.checkSignedUrl(w, r) {
+			return
+		}
 		vs.GetOrHeadHandler(w, r)
 	case "OPTIONS":
 		stats.ReadRequest()
@@ -100,22 +101,26 @@ func (vs *VolumeServer) publicReadOnlyHandler(w http.ResponseWriter, r *http.Req
 	}
 }
 
-func (vs *VolumeServer) maybeCheckJwtAuthorization(r *http.Request, vid, fid string, isWrite bool) bool {
+// checkSignedUrl requires the signed urls for the reads from the public port, if url.signing.key is set in security.toml
+func (vs *VolumeServer) checkSignedUrl(w http.ResponseWriter, r *http.Request) bool {
+	signingKey := vs.guard.GetUrlSigningKey()
+	if len(signingKey) == 0 {
+		return true
+	}
+	vid, fid, _, _, _ := parseURLPath(r.URL.Path)
+	if err := security.VerifyFileIdUrl(signingKey, vid+","+fid, r.URL.Query(), time.Now()); err != nil {
+		glog.V(1).Infof("signed url %s from %s: %v", r.URL, r.RemoteAddr, err)
+		writeJsonError(w, r, http.StatusForbidden, err)
+		return false
+	}
+	return true
+}
 
-	var signingKey security.SigningKey
+func (vs *VolumeServer) maybeCheckJwtAuthorization(r *http.Request, vid, fid string, isWrite bool) bool {
 
-	if isWrite {
-		if len(vs.guard.SigningKey) == 0 {
-			return true
-		} else {
-			signingKey = vs.guard.SigningKey
-		}
-	} else {
-		if len(vs.guard.ReadSigningKey) == 0 {
-			return true
-		} else {
-			signingKey = vs.guard.ReadSigningKey
-		}
+	signingKeys := vs.guard.VerifyingKeys(isWrite)
+	if len(signingKeys) == 0 {
+		return true
 	}
 
 	tokenStr := security.GetJwt(r)
@@ -124,7 +129,14 @@ func (vs *VolumeServer) maybeCheckJwtAuthorization(r *http.Request, vid, fid str
 		return false
 	}
 
-	token, err := security.DecodeJwt(signingKey, tokenStr)
+	token, err := security.DecodeJwt(signingKeys[0], tokenStr)
+	for _, previousKey := range signingKeys[1:] {
+		if err == nil {
+			break
+		}
+		// the jwt may be signed by the key replaced by a configuration reload
+		token, err = security.DecodeJwt(previousKey, tokenStr)
+	}
 	if err != nil {
 		glog.V(1).Infof("jwt verification error from %s: %v", r.RemoteAddr, err)
 		return false
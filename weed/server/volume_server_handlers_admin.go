@@ -23,6 +23,7 @@ func (vs *VolumeServer) statusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	m["DiskStatuses"] = ds
 	m["Volumes"] = vs.store.VolumeInfos()
+	m["IndexMemory"] = vs.store.IndexMemoryStatus()
 	writeJsonQuiet(w, r, http.StatusOK, m)
 }
 
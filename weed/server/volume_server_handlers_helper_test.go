@@ -0,0 +1,39 @@
+package weed_server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRange(t *testing.T) {
+
+	tests := []struct {
+		header string
+		ranges []httpRange
+		err    error
+	}{
+		{"bytes=0-9", []httpRange{{0, 10}}, nil},
+		{"bytes=0-9,20-", []httpRange{{0, 10}, {20, 80}}, nil},
+		{"bytes=-10", []httpRange{{90, 10}}, nil},
+		{"bytes=-200", []httpRange{{0, 100}}, nil},
+		{"bytes=90-200", []httpRange{{90, 10}}, nil},
+		{"bytes=0-9,100-", []httpRange{{0, 10}}, nil},
+		{"bytes=100-", nil, errNoOverlap},
+		{"bytes=200-300,100-", nil, errNoOverlap},
+		{"bytes=-0", nil, errNoOverlap},
+	}
+
+	for _, tt := range tests {
+		ranges, err := parseRange(tt.header, 100)
+		assert.Equal(t, tt.err, err, tt.header)
+		assert.Equal(t, tt.ranges, ranges, tt.header)
+	}
+
+	for _, header := range []string{"bits=0-9", "bytes=9-0", "bytes=a-b", "bytes=--5"} {
+		_, err := parseRange(header, 100)
+		assert.NotNil(t, err, header)
+		assert.NotEqual(t, errNoOverlap, err, header)
+	}
+
+}
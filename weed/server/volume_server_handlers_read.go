@@ -17,6 +17,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/images"
 	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/stats"
 	"github.com/chrislusf/seaweedfs/weed/storage"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
@@ -43,13 +44,13 @@ func (vs *VolumeServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 
 	volumeId, err := needle.NewVolumeId(vid)
 	if err != nil {
-		glog.V(2).Infof("parsing vid %s: %v", r.URL.Path, err)
+		glog.V(2).InfofCtx(r.Context(), "parsing vid %s: %v", r.URL.Path, err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	err = n.ParsePath(fid)
 	if err != nil {
-		glog.V(2).Infof("parsing fid %s: %v", r.URL.Path, err)
+		glog.V(2).InfofCtx(r.Context(), "parsing fid %s: %v", r.URL.Path, err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -59,14 +60,14 @@ func (vs *VolumeServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 	_, hasEcVolume := vs.store.FindEcVolume(volumeId)
 	if !hasVolume && !hasEcVolume {
 		if vs.ReadMode == "local" {
-			glog.V(0).Infoln("volume is not local:", err, r.URL.Path)
+			glog.V(0).InfofCtx(r.Context(), "volume is not local: %v %s", err, r.URL.Path)
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
 		lookupResult, err := operation.Lookup(vs.GetMaster, volumeId.String())
 		glog.V(2).Infoln("volume", volumeId, "found on", lookupResult, "error", err)
 		if err != nil || len(lookupResult.Locations) <= 0 {
-			glog.V(0).Infoln("lookup error:", err, r.URL.Path)
+			glog.V(0).InfofCtx(r.Context(), "lookup error: %v %s", err, r.URL.Path)
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
@@ -77,7 +78,7 @@ func (vs *VolumeServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 			r.URL.Scheme = u.Scheme
 			request, err := http.NewRequest("GET", r.URL.String(), nil)
 			if err != nil {
-				glog.V(0).Infof("failed to instance http request of url %s: %v", r.URL.String(), err)
+				glog.V(0).InfofCtx(r.Context(), "failed to instance http request of url %s: %v", r.URL.String(), err)
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
@@ -87,9 +88,9 @@ func (vs *VolumeServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 				}
 			}
 
-			response, err := client.Do(request)
+			response, err := operation.HttpClient.Do(request)
 			if err != nil {
-				glog.V(0).Infof("request remote url %s: %v", r.URL.String(), err)
+				glog.V(0).InfofCtx(r.Context(), "request remote url %s: %v", r.URL.String(), err)
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
@@ -111,6 +112,12 @@ func (vs *VolumeServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 			if c := r.FormValue("collection"); c != "" {
 				arg.Set("collection", c)
 			}
+			// the signed url is verified by the target server again
+			for _, param := range []string{security.SignedUrlExpiresParam, security.SignedUrlSignatureParam} {
+				if value := r.FormValue(param); value != "" {
+					arg.Set(param, value)
+				}
+			}
 			u.RawQuery = arg.Encode()
 			http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
 			return
@@ -120,29 +127,52 @@ func (vs *VolumeServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 
 	readOption := &storage.ReadOption{
 		ReadDeleted: r.FormValue("readDeleted") == "true",
+		MetaOnly:    hasVolume && canReadMetaOnly(r),
 	}
 
 	var count int
 	if hasVolume {
 		count, err = vs.store.ReadVolumeNeedle(volumeId, n, readOption)
+		if err == nil && readOption.MetaOnly && (n.IsCompressed() || n.IsChunkedManifest()) {
+			// the content length is of the uncompressed data, or of the chunks
+			readOption.MetaOnly = false
+			count, err = vs.store.ReadVolumeNeedle(volumeId, n, readOption)
+		}
 	} else if hasEcVolume {
 		count, err = vs.store.ReadEcShardNeedle(volumeId, n)
 	}
-	if err != nil && err != storage.ErrorDeleted && r.FormValue("type") != "replicate" && hasVolume {
-		glog.V(4).Infof("read needle: %v", err)
-		// start to fix it from other replicas, if not deleted and hasVolume and is not a replicated request
+	if err == needle.ErrorCRC && r.FormValue("type") != "replicate" && hasVolume {
+		glog.ErrorfCtx(r.Context(), "read needle %s: %v", r.URL.Path, err)
+		// fix it from other replicas, if hasVolume and is not a replicated request
+		if count, err = vs.repairNeedleFromReplicas(volumeId, n); err != nil {
+			glog.ErrorfCtx(r.Context(), "repair needle %s: %v", r.URL.Path, err)
+		}
 	}
 	// glog.V(4).Infoln("read bytes", count, "error", err)
 	if err != nil || count < 0 {
-		glog.V(3).Infof("read %s isNormalVolume %v error: %v", r.URL.Path, hasVolume, err)
+		glog.V(3).InfofCtx(r.Context(), "read %s isNormalVolume %v error: %v", r.URL.Path, hasVolume, err)
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 	if n.Cookie != cookie {
-		glog.V(0).Infof("request %s with cookie:%x expected:%x from %s agent %s", r.URL.Path, cookie, n.Cookie, r.RemoteAddr, r.UserAgent())
+		glog.V(0).InfofCtx(r.Context(), "request %s with cookie:%x expected:%x from %s agent %s", r.URL.Path, cookie, n.Cookie, r.RemoteAddr, r.UserAgent())
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
+	if hasVolume {
+		v := vs.store.GetVolume(volumeId)
+		if v == nil {
+			// the volume is deleted or unmounted after the read
+			glog.V(3).InfofCtx(r.Context(), "read %s: volume %d not found", r.URL.Path, volumeId)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		vs.getCacheConf().setCacheHeaders(w, v.Collection, time.Now())
+		setNeedleHeaders(w, n, v.ChecksumAlgorithm(), time.Now())
+	} else if ecVolume, found := vs.store.FindEcVolume(volumeId); found {
+		vs.getCacheConf().setCacheHeaders(w, ecVolume.Collection, time.Now())
+		setNeedleHeaders(w, n, ecVolume.ChecksumAlgorithm, time.Now())
+	}
 	if n.LastModified != 0 {
 		w.Header().Set("Last-Modified", time.Unix(int64(n.LastModified), 0).UTC().Format(http.TimeFormat))
 		if r.Header.Get("If-Modified-Since") != "" {
@@ -170,6 +200,15 @@ func (vs *VolumeServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 			w.Header().Set(k, v)
 		}
 	}
+	if n.HasMetadata() {
+		metadata, err := n.GetMetadata()
+		if err != nil {
+			glog.V(0).Infoln("decode needle metadata error:", err)
+		}
+		for k, v := range metadata {
+			w.Header().Set(needle.MetadataNamePrefix+k, v)
+		}
+	}
 
 	if vs.tryHandleChunkedFile(n, filename, ext, w, r) {
 		return
@@ -189,6 +228,11 @@ func (vs *VolumeServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	if readOption.MetaOnly {
+		writeResponseHeaders(filename, mtype, int64(n.DataSize), w, r)
+		return
+	}
+
 	if n.IsCompressed() {
 		if _, _, _, shouldResize := shouldResizeImages(ext, r); shouldResize {
 			if n.Data, err = util.DecompressData(n.Data); err != nil {
@@ -219,7 +263,7 @@ func (vs *VolumeServer) tryHandleChunkedFile(n *needle.Needle, fileName string,
 
 	chunkManifest, e := operation.LoadChunkManifest(n.Data, n.IsCompressed())
 	if e != nil {
-		glog.V(0).Infof("load chunked manifest (%s) error: %v", r.URL.Path, e)
+		glog.V(0).InfofCtx(r.Context(), "load chunked manifest (%s) error: %v", r.URL.Path, e)
 		return false
 	}
 	if fileName == "" && chunkManifest.Name != "" {
@@ -277,8 +321,24 @@ func shouldResizeImages(ext string, r *http.Request) (width, height int, mode st
 	return
 }
 
-func writeResponseContent(filename, mimeType string, rs io.ReadSeeker, w http.ResponseWriter, r *http.Request) error {
-	totalSize, e := rs.Seek(0, 2)
+// canReadMetaOnly is whether the response does not need the needle data, i.e., a HEAD request without resizing images
+func canReadMetaOnly(r *http.Request) bool {
+	return r.Method == "HEAD" && r.FormValue("width") == "" && r.FormValue("height") == ""
+}
+
+// setNeedleHeaders sets the checksum of the stored data, and the ttl if the needle expires
+func setNeedleHeaders(w http.ResponseWriter, n *needle.Needle, checksumAlgorithm needle.ChecksumAlgorithm, now time.Time) {
+	checksum := make([]byte, 4)
+	util.Uint32toBytes(checksum, uint32(n.Checksum))
+	setChecksumHeader(w, checksumAlgorithm.String(), checksum)
+	if n.HasTtl() && n.Ttl != nil && n.Ttl.Minutes() > 0 && n.AppendAtNs > 0 {
+		expiresAt := time.Unix(0, int64(n.AppendAtNs)).Add(time.Duration(n.Ttl.Minutes()) * time.Minute)
+		setTtlHeaders(w, n.Ttl.String(), expiresAt, now)
+	}
+}
+
+// writeResponseHeaders sets the headers of the content, and the Content-Length for HEAD requests
+func writeResponseHeaders(filename, mimeType string, totalSize int64, w http.ResponseWriter, r *http.Request) string {
 	if mimeType == "" {
 		if ext := filepath.Ext(filename); ext != "" {
 			mimeType = mime.TypeByExtension(ext)
@@ -293,6 +353,14 @@ func writeResponseContent(filename, mimeType string, rs io.ReadSeeker, w http.Re
 
 	if r.Method == "HEAD" {
 		w.Header().Set("Content-Length", strconv.FormatInt(totalSize, 10))
+	}
+	return mimeType
+}
+
+func writeResponseContent(filename, mimeType string, rs io.ReadSeeker, w http.ResponseWriter, r *http.Request) error {
+	totalSize, e := rs.Seek(0, 2)
+	mimeType = writeResponseHeaders(filename, mimeType, totalSize, w, r)
+	if r.Method == "HEAD" {
 		return nil
 	}
 
@@ -16,6 +16,12 @@ func (vs *VolumeServer) uiStatusHandler(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Server", "SeaweedFS Volume "+util.VERSION)
 	infos := make(map[string]interface{})
 	infos["Up Time"] = time.Now().Sub(startTime).String()
+	indexMemory := vs.store.IndexMemoryStatus()
+	indexMemoryUsage := util.BytesToHumanReadable(indexMemory.Used)
+	if indexMemory.Budget > 0 {
+		indexMemoryUsage += " / " + util.BytesToHumanReadable(indexMemory.Budget)
+	}
+	infos["Index Memory"] = indexMemoryUsage
 	var ds []*volume_server_pb.DiskStatus
 	for _, loc := range vs.store.Locations {
 		if dir, e := filepath.Abs(loc.Directory); e == nil {
@@ -0,0 +1,67 @@
+package weed_server
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/chrislusf/seaweedfs/weed/storage"
+	"github.com/chrislusf/seaweedfs/weed/storage/backend"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// LoadVolumePreallocation reads the [volume.preallocate] section of volume.toml, and the [[volume.preallocate.collections]] overriding it
+func LoadVolumePreallocation(v *util.ViperProxy) (*storage.VolumePreallocation, error) {
+	strategy, err := backend.ParsePreallocateStrategy(v.GetString("volume.preallocate.strategy"))
+	if err != nil {
+		return nil, fmt.Errorf("volume.preallocate.strategy: %v", err)
+	}
+	conf := &storage.VolumePreallocation{
+		Global: storage.CollectionPreallocation{
+			Strategy:   strategy,
+			Size:       int64(v.GetInt("volume.preallocate.size_mb")) * 1024 * 1024,
+			ExtentSize: int64(v.GetInt("volume.preallocate.extent_size_mb")) * 1024 * 1024,
+		},
+		Collections: make(map[string]storage.CollectionPreallocation),
+	}
+
+	items, _ := v.Get("volume.preallocate.collections").([]interface{})
+	for _, item := range items {
+		values, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected volume.preallocate.collections %v", item)
+		}
+		collection, found := values["collection"].(string)
+		if !found {
+			return nil, fmt.Errorf("volume.preallocate.collections %v needs collection", item)
+		}
+		collectionConf := conf.Global
+		if strategy, found := values["strategy"]; found {
+			if collectionConf.Strategy, err = backend.ParsePreallocateStrategy(fmt.Sprint(strategy)); err != nil {
+				return nil, fmt.Errorf("volume.preallocate.collections %v strategy: %v", item, err)
+			}
+		}
+		for key, size := range map[string]*int64{"size_mb": &collectionConf.Size, "extent_size_mb": &collectionConf.ExtentSize} {
+			value, found := values[key]
+			if !found {
+				continue
+			}
+			mb, err := strconv.ParseInt(fmt.Sprint(value), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("volume.preallocate.collections %v %s: %v", item, key, err)
+			}
+			*size = mb * 1024 * 1024
+		}
+		conf.Collections[collection] = collectionConf
+	}
+
+	return conf, nil
+}
+
+func (vs *VolumeServer) loadPreallocation() error {
+	conf, err := LoadVolumePreallocation(util.GetViper())
+	if err != nil {
+		return err
+	}
+	vs.store.SetVolumePreallocation(conf)
+	return nil
+}
@@ -0,0 +1,48 @@
+package weed_server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chrislusf/seaweedfs/weed/storage"
+	"github.com/chrislusf/seaweedfs/weed/storage/backend"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+func TestLoadVolumePreallocation(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("toml")
+	assert.Equal(t, nil, v.ReadConfig(strings.NewReader(`
+[volume.preallocate]
+strategy = "background"
+extent_size_mb = 16
+
+[[volume.preallocate.collections]]
+collection = "archive"
+strategy = "fallocate"
+size_mb = 30000
+extent_size_mb = 64
+
+[[volume.preallocate.collections]]
+collection = "tmp"
+strategy = "sparse"
+`)))
+	conf, err := LoadVolumePreallocation(&util.ViperProxy{Viper: v})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, storage.CollectionPreallocation{Strategy: backend.PreallocateBackground, ExtentSize: 16 << 20}, conf.Global)
+	assert.Equal(t, storage.CollectionPreallocation{Strategy: backend.PreallocateFallocate, Size: 30000 << 20, ExtentSize: 64 << 20}, conf.Collections["archive"])
+	// the collection inherits the extent size
+	assert.Equal(t, storage.CollectionPreallocation{Strategy: backend.PreallocateSparse, ExtentSize: 16 << 20}, conf.Collections["tmp"])
+
+	v = viper.New()
+	v.SetConfigType("toml")
+	assert.Equal(t, nil, v.ReadConfig(strings.NewReader(`
+[volume.preallocate]
+strategy = "eager"
+`)))
+	_, err = LoadVolumePreallocation(&util.ViperProxy{Viper: v})
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,80 @@
+package weed_server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// repairNeedleFromReplicas reads a needle, which failed the CRC check locally, from the other replicas.
+// The first good copy fills in the needle, and is also appended to the local volume to replace the corrupted one.
+func (vs *VolumeServer) repairNeedleFromReplicas(volumeId needle.VolumeId, n *needle.Needle) (int, error) {
+	v := vs.store.GetVolume(volumeId)
+	if v == nil {
+		return 0, fmt.Errorf("volume %d not found", volumeId)
+	}
+	if v.ReplicaPlacement.GetCopyCount() == 1 {
+		return 0, fmt.Errorf("volume %d has no replicas", volumeId)
+	}
+
+	lookupResult, err := operation.Lookup(vs.GetMaster, volumeId.String())
+	if err != nil {
+		return 0, fmt.Errorf("lookup volume %d: %v", volumeId, err)
+	}
+
+	selfUrl := util.JoinHostPort(vs.store.Ip, vs.store.Port)
+	var lastErr = fmt.Errorf("volume %d has no other replicas", volumeId)
+	for _, location := range lookupResult.Locations {
+		if location.Url == selfUrl {
+			continue
+		}
+
+		var blob []byte
+		var size types.Size
+		err = operation.WithVolumeServerClient(location.Url, vs.grpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
+			resp, readErr := client.ReadNeedleBlob(context.Background(), &volume_server_pb.ReadNeedleBlobRequest{
+				VolumeId: uint32(volumeId),
+				NeedleId: uint64(n.Id),
+			})
+			if readErr != nil {
+				return readErr
+			}
+			blob, size = resp.NeedleBlob, types.Size(resp.Size)
+			return nil
+		})
+		if err != nil {
+			lastErr = fmt.Errorf("read needle %d from %s: %v", n.Id, location.Url, err)
+			continue
+		}
+
+		// the replica copy must also pass the CRC check
+		repaired := &needle.Needle{}
+		if err = repaired.ReadBytes(blob, 0, size, v.Version(), v.ChecksumAlgorithm()); err != nil {
+			lastErr = fmt.Errorf("parse needle %d from %s: %v", n.Id, location.Url, err)
+			continue
+		}
+		if repaired.Id != n.Id {
+			lastErr = fmt.Errorf("needle %d from %s has id %d", n.Id, location.Url, repaired.Id)
+			continue
+		}
+
+		if v.IsReadOnly() {
+			glog.Warningf("read needle %d of read only volume %d from %s, the corrupted local copy is not replaced", n.Id, volumeId, location.Url)
+		} else if err = v.WriteNeedleBlob(n.Id, blob, size); err != nil {
+			glog.Errorf("replace corrupted needle %d of volume %d: %v", n.Id, volumeId, err)
+		} else {
+			glog.V(0).Infof("repaired corrupted needle %d of volume %d from %s", n.Id, volumeId, location.Url)
+		}
+
+		*n = *repaired
+		return len(n.Data), nil
+	}
+
+	return 0, lastErr
+}
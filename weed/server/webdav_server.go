@@ -40,6 +40,7 @@ type WebDavOption struct {
 	Cipher           bool
 	CacheDir         string
 	CacheSizeMB      int64
+	CacheService     string // the unix socket of a shared chunk cache
 }
 
 type WebDavServer struct {
@@ -73,7 +74,7 @@ type WebDavFileSystem struct {
 	secret         security.SigningKey
 	filer          *filer.Filer
 	grpcDialOption grpc.DialOption
-	chunkCache     *chunk_cache.TieredChunkCache
+	chunkCache     chunk_cache.ChunkCache
 	signature      int32
 }
 
@@ -111,7 +112,12 @@ func NewWebDavFileSystem(option *WebDavOption) (webdav.FileSystem, error) {
 	cacheDir := path.Join(option.CacheDir, cacheUniqueId)
 
 	os.MkdirAll(cacheDir, os.FileMode(0755))
-	chunkCache := chunk_cache.NewTieredChunkCache(256, cacheDir, option.CacheSizeMB, 1024*1024)
+	var chunkCache chunk_cache.ChunkCache
+	if option.CacheService != "" {
+		chunkCache = chunk_cache.NewRemoteChunkCache(option.CacheService)
+	} else {
+		chunkCache = chunk_cache.NewTieredChunkCache(256, cacheDir, option.CacheSizeMB, 1024*1024)
+	}
 	return &WebDavFileSystem{
 		option:     option,
 		chunkCache: chunkCache,
@@ -0,0 +1,545 @@
+package shell
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+	"github.com/chrislusf/seaweedfs/weed/topology"
+)
+
+func init() {
+	Commands = append(Commands, &commandClusterCheck{})
+}
+
+type commandClusterCheck struct {
+}
+
+func (c *commandClusterCheck) Name() string {
+	return "cluster.check"
+}
+
+func (c *commandClusterCheck) Help() string {
+	return `check the connectivity, the clocks, the versions, the replication and the free space of the cluster
+
+	cluster.check [-maxClockSkew=1s] [-minFreePercent=10] [-timeout=5s]
+
+	This is a read only check, e.g., before upgrading or changing the cluster.
+	It prints a warning with the suggested action for each problem found in:
+	  * the grpc connectivity from this shell to the masters, the volume servers and the filers,
+	    from the masters to the volume servers, from the volume servers to the masters and the other volume servers,
+	    and from the filers to the masters and the volume servers
+	  * whether the masters agree on the leader
+	  * the clock skew between the servers
+	  * the versions of the servers
+	  * whether the new volumes of the default replication and of the replications in use fit the free volume slots
+	  * the free volume slots, and the free disk space of the volume servers
+
+`
+}
+
+func (c *commandClusterCheck) Do(args []string, commandEnv *CommandEnv, writer io.Writer) (err error) {
+
+	checkCommand := flag.NewFlagSet(c.Name(), flag.ContinueOnError)
+	maxClockSkew := checkCommand.Duration("maxClockSkew", time.Second, "warn if the clock of a server is off by more than this")
+	minFreePercent := checkCommand.Float64("minFreePercent", 10, "warn if the free volume slots or the free disk space is less than this percentage")
+	timeout := checkCommand.Duration("timeout", 5*time.Second, "timeout of each grpc call")
+	if err = checkCommand.Parse(args); err != nil {
+		return nil
+	}
+
+	topologyInfo, volumeSizeLimitMb, err := collectTopologyInfo(commandEnv)
+	if err != nil {
+		return err
+	}
+	var masterConfiguration *master_pb.GetMasterConfigurationResponse
+	var filers []string
+	err = commandEnv.MasterClient.WithClient(func(client master_pb.SeaweedClient) error {
+		if masterConfiguration, err = client.GetMasterConfiguration(context.Background(), &master_pb.GetMasterConfigurationRequest{}); err != nil {
+			return err
+		}
+		resp, err := client.ListMasterClients(context.Background(), &master_pb.ListMasterClientsRequest{ClientType: "filer"})
+		if err != nil {
+			return err
+		}
+		// the filers connect to the masters with their http addresses
+		filers = resp.GrpcAddresses
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	check := &clusterCheck{
+		commandEnv: commandEnv,
+		writer:     writer,
+		timeout:    *timeout,
+	}
+	for _, master := range strings.Split(*commandEnv.option.Masters, ",") {
+		check.servers = append(check.servers, &clusterCheckServer{address: master, serverType: pb.MasterType})
+	}
+	eachDataNode(topologyInfo, func(dc string, rack RackId, dn *master_pb.DataNodeInfo) {
+		check.servers = append(check.servers, &clusterCheckServer{address: dn.Id, serverType: pb.VolumeServerType})
+	})
+	for _, filer := range filers {
+		check.servers = append(check.servers, &clusterCheckServer{address: filer, serverType: pb.FilerType})
+	}
+	sort.SliceStable(check.servers, func(i, j int) bool {
+		return check.servers[i].serverType < check.servers[j].serverType
+	})
+
+	check.checkConnectivity()
+	check.checkLeader()
+	check.report("clock skew", findClockSkews(check.servers, *maxClockSkew))
+	check.report("versions", findVersionSkews(check.servers))
+	check.report("replication", findUnplaceableReplications(topologyInfo, masterConfiguration.DefaultReplication))
+	check.report("free volume slots", findLowFreeVolumeSlots(topologyInfo, *minFreePercent))
+	check.report("free disk space", check.findLowFreeDiskSpace(*minFreePercent, volumeSizeLimitMb*1024*1024))
+
+	fmt.Fprintf(writer, "checked %d masters, %d volume servers and %d filers: %d warnings\n",
+		len(check.serversOf(pb.MasterType)), len(check.serversOf(pb.VolumeServerType)), len(check.serversOf(pb.FilerType)), check.warningCount)
+	return nil
+}
+
+type clusterCheckServer struct {
+	address    string
+	serverType string
+	// from the ping by this shell
+	reachable   bool
+	version     string
+	clockOffset time.Duration // the clock of the server minus the clock of this shell
+	roundTrip   time.Duration
+}
+
+func (s *clusterCheckServer) String() string {
+	return s.serverType + " " + s.address
+}
+
+type clusterCheck struct {
+	commandEnv   *CommandEnv
+	writer       io.Writer
+	timeout      time.Duration
+	servers      []*clusterCheckServer
+	warningCount int
+}
+
+type clusterPingResult struct {
+	remoteTimeNs int64 // the clock of the pinged server
+	version      string
+}
+
+// ping asks the server to ping the target, or to reply by itself without a target
+func (c *clusterCheck) ping(server *clusterCheckServer, target *clusterCheckServer) (result clusterPingResult, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	var targetAddress, targetType string
+	if target != nil {
+		targetAddress, targetType = target.address, target.serverType
+	}
+	grpcDialOption := c.commandEnv.option.GrpcDialOption
+	switch server.serverType {
+	case pb.MasterType:
+		err = operation.WithMasterServerClient(server.address, grpcDialOption, func(client master_pb.SeaweedClient) error {
+			resp, pingErr := client.Ping(ctx, &master_pb.PingRequest{Target: targetAddress, TargetType: targetType})
+			if pingErr == nil {
+				result = clusterPingResult{resp.RemoteTimeNs, resp.Version}
+			}
+			return pingErr
+		})
+	case pb.VolumeServerType:
+		err = operation.WithVolumeServerClient(server.address, grpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
+			resp, pingErr := client.Ping(ctx, &volume_server_pb.PingRequest{Target: targetAddress, TargetType: targetType})
+			if pingErr == nil {
+				result = clusterPingResult{resp.RemoteTimeNs, resp.Version}
+			}
+			return pingErr
+		})
+	case pb.FilerType:
+		err = operation.WithFilerServerClient(server.address, grpcDialOption, func(client filer_pb.SeaweedFilerClient) error {
+			resp, pingErr := client.Ping(ctx, &filer_pb.PingRequest{Target: targetAddress, TargetType: targetType})
+			if pingErr == nil {
+				result = clusterPingResult{resp.RemoteTimeNs, resp.Version}
+			}
+			return pingErr
+		})
+	}
+	return
+}
+
+// checkConnectivity pings all the servers from this shell, and then the servers needed by each reachable server from it
+func (c *clusterCheck) checkConnectivity() {
+	var warnings []string
+	var warningsLock sync.Mutex
+	addWarning := func(format string, a ...interface{}) {
+		warningsLock.Lock()
+		defer warningsLock.Unlock()
+		warnings = append(warnings, fmt.Sprintf(format, a...))
+	}
+
+	c.forEach(c.servers, func(server *clusterCheckServer) {
+		start := time.Now()
+		result, err := c.ping(server, nil)
+		if err != nil {
+			addWarning("can not reach %s from this shell: %v, check the server is running and its grpc port is open to this host", server, err)
+			return
+		}
+		server.reachable = true
+		server.version = result.version
+		server.roundTrip = time.Since(start)
+		server.clockOffset = time.Duration(result.remoteTimeNs - (start.UnixNano() + server.roundTrip.Nanoseconds()/2))
+	})
+
+	type pair struct {
+		from, to *clusterCheckServer
+	}
+	var pairs []pair
+	for _, from := range c.servers {
+		if !from.reachable {
+			continue
+		}
+		for _, to := range c.serversNeededBy(from) {
+			if to != from {
+				pairs = append(pairs, pair{from, to})
+			}
+		}
+	}
+	c.forEachIndex(len(pairs), func(i int) {
+		if _, err := c.ping(pairs[i].from, pairs[i].to); err != nil {
+			addWarning("can not reach %s from %s: %v, check the grpc port of %s is open to %s", pairs[i].to, pairs[i].from, err, pairs[i].to.address, pairs[i].from.address)
+		}
+	})
+
+	sort.Strings(warnings)
+	c.report("connectivity", warnings)
+}
+
+// serversNeededBy are the servers called by the server with grpc
+func (c *clusterCheck) serversNeededBy(server *clusterCheckServer) (servers []*clusterCheckServer) {
+	switch server.serverType {
+	case pb.MasterType:
+		// allocating, vacuuming and deleting the volumes
+		servers = c.serversOf(pb.VolumeServerType)
+	case pb.VolumeServerType:
+		// heartbeats, and copying the volumes and the ec shards
+		servers = append(c.serversOf(pb.MasterType), c.serversOf(pb.VolumeServerType)...)
+	case pb.FilerType:
+		// looking up and deleting the file chunks
+		servers = append(c.serversOf(pb.MasterType), c.serversOf(pb.VolumeServerType)...)
+	}
+	return
+}
+
+func (c *clusterCheck) serversOf(serverType string) (servers []*clusterCheckServer) {
+	for _, server := range c.servers {
+		if server.serverType == serverType {
+			servers = append(servers, server)
+		}
+	}
+	return
+}
+
+func (c *clusterCheck) forEach(servers []*clusterCheckServer, fn func(server *clusterCheckServer)) {
+	c.forEachIndex(len(servers), func(i int) {
+		fn(servers[i])
+	})
+}
+
+// forEachIndex runs fn for 0 to n-1 concurrently, with at most 16 calls at a time
+func (c *clusterCheck) forEachIndex(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	limiter := make(chan struct{}, 16)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		limiter <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-limiter }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// checkLeader compares the leaders seen by the reachable masters
+func (c *clusterCheck) checkLeader() {
+	leaders := make(map[string][]string)
+	for _, master := range c.serversOf(pb.MasterType) {
+		if !master.reachable {
+			continue
+		}
+		err := operation.WithMasterServerClient(master.address, c.commandEnv.option.GrpcDialOption, func(client master_pb.SeaweedClient) error {
+			ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+			defer cancel()
+			resp, err := client.GetMasterConfiguration(ctx, &master_pb.GetMasterConfigurationRequest{})
+			if err != nil {
+				return err
+			}
+			leaders[resp.Leader] = append(leaders[resp.Leader], master.address)
+			return nil
+		})
+		if err != nil {
+			leaders[""] = append(leaders[""], master.address)
+		}
+	}
+	var warnings []string
+	if _, found := leaders[""]; found {
+		warnings = append(warnings, fmt.Sprintf("masters %s have no leader, check the masters started with the same -peers can reach each other", strings.Join(leaders[""], ",")))
+		delete(leaders, "")
+	}
+	if len(leaders) > 1 {
+		var views []string
+		for leader, masters := range leaders {
+			views = append(views, fmt.Sprintf("%s by %s", leader, strings.Join(masters, ",")))
+		}
+		sort.Strings(views)
+		warnings = append(warnings, fmt.Sprintf("masters disagree on the leader: %s, check the -peers of the masters are the same", strings.Join(views, "; ")))
+	}
+	c.report("master leader", warnings)
+}
+
+// findLowFreeDiskSpace checks the disks of the reachable volume servers
+func (c *clusterCheck) findLowFreeDiskSpace(minFreePercent float64, volumeSizeLimit uint64) (warnings []string) {
+	var warningsLock sync.Mutex
+	c.forEach(c.serversOf(pb.VolumeServerType), func(server *clusterCheckServer) {
+		if !server.reachable {
+			return
+		}
+		err := operation.WithVolumeServerClient(server.address, c.commandEnv.option.GrpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
+			ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+			defer cancel()
+			resp, err := client.VolumeServerStatus(ctx, &volume_server_pb.VolumeServerStatusRequest{})
+			if err != nil {
+				return err
+			}
+			warningsLock.Lock()
+			defer warningsLock.Unlock()
+			warnings = append(warnings, lowFreeDiskSpaceWarnings(server.address, resp.DiskStatuses, minFreePercent, volumeSizeLimit)...)
+			return nil
+		})
+		if err != nil {
+			warningsLock.Lock()
+			warnings = append(warnings, fmt.Sprintf("can not read the disk status of %s: %v", server, err))
+			warningsLock.Unlock()
+		}
+	})
+	sort.Strings(warnings)
+	return
+}
+
+func (c *clusterCheck) report(name string, warnings []string) {
+	if len(warnings) == 0 {
+		fmt.Fprintf(c.writer, "%s: ok\n", name)
+		return
+	}
+	fmt.Fprintf(c.writer, "%s: %d warnings\n", name, len(warnings))
+	for _, warning := range warnings {
+		fmt.Fprintf(c.writer, "  warning: %s\n", warning)
+	}
+	c.warningCount += len(warnings)
+}
+
+// findClockSkews compares the clock of each reachable server with the median of all the servers,
+// discounting the uncertainty of half of the round trip of the ping
+func findClockSkews(servers []*clusterCheckServer, maxClockSkew time.Duration) (warnings []string) {
+	var offsets []time.Duration
+	for _, server := range servers {
+		if server.reachable {
+			offsets = append(offsets, server.clockOffset)
+		}
+	}
+	if len(offsets) < 2 {
+		return
+	}
+	sort.Slice(offsets, func(i, j int) bool {
+		return offsets[i] < offsets[j]
+	})
+	median := offsets[len(offsets)/2]
+	for _, server := range servers {
+		if !server.reachable {
+			continue
+		}
+		skew := server.clockOffset - median
+		direction := "ahead of"
+		if skew < 0 {
+			skew, direction = -skew, "behind"
+		}
+		if skew-server.roundTrip/2 > maxClockSkew {
+			warnings = append(warnings, fmt.Sprintf("the clock of %s is %v %s the other servers, sync the clocks with ntp", server, skew.Round(time.Millisecond), direction))
+		}
+	}
+	return
+}
+
+// findVersionSkews reports the servers not on the version run by most servers
+func findVersionSkews(servers []*clusterCheckServer) (warnings []string) {
+	serversByVersion := make(map[string][]string)
+	var versions []string
+	for _, server := range servers {
+		if !server.reachable {
+			continue
+		}
+		if _, found := serversByVersion[server.version]; !found {
+			versions = append(versions, server.version)
+		}
+		serversByVersion[server.version] = append(serversByVersion[server.version], server.String())
+	}
+	if len(versions) < 2 {
+		return
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return len(serversByVersion[versions[i]]) > len(serversByVersion[versions[j]])
+	})
+	for _, version := range versions[1:] {
+		warnings = append(warnings, fmt.Sprintf("%s run version %s, while %d servers run version %s, upgrade the servers to the same version",
+			strings.Join(serversByVersion[version], ", "), version, len(serversByVersion[versions[0]]), versions[0]))
+	}
+	return
+}
+
+// findUnplaceableReplications checks the default replication and the replications of the existing volumes,
+// for each disk type, can place the replicas of a new volume on the free volume slots of the active volume servers
+func findUnplaceableReplications(topologyInfo *master_pb.TopologyInfo, defaultReplication string) (warnings []string) {
+	type placement struct {
+		replication string
+		diskType    types.DiskType
+	}
+	placements := make(map[placement]string)
+	if defaultReplication != "" {
+		placements[placement{defaultReplication, types.HardDriveType}] = "the default replication"
+	}
+	eachDataNode(topologyInfo, func(dc string, rack RackId, dn *master_pb.DataNodeInfo) {
+		for diskType, diskInfo := range dn.DiskInfos {
+			for _, v := range diskInfo.VolumeInfos {
+				rp, err := super_block.NewReplicaPlacementFromByte(byte(v.ReplicaPlacement))
+				if err != nil {
+					continue
+				}
+				p := placement{rp.String(), types.ToDiskType(diskType)}
+				if _, found := placements[p]; !found {
+					placements[p] = fmt.Sprintf("volume %d of collection %q", v.Id, v.Collection)
+				}
+			}
+		}
+	})
+
+	for p, source := range placements {
+		rp, err := super_block.NewReplicaPlacementFromString(p.replication)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("invalid replication %q of %s", p.replication, source))
+			continue
+		}
+		if err = checkReplicaPlacement(topologyInfo, rp, p.diskType); err != nil {
+			warnings = append(warnings, fmt.Sprintf("new %s volumes of replication %s, as %s, can not be created: %v, add volume servers or free volume slots",
+				p.diskType.ReadableString(), p.replication, source, err))
+		}
+	}
+	sort.Strings(warnings)
+	return
+}
+
+// checkReplicaPlacement tells why the replicas of a new volume can not be placed, like when growing the volumes:
+// one data center with the racks for the replicas in other racks, one of them with the servers for the replicas on the same rack,
+// and the other data centers for the replicas in other data centers
+func checkReplicaPlacement(topologyInfo *master_pb.TopologyInfo, rp *super_block.ReplicaPlacement, diskType types.DiskType) error {
+	var dataCentersWithFreeSlots int
+	var hasMainDataCenter bool
+	for _, dc := range topologyInfo.DataCenterInfos {
+		var racksWithFreeSlots int
+		var hasMainRack bool
+		for _, rack := range dc.RackInfos {
+			var nodesWithFreeSlots int
+			for _, dn := range rack.DataNodeInfos {
+				if dn.State != "" && dn.State != topology.NodeStateActive {
+					continue
+				}
+				if freeVolumeSlots(dn.DiskInfos[string(diskType)]) > 0 {
+					nodesWithFreeSlots++
+				}
+			}
+			if nodesWithFreeSlots > 0 {
+				racksWithFreeSlots++
+			}
+			if nodesWithFreeSlots >= rp.SameRackCount+1 {
+				hasMainRack = true
+			}
+		}
+		if racksWithFreeSlots > 0 {
+			dataCentersWithFreeSlots++
+		}
+		if hasMainRack && racksWithFreeSlots >= rp.DiffRackCount+1 {
+			hasMainDataCenter = true
+		}
+	}
+	if !hasMainDataCenter {
+		return fmt.Errorf("no data center has %d racks with free volume slots, one of them with %d volume servers with free volume slots",
+			rp.DiffRackCount+1, rp.SameRackCount+1)
+	}
+	if dataCentersWithFreeSlots < rp.DiffDataCenterCount+1 {
+		return fmt.Errorf("only %d data centers have free volume slots, less than %d", dataCentersWithFreeSlots, rp.DiffDataCenterCount+1)
+	}
+	return nil
+}
+
+func freeVolumeSlots(diskInfo *master_pb.DiskInfo) int64 {
+	if diskInfo == nil {
+		return 0
+	}
+	return int64(diskInfo.MaxVolumeCount) - int64(diskInfo.VolumeCount)
+}
+
+// findLowFreeVolumeSlots reports the disk types low in the free volume slots, and the volume servers without free volume slots
+func findLowFreeVolumeSlots(topologyInfo *master_pb.TopologyInfo, minFreePercent float64) (warnings []string) {
+	maxSlots, freeSlots := make(map[string]int64), make(map[string]int64)
+	eachDataNode(topologyInfo, func(dc string, rack RackId, dn *master_pb.DataNodeInfo) {
+		if dn.State != "" && dn.State != topology.NodeStateActive {
+			warnings = append(warnings, fmt.Sprintf("volume server %s is %s, check its heartbeats to the master", dn.Id, dn.State))
+		}
+		for diskType, diskInfo := range dn.DiskInfos {
+			if diskInfo.MaxVolumeCount == 0 {
+				continue
+			}
+			free := freeVolumeSlots(diskInfo)
+			maxSlots[diskType] += int64(diskInfo.MaxVolumeCount)
+			if free <= 0 {
+				warnings = append(warnings, fmt.Sprintf("volume server %s has no free %s volume slots, move volumes off with volume.balance or volume.move",
+					dn.Id, types.ToDiskType(diskType).ReadableString()))
+				continue
+			}
+			freeSlots[diskType] += free
+		}
+	})
+	for diskType, max := range maxSlots {
+		if float64(freeSlots[diskType])*100 < float64(max)*minFreePercent {
+			warnings = append(warnings, fmt.Sprintf("only %d of %d %s volume slots are free, add volume servers, raise -volume.max, or delete or ec encode the old volumes",
+				freeSlots[diskType], max, types.ToDiskType(diskType).ReadableString()))
+		}
+	}
+	sort.Strings(warnings)
+	return
+}
+
+func lowFreeDiskSpaceWarnings(address string, diskStatuses []*volume_server_pb.DiskStatus, minFreePercent float64, volumeSizeLimit uint64) (warnings []string) {
+	for _, disk := range diskStatuses {
+		switch {
+		case disk.Free < volumeSizeLimit:
+			warnings = append(warnings, fmt.Sprintf("%s on volume server %s has %d MB free, less than the volume size limit of %d MB, free the disk space or move volumes off with volume.move",
+				disk.Dir, address, disk.Free/1024/1024, volumeSizeLimit/1024/1024))
+		case float64(disk.PercentFree) < minFreePercent:
+			warnings = append(warnings, fmt.Sprintf("%s on volume server %s has %.1f%% free, free the disk space or move volumes off with volume.move",
+				disk.Dir, address, disk.PercentFree))
+		}
+	}
+	return
+}
@@ -0,0 +1,120 @@
+package shell
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+)
+
+// newCheckTopology has the data centers of the racks of the volume servers, by their free hdd volume slots
+func newCheckTopology(dataCenters map[string]map[string][]int) *master_pb.TopologyInfo {
+	topologyInfo := &master_pb.TopologyInfo{}
+	for dcId, racks := range dataCenters {
+		dc := &master_pb.DataCenterInfo{Id: dcId}
+		for rackId, nodes := range racks {
+			rack := &master_pb.RackInfo{Id: rackId}
+			for i, free := range nodes {
+				rack.DataNodeInfos = append(rack.DataNodeInfos, &master_pb.DataNodeInfo{
+					Id: dcId + rackId + string(rune('a'+i)),
+					DiskInfos: map[string]*master_pb.DiskInfo{
+						"": {MaxVolumeCount: 10, VolumeCount: uint64(10 - free)},
+					},
+				})
+			}
+			dc.RackInfos = append(dc.RackInfos, rack)
+		}
+		topologyInfo.DataCenterInfos = append(topologyInfo.DataCenterInfos, dc)
+	}
+	return topologyInfo
+}
+
+func TestCheckReplicaPlacement(t *testing.T) {
+	topologyInfo := newCheckTopology(map[string]map[string][]int{
+		"dc1": {"rack1": {1, 1, 0}, "rack2": {2}},
+		"dc2": {"rack1": {0}},
+	})
+	for replication, feasible := range map[string]bool{
+		"000": true,
+		"001": true,
+		"002": false, // only two servers with free slots on the same rack
+		"010": true,
+		"011": true,
+		"020": false,
+		"100": false, // no free slots in dc2
+	} {
+		rp, _ := super_block.NewReplicaPlacementFromString(replication)
+		if err := checkReplicaPlacement(topologyInfo, rp, types.HardDriveType); (err == nil) != feasible {
+			t.Errorf("replication %s: %v", replication, err)
+		}
+	}
+
+	// the ssd disks are not used for the hdd volumes
+	rp, _ := super_block.NewReplicaPlacementFromString("000")
+	if err := checkReplicaPlacement(topologyInfo, rp, types.SsdType); err == nil {
+		t.Errorf("placed on ssd without ssd disks")
+	}
+
+	warnings := findUnplaceableReplications(topologyInfo, "100")
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "the default replication") {
+		t.Errorf("warnings %v", warnings)
+	}
+}
+
+func TestFindLowFreeVolumeSlots(t *testing.T) {
+	topologyInfo := newCheckTopology(map[string]map[string][]int{
+		"dc1": {"rack1": {1, 0}},
+	})
+	warnings := findLowFreeVolumeSlots(topologyInfo, 10)
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "only 1 of 20 hdd volume slots are free") || !strings.Contains(warnings[1], "has no free hdd volume slots") {
+		t.Errorf("warnings %v", warnings)
+	}
+	if warnings = findLowFreeVolumeSlots(topologyInfo, 5); len(warnings) != 1 {
+		t.Errorf("warnings %v", warnings)
+	}
+}
+
+func TestFindClockAndVersionSkews(t *testing.T) {
+	servers := []*clusterCheckServer{
+		{address: "m1:9333", serverType: pb.MasterType, reachable: true, version: "2.60", clockOffset: 10 * time.Millisecond},
+		{address: "v1:8080", serverType: pb.VolumeServerType, reachable: true, version: "2.60", clockOffset: -20 * time.Millisecond},
+		{address: "v2:8080", serverType: pb.VolumeServerType, reachable: true, version: "2.59", clockOffset: 3 * time.Second, roundTrip: time.Second},
+		{address: "v3:8080", serverType: pb.VolumeServerType, reachable: true, version: "2.60", clockOffset: -5 * time.Second},
+		{address: "f1:8888", serverType: pb.FilerType, version: "2.58", clockOffset: time.Hour},
+	}
+
+	warnings := findClockSkews(servers, time.Second)
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "volumeServer v2:8080 is 2.99s ahead of") || !strings.Contains(warnings[1], "volumeServer v3:8080 is 5.01s behind") {
+		t.Errorf("clock warnings %v", warnings)
+	}
+	// the round trip of the ping is discounted
+	if warnings = findClockSkews(servers, 2600*time.Millisecond); len(warnings) != 1 {
+		t.Errorf("clock warnings %v", warnings)
+	}
+
+	warnings = findVersionSkews(servers)
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "volumeServer v2:8080 run version 2.59, while 3 servers run version 2.60") {
+		t.Errorf("version warnings %v", warnings)
+	}
+}
+
+func TestLowFreeDiskSpaceWarnings(t *testing.T) {
+	warnings := lowFreeDiskSpaceWarnings("v1:8080", []*volume_server_pb.DiskStatus{
+		{Dir: "/data1", Free: 100 << 30, PercentFree: 50},
+		{Dir: "/data2", Free: 20 << 30, PercentFree: 5},
+		{Dir: "/data3", Free: 10 << 20, PercentFree: 1},
+	}, 10, 30<<30)
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "/data2 on volume server v1:8080 has 20480 MB free, less than the volume size limit") ||
+		!strings.Contains(warnings[1], "/data3") {
+		t.Errorf("warnings %v", warnings)
+	}
+	warnings = lowFreeDiskSpaceWarnings("v1:8080", []*volume_server_pb.DiskStatus{{Dir: "/data", Free: 100 << 30, PercentFree: 5}}, 10, 30<<30)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "has 5.0% free") {
+		t.Errorf("warnings %v", warnings)
+	}
+}
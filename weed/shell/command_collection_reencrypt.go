@@ -0,0 +1,380 @@
+package shell
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/chrislusf/seaweedfs/weed/filer"
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// reencryptUpdateRetries is the number of retries to replace the chunks of a file changed meanwhile
+const reencryptUpdateRetries = 3
+
+func init() {
+	Commands = append(Commands, &commandCollectionReencrypt{})
+}
+
+type commandCollectionReencrypt struct {
+	env    *CommandEnv
+	writer io.Writer
+
+	collection string
+	volumeIds  map[uint32]bool
+	apply      bool
+	writerLock sync.Mutex
+	fileCount  int64
+	chunkCount int64
+	byteCount  int64
+	retryCount int64
+	errorCount int64
+}
+
+func (c *commandCollectionReencrypt) Name() string {
+	return "collection.reencrypt"
+}
+
+func (c *commandCollectionReencrypt) Help() string {
+	return `re-encrypt the encrypted files of a collection with new cipher keys
+
+	collection.reencrypt -collection <collection_name> [-path /] [-apply]
+
+	Files are encrypted when the filer runs with -encryptVolumeData. Each chunk has its own cipher key,
+	which is kept in the filer meta data. To rotate the keys, for every encrypted chunk in the collection:
+	1. a volume server holding the chunk decrypts it with the old key, and uploads it
+	   to a newly assigned file id, encrypted with a new key.
+	2. the file meta data is updated to use the new chunk, and the filer deletes the old chunk.
+
+	The files can be read and written during the re-encryption. The file meta data is only updated
+	if its chunks are not changed meanwhile, or else the chunks are replaced again in the latest version.
+	The chunk manifests of large files are resolved, and the filer writes new manifests of the new chunks.
+
+	Without -apply, only the chunks to re-encrypt are counted.
+	The progress is printed every 1000 files.
+
+`
+}
+
+func (c *commandCollectionReencrypt) Do(args []string, commandEnv *CommandEnv, writer io.Writer) (err error) {
+
+	if err = commandEnv.confirmIsLocked(); err != nil {
+		return
+	}
+
+	reencryptCommand := flag.NewFlagSet(c.Name(), flag.ContinueOnError)
+	collectionName := reencryptCommand.String("collection", "", "collection to re-encrypt. Use '_default_' for the empty-named collection.")
+	filerPath := reencryptCommand.String("path", "/", "only re-encrypt files under this filer directory")
+	applyReencrypt := reencryptCommand.Bool("apply", false, "re-encrypt the files")
+	if err = reencryptCommand.Parse(args); err != nil {
+		return nil
+	}
+
+	if *collectionName == "" {
+		return fmt.Errorf("empty collection name is not allowed")
+	}
+	if *collectionName == "_default_" {
+		*collectionName = ""
+	}
+
+	topologyInfo, _, err := collectTopologyInfo(commandEnv)
+	if err != nil {
+		return err
+	}
+
+	c.env = commandEnv
+	c.writer = writer
+	c.collection = *collectionName
+	c.apply = *applyReencrypt
+	c.volumeIds = collectCollectionVolumeIds(topologyInfo, c.collection)
+	c.fileCount, c.chunkCount, c.byteCount, c.retryCount, c.errorCount = 0, 0, 0, 0, 0
+
+	if len(c.volumeIds) == 0 {
+		return fmt.Errorf("collection '%s' has no volumes", c.collection)
+	}
+
+	err = filer_pb.TraverseBfs(commandEnv, util.FullPath(*filerPath), func(parentPath util.FullPath, entry *filer_pb.Entry) {
+		if entry.IsDirectory {
+			return
+		}
+		c.reencryptEntry(parentPath, entry)
+	})
+	if err != nil {
+		return fmt.Errorf("traverse %s: %v", *filerPath, err)
+	}
+
+	verb := "re-encrypted"
+	if !c.apply {
+		verb = "to re-encrypt"
+	}
+	fmt.Fprintf(writer, "%s %d chunks, %d bytes, in %d files. %d updates retried for the files changed meanwhile, %d errors.\n",
+		verb, c.chunkCount, c.byteCount, c.fileCount, c.retryCount, c.errorCount)
+	if !c.apply {
+		fmt.Fprintf(writer, "Use -apply to re-encrypt the files.\n")
+	}
+	if c.errorCount > 0 {
+		return fmt.Errorf("failed to re-encrypt %d chunks", c.errorCount)
+	}
+
+	return nil
+}
+
+func (c *commandCollectionReencrypt) reencryptEntry(parentPath util.FullPath, entry *filer_pb.Entry) {
+
+	fullPath := parentPath.Child(entry.Name)
+	dataChunks, err := c.resolveDataChunks(entry.Chunks)
+	if err != nil {
+		c.printError("resolve %s chunk manifests: %v\n", fullPath, err)
+		return
+	}
+
+	var toReencrypt []*filer_pb.FileChunk
+	for _, chunk := range dataChunks {
+		if len(chunk.CipherKey) == 0 {
+			continue
+		}
+		fileId, err := needle.ParseFileIdFromString(chunk.GetFileIdString())
+		if err != nil || !c.volumeIds[uint32(fileId.VolumeId)] {
+			continue
+		}
+		toReencrypt = append(toReencrypt, chunk)
+	}
+	if len(toReencrypt) == 0 {
+		return
+	}
+
+	if !c.apply {
+		c.addProgress(toReencrypt)
+		return
+	}
+
+	newChunks := make(map[string]*filer_pb.FileChunk)
+	for _, chunk := range toReencrypt {
+		newChunk, err := c.reencryptChunk(entry, chunk)
+		if err != nil {
+			c.printError("re-encrypt %s chunk %s: %v\n", fullPath, chunk.GetFileIdString(), err)
+			continue
+		}
+		newChunks[chunk.GetFileIdString()] = newChunk
+	}
+
+	if err := c.updateEntryChunks(parentPath, entry.Name, newChunks); err != nil {
+		c.printError("update %s: %v\n", fullPath, err)
+		for _, newChunk := range newChunks {
+			if newChunk != nil {
+				c.deleteFileIds([]string{newChunk.GetFileIdString()})
+			}
+		}
+		return
+	}
+
+	var reencrypted []*filer_pb.FileChunk
+	for _, chunk := range toReencrypt {
+		// the new chunk is nil if the chunk was changed meanwhile
+		if newChunk, found := newChunks[chunk.GetFileIdString()]; found && newChunk != nil {
+			reencrypted = append(reencrypted, chunk)
+		}
+	}
+	c.addProgress(reencrypted)
+}
+
+// reencryptChunk lets a volume server holding the chunk copy it to a new file id with a new cipher key
+func (c *commandCollectionReencrypt) reencryptChunk(entry *filer_pb.Entry, chunk *filer_pb.FileChunk) (*filer_pb.FileChunk, error) {
+
+	fileId, err := needle.ParseFileIdFromString(chunk.GetFileIdString())
+	if err != nil {
+		return nil, err
+	}
+	locations, found := c.env.MasterClient.GetLocations(uint32(fileId.VolumeId))
+	if !found {
+		return nil, fmt.Errorf("volume %d not found", fileId.VolumeId)
+	}
+
+	assignResult, err := operation.Assign(c.env.MasterClient.GetMaster, c.env.option.GrpcDialOption, &operation.VolumeAssignRequest{
+		Count:       1,
+		Collection:  c.collection,
+		Replication: entry.Attributes.Replication,
+		Ttl:         needle.SecondsToTTL(entry.Attributes.TtlSec),
+		DiskType:    entry.Attributes.DiskType,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("assign: %v", err)
+	}
+
+	var resp *volume_server_pb.VolumeNeedleReencryptResponse
+	for _, loc := range locations {
+		err = operation.WithVolumeServerClient(loc.Url, c.env.option.GrpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) (reencryptErr error) {
+			resp, reencryptErr = volumeServerClient.VolumeNeedleReencrypt(context.Background(), &volume_server_pb.VolumeNeedleReencryptRequest{
+				VolumeId:     uint32(fileId.VolumeId),
+				NeedleId:     uint64(fileId.Key),
+				Cookie:       uint32(fileId.Cookie),
+				CipherKey:    chunk.CipherKey,
+				TargetFileId: assignResult.Fid,
+				TargetUrl:    assignResult.Url,
+				TargetAuth:   string(assignResult.Auth),
+			})
+			return
+		})
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fid, err := filer_pb.ToFileIdObject(assignResult.Fid)
+	if err != nil {
+		return nil, err
+	}
+
+	return &filer_pb.FileChunk{
+		FileId:       assignResult.Fid,
+		Offset:       chunk.Offset,
+		Size:         chunk.Size,
+		Mtime:        chunk.Mtime,
+		ETag:         resp.ETag,
+		Fid:          fid,
+		CipherKey:    resp.CipherKey,
+		IsCompressed: chunk.IsCompressed,
+	}, nil
+}
+
+// resolveDataChunks resolves the chunk manifests of large files into the data chunks
+func (c *commandCollectionReencrypt) resolveDataChunks(chunks []*filer_pb.FileChunk) ([]*filer_pb.FileChunk, error) {
+	manifestChunks, _ := filer.SeparateManifestChunks(chunks)
+	if len(manifestChunks) == 0 {
+		return chunks, nil
+	}
+	dataChunks, _, err := filer.ResolveChunkManifest(filer.LookupFn(c.env), chunks, 0, math.MaxInt64)
+	return dataChunks, err
+}
+
+// updateEntryChunks replaces the chunks in the latest version of the entry, only if the entry chunks are not changed
+// since they are read, and retries with the latest version if they are.
+// The entry with chunk manifests is updated with all the data chunks, for the filer to write new manifests.
+// The new chunks of the chunks not found in the entry any more are deleted, and set to nil in newChunks.
+func (c *commandCollectionReencrypt) updateEntryChunks(parentPath util.FullPath, name string, newChunks map[string]*filer_pb.FileChunk) error {
+
+	if len(newChunks) == 0 {
+		return nil
+	}
+
+	for i := 0; ; i++ {
+		used := make(map[string]bool)
+		err := c.env.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+
+			resp, err := filer_pb.LookupEntry(client, &filer_pb.LookupDirectoryEntryRequest{
+				Directory: string(parentPath),
+				Name:      name,
+			})
+			if err != nil {
+				return err
+			}
+
+			chunks, err := c.resolveDataChunks(resp.Entry.Chunks)
+			if err != nil {
+				return err
+			}
+			var updatedChunks []*filer_pb.FileChunk
+			for _, chunk := range chunks {
+				oldFileId := chunk.GetFileIdString()
+				if newChunk, found := newChunks[oldFileId]; found {
+					chunk = newChunk
+					used[oldFileId] = true
+				}
+				updatedChunks = append(updatedChunks, chunk)
+			}
+			if len(used) == 0 {
+				return nil
+			}
+
+			var expectedChunkFileIds []string
+			for _, chunk := range resp.Entry.Chunks {
+				expectedChunkFileIds = append(expectedChunkFileIds, chunk.GetFileIdString())
+			}
+			resp.Entry.Chunks = updatedChunks
+			return filer_pb.UpdateEntry(client, &filer_pb.UpdateEntryRequest{
+				Directory:            string(parentPath),
+				Entry:                resp.Entry,
+				ExpectedChunkFileIds: expectedChunkFileIds,
+			})
+		})
+		if err == filer_pb.ErrChunksChanged && i < reencryptUpdateRetries {
+			atomic.AddInt64(&c.retryCount, 1)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for oldFileId, newChunk := range newChunks {
+			if !used[oldFileId] {
+				c.deleteFileIds([]string{newChunk.GetFileIdString()})
+				newChunks[oldFileId] = nil
+			}
+		}
+		return nil
+	}
+}
+
+func (c *commandCollectionReencrypt) deleteFileIds(fileIds []string) {
+	if len(fileIds) == 0 {
+		return
+	}
+	if _, err := operation.DeleteFiles(c.env.MasterClient.GetMaster, false, c.env.option.GrpcDialOption, fileIds); err != nil {
+		c.printError("delete %v: %v\n", fileIds, err)
+	}
+}
+
+func (c *commandCollectionReencrypt) addProgress(chunks []*filer_pb.FileChunk) {
+	if len(chunks) == 0 {
+		return
+	}
+	var bytes int64
+	for _, chunk := range chunks {
+		bytes += int64(chunk.Size)
+	}
+	chunkCount := atomic.AddInt64(&c.chunkCount, int64(len(chunks)))
+	byteCount := atomic.AddInt64(&c.byteCount, bytes)
+	if fileCount := atomic.AddInt64(&c.fileCount, 1); fileCount%1000 == 0 {
+		c.writerLock.Lock()
+		fmt.Fprintf(c.writer, "progress: %d files, %d chunks, %d bytes\n", fileCount, chunkCount, byteCount)
+		c.writerLock.Unlock()
+	}
+}
+
+func (c *commandCollectionReencrypt) printError(format string, a ...interface{}) {
+	atomic.AddInt64(&c.errorCount, 1)
+	c.writerLock.Lock()
+	fmt.Fprintf(c.writer, format, a...)
+	c.writerLock.Unlock()
+}
+
+func collectCollectionVolumeIds(topoInfo *master_pb.TopologyInfo, selectedCollection string) map[uint32]bool {
+	vidMap := make(map[uint32]bool)
+	eachDataNode(topoInfo, func(dc string, rack RackId, dn *master_pb.DataNodeInfo) {
+		for _, diskInfo := range dn.DiskInfos {
+			for _, v := range diskInfo.VolumeInfos {
+				if v.Collection == selectedCollection {
+					vidMap[v.Id] = true
+				}
+			}
+			for _, ecShardInfo := range diskInfo.EcShardInfos {
+				if ecShardInfo.Collection == selectedCollection {
+					vidMap[ecShardInfo.Id] = true
+				}
+			}
+		}
+	})
+	return vidMap
+}
@@ -25,7 +25,9 @@ func (c *commandEcBalance) Name() string {
 func (c *commandEcBalance) Help() string {
 	return `balance all ec shards among all racks and volume servers
 
-	ec.balance [-c EACH_COLLECTION|<collection_name>] [-force] [-dataCenter <data_center>]
+	ec.balance [-collection EACH_COLLECTION|<collection_name>] [-force] [-dataCenter <data_center>]
+
+	Without -force, it only prints the ec shards to move.
 
 	Algorithm:
 
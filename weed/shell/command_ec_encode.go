@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"sort"
 	"sync"
 	"time"
 
@@ -32,14 +33,16 @@ func (c *commandEcEncode) Name() string {
 func (c *commandEcEncode) Help() string {
 	return `apply erasure coding to a volume
 
-	ec.encode [-collection=""] [-fullPercent=95] [-quietFor=1h]
-	ec.encode [-collection=""] [-volumeId=<volume_id>]
+	ec.encode [-collection=""] [-fullPercent=95] [-quietFor=1h] [-n]
+	ec.encode [-collection=""] [-volumeId=<volume_id>] [-n]
 
 	This command will:
 	1. freeze one volume
 	2. apply erasure coding to the volume
 	3. move the encoded shards to multiple volume servers
 
+	With -n, it only prints the volumes to encode and where their shards would go.
+
 	The erasure coding is 10.4. So ideally you have more than 14 volume servers, and you can afford
 	to lose 4 volume servers.
 
@@ -64,32 +67,70 @@ func (c *commandEcEncode) Do(args []string, commandEnv *CommandEnv, writer io.Wr
 	fullPercentage := encodeCommand.Float64("fullPercent", 95, "the volume reaches the percentage of max volume size")
 	quietPeriod := encodeCommand.Duration("quietFor", time.Hour, "select volumes without no writes for this period")
 	parallelCopy := encodeCommand.Bool("parallelCopy", true, "copy shards in parallel")
+	skipChanges := encodeCommand.Bool("n", false, "only print the volumes to encode and the planned shard locations")
 	if err = encodeCommand.Parse(args); err != nil {
 		return nil
 	}
 
-	vid := needle.VolumeId(*volumeId)
-
-	// volumeId is provided
-	if vid != 0 {
-		return doEcEncode(commandEnv, *collection, vid, *parallelCopy)
+	var volumeIds []needle.VolumeId
+	if vid := needle.VolumeId(*volumeId); vid != 0 {
+		// volumeId is provided
+		volumeIds = append(volumeIds, vid)
+	} else {
+		// apply to all volumes in the collection
+		volumeIds, err = collectVolumeIdsForEcEncode(commandEnv, *collection, *fullPercentage, *quietPeriod)
+		if err != nil {
+			return err
+		}
 	}
+	fmt.Fprintf(writer, "ec encode volumes: %v\n", volumeIds)
 
-	// apply to all volumes in the collection
-	volumeIds, err := collectVolumeIdsForEcEncode(commandEnv, *collection, *fullPercentage, *quietPeriod)
-	if err != nil {
-		return err
+	if *skipChanges {
+		allEcNodes, totalFreeEcSlots, err := collectEcNodes(commandEnv, "")
+		if err != nil {
+			return err
+		}
+		return planEcEncode(allEcNodes, totalFreeEcSlots, *collection, volumeIds, writer)
 	}
-	fmt.Printf("ec encode volumes: %v\n", volumeIds)
-	for _, vid := range volumeIds {
+
+	for i, vid := range volumeIds {
+		fmt.Fprintf(writer, "ec encode volume %d (%d/%d) ...\n", vid, i+1, len(volumeIds))
 		if err = doEcEncode(commandEnv, *collection, vid, *parallelCopy); err != nil {
 			return err
 		}
 	}
+	fmt.Fprintf(writer, "ec encoded %d volumes\n", len(volumeIds))
 
 	return nil
 }
 
+// planEcEncode prints where the shards of each volume would go, in the same way as spreadEcShards,
+// counting the shards planned for the earlier volumes
+func planEcEncode(allEcNodes []*EcNode, totalFreeEcSlots int, collection string, volumeIds []needle.VolumeId, writer io.Writer) error {
+	for i, vid := range volumeIds {
+		if totalFreeEcSlots < erasure_coding.TotalShardsCount {
+			return fmt.Errorf("not enough free ec shard slots for volume %d. only %d left", vid, totalFreeEcSlots)
+		}
+		sortEcNodesByFreeslotsDecending(allEcNodes)
+		allocatedDataNodes := allEcNodes
+		if len(allocatedDataNodes) > erasure_coding.TotalShardsCount {
+			allocatedDataNodes = allocatedDataNodes[:erasure_coding.TotalShardsCount]
+		}
+		allocatedEcIds := balancedEcDistribution(allocatedDataNodes)
+
+		fmt.Fprintf(writer, "volume %d (%d/%d) would be encoded to:\n", vid, i+1, len(volumeIds))
+		for j, dataNode := range allocatedDataNodes {
+			if len(allocatedEcIds[j]) == 0 {
+				continue
+			}
+			fmt.Fprintf(writer, "  %s %s shards %v\n", dataNode.rack, dataNode.info.Id, allocatedEcIds[j])
+			dataNode.addEcVolumeShards(vid, collection, allocatedEcIds[j])
+		}
+		totalFreeEcSlots -= erasure_coding.TotalShardsCount
+	}
+	return nil
+}
+
 func doEcEncode(commandEnv *CommandEnv, collection string, vid needle.VolumeId, parallelCopy bool) (err error) {
 	// find volume location
 	locations, found := commandEnv.MasterClient.GetLocations(uint32(vid))
@@ -299,6 +340,9 @@ func collectVolumeIdsForEcEncode(commandEnv *CommandEnv, selectedCollection stri
 	for vid := range vidMap {
 		vids = append(vids, needle.VolumeId(vid))
 	}
+	sort.Slice(vids, func(i, j int) bool {
+		return vids[i] < vids[j]
+	})
 
 	return
 }
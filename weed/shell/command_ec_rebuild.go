@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"sort"
 
 	"github.com/chrislusf/seaweedfs/weed/operation"
 	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
@@ -27,30 +28,25 @@ func (c *commandEcRebuild) Name() string {
 func (c *commandEcRebuild) Help() string {
 	return `find and rebuild missing ec shards among volume servers
 
-	ec.rebuild [-c EACH_COLLECTION|<collection_name>] [-force]
+	ec.rebuild [-collection EACH_COLLECTION|<collection_name>] [-force]
 
 	Algorithm:
 
-	For each type of volume server (different max volume count limit){
-		for each collection {
-			rebuildEcVolumes()
-		}
+	For each collection {
+		rebuildEcVolumes()
 	}
 
 	func rebuildEcVolumes(){
-		idealWritableVolumes = totalWritableVolumes / numVolumeServers
-		for {
-			sort all volume servers ordered by the number of local writable volumes
-			pick the volume server A with the lowest number of writable volumes x
-			pick the volume server B with the highest number of writable volumes y
-			if y > idealWritableVolumes and x +1 <= idealWritableVolumes {
-				if B has a writable volume id v that A does not have {
-					move writable volume v from A to B
-				}
-			}
+		for each ec volume with missing shards, and at least 10 shards left {
+			pick the volume server with the most free ec shard slots as the rebuilder
+			copy the existing shards, and the .ecx .ecj .vif files, to the rebuilder
+			generate and mount the missing shards on the rebuilder
+			delete the copied shards from the rebuilder
 		}
 	}
 
+	Without -force, it only prints the missing shards and the shards to copy.
+
 `
 }
 
@@ -104,6 +100,7 @@ func rebuildEcVolumes(commandEnv *CommandEnv, allEcNodes []*EcNode, collection s
 		ecShardMap.registerEcNode(ecNode, collection)
 	}
 
+	var volumeIds []needle.VolumeId
 	for vid, locations := range ecShardMap {
 		shardCount := locations.shardCount()
 		if shardCount == erasure_coding.TotalShardsCount {
@@ -112,6 +109,13 @@ func rebuildEcVolumes(commandEnv *CommandEnv, allEcNodes []*EcNode, collection s
 		if shardCount < erasure_coding.DataShardsCount {
 			return fmt.Errorf("ec volume %d is unrepairable with %d shards\n", vid, shardCount)
 		}
+		volumeIds = append(volumeIds, vid)
+	}
+	sort.Slice(volumeIds, func(i, j int) bool {
+		return volumeIds[i] < volumeIds[j]
+	})
+
+	for i, vid := range volumeIds {
 
 		sortEcNodesByFreeslotsDecending(allEcNodes)
 
@@ -119,11 +123,20 @@ func rebuildEcVolumes(commandEnv *CommandEnv, allEcNodes []*EcNode, collection s
 			return fmt.Errorf("disk space is not enough")
 		}
 
-		if err := rebuildOneEcVolume(commandEnv, allEcNodes[0], collection, vid, locations, writer, applyChanges); err != nil {
+		fmt.Fprintf(writer, "rebuild ec volume %d (%d/%d) on %s\n", vid, i+1, len(volumeIds), allEcNodes[0].info.Id)
+		if err := rebuildOneEcVolume(commandEnv, allEcNodes[0], collection, vid, ecShardMap[vid], writer, applyChanges); err != nil {
 			return err
 		}
 	}
 
+	if len(volumeIds) > 0 {
+		if applyChanges {
+			fmt.Fprintf(writer, "rebuilt %d ec volumes of collection %q\n", len(volumeIds), collection)
+		} else {
+			fmt.Fprintf(writer, "%d ec volumes of collection %q to rebuild, use -force to apply\n", len(volumeIds), collection)
+		}
+	}
+
 	return nil
 }
 
@@ -137,6 +150,9 @@ func rebuildOneEcVolume(commandEnv *CommandEnv, rebuilder *EcNode, collection st
 	if err != nil {
 		return err
 	}
+	if !applyChanges {
+		return nil
+	}
 	defer func() {
 		// clean up working files
 
@@ -148,10 +164,6 @@ func rebuildOneEcVolume(commandEnv *CommandEnv, rebuilder *EcNode, collection st
 
 	}()
 
-	if !applyChanges {
-		return nil
-	}
-
 	// generate ec shards, and maybe ecx file
 	generatedShardIds, err = generateMissingShards(commandEnv.option.GrpcDialOption, collection, volumeId, rebuilder.info.Id)
 	if err != nil {
@@ -230,6 +242,9 @@ func prepareDataToRecover(commandEnv *CommandEnv, rebuilder *EcNode, collection
 		}
 		if copyErr != nil {
 			fmt.Fprintf(writer, "%s failed to copy %d.%d from %s: %v\n", rebuilder.info.Id, volumeId, shardId, ecNodes[0].info.Id, copyErr)
+		} else if !applyBalancing {
+			fmt.Fprintf(writer, "%s would copy %d.%d from %s\n", rebuilder.info.Id, volumeId, shardId, ecNodes[0].info.Id)
+			copiedShardIds = append(copiedShardIds, uint32(shardId))
 		} else {
 			fmt.Fprintf(writer, "%s copied %d.%d from %s\n", rebuilder.info.Id, volumeId, shardId, ecNodes[0].info.Id)
 			copiedShardIds = append(copiedShardIds, uint32(shardId))
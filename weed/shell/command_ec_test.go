@@ -1,7 +1,9 @@
 package shell
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
@@ -138,3 +140,58 @@ func newEcNode(dc string, rack string, dataNodeId string, freeEcSlot int) *EcNod
 func (ecNode *EcNode) addEcVolumeAndShardsForTest(vid uint32, collection string, shardIds []uint32) *EcNode {
 	return ecNode.addEcVolumeShards(needle.VolumeId(vid), collection, shardIds)
 }
+
+func TestCommandEcEncodePlan(t *testing.T) {
+
+	allEcNodes := []*EcNode{
+		newEcNode("dc1", "rack1", "dn1", 10),
+		newEcNode("dc1", "rack2", "dn2", 10),
+		newEcNode("dc1", "rack3", "dn3", 10),
+	}
+
+	var buf bytes.Buffer
+	if err := planEcEncode(allEcNodes, 30, "c1", []needle.VolumeId{1, 2}, &buf); err != nil {
+		t.Fatalf("plan ec encode: %v", err)
+	}
+	for _, ecNode := range allEcNodes {
+		if ecNode.freeEcSlot < 0 {
+			t.Errorf("%s overbooked: %d", ecNode.info.Id, ecNode.freeEcSlot)
+		}
+	}
+	if !strings.Contains(buf.String(), "volume 2 (2/2) would be encoded to") {
+		t.Errorf("unexpected plan: %s", buf.String())
+	}
+
+	// the third volume does not fit
+	if err := planEcEncode(allEcNodes, 2, "c1", []needle.VolumeId{3}, &buf); err == nil {
+		t.Errorf("expected not enough free ec shard slots")
+	}
+}
+
+func TestCommandEcRebuildDryRun(t *testing.T) {
+
+	allEcNodes := []*EcNode{
+		newEcNode("dc1", "rack1", "dn1", 100).addEcVolumeAndShardsForTest(1, "c1", []uint32{0, 1, 2, 3, 4, 5, 6}),
+		newEcNode("dc1", "rack2", "dn2", 100).addEcVolumeAndShardsForTest(1, "c1", []uint32{7, 8, 9, 10, 11}),
+		newEcNode("dc1", "rack3", "dn3", 100).addEcVolumeAndShardsForTest(2, "c1", []uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13}),
+	}
+
+	var buf bytes.Buffer
+	if err := rebuildEcVolumes(nil, allEcNodes, "c1", &buf, false); err != nil {
+		t.Fatalf("rebuild ec volumes: %v", err)
+	}
+	output := buf.String()
+	for _, expected := range []string{
+		"rebuild ec volume 1 (1/1)",
+		"missing shard 1.12",
+		"missing shard 1.13",
+		"1 ec volumes of collection \"c1\" to rebuild",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("missing %q in %s", expected, output)
+		}
+	}
+	if strings.Contains(output, "ec volume 2") {
+		t.Errorf("complete ec volume 2 rebuilt: %s", output)
+	}
+}
@@ -36,6 +36,12 @@ func (c *commandFsConfigure) Help() string {
 	# example: configure adding only 1 physical volume for each bucket collection
 	fs.configure -locationPrefix=/buckets/ -volumeGrowthCount=1
 
+	# example: save files smaller than 8KB in the filer store, instead of volume servers
+	fs.configure -locationPrefix=/my/icons/ -saveToFilerLimit=8192
+
+	# example: split the files into 32MB chunks, for writes via http, s3, and mount
+	fs.configure -locationPrefix=/buckets/videos/ -maxMB=32
+
 	# apply the changes
 	fs.configure -locationPrefix=/my/folder -collection=abc -apply
 
@@ -56,6 +62,9 @@ func (c *commandFsConfigure) Do(args []string, commandEnv *CommandEnv, writer io
 	fsync := fsConfigureCommand.Bool("fsync", false, "fsync for the writes")
 	isReadOnly := fsConfigureCommand.Bool("readOnly", false, "disable writes")
 	volumeGrowthCount := fsConfigureCommand.Int("volumeGrowthCount", 0, "the number of physical volumes to add if no writable volumes")
+	readMode := fsConfigureCommand.String("readMode", "", "[proxy|redirect] read through the filer, or redirect to the volume server for single chunk files")
+	saveToFilerLimit := fsConfigureCommand.Uint("saveToFilerLimit", 0, "files smaller than this size are saved in the filer store")
+	maxMB := fsConfigureCommand.Uint("maxMB", 0, "split files larger than this limit into chunks of this size in MB")
 	isDelete := fsConfigureCommand.Bool("delete", false, "delete the configuration by locationPrefix")
 	apply := fsConfigureCommand.Bool("apply", false, "update and apply filer configuration")
 	if err = fsConfigureCommand.Parse(args); err != nil {
@@ -86,6 +95,14 @@ func (c *commandFsConfigure) Do(args []string, commandEnv *CommandEnv, writer io
 			DiskType:          *diskType,
 			VolumeGrowthCount: uint32(*volumeGrowthCount),
 			ReadOnly:          *isReadOnly,
+			ReadMode:          *readMode,
+			SaveToFilerLimit:  uint32(*saveToFilerLimit),
+			MaxMb:             uint32(*maxMB),
+		}
+
+		// check read mode
+		if *readMode != "" && *readMode != filer.ReadModeProxy && *readMode != filer.ReadModeRedirect {
+			return fmt.Errorf("unknown read mode %s", *readMode)
 		}
 
 		// check collection
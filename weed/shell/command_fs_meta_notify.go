@@ -51,7 +51,7 @@ func (c *commandFsMetaNotify) Do(args []string, commandEnv *CommandEnv, writer i
 			fileCount++
 		}
 
-		notifyErr := notification.Queue.SendMessage(
+		notifyErr := notification.SendMessage(
 			string(parentPath.Child(entry.Name)),
 			&filer_pb.EventNotification{
 				NewEntry: entry,
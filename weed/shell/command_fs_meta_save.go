@@ -104,7 +104,7 @@ func (c *commandFsMetaSave) Do(args []string, commandEnv *CommandEnv, writer io.
 	})
 
 	if err == nil {
-		fmt.Fprintf(writer, "meta data for http://%s:%d%s is saved to %s\n", commandEnv.option.FilerHost, commandEnv.option.FilerPort, path, fileName)
+		fmt.Fprintf(writer, "meta data for http://%s%s is saved to %s\n", util.JoinHostPort(commandEnv.option.FilerHost, int(commandEnv.option.FilerPort)), path, fileName)
 	}
 
 	return err
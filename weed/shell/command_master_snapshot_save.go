@@ -0,0 +1,73 @@
+package shell
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+)
+
+func init() {
+	Commands = append(Commands, &commandMasterSnapshotSave{})
+}
+
+type commandMasterSnapshotSave struct {
+}
+
+func (c *commandMasterSnapshotSave) Name() string {
+	return "master.snapshot.save"
+}
+
+func (c *commandMasterSnapshotSave) Help() string {
+	return `save the max volume id, the file key sequence and the topology of the master leader to a local file
+
+	master.snapshot.save                  # save to a local master-<time>.snapshot file
+	master.snapshot.save -o t.snapshot    # save to t.snapshot file
+
+	If all masters and their meta data folders are lost, bootstrap a new master set from the snapshot with
+
+	weed master -mdir=<new empty folder> -snapshot=t.snapshot -peers=...
+
+	The new masters continue the volume ids and file keys after the snapshot, skipping the gaps
+	set by -snapshot.volumeIdGap and -snapshot.fileKeyGap for the volumes and files created after the snapshot.
+
+`
+}
+
+func (c *commandMasterSnapshotSave) Do(args []string, commandEnv *CommandEnv, writer io.Writer) (err error) {
+
+	snapshotSaveCommand := flag.NewFlagSet(c.Name(), flag.ContinueOnError)
+	outputFileName := snapshotSaveCommand.String("o", "", "output the snapshot to this file")
+	if err = snapshotSaveCommand.Parse(args); err != nil {
+		return nil
+	}
+
+	var snapshot *master_pb.MasterSnapshot
+	err = commandEnv.MasterClient.WithClient(func(client master_pb.SeaweedClient) error {
+		snapshot, err = client.GetMasterSnapshot(context.Background(), &master_pb.GetMasterSnapshotRequest{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fileName := *outputFileName
+	if fileName == "" {
+		t := time.Unix(0, snapshot.SnapshotTsNs)
+		fileName = fmt.Sprintf("master-%4d%02d%02d-%02d%02d%02d.snapshot",
+			t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second())
+	}
+
+	if err = pb.SaveMasterSnapshot(fileName, snapshot); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(writer, "saved snapshot of leader %s to %s: max volume id %d, next file key %d, %s sequencer\n",
+		snapshot.Leader, fileName, snapshot.MaxVolumeId, snapshot.NextFileKey, snapshot.SequencerType)
+
+	return nil
+}
@@ -36,6 +36,9 @@ func (c *commandVolumeCheckDisk) Help() string {
         append entries in A and not in B to B
         append entries in B and not in A to A
 
+	The volumes marked by the volume servers after failing to replicate some writes or deletes
+	are checked even if the file counts are the same, and the marks are cleared after the replicas are synced with -force.
+
 `
 }
 
@@ -75,30 +78,61 @@ func (c *commandVolumeCheckDisk) Do(args []string, commandEnv *CommandEnv, write
 		sort.Slice(replicas, func(i, j int) bool {
 			return fileCount(replicas[i]) > fileCount(replicas[j])
 		})
-		for len(replicas) >= 2 {
-			a, b := replicas[0], replicas[1]
-			if !*slowMode {
+		outOfSync := hasReplicasOutOfSync(replicas)
+		synced := true
+		for remaining := replicas; len(remaining) >= 2; remaining = remaining[1:] {
+			a, b := remaining[0], remaining[1]
+			if !*slowMode && !outOfSync {
 				if fileCount(a) == fileCount(b) {
-					replicas = replicas[1:]
 					continue
 				}
 			}
 			if a.info.ReadOnly || b.info.ReadOnly {
 				fmt.Fprintf(writer, "skipping readonly volume %d on %s and %s\n", a.info.Id, a.location.dataNode.Id, b.location.dataNode.Id)
-				replicas = replicas[1:]
+				synced = false
 				continue
 			}
 
 			if err := c.syncTwoReplicas(aDB, bDB, a, verbose, writer, b, err, applyChanges, nonRepairThreshold); err != nil {
 				fmt.Fprintf(writer, "snyc volume %d on %s and %s: %v\n", a.info.Id, a.location.dataNode.Id, b.location.dataNode.Id, err)
+				synced = false
 			}
-			replicas = replicas[1:]
+		}
+		if outOfSync && synced && *applyChanges {
+			c.markReplicasInSync(replicas, writer)
 		}
 	}
 
 	return nil
 }
 
+func hasReplicasOutOfSync(replicas []*VolumeReplica) bool {
+	for _, replica := range replicas {
+		if replica.info.ReplicasOutOfSync {
+			return true
+		}
+	}
+	return false
+}
+
+// markReplicasInSync clears the marks of failed replications, after all the replicas of the volume are synced
+func (c *commandVolumeCheckDisk) markReplicasInSync(replicas []*VolumeReplica, writer io.Writer) {
+	for _, replica := range replicas {
+		if !replica.info.ReplicasOutOfSync {
+			continue
+		}
+		err := operation.WithVolumeServerClient(replica.location.dataNode.Id, c.env.option.GrpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
+			_, err := client.VolumeMarkReplicasInSync(context.Background(), &volume_server_pb.VolumeMarkReplicasInSyncRequest{
+				VolumeId: replica.info.Id,
+			})
+			return err
+		})
+		if err != nil {
+			fmt.Fprintf(writer, "mark volume %d on %s in sync: %v\n", replica.info.Id, replica.location.dataNode.Id, err)
+		}
+	}
+}
+
 func (c *commandVolumeCheckDisk) syncTwoReplicas(aDB *needle_map.MemDb, bDB *needle_map.MemDb, a *VolumeReplica, verbose *bool, writer io.Writer, b *VolumeReplica, err error, applyChanges *bool, nonRepairThreshold *float64) error {
 	aHasChanges, bHasChanges := true, true
 	for aHasChanges || bHasChanges {
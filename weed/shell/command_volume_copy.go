@@ -24,7 +24,9 @@ func (c *commandVolumeCopy) Help() string {
 
 	volume.copy -source <source volume server host:port> -target <target volume server host:port> -volumeId <volume id>
 
-	This command copies a volume from one volume server to another volume server.
+	This command copies a volume from one volume server to another volume server, and mounts it on the target volume server.
+	The source volume is marked as readonly during the copying, and writable again afterwards if it was writable.
+	The copying progress is printed periodically.
 	Usually you will want to unmount the volume first before copying.
 
 `
@@ -48,10 +50,16 @@ func (c *commandVolumeCopy) Do(args []string, commandEnv *CommandEnv, writer io.
 
 	volumeId := needle.VolumeId(*volumeIdInt)
 
+	if sourceVolumeServer == "" || targetVolumeServer == "" || volumeId == 0 {
+		return fmt.Errorf("-source, -target and -volumeId are required")
+	}
 	if sourceVolumeServer == targetVolumeServer {
 		return fmt.Errorf("source and target volume servers are the same!")
 	}
 
-	_, err = copyVolume(commandEnv.option.GrpcDialOption, volumeId, sourceVolumeServer, targetVolumeServer, "")
-	return
+	if _, err = copyVolume(commandEnv.option.GrpcDialOption, writer, volumeId, sourceVolumeServer, targetVolumeServer, ""); err != nil {
+		return fmt.Errorf("copy volume %d from %s to %s: %v", volumeId, sourceVolumeServer, targetVolumeServer, err)
+	}
+	fmt.Fprintf(writer, "copied volume %d from %s to %s\n", volumeId, sourceVolumeServer, targetVolumeServer)
+	return nil
 }
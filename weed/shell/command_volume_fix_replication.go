@@ -171,60 +171,66 @@ func (c *commandVolumeFixReplication) fixOneUnderReplicatedVolume(commandEnv *Co
 	replicas := volumeReplicas[vid]
 	replica := pickOneReplicaToCopyFrom(replicas)
 	replicaPlacement, _ := super_block.NewReplicaPlacementFromByte(byte(replica.info.ReplicaPlacement))
-	foundNewLocation := false
-	hasSkippedCollection := false
-	keepDataNodesSorted(allLocations, types.ToDiskType(replica.info.DiskType))
-	fn := capacityByFreeVolumeCount(types.ToDiskType(replica.info.DiskType))
-	for _, dst := range allLocations {
-		// check whether data nodes satisfy the constraints
-		if fn(dst.dataNode) > 0 && satisfyReplicaPlacement(replicaPlacement, replicas, dst) {
-			// check collection name pattern
-			if *c.collectionPattern != "" {
-				matched, err := filepath.Match(*c.collectionPattern, replica.info.Collection)
-				if err != nil {
-					return fmt.Errorf("match pattern %s with collection %s: %v", *c.collectionPattern, replica.info.Collection, err)
-				}
-				if !matched {
-					hasSkippedCollection = true
-					break
-				}
-			}
-
-			// ask the volume server to replicate the volume
-			foundNewLocation = true
-			fmt.Fprintf(writer, "replicating volume %d %s from %s to dataNode %s ...\n", replica.info.Id, replicaPlacement, replica.location.dataNode.Id, dst.dataNode.Id)
+	dst, found := pickOneLocationToReplicate(replicaPlacement, replicas, types.ToDiskType(replica.info.DiskType), allLocations)
+	if !found {
+		fmt.Fprintf(writer, "failed to place volume %d replica as %s, existing:%+v\n", replica.info.Id, replicaPlacement, len(replicas))
+		return nil
+	}
 
-			if !takeAction {
-				break
-			}
+	// check collection name pattern
+	if *c.collectionPattern != "" {
+		matched, err := filepath.Match(*c.collectionPattern, replica.info.Collection)
+		if err != nil {
+			return fmt.Errorf("match pattern %s with collection %s: %v", *c.collectionPattern, replica.info.Collection, err)
+		}
+		if !matched {
+			return nil
+		}
+	}
 
-			err := operation.WithVolumeServerClient(dst.dataNode.Id, commandEnv.option.GrpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) error {
-				_, replicateErr := volumeServerClient.VolumeCopy(context.Background(), &volume_server_pb.VolumeCopyRequest{
-					VolumeId:       replica.info.Id,
-					SourceDataNode: replica.location.dataNode.Id,
-				})
-				if replicateErr != nil {
-					return fmt.Errorf("copying from %s => %s : %v", replica.location.dataNode.Id, dst.dataNode.Id, replicateErr)
-				}
-				return nil
-			})
+	// ask the volume server to replicate the volume
+	fmt.Fprintf(writer, "replicating volume %d %s from %s to dataNode %s ...\n", replica.info.Id, replicaPlacement, replica.location.dataNode.Id, dst.dataNode.Id)
 
-			if err != nil {
-				return err
-			}
+	if !takeAction {
+		return nil
+	}
 
-			// adjust free volume count
-			dst.dataNode.DiskInfos[replica.info.DiskType].FreeVolumeCount--
-			break
+	err := operation.WithVolumeServerClient(dst.dataNode.Id, commandEnv.option.GrpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) error {
+		stream, replicateErr := volumeServerClient.VolumeCopy(context.Background(), &volume_server_pb.VolumeCopyRequest{
+			VolumeId:       replica.info.Id,
+			SourceDataNode: replica.location.dataNode.Id,
+		})
+		if replicateErr == nil {
+			_, replicateErr = receiveVolumeCopy(stream, writer, needle.VolumeId(replica.info.Id))
 		}
-	}
+		if replicateErr != nil {
+			return fmt.Errorf("copying from %s => %s : %v", replica.location.dataNode.Id, dst.dataNode.Id, replicateErr)
+		}
+		return nil
+	})
 
-	if !foundNewLocation && !hasSkippedCollection {
-		fmt.Fprintf(writer, "failed to place volume %d replica as %s, existing:%+v\n", replica.info.Id, replicaPlacement, len(replicas))
+	if err != nil {
+		return err
 	}
+
+	// adjust free volume count
+	dst.dataNode.DiskInfos[replica.info.DiskType].FreeVolumeCount--
 	return nil
 }
 
+// pickOneLocationToReplicate picks the data node with the most free slots where one more replica satisfies the replica placement
+func pickOneLocationToReplicate(replicaPlacement *super_block.ReplicaPlacement, replicas []*VolumeReplica, diskType types.DiskType, allLocations []location) (location, bool) {
+	keepDataNodesSorted(allLocations, diskType)
+	fn := capacityByFreeVolumeCount(diskType)
+	for _, dst := range allLocations {
+		// check whether data nodes satisfy the constraints
+		if fn(dst.dataNode) > 0 && satisfyReplicaPlacement(replicaPlacement, replicas, dst) {
+			return dst, true
+		}
+	}
+	return location{}, false
+}
+
 func keepDataNodesSorted(dataNodes []location, diskType types.DiskType) {
 	fn := capacityByFreeVolumeCount(diskType)
 	sort.Slice(dataNodes, func(i, j int) bool {
@@ -95,7 +95,11 @@ func writeRackInfo(writer io.Writer, t *master_pb.RackInfo) statistics {
 	return s
 }
 func writeDataNodeInfo(writer io.Writer, t *master_pb.DataNodeInfo) statistics {
-	fmt.Fprintf(writer, "      DataNode %s%s\n", t.Id, diskInfosToString(t.DiskInfos))
+	var state string
+	if t.State != "" && t.State != "active" {
+		state = " " + t.State
+	}
+	fmt.Fprintf(writer, "      DataNode %s%s%s\n", t.Id, state, diskInfosToString(t.DiskInfos))
 	var s statistics
 	for _, diskInfo := range t.DiskInfos {
 		s = s.plus(writeDiskInfo(writer, diskInfo))
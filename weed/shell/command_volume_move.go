@@ -11,6 +11,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/operation"
 	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/util"
 	"google.golang.org/grpc"
 )
 
@@ -31,15 +32,28 @@ func (c *commandVolumeMove) Help() string {
 	volume.move -source <source volume server host:port> -target <target volume server host:port> -volumeId <volume id>
 	volume.move -source <source volume server host:port> -target <target volume server host:port> -volumeId <volume id> -disk [hdd|ssd|<tag>]
 
-	This command move a live volume from one volume server to another volume server. Here are the steps:
+	This command move a live volume from one volume server to another volume server.
+
+	If the volume is writable, it stays writable during the copying. Here are the steps:
+
+	1. This command asks the target volume server to copy the source volume from source volume server, without mounting it.
+		The copying progress is printed periodically.
+	2. This command asks the target volume server to tail the source volume for updates after the copying, until caught up.
+		The new volume is not visible to the master yet.
+	3. This command asks the source volume server to mark the volume as readonly.
+	4. This command asks the target volume server to tail the last updates, until idle for 5 seconds, and mount the new volume.
+	5. This command asks the source volume server to delete the source volume, which also unmounts it.
+		Now the master will mark this volume id as writable, on the target volume server.
+
+	If the volume is readonly, here are the steps:
 
 	1. This command asks the target volume server to copy the source volume from source volume server, remember the last entry's timestamp.
+		The copying progress is printed periodically.
 	2. This command asks the target volume server to mount the new volume
-		Now the master will mark this volume id as readonly.
-	3. This command asks the target volume server to tail the source volume for updates after the timestamp, for 1 minutes to drain the requests.
-	4. This command asks the source volume server to unmount the source volume
-		Now the master will mark this volume id as writable.
-	5. This command asks the source volume server to delete the source volume
+	3. This command asks the target volume server to tail the source volume for updates after the timestamp, until idle for 5 seconds to drain the requests.
+	4. This command asks the source volume server to delete the source volume, which also unmounts it.
+
+	If any step fails before the source volume is deleted, the source volume is marked as writable again if it was writable.
 
 	The option "-disk [hdd|ssd|<tag>]" can be used to change the volume disk type.
 
@@ -65,90 +79,185 @@ func (c *commandVolumeMove) Do(args []string, commandEnv *CommandEnv, writer io.
 
 	volumeId := needle.VolumeId(*volumeIdInt)
 
+	if sourceVolumeServer == "" || targetVolumeServer == "" || volumeId == 0 {
+		return fmt.Errorf("-source, -target and -volumeId are required")
+	}
 	if sourceVolumeServer == targetVolumeServer {
 		return fmt.Errorf("source and target volume servers are the same!")
 	}
 
-	return LiveMoveVolume(commandEnv.option.GrpcDialOption, volumeId, sourceVolumeServer, targetVolumeServer, 5*time.Second, *diskTypeStr)
+	return LiveMoveVolume(commandEnv.option.GrpcDialOption, writer, volumeId, sourceVolumeServer, targetVolumeServer, 5*time.Second, *diskTypeStr)
 }
 
 // LiveMoveVolume moves one volume from one source volume server to one target volume server, with idleTimeout to drain the incoming requests.
-func LiveMoveVolume(grpcDialOption grpc.DialOption, volumeId needle.VolumeId, sourceVolumeServer, targetVolumeServer string, idleTimeout time.Duration, diskType string) (err error) {
+// A writable volume is copied while it is written, and is readonly only during the final cutover.
+func LiveMoveVolume(grpcDialOption grpc.DialOption, writer io.Writer, volumeId needle.VolumeId, sourceVolumeServer, targetVolumeServer string, idleTimeout time.Duration, diskType string) (err error) {
 
-	log.Printf("copying volume %d from %s to %s", volumeId, sourceVolumeServer, targetVolumeServer)
-	lastAppendAtNs, err := copyVolume(grpcDialOption, volumeId, sourceVolumeServer, targetVolumeServer, diskType)
+	isReadOnly, err := isVolumeReadonly(grpcDialOption, volumeId, sourceVolumeServer)
+	if err != nil {
+		return fmt.Errorf("volume %d status on %s: %v", volumeId, sourceVolumeServer, err)
+	}
+	if !isReadOnly {
+		return liveMoveWritableVolume(grpcDialOption, writer, volumeId, sourceVolumeServer, targetVolumeServer, idleTimeout, diskType)
+	}
+
+	fmt.Fprintf(writer, "copying volume %d from %s to %s\n", volumeId, sourceVolumeServer, targetVolumeServer)
+	lastAppendAtNs, err := doCopyVolume(grpcDialOption, writer, volumeId, sourceVolumeServer, targetVolumeServer, diskType, false)
 	if err != nil {
 		return fmt.Errorf("copy volume %d from %s to %s: %v", volumeId, sourceVolumeServer, targetVolumeServer, err)
 	}
 
-	log.Printf("tailing volume %d from %s to %s", volumeId, sourceVolumeServer, targetVolumeServer)
+	fmt.Fprintf(writer, "tailing volume %d from %s to %s\n", volumeId, sourceVolumeServer, targetVolumeServer)
 	if err = tailVolume(grpcDialOption, volumeId, sourceVolumeServer, targetVolumeServer, lastAppendAtNs, idleTimeout); err != nil {
 		return fmt.Errorf("tail volume %d from %s to %s: %v", volumeId, sourceVolumeServer, targetVolumeServer, err)
 	}
 
-	log.Printf("deleting volume %d from %s", volumeId, sourceVolumeServer)
+	fmt.Fprintf(writer, "deleting volume %d from %s\n", volumeId, sourceVolumeServer)
 	if err = deleteVolume(grpcDialOption, volumeId, sourceVolumeServer); err != nil {
 		return fmt.Errorf("delete volume %d from %s: %v", volumeId, sourceVolumeServer, err)
 	}
 
-	log.Printf("moved volume %d from %s to %s", volumeId, sourceVolumeServer, targetVolumeServer)
+	fmt.Fprintf(writer, "moved volume %d from %s to %s\n", volumeId, sourceVolumeServer, targetVolumeServer)
 	return nil
 }
 
-func copyVolume(grpcDialOption grpc.DialOption, volumeId needle.VolumeId, sourceVolumeServer, targetVolumeServer string, diskType string) (lastAppendAtNs uint64, err error) {
+// liveMoveWritableVolume copies the volume without mounting it on the target volume server, and follows the updates until caught up.
+// Then the source volume is marked readonly to apply the last updates, and the target volume is mounted before the source volume is deleted.
+func liveMoveWritableVolume(grpcDialOption grpc.DialOption, writer io.Writer, volumeId needle.VolumeId, sourceVolumeServer, targetVolumeServer string, idleTimeout time.Duration, diskType string) (err error) {
+
+	fmt.Fprintf(writer, "copying writable volume %d from %s to %s\n", volumeId, sourceVolumeServer, targetVolumeServer)
+	lastAppendAtNs, err := doCopyVolume(grpcDialOption, writer, volumeId, sourceVolumeServer, targetVolumeServer, diskType, true)
+	if err != nil {
+		return fmt.Errorf("copy volume %d from %s to %s: %v", volumeId, sourceVolumeServer, targetVolumeServer, err)
+	}
+
+	fmt.Fprintf(writer, "catching up volume %d from %s to %s\n", volumeId, sourceVolumeServer, targetVolumeServer)
+	tailResp, err := tailUnmountedVolume(grpcDialOption, volumeId, sourceVolumeServer, targetVolumeServer, lastAppendAtNs, 0, false)
+	if err != nil {
+		return fmt.Errorf("tail volume %d from %s to %s: %v", volumeId, sourceVolumeServer, targetVolumeServer, err)
+	}
+	fmt.Fprintf(writer, "  volume %d applied %d updates\n", volumeId, tailResp.NeedleCount)
+
+	fmt.Fprintf(writer, "switching volume %d from %s to %s\n", volumeId, sourceVolumeServer, targetVolumeServer)
+	if err = markVolumeWritable(grpcDialOption, volumeId, sourceVolumeServer, false); err != nil {
+		return fmt.Errorf("mark volume %d as readonly on %s: %v", volumeId, sourceVolumeServer, err)
+	}
+	defer func() {
+		if err != nil {
+			if writableErr := markVolumeWritable(grpcDialOption, volumeId, sourceVolumeServer, true); writableErr != nil {
+				fmt.Fprintf(writer, "failed to mark volume %d as writable on %s: %v\n", volumeId, sourceVolumeServer, writableErr)
+			}
+		}
+	}()
+
+	if tailResp, err = tailUnmountedVolume(grpcDialOption, volumeId, sourceVolumeServer, targetVolumeServer, tailResp.LastAppendAtNs, idleTimeout, true); err != nil {
+		return fmt.Errorf("tail and mount volume %d from %s to %s: %v", volumeId, sourceVolumeServer, targetVolumeServer, err)
+	}
+	fmt.Fprintf(writer, "  volume %d applied %d updates, mounted on %s\n", volumeId, tailResp.NeedleCount, targetVolumeServer)
+
+	fmt.Fprintf(writer, "deleting volume %d from %s\n", volumeId, sourceVolumeServer)
+	if err = deleteVolume(grpcDialOption, volumeId, sourceVolumeServer); err != nil {
+		return fmt.Errorf("delete volume %d from %s: %v", volumeId, sourceVolumeServer, err)
+	}
+
+	fmt.Fprintf(writer, "moved volume %d from %s to %s\n", volumeId, sourceVolumeServer, targetVolumeServer)
+	return nil
+}
+
+// copyVolume copies the volume to the target volume server, with the source volume readonly during the copying
+func copyVolume(grpcDialOption grpc.DialOption, writer io.Writer, volumeId needle.VolumeId, sourceVolumeServer, targetVolumeServer string, diskType string) (lastAppendAtNs uint64, err error) {
 
 	// check to see if the volume is already read-only and if its not then we need
 	// to mark it as read-only and then before we return we need to undo what we
 	// did
-	var shouldMarkWritable bool
+	shouldMarkWritable, err := markSourceVolumeReadonly(grpcDialOption, volumeId, sourceVolumeServer)
+	if err != nil {
+		return
+	}
 	defer func() {
 		if !shouldMarkWritable {
 			return
 		}
-
-		clientErr := operation.WithVolumeServerClient(sourceVolumeServer, grpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) error {
-			_, writableErr := volumeServerClient.VolumeMarkWritable(context.Background(), &volume_server_pb.VolumeMarkWritableRequest{
-				VolumeId: uint32(volumeId),
-			})
-			return writableErr
-		})
-		if clientErr != nil {
-			log.Printf("failed to mark volume %d as writable after copy from %s: %v", volumeId, sourceVolumeServer, clientErr)
+		if writableErr := markVolumeWritable(grpcDialOption, volumeId, sourceVolumeServer, true); writableErr != nil {
+			log.Printf("failed to mark volume %d as writable after copy from %s: %v", volumeId, sourceVolumeServer, writableErr)
 		}
 	}()
 
+	return doCopyVolume(grpcDialOption, writer, volumeId, sourceVolumeServer, targetVolumeServer, diskType, false)
+}
+
+func isVolumeReadonly(grpcDialOption grpc.DialOption, volumeId needle.VolumeId, sourceVolumeServer string) (isReadOnly bool, err error) {
 	err = operation.WithVolumeServerClient(sourceVolumeServer, grpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) error {
 		resp, statusErr := volumeServerClient.VolumeStatus(context.Background(), &volume_server_pb.VolumeStatusRequest{
 			VolumeId: uint32(volumeId),
 		})
-		if statusErr == nil && !resp.IsReadOnly {
-			shouldMarkWritable = true
-			_, readonlyErr := volumeServerClient.VolumeMarkReadonly(context.Background(), &volume_server_pb.VolumeMarkReadonlyRequest{
-				VolumeId: uint32(volumeId),
-			})
-			return readonlyErr
+		if statusErr == nil {
+			isReadOnly = resp.IsReadOnly
 		}
 		return statusErr
 	})
-	if err != nil {
-		return
-	}
+	return
+}
+
+// markSourceVolumeReadonly marks the volume as readonly, and returns whether it was writable before
+func markSourceVolumeReadonly(grpcDialOption grpc.DialOption, volumeId needle.VolumeId, sourceVolumeServer string) (wasWritable bool, err error) {
+	err = operation.WithVolumeServerClient(sourceVolumeServer, grpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) error {
+		resp, statusErr := volumeServerClient.VolumeStatus(context.Background(), &volume_server_pb.VolumeStatusRequest{
+			VolumeId: uint32(volumeId),
+		})
+		if statusErr != nil || resp.IsReadOnly {
+			return statusErr
+		}
+		_, readonlyErr := volumeServerClient.VolumeMarkReadonly(context.Background(), &volume_server_pb.VolumeMarkReadonlyRequest{
+			VolumeId: uint32(volumeId),
+		})
+		wasWritable = readonlyErr == nil
+		return readonlyErr
+	})
+	return
+}
 
+// doCopyVolume asks the target volume server to copy and mount the volume, printing the copying progress.
+// With skipMount, the copied volume is not mounted, to follow the source volume with tailUnmountedVolume.
+func doCopyVolume(grpcDialOption grpc.DialOption, writer io.Writer, volumeId needle.VolumeId, sourceVolumeServer, targetVolumeServer string, diskType string, skipMount bool) (lastAppendAtNs uint64, err error) {
 	err = operation.WithVolumeServerClient(targetVolumeServer, grpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) error {
-		resp, replicateErr := volumeServerClient.VolumeCopy(context.Background(), &volume_server_pb.VolumeCopyRequest{
+		stream, replicateErr := volumeServerClient.VolumeCopy(context.Background(), &volume_server_pb.VolumeCopyRequest{
 			VolumeId:       uint32(volumeId),
 			SourceDataNode: sourceVolumeServer,
 			DiskType:       diskType,
+			SkipMount:      skipMount,
 		})
-		if replicateErr == nil {
-			lastAppendAtNs = resp.LastAppendAtNs
+		if replicateErr != nil {
+			return replicateErr
 		}
+		lastAppendAtNs, replicateErr = receiveVolumeCopy(stream, writer, volumeId)
 		return replicateErr
 	})
-
 	return
 }
 
+// receiveVolumeCopy prints the copying progress, and returns the last append timestamp of the copied volume
+func receiveVolumeCopy(stream volume_server_pb.VolumeServer_VolumeCopyClient, writer io.Writer, volumeId needle.VolumeId) (lastAppendAtNs uint64, err error) {
+	for {
+		resp, recvErr := stream.Recv()
+		if recvErr == io.EOF {
+			return lastAppendAtNs, nil
+		}
+		if recvErr != nil {
+			return 0, recvErr
+		}
+		if resp.LastAppendAtNs != 0 {
+			lastAppendAtNs = resp.LastAppendAtNs
+			continue
+		}
+		if resp.TotalBytes > 0 {
+			fmt.Fprintf(writer, "  volume %d copied %s of %s (%.1f%%)\n", volumeId,
+				util.BytesToHumanReadable(resp.ProcessedBytes), util.BytesToHumanReadable(resp.TotalBytes),
+				float64(resp.ProcessedBytes)*100/float64(resp.TotalBytes))
+		}
+	}
+}
+
 func tailVolume(grpcDialOption grpc.DialOption, volumeId needle.VolumeId, sourceVolumeServer, targetVolumeServer string, lastAppendAtNs uint64, idleTimeout time.Duration) (err error) {
 
 	return operation.WithVolumeServerClient(targetVolumeServer, grpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) error {
@@ -163,6 +272,22 @@ func tailVolume(grpcDialOption grpc.DialOption, volumeId needle.VolumeId, source
 
 }
 
+// tailUnmountedVolume asks the target volume server to apply the updates of the source volume to the copied volume not mounted yet.
+// With idleTimeout, it follows until the source volume is idle, otherwise until caught up.
+func tailUnmountedVolume(grpcDialOption grpc.DialOption, volumeId needle.VolumeId, sourceVolumeServer, targetVolumeServer string, sinceNs uint64, idleTimeout time.Duration, mount bool) (resp *volume_server_pb.VolumeTailResponse, err error) {
+	err = operation.WithVolumeServerClient(targetVolumeServer, grpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) (tailErr error) {
+		resp, tailErr = volumeServerClient.VolumeTail(context.Background(), &volume_server_pb.VolumeTailRequest{
+			VolumeId:           uint32(volumeId),
+			SinceNs:            sinceNs,
+			IdleTimeoutSeconds: uint32(idleTimeout.Seconds()),
+			SourceVolumeServer: sourceVolumeServer,
+			Mount:              mount,
+		})
+		return
+	})
+	return
+}
+
 func deleteVolume(grpcDialOption grpc.DialOption, volumeId needle.VolumeId, sourceVolumeServer string) (err error) {
 	return operation.WithVolumeServerClient(sourceVolumeServer, grpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) error {
 		_, deleteErr := volumeServerClient.VolumeDelete(context.Background(), &volume_server_pb.VolumeDeleteRequest{
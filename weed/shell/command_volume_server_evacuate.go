@@ -106,7 +106,7 @@ func evacuateNormalVolumes(commandEnv *CommandEnv, topologyInfo *master_pb.Topol
 	volumeReplicas, _ := collectVolumeReplicaLocations(topologyInfo)
 	for _, diskInfo := range thisNode.info.DiskInfos {
 		for _, vol := range diskInfo.VolumeInfos {
-			hasMoved, err := moveAwayOneNormalVolume(commandEnv, volumeReplicas, vol, thisNode, otherNodes, applyChange)
+			hasMoved, err := moveAwayOneNormalVolume(commandEnv, writer, volumeReplicas, vol, thisNode, otherNodes, applyChange)
 			if err != nil {
 				return fmt.Errorf("move away volume %d from %s: %v", vol.Id, volumeServer, err)
 			}
@@ -181,7 +181,7 @@ func moveAwayOneEcVolume(commandEnv *CommandEnv, ecShardInfo *master_pb.VolumeEc
 	return
 }
 
-func moveAwayOneNormalVolume(commandEnv *CommandEnv, volumeReplicas map[uint32][]*VolumeReplica, vol *master_pb.VolumeInformationMessage, thisNode *Node, otherNodes []*Node, applyChange bool) (hasMoved bool, err error) {
+func moveAwayOneNormalVolume(commandEnv *CommandEnv, writer io.Writer, volumeReplicas map[uint32][]*VolumeReplica, vol *master_pb.VolumeInformationMessage, thisNode *Node, otherNodes []*Node, applyChange bool) (hasMoved bool, err error) {
 	fn := capacityByFreeVolumeCount(types.ToDiskType(vol.DiskType))
 	for _, n := range otherNodes {
 		n.selectVolumes(func(v *master_pb.VolumeInformationMessage) bool {
@@ -194,7 +194,7 @@ func moveAwayOneNormalVolume(commandEnv *CommandEnv, volumeReplicas map[uint32][
 
 	for i := 0; i < len(otherNodes); i++ {
 		emptyNode := otherNodes[i]
-		hasMoved, err = maybeMoveOneVolume(commandEnv, volumeReplicas, thisNode, vol, emptyNode, applyChange)
+		hasMoved, err = maybeMoveOneVolume(commandEnv, writer, volumeReplicas, thisNode, vol, emptyNode, applyChange)
 		if err != nil {
 			return
 		}
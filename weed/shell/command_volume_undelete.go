@@ -0,0 +1,77 @@
+package shell
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+)
+
+func init() {
+	Commands = append(Commands, &commandVolumeUndelete{})
+}
+
+type commandVolumeUndelete struct {
+}
+
+func (c *commandVolumeUndelete) Name() string {
+	return "volume.undelete"
+}
+
+func (c *commandVolumeUndelete) Help() string {
+	return `undelete files on all replicas of their volumes
+
+	volume.undelete <fileId> [<fileId>...]
+
+	A deleted file can be undeleted until the volume is vacuumed.
+	Start the volume servers with -deleteGraceMinutes to keep the recently deleted files through vacuum.
+
+`
+}
+
+func (c *commandVolumeUndelete) Do(args []string, commandEnv *CommandEnv, writer io.Writer) (err error) {
+
+	undeleteCommand := flag.NewFlagSet(c.Name(), flag.ContinueOnError)
+	if err = undeleteCommand.Parse(args); err != nil {
+		return nil
+	}
+	if undeleteCommand.NArg() == 0 {
+		return fmt.Errorf("missing file ids")
+	}
+
+	for _, fid := range undeleteCommand.Args() {
+		fileId, parseErr := needle.ParseFileIdFromString(fid)
+		if parseErr != nil {
+			return fmt.Errorf("parse file id %s: %v", fid, parseErr)
+		}
+
+		locations, found := commandEnv.MasterClient.GetLocations(uint32(fileId.VolumeId))
+		if !found {
+			return fmt.Errorf("volume %d not found", fileId.VolumeId)
+		}
+
+		for _, loc := range locations {
+			err = operation.WithVolumeServerClient(loc.Url, commandEnv.option.GrpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) error {
+				resp, undeleteErr := volumeServerClient.VolumeNeedleUndelete(context.Background(), &volume_server_pb.VolumeNeedleUndeleteRequest{
+					VolumeId: uint32(fileId.VolumeId),
+					NeedleId: uint64(fileId.Key),
+					Cookie:   uint32(fileId.Cookie),
+				})
+				if undeleteErr != nil {
+					return undeleteErr
+				}
+				fmt.Fprintf(writer, "undeleted %s on %s, size %d\n", fid, loc.Url, resp.Size)
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("undelete %s on %s: %v", fid, loc.Url, err)
+			}
+		}
+	}
+
+	return nil
+}
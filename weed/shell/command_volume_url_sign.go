@@ -0,0 +1,70 @@
+package shell
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+func init() {
+	Commands = append(Commands, &commandVolumeUrlSign{})
+}
+
+type commandVolumeUrlSign struct {
+}
+
+func (c *commandVolumeUrlSign) Name() string {
+	return "volume.url.sign"
+}
+
+func (c *commandVolumeUrlSign) Help() string {
+	return `generate signed urls to read files from the public port of the volume servers
+
+	volume.url.sign [-expires=24h] <fileId> [<fileId>...]
+
+	The urls are signed by the url.signing.key in security.toml, which must be the same as the volume servers'.
+	The volume servers with url.signing.key set only serve the signed urls on the public port until the expiry.
+
+`
+}
+
+func (c *commandVolumeUrlSign) Do(args []string, commandEnv *CommandEnv, writer io.Writer) (err error) {
+
+	signCommand := flag.NewFlagSet(c.Name(), flag.ContinueOnError)
+	expires := signCommand.Duration("expires", 24*time.Hour, "the signed urls expire after this duration")
+	if err = signCommand.Parse(args); err != nil {
+		return nil
+	}
+	if signCommand.NArg() == 0 {
+		return fmt.Errorf("missing file ids")
+	}
+	signingKey := security.SigningKey(util.GetViper().GetString("url.signing.key"))
+	if len(signingKey) == 0 {
+		return fmt.Errorf("url.signing.key is not set in security.toml")
+	}
+	expiresAt := time.Now().Add(*expires)
+
+	for _, fid := range signCommand.Args() {
+		fileId, parseErr := needle.ParseFileIdFromString(fid)
+		if parseErr != nil {
+			return fmt.Errorf("parse file id %s: %v", fid, parseErr)
+		}
+
+		locations, found := commandEnv.MasterClient.GetLocations(uint32(fileId.VolumeId))
+		if !found {
+			return fmt.Errorf("volume %d not found", fileId.VolumeId)
+		}
+
+		query := security.SignFileIdUrl(signingKey, fid, expiresAt).Encode()
+		for _, loc := range locations {
+			fmt.Fprintf(writer, "http://%s/%s?%s\n", loc.PublicUrl, fid, query)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package shell
+
+import (
+	"context"
+	"io"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+)
+
+func init() {
+	Commands = append(Commands, &commandVacuumDisable{})
+}
+
+type commandVacuumDisable struct {
+}
+
+func (c *commandVacuumDisable) Name() string {
+	return "volume.vacuum.disable"
+}
+
+func (c *commandVacuumDisable) Help() string {
+	return `disable vacuuming volumes, and stop the vacuum in progress after the current volume
+
+	volume.vacuum.disable
+
+	The setting is kept in memory of the master leader, and is reset when the leader changes.
+
+`
+}
+
+func (c *commandVacuumDisable) Do(args []string, commandEnv *CommandEnv, writer io.Writer) (err error) {
+
+	if err = commandEnv.confirmIsLocked(); err != nil {
+		return
+	}
+
+	err = commandEnv.MasterClient.WithClient(func(client master_pb.SeaweedClient) error {
+		_, err = client.DisableVacuum(context.Background(), &master_pb.DisableVacuumRequest{})
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package shell
+
+import (
+	"context"
+	"io"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+)
+
+func init() {
+	Commands = append(Commands, &commandVacuumEnable{})
+}
+
+type commandVacuumEnable struct {
+}
+
+func (c *commandVacuumEnable) Name() string {
+	return "volume.vacuum.enable"
+}
+
+func (c *commandVacuumEnable) Help() string {
+	return `enable vacuuming volumes
+
+	volume.vacuum.enable
+
+`
+}
+
+func (c *commandVacuumEnable) Do(args []string, commandEnv *CommandEnv, writer io.Writer) (err error) {
+
+	if err = commandEnv.confirmIsLocked(); err != nil {
+		return
+	}
+
+	err = commandEnv.MasterClient.WithClient(func(client master_pb.SeaweedClient) error {
+		_, err = client.EnableVacuum(context.Background(), &master_pb.EnableVacuumRequest{})
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	return nil
+}
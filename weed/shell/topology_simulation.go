@@ -0,0 +1,389 @@
+package shell
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage/erasure_coding"
+	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+)
+
+// The simulation applies a hypothetical change to a copy of the topology, e.g., removing a volume server
+// for maintenance or adding a new rack, without touching the actual topology or any volume server.
+// It reports the volumes losing replicas or erasure coding shards, the copies to restore the replication,
+// and the moves to balance the volume servers, planned by the same functions as "volume.fix.replication"
+// and "volume.balance".
+
+// TopologyChange is the hypothetical change to simulate
+type TopologyChange struct {
+	// volume servers to remove, as "ip:port"
+	RemoveDataNodes []string `json:"removeDataNodes,omitempty"`
+	// racks to remove, as "dataCenter:rack", or "rack" for the rack in any data center
+	RemoveRacks []string `json:"removeRacks,omitempty"`
+	// data centers to remove
+	RemoveDataCenters []string `json:"removeDataCenters,omitempty"`
+	// volume servers to add
+	AddDataNodes []*SimulatedDataNode `json:"addDataNodes,omitempty"`
+	// only balance the volumes of this collection, "" for all collections
+	Collection string `json:"collection,omitempty"`
+}
+
+type SimulatedDataNode struct {
+	Id         string `json:"id"`
+	DataCenter string `json:"dataCenter"`
+	Rack       string `json:"rack"`
+	// the max volume count by disk type, "" for hdd. Defaults to the average of the existing volume servers.
+	MaxVolumeCounts map[string]int64 `json:"maxVolumeCounts,omitempty"`
+}
+
+type SimulatedVolume struct {
+	VolumeId    uint32 `json:"volumeId"`
+	Collection  string `json:"collection,omitempty"`
+	Replication string `json:"replication"`
+	DiskType    string `json:"diskType,omitempty"`
+	Size        uint64 `json:"size"`
+	Replicas    int    `json:"replicas"`
+	Remaining   int    `json:"remaining"`
+}
+
+type SimulatedEcVolume struct {
+	VolumeId        uint32 `json:"volumeId"`
+	Collection      string `json:"collection,omitempty"`
+	Shards          int    `json:"shards"`
+	RemainingShards int    `json:"remainingShards"`
+	// the volume can not be read any more with fewer than erasure_coding.DataShardsCount shards
+	IsLost bool `json:"isLost"`
+}
+
+type SimulatedMove struct {
+	VolumeId   uint32 `json:"volumeId"`
+	Collection string `json:"collection,omitempty"`
+	DiskType   string `json:"diskType,omitempty"`
+	Size       uint64 `json:"size"`
+	Source     string `json:"source"`
+	Target     string `json:"target"`
+}
+
+type SimulationResult struct {
+	RemovedDataNodes []string `json:"removedDataNodes"`
+	AddedDataNodes   []string `json:"addedDataNodes"`
+	// volumes with fewer replicas than their replica placement after the change
+	UnderReplicatedVolumes []*SimulatedVolume `json:"underReplicatedVolumes"`
+	// volumes with all replicas removed
+	LostVolumes []*SimulatedVolume `json:"lostVolumes"`
+	// erasure coded volumes losing shards
+	UnderProtectedEcVolumes []*SimulatedEcVolume `json:"underProtectedEcVolumes"`
+	// volume copies to restore the replica placement
+	Replications     []*SimulatedMove `json:"replications"`
+	ReplicationBytes uint64           `json:"replicationBytes"`
+	// volumes without any volume server to place the missing replicas
+	UnplaceableVolumes []*SimulatedVolume `json:"unplaceableVolumes"`
+	// volume moves to balance the volume servers after the replications
+	BalanceMoves []*SimulatedMove `json:"balanceMoves"`
+	BalanceBytes uint64           `json:"balanceBytes"`
+}
+
+// SimulateTopologyChange reports the impact of the change on the topology, without changing it
+func SimulateTopologyChange(topologyInfo *master_pb.TopologyInfo, change *TopologyChange, volumeSizeLimit uint64) (*SimulationResult, error) {
+	result := &SimulationResult{
+		RemovedDataNodes:        []string{},
+		AddedDataNodes:          []string{},
+		UnderReplicatedVolumes:  []*SimulatedVolume{},
+		LostVolumes:             []*SimulatedVolume{},
+		UnderProtectedEcVolumes: []*SimulatedEcVolume{},
+		Replications:            []*SimulatedMove{},
+		UnplaceableVolumes:      []*SimulatedVolume{},
+		BalanceMoves:            []*SimulatedMove{},
+	}
+
+	simulated := proto.Clone(topologyInfo).(*master_pb.TopologyInfo)
+	removed, err := removeSimulatedDataNodes(simulated, change)
+	if err != nil {
+		return nil, err
+	}
+	for id := range removed {
+		result.RemovedDataNodes = append(result.RemovedDataNodes, id)
+	}
+	sort.Strings(result.RemovedDataNodes)
+
+	underReplicatedVolumeIds := checkSimulatedVolumes(topologyInfo, simulated, result)
+	checkSimulatedEcVolumes(topologyInfo, removed, result)
+
+	if err := addSimulatedDataNodes(simulated, change.AddDataNodes, result); err != nil {
+		return nil, err
+	}
+
+	simulateFixReplication(simulated, underReplicatedVolumeIds, result)
+
+	collection := change.Collection
+	if collection == "" {
+		collection = "ALL_COLLECTIONS"
+	}
+	if err := simulateBalance(simulated, volumeSizeLimit, collection, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// removeSimulatedDataNodes removes the data nodes of the change from the topology, and returns the removed ones
+func removeSimulatedDataNodes(topologyInfo *master_pb.TopologyInfo, change *TopologyChange) (removed map[string]bool, err error) {
+	removed = make(map[string]bool)
+	markRemoved := func(matches func(dc, rack string, dn *master_pb.DataNodeInfo) bool) (found bool) {
+		eachDataNode(topologyInfo, func(dc string, rack RackId, dn *master_pb.DataNodeInfo) {
+			if matches(dc, string(rack), dn) {
+				removed[dn.Id], found = true, true
+			}
+		})
+		return
+	}
+
+	for _, id := range change.RemoveDataNodes {
+		if !markRemoved(func(dc, rack string, dn *master_pb.DataNodeInfo) bool { return dn.Id == id }) {
+			return nil, fmt.Errorf("volume server %s not found", id)
+		}
+	}
+	for _, rackToRemove := range change.RemoveRacks {
+		dcToRemove := ""
+		if t := strings.LastIndex(rackToRemove, ":"); t >= 0 {
+			dcToRemove, rackToRemove = rackToRemove[:t], rackToRemove[t+1:]
+		}
+		if !markRemoved(func(dc, rack string, dn *master_pb.DataNodeInfo) bool {
+			return rack == rackToRemove && (dcToRemove == "" || dc == dcToRemove)
+		}) {
+			return nil, fmt.Errorf("rack %s not found", rackToRemove)
+		}
+	}
+	for _, dcToRemove := range change.RemoveDataCenters {
+		if !markRemoved(func(dc, rack string, dn *master_pb.DataNodeInfo) bool { return dc == dcToRemove }) {
+			return nil, fmt.Errorf("data center %s not found", dcToRemove)
+		}
+	}
+
+	for _, dc := range topologyInfo.DataCenterInfos {
+		for _, rack := range dc.RackInfos {
+			var remaining []*master_pb.DataNodeInfo
+			for _, dn := range rack.DataNodeInfos {
+				if !removed[dn.Id] {
+					remaining = append(remaining, dn)
+				}
+			}
+			rack.DataNodeInfos = remaining
+		}
+	}
+	return removed, nil
+}
+
+// checkSimulatedVolumes reports the volumes losing replicas, and returns the under replicated ones
+func checkSimulatedVolumes(topologyInfo, simulated *master_pb.TopologyInfo, result *SimulationResult) (underReplicatedVolumeIds []uint32) {
+	volumeReplicas, _ := collectVolumeReplicaLocations(topologyInfo)
+	remainingReplicas, _ := collectVolumeReplicaLocations(simulated)
+
+	for _, vid := range sortedVolumeIds(volumeReplicas) {
+		replicas, remaining := volumeReplicas[vid], remainingReplicas[vid]
+		v := replicas[0].info
+		replicaPlacement, _ := super_block.NewReplicaPlacementFromByte(byte(v.ReplicaPlacement))
+		if len(remaining) >= replicaPlacement.GetCopyCount() {
+			continue
+		}
+		volume := &SimulatedVolume{
+			VolumeId:    vid,
+			Collection:  v.Collection,
+			Replication: replicaPlacement.String(),
+			DiskType:    v.DiskType,
+			Size:        v.Size,
+			Replicas:    len(replicas),
+			Remaining:   len(remaining),
+		}
+		if len(remaining) == 0 {
+			result.LostVolumes = append(result.LostVolumes, volume)
+			continue
+		}
+		result.UnderReplicatedVolumes = append(result.UnderReplicatedVolumes, volume)
+		underReplicatedVolumeIds = append(underReplicatedVolumeIds, vid)
+	}
+	return
+}
+
+func checkSimulatedEcVolumes(topologyInfo *master_pb.TopologyInfo, removed map[string]bool, result *SimulationResult) {
+	allShards, remainingShards := make(map[uint32]erasure_coding.ShardBits), make(map[uint32]erasure_coding.ShardBits)
+	collections := make(map[uint32]string)
+	eachDataNode(topologyInfo, func(dc string, rack RackId, dn *master_pb.DataNodeInfo) {
+		for _, diskInfo := range dn.DiskInfos {
+			for _, ecShardInfo := range diskInfo.EcShardInfos {
+				shardBits := erasure_coding.ShardBits(ecShardInfo.EcIndexBits)
+				allShards[ecShardInfo.Id] = allShards[ecShardInfo.Id].Plus(shardBits)
+				if !removed[dn.Id] {
+					remainingShards[ecShardInfo.Id] = remainingShards[ecShardInfo.Id].Plus(shardBits)
+				}
+				collections[ecShardInfo.Id] = ecShardInfo.Collection
+			}
+		}
+	})
+
+	var vids []uint32
+	for vid := range allShards {
+		vids = append(vids, vid)
+	}
+	sort.Slice(vids, func(i, j int) bool { return vids[i] < vids[j] })
+
+	for _, vid := range vids {
+		if remainingShards[vid] == allShards[vid] {
+			continue
+		}
+		result.UnderProtectedEcVolumes = append(result.UnderProtectedEcVolumes, &SimulatedEcVolume{
+			VolumeId:        vid,
+			Collection:      collections[vid],
+			Shards:          allShards[vid].ShardIdCount(),
+			RemainingShards: remainingShards[vid].ShardIdCount(),
+			IsLost:          remainingShards[vid].ShardIdCount() < erasure_coding.DataShardsCount,
+		})
+	}
+}
+
+func addSimulatedDataNodes(topologyInfo *master_pb.TopologyInfo, dataNodes []*SimulatedDataNode, result *SimulationResult) error {
+
+	// the average max volume counts of the existing volume servers
+	averageMaxVolumeCounts := make(map[string]int64)
+	existingDataNodes := make(map[string]bool)
+	eachDataNode(topologyInfo, func(dc string, rack RackId, dn *master_pb.DataNodeInfo) {
+		existingDataNodes[dn.Id] = true
+		for diskType, diskInfo := range dn.DiskInfos {
+			averageMaxVolumeCounts[diskType] += int64(diskInfo.MaxVolumeCount)
+		}
+	})
+	if len(existingDataNodes) > 0 {
+		for diskType := range averageMaxVolumeCounts {
+			averageMaxVolumeCounts[diskType] /= int64(len(existingDataNodes))
+		}
+	}
+
+	for _, dn := range dataNodes {
+		if dn.Id == "" || dn.DataCenter == "" || dn.Rack == "" {
+			return fmt.Errorf("volume server to add needs the id, data center and rack: %+v", dn)
+		}
+		if existingDataNodes[dn.Id] {
+			return fmt.Errorf("volume server %s already exists", dn.Id)
+		}
+		maxVolumeCounts := dn.MaxVolumeCounts
+		if len(maxVolumeCounts) == 0 {
+			maxVolumeCounts = averageMaxVolumeCounts
+		}
+		dataNodeInfo := &master_pb.DataNodeInfo{
+			Id:        dn.Id,
+			DiskInfos: make(map[string]*master_pb.DiskInfo),
+		}
+		for diskType, maxVolumeCount := range maxVolumeCounts {
+			dataNodeInfo.DiskInfos[diskType] = &master_pb.DiskInfo{
+				Type:           diskType,
+				MaxVolumeCount: uint64(maxVolumeCount),
+			}
+		}
+		rack := findOrAddSimulatedRack(topologyInfo, dn.DataCenter, dn.Rack)
+		rack.DataNodeInfos = append(rack.DataNodeInfos, dataNodeInfo)
+		existingDataNodes[dn.Id] = true
+		result.AddedDataNodes = append(result.AddedDataNodes, dn.Id)
+	}
+	return nil
+}
+
+func findOrAddSimulatedRack(topologyInfo *master_pb.TopologyInfo, dataCenter, rack string) *master_pb.RackInfo {
+	var dcInfo *master_pb.DataCenterInfo
+	for _, dc := range topologyInfo.DataCenterInfos {
+		if dc.Id == dataCenter {
+			dcInfo = dc
+		}
+	}
+	if dcInfo == nil {
+		dcInfo = &master_pb.DataCenterInfo{Id: dataCenter}
+		topologyInfo.DataCenterInfos = append(topologyInfo.DataCenterInfos, dcInfo)
+	}
+	for _, r := range dcInfo.RackInfos {
+		if r.Id == rack {
+			return r
+		}
+	}
+	rackInfo := &master_pb.RackInfo{Id: rack}
+	dcInfo.RackInfos = append(dcInfo.RackInfos, rackInfo)
+	return rackInfo
+}
+
+// simulateFixReplication places the missing replicas the same way as "volume.fix.replication"
+func simulateFixReplication(topologyInfo *master_pb.TopologyInfo, underReplicatedVolumeIds []uint32, result *SimulationResult) {
+	volumeReplicas, allLocations := collectVolumeReplicaLocations(topologyInfo)
+
+	for i, vid := range underReplicatedVolumeIds {
+		replicas := volumeReplicas[vid]
+		replica := pickOneReplicaToCopyFrom(replicas)
+		replicaPlacement, _ := super_block.NewReplicaPlacementFromByte(byte(replica.info.ReplicaPlacement))
+		for len(replicas) < replicaPlacement.GetCopyCount() {
+			dst, found := pickOneLocationToReplicate(replicaPlacement, replicas, types.ToDiskType(replica.info.DiskType), allLocations)
+			if !found {
+				result.UnplaceableVolumes = append(result.UnplaceableVolumes, result.UnderReplicatedVolumes[i])
+				break
+			}
+			diskInfo := dst.dataNode.DiskInfos[replica.info.DiskType]
+			diskInfo.VolumeInfos = append(diskInfo.VolumeInfos, replica.info)
+			diskInfo.VolumeCount++
+			replicas = append(replicas, &VolumeReplica{location: &dst, info: replica.info})
+			result.Replications = append(result.Replications, newSimulatedMove(replica.info, replica.location.dataNode.Id, dst.dataNode.Id))
+			result.ReplicationBytes += replica.info.Size
+		}
+		volumeReplicas[vid] = replicas
+	}
+}
+
+// simulateBalance plans the volume moves the same way as "volume.balance"
+func simulateBalance(topologyInfo *master_pb.TopologyInfo, volumeSizeLimit uint64, collection string, result *SimulationResult) error {
+	nodes := collectVolumeServersByDc(topologyInfo, "")
+	volumeReplicas, _ := collectVolumeReplicaLocations(topologyInfo)
+	diskTypes := collectVolumeDiskTypes(topologyInfo)
+	sort.Slice(diskTypes, func(i, j int) bool { return diskTypes[i] < diskTypes[j] })
+
+	sources := make(map[*VolumeReplica]string)
+	for _, replicas := range volumeReplicas {
+		for _, replica := range replicas {
+			sources[replica] = replica.location.dataNode.Id
+		}
+	}
+
+	// without applying the balancing, the volume servers are not contacted
+	if err := balanceVolumeServers(nil, ioutil.Discard, diskTypes, volumeReplicas, nodes, volumeSizeLimit, collection, false); err != nil {
+		return err
+	}
+
+	for _, vid := range sortedVolumeIds(volumeReplicas) {
+		for _, replica := range volumeReplicas[vid] {
+			if source, target := sources[replica], replica.location.dataNode.Id; source != target {
+				result.BalanceMoves = append(result.BalanceMoves, newSimulatedMove(replica.info, source, target))
+				result.BalanceBytes += replica.info.Size
+			}
+		}
+	}
+	return nil
+}
+
+func newSimulatedMove(v *master_pb.VolumeInformationMessage, source, target string) *SimulatedMove {
+	return &SimulatedMove{
+		VolumeId:   v.Id,
+		Collection: v.Collection,
+		DiskType:   v.DiskType,
+		Size:       v.Size,
+		Source:     source,
+		Target:     target,
+	}
+}
+
+func sortedVolumeIds(volumeReplicas map[uint32][]*VolumeReplica) (vids []uint32) {
+	for vid := range volumeReplicas {
+		vids = append(vids, vid)
+	}
+	sort.Slice(vids, func(i, j int) bool { return vids[i] < vids[j] })
+	return
+}
@@ -0,0 +1,146 @@
+package shell
+
+import (
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+)
+
+func newSimulationDataNode(id string, maxVolumeCount uint64, volumes ...*master_pb.VolumeInformationMessage) *master_pb.DataNodeInfo {
+	return &master_pb.DataNodeInfo{
+		Id: id,
+		DiskInfos: map[string]*master_pb.DiskInfo{
+			"": {
+				VolumeCount:    uint64(len(volumes)),
+				MaxVolumeCount: maxVolumeCount,
+				VolumeInfos:    volumes,
+			},
+		},
+	}
+}
+
+func newSimulationVolume(id uint32, replicaPlacement uint32, size uint64) *master_pb.VolumeInformationMessage {
+	return &master_pb.VolumeInformationMessage{
+		Id:               id,
+		Size:             size,
+		ReplicaPlacement: replicaPlacement,
+	}
+}
+
+// two racks with two volume servers each. volume 1 and 2 are replicated to the other rack, volume 3 is not replicated
+func newSimulationTopologyInfo() *master_pb.TopologyInfo {
+	n1 := newSimulationDataNode("n1:8080", 10, newSimulationVolume(1, 10, 100), newSimulationVolume(3, 0, 300))
+	n1.DiskInfos[""].EcShardInfos = []*master_pb.VolumeEcShardInformationMessage{{Id: 7, EcIndexBits: 0x7f}}
+	n3 := newSimulationDataNode("n3:8080", 10, newSimulationVolume(1, 10, 100))
+	n3.DiskInfos[""].EcShardInfos = []*master_pb.VolumeEcShardInformationMessage{{Id: 7, EcIndexBits: 0x3f80}}
+	return &master_pb.TopologyInfo{
+		DataCenterInfos: []*master_pb.DataCenterInfo{{
+			Id: "dc1",
+			RackInfos: []*master_pb.RackInfo{
+				{
+					Id: "rack1",
+					DataNodeInfos: []*master_pb.DataNodeInfo{
+						n1,
+						newSimulationDataNode("n2:8080", 10, newSimulationVolume(2, 10, 200)),
+					},
+				},
+				{
+					Id: "rack2",
+					DataNodeInfos: []*master_pb.DataNodeInfo{
+						n3,
+						newSimulationDataNode("n4:8080", 10, newSimulationVolume(2, 10, 200)),
+					},
+				},
+			},
+		}},
+	}
+}
+
+func TestSimulateRemoveDataNode(t *testing.T) {
+	result, err := SimulateTopologyChange(newSimulationTopologyInfo(), &TopologyChange{
+		RemoveDataNodes: []string{"n1:8080"},
+	}, 1000)
+	if err != nil {
+		t.Fatalf("simulate: %v", err)
+	}
+
+	if len(result.UnderReplicatedVolumes) != 1 || result.UnderReplicatedVolumes[0].VolumeId != 1 || result.UnderReplicatedVolumes[0].Remaining != 1 {
+		t.Errorf("under replicated volumes: %+v", result.UnderReplicatedVolumes)
+	}
+	if len(result.LostVolumes) != 1 || result.LostVolumes[0].VolumeId != 3 {
+		t.Errorf("lost volumes: %+v", result.LostVolumes)
+	}
+	if len(result.UnderProtectedEcVolumes) != 1 || result.UnderProtectedEcVolumes[0].RemainingShards != 7 || !result.UnderProtectedEcVolumes[0].IsLost {
+		t.Errorf("ec volumes: %+v", result.UnderProtectedEcVolumes)
+	}
+
+	// the new replica must be on the other rack than n3
+	if len(result.Replications) != 1 || result.Replications[0].Source != "n3:8080" || result.Replications[0].Target != "n2:8080" {
+		t.Errorf("replications: %+v", result.Replications)
+	}
+	if result.ReplicationBytes != 100 {
+		t.Errorf("replication bytes: %d", result.ReplicationBytes)
+	}
+}
+
+func TestSimulateRemoveRackAndAddRack(t *testing.T) {
+	result, err := SimulateTopologyChange(newSimulationTopologyInfo(), &TopologyChange{
+		RemoveRacks: []string{"dc1:rack2"},
+	}, 1000)
+	if err != nil {
+		t.Fatalf("simulate: %v", err)
+	}
+	if len(result.RemovedDataNodes) != 2 || len(result.UnderReplicatedVolumes) != 2 {
+		t.Errorf("removed %v, under replicated volumes: %+v", result.RemovedDataNodes, result.UnderReplicatedVolumes)
+	}
+	// no other rack to place the replicas
+	if len(result.UnplaceableVolumes) != 2 || len(result.Replications) != 0 {
+		t.Errorf("unplaceable volumes: %+v, replications %+v", result.UnplaceableVolumes, result.Replications)
+	}
+
+	result, err = SimulateTopologyChange(newSimulationTopologyInfo(), &TopologyChange{
+		RemoveRacks:  []string{"rack2"},
+		AddDataNodes: []*SimulatedDataNode{{Id: "n5:8080", DataCenter: "dc1", Rack: "rack3"}},
+	}, 1000)
+	if err != nil {
+		t.Fatalf("simulate: %v", err)
+	}
+	if len(result.UnplaceableVolumes) != 0 || len(result.Replications) != 2 {
+		t.Fatalf("unplaceable volumes: %+v, replications %+v", result.UnplaceableVolumes, result.Replications)
+	}
+	for _, move := range result.Replications {
+		if move.Target != "n5:8080" {
+			t.Errorf("replication to %s", move.Target)
+		}
+	}
+	if result.ReplicationBytes != 300 {
+		t.Errorf("replication bytes: %d", result.ReplicationBytes)
+	}
+}
+
+func TestSimulateBalance(t *testing.T) {
+	result, err := SimulateTopologyChange(newSimulationTopologyInfo(), &TopologyChange{
+		AddDataNodes: []*SimulatedDataNode{{Id: "n5:8080", DataCenter: "dc1", Rack: "rack1", MaxVolumeCounts: map[string]int64{"": 10}}},
+	}, 1000)
+	if err != nil {
+		t.Fatalf("simulate: %v", err)
+	}
+	if len(result.UnderReplicatedVolumes) != 0 || len(result.Replications) != 0 {
+		t.Errorf("under replicated volumes: %+v", result.UnderReplicatedVolumes)
+	}
+	// n1 has 2 volumes out of 10, above the ideal ratio 6/50
+	if len(result.BalanceMoves) != 1 || result.BalanceMoves[0].Source != "n1:8080" || result.BalanceMoves[0].Target != "n5:8080" {
+		t.Errorf("balance moves: %+v", result.BalanceMoves)
+	}
+}
+
+func TestSimulateUnknownChange(t *testing.T) {
+	if _, err := SimulateTopologyChange(newSimulationTopologyInfo(), &TopologyChange{RemoveDataNodes: []string{"n9:8080"}}, 1000); err == nil {
+		t.Errorf("expect error removing unknown volume server")
+	}
+	if _, err := SimulateTopologyChange(newSimulationTopologyInfo(), &TopologyChange{
+		AddDataNodes: []*SimulatedDataNode{{Id: "n1:8080", DataCenter: "dc1", Rack: "rack1"}},
+	}, 1000); err == nil {
+		t.Errorf("expect error adding existing volume server")
+	}
+}
@@ -52,6 +52,14 @@ var (
 			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 24),
 		}, []string{"store", "type"})
 
+	FilerStoreMetaCacheCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "filerStore",
+			Name:      "meta_cache_total",
+			Help:      "Counter of filer store metadata cache lookups.",
+		}, []string{"type", "result"})
+
 	VolumeServerRequestCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: "SeaweedFS",
@@ -109,6 +117,63 @@ var (
 			Help:      "Resource usage",
 		}, []string{"name", "type"})
 
+	VolumeServerAsyncReplicationCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "volumeServer",
+			Name:      "async_replication_total",
+			Help:      "Counter of the writes and deletes replicated asynchronously to the other data centers.",
+		}, []string{"type"})
+
+	VolumeServerAsyncReplicationQueueGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "volumeServer",
+			Name:      "async_replication_queue",
+			Help:      "Number of the writes and deletes waiting to be replicated to the replica in another data center.",
+		}, []string{"replica"})
+
+	VolumeServerNeedleRequestCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "volumeServer",
+			Name:      "needle_request_total",
+			Help:      "Counter of needle reads, writes and deletes by collection and disk.",
+		}, []string{"collection", "disk", "type", "result"})
+
+	VolumeServerNeedleBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "volumeServer",
+			Name:      "needle_bytes_total",
+			Help:      "Counter of needle bytes read, written and deleted by collection and disk.",
+		}, []string{"collection", "disk", "type"})
+
+	VolumeServerNeedleRequestHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "volumeServer",
+			Name:      "needle_request_seconds",
+			Help:      "Bucketed histogram of needle read, write and delete time by collection and disk.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 24),
+		}, []string{"collection", "disk", "type"})
+
+	VolumeServerIndexMemoryGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "volumeServer",
+			Name:      "index_memory_bytes",
+			Help:      "Memory used by the needle maps of the volumes, and the memory budget.",
+		}, []string{"type"})
+
+	VolumeServerQuarantinedVolumeCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "volumeServer",
+			Name:      "quarantined_volumes_total",
+			Help:      "Counter of volumes quarantined for colliding with the volumes of the same ids registered elsewhere.",
+		}, []string{"collection"})
+
 	S3RequestCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: "SeaweedFS",
@@ -124,6 +189,72 @@ var (
 			Help:      "Bucketed histogram of s3 request processing time.",
 			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 24),
 		}, []string{"type"})
+	S3OperationCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "s3",
+			Name:      "operation_total",
+			Help:      "Counter of s3 API operations by http status and s3 error code.",
+		}, []string{"operation", "bucket", "code", "error"})
+	S3OperationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "s3",
+			Name:      "operation_seconds",
+			Help:      "Bucketed histogram of s3 API operation latency.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 24),
+		}, []string{"operation", "bucket"})
+	S3OperationBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "s3",
+			Name:      "operation_bytes",
+			Help:      "Counter of s3 API operation request and response body bytes.",
+		}, []string{"operation", "bucket", "direction"})
+
+	S3ReplicationCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "s3",
+			Name:      "replication_total",
+			Help:      "Counter of s3 bucket replication operations.",
+		}, []string{"bucket", "type"})
+	S3ReplicationBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "s3",
+			Name:      "replication_bytes",
+			Help:      "Counter of s3 bucket replicated bytes.",
+		}, []string{"bucket"})
+	S3ReplicationLatencyGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "s3",
+			Name:      "replication_latency_seconds",
+			Help:      "Seconds from the object change to its replication, of the last replicated object.",
+		}, []string{"bucket"})
+
+	ReplicationCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "replication",
+			Name:      "events_total",
+			Help:      "Counter of filer.replicate events by the sinks.",
+		}, []string{"sink", "type"})
+	ReplicationQueueGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "replication",
+			Name:      "queue_length",
+			Help:      "Number of filer.replicate events waiting for the sink.",
+		}, []string{"sink"})
+	ReplicationLagGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "replication",
+			Name:      "lag_seconds",
+			Help:      "Seconds from the metadata event to its replication, of the last event replicated to the sink.",
+		}, []string{"sink"})
 )
 
 func init() {
@@ -131,6 +262,7 @@ func init() {
 	Gather.MustRegister(FilerRequestHistogram)
 	Gather.MustRegister(FilerStoreCounter)
 	Gather.MustRegister(FilerStoreHistogram)
+	Gather.MustRegister(FilerStoreMetaCacheCounter)
 	Gather.MustRegister(collectors.NewGoCollector())
 	Gather.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 
@@ -141,9 +273,25 @@ func init() {
 	Gather.MustRegister(VolumeServerReadOnlyVolumeGauge)
 	Gather.MustRegister(VolumeServerDiskSizeGauge)
 	Gather.MustRegister(VolumeServerResourceGauge)
+	Gather.MustRegister(VolumeServerAsyncReplicationCounter)
+	Gather.MustRegister(VolumeServerAsyncReplicationQueueGauge)
+	Gather.MustRegister(VolumeServerNeedleRequestCounter)
+	Gather.MustRegister(VolumeServerNeedleBytesCounter)
+	Gather.MustRegister(VolumeServerNeedleRequestHistogram)
+	Gather.MustRegister(VolumeServerIndexMemoryGauge)
+	Gather.MustRegister(VolumeServerQuarantinedVolumeCounter)
 
 	Gather.MustRegister(S3RequestCounter)
 	Gather.MustRegister(S3RequestHistogram)
+	Gather.MustRegister(S3OperationCounter)
+	Gather.MustRegister(S3OperationHistogram)
+	Gather.MustRegister(S3OperationBytesCounter)
+	Gather.MustRegister(S3ReplicationCounter)
+	Gather.MustRegister(S3ReplicationBytesCounter)
+	Gather.MustRegister(S3ReplicationLatencyGauge)
+	Gather.MustRegister(ReplicationCounter)
+	Gather.MustRegister(ReplicationQueueGauge)
+	Gather.MustRegister(ReplicationLagGauge)
 }
 
 func LoopPushingMetric(name, instance, addr string, intervalSeconds int) {
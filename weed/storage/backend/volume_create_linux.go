@@ -5,18 +5,82 @@ package backend
 import (
 	"os"
 	"syscall"
+	"unsafe"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
 )
 
-func CreateVolumeFile(fileName string, preallocate int64, memoryMapSizeMB uint32) (BackendStorageFile, error) {
+func CreateVolumeFile(fileName string, preallocation Preallocation, memoryMapSizeMB uint32) (BackendStorageFile, error) {
 	file, e := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if e != nil {
 		return nil, e
 	}
-	if preallocate != 0 {
-		syscall.Fallocate(int(file.Fd()), 1, 0, preallocate)
-		glog.V(1).Infof("Preallocated %d bytes disk space for %s", preallocate, fileName)
+	if preallocation.ExtentSize > 0 {
+		// only effective on the empty file
+		if err := setExtentSizeHint(file, preallocation.ExtentSize); err != nil {
+			glog.V(1).Infof("set extent size hint %d for %s: %v", preallocation.ExtentSize, fileName, err)
+		}
+	}
+	size := preallocation.AlignedSize()
+	if size <= 0 {
+		return NewDiskFile(file), nil
+	}
+	switch preallocation.Strategy {
+	case PreallocateSparse:
+	case PreallocateBackground:
+		// the duplicated fd stays valid even if the volume file is closed in the meantime
+		fd, err := syscall.Dup(int(file.Fd()))
+		if err != nil {
+			glog.V(0).Infof("preallocate %s in background: %v", fileName, err)
+			break
+		}
+		go func() {
+			defer syscall.Close(fd)
+			fallocate(fd, fileName, size)
+		}()
+	default:
+		fallocate(int(file.Fd()), fileName, size)
 	}
 	return NewDiskFile(file), nil
 }
+
+func fallocate(fd int, fileName string, size int64) {
+	// keep the file size, which is where the next needle is appended
+	if err := syscall.Fallocate(fd, 1, 0, size); err != nil {
+		glog.V(0).Infof("preallocate %d bytes disk space for %s: %v", size, fileName, err)
+		return
+	}
+	glog.V(1).Infof("Preallocated %d bytes disk space for %s", size, fileName)
+}
+
+// fsxattr is struct fsxattr in linux/fs.h
+type fsxattr struct {
+	xflags     uint32
+	extsize    uint32
+	nextents   uint32
+	projid     uint32
+	cowextsize uint32
+	pad        [8]byte
+}
+
+const (
+	// _IOR('X', 31, struct fsxattr) and _IOW('X', 32, struct fsxattr), in the generic ioctl encoding
+	fsIocFsGetXattr = 0x801c581f
+	fsIocFsSetXattr = 0x401c5820
+	fsXflagExtsize  = 0x800
+)
+
+// setExtentSizeHint asks XFS to allocate the file in the extents of the size.
+// The other filesystems do not support it, and return an error.
+func setExtentSizeHint(file *os.File, extentSize int64) error {
+	var attr fsxattr
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), fsIocFsGetXattr, uintptr(unsafe.Pointer(&attr))); errno != 0 {
+		return errno
+	}
+	attr.xflags |= fsXflagExtsize
+	attr.extsize = uint32(extentSize)
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), fsIocFsSetXattr, uintptr(unsafe.Pointer(&attr))); errno != 0 {
+		return errno
+	}
+	return nil
+}
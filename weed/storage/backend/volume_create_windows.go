@@ -10,8 +10,8 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/storage/backend/memory_map/os_overloads"
 )
 
-func CreateVolumeFile(fileName string, preallocate int64, memoryMapSizeMB uint32) (BackendStorageFile, error) {
-	if preallocate > 0 {
+func CreateVolumeFile(fileName string, preallocation Preallocation, memoryMapSizeMB uint32) (BackendStorageFile, error) {
+	if preallocation.Size > 0 {
 		glog.V(0).Infof("Preallocated disk space for %s is not supported", fileName)
 	}
 
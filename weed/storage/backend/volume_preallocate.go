@@ -0,0 +1,44 @@
+package backend
+
+import (
+	"fmt"
+)
+
+// PreallocateStrategy is how the disk space of a new volume file is reserved
+type PreallocateStrategy string
+
+const (
+	// PreallocateFallocate reserves the disk space when the volume file is created
+	PreallocateFallocate PreallocateStrategy = "fallocate"
+	// PreallocateBackground reserves the disk space after the volume file is created, without delaying the volume creation
+	PreallocateBackground PreallocateStrategy = "background"
+	// PreallocateSparse does not reserve the disk space, and the volume file grows with the writes
+	PreallocateSparse PreallocateStrategy = "sparse"
+)
+
+func ParsePreallocateStrategy(strategy string) (PreallocateStrategy, error) {
+	switch s := PreallocateStrategy(strategy); s {
+	case "":
+		return PreallocateFallocate, nil
+	case PreallocateFallocate, PreallocateBackground, PreallocateSparse:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown preallocate strategy %q, expecting fallocate, background or sparse", strategy)
+}
+
+// Preallocation is how to reserve the disk space of a new volume file
+type Preallocation struct {
+	Strategy PreallocateStrategy // empty for PreallocateFallocate
+	Size     int64               // bytes to reserve, 0 to not reserve
+	// the allocation unit for the large extent filesystems, 0 for the filesystem default.
+	// The reserved size is rounded up to it, and it is the extent size hint on XFS.
+	ExtentSize int64
+}
+
+// AlignedSize is the size to reserve, rounded up to the extent size
+func (p Preallocation) AlignedSize() int64 {
+	if p.Size <= 0 || p.ExtentSize <= 0 || p.Size%p.ExtentSize == 0 {
+		return p.Size
+	}
+	return (p.Size/p.ExtentSize + 1) * p.ExtentSize
+}
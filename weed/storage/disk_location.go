@@ -8,10 +8,12 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/storage/backend"
 	"github.com/chrislusf/seaweedfs/weed/storage/erasure_coding"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/util"
@@ -51,7 +53,6 @@ func NewDiskLocation(dir string, maxVolumeCount int, minFreeSpace util.MinFreeSp
 	}
 	location.volumes = make(map[needle.VolumeId]*Volume)
 	location.ecVolumes = make(map[needle.VolumeId]*erasure_coding.EcVolume)
-	go location.CheckDiskSpace()
 	return location
 }
 
@@ -85,7 +86,7 @@ func getValidVolumeName(basename string) string {
 	return ""
 }
 
-func (l *DiskLocation) loadExistingVolume(fileInfo os.FileInfo, needleMapKind NeedleMapKind) bool {
+func (l *DiskLocation) loadExistingVolume(fileInfo os.FileInfo, needleMapKind NeedleMapKind, checkLevel VolumeCheckLevel) bool {
 	basename := fileInfo.Name()
 	if fileInfo.IsDir() {
 		return false
@@ -122,7 +123,7 @@ func (l *DiskLocation) loadExistingVolume(fileInfo os.FileInfo, needleMapKind Ne
 	}
 
 	// load the volume
-	v, e := NewVolume(l.Directory, l.IdxDirectory, collection, vid, needleMapKind, nil, nil, 0, 0)
+	v, e := newVolume(l.Directory, l.IdxDirectory, collection, vid, needleMapKind, checkLevel, nil, nil, needle.ChecksumCrc32c, needle.CurrentVersion, backend.Preallocation{}, 0)
 	if e != nil {
 		glog.V(0).Infof("new volume %s error %s", volumeName, e)
 		return false
@@ -136,44 +137,68 @@ func (l *DiskLocation) loadExistingVolume(fileInfo os.FileInfo, needleMapKind Ne
 	return true
 }
 
-func (l *DiskLocation) concurrentLoadingVolumes(needleMapKind NeedleMapKind, concurrency int) {
+func (l *DiskLocation) concurrentLoadingVolumes(needleMapKind NeedleMapKind, checkLevel VolumeCheckLevel, concurrency int) {
+
+	var volumeFileInfos []os.FileInfo
+	foundVolumeNames := make(map[string]bool)
+	if fileInfos, err := ioutil.ReadDir(l.Directory); err == nil {
+		for _, fi := range fileInfos {
+			volumeName := getValidVolumeName(fi.Name())
+			if volumeName == "" {
+				continue
+			}
+			if _, found := foundVolumeNames[volumeName]; !found {
+				foundVolumeNames[volumeName] = true
+				volumeFileInfos = append(volumeFileInfos, fi)
+			}
+		}
+	}
 
 	task_queue := make(chan os.FileInfo, 10*concurrency)
 	go func() {
-		foundVolumeNames := make(map[string]bool)
-		if fileInfos, err := ioutil.ReadDir(l.Directory); err == nil {
-			for _, fi := range fileInfos {
-				volumeName := getValidVolumeName(fi.Name())
-				if volumeName == "" {
-					continue
-				}
-				if _, found := foundVolumeNames[volumeName]; !found {
-					foundVolumeNames[volumeName] = true
-					task_queue <- fi
-				}
-			}
+		for _, fi := range volumeFileInfos {
+			task_queue <- fi
 		}
 		close(task_queue)
 	}()
 
+	// log the progress of slow loading, e.g., with many volumes or -check=full
+	var loadedCount int64
+	progressDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				glog.V(0).Infof("dir %s loading volumes: %d of %d, check %s", l.Directory, atomic.LoadInt64(&loadedCount), len(volumeFileInfos), checkLevel)
+			case <-progressDone:
+				return
+			}
+		}
+	}()
+
 	var wg sync.WaitGroup
 	for workerNum := 0; workerNum < concurrency; workerNum++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for fi := range task_queue {
-				_ = l.loadExistingVolume(fi, needleMapKind)
+				_ = l.loadExistingVolume(fi, needleMapKind, checkLevel)
+				atomic.AddInt64(&loadedCount, 1)
 			}
 		}()
 	}
 	wg.Wait()
+	close(progressDone)
 
 }
 
-func (l *DiskLocation) loadExistingVolumes(needleMapKind NeedleMapKind) {
+func (l *DiskLocation) loadExistingVolumes(needleMapKind NeedleMapKind, checkLevel VolumeCheckLevel) {
 
-	l.concurrentLoadingVolumes(needleMapKind, 10)
-	glog.V(0).Infof("Store started on dir: %s with %d volumes max %d", l.Directory, len(l.volumes), l.MaxVolumeCount)
+	startTime := time.Now()
+	l.concurrentLoadingVolumes(needleMapKind, checkLevel, 10)
+	glog.V(0).Infof("Store started on dir: %s with %d volumes max %d, check %s in %v", l.Directory, len(l.volumes), l.MaxVolumeCount, checkLevel, time.Since(startTime))
 
 	l.loadAllEcShards()
 	glog.V(0).Infof("Store started on dir: %s with %d ec shards", l.Directory, len(l.ecVolumes))
@@ -242,7 +267,7 @@ func (l *DiskLocation) deleteVolumeById(vid needle.VolumeId) (found bool, e erro
 
 func (l *DiskLocation) LoadVolume(vid needle.VolumeId, needleMapKind NeedleMapKind) bool {
 	if fileInfo, found := l.LocateVolume(vid); found {
-		return l.loadExistingVolume(fileInfo, needleMapKind)
+		return l.loadExistingVolume(fileInfo, needleMapKind, VolumeCheckIndex)
 	}
 	return false
 }
@@ -354,7 +379,9 @@ func (l *DiskLocation) UnUsedSpace(volumeSizeLimit uint64) (unUsedSpace uint64)
 	return
 }
 
-func (l *DiskLocation) CheckDiskSpace() {
+// CheckDiskSpace checks the free space every minute.
+// The volumes are read only when the free space is low, and the change is signaled to diskSpaceLowChanged.
+func (l *DiskLocation) CheckDiskSpace(diskSpaceLowChanged chan bool) {
 	for {
 		if dir, e := filepath.Abs(l.Directory); e == nil {
 			s := stats.NewDiskStatus(dir)
@@ -365,6 +392,11 @@ func (l *DiskLocation) CheckDiskSpace() {
 			isLow, desc := l.MinFreeSpace.IsLow(s.Free, s.PercentFree)
 			if isLow != l.isDiskSpaceLow {
 				l.isDiskSpaceLow = !l.isDiskSpaceLow
+				glog.V(0).Infof("dir %s volumes are %s: %s", dir, util.IfElse(l.isDiskSpaceLow, "read only", "writable"), desc)
+				select {
+				case diskSpaceLowChanged <- true:
+				default:
+				}
 			}
 
 			logLevel := glog.Level(4)
@@ -34,6 +34,7 @@ type EcVolume struct {
 	ShardLocationsRefreshTime time.Time
 	ShardLocationsLock        sync.RWMutex
 	Version                   needle.Version
+	ChecksumAlgorithm         needle.ChecksumAlgorithm
 	ecjFile                   *os.File
 	ecjFileAccessLock         sync.Mutex
 	diskType                  types.DiskType
@@ -45,6 +46,23 @@ func NewEcVolume(diskType types.DiskType, dir string, dirIdx string, collection
 	dataBaseFileName := EcShardFileName(collection, dir, int(vid))
 	indexBaseFileName := EcShardFileName(collection, dirIdx, int(vid))
 
+	// read volume info
+	ev.Version = needle.Version3
+	if volumeInfo, _, found, _ := pb.MaybeLoadVolumeInfo(dataBaseFileName + ".vif"); found {
+		ev.Version = needle.Version(volumeInfo.Version)
+		ev.ChecksumAlgorithm = needle.ChecksumAlgorithm(volumeInfo.ChecksumAlgorithm)
+		if volumeInfo.OffsetSize != 0 && volumeInfo.OffsetSize != types.OffsetSize {
+			// the .ecx file was generated by a build with a different offset size
+			if err = idx.ConvertIndexFile(indexBaseFileName+".ecx", int(volumeInfo.OffsetSize)); err != nil {
+				return nil, fmt.Errorf("convert ec volume index %s.ecx: %v", indexBaseFileName, err)
+			}
+			volumeInfo.OffsetSize = types.OffsetSize
+			pb.SaveVolumeInfo(dataBaseFileName+".vif", volumeInfo)
+		}
+	} else {
+		pb.SaveVolumeInfo(dataBaseFileName+".vif", &volume_server_pb.VolumeInfo{Version: uint32(ev.Version), OffsetSize: types.OffsetSize})
+	}
+
 	// open ecx file
 	if ev.ecxFile, err = os.OpenFile(indexBaseFileName+".ecx", os.O_RDWR, 0644); err != nil {
 		return nil, fmt.Errorf("cannot open ec volume index %s.ecx: %v", indexBaseFileName, err)
@@ -61,14 +79,6 @@ func NewEcVolume(diskType types.DiskType, dir string, dirIdx string, collection
 		return nil, fmt.Errorf("cannot open ec volume journal %s.ecj: %v", indexBaseFileName, err)
 	}
 
-	// read volume info
-	ev.Version = needle.Version3
-	if volumeInfo, _, found, _ := pb.MaybeLoadVolumeInfo(dataBaseFileName + ".vif"); found {
-		ev.Version = needle.Version(volumeInfo.Version)
-	} else {
-		pb.SaveVolumeInfo(dataBaseFileName+".vif", &volume_server_pb.VolumeInfo{Version: uint32(ev.Version)})
-	}
-
 	ev.ShardLocations = make(map[ShardId][]string)
 
 	return
@@ -0,0 +1,84 @@
+package idx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// ConvertIndexFile rewrites an index file written with fromOffsetSize bytes offsets
+// into the offset size of this build. The entries keep the same order,
+// so sorted .ecx files stay sorted.
+func ConvertIndexFile(fileName string, fromOffsetSize int) error {
+	if fromOffsetSize < 4 || fromOffsetSize > 8 {
+		return fmt.Errorf("unsupported offset size %d", fromOffsetSize)
+	}
+	fromEntrySize := types.NeedleIdSize + fromOffsetSize + types.SizeSize
+
+	src, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size()%int64(fromEntrySize) != 0 {
+		return fmt.Errorf("%s size %d is not a multiple of the %d bytes offset entry size %d", fileName, stat.Size(), fromOffsetSize, fromEntrySize)
+	}
+
+	tmpFileName := fileName + ".cvt"
+	dst, err := os.OpenFile(tmpFileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFileName)
+
+	reader := bufio.NewReaderSize(src, fromEntrySize*RowsToRead)
+	writer := bufio.NewWriterSize(dst, types.NeedleMapEntrySize*RowsToRead)
+	fromEntry := make([]byte, fromEntrySize)
+	toEntry := make([]byte, types.NeedleMapEntrySize)
+	offsetBits := uint(8 * types.OffsetSize)
+	for {
+		if _, err = io.ReadFull(reader, fromEntry); err == io.EOF {
+			break
+		} else if err != nil {
+			dst.Close()
+			return fmt.Errorf("read %s: %v", fileName, err)
+		}
+		offsetBytes := fromEntry[types.NeedleIdSize : types.NeedleIdSize+fromOffsetSize]
+		// the lower 4 bytes are big endian, followed by the higher bytes
+		offset := uint64(util.BytesToUint32(offsetBytes[0:4]))
+		for i, b := range offsetBytes[4:] {
+			offset += uint64(b) << (32 + 8*uint(i))
+		}
+		if offsetBits < 64 && offset>>offsetBits != 0 {
+			dst.Close()
+			return fmt.Errorf("offset %d in %s exceeds %d bytes offset", offset*types.NeedlePaddingSize, fileName, types.OffsetSize)
+		}
+		copy(toEntry[0:types.NeedleIdSize], fromEntry[0:types.NeedleIdSize])
+		types.OffsetToBytes(toEntry[types.NeedleIdSize:types.NeedleIdSize+types.OffsetSize], types.ToOffset(int64(offset*types.NeedlePaddingSize)))
+		copy(toEntry[types.NeedleIdSize+types.OffsetSize:], fromEntry[types.NeedleIdSize+fromOffsetSize:])
+		if _, err = writer.Write(toEntry); err != nil {
+			dst.Close()
+			return fmt.Errorf("write %s: %v", tmpFileName, err)
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		dst.Close()
+		return fmt.Errorf("write %s: %v", tmpFileName, err)
+	}
+	if err = dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFileName, fileName)
+}
@@ -2,9 +2,13 @@ package needle
 
 import (
 	"fmt"
+	"hash"
 	"io"
+	"strings"
 
+	"github.com/cespare/xxhash"
 	"github.com/klauspost/crc32"
+	"golang.org/x/sys/cpu"
 
 	"github.com/chrislusf/seaweedfs/weed/util"
 )
@@ -25,12 +29,65 @@ func (c CRC) Value() uint32 {
 	return uint32(c>>15|c<<17) + 0xa282ead8
 }
 
+// crcFromValue is the reverse of CRC.Value()
+func crcFromValue(value uint32) CRC {
+	c := value - 0xa282ead8
+	return CRC(c<<15 | c>>17)
+}
+
 func (n *Needle) Etag() string {
 	bits := make([]byte, 4)
 	util.Uint32toBytes(bits, uint32(n.Checksum))
 	return fmt.Sprintf("%x", bits)
 }
 
+// ChecksumAlgorithm is how the needle checksums of a volume are calculated.
+// It is recorded in the volume super block.
+type ChecksumAlgorithm uint32
+
+const (
+	ChecksumCrc32c ChecksumAlgorithm = iota // hardware accelerated with SSE4.2 or ARMv8 CRC32 instructions
+	ChecksumXxHash                          // the lower 32 bits of the 64 bit xxHash, fast without hardware support
+)
+
+func ParseChecksumAlgorithm(name string) (ChecksumAlgorithm, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return DefaultChecksumAlgorithm(), nil
+	case "crc32c":
+		return ChecksumCrc32c, nil
+	case "xxhash":
+		return ChecksumXxHash, nil
+	}
+	return ChecksumCrc32c, fmt.Errorf("unknown checksum algorithm %s, expecting crc32c or xxhash", name)
+}
+
+// DefaultChecksumAlgorithm is CRC32C if this cpu calculates it in hardware, otherwise xxHash.
+func DefaultChecksumAlgorithm() ChecksumAlgorithm {
+	if cpu.X86.HasSSE42 || cpu.ARM64.HasCRC32 {
+		return ChecksumCrc32c
+	}
+	return ChecksumXxHash
+}
+
+func (a ChecksumAlgorithm) String() string {
+	switch a {
+	case ChecksumCrc32c:
+		return "crc32c"
+	case ChecksumXxHash:
+		return "xxhash"
+	}
+	return fmt.Sprintf("unknown(%d)", uint32(a))
+}
+
+// Checksum calculates the needle checksum of the data
+func (a ChecksumAlgorithm) Checksum(b []byte) CRC {
+	if a == ChecksumXxHash {
+		return CRC(xxhash.Sum64(b))
+	}
+	return NewCRC(b)
+}
+
 func NewCRCwriter(w io.Writer) *CRCwriter {
 
 	return &CRCwriter{
@@ -52,3 +109,55 @@ func (c *CRCwriter) Write(p []byte) (n int, err error) {
 }
 
 func (c *CRCwriter) Sum() uint32 { return c.crc.Value() } // final hash
+
+// ChecksumWriter calculates the needle checksum of the data written through it
+type ChecksumWriter interface {
+	io.Writer
+	Sum() uint32
+}
+
+func NewChecksumWriter(w io.Writer, algorithm ChecksumAlgorithm) ChecksumWriter {
+	if algorithm == ChecksumXxHash {
+		return &xxHashWriter{
+			h: xxhash.New(),
+			w: w,
+		}
+	}
+	return NewCRCwriter(w)
+}
+
+type xxHashWriter struct {
+	h hash.Hash64
+	w io.Writer
+}
+
+func (x *xxHashWriter) Write(p []byte) (n int, err error) {
+	n, err = x.w.Write(p)
+	x.h.Write(p)
+	return
+}
+
+func (x *xxHashWriter) Sum() uint32 { return CRC(x.h.Sum64()).Value() }
+
+// NewChecksum calculates the needle checksum of the data written in pieces, as the Sum32 of the hash,
+// the same as ChecksumAlgorithm.Checksum of the whole data
+func NewChecksum(algorithm ChecksumAlgorithm) hash.Hash32 {
+	if algorithm == ChecksumXxHash {
+		return &xxHash32{xxhash.New()}
+	}
+	return crc32.New(table)
+}
+
+// xxHash32 is the lower 32 bits of the 64 bit xxHash
+type xxHash32 struct {
+	hash.Hash64
+}
+
+func (x *xxHash32) Size() int { return 4 }
+
+func (x *xxHash32) Sum32() uint32 { return uint32(x.Sum64()) }
+
+func (x *xxHash32) Sum(b []byte) []byte {
+	s := x.Sum32()
+	return append(b, byte(s>>24), byte(s>>16), byte(s>>8), byte(s))
+}
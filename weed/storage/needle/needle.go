@@ -36,10 +36,12 @@ type Needle struct {
 	Mime         []byte `comment:"maximum 256 characters"` //version2
 	PairsSize    uint16 //version2
 	Pairs        []byte `comment:"additional name value pairs, json format, maximum 64kB"`
+	MetadataSize uint16 //version4
+	Metadata     []byte `comment:"user tags and checksum info, key value block, maximum 64kB"` //version4
 	LastModified uint64 //only store LastModifiedBytesLength bytes, which is 5 bytes to disk
 	Ttl          *TTL
 
-	Checksum   CRC    `comment:"CRC32 to check integrity"`
+	Checksum   CRC    `comment:"CRC32C or xxHash to check integrity"`
 	AppendAtNs uint64 `comment:"append timestamp in nano seconds"` //version3
 	Padding    []byte `comment:"Aligned to 8 bytes"`
 }
@@ -82,6 +84,9 @@ func CreateNeedleFromRequest(r *http.Request, fixJpgOrientation bool, sizeLimit
 			n.SetHasPairs()
 		}
 	}
+	if e = n.SetMetadata(pu.MetadataMap); e != nil {
+		return
+	}
 	if pu.IsGzipped {
 		// println(r.URL.Path, "is set to compressed", pu.FileName, pu.IsGzipped, "dataSize", pu.OriginalDataSize)
 		n.SetIsCompressed()
@@ -105,8 +110,6 @@ func CreateNeedleFromRequest(r *http.Request, fixJpgOrientation bool, sizeLimit
 		}
 	}
 
-	n.Checksum = NewCRC(n.Data)
-
 	commaSep := strings.LastIndex(r.URL.Path, ",")
 	dotSep := strings.LastIndex(r.URL.Path, ".")
 	fid := r.URL.Path[commaSep+1:]
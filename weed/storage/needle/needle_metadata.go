@@ -0,0 +1,109 @@
+package needle
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+const (
+	// MetadataNamePrefix is the http header prefix for the needle metadata block entries
+	MetadataNamePrefix = "X-Seaweed-Meta-"
+
+	// well known metadata keys, so that volume level tools can verify the original content
+	MetadataChecksumAlgorithm = "Checksum-Algorithm"
+	MetadataChecksum          = "Checksum"
+)
+
+// EncodeNeedleMetadata encodes the key value pairs into the needle metadata block.
+// Each entry is stored as 1 byte key length, key, 2 bytes value length, value.
+func EncodeNeedleMetadata(metadata map[string]string) ([]byte, error) {
+	var keys []string
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var block []byte
+	for _, k := range keys {
+		v := metadata[k]
+		if len(k) == 0 || len(k) > math.MaxUint8 {
+			return nil, fmt.Errorf("invalid metadata key length %d", len(k))
+		}
+		if len(v) > math.MaxUint16 {
+			return nil, fmt.Errorf("metadata %s value length %d exceeds %d", k, len(v), math.MaxUint16)
+		}
+		entry := make([]byte, 1+len(k)+2+len(v))
+		entry[0] = uint8(len(k))
+		copy(entry[1:], k)
+		util.Uint16toBytes(entry[1+len(k):3+len(k)], uint16(len(v)))
+		copy(entry[3+len(k):], v)
+		block = append(block, entry...)
+	}
+	if len(block) > math.MaxUint16 {
+		return nil, fmt.Errorf("metadata size %d exceeds %d", len(block), math.MaxUint16)
+	}
+	return block, nil
+}
+
+// DecodeNeedleMetadata decodes the needle metadata block into key value pairs.
+func DecodeNeedleMetadata(block []byte) (map[string]string, error) {
+	metadata := make(map[string]string)
+	index := 0
+	for index < len(block) {
+		keyLength := int(block[index])
+		index++
+		if index+keyLength+2 > len(block) {
+			return metadata, fmt.Errorf("metadata key out of range at %d", index)
+		}
+		key := string(block[index : index+keyLength])
+		index += keyLength
+		valueLength := int(util.BytesToUint16(block[index : index+2]))
+		index += 2
+		if index+valueLength > len(block) {
+			return metadata, fmt.Errorf("metadata %s value out of range at %d", key, index)
+		}
+		metadata[key] = string(block[index : index+valueLength])
+		index += valueLength
+	}
+	return metadata, nil
+}
+
+// SetMetadata stores the key value pairs in the needle metadata block.
+// The block is only written to volumes of Version4 or later.
+func (n *Needle) SetMetadata(metadata map[string]string) error {
+	if len(metadata) == 0 {
+		return nil
+	}
+	block, err := EncodeNeedleMetadata(metadata)
+	if err != nil {
+		return err
+	}
+	n.Metadata = block
+	n.MetadataSize = uint16(len(block))
+	n.SetHasMetadata()
+	return nil
+}
+
+// GetMetadata returns the key value pairs of the needle metadata block, if any.
+func (n *Needle) GetMetadata() (map[string]string, error) {
+	if !n.HasMetadata() {
+		return nil, nil
+	}
+	return DecodeNeedleMetadata(n.Metadata)
+}
+
+// parseMetadataHeaders collects the metadata entries from the http headers, with the prefix removed.
+func parseMetadataHeaders(header http.Header) map[string]string {
+	metadata := make(map[string]string)
+	for k, v := range header {
+		if len(v) > 0 && strings.HasPrefix(k, MetadataNamePrefix) && len(k) > len(MetadataNamePrefix) {
+			metadata[k[len(MetadataNamePrefix):]] = v[0]
+		}
+	}
+	return metadata
+}
@@ -3,7 +3,9 @@ package needle
 import (
 	"bytes"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -24,6 +26,7 @@ type ParsedUpload struct {
 	bytesBuffer *bytes.Buffer
 	MimeType    string
 	PairMap     map[string]string
+	MetadataMap map[string]string
 	IsGzipped   bool
 	// IsZstd           bool
 	OriginalDataSize int
@@ -43,6 +46,7 @@ func ParseUpload(r *http.Request, sizeLimit int64, bytesBuffer *bytes.Buffer) (p
 			pu.PairMap[k] = v[0]
 		}
 	}
+	pu.MetadataMap = parseMetadataHeaders(r.Header)
 
 	if r.Method == "POST" {
 		e = parseMultipart(r, sizeLimit, pu)
@@ -100,9 +104,28 @@ func ParseUpload(r *http.Request, sizeLimit int64, bytesBuffer *bytes.Buffer) (p
 		}
 	}
 
+	// sha256
+	if expectedSha256 := AmzContentSha256(r.Header); expectedSha256 != "" {
+		h := sha256.Sum256(pu.UncompressedData)
+		if actualSha256 := hex.EncodeToString(h[:]); expectedSha256 != actualSha256 {
+			e = fmt.Errorf("X-Amz-Content-Sha256 did not match sha256 of file data expected [%s] received [%s] size %d", expectedSha256, actualSha256, len(pu.UncompressedData))
+			return
+		}
+	}
+
 	return
 }
 
+// AmzContentSha256 returns the hex encoded sha256 of the "X-Amz-Content-Sha256" header,
+// or empty if the header is not a sha256, e.g., "UNSIGNED-PAYLOAD" or "STREAMING-AWS4-HMAC-SHA256-PAYLOAD".
+func AmzContentSha256(h http.Header) string {
+	sha256Hex := strings.ToLower(h.Get("X-Amz-Content-Sha256"))
+	if decoded, err := hex.DecodeString(sha256Hex); err != nil || len(decoded) != sha256.Size {
+		return ""
+	}
+	return sha256Hex
+}
+
 func parsePut(r *http.Request, sizeLimit int64, pu *ParsedUpload) error {
 	pu.IsGzipped = r.Header.Get("Content-Encoding") == "gzip"
 	// pu.IsZstd = r.Header.Get("Content-Encoding") == "zstd"
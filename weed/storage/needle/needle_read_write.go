@@ -20,12 +20,15 @@ const (
 	FlagHasLastModifiedDate = 0x08
 	FlagHasTtl              = 0x10
 	FlagHasPairs            = 0x20
+	FlagHasMetadata         = 0x40
 	FlagIsChunkManifest     = 0x80
 	LastModifiedBytesLength = 5
 	TtlBytesLength          = 2
+	DataSizeBytesLength     = 4
 )
 
 var ErrorSizeMismatch = errors.New("size mismatch")
+var ErrorCRC = errors.New("CRC error! Data On Disk Corrupted")
 
 func (n *Needle) DiskSize(version Version) int64 {
 	return GetActualSize(n.Size, version)
@@ -54,7 +57,7 @@ func (n *Needle) prepareWriteBuffer(version Version, writeBytes *bytes.Buffer) (
 		util.Uint32toBytes(header[0:NeedleChecksumSize], n.Checksum.Value())
 		writeBytes.Write(header[0 : NeedleChecksumSize+padding])
 		return size, actualSize, nil
-	case Version2, Version3:
+	case Version2, Version3, Version4:
 		header := make([]byte, NeedleHeaderSize+TimestampSize) // adding timestamp to reuse it and avoid extra allocation
 		CookieToBytes(header[0:CookieSize], n.Cookie)
 		NeedleIdToBytes(header[CookieSize:CookieSize+NeedleIdSize], n.Id)
@@ -64,6 +67,11 @@ func (n *Needle) prepareWriteBuffer(version Version, writeBytes *bytes.Buffer) (
 			n.NameSize = uint8(len(n.Name))
 		}
 		n.DataSize, n.MimeSize = uint32(len(n.Data)), uint8(len(n.Mime))
+		flags := n.Flags
+		if version < Version4 {
+			// the metadata block is not readable by older versions
+			flags = flags &^ FlagHasMetadata
+		}
 		if n.DataSize > 0 {
 			n.Size = 4 + Size(n.DataSize) + 1
 			if n.HasName() {
@@ -81,6 +89,9 @@ func (n *Needle) prepareWriteBuffer(version Version, writeBytes *bytes.Buffer) (
 			if n.HasPairs() {
 				n.Size += 2 + Size(n.PairsSize)
 			}
+			if flags&FlagHasMetadata != 0 {
+				n.Size += 2 + Size(n.MetadataSize)
+			}
 		} else {
 			n.Size = 0
 		}
@@ -90,7 +101,7 @@ func (n *Needle) prepareWriteBuffer(version Version, writeBytes *bytes.Buffer) (
 			util.Uint32toBytes(header[0:4], n.DataSize)
 			writeBytes.Write(header[0:4])
 			writeBytes.Write(n.Data)
-			util.Uint8toBytes(header[0:1], n.Flags)
+			util.Uint8toBytes(header[0:1], flags)
 			writeBytes.Write(header[0:1])
 			if n.HasName() {
 				util.Uint8toBytes(header[0:1], n.NameSize)
@@ -115,13 +126,18 @@ func (n *Needle) prepareWriteBuffer(version Version, writeBytes *bytes.Buffer) (
 				writeBytes.Write(header[0:2])
 				writeBytes.Write(n.Pairs)
 			}
+			if flags&FlagHasMetadata != 0 {
+				util.Uint16toBytes(header[0:2], n.MetadataSize)
+				writeBytes.Write(header[0:2])
+				writeBytes.Write(n.Metadata)
+			}
 		}
 		padding := PaddingLength(n.Size, version)
 		util.Uint32toBytes(header[0:NeedleChecksumSize], n.Checksum.Value())
 		if version == Version2 {
 			writeBytes.Write(header[0 : NeedleChecksumSize+padding])
 		} else {
-			// version3
+			// version3 and version4
 			util.Uint64toBytes(header[NeedleChecksumSize:NeedleChecksumSize+TimestampSize], n.AppendAtNs)
 			writeBytes.Write(header[0 : NeedleChecksumSize+TimestampSize+padding])
 		}
@@ -180,7 +196,7 @@ func WriteNeedleBlob(w backend.BackendStorageFile, dataSlice []byte, size Size,
 		return
 	}
 
-	if version == Version3 {
+	if version >= Version3 {
 		tsOffset := NeedleHeaderSize + size + NeedleChecksumSize
 		util.Uint64toBytes(dataSlice[tsOffset:tsOffset+TimestampSize], appendAtNs)
 	}
@@ -212,7 +228,7 @@ func ReadNeedleBlob(r backend.BackendStorageFile, offset int64, size Size, versi
 }
 
 // ReadBytes hydrates the needle from the bytes buffer, with only n.Id is set.
-func (n *Needle) ReadBytes(bytes []byte, offset int64, size Size, version Version) (err error) {
+func (n *Needle) ReadBytes(bytes []byte, offset int64, size Size, version Version, checksumAlgorithm ChecksumAlgorithm) (err error) {
 	n.ParseNeedleHeader(bytes)
 	if n.Size != size {
 		// cookie is not always passed in for this API. Use size to do preliminary checking.
@@ -225,7 +241,7 @@ func (n *Needle) ReadBytes(bytes []byte, offset int64, size Size, version Versio
 	switch version {
 	case Version1:
 		n.Data = bytes[NeedleHeaderSize : NeedleHeaderSize+size]
-	case Version2, Version3:
+	case Version2, Version3, Version4:
 		err = n.readNeedleDataVersion2(bytes[NeedleHeaderSize : NeedleHeaderSize+int(n.Size)])
 	}
 	if err != nil && err != io.EOF {
@@ -233,26 +249,81 @@ func (n *Needle) ReadBytes(bytes []byte, offset int64, size Size, version Versio
 	}
 	if size > 0 {
 		checksum := util.BytesToUint32(bytes[NeedleHeaderSize+size : NeedleHeaderSize+size+NeedleChecksumSize])
-		newChecksum := NewCRC(n.Data)
+		newChecksum := checksumAlgorithm.Checksum(n.Data)
 		if checksum != newChecksum.Value() {
-			return errors.New("CRC error! Data On Disk Corrupted")
+			return ErrorCRC
 		}
 		n.Checksum = newChecksum
 	}
-	if version == Version3 {
+	if version >= Version3 {
 		tsOffset := NeedleHeaderSize + size + NeedleChecksumSize
 		n.AppendAtNs = util.BytesToUint64(bytes[tsOffset : tsOffset+TimestampSize])
 	}
 	return nil
 }
 
+// ReadNeedleMeta hydrates the needle from the file without the data, with only n.Id is set,
+// e.g., to answer the HEAD requests. The checksum is kept as stored, and not verified.
+func (n *Needle) ReadNeedleMeta(r backend.BackendStorageFile, offset int64, size Size, version Version) (err error) {
+	header := make([]byte, NeedleHeaderSize+DataSizeBytesLength)
+	if _, err = r.ReadAt(header, offset); err != nil && err != io.EOF {
+		return err
+	}
+	n.ParseNeedleHeader(header)
+	if n.Size != size {
+		if OffsetSize == 4 && offset < int64(MaxPossibleVolumeSize) {
+			return ErrorSizeMismatch
+		}
+		return fmt.Errorf("entry not found: offset %d found id %x size %d, expected size %d", offset, n.Id, n.Size, size)
+	}
+
+	// skip the data, and read the fields after it, the checksum, and the append timestamp
+	var metaSize int64
+	switch version {
+	case Version1:
+		n.DataSize = uint32(size)
+	case Version2, Version3, Version4:
+		if size > 0 {
+			n.DataSize = util.BytesToUint32(header[NeedleHeaderSize : NeedleHeaderSize+DataSizeBytesLength])
+			metaSize = int64(size) - DataSizeBytesLength - int64(n.DataSize)
+		}
+	default:
+		return fmt.Errorf("unsupported version %d!", version)
+	}
+	if metaSize < 0 {
+		return fmt.Errorf("needle %x data size %d exceeds needle size %d", n.Id, n.DataSize, size)
+	}
+	tailSize := metaSize + NeedleChecksumSize
+	if version >= Version3 {
+		tailSize += TimestampSize
+	}
+	tail := make([]byte, tailSize)
+	if _, err = r.ReadAt(tail, offset+NeedleHeaderSize+int64(size)-metaSize); err != nil && err != io.EOF {
+		return err
+	}
+
+	if metaSize > 0 {
+		if err = n.readNeedleMetaVersion2(tail[:metaSize]); err != nil {
+			return err
+		}
+	}
+	if size > 0 {
+		n.Checksum = crcFromValue(util.BytesToUint32(tail[metaSize : metaSize+NeedleChecksumSize]))
+	}
+	if version >= Version3 {
+		tsOffset := metaSize + NeedleChecksumSize
+		n.AppendAtNs = util.BytesToUint64(tail[tsOffset : tsOffset+TimestampSize])
+	}
+	return nil
+}
+
 // ReadData hydrates the needle from the file, with only n.Id is set.
-func (n *Needle) ReadData(r backend.BackendStorageFile, offset int64, size Size, version Version) (err error) {
+func (n *Needle) ReadData(r backend.BackendStorageFile, offset int64, size Size, version Version, checksumAlgorithm ChecksumAlgorithm) (err error) {
 	bytes, err := ReadNeedleBlob(r, offset, size, version)
 	if err != nil {
 		return err
 	}
-	return n.ReadBytes(bytes, offset, size, version)
+	return n.ReadBytes(bytes, offset, size, version, checksumAlgorithm)
 }
 
 func (n *Needle) ParseNeedleHeader(bytes []byte) {
@@ -271,9 +342,19 @@ func (n *Needle) readNeedleDataVersion2(bytes []byte) (err error) {
 		}
 		n.Data = bytes[index : index+int(n.DataSize)]
 		index = index + int(n.DataSize)
-		n.Flags = bytes[index]
-		index = index + 1
+		return n.readNeedleMetaVersion2(bytes[index:])
 	}
+	return nil
+}
+
+// readNeedleMetaVersion2 parses the flags and the optional fields following the data
+func (n *Needle) readNeedleMetaVersion2(bytes []byte) (err error) {
+	index, lenBytes := 0, len(bytes)
+	if index >= lenBytes {
+		return fmt.Errorf("index out of range %d", 1)
+	}
+	n.Flags = bytes[index]
+	index = index + 1
 	if index < lenBytes && n.HasName() {
 		n.NameSize = uint8(bytes[index])
 		index = index + 1
@@ -319,12 +400,25 @@ func (n *Needle) readNeedleDataVersion2(bytes []byte) (err error) {
 		n.Pairs = bytes[index:end]
 		index = end
 	}
+	if index < lenBytes && n.HasMetadata() {
+		if 2+index > lenBytes {
+			return fmt.Errorf("index out of range %d", 8)
+		}
+		n.MetadataSize = util.BytesToUint16(bytes[index : index+2])
+		index += 2
+		if int(n.MetadataSize)+index > lenBytes {
+			return fmt.Errorf("index out of range %d", 9)
+		}
+		end := index + int(n.MetadataSize)
+		n.Metadata = bytes[index:end]
+		index = end
+	}
 	return nil
 }
 
 func ReadNeedleHeader(r backend.BackendStorageFile, version Version, offset int64) (n *Needle, bytes []byte, bodyLength int64, err error) {
 	n = new(Needle)
-	if version == Version1 || version == Version2 || version == Version3 {
+	if version == Version1 || version == Version2 || version == Version3 || version == Version4 {
 		bytes = make([]byte, NeedleHeaderSize)
 
 		var count int
@@ -341,7 +435,7 @@ func ReadNeedleHeader(r backend.BackendStorageFile, version Version, offset int6
 }
 
 func PaddingLength(needleSize Size, version Version) Size {
-	if version == Version3 {
+	if version >= Version3 {
 		// this is same value as version2, but just listed here for clarity
 		return NeedlePaddingSize - ((NeedleHeaderSize + needleSize + NeedleChecksumSize + TimestampSize) % NeedlePaddingSize)
 	}
@@ -349,7 +443,7 @@ func PaddingLength(needleSize Size, version Version) Size {
 }
 
 func NeedleBodyLength(needleSize Size, version Version) int64 {
-	if version == Version3 {
+	if version >= Version3 {
 		return int64(needleSize) + NeedleChecksumSize + TimestampSize + int64(PaddingLength(needleSize, version))
 	}
 	return int64(needleSize) + NeedleChecksumSize + int64(PaddingLength(needleSize, version))
@@ -377,15 +471,16 @@ func (n *Needle) ReadNeedleBodyBytes(needleBody []byte, version Version) (err er
 	if len(needleBody) <= 0 {
 		return nil
 	}
+	// the checksum is not verified, and is kept as is
 	switch version {
 	case Version1:
 		n.Data = needleBody[:n.Size]
-		n.Checksum = NewCRC(n.Data)
-	case Version2, Version3:
+		n.Checksum = crcFromValue(util.BytesToUint32(needleBody[n.Size : n.Size+NeedleChecksumSize]))
+	case Version2, Version3, Version4:
 		err = n.readNeedleDataVersion2(needleBody[0:n.Size])
-		n.Checksum = NewCRC(n.Data)
+		n.Checksum = crcFromValue(util.BytesToUint32(needleBody[n.Size : n.Size+NeedleChecksumSize]))
 
-		if version == Version3 {
+		if version >= Version3 {
 			tsOffset := n.Size + NeedleChecksumSize
 			n.AppendAtNs = util.BytesToUint64(needleBody[tsOffset : tsOffset+TimestampSize])
 		}
@@ -442,6 +537,14 @@ func (n *Needle) SetHasPairs() {
 	n.Flags = n.Flags | FlagHasPairs
 }
 
+func (n *Needle) HasMetadata() bool {
+	return n.Flags&FlagHasMetadata != 0
+}
+
+func (n *Needle) SetHasMetadata() {
+	n.Flags = n.Flags | FlagHasMetadata
+}
+
 func GetActualSize(size Size, version Version) int64 {
 	return NeedleHeaderSize + NeedleBodyLength(size, version)
 }
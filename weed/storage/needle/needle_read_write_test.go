@@ -1,8 +1,10 @@
 package needle
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/chrislusf/seaweedfs/weed/storage/backend"
@@ -63,3 +65,111 @@ func TestAppend(t *testing.T) {
 		t.Errorf("Fail to Append Needle.")
 	}
 }
+
+func TestNeedleMetadataReadWrite(t *testing.T) {
+	metadata := map[string]string{
+		"Owner":                   "alice",
+		MetadataChecksumAlgorithm: "sha256",
+		MetadataChecksum:          "e3b0c44298fc1c149afbf4c8996fb924",
+	}
+
+	for _, version := range []Version{Version3, Version4} {
+		n := &Needle{
+			Cookie: types.Cookie(123),
+			Id:     types.NeedleId(456),
+			Data:   []byte("abcdefg"),
+		}
+		if err := n.SetMetadata(metadata); err != nil {
+			t.Fatalf("set metadata: %v", err)
+		}
+		n.Checksum = NewCRC(n.Data)
+
+		buf := new(bytes.Buffer)
+		if _, _, err := n.prepareWriteBuffer(version, buf); err != nil {
+			t.Fatalf("version %d prepare write buffer: %v", version, err)
+		}
+		if int64(buf.Len()) != GetActualSize(n.Size, version) {
+			t.Fatalf("version %d written %d bytes, expected %d", version, buf.Len(), GetActualSize(n.Size, version))
+		}
+
+		readNeedle := new(Needle)
+		if err := readNeedle.ReadBytes(buf.Bytes(), 0, n.Size, version, ChecksumCrc32c); err != nil {
+			t.Fatalf("version %d read bytes: %v", version, err)
+		}
+		if string(readNeedle.Data) != "abcdefg" {
+			t.Errorf("version %d unexpected data %s", version, readNeedle.Data)
+		}
+		readMetadata, err := readNeedle.GetMetadata()
+		if err != nil {
+			t.Fatalf("version %d get metadata: %v", version, err)
+		}
+		if version < Version4 {
+			if len(readMetadata) != 0 {
+				t.Errorf("version %d should not store metadata: %v", version, readMetadata)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(readMetadata, metadata) {
+			t.Errorf("version %d metadata %v, expected %v", version, readMetadata, metadata)
+		}
+	}
+}
+
+func TestReadNeedleMeta(t *testing.T) {
+	for _, version := range []Version{Version1, Version2, Version3, Version4} {
+		tempFile, err := ioutil.TempFile("", ".dat")
+		if err != nil {
+			t.Fatalf("temp file: %v", err)
+		}
+		datBackend := backend.NewDiskFile(tempFile)
+
+		ttl, _ := ReadTTL("3d")
+		n := &Needle{
+			Cookie:       types.Cookie(123),
+			Id:           types.NeedleId(456),
+			Data:         []byte("some file content"),
+			Name:         []byte("a.txt"),
+			Mime:         []byte("text/plain"),
+			LastModified: 1600000000,
+			Ttl:          ttl,
+			AppendAtNs:   1600000000000000000,
+		}
+		n.SetHasName()
+		n.SetHasMime()
+		n.SetHasLastModifiedDate()
+		n.SetHasTtl()
+		n.Checksum = NewCRC(n.Data)
+		offset, _, _, err := n.Append(datBackend, version)
+		size := n.Size
+		if err != nil {
+			t.Fatalf("version %d append: %v", version, err)
+		}
+
+		meta := new(Needle)
+		if err = meta.ReadNeedleMeta(datBackend, int64(offset), size, version); err != nil {
+			t.Fatalf("version %d read meta: %v", version, err)
+		}
+		full := new(Needle)
+		if err = full.ReadData(datBackend, int64(offset), size, version, ChecksumCrc32c); err != nil {
+			t.Fatalf("version %d read data: %v", version, err)
+		}
+		datBackend.Close()
+		os.Remove(tempFile.Name())
+
+		if meta.Data != nil {
+			t.Errorf("version %d read data %s", version, meta.Data)
+		}
+		if meta.DataSize != uint32(len(full.Data)) {
+			t.Errorf("version %d data size %d, expected %d", version, meta.DataSize, len(full.Data))
+		}
+		if meta.Checksum != full.Checksum || meta.AppendAtNs != full.AppendAtNs || meta.Cookie != full.Cookie {
+			t.Errorf("version %d read meta %+v, expected %+v", version, meta, full)
+		}
+		if version == Version1 {
+			continue
+		}
+		if string(meta.Name) != "a.txt" || string(meta.Mime) != "text/plain" || meta.LastModified != 1600000000 || meta.Ttl.String() != "3d" {
+			t.Errorf("version %d read meta %+v", version, meta)
+		}
+	}
+}
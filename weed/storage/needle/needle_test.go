@@ -47,3 +47,15 @@ func BenchmarkParseKeyHash(b *testing.B) {
 		ParseNeedleIdCookie("4ed44ed44ed44ed4c8116e41")
 	}
 }
+
+func TestNewChecksum(t *testing.T) {
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	for _, algorithm := range []ChecksumAlgorithm{ChecksumCrc32c, ChecksumXxHash} {
+		h := NewChecksum(algorithm)
+		h.Write(data[:10])
+		h.Write(data[10:])
+		if h.Sum32() != uint32(algorithm.Checksum(data)) {
+			t.Errorf("%s: %x, expected %x", algorithm, h.Sum32(), uint32(algorithm.Checksum(data)))
+		}
+	}
+}
@@ -1,10 +1,26 @@
 package needle
 
+import "fmt"
+
 type Version uint8
 
 const (
-	Version1       = Version(1)
-	Version2       = Version(2)
-	Version3       = Version(3)
+	Version1 = Version(1)
+	Version2 = Version(2)
+	Version3 = Version(3)
+	// Version4 is the same as Version3, with the optional needle metadata block.
+	// It is only created if requested, since the volume servers of earlier releases can not read it.
+	Version4       = Version(4)
 	CurrentVersion = Version3
 )
+
+// ParseVolumeVersion parses the version of the new volumes, 0 for CurrentVersion
+func ParseVolumeVersion(version uint) (Version, error) {
+	switch Version(version) {
+	case 0:
+		return CurrentVersion, nil
+	case Version3, Version4:
+		return Version(version), nil
+	}
+	return CurrentVersion, fmt.Errorf("unsupported volume version %d, expecting 3 or 4", version)
+}
@@ -17,6 +17,7 @@ const (
 	NeedleMapLevelDb                     // small memory footprint, 4MB total, 1 write buffer, 3 block buffer
 	NeedleMapLevelDbMedium               // medium memory footprint, 8MB total, 3 write buffer, 5 block buffer
 	NeedleMapLevelDbLarge                // large memory footprint, 12MB total, 4write buffer, 8 block buffer
+	NeedleMapBoltDb                      // on-disk b+tree, memory footprint is mostly the OS page cache
 )
 
 type NeedleMapper interface {
@@ -33,6 +34,7 @@ type NeedleMapper interface {
 	IndexFileSize() uint64
 	Sync() error
 	ReadIndexEntry(n int64) (key NeedleId, offset Offset, size Size, err error)
+	MemorySize() uint64
 }
 
 type baseNeedleMapper struct {
@@ -63,6 +65,11 @@ func (nm *baseNeedleMapper) appendToIndexFile(key NeedleId, offset Offset, size
 	return err
 }
 
+// MemorySize is the estimated memory used by the needle map, excluding the OS page cache
+func (nm *baseNeedleMapper) MemorySize() uint64 {
+	return 0
+}
+
 func (nm *baseNeedleMapper) Sync() error {
 	return nm.indexFile.Sync()
 }
@@ -3,6 +3,7 @@ package needle_map
 import (
 	"sort"
 	"sync"
+	"unsafe"
 
 	. "github.com/chrislusf/seaweedfs/weed/storage/types"
 )
@@ -262,6 +263,20 @@ func (cm *CompactMap) binarySearchCompactSection(key NeedleId) int {
 	return -3
 }
 
+// MemorySize estimates the memory used by the allocated sections
+func (cm *CompactMap) MemorySize() (size uint64) {
+	valueSize := uint64(unsafe.Sizeof(SectionalNeedleValue{}))
+	valueExtraSize := uint64(unsafe.Sizeof(SectionalNeedleValueExtra{}))
+	for _, cs := range cm.list {
+		cs.RLock()
+		size += uint64(unsafe.Sizeof(*cs))
+		size += uint64(cap(cs.values)+cap(cs.overflow)) * valueSize
+		size += uint64(cap(cs.valuesExtra)+cap(cs.overflowExtra)) * valueExtraSize
+		cs.RUnlock()
+	}
+	return
+}
+
 // Visit visits all entries or stop if any error when visiting
 func (cm *CompactMap) AscendingVisit(visit func(NeedleValue) error) error {
 	for _, cs := range cm.list {
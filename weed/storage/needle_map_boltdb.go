@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/storage/idx"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle_map"
+	. "github.com/chrislusf/seaweedfs/weed/storage/types"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+var (
+	boltDbNeedleBucket     = []byte("needles")
+	boltDbMetaBucket       = []byte("meta")
+	boltDbIndexFileOffset  = []byte("indexFileOffset")
+	boltDbCatchUpBatchSize = 100000
+)
+
+// BoltDbNeedleMap keeps the needle index in an on-disk b+tree,
+// so only the pages being accessed are in memory.
+// The .idx file is still written first. The b+tree remembers the .idx file offset it has applied,
+// and catches up with the .idx file when opened.
+type BoltDbNeedleMap struct {
+	baseNeedleMapper
+	dbFileName string
+	db         *bolt.DB
+}
+
+func NewBoltDbNeedleMap(dbFileName string, indexFile *os.File) (m *BoltDbNeedleMap, err error) {
+	m = &BoltDbNeedleMap{dbFileName: dbFileName}
+	m.indexFile = indexFile
+	if stat, err := indexFile.Stat(); err != nil {
+		glog.Fatalf("stat file %s: %v", indexFile.Name(), err)
+	} else {
+		m.indexFileOffset = stat.Size()
+	}
+	glog.V(1).Infof("Opening %s...", dbFileName)
+	if m.db, err = openBoltDb(dbFileName); err != nil {
+		glog.Warningf("open %s: %v, generating it from %s", dbFileName, err, indexFile.Name())
+		os.Remove(dbFileName)
+		if m.db, err = openBoltDb(dbFileName); err != nil {
+			return nil, err
+		}
+	}
+	if err = m.catchUpIndexFile(); err != nil {
+		m.db.Close()
+		return nil, fmt.Errorf("update %s from %s: %v", dbFileName, indexFile.Name(), err)
+	}
+	glog.V(1).Infof("Loading %s...", indexFile.Name())
+	mm, indexLoadError := newNeedleMapMetricFromIndexFile(indexFile)
+	if indexLoadError != nil {
+		m.db.Close()
+		return nil, indexLoadError
+	}
+	m.mapMetric = *mm
+	return
+}
+
+func openBoltDb(dbFileName string) (*bolt.DB, error) {
+	db, err := bolt.Open(dbFileName, 0644, &bolt.Options{Timeout: time.Second, NoFreelistSync: true})
+	if err != nil {
+		return nil, err
+	}
+	// the .idx file is synced instead, and is replayed if the b+tree is behind
+	db.NoSync = true
+	if err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(boltDbNeedleBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(boltDbMetaBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// catchUpIndexFile applies the .idx file entries after the last applied offset
+func (m *BoltDbNeedleMap) catchUpIndexFile() error {
+	var appliedOffset int64
+	m.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(boltDbMetaBucket).Get(boltDbIndexFileOffset); len(data) == 8 {
+			appliedOffset = int64(util.BytesToUint64(data))
+		}
+		return nil
+	})
+	if appliedOffset == m.indexFileOffset {
+		return nil
+	}
+	if appliedOffset > m.indexFileOffset {
+		// the .idx file has been replaced, e.g., by compaction
+		glog.V(0).Infof("regenerating %s from %s", m.dbFileName, m.indexFile.Name())
+		if err := m.db.Update(func(tx *bolt.Tx) error {
+			if err := tx.DeleteBucket(boltDbNeedleBucket); err != nil {
+				return err
+			}
+			_, err := tx.CreateBucket(boltDbNeedleBucket)
+			return err
+		}); err != nil {
+			return err
+		}
+		appliedOffset = 0
+	}
+	glog.V(1).Infof("updating %s from %s offset %d to %d", m.dbFileName, m.indexFile.Name(), appliedOffset, m.indexFileOffset)
+
+	var batch []needle_map.NeedleValue
+	flush := func(offset int64) error {
+		err := m.db.Update(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket(boltDbNeedleBucket)
+			for _, nv := range batch {
+				if !nv.Offset.IsZero() && nv.Size.IsValid() {
+					if err := boltDbWrite(bucket, nv.Key, nv.Offset, nv.Size); err != nil {
+						return err
+					}
+				} else if err := boltDbDelete(bucket, nv.Key); err != nil {
+					return err
+				}
+			}
+			return boltDbSetIndexFileOffset(tx, offset)
+		})
+		batch = batch[:0]
+		return err
+	}
+	reader := io.NewSectionReader(m.indexFile, appliedOffset, m.indexFileOffset-appliedOffset)
+	walked := appliedOffset
+	if err := idx.WalkIndexFile(reader, func(key NeedleId, offset Offset, size Size) error {
+		batch = append(batch, needle_map.NeedleValue{Key: key, Offset: offset, Size: size})
+		walked += NeedleMapEntrySize
+		if len(batch) >= boltDbCatchUpBatchSize {
+			return flush(walked)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return flush(walked)
+}
+
+func (m *BoltDbNeedleMap) Get(key NeedleId) (element *needle_map.NeedleValue, ok bool) {
+	bytes := make([]byte, NeedleIdSize)
+	NeedleIdToBytes(bytes, key)
+	m.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltDbNeedleBucket).Get(bytes)
+		if len(data) != OffsetSize+SizeSize {
+			return nil
+		}
+		offset := BytesToOffset(data[0:OffsetSize])
+		size := BytesToSize(data[OffsetSize : OffsetSize+SizeSize])
+		element, ok = &needle_map.NeedleValue{Key: key, Offset: offset, Size: size}, true
+		return nil
+	})
+	return
+}
+
+func (m *BoltDbNeedleMap) Put(key NeedleId, offset Offset, size Size) error {
+	var oldSize Size
+	if oldNeedle, ok := m.Get(key); ok {
+		oldSize = oldNeedle.Size
+	}
+	m.logPut(key, oldSize, size)
+	// write to index file first
+	if err := m.appendToIndexFile(key, offset, size); err != nil {
+		return fmt.Errorf("cannot write to indexfile %s: %v", m.indexFile.Name(), err)
+	}
+	return m.db.Update(func(tx *bolt.Tx) error {
+		if err := boltDbWrite(tx.Bucket(boltDbNeedleBucket), key, offset, size); err != nil {
+			return err
+		}
+		return boltDbSetIndexFileOffset(tx, m.indexFileOffset)
+	})
+}
+
+func (m *BoltDbNeedleMap) Delete(key NeedleId, offset Offset) error {
+	oldNeedle, found := m.Get(key)
+	if !found || oldNeedle.Size.IsDeleted() {
+		return nil
+	}
+	m.logDelete(oldNeedle.Size)
+
+	// write to index file first
+	if err := m.appendToIndexFile(key, offset, TombstoneFileSize); err != nil {
+		return err
+	}
+
+	return m.db.Update(func(tx *bolt.Tx) error {
+		if err := boltDbWrite(tx.Bucket(boltDbNeedleBucket), key, oldNeedle.Offset, -oldNeedle.Size); err != nil {
+			return err
+		}
+		return boltDbSetIndexFileOffset(tx, m.indexFileOffset)
+	})
+}
+
+func boltDbWrite(bucket *bolt.Bucket, key NeedleId, offset Offset, size Size) error {
+	bytes := needle_map.ToBytes(key, offset, size)
+	if err := bucket.Put(bytes[0:NeedleIdSize], bytes[NeedleIdSize:NeedleIdSize+OffsetSize+SizeSize]); err != nil {
+		return fmt.Errorf("failed to write boltdb: %v", err)
+	}
+	return nil
+}
+
+func boltDbDelete(bucket *bolt.Bucket, key NeedleId) error {
+	bytes := make([]byte, NeedleIdSize)
+	NeedleIdToBytes(bytes, key)
+	return bucket.Delete(bytes)
+}
+
+func boltDbSetIndexFileOffset(tx *bolt.Tx, offset int64) error {
+	bytes := make([]byte, 8)
+	util.Uint64toBytes(bytes, uint64(offset))
+	return tx.Bucket(boltDbMetaBucket).Put(boltDbIndexFileOffset, bytes)
+}
+
+func (m *BoltDbNeedleMap) Sync() error {
+	if err := m.indexFile.Sync(); err != nil {
+		return err
+	}
+	return m.db.Sync()
+}
+
+func (m *BoltDbNeedleMap) Close() {
+	indexFileName := m.indexFile.Name()
+	if err := m.indexFile.Sync(); err != nil {
+		glog.Warningf("sync file %s failed: %v", indexFileName, err)
+	}
+	if err := m.indexFile.Close(); err != nil {
+		glog.Warningf("close index file %s failed: %v", indexFileName, err)
+	}
+
+	if m.db != nil {
+		if err := m.db.Sync(); err != nil {
+			glog.Warningf("sync boltdb %s failed: %v", m.dbFileName, err)
+		}
+		if err := m.db.Close(); err != nil {
+			glog.Warningf("close boltdb %s failed: %v", m.dbFileName, err)
+		}
+	}
+}
+
+func (m *BoltDbNeedleMap) Destroy() error {
+	m.Close()
+	os.Remove(m.indexFile.Name())
+	return os.Remove(m.dbFileName)
+}
@@ -21,10 +21,11 @@ type LevelDbNeedleMap struct {
 	baseNeedleMapper
 	dbFileName string
 	db         *leveldb.DB
+	opts       *opt.Options
 }
 
 func NewLevelDbNeedleMap(dbFileName string, indexFile *os.File, opts *opt.Options) (m *LevelDbNeedleMap, err error) {
-	m = &LevelDbNeedleMap{dbFileName: dbFileName}
+	m = &LevelDbNeedleMap{dbFileName: dbFileName, opts: opts}
 	m.indexFile = indexFile
 	if !isLevelDbFresh(dbFileName, indexFile) {
 		glog.V(1).Infof("Start to Generate %s from %s", dbFileName, indexFile.Name())
@@ -143,6 +144,14 @@ func (m *LevelDbNeedleMap) Delete(key NeedleId, offset Offset) error {
 	return levelDbWrite(m.db, key, oldNeedle.Offset, -oldNeedle.Size)
 }
 
+// MemorySize is the configured block cache and write buffer sizes
+func (m *LevelDbNeedleMap) MemorySize() uint64 {
+	if m.opts == nil {
+		return uint64(opt.DefaultBlockCacheCapacity + opt.DefaultWriteBuffer)
+	}
+	return uint64(m.opts.GetBlockCacheCapacity() + m.opts.GetWriteBuffer())
+}
+
 func (m *LevelDbNeedleMap) Close() {
 	indexFileName := m.indexFile.Name()
 	if err := m.indexFile.Sync(); err != nil {
@@ -68,6 +68,12 @@ func (nm *NeedleMap) Delete(key NeedleId, offset Offset) error {
 	nm.logDelete(deletedBytes)
 	return nm.appendToIndexFile(key, offset, TombstoneFileSize)
 }
+func (nm *NeedleMap) MemorySize() uint64 {
+	if cm, ok := nm.m.(*needle_map.CompactMap); ok {
+		return cm.MemorySize()
+	}
+	return 0
+}
 func (nm *NeedleMap) Close() {
 	indexFileName := nm.indexFile.Name()
 	if err := nm.indexFile.Sync(); err != nil {
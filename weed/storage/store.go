@@ -5,7 +5,9 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/util"
 	"path/filepath"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"google.golang.org/grpc"
 
@@ -25,6 +27,8 @@ const (
 
 type ReadOption struct {
 	ReadDeleted bool
+	// read the needle without the data, which is not verified by the checksum
+	MetaOnly bool
 }
 
 /*
@@ -44,9 +48,17 @@ type Store struct {
 	NeedleMapKind       NeedleMapKind
 	NewVolumesChan      chan master_pb.VolumeShortInformationMessage
 	DeletedVolumesChan  chan master_pb.VolumeShortInformationMessage
+	UpdatedVolumesChan  chan *master_pb.VolumeInformationMessage
 	NewEcShardsChan     chan master_pb.VolumeEcShardInformationMessage
 	DeletedEcShardsChan chan master_pb.VolumeEcShardInformationMessage
+	DiskSpaceLowChanged chan bool // to send the read only changes to the master without waiting for the next heartbeat
 	isStopping          bool
+	IndexMemoryBudget   uint64 // the memory for the needle maps of all the volumes, 0 for no limit
+	demotedVolumeCount  int64
+	preallocation       *VolumePreallocation
+	preallocationLock   sync.RWMutex
+	collectionCaps      map[string]CollectionCap
+	collectionCapsLock  sync.RWMutex
 }
 
 func (s *Store) String() (str string) {
@@ -55,24 +67,40 @@ func (s *Store) String() (str string) {
 }
 
 func NewStore(grpcDialOption grpc.DialOption, port int, ip, publicUrl string, dirnames []string, maxVolumeCounts []int,
-	minFreeSpaces []util.MinFreeSpace, idxFolder string, needleMapKind NeedleMapKind, diskTypes []DiskType) (s *Store) {
+	minFreeSpaces []util.MinFreeSpace, idxFolder string, needleMapKind NeedleMapKind, checkLevel VolumeCheckLevel, diskTypes []DiskType) (s *Store) {
 	s = &Store{grpcDialOption: grpcDialOption, Port: port, Ip: ip, PublicUrl: publicUrl, NeedleMapKind: needleMapKind}
+	s.DiskSpaceLowChanged = make(chan bool, 1)
 	s.Locations = make([]*DiskLocation, 0)
 	for i := 0; i < len(dirnames); i++ {
 		location := NewDiskLocation(dirnames[i], maxVolumeCounts[i], minFreeSpaces[i], idxFolder, diskTypes[i])
-		location.loadExistingVolumes(needleMapKind)
 		s.Locations = append(s.Locations, location)
 		stats.VolumeServerMaxVolumeCounter.Add(float64(maxVolumeCounts[i]))
 	}
+
+	// load the directories in parallel, usually on different disks
+	var wg sync.WaitGroup
+	for _, location := range s.Locations {
+		wg.Add(1)
+		go func(location *DiskLocation) {
+			defer wg.Done()
+			location.loadExistingVolumes(needleMapKind, checkLevel)
+		}(location)
+	}
+	wg.Wait()
+
+	for _, location := range s.Locations {
+		go location.CheckDiskSpace(s.DiskSpaceLowChanged)
+	}
 	s.NewVolumesChan = make(chan master_pb.VolumeShortInformationMessage, 3)
 	s.DeletedVolumesChan = make(chan master_pb.VolumeShortInformationMessage, 3)
+	s.UpdatedVolumesChan = make(chan *master_pb.VolumeInformationMessage, 3)
 
 	s.NewEcShardsChan = make(chan master_pb.VolumeEcShardInformationMessage, 3)
 	s.DeletedEcShardsChan = make(chan master_pb.VolumeEcShardInformationMessage, 3)
 
 	return
 }
-func (s *Store) AddVolume(volumeId needle.VolumeId, collection string, needleMapKind NeedleMapKind, replicaPlacement string, ttlString string, preallocate int64, MemoryMapMaxSizeMb uint32, diskType DiskType) error {
+func (s *Store) AddVolume(volumeId needle.VolumeId, collection string, needleMapKind NeedleMapKind, replicaPlacement string, ttlString string, checksumAlgorithm needle.ChecksumAlgorithm, version needle.Version, preallocate int64, MemoryMapMaxSizeMb uint32, diskType DiskType, uuid string) error {
 	rt, e := super_block.NewReplicaPlacementFromString(replicaPlacement)
 	if e != nil {
 		return e
@@ -81,7 +109,10 @@ func (s *Store) AddVolume(volumeId needle.VolumeId, collection string, needleMap
 	if e != nil {
 		return e
 	}
-	e = s.addVolume(volumeId, collection, needleMapKind, rt, ttl, preallocate, MemoryMapMaxSizeMb, diskType)
+	if version, e = needle.ParseVolumeVersion(uint(version)); e != nil {
+		return e
+	}
+	e = s.addVolume(volumeId, collection, needleMapKind, rt, ttl, checksumAlgorithm, version, preallocate, MemoryMapMaxSizeMb, diskType, uuid)
 	return e
 }
 func (s *Store) DeleteCollection(collection string) (e error) {
@@ -123,14 +154,21 @@ func (s *Store) FindFreeLocation(diskType DiskType) (ret *DiskLocation) {
 	}
 	return ret
 }
-func (s *Store) addVolume(vid needle.VolumeId, collection string, needleMapKind NeedleMapKind, replicaPlacement *super_block.ReplicaPlacement, ttl *needle.TTL, preallocate int64, memoryMapMaxSizeMb uint32, diskType DiskType) error {
+func (s *Store) addVolume(vid needle.VolumeId, collection string, needleMapKind NeedleMapKind, replicaPlacement *super_block.ReplicaPlacement, ttl *needle.TTL, checksumAlgorithm needle.ChecksumAlgorithm, version needle.Version, preallocate int64, memoryMapMaxSizeMb uint32, diskType DiskType, uuid string) error {
 	if s.findVolume(vid) != nil {
 		return fmt.Errorf("Volume Id %d already exists!", vid)
 	}
+	if err := s.checkCollectionCap(collection); err != nil {
+		return err
+	}
 	if location := s.FindFreeLocation(diskType); location != nil {
-		glog.V(0).Infof("In dir %s adds volume:%v collection:%s replicaPlacement:%v ttl:%v",
-			location.Directory, vid, collection, replicaPlacement, ttl)
-		if volume, err := NewVolume(location.Directory, location.IdxDirectory, collection, vid, needleMapKind, replicaPlacement, ttl, preallocate, memoryMapMaxSizeMb); err == nil {
+		glog.V(0).Infof("In dir %s adds volume:%v collection:%s replicaPlacement:%v ttl:%v checksum:%v",
+			location.Directory, vid, collection, replicaPlacement, ttl, checksumAlgorithm)
+		preallocation := s.volumePreallocation(collection, preallocate)
+		if volume, err := newVolume(location.Directory, location.IdxDirectory, collection, vid, needleMapKind, VolumeCheckIndex, replicaPlacement, ttl, checksumAlgorithm, version, preallocation, memoryMapMaxSizeMb); err == nil {
+			if err = volume.SetUuid(uuid); err != nil {
+				glog.Warningf("volume %d set uuid: %v", vid, err)
+			}
 			location.SetVolume(vid, volume)
 			glog.V(0).Infof("add volume %d", vid)
 			s.NewVolumesChan <- master_pb.VolumeShortInformationMessage{
@@ -172,14 +210,17 @@ func collectStatsForOneLocation(location *DiskLocation) (stats []*VolumeInfo) {
 func collectStatForOneVolume(vid needle.VolumeId, v *Volume) (s *VolumeInfo) {
 
 	s = &VolumeInfo{
-		Id:               vid,
-		Collection:       v.Collection,
-		ReplicaPlacement: v.ReplicaPlacement,
-		Version:          v.Version(),
-		ReadOnly:         v.IsReadOnly(),
-		Ttl:              v.Ttl,
-		CompactRevision:  uint32(v.CompactionRevision),
-		DiskType:         v.DiskType().String(),
+		Id:                vid,
+		Collection:        v.Collection,
+		ReplicaPlacement:  v.ReplicaPlacement,
+		Version:           v.Version(),
+		ReadOnly:          v.IsReadOnly(),
+		Ttl:               v.Ttl,
+		CompactRevision:   uint32(v.CompactionRevision),
+		DiskType:          v.DiskType().String(),
+		Epoch:             v.Epoch(),
+		Uuid:              v.Uuid(),
+		ReplicasOutOfSync: v.ReplicasOutOfSync(),
 	}
 	s.RemoteStorageName, s.RemoteStorageKey = v.RemoteStorageNameKey()
 
@@ -194,6 +235,7 @@ func collectStatForOneVolume(vid needle.VolumeId, v *Volume) (s *VolumeInfo) {
 	s.DeleteCount = v.nm.DeletedCount()
 	s.DeletedByteCount = v.nm.DeletedSize()
 	s.Size = v.nm.ContentSize()
+	s.IndexMemorySize = v.nm.MemorySize()
 
 	return
 }
@@ -318,6 +360,7 @@ func (s *Store) CollectHeartbeat() *master_pb.Heartbeat {
 		Rack:            s.rack,
 		Volumes:         volumeMessages,
 		HasNoVolumes:    len(volumeMessages) == 0,
+		CollectionCaps:  s.collectionCapsToPb(),
 	}
 
 }
@@ -338,7 +381,9 @@ func (s *Store) WriteVolumeNeedle(i needle.VolumeId, n *needle.Needle, fsync boo
 			err = fmt.Errorf("volume %d is read only", i)
 			return
 		}
+		start := time.Now()
 		_, _, isUnchanged, err = v.writeNeedle2(n, fsync && s.isStopping)
+		observeNeedleRequest(v.Collection, v.location, "write", start, int64(len(n.Data)), err)
 		return
 	}
 	glog.V(0).Infoln("volume", i, "not found!")
@@ -346,22 +391,75 @@ func (s *Store) WriteVolumeNeedle(i needle.VolumeId, n *needle.Needle, fsync boo
 	return
 }
 
+// StartWriting counts an upload to the volume as a concurrent writer, until the returned function is called
+func (s *Store) StartWriting(i needle.VolumeId) (done func()) {
+	v := s.findVolume(i)
+	if v == nil {
+		return func() {}
+	}
+	atomic.AddInt32(&v.concurrentWriters, 1)
+	return func() {
+		atomic.AddInt32(&v.concurrentWriters, -1)
+	}
+}
+
 func (s *Store) DeleteVolumeNeedle(i needle.VolumeId, n *needle.Needle) (Size, error) {
 	if v := s.findVolume(i); v != nil {
 		if v.noWriteOrDelete {
 			return 0, fmt.Errorf("volume %d is read only", i)
 		}
-		return v.deleteNeedle2(n)
+		start := time.Now()
+		size, err := v.deleteNeedle2(n)
+		observeNeedleRequest(v.Collection, v.location, "delete", start, int64(size), err)
+		return size, err
+	}
+	return 0, fmt.Errorf("volume %d not found on %s:%d", i, s.Ip, s.Port)
+}
+
+func (s *Store) UndeleteVolumeNeedle(i needle.VolumeId, n *needle.Needle) (Size, error) {
+	if v := s.findVolume(i); v != nil {
+		if v.IsReadOnly() {
+			return 0, fmt.Errorf("volume %d is read only", i)
+		}
+		return v.undeleteNeedle(n)
 	}
 	return 0, fmt.Errorf("volume %d not found on %s:%d", i, s.Ip, s.Port)
 }
 
 func (s *Store) ReadVolumeNeedle(i needle.VolumeId, n *needle.Needle, readOption *ReadOption) (int, error) {
 	if v := s.findVolume(i); v != nil {
-		return v.readNeedle(n, readOption)
+		start := time.Now()
+		count, err := v.readNeedle(n, readOption)
+		observeNeedleRequest(v.Collection, v.location, "read", start, int64(count), err)
+		return count, err
 	}
 	return 0, fmt.Errorf("volume %d not found", i)
 }
+
+// observeNeedleRequest records the needle request metrics by collection and disk,
+// to find the busy collections and the slow or failing disks.
+func observeNeedleRequest(collection string, location *DiskLocation, requestType string, start time.Time, size int64, err error) {
+	disk := ""
+	if location != nil {
+		disk = location.Directory
+	}
+	result := "ok"
+	switch err {
+	case nil:
+	case ErrorNotFound, ErrorDeleted:
+		result = "not_found"
+	default:
+		result = "error"
+	}
+	stats.VolumeServerNeedleRequestCounter.WithLabelValues(collection, disk, requestType, result).Inc()
+	if err != nil {
+		return
+	}
+	stats.VolumeServerNeedleRequestHistogram.WithLabelValues(collection, disk, requestType).Observe(time.Since(start).Seconds())
+	if size > 0 {
+		stats.VolumeServerNeedleBytesCounter.WithLabelValues(collection, disk, requestType).Add(float64(size))
+	}
+}
 func (s *Store) GetVolume(i needle.VolumeId) *Volume {
 	return s.findVolume(i)
 }
@@ -393,6 +491,39 @@ func (s *Store) MarkVolumeWritable(i needle.VolumeId) error {
 	return nil
 }
 
+// MarkVolumeReplicasOutOfSync marks the volume for repair after a write or delete failed to replicate,
+// and reports it to the master
+func (s *Store) MarkVolumeReplicasOutOfSync(i needle.VolumeId, outOfSync bool) error {
+	v := s.findVolume(i)
+	if v == nil {
+		return fmt.Errorf("volume %d not found", i)
+	}
+	if v.ReplicasOutOfSync() == outOfSync {
+		return nil
+	}
+	if err := v.SetReplicasOutOfSync(outOfSync); err != nil {
+		return err
+	}
+	s.NotifyVolumeUpdated(i)
+	return nil
+}
+
+// NotifyVolumeUpdated sends the volume status to the master without waiting for the next heartbeat,
+// e.g., after the volume is moved to or from the remote tier
+func (s *Store) NotifyVolumeUpdated(i needle.VolumeId) {
+	v := s.findVolume(i)
+	if v == nil {
+		return
+	}
+	if _, message := v.ToVolumeInformationMessage(); message != nil {
+		select {
+		case s.UpdatedVolumesChan <- message:
+		default:
+			glog.V(0).Infof("volume %d update will be sent in the next heartbeat", i)
+		}
+	}
+}
+
 func (s *Store) MountVolume(i needle.VolumeId) error {
 	for _, location := range s.Locations {
 		if found := location.LoadVolume(i, s.NeedleMapKind); found == true {
@@ -413,6 +544,31 @@ func (s *Store) MountVolume(i needle.VolumeId) error {
 	return fmt.Errorf("volume %d not found on disk", i)
 }
 
+// LoadUnmountedVolume loads the volume files without mounting the volume, e.g., a copied volume catching up with its source.
+// The volume is not reported to the master, and should be closed after use.
+func (s *Store) LoadUnmountedVolume(i needle.VolumeId) (*Volume, error) {
+	if s.findVolume(i) != nil {
+		return nil, fmt.Errorf("volume %d is already mounted", i)
+	}
+	for _, location := range s.Locations {
+		fileInfo, found := location.LocateVolume(i)
+		if !found {
+			continue
+		}
+		_, collection, err := volumeIdFromFileName(fileInfo.Name())
+		if err != nil {
+			return nil, err
+		}
+		v, err := NewVolume(location.Directory, location.IdxDirectory, collection, i, s.NeedleMapKind, nil, nil, needle.ChecksumCrc32c, 0, 0)
+		if err != nil {
+			return nil, fmt.Errorf("load volume %d: %v", i, err)
+		}
+		v.location = location
+		return v, nil
+	}
+	return nil, fmt.Errorf("volume %d not found on disk", i)
+}
+
 func (s *Store) UnmountVolume(i needle.VolumeId) error {
 	v := s.findVolume(i)
 	if v == nil {
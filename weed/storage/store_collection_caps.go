@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+)
+
+// CollectionCap limits the volumes of a collection on this volume server, for the volume servers shared by several tenants.
+// The caps are reported to the master, which does not grow the volumes of the collection here beyond the volume count,
+// and stops assigning writes to them here at the disk usage.
+type CollectionCap struct {
+	MaxVolumeCount int    // 0 for no limit
+	MaxDiskUsage   uint64 // in bytes, 0 for no limit
+}
+
+// SetCollectionCaps replaces the collection caps, reported in the next heartbeat
+func (s *Store) SetCollectionCaps(collectionCaps map[string]CollectionCap) {
+	s.collectionCapsLock.Lock()
+	defer s.collectionCapsLock.Unlock()
+	s.collectionCaps = collectionCaps
+}
+
+func (s *Store) collectionCapsToPb() (collectionCaps []*master_pb.CollectionCap) {
+	s.collectionCapsLock.RLock()
+	defer s.collectionCapsLock.RUnlock()
+	for collection, c := range s.collectionCaps {
+		collectionCaps = append(collectionCaps, &master_pb.CollectionCap{
+			Collection:     collection,
+			MaxVolumeCount: uint32(c.MaxVolumeCount),
+			MaxDiskUsage:   c.MaxDiskUsage,
+		})
+	}
+	sort.Slice(collectionCaps, func(i, j int) bool {
+		return collectionCaps[i].Collection < collectionCaps[j].Collection
+	})
+	return
+}
+
+// checkCollectionCap rejects a new volume of the collection at its caps,
+// in case the master allocates the volume before seeing the caps
+func (s *Store) checkCollectionCap(collection string) error {
+	s.collectionCapsLock.RLock()
+	c, found := s.collectionCaps[collection]
+	s.collectionCapsLock.RUnlock()
+	if !found {
+		return nil
+	}
+
+	var volumeCount int
+	var diskUsage uint64
+	for _, location := range s.Locations {
+		location.volumesLock.RLock()
+		for _, v := range location.volumes {
+			if v.Collection != collection {
+				continue
+			}
+			volumeCount++
+			datSize, _, _ := v.FileStat()
+			diskUsage += datSize
+		}
+		location.volumesLock.RUnlock()
+	}
+
+	if c.MaxVolumeCount > 0 && volumeCount >= c.MaxVolumeCount {
+		return fmt.Errorf("collection %q has %d volumes, reaching the cap of %d volumes", collection, volumeCount, c.MaxVolumeCount)
+	}
+	if c.MaxDiskUsage > 0 && diskUsage >= c.MaxDiskUsage {
+		return fmt.Errorf("collection %q uses %d bytes, reaching the cap of %d bytes", collection, diskUsage, c.MaxDiskUsage)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+)
+
+func TestCollectionCaps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "collection_caps")
+	if err != nil {
+		t.Fatalf("temp dir creation: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newTestStore(dir)
+	defer s.Close()
+	go func() {
+		// drain the new volume messages sent to the master
+		for range s.NewVolumesChan {
+		}
+	}()
+	s.SetCollectionCaps(map[string]CollectionCap{
+		"logs": {MaxVolumeCount: 2},
+		"tmp":  {MaxDiskUsage: 1},
+	})
+
+	addVolume := func(vid needle.VolumeId, collection string) error {
+		return s.AddVolume(vid, collection, NeedleMapInMemory, "000", "", needle.ChecksumCrc32c, needle.CurrentVersion, 0, 0, types.HardDriveType, "")
+	}
+	for vid := needle.VolumeId(1); vid <= 2; vid++ {
+		if err := addVolume(vid, "logs"); err != nil {
+			t.Fatalf("add volume %d: %v", vid, err)
+		}
+	}
+	if err := addVolume(3, "logs"); err == nil {
+		t.Errorf("added a volume over the volume count cap")
+	}
+	if err := addVolume(3, "pictures"); err != nil {
+		t.Errorf("add volume of the collection without caps: %v", err)
+	}
+	// the superblock reaches the disk usage cap
+	if err := addVolume(4, "tmp"); err != nil {
+		t.Fatalf("add volume under the disk usage cap: %v", err)
+	}
+	if err := addVolume(5, "tmp"); err == nil {
+		t.Errorf("added a volume over the disk usage cap")
+	}
+
+	heartbeat := s.CollectHeartbeat()
+	expected := []*master_pb.CollectionCap{{Collection: "logs", MaxVolumeCount: 2}, {Collection: "tmp", MaxDiskUsage: 1}}
+	if len(heartbeat.CollectionCaps) != len(expected) {
+		t.Fatalf("heartbeat collection caps %v", heartbeat.CollectionCaps)
+	}
+	for i, c := range expected {
+		if heartbeat.CollectionCaps[i].String() != c.String() {
+			t.Errorf("heartbeat collection cap %v, expected %v", heartbeat.CollectionCaps[i], c)
+		}
+	}
+}
@@ -121,9 +121,12 @@ func (s *Store) DestroyEcVolume(vid needle.VolumeId) {
 	}
 }
 
-func (s *Store) ReadEcShardNeedle(vid needle.VolumeId, n *needle.Needle) (int, error) {
+func (s *Store) ReadEcShardNeedle(vid needle.VolumeId, n *needle.Needle) (count int, err error) {
 	for _, location := range s.Locations {
 		if localEcVolume, found := location.FindEcVolume(vid); found {
+			defer func(location *DiskLocation, start time.Time) {
+				observeNeedleRequest(localEcVolume.Collection, location, "read", start, int64(count), err)
+			}(location, time.Now())
 
 			offset, size, intervals, err := localEcVolume.LocateEcShardNeedle(n.Id, localEcVolume.Version)
 			if err != nil {
@@ -146,7 +149,7 @@ func (s *Store) ReadEcShardNeedle(vid needle.VolumeId, n *needle.Needle) (int, e
 				return 0, ErrorDeleted
 			}
 
-			err = n.ReadBytes(bytes, offset.ToActualOffset(), size, localEcVolume.Version)
+			err = n.ReadBytes(bytes, offset.ToActualOffset(), size, localEcVolume.Version, localEcVolume.ChecksumAlgorithm)
 			if err != nil {
 				return 0, fmt.Errorf("readbytes: %v", err)
 			}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+)
+
+const (
+	// the needle map kind of the demoted volumes, with a small and fixed memory footprint
+	demotedNeedleMapKind = NeedleMapLevelDb
+	// the block cache and the write buffer of NeedleMapLevelDb, only smaller in-memory needle maps are kept
+	demotedNeedleMapMemorySize = 3 * 1024 * 1024
+)
+
+// touch records the last read or write of the volume, to demote the indexes of the cold volumes first
+func (v *Volume) touch() {
+	atomic.StoreInt64(&v.lastAccessTsSeconds, time.Now().Unix())
+}
+
+func (v *Volume) lastAccessTime() int64 {
+	return atomic.LoadInt64(&v.lastAccessTsSeconds)
+}
+
+// indexMemory is the estimated memory used by the needle map of the volume
+func (v *Volume) indexMemory() (memorySize uint64, isInMemory bool) {
+	v.dataFileAccessLock.RLock()
+	defer v.dataFileAccessLock.RUnlock()
+	if v.nm == nil {
+		return 0, false
+	}
+	_, isInMemory = v.nm.(*NeedleMap)
+	return v.nm.MemorySize(), isInMemory
+}
+
+// demoteNeedleMap reloads the in-memory needle map of the volume as an on-disk needle map.
+// The on-disk needle map is rebuilt from the .idx file, and is kept until the volume is reloaded.
+func (v *Volume) demoteNeedleMap(needleMapKind NeedleMapKind) error {
+	v.dataFileAccessLock.Lock()
+	defer v.dataFileAccessLock.Unlock()
+
+	if v.isCompacting {
+		return fmt.Errorf("volume %d is compacting", v.Id)
+	}
+	if _, ok := v.nm.(*NeedleMap); !ok {
+		return fmt.Errorf("volume %d index is not in memory", v.Id)
+	}
+
+	oldNeedleMap := v.nm
+	if err := oldNeedleMap.Sync(); err != nil {
+		return fmt.Errorf("sync volume %d index: %v", v.Id, err)
+	}
+	indexFile, err := os.OpenFile(v.FileName(".idx"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("open volume index %s: %v", v.FileName(".idx"), err)
+	}
+	// a left over on-disk needle map may have the entries removed by vacuuming since
+	os.RemoveAll(v.FileName(".ldb"))
+	if err = v.loadNeedleMap(needleMapKind, indexFile); err != nil {
+		v.nm = oldNeedleMap
+		indexFile.Close()
+		return err
+	}
+	oldNeedleMap.Close()
+	v.needleMapKind = needleMapKind
+	return nil
+}
+
+// IndexMemoryStatus is the memory used by the needle maps of the loaded volumes, against the budget
+type IndexMemoryStatus struct {
+	Budget          uint64 // 0 for no limit
+	Used            uint64
+	InMemoryVolumes int
+	DemotedVolumes  int64 // since the start of the volume server
+}
+
+func (s *Store) IndexMemoryStatus() (status IndexMemoryStatus) {
+	status.Budget = s.IndexMemoryBudget
+	status.DemotedVolumes = atomic.LoadInt64(&s.demotedVolumeCount)
+	for _, location := range s.Locations {
+		location.volumesLock.RLock()
+		for _, v := range location.volumes {
+			memorySize, isInMemory := v.indexMemory()
+			status.Used += memorySize
+			if isInMemory {
+				status.InMemoryVolumes++
+			}
+		}
+		location.volumesLock.RUnlock()
+	}
+	return
+}
+
+// EnforceIndexMemoryBudget demotes the in-memory needle maps of the least recently accessed volumes
+// to on-disk needle maps, until the needle maps of all the loaded volumes fit in the memory budget.
+func (s *Store) EnforceIndexMemoryBudget() (demoted []needle.VolumeId) {
+	if s.IndexMemoryBudget == 0 {
+		return
+	}
+
+	type candidate struct {
+		v            *Volume
+		memorySize   uint64
+		lastAccessTs int64
+	}
+	var candidates []*candidate
+	var used uint64
+	for _, location := range s.Locations {
+		location.volumesLock.RLock()
+		for _, v := range location.volumes {
+			memorySize, isInMemory := v.indexMemory()
+			used += memorySize
+			if isInMemory && memorySize > demotedNeedleMapMemorySize {
+				candidates = append(candidates, &candidate{v: v, memorySize: memorySize, lastAccessTs: v.lastAccessTime()})
+			}
+		}
+		location.volumesLock.RUnlock()
+	}
+	stats.VolumeServerIndexMemoryGauge.WithLabelValues("used").Set(float64(used))
+	stats.VolumeServerIndexMemoryGauge.WithLabelValues("budget").Set(float64(s.IndexMemoryBudget))
+	if used <= s.IndexMemoryBudget {
+		return
+	}
+
+	// the coldest first, and the largest first among the equally cold ones
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].lastAccessTs != candidates[j].lastAccessTs {
+			return candidates[i].lastAccessTs < candidates[j].lastAccessTs
+		}
+		return candidates[i].memorySize > candidates[j].memorySize
+	})
+
+	for _, c := range candidates {
+		if used <= s.IndexMemoryBudget {
+			break
+		}
+		if err := c.v.demoteNeedleMap(demotedNeedleMapKind); err != nil {
+			glog.V(1).Infof("demote volume %d index: %v", c.v.Id, err)
+			continue
+		}
+		newMemorySize, _ := c.v.indexMemory()
+		used = used - c.memorySize + newMemorySize
+		atomic.AddInt64(&s.demotedVolumeCount, 1)
+		demoted = append(demoted, c.v.Id)
+		glog.V(0).Infof("demoted volume %d index using %d bytes to on-disk index using %d bytes, index memory %d/%d bytes",
+			c.v.Id, c.memorySize, newMemorySize, used, s.IndexMemoryBudget)
+	}
+	stats.VolumeServerIndexMemoryGauge.WithLabelValues("used").Set(float64(used))
+	if used > s.IndexMemoryBudget {
+		glog.Warningf("index memory %d bytes is still over the budget of %d bytes", used, s.IndexMemoryBudget)
+	}
+	return
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+)
+
+func TestEnforceIndexMemoryBudget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index_memory")
+	if err != nil {
+		t.Fatalf("temp dir creation: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newTestStore(dir)
+	defer s.Close()
+
+	written := make(map[needle.VolumeId][]*needle.Needle)
+	for vid := needle.VolumeId(1); vid <= 3; vid++ {
+		if err := s.AddVolume(vid, "", NeedleMapInMemory, "000", "", needle.ChecksumCrc32c, needle.CurrentVersion, 0, 0, types.HardDriveType, ""); err != nil {
+			t.Fatalf("add volume %d: %v", vid, err)
+		}
+		// the needle ids far apart take one compact section each
+		for i := uint64(1); i <= 4; i++ {
+			n := newRandomNeedle(i << 33)
+			if _, err := s.WriteVolumeNeedle(vid, n, false); err != nil {
+				t.Fatalf("write volume %d: %v", vid, err)
+			}
+			written[vid] = append(written[vid], n)
+		}
+	}
+	// volume 2 is the coldest, then volume 1
+	for vid, ts := range map[needle.VolumeId]int64{1: 200, 2: 100, 3: 300} {
+		s.findVolume(vid).lastAccessTsSeconds = ts
+	}
+
+	status := s.IndexMemoryStatus()
+	if status.InMemoryVolumes != 3 || status.Used <= 3*demotedNeedleMapMemorySize {
+		t.Fatalf("index memory status %+v", status)
+	}
+
+	// no limit
+	if demoted := s.EnforceIndexMemoryBudget(); len(demoted) != 0 {
+		t.Errorf("demoted %v without a budget", demoted)
+	}
+
+	s.IndexMemoryBudget = status.Used - 1
+	demoted := s.EnforceIndexMemoryBudget()
+	if len(demoted) != 1 || demoted[0] != 2 {
+		t.Fatalf("demoted %v", demoted)
+	}
+	if v := s.findVolume(2); v.needleMapKind != demotedNeedleMapKind {
+		t.Errorf("volume 2 needle map kind %v", v.needleMapKind)
+	}
+	newStatus := s.IndexMemoryStatus()
+	if newStatus.InMemoryVolumes != 2 || newStatus.Used >= status.Used || newStatus.DemotedVolumes != 1 {
+		t.Errorf("index memory status %+v after demotion", newStatus)
+	}
+
+	// within the budget
+	if demoted := s.EnforceIndexMemoryBudget(); len(demoted) != 0 {
+		t.Errorf("demoted %v again", demoted)
+	}
+
+	// the demoted volume is still readable and writable
+	n := newRandomNeedle(500000)
+	if _, err := s.WriteVolumeNeedle(2, n, false); err != nil {
+		t.Fatalf("write demoted volume: %v", err)
+	}
+	for _, expected := range append(written[2], n) {
+		n := &needle.Needle{Id: expected.Id}
+		if _, err := s.ReadVolumeNeedle(2, n, nil); err != nil {
+			t.Fatalf("read %d from demoted volume: %v", expected.Id, err)
+		}
+		if !bytes.Equal(n.Data, expected.Data) {
+			t.Errorf("read %d from demoted volume: different content", expected.Id)
+		}
+	}
+	if v := s.findVolume(2); v.nm.FileCount() != 5 {
+		t.Errorf("demoted volume file count %d", v.nm.FileCount())
+	}
+}
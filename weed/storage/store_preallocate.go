@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"github.com/chrislusf/seaweedfs/weed/storage/backend"
+)
+
+// VolumePreallocation is how the new volumes reserve the disk space for their .dat files,
+// with optional overrides by the collections, e.g., to reserve the whole volume in large extents on the archival nodes.
+type VolumePreallocation struct {
+	Global      CollectionPreallocation
+	Collections map[string]CollectionPreallocation
+}
+
+type CollectionPreallocation struct {
+	Strategy backend.PreallocateStrategy
+	// the bytes to reserve, 0 to reserve the size requested by the master
+	Size       int64
+	ExtentSize int64
+}
+
+// SetVolumePreallocation replaces the preallocation of the volumes created from now on
+func (s *Store) SetVolumePreallocation(preallocation *VolumePreallocation) {
+	s.preallocationLock.Lock()
+	defer s.preallocationLock.Unlock()
+	s.preallocation = preallocation
+}
+
+// volumePreallocation is the preallocation of a new volume of the collection, given the size requested by the master
+func (s *Store) volumePreallocation(collection string, requestedSize int64) backend.Preallocation {
+	s.preallocationLock.RLock()
+	defer s.preallocationLock.RUnlock()
+
+	if s.preallocation == nil {
+		return backend.Preallocation{Size: requestedSize}
+	}
+	conf, found := s.preallocation.Collections[collection]
+	if !found {
+		conf = s.preallocation.Global
+	}
+	preallocation := backend.Preallocation{
+		Strategy:   conf.Strategy,
+		Size:       requestedSize,
+		ExtentSize: conf.ExtentSize,
+	}
+	if conf.Size > 0 {
+		preallocation.Size = conf.Size
+	}
+	return preallocation
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chrislusf/seaweedfs/weed/storage/backend"
+)
+
+func TestVolumePreallocation(t *testing.T) {
+	s := &Store{}
+	// without the configuration, the size requested by the master is reserved
+	assert.Equal(t, backend.Preallocation{Size: 100}, s.volumePreallocation("", 100))
+
+	s.SetVolumePreallocation(&VolumePreallocation{
+		Global: CollectionPreallocation{Strategy: backend.PreallocateBackground},
+		Collections: map[string]CollectionPreallocation{
+			"archive": {Strategy: backend.PreallocateFallocate, Size: 30 << 20, ExtentSize: 4 << 20},
+			"tmp":     {Strategy: backend.PreallocateSparse},
+		},
+	})
+	assert.Equal(t, backend.Preallocation{Strategy: backend.PreallocateBackground, Size: 100}, s.volumePreallocation("pictures", 100))
+	assert.Equal(t, backend.Preallocation{Strategy: backend.PreallocateSparse}, s.volumePreallocation("tmp", 0))
+
+	archive := s.volumePreallocation("archive", 100)
+	assert.Equal(t, backend.Preallocation{Strategy: backend.PreallocateFallocate, Size: 30 << 20, ExtentSize: 4 << 20}, archive)
+	assert.Equal(t, int64(32<<20), archive.AlignedSize())
+	assert.Equal(t, int64(100), backend.Preallocation{Size: 100}.AlignedSize())
+}
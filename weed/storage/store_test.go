@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/storage/backend"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+)
+
+func TestAddVolumeVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "volume_version")
+	if err != nil {
+		t.Fatalf("temp dir creation: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newTestStore(dir)
+	defer s.Close()
+
+	// 0 is from the masters not setting the version
+	for vid, version := range map[needle.VolumeId]needle.Version{1: 0, 2: needle.Version4} {
+		if err := s.AddVolume(vid, "", NeedleMapInMemory, "000", "", needle.ChecksumCrc32c, version, 0, 0, types.HardDriveType, ""); err != nil {
+			t.Fatalf("add volume %d: %v", vid, err)
+		}
+	}
+	if v := s.findVolume(1); v.Version() != needle.Version3 {
+		t.Errorf("volume 1 version %d, expected %d", v.Version(), needle.Version3)
+	}
+	if v := s.findVolume(2); v.Version() != needle.Version4 {
+		t.Errorf("volume 2 version %d, expected %d", v.Version(), needle.Version4)
+	}
+	if err := s.AddVolume(3, "", NeedleMapInMemory, "000", "", needle.ChecksumCrc32c, 5, 0, 0, types.HardDriveType, ""); err == nil {
+		t.Errorf("added volume 3 of unsupported version 5")
+	}
+}
+
+func TestLoadVolumeVersionWithoutVif(t *testing.T) {
+	dir, err := ioutil.TempDir("", "volume_version")
+	if err != nil {
+		t.Fatalf("temp dir creation: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	v, err := newVolume(dir, dir, "", 1, NeedleMapInMemory, VolumeCheckIndex, &super_block.ReplicaPlacement{}, &needle.TTL{}, needle.ChecksumCrc32c, needle.Version4, backend.Preallocation{}, 0)
+	if err != nil {
+		t.Fatalf("volume creation: %v", err)
+	}
+	n := newEmptyNeedle(1)
+	n.Data = []byte("some data with metadata")
+	n.Checksum = needle.NewCRC(n.Data)
+	if err = n.SetMetadata(map[string]string{"Owner": "someone"}); err != nil {
+		t.Fatalf("set metadata: %v", err)
+	}
+	if _, _, _, err = v.writeNeedle2(n, false); err != nil {
+		t.Fatalf("write needle: %v", err)
+	}
+	v.Close()
+
+	// e.g., volumes copied without their .vif files
+	if err = os.Remove(v.FileName(".vif")); err != nil {
+		t.Fatalf("remove vif file: %v", err)
+	}
+
+	// the version of the new volume is ignored when loading an existing volume
+	v, err = newVolume(dir, dir, "", 1, NeedleMapInMemory, VolumeCheckIndex, nil, nil, needle.ChecksumCrc32c, needle.CurrentVersion, backend.Preallocation{}, 0)
+	if err != nil {
+		t.Fatalf("volume reloading: %v", err)
+	}
+	defer v.Close()
+	if v.Version() != needle.Version4 || v.GetVolumeInfo().Version != uint32(needle.Version4) {
+		t.Fatalf("volume version %d, .vif version %d, expected %d", v.Version(), v.GetVolumeInfo().Version, needle.Version4)
+	}
+	n = newEmptyNeedle(1)
+	if _, err = v.readNeedle(n, nil); err != nil {
+		t.Fatalf("read needle: %v", err)
+	}
+	if metadata, err := n.GetMetadata(); err != nil || metadata["Owner"] != "someone" {
+		t.Errorf("read metadata %v: %v", metadata, err)
+	}
+}
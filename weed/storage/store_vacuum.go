@@ -2,10 +2,14 @@ package storage
 
 import (
 	"fmt"
+	"time"
+
 	"github.com/chrislusf/seaweedfs/weed/stats"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/storage/backend"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle_map"
 )
 
 func (s *Store) CheckCompactVolume(volumeId needle.VolumeId) (float64, error) {
@@ -15,16 +19,23 @@ func (s *Store) CheckCompactVolume(volumeId needle.VolumeId) (float64, error) {
 	}
 	return 0, fmt.Errorf("volume id %d is not found during check compact", volumeId)
 }
-func (s *Store) CompactVolume(vid needle.VolumeId, preallocate int64, compactionBytePerSecond int64) error {
+func (s *Store) CompactVolume(vid needle.VolumeId, preallocate int64, compactionBytePerSecond int64, deleteGracePeriod time.Duration) error {
 	if v := s.findVolume(vid); v != nil {
-		s := stats.NewDiskStatus(v.dir)
-		if int64(s.Free) < preallocate {
-			return fmt.Errorf("free space: %d bytes, not enough for %d bytes", s.Free, preallocate)
+		preallocation := s.volumePreallocation(v.Collection, preallocate)
+		diskStatus := stats.NewDiskStatus(v.dir)
+		if preallocation.Strategy != backend.PreallocateSparse && int64(diskStatus.Free) < preallocation.AlignedSize() {
+			return fmt.Errorf("free space: %d bytes, not enough for %d bytes", diskStatus.Free, preallocation.AlignedSize())
 		}
-		return v.Compact2(preallocate, compactionBytePerSecond)
+		return v.Compact2(preallocation, compactionBytePerSecond, deleteGracePeriod)
 	}
 	return fmt.Errorf("volume id %d is not found during compact", vid)
 }
+func (s *Store) VerifyCompactVolume(vid needle.VolumeId, siblingNm *needle_map.MemDb) (uint64, uint64, error) {
+	if v := s.findVolume(vid); v != nil {
+		return v.VerifyCompact(siblingNm)
+	}
+	return 0, 0, fmt.Errorf("volume id %d is not found during verify compact", vid)
+}
 func (s *Store) CommitCompactVolume(vid needle.VolumeId) (bool, error) {
 	if v := s.findVolume(vid); v != nil {
 		return v.IsReadOnly(), v.CommitCompact()
@@ -6,6 +6,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
 	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
@@ -19,7 +20,7 @@ const (
 * Byte 1: Replica Placement strategy, 000, 001, 002, 010, etc
 * Byte 2 and byte 3: Time to live. See TTL for definition
 * Byte 4 and byte 5: The number of times the volume has been compacted.
-* Rest bytes: Reserved
+* Byte 6 and byte 7: The size of the optional extra, which follows the 8 bytes and is padded to the needle alignment.
  */
 type SuperBlock struct {
 	Version            needle.Version
@@ -32,8 +33,16 @@ type SuperBlock struct {
 
 func (s *SuperBlock) BlockSize() int {
 	switch s.Version {
-	case needle.Version2, needle.Version3:
-		return SuperBlockSize + int(s.ExtraSize)
+	case needle.Version2, needle.Version3, needle.Version4:
+		if s.ExtraSize == 0 {
+			return SuperBlockSize
+		}
+		// padded, so the needles are still aligned
+		blockSize := SuperBlockSize + int(s.ExtraSize)
+		if remainder := blockSize % types.NeedlePaddingSize; remainder != 0 {
+			blockSize += types.NeedlePaddingSize - remainder
+		}
+		return blockSize
 	}
 	return SuperBlockSize
 }
@@ -59,11 +68,34 @@ func (s *SuperBlock) Bytes() []byte {
 		util.Uint16toBytes(header[6:8], s.ExtraSize)
 
 		header = append(header, extraData...)
+		if padding := s.BlockSize() - len(header); padding > 0 {
+			header = append(header, make([]byte, padding)...)
+		}
 	}
 
 	return header
 }
 
+// ChecksumAlgorithm is how the needle checksums are calculated, CRC32C if not recorded.
+func (s *SuperBlock) ChecksumAlgorithm() needle.ChecksumAlgorithm {
+	if s.Extra == nil {
+		return needle.ChecksumCrc32c
+	}
+	return needle.ChecksumAlgorithm(s.Extra.ChecksumAlgorithm)
+}
+
+// SetChecksumAlgorithm records the checksum algorithm in the super block extra.
+// The default CRC32C is not recorded, so the super block stays readable by older versions.
+func (s *SuperBlock) SetChecksumAlgorithm(checksumAlgorithm needle.ChecksumAlgorithm) {
+	if checksumAlgorithm == needle.ChecksumCrc32c && s.Extra == nil {
+		return
+	}
+	if s.Extra == nil {
+		s.Extra = &master_pb.SuperBlockExtra{}
+	}
+	s.Extra.ChecksumAlgorithm = uint32(checksumAlgorithm)
+}
+
 func (s *SuperBlock) Initialized() bool {
 	return s.ReplicaPlacement != nil && s.Ttl != nil
 }
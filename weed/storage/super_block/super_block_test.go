@@ -1,8 +1,11 @@
 package super_block
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
+	"github.com/chrislusf/seaweedfs/weed/storage/backend"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 )
 
@@ -23,3 +26,39 @@ func TestSuperBlockReadWrite(t *testing.T) {
 	}
 
 }
+
+func TestSuperBlockChecksumAlgorithm(t *testing.T) {
+	rp, _ := NewReplicaPlacementFromByte(byte(001))
+	s := &SuperBlock{
+		Version:          needle.CurrentVersion,
+		ReplicaPlacement: rp,
+		Ttl:              needle.EMPTY_TTL,
+	}
+	s.SetChecksumAlgorithm(needle.ChecksumCrc32c)
+	if len(s.Bytes()) != SuperBlockSize {
+		t.Fatalf("the default checksum algorithm should not be recorded")
+	}
+	s.SetChecksumAlgorithm(needle.ChecksumXxHash)
+
+	f, err := ioutil.TempFile("", "superblock")
+	if err != nil {
+		t.Fatalf("temp file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	datBackend := backend.NewDiskFile(f)
+	defer datBackend.Close()
+	if _, err = datBackend.WriteAt(s.Bytes(), 0); err != nil {
+		t.Fatalf("write super block: %v", err)
+	}
+
+	readSuperBlock, err := ReadSuperBlock(datBackend)
+	if err != nil {
+		t.Fatalf("read super block: %v", err)
+	}
+	if readSuperBlock.ChecksumAlgorithm() != needle.ChecksumXxHash {
+		t.Fatalf("checksum algorithm %v", readSuperBlock.ChecksumAlgorithm())
+	}
+	if readSuperBlock.BlockSize() != len(s.Bytes()) {
+		t.Fatalf("super block size %d, expected %d", readSuperBlock.BlockSize(), len(s.Bytes()))
+	}
+}
@@ -0,0 +1,96 @@
+// +build 8BytesOffset
+
+package types
+
+import (
+	"fmt"
+)
+
+type OffsetHigher struct {
+	b4 byte
+	b5 byte
+	b6 byte
+	b7 byte
+}
+
+const (
+	OffsetSize                   = 4 + 4
+	MaxPossibleVolumeSize uint64 = 4 * 1024 * 1024 * 1024 * 8 * 256 * 256 * 256 // 512PB, to keep the actual offset within int64
+)
+
+// the higher bytes follow the lower 4 bytes, same layout as the 5 bytes offset
+func OffsetToBytes(bytes []byte, offset Offset) {
+	bytes[7] = offset.b7
+	bytes[6] = offset.b6
+	bytes[5] = offset.b5
+	bytes[4] = offset.b4
+	bytes[3] = offset.b0
+	bytes[2] = offset.b1
+	bytes[1] = offset.b2
+	bytes[0] = offset.b3
+}
+
+// only for testing, will be removed later.
+func Uint32ToOffset(offset uint32) Offset {
+	return Offset{
+		OffsetLower: OffsetLower{
+			b0: byte(offset),
+			b1: byte(offset >> 8),
+			b2: byte(offset >> 16),
+			b3: byte(offset >> 24),
+		},
+	}
+}
+
+func BytesToOffset(bytes []byte) Offset {
+	return Offset{
+		OffsetHigher: OffsetHigher{
+			b4: bytes[4],
+			b5: bytes[5],
+			b6: bytes[6],
+			b7: bytes[7],
+		},
+		OffsetLower: OffsetLower{
+			b0: bytes[3],
+			b1: bytes[2],
+			b2: bytes[1],
+			b3: bytes[0],
+		},
+	}
+}
+
+func (offset Offset) IsZero() bool {
+	return offset.b0 == 0 && offset.b1 == 0 && offset.b2 == 0 && offset.b3 == 0 &&
+		offset.b4 == 0 && offset.b5 == 0 && offset.b6 == 0 && offset.b7 == 0
+}
+
+func ToOffset(offset int64) Offset {
+	smaller := offset / int64(NeedlePaddingSize)
+	return Offset{
+		OffsetHigher: OffsetHigher{
+			b4: byte(smaller >> 32),
+			b5: byte(smaller >> 40),
+			b6: byte(smaller >> 48),
+			b7: byte(smaller >> 56),
+		},
+		OffsetLower: OffsetLower{
+			b0: byte(smaller),
+			b1: byte(smaller >> 8),
+			b2: byte(smaller >> 16),
+			b3: byte(smaller >> 24),
+		},
+	}
+}
+
+func (offset Offset) value() int64 {
+	return int64(offset.b0) + int64(offset.b1)<<8 + int64(offset.b2)<<16 + int64(offset.b3)<<24 +
+		int64(offset.b4)<<32 + int64(offset.b5)<<40 + int64(offset.b6)<<48 + int64(offset.b7)<<56
+}
+
+func (offset Offset) ToActualOffset() (actualOffset int64) {
+	return offset.value() * int64(NeedlePaddingSize)
+}
+
+func (offset Offset) String() string {
+	return fmt.Sprintf("%d", offset.value())
+}
@@ -5,6 +5,7 @@ import (
 	"path"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
@@ -26,6 +27,7 @@ type Volume struct {
 	DataBackend        backend.BackendStorageFile
 	nm                 NeedleMapper
 	needleMapKind      NeedleMapKind
+	checkLevel         VolumeCheckLevel
 	noWriteOrDelete    bool // if readonly, either noWriteOrDelete or noWriteCanDelete
 	noWriteCanDelete   bool // if readonly, either noWriteOrDelete or noWriteCanDelete
 	noWriteLock        sync.RWMutex
@@ -42,21 +44,38 @@ type Volume struct {
 	lastCompactIndexOffset uint64
 	lastCompactRevision    uint16
 
+	// the deleted needles kept by the last vacuum to be undeleted, not counted as garbage until they expire
+	retainedDeletedSize  uint64
+	retainedUntil        time.Time
+	compactRetainedSize  uint64 // kept by the compaction not committed yet
+	compactRetainedUntil time.Time
+
 	isCompacting bool
 
+	concurrentWriters int32 // uploads in progress, reported to the master to spread the writes
+
+	epoch uint64 // replica membership epoch, adopted from the master
+
 	volumeInfo *volume_server_pb.VolumeInfo
 	location   *DiskLocation
 
 	lastIoError error
+
+	lastAccessTsSeconds int64 // the last read or write, to find the cold volumes
+}
+
+func NewVolume(dirname string, dirIdx string, collection string, id needle.VolumeId, needleMapKind NeedleMapKind, replicaPlacement *super_block.ReplicaPlacement, ttl *needle.TTL, checksumAlgorithm needle.ChecksumAlgorithm, preallocate int64, memoryMapMaxSizeMb uint32) (v *Volume, e error) {
+	return newVolume(dirname, dirIdx, collection, id, needleMapKind, VolumeCheckIndex, replicaPlacement, ttl, checksumAlgorithm, needle.CurrentVersion, backend.Preallocation{Size: preallocate}, memoryMapMaxSizeMb)
 }
 
-func NewVolume(dirname string, dirIdx string, collection string, id needle.VolumeId, needleMapKind NeedleMapKind, replicaPlacement *super_block.ReplicaPlacement, ttl *needle.TTL, preallocate int64, memoryMapMaxSizeMb uint32) (v *Volume, e error) {
-	// if replicaPlacement is nil, the superblock will be loaded from disk
+func newVolume(dirname string, dirIdx string, collection string, id needle.VolumeId, needleMapKind NeedleMapKind, checkLevel VolumeCheckLevel, replicaPlacement *super_block.ReplicaPlacement, ttl *needle.TTL, checksumAlgorithm needle.ChecksumAlgorithm, version needle.Version, preallocation backend.Preallocation, memoryMapMaxSizeMb uint32) (v *Volume, e error) {
+	// if replicaPlacement is nil, the superblock will be loaded from disk, and version is only for the empty volume file
 	v = &Volume{dir: dirname, dirIdx: dirIdx, Collection: collection, Id: id, MemoryMapMaxSizeMb: memoryMapMaxSizeMb,
-		asyncRequestsChan: make(chan *needle.AsyncRequest, 128)}
-	v.SuperBlock = super_block.SuperBlock{ReplicaPlacement: replicaPlacement, Ttl: ttl}
+		checkLevel: checkLevel, asyncRequestsChan: make(chan *needle.AsyncRequest, 128)}
+	v.SuperBlock = super_block.SuperBlock{Version: version, ReplicaPlacement: replicaPlacement, Ttl: ttl}
+	v.SuperBlock.SetChecksumAlgorithm(checksumAlgorithm)
 	v.needleMapKind = needleMapKind
-	e = v.load(true, true, needleMapKind, preallocate)
+	e = v.load(true, true, needleMapKind, preallocation)
 	v.startWorker()
 	return
 }
@@ -87,7 +106,7 @@ func (v *Volume) IndexFileName() (fileName string) {
 
 func (v *Volume) FileName(ext string) (fileName string) {
 	switch ext {
-	case ".idx", ".cpx", ".ldb":
+	case ".idx", ".cpx", ".ldb", ".bdb":
 		return VolumeFileName(v.dirIdx, v.Collection, int(v.Id)) + ext
 	}
 	// .dat, .cpd, .vif
@@ -209,7 +228,7 @@ func (v *Volume) expired(contentSize uint64, volumeSizeLimit uint64) bool {
 		// skip if we don't know size limit
 		return false
 	}
-	if contentSize <= super_block.SuperBlockSize {
+	if contentSize <= uint64(v.SuperBlock.BlockSize()) {
 		return false
 	}
 	if v.Ttl == nil || v.Ttl.Minutes() == 0 {
@@ -240,7 +259,7 @@ func (v *Volume) expiredLongEnough(maxDelayMinutes uint32) bool {
 	return false
 }
 
-func (v *Volume) collectStatus() (maxFileKey types.NeedleId, datFileSize int64, modTime time.Time, fileCount, deletedCount, deletedSize uint64, ok bool) {
+func (v *Volume) collectStatus() (maxFileKey types.NeedleId, datFileSize int64, modTime time.Time, fileCount, deletedCount, deletedSize, indexMemorySize uint64, ok bool) {
 	v.dataFileAccessLock.RLock()
 	defer v.dataFileAccessLock.RUnlock()
 	glog.V(3).Infof("collectStatus volume %d", v.Id)
@@ -257,32 +276,38 @@ func (v *Volume) collectStatus() (maxFileKey types.NeedleId, datFileSize int64,
 	deletedCount = uint64(v.nm.DeletedCount())
 	deletedSize = v.nm.DeletedSize()
 	fileCount = uint64(v.nm.FileCount())
+	indexMemorySize = v.nm.MemorySize()
 
 	return
 }
 
 func (v *Volume) ToVolumeInformationMessage() (types.NeedleId, *master_pb.VolumeInformationMessage) {
 
-	maxFileKey, volumeSize, modTime, fileCount, deletedCount, deletedSize, ok := v.collectStatus()
+	maxFileKey, volumeSize, modTime, fileCount, deletedCount, deletedSize, indexMemorySize, ok := v.collectStatus()
 
 	if !ok {
 		return 0, nil
 	}
 
 	volumeInfo := &master_pb.VolumeInformationMessage{
-		Id:               uint32(v.Id),
-		Size:             uint64(volumeSize),
-		Collection:       v.Collection,
-		FileCount:        fileCount,
-		DeleteCount:      deletedCount,
-		DeletedByteCount: deletedSize,
-		ReadOnly:         v.IsReadOnly(),
-		ReplicaPlacement: uint32(v.ReplicaPlacement.Byte()),
-		Version:          uint32(v.Version()),
-		Ttl:              v.Ttl.ToUint32(),
-		CompactRevision:  uint32(v.SuperBlock.CompactionRevision),
-		ModifiedAtSecond: modTime.Unix(),
-		DiskType:         string(v.location.DiskType),
+		Id:                uint32(v.Id),
+		Size:              uint64(volumeSize),
+		Collection:        v.Collection,
+		FileCount:         fileCount,
+		DeleteCount:       deletedCount,
+		DeletedByteCount:  deletedSize,
+		ReadOnly:          v.IsReadOnly(),
+		ReplicaPlacement:  uint32(v.ReplicaPlacement.Byte()),
+		Version:           uint32(v.Version()),
+		Ttl:               v.Ttl.ToUint32(),
+		CompactRevision:   uint32(v.SuperBlock.CompactionRevision),
+		ModifiedAtSecond:  modTime.Unix(),
+		DiskType:          string(v.location.DiskType),
+		IndexMemorySize:   indexMemorySize,
+		ConcurrentWriters: uint32(atomic.LoadInt32(&v.concurrentWriters)),
+		Epoch:             v.Epoch(),
+		Uuid:              v.Uuid(),
+		ReplicasOutOfSync: v.ReplicasOutOfSync(),
 	}
 
 	volumeInfo.RemoteStorageName, volumeInfo.RemoteStorageKey = v.RemoteStorageNameKey()
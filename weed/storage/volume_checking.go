@@ -2,9 +2,9 @@ package storage
 
 import (
 	"fmt"
-	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/storage/backend"
@@ -14,6 +14,39 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
+// VolumeCheckLevel is how much of a volume is validated when it is loaded.
+type VolumeCheckLevel int
+
+const (
+	VolumeCheckIndex VolumeCheckLevel = iota // verify the index file size and fix the last index entries, the default
+	VolumeCheckNone                          // trust the files as they are, for the fastest startup
+	VolumeCheckFull                          // also read every needle in the index and verify its checksum
+)
+
+func ParseVolumeCheckLevel(name string) (VolumeCheckLevel, error) {
+	switch strings.ToLower(name) {
+	case "", "index":
+		return VolumeCheckIndex, nil
+	case "none":
+		return VolumeCheckNone, nil
+	case "full":
+		return VolumeCheckFull, nil
+	}
+	return VolumeCheckIndex, fmt.Errorf("unknown check level %s, expecting none, index or full", name)
+}
+
+func (l VolumeCheckLevel) String() string {
+	switch l {
+	case VolumeCheckIndex:
+		return "index"
+	case VolumeCheckNone:
+		return "none"
+	case VolumeCheckFull:
+		return "full"
+	}
+	return fmt.Sprintf("unknown(%d)", int(l))
+}
+
 func CheckAndFixVolumeDataIntegrity(v *Volume, indexFile *os.File) (lastAppendAtNs uint64, err error) {
 	var indexSize int64
 	if indexSize, err = verifyIndexFileIntegrity(indexFile); err != nil {
@@ -44,6 +77,25 @@ func CheckAndFixVolumeDataIntegrity(v *Volume, indexFile *os.File) (lastAppendAt
 	return
 }
 
+// verifyAllNeedles reads every needle in the index file, and verifies its checksum
+func verifyAllNeedles(v *Volume, indexFile *os.File) (err error) {
+	version := v.Version()
+	checksumAlgorithm := v.ChecksumAlgorithm()
+	return idx.WalkIndexFile(indexFile, func(key NeedleId, offset Offset, size Size) error {
+		if offset.IsZero() || !size.IsValid() {
+			return nil
+		}
+		n := new(needle.Needle)
+		if err := n.ReadData(v.DataBackend, offset.ToActualOffset(), size, version, checksumAlgorithm); err != nil {
+			return fmt.Errorf("read needle %s at %d: %v", key, offset.ToActualOffset(), err)
+		}
+		if n.Id != key {
+			return fmt.Errorf("index key %s does not match needle's Id %s at %d", key, n.Id, offset.ToActualOffset())
+		}
+		return nil
+	})
+}
+
 func doCheckAndFixVolumeData(v *Volume, indexFile *os.File, indexOffset int64) (lastAppendAtNs uint64, err error) {
 	var lastIdxEntry []byte
 	if lastIdxEntry, err = readIndexEntryAtOffset(indexFile, indexOffset); err != nil {
@@ -55,11 +107,11 @@ func doCheckAndFixVolumeData(v *Volume, indexFile *os.File, indexOffset int64) (
 	}
 	if size < 0 {
 		// read the deletion entry
-		if lastAppendAtNs, err = verifyDeletedNeedleIntegrity(v.DataBackend, v.Version(), key); err != nil {
+		if lastAppendAtNs, err = verifyDeletedNeedleIntegrity(v.DataBackend, v.Version(), v.ChecksumAlgorithm(), key); err != nil {
 			return lastAppendAtNs, fmt.Errorf("verifyNeedleIntegrity %s failed: %v", indexFile.Name(), err)
 		}
 	} else {
-		if lastAppendAtNs, err = verifyNeedleIntegrity(v.DataBackend, v.Version(), offset.ToActualOffset(), key, size); err != nil {
+		if lastAppendAtNs, err = verifyNeedleIntegrity(v.DataBackend, v.Version(), v.ChecksumAlgorithm(), offset.ToActualOffset(), key, size); err != nil {
 			return lastAppendAtNs, err
 		}
 	}
@@ -85,7 +137,7 @@ func readIndexEntryAtOffset(indexFile *os.File, offset int64) (bytes []byte, err
 	return
 }
 
-func verifyNeedleIntegrity(datFile backend.BackendStorageFile, v needle.Version, offset int64, key NeedleId, size Size) (lastAppendAtNs uint64, err error) {
+func verifyNeedleIntegrity(datFile backend.BackendStorageFile, v needle.Version, checksumAlgorithm needle.ChecksumAlgorithm, offset int64, key NeedleId, size Size) (lastAppendAtNs uint64, err error) {
 	n, _, _, err := needle.ReadNeedleHeader(datFile, v, offset)
 	if err == io.EOF {
 		return 0, err
@@ -96,7 +148,7 @@ func verifyNeedleIntegrity(datFile backend.BackendStorageFile, v needle.Version,
 	if n.Size != size {
 		return 0, ErrorSizeMismatch
 	}
-	if v == needle.Version3 {
+	if v >= needle.Version3 {
 		bytes := make([]byte, TimestampSize)
 		_, err = datFile.ReadAt(bytes, offset+NeedleHeaderSize+int64(size)+needle.NeedleChecksumSize)
 		if err == io.EOF {
@@ -124,7 +176,7 @@ func verifyNeedleIntegrity(datFile backend.BackendStorageFile, v needle.Version,
 		}
 		glog.Warningf("data file %s has %d bytes, less than expected %d bytes!", datFile.Name(), fileSize, fileTailOffset)
 	}
-	if err = n.ReadData(datFile, offset, size, v); err != nil {
+	if err = n.ReadData(datFile, offset, size, v, checksumAlgorithm); err != nil {
 		return n.AppendAtNs, fmt.Errorf("read data [%d,%d) : %v", offset, offset+int64(size), err)
 	}
 	if n.Id != key {
@@ -133,7 +185,7 @@ func verifyNeedleIntegrity(datFile backend.BackendStorageFile, v needle.Version,
 	return n.AppendAtNs, err
 }
 
-func verifyDeletedNeedleIntegrity(datFile backend.BackendStorageFile, v needle.Version, key NeedleId) (lastAppendAtNs uint64, err error) {
+func verifyDeletedNeedleIntegrity(datFile backend.BackendStorageFile, v needle.Version, checksumAlgorithm needle.ChecksumAlgorithm, key NeedleId) (lastAppendAtNs uint64, err error) {
 	n := new(needle.Needle)
 	size := n.DiskSize(v)
 	var fileSize int64
@@ -141,7 +193,7 @@ func verifyDeletedNeedleIntegrity(datFile backend.BackendStorageFile, v needle.V
 	if err != nil {
 		return 0, fmt.Errorf("GetStat: %v", err)
 	}
-	if err = n.ReadData(datFile, fileSize-size, Size(0), v); err != nil {
+	if err = n.ReadData(datFile, fileSize-size, Size(0), v, checksumAlgorithm); err != nil {
 		return n.AppendAtNs, fmt.Errorf("read data [%d,%d) : %v", fileSize-size, size, err)
 	}
 	if n.Id != key {
@@ -155,7 +207,7 @@ func (v *Volume) checkIdxFile() error {
 	if err != nil {
 		return fmt.Errorf("get stat %s: %v", v.FileName(".dat"), err)
 	}
-	if datFileSize <= super_block.SuperBlockSize {
+	if datFileSize <= int64(v.SuperBlock.BlockSize()) {
 		return nil
 	}
 	indexFileName := v.FileName(".idx")
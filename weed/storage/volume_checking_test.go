@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/storage/backend"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+)
+
+func TestVolumeCheckFullFindsCorruptedNeedle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "example")
+	if err != nil {
+		t.Fatalf("temp dir creation: %v", err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	v, err := NewVolume(dir, dir, "", 1, NeedleMapInMemory, &super_block.ReplicaPlacement{}, &needle.TTL{}, needle.ChecksumCrc32c, 0, 0)
+	if err != nil {
+		t.Fatalf("volume creation: %v", err)
+	}
+	for i := uint64(1); i <= 20; i++ {
+		n := newEmptyNeedle(i)
+		n.Data = []byte("some data to be corrupted on the disk")
+		n.Checksum = needle.NewCRC(n.Data)
+		if _, _, _, err := v.writeNeedle2(n, false); err != nil {
+			t.Fatalf("write file %d: %v", i, err)
+		}
+	}
+	nv, ok := v.nm.Get(types.Uint64ToNeedleId(2))
+	if !ok {
+		t.Fatalf("needle 2 not found")
+	}
+	v.Close()
+
+	// flip a byte of the data of an early needle, not checked by the default index check
+	datFile, err := os.OpenFile(v.FileName(".dat"), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("open dat file: %v", err)
+	}
+	corruptAt := nv.Offset.ToActualOffset() + types.NeedleHeaderSize + 4 + 10
+	b := make([]byte, 1)
+	if _, err = datFile.ReadAt(b, corruptAt); err != nil {
+		t.Fatalf("read dat file: %v", err)
+	}
+	b[0] ^= 0xff
+	if _, err = datFile.WriteAt(b, corruptAt); err != nil {
+		t.Fatalf("write dat file: %v", err)
+	}
+	datFile.Close()
+
+	for _, tc := range []struct {
+		checkLevel VolumeCheckLevel
+		readOnly   bool
+	}{
+		{VolumeCheckNone, false},
+		{VolumeCheckIndex, false},
+		{VolumeCheckFull, true},
+	} {
+		v, err := newVolume(dir, dir, "", 1, NeedleMapInMemory, tc.checkLevel, nil, nil, needle.ChecksumCrc32c, needle.CurrentVersion, backend.Preallocation{}, 0)
+		if err != nil {
+			t.Fatalf("volume loading with check %s: %v", tc.checkLevel, err)
+		}
+		if v.noWriteOrDelete != tc.readOnly {
+			t.Errorf("check %s: read only %v, expected %v", tc.checkLevel, v.noWriteOrDelete, tc.readOnly)
+		}
+		v.Close()
+	}
+}
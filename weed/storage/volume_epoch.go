@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+)
+
+// Epoch is the replica membership epoch of the volume known to this replica.
+// The master increases the epoch when a replica is added or removed.
+func (v *Volume) Epoch() uint64 {
+	return atomic.LoadUint64(&v.epoch)
+}
+
+// AdoptEpoch sets the epoch if it is newer, and returns whether it is changed
+func (v *Volume) AdoptEpoch(epoch uint64) bool {
+	for {
+		current := atomic.LoadUint64(&v.epoch)
+		if epoch <= current {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(&v.epoch, current, epoch) {
+			return true
+		}
+	}
+}
+
+// SetVolumeEpoch adopts the newer replica membership epoch of the volume from the master
+func (s *Store) SetVolumeEpoch(i needle.VolumeId, epoch uint64) {
+	if v := s.findVolume(i); v != nil && v.AdoptEpoch(epoch) {
+		glog.V(0).Infof("volume %d epoch %d", i, epoch)
+	}
+}
+
+// GetVolumeEpoch returns the replica membership epoch of the volume, or 0 if not found
+func (s *Store) GetVolumeEpoch(i needle.VolumeId) uint64 {
+	if v := s.findVolume(i); v != nil {
+		return v.Epoch()
+	}
+	return 0
+}
+
+// CheckVolumeEpoch rejects a write with an older epoch than the one the volume adopted from the master,
+// which comes from a replica or a client not knowing the latest replica membership,
+// e.g., a partitioned volume server still thinking it owns the volume.
+// A newer epoch is accepted but not adopted, since only the master decides the replica membership,
+// and the volume adopts it from the heartbeat responses or the volume lookups.
+// The zero epoch, from the clients not knowing the epochs, is not checked.
+func (s *Store) CheckVolumeEpoch(i needle.VolumeId, epoch uint64) error {
+	v := s.findVolume(i)
+	if v == nil || epoch == 0 {
+		return nil
+	}
+	if current := v.Epoch(); epoch < current {
+		return fmt.Errorf("volume %d epoch %d is older than the current epoch %d", i, epoch, current)
+	}
+	return nil
+}
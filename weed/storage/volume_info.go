@@ -25,6 +25,11 @@ type VolumeInfo struct {
 	ModifiedAtSecond  int64
 	RemoteStorageName string
 	RemoteStorageKey  string
+	IndexMemorySize   uint64
+	ConcurrentWriters uint32
+	Epoch             uint64
+	Uuid              string
+	ReplicasOutOfSync bool
 }
 
 func NewVolumeInfo(m *master_pb.VolumeInformationMessage) (vi VolumeInfo, err error) {
@@ -42,6 +47,11 @@ func NewVolumeInfo(m *master_pb.VolumeInformationMessage) (vi VolumeInfo, err er
 		RemoteStorageName: m.RemoteStorageName,
 		RemoteStorageKey:  m.RemoteStorageKey,
 		DiskType:          m.DiskType,
+		IndexMemorySize:   m.IndexMemorySize,
+		ConcurrentWriters: m.ConcurrentWriters,
+		Epoch:             m.Epoch,
+		Uuid:              m.Uuid,
+		ReplicasOutOfSync: m.ReplicasOutOfSync,
 	}
 	rp, e := super_block.NewReplicaPlacementFromByte(byte(m.ReplicaPlacement))
 	if e != nil {
@@ -94,6 +104,11 @@ func (vi VolumeInfo) ToVolumeInformationMessage() *master_pb.VolumeInformationMe
 		RemoteStorageName: vi.RemoteStorageName,
 		RemoteStorageKey:  vi.RemoteStorageKey,
 		DiskType:          vi.DiskType,
+		IndexMemorySize:   vi.IndexMemorySize,
+		ConcurrentWriters: vi.ConcurrentWriters,
+		Epoch:             vi.Epoch,
+		Uuid:              vi.Uuid,
+		ReplicasOutOfSync: vi.ReplicasOutOfSync,
 	}
 }
 
@@ -9,8 +9,10 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/stats"
 	"github.com/chrislusf/seaweedfs/weed/storage/backend"
+	"github.com/chrislusf/seaweedfs/weed/storage/idx"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
 	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
@@ -18,11 +20,11 @@ func loadVolumeWithoutIndex(dirname string, collection string, id needle.VolumeI
 	v = &Volume{dir: dirname, Collection: collection, Id: id}
 	v.SuperBlock = super_block.SuperBlock{}
 	v.needleMapKind = needleMapKind
-	err = v.load(false, false, needleMapKind, 0)
+	err = v.load(false, false, needleMapKind, backend.Preallocation{})
 	return
 }
 
-func (v *Volume) load(alsoLoadIndex bool, createDatIfMissing bool, needleMapKind NeedleMapKind, preallocate int64) (err error) {
+func (v *Volume) load(alsoLoadIndex bool, createDatIfMissing bool, needleMapKind NeedleMapKind, preallocation backend.Preallocation) (err error) {
 	alreadyHasSuperBlock := false
 
 	hasLoadedVolume := false
@@ -67,7 +69,7 @@ func (v *Volume) load(alsoLoadIndex bool, createDatIfMissing bool, needleMapKind
 		v.DataBackend = backend.NewDiskFile(dataFile)
 	} else {
 		if createDatIfMissing {
-			v.DataBackend, err = backend.CreateVolumeFile(v.FileName(".dat"), preallocate, v.MemoryMapMaxSizeMb)
+			v.DataBackend, err = backend.CreateVolumeFile(v.FileName(".dat"), preallocation, v.MemoryMapMaxSizeMb)
 		} else {
 			return fmt.Errorf("volume data file %s does not exist", v.FileName(".dat"))
 		}
@@ -102,6 +104,9 @@ func (v *Volume) load(alsoLoadIndex bool, createDatIfMissing bool, needleMapKind
 				v.dirIdx = v.dir
 			}
 		}
+		if err = v.maybeConvertIndexFile(); err != nil {
+			return fmt.Errorf("convert volume index %s: %v", v.FileName(".idx"), err)
+		}
 		// check volume idx files
 		if err := v.checkIdxFile(); err != nil {
 			glog.Fatalf("check volume idx file %s: %v", v.FileName(".idx"), err)
@@ -118,9 +123,17 @@ func (v *Volume) load(alsoLoadIndex bool, createDatIfMissing bool, needleMapKind
 				return fmt.Errorf("cannot write Volume Index %s: %v", v.FileName(".idx"), err)
 			}
 		}
-		if v.lastAppendAtNs, err = CheckAndFixVolumeDataIntegrity(v, indexFile); err != nil {
-			v.noWriteOrDelete = true
-			glog.V(0).Infof("volumeDataIntegrityChecking failed %v", err)
+		if v.checkLevel != VolumeCheckNone {
+			if v.lastAppendAtNs, err = CheckAndFixVolumeDataIntegrity(v, indexFile); err != nil {
+				v.noWriteOrDelete = true
+				glog.V(0).Infof("volumeDataIntegrityChecking failed %v", err)
+			}
+		}
+		if err == nil && v.checkLevel == VolumeCheckFull {
+			if err = verifyAllNeedles(v, indexFile); err != nil {
+				v.noWriteOrDelete = true
+				glog.Warningf("volume %d is read only, verifying all needles: %v", v.Id, err)
+			}
 		}
 
 		if v.noWriteOrDelete || v.noWriteCanDelete {
@@ -128,48 +141,15 @@ func (v *Volume) load(alsoLoadIndex bool, createDatIfMissing bool, needleMapKind
 				glog.V(0).Infof("loading sorted db %s error: %v", v.FileName(".sdx"), err)
 			}
 		} else {
-			switch needleMapKind {
-			case NeedleMapInMemory:
-				glog.V(0).Infoln("loading index", v.FileName(".idx"), "to memory")
-				if v.nm, err = LoadCompactNeedleMap(indexFile); err != nil {
-					glog.V(0).Infof("loading index %s to memory error: %v", v.FileName(".idx"), err)
-				}
-			case NeedleMapLevelDb:
-				glog.V(0).Infoln("loading leveldb", v.FileName(".ldb"))
-				opts := &opt.Options{
-					BlockCacheCapacity:            2 * 1024 * 1024, // default value is 8MiB
-					WriteBuffer:                   1 * 1024 * 1024, // default value is 4MiB
-					CompactionTableSizeMultiplier: 10,              // default value is 1
-				}
-				if v.nm, err = NewLevelDbNeedleMap(v.FileName(".ldb"), indexFile, opts); err != nil {
-					glog.V(0).Infof("loading leveldb %s error: %v", v.FileName(".ldb"), err)
-				}
-			case NeedleMapLevelDbMedium:
-				glog.V(0).Infoln("loading leveldb medium", v.FileName(".ldb"))
-				opts := &opt.Options{
-					BlockCacheCapacity:            4 * 1024 * 1024, // default value is 8MiB
-					WriteBuffer:                   2 * 1024 * 1024, // default value is 4MiB
-					CompactionTableSizeMultiplier: 10,              // default value is 1
-				}
-				if v.nm, err = NewLevelDbNeedleMap(v.FileName(".ldb"), indexFile, opts); err != nil {
-					glog.V(0).Infof("loading leveldb %s error: %v", v.FileName(".ldb"), err)
-				}
-			case NeedleMapLevelDbLarge:
-				glog.V(0).Infoln("loading leveldb large", v.FileName(".ldb"))
-				opts := &opt.Options{
-					BlockCacheCapacity:            8 * 1024 * 1024, // default value is 8MiB
-					WriteBuffer:                   4 * 1024 * 1024, // default value is 4MiB
-					CompactionTableSizeMultiplier: 10,              // default value is 1
-				}
-				if v.nm, err = NewLevelDbNeedleMap(v.FileName(".ldb"), indexFile, opts); err != nil {
-					glog.V(0).Infof("loading leveldb %s error: %v", v.FileName(".ldb"), err)
-				}
-			}
+			err = v.loadNeedleMap(needleMapKind, indexFile)
 		}
 	}
 
-	if !hasVolumeInfoFile {
-		v.volumeInfo.Version = uint32(v.SuperBlock.Version)
+	if !hasVolumeInfoFile || v.volumeInfo.OffsetSize == 0 || v.volumeInfo.Version == 0 {
+		if v.volumeInfo.Version == 0 {
+			v.volumeInfo.Version = uint32(v.SuperBlock.Version)
+		}
+		v.volumeInfo.OffsetSize = uint32(types.OffsetSize)
 		v.SaveVolumeInfo()
 	}
 
@@ -181,3 +161,72 @@ func (v *Volume) load(alsoLoadIndex bool, createDatIfMissing bool, needleMapKind
 
 	return err
 }
+
+// loadNeedleMap loads the index file into the needle map of the kind
+func (v *Volume) loadNeedleMap(needleMapKind NeedleMapKind, indexFile *os.File) (err error) {
+	switch needleMapKind {
+	case NeedleMapInMemory:
+		glog.V(0).Infoln("loading index", v.FileName(".idx"), "to memory")
+		if v.nm, err = LoadCompactNeedleMap(indexFile); err != nil {
+			glog.V(0).Infof("loading index %s to memory error: %v", v.FileName(".idx"), err)
+		}
+	case NeedleMapLevelDb:
+		glog.V(0).Infoln("loading leveldb", v.FileName(".ldb"))
+		opts := &opt.Options{
+			BlockCacheCapacity:            2 * 1024 * 1024, // default value is 8MiB
+			WriteBuffer:                   1 * 1024 * 1024, // default value is 4MiB
+			CompactionTableSizeMultiplier: 10,              // default value is 1
+		}
+		if v.nm, err = NewLevelDbNeedleMap(v.FileName(".ldb"), indexFile, opts); err != nil {
+			glog.V(0).Infof("loading leveldb %s error: %v", v.FileName(".ldb"), err)
+		}
+	case NeedleMapLevelDbMedium:
+		glog.V(0).Infoln("loading leveldb medium", v.FileName(".ldb"))
+		opts := &opt.Options{
+			BlockCacheCapacity:            4 * 1024 * 1024, // default value is 8MiB
+			WriteBuffer:                   2 * 1024 * 1024, // default value is 4MiB
+			CompactionTableSizeMultiplier: 10,              // default value is 1
+		}
+		if v.nm, err = NewLevelDbNeedleMap(v.FileName(".ldb"), indexFile, opts); err != nil {
+			glog.V(0).Infof("loading leveldb %s error: %v", v.FileName(".ldb"), err)
+		}
+	case NeedleMapLevelDbLarge:
+		glog.V(0).Infoln("loading leveldb large", v.FileName(".ldb"))
+		opts := &opt.Options{
+			BlockCacheCapacity:            8 * 1024 * 1024, // default value is 8MiB
+			WriteBuffer:                   4 * 1024 * 1024, // default value is 4MiB
+			CompactionTableSizeMultiplier: 10,              // default value is 1
+		}
+		if v.nm, err = NewLevelDbNeedleMap(v.FileName(".ldb"), indexFile, opts); err != nil {
+			glog.V(0).Infof("loading leveldb %s error: %v", v.FileName(".ldb"), err)
+		}
+	case NeedleMapBoltDb:
+		glog.V(0).Infoln("loading boltdb", v.FileName(".bdb"))
+		if v.nm, err = NewBoltDbNeedleMap(v.FileName(".bdb"), indexFile); err != nil {
+			glog.V(0).Infof("loading boltdb %s error: %v", v.FileName(".bdb"), err)
+		}
+	}
+	return
+}
+
+// maybeConvertIndexFile converts the .idx file written by a build with a different offset size,
+// e.g., when moving volumes to a server built with "-tags 8BytesOffset".
+// Volumes without the recorded offset size are assumed to have the offset size of this build.
+func (v *Volume) maybeConvertIndexFile() error {
+	offsetSize := int(v.volumeInfo.OffsetSize)
+	if offsetSize == 0 || offsetSize == types.OffsetSize {
+		return nil
+	}
+	if util.FileExists(v.FileName(".idx")) {
+		glog.V(0).Infof("converting %s from %d bytes offset to %d bytes offset", v.FileName(".idx"), offsetSize, types.OffsetSize)
+		if err := idx.ConvertIndexFile(v.FileName(".idx"), offsetSize); err != nil {
+			return err
+		}
+		// generated from the .idx file with the old offset size
+		os.Remove(v.FileName(".sdx"))
+		os.RemoveAll(v.FileName(".ldb"))
+		os.Remove(v.FileName(".bdb"))
+	}
+	v.volumeInfo.OffsetSize = uint32(types.OffsetSize)
+	return v.SaveVolumeInfo()
+}
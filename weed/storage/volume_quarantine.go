@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// Uuid identifies the volume across its replicas, to tell apart the volumes of the same id allocated separately,
+// e.g., by two masters after a split brain. It is empty for the volumes allocated by older versions.
+func (v *Volume) Uuid() string {
+	if v.volumeInfo == nil {
+		return ""
+	}
+	return v.volumeInfo.Uuid
+}
+
+// SetUuid saves the uuid given by the master into the .vif file, which is copied along with the volume
+func (v *Volume) SetUuid(uuid string) error {
+	if uuid == "" || v.volumeInfo.Uuid == uuid {
+		return nil
+	}
+	v.volumeInfo.Uuid = uuid
+	return v.SaveVolumeInfo()
+}
+
+// ReplicasOutOfSync tells whether some writes or deletes failed to replicate from this volume
+func (v *Volume) ReplicasOutOfSync() bool {
+	if v.volumeInfo == nil {
+		return false
+	}
+	return v.volumeInfo.ReplicasOutOfSync
+}
+
+// SetReplicasOutOfSync saves the flag into the .vif file, so the volume is still reported for repair after a restart
+func (v *Volume) SetReplicasOutOfSync(outOfSync bool) error {
+	if v.volumeInfo == nil || v.volumeInfo.ReplicasOutOfSync == outOfSync {
+		return nil
+	}
+	v.volumeInfo.ReplicasOutOfSync = outOfSync
+	return v.SaveVolumeInfo()
+}
+
+// QuarantineVolume unloads the volume colliding with the volume of the same id registered elsewhere,
+// and renames its files to "<name>.<ext>.quarantined.<unix seconds>", to be kept for inspection but never loaded again.
+// The master is not told about the deletion, since it has not registered the volume.
+func (s *Store) QuarantineVolume(i needle.VolumeId, reason string) error {
+	v := s.findVolume(i)
+	if v == nil {
+		return fmt.Errorf("volume %d not found", i)
+	}
+	dataFileName, indexFileName := v.DataFileName(), v.IndexFileName()
+	if err := v.location.UnloadVolume(i); err != nil {
+		return err
+	}
+
+	suffix := fmt.Sprintf(".quarantined.%d", time.Now().Unix())
+	if err := quarantineVolumeFiles(dataFileName, suffix); err != nil {
+		return err
+	}
+	if err := quarantineVolumeFiles(indexFileName, suffix); err != nil {
+		return err
+	}
+
+	stats.VolumeServerQuarantinedVolumeCounter.WithLabelValues(v.Collection).Inc()
+	glog.Errorf("quarantined volume %d as %s*%s: %s", i, dataFileName, suffix, reason)
+	return nil
+}
+
+func quarantineVolumeFiles(filename, suffix string) error {
+	for _, ext := range []string{".dat", ".idx", ".vif"} {
+		if !util.FileExists(filename + ext) {
+			continue
+		}
+		if err := os.Rename(filename+ext, filename+ext+suffix); err != nil {
+			return err
+		}
+	}
+	// generated from the .idx file
+	os.Remove(filename + ".sdx")
+	os.RemoveAll(filename + ".ldb")
+	os.Remove(filename + ".bdb")
+	return nil
+}
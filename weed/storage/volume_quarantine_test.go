@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+func newTestStore(dir string) *Store {
+	return NewStore(nil, 8080, "127.0.0.1", "127.0.0.1:8080", []string{dir}, []int{10},
+		[]util.MinFreeSpace{{}}, "", NeedleMapInMemory, VolumeCheckIndex, []types.DiskType{types.HardDriveType})
+}
+
+func TestQuarantineVolume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quarantine")
+	if err != nil {
+		t.Fatalf("temp dir creation: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newTestStore(dir)
+	if err := s.AddVolume(1, "", NeedleMapInMemory, "000", "", needle.ChecksumCrc32c, needle.CurrentVersion, 0, 0, types.HardDriveType, "uuid-a"); err != nil {
+		t.Fatalf("add volume: %v", err)
+	}
+	s.Close()
+
+	// the uuid is kept in the .vif file
+	s = newTestStore(dir)
+	if v := s.findVolume(1); v == nil || v.Uuid() != "uuid-a" {
+		t.Fatalf("loaded volume %v", v)
+	}
+
+	if err := s.QuarantineVolume(1, "uuid uuid-a differs from uuid-b"); err != nil {
+		t.Fatalf("quarantine volume: %v", err)
+	}
+	if s.findVolume(1) != nil {
+		t.Errorf("quarantined volume still loaded")
+	}
+	s.Close()
+
+	fileInfos, _ := ioutil.ReadDir(dir)
+	var quarantinedFiles []string
+	for _, fileInfo := range fileInfos {
+		if !strings.Contains(fileInfo.Name(), ".quarantined.") {
+			t.Errorf("unexpected file %s", filepath.Join(dir, fileInfo.Name()))
+		}
+		quarantinedFiles = append(quarantinedFiles, fileInfo.Name())
+	}
+	if len(quarantinedFiles) != 3 {
+		t.Errorf("quarantined files %v", quarantinedFiles)
+	}
+
+	// the quarantined volume is not loaded again
+	s = newTestStore(dir)
+	defer s.Close()
+	if s.findVolume(1) != nil {
+		t.Errorf("quarantined volume loaded again")
+	}
+}
+
+func TestMarkVolumeReplicasOutOfSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "out_of_sync")
+	if err != nil {
+		t.Fatalf("temp dir creation: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newTestStore(dir)
+	if err := s.AddVolume(1, "", NeedleMapInMemory, "001", "", needle.ChecksumCrc32c, needle.CurrentVersion, 0, 0, types.HardDriveType, "uuid-a"); err != nil {
+		t.Fatalf("add volume: %v", err)
+	}
+	if err := s.MarkVolumeReplicasOutOfSync(1, true); err != nil {
+		t.Fatalf("mark volume: %v", err)
+	}
+	select {
+	case message := <-s.UpdatedVolumesChan:
+		if !message.ReplicasOutOfSync {
+			t.Errorf("reported volume %+v", message)
+		}
+	default:
+		t.Errorf("marked volume not reported")
+	}
+	s.Close()
+
+	// the mark is kept in the .vif file until the replicas are synced
+	s = newTestStore(dir)
+	defer s.Close()
+	if v := s.findVolume(1); v == nil || !v.ReplicasOutOfSync() {
+		t.Fatalf("loaded volume %v not marked", v)
+	}
+	if err := s.MarkVolumeReplicasOutOfSync(1, false); err != nil {
+		t.Fatalf("clear volume mark: %v", err)
+	}
+	if _, message := s.findVolume(1).ToVolumeInformationMessage(); message.ReplicasOutOfSync {
+		t.Errorf("volume still marked")
+	}
+}
@@ -16,6 +16,7 @@ import (
 func (v *Volume) readNeedle(n *needle.Needle, readOption *ReadOption) (int, error) {
 	v.dataFileAccessLock.RLock()
 	defer v.dataFileAccessLock.RUnlock()
+	v.touch()
 
 	nv, ok := v.nm.Get(n.Id)
 	if !ok || nv.Offset.IsZero() {
@@ -33,9 +34,15 @@ func (v *Volume) readNeedle(n *needle.Needle, readOption *ReadOption) (int, erro
 	if readSize == 0 {
 		return 0, nil
 	}
-	err := n.ReadData(v.DataBackend, nv.Offset.ToActualOffset(), readSize, v.Version())
+	readData := func(offset int64) error {
+		if readOption != nil && readOption.MetaOnly {
+			return n.ReadNeedleMeta(v.DataBackend, offset, readSize, v.Version())
+		}
+		return n.ReadData(v.DataBackend, offset, readSize, v.Version(), v.ChecksumAlgorithm())
+	}
+	err := readData(nv.Offset.ToActualOffset())
 	if err == needle.ErrorSizeMismatch && OffsetSize == 4 {
-		err = n.ReadData(v.DataBackend, nv.Offset.ToActualOffset()+int64(MaxPossibleVolumeSize), readSize, v.Version())
+		err = readData(nv.Offset.ToActualOffset() + int64(MaxPossibleVolumeSize))
 	}
 	v.checkReadWriteError(err)
 	if err != nil {
@@ -66,6 +73,22 @@ func (v *Volume) ReadNeedleBlob(offset int64, size Size) ([]byte, error) {
 	return needle.ReadNeedleBlob(v.DataBackend, offset, size, v.Version())
 }
 
+// ReadNeedleBlobById reads the raw bytes of a needle, looking up its offset and size from the needle map
+func (v *Volume) ReadNeedleBlobById(needleId NeedleId) ([]byte, Size, error) {
+	v.dataFileAccessLock.RLock()
+	defer v.dataFileAccessLock.RUnlock()
+
+	nv, ok := v.nm.Get(needleId)
+	if !ok || nv.Offset.IsZero() {
+		return nil, 0, ErrorNotFound
+	}
+	if nv.Size.IsDeleted() {
+		return nil, 0, ErrorDeleted
+	}
+	blob, err := needle.ReadNeedleBlob(v.DataBackend, nv.Offset.ToActualOffset(), nv.Size, v.Version())
+	return blob, nv.Size, err
+}
+
 type VolumeFileScanner interface {
 	VisitSuperBlock(super_block.SuperBlock) error
 	ReadNeedleBody() bool
@@ -38,16 +38,16 @@ func (v *Volume) StreamWrite(n *needle.Needle, data io.Reader, dataSize uint32)
 	// data size and data
 	util.Uint32toBytes(header[0:4], n.DataSize)
 	df.Write(header[0:4])
-	// write and calculate CRC
-	crcWriter := needle.NewCRCwriter(df)
-	io.Copy(crcWriter, io.LimitReader(data, int64(dataSize)))
+	// write and calculate the checksum
+	checksumWriter := needle.NewChecksumWriter(df, v.ChecksumAlgorithm())
+	io.Copy(checksumWriter, io.LimitReader(data, int64(dataSize)))
 
 	// flags
 	util.Uint8toBytes(header[0:1], n.Flags)
 	df.Write(header[0:1])
 
 	// data checksum
-	util.Uint32toBytes(header[0:needle.NeedleChecksumSize], crcWriter.Sum())
+	util.Uint32toBytes(header[0:needle.NeedleChecksumSize], checksumWriter.Sum())
 	// write timestamp, padding
 	n.AppendAtNs = uint64(time.Now().UnixNano())
 	util.Uint64toBytes(header[needle.NeedleChecksumSize:needle.NeedleChecksumSize+TimestampSize], n.AppendAtNs)
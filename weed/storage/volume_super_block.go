@@ -18,7 +18,9 @@ func (v *Volume) maybeWriteSuperBlock() error {
 		return e
 	}
 	if datSize == 0 {
-		v.SuperBlock.Version = needle.CurrentVersion
+		if v.SuperBlock.Version == 0 {
+			v.SuperBlock.Version = needle.CurrentVersion
+		}
 		_, e = v.DataBackend.WriteAt(v.SuperBlock.Bytes(), 0)
 		if e != nil && os.IsPermission(e) {
 			//read-only, but zero length - recreate it!
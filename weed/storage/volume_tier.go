@@ -6,7 +6,6 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
 	"github.com/chrislusf/seaweedfs/weed/storage/backend"
 	_ "github.com/chrislusf/seaweedfs/weed/storage/backend/s3_backend"
-	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 )
 
 func (v *Volume) GetVolumeInfo() *volume_server_pb.VolumeInfo {
@@ -18,9 +17,7 @@ func (v *Volume) maybeLoadVolumeInfo() (found bool) {
 	var err error
 	v.volumeInfo, v.hasRemoteFile, found, err = pb.MaybeLoadVolumeInfo(v.FileName(".vif"))
 
-	if v.volumeInfo.Version == 0 {
-		v.volumeInfo.Version = uint32(needle.CurrentVersion)
-	}
+	// without the version in the .vif file, the version is read from the super block when loading the volume
 
 	if v.hasRemoteFile {
 		glog.V(0).Infof("volume %d is tiered to %s as %s and read only", v.Id,
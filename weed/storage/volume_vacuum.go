@@ -2,6 +2,7 @@ package storage
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"runtime"
 	"time"
@@ -22,19 +23,27 @@ func (v *Volume) garbageLevel() float64 {
 		return 0
 	}
 	deletedSize := v.DeletedSize()
+	if time.Now().Before(v.retainedUntil) {
+		if deletedSize > v.retainedDeletedSize {
+			deletedSize -= v.retainedDeletedSize
+		} else {
+			deletedSize = 0
+		}
+	}
 	fileSize := v.ContentSize()
 	if v.DeletedCount() > 0 && v.DeletedSize() == 0 {
 		// this happens for .sdx converted back to normal .idx
 		// where deleted entry size is missing
 		datFileSize, _, _ := v.FileStat()
-		deletedSize = datFileSize - fileSize - super_block.SuperBlockSize
+		deletedSize = datFileSize - fileSize - uint64(v.SuperBlock.BlockSize())
 		fileSize = datFileSize
 	}
 	return float64(deletedSize) / float64(fileSize)
 }
 
 // compact a volume based on deletions in .dat files
-func (v *Volume) Compact(preallocate int64, compactionBytePerSecond int64) error {
+// the needles deleted within deleteGracePeriod are kept, so they can still be undeleted
+func (v *Volume) Compact(preallocation backend.Preallocation, compactionBytePerSecond int64, deleteGracePeriod time.Duration) error {
 
 	if v.MemoryMapMaxSizeMb != 0 { //it makes no sense to compact in memory
 		return nil
@@ -58,11 +67,15 @@ func (v *Volume) Compact(preallocate int64, compactionBytePerSecond int64) error
 	if err := v.nm.Sync(); err != nil {
 		glog.V(0).Infof("compact fail to sync volume idx %d", v.Id)
 	}
-	return v.copyDataAndGenerateIndexFile(v.FileName(".cpd"), v.FileName(".cpx"), preallocate, compactionBytePerSecond)
+	if err := v.copyDataAndGenerateIndexFile(v.FileName(".cpd"), v.FileName(".cpx"), preallocation, compactionBytePerSecond); err != nil {
+		return err
+	}
+	return v.keepRecentlyDeletedNeedles(v.FileName(".cpd"), v.FileName(".cpx"), deleteGracePeriod)
 }
 
 // compact a volume based on deletions in .idx files
-func (v *Volume) Compact2(preallocate int64, compactionBytePerSecond int64) error {
+// the needles deleted within deleteGracePeriod are kept, so they can still be undeleted
+func (v *Volume) Compact2(preallocation backend.Preallocation, compactionBytePerSecond int64, deleteGracePeriod time.Duration) error {
 
 	if v.MemoryMapMaxSizeMb != 0 { //it makes no sense to compact in memory
 		return nil
@@ -83,7 +96,66 @@ func (v *Volume) Compact2(preallocate int64, compactionBytePerSecond int64) erro
 	if err := v.nm.Sync(); err != nil {
 		glog.V(0).Infof("compact2 fail to sync volume idx %d: %v", v.Id, err)
 	}
-	return copyDataBasedOnIndexFile(v.FileName(".dat"), v.FileName(".idx"), v.FileName(".cpd"), v.FileName(".cpx"), v.SuperBlock, v.Version(), preallocate, compactionBytePerSecond)
+	if err := copyDataBasedOnIndexFile(v.FileName(".dat"), v.FileName(".idx"), int64(v.lastCompactIndexOffset), v.FileName(".cpd"), v.FileName(".cpx"), v.SuperBlock, v.Version(), preallocation, compactionBytePerSecond); err != nil {
+		return err
+	}
+	return v.keepRecentlyDeletedNeedles(v.FileName(".cpd"), v.FileName(".cpx"), deleteGracePeriod)
+}
+
+// VerifyCompact compares the compacted but not committed index with the index of another replica.
+// It fails if a needle live on both replicas is missing from the compacted volume, or has a different size.
+// The needles live on the other replica only are counted as inconsistent, since the replicas may differ
+// for the recent writes and deletes.
+func (v *Volume) VerifyCompact(siblingNm *needle_map.MemDb) (checkedCount, inconsistentCount uint64, err error) {
+	if !util.FileExists(v.FileName(".cpx")) {
+		return 0, 0, fmt.Errorf("volume %d is not compacted", v.Id)
+	}
+
+	compactedNm := needle_map.NewMemDb()
+	defer compactedNm.Close()
+	if err = compactedNm.LoadFromIdx(v.FileName(".cpx")); err != nil {
+		return 0, 0, fmt.Errorf("load %s: %v", v.FileName(".cpx"), err)
+	}
+
+	// the changes after the compaction started are applied by makeupDiff() when committing
+	oldIdxFile, err := os.Open(v.FileName(".idx"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("open %s: %v", v.FileName(".idx"), err)
+	}
+	defer oldIdxFile.Close()
+	indexSize, err := verifyIndexFileIntegrity(oldIdxFile)
+	if err != nil {
+		return 0, 0, fmt.Errorf("verifyIndexFileIntegrity %s: %v", v.FileName(".idx"), err)
+	}
+	if uint64(indexSize) > v.lastCompactIndexOffset {
+		tail := io.NewSectionReader(oldIdxFile, int64(v.lastCompactIndexOffset), indexSize-int64(v.lastCompactIndexOffset))
+		if err = compactedNm.LoadFromReaderAt(tail); err != nil {
+			return 0, 0, fmt.Errorf("load %s: %v", v.FileName(".idx"), err)
+		}
+	}
+
+	err = siblingNm.AscendingVisit(func(value needle_map.NeedleValue) error {
+		checkedCount++
+		if compacted, found := compactedNm.Get(value.Key); found && compacted.Size == value.Size {
+			return nil
+		}
+		nv, ok := v.nm.Get(value.Key)
+		if !ok || nv.Offset.IsZero() || nv.Size.IsDeleted() || nv.Size != value.Size {
+			inconsistentCount++
+			return nil
+		}
+		_, readErr := v.readNeedle(&needle.Needle{Id: value.Key}, nil)
+		if readErr == ErrorNotFound {
+			// expired by ttl
+			return nil
+		}
+		if readErr != nil {
+			return fmt.Errorf("needle %d size %d is missing in compacted volume %d: %v", value.Key, value.Size, v.Id, readErr)
+		}
+		return fmt.Errorf("needle %d size %d is missing in compacted volume %d", value.Key, value.Size, v.Id)
+	})
+
+	return
 }
 
 func (v *Volume) CommitCompact() error {
@@ -139,15 +211,17 @@ func (v *Volume) CommitCompact() error {
 		if e = os.Rename(v.FileName(".cpx"), v.FileName(".idx")); e != nil {
 			return fmt.Errorf("rename %s: %v", v.FileName(".cpx"), e)
 		}
+		v.retainedDeletedSize, v.retainedUntil = v.compactRetainedSize, v.compactRetainedUntil
 	}
 
 	//glog.V(3).Infof("Pretending to be vacuuming...")
 	//time.Sleep(20 * time.Second)
 
 	os.RemoveAll(v.FileName(".ldb"))
+	os.Remove(v.FileName(".bdb"))
 
 	glog.V(3).Infof("Loading volume %d commit file...", v.Id)
-	if e = v.load(true, false, v.needleMapKind, 0); e != nil {
+	if e = v.load(true, false, v.needleMapKind, backend.Preallocation{}); e != nil {
 		return e
 	}
 	return nil
@@ -209,33 +283,7 @@ func (v *Volume) makeupDiff(newDatFileName, newIdxFileName, oldDatFileName, oldI
 		return fmt.Errorf("current old dat file's compact revision %d is not the expected one %d", oldDatCompactRevision, v.lastCompactRevision)
 	}
 
-	type keyField struct {
-		offset Offset
-		size   Size
-	}
-	incrementedHasUpdatedIndexEntry := make(map[NeedleId]keyField)
-
-	for idxOffset := indexSize - NeedleMapEntrySize; uint64(idxOffset) >= v.lastCompactIndexOffset; idxOffset -= NeedleMapEntrySize {
-		var IdxEntry []byte
-		if IdxEntry, err = readIndexEntryAtOffset(oldIdxFile, idxOffset); err != nil {
-			return fmt.Errorf("readIndexEntry %s at offset %d failed: %v", oldIdxFileName, idxOffset, err)
-		}
-		key, offset, size := idx2.IdxFileEntry(IdxEntry)
-		glog.V(4).Infof("key %d offset %d size %d", key, offset, size)
-		if _, found := incrementedHasUpdatedIndexEntry[key]; !found {
-			incrementedHasUpdatedIndexEntry[key] = keyField{
-				offset: offset,
-				size:   size,
-			}
-		}
-	}
-
-	// no updates during commit step
-	if len(incrementedHasUpdatedIndexEntry) == 0 {
-		return nil
-	}
-
-	// deal with updates during commit step
+	// deal with updates during compaction
 	var (
 		dst, idx *os.File
 	)
@@ -245,7 +293,7 @@ func (v *Volume) makeupDiff(newDatFileName, newIdxFileName, oldDatFileName, oldI
 	dstDatBackend := backend.NewDiskFile(dst)
 	defer dstDatBackend.Close()
 
-	if idx, err = os.OpenFile(newIdxFileName, os.O_RDWR, 0644); err != nil {
+	if idx, err = os.OpenFile(newIdxFileName, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
 		return fmt.Errorf("open idx file %s failed: %v", newIdxFileName, err)
 	}
 	defer idx.Close()
@@ -259,56 +307,62 @@ func (v *Volume) makeupDiff(newDatFileName, newIdxFileName, oldDatFileName, oldI
 		return fmt.Errorf("oldDatFile %s 's compact revision is %d while newDatFile %s 's compact revision is %d", oldDatFileName, oldDatCompactRevision, newDatFileName, newDatCompactRevision)
 	}
 
-	for key, increIdxEntry := range incrementedHasUpdatedIndexEntry {
-
-		idxEntryBytes := needle_map.ToBytes(key, increIdxEntry.offset, increIdxEntry.size)
+	// the .idx entries after lastCompactIndexOffset are the log of the writes and deletes during compaction.
+	// replay all of them in order, so the new files end up with the same needles and deletions.
+	version := v.Version()
+	increments := io.NewSectionReader(oldIdxFile, int64(v.lastCompactIndexOffset), indexSize-int64(v.lastCompactIndexOffset))
+	return idx2.WalkIndexFile(increments, func(key NeedleId, offset Offset, size Size) error {
+		glog.V(4).Infof("key %d offset %d size %d", key, offset, size)
 
-		var offset int64
-		if offset, err = dst.Seek(0, 2); err != nil {
-			glog.V(0).Infof("failed to seek the end of file: %v", err)
-			return
-		}
-		//ensure file writing starting from aligned positions
-		if offset%NeedlePaddingSize != 0 {
-			offset = offset + (NeedlePaddingSize - offset%NeedlePaddingSize)
-			if offset, err = dst.Seek(offset, 0); err != nil {
-				glog.V(0).Infof("failed to align in datafile %s: %v", dst.Name(), err)
-				return
+		var newOffset uint64
+		if !offset.IsZero() && !size.IsDeleted() {
+			//updated needle
+			needleBytes, err := needle.ReadNeedleBlob(oldDatBackend, offset.ToActualOffset(), size, version)
+			if err != nil {
+				return fmt.Errorf("ReadNeedleBlob %s key %d offset %d size %d failed: %v", oldDatFile.Name(), key, offset.ToActualOffset(), size, err)
 			}
-		}
-
-		//updated needle
-		if !increIdxEntry.offset.IsZero() && increIdxEntry.size != 0 && increIdxEntry.size.IsValid() {
-			//even the needle cache in memory is hit, the need_bytes is correct
-			glog.V(4).Infof("file %d offset %d size %d", key, increIdxEntry.offset.ToActualOffset(), increIdxEntry.size)
-			var needleBytes []byte
-			needleBytes, err = needle.ReadNeedleBlob(oldDatBackend, increIdxEntry.offset.ToActualOffset(), increIdxEntry.size, v.Version())
+			datSize, _, err := dstDatBackend.GetStat()
 			if err != nil {
-				return fmt.Errorf("ReadNeedleBlob %s key %d offset %d size %d failed: %v", oldDatFile.Name(), key, increIdxEntry.offset.ToActualOffset(), increIdxEntry.size, err)
+				return fmt.Errorf("stat %s: %v", dst.Name(), err)
+			}
+			//ensure file writing starting from aligned positions
+			newOffset = uint64(datSize)
+			if newOffset%NeedlePaddingSize != 0 {
+				newOffset = newOffset + (NeedlePaddingSize - newOffset%NeedlePaddingSize)
+			}
+			if _, err = dstDatBackend.WriteAt(needleBytes, int64(newOffset)); err != nil {
+				return fmt.Errorf("write %s: %v", dst.Name(), err)
 			}
-			dstDatBackend.Write(needleBytes)
-			util.Uint32toBytes(idxEntryBytes[8:12], uint32(offset/NeedlePaddingSize))
 		} else { //deleted needle
 			//fakeDelNeedle 's default Data field is nil
 			fakeDelNeedle := new(needle.Needle)
 			fakeDelNeedle.Id = key
 			fakeDelNeedle.Cookie = 0x12345678
 			fakeDelNeedle.AppendAtNs = uint64(time.Now().UnixNano())
-			_, _, _, err = fakeDelNeedle.Append(dstDatBackend, v.Version())
+			// keep the deletion time of the tombstone
+			if !offset.IsZero() {
+				if tombstoneBytes, readErr := needle.ReadNeedleBlob(oldDatBackend, offset.ToActualOffset(), 0, version); readErr == nil {
+					tombstone := new(needle.Needle)
+					if tombstone.ReadBytes(tombstoneBytes, offset.ToActualOffset(), 0, version, v.ChecksumAlgorithm()) == nil {
+						fakeDelNeedle.Cookie = tombstone.Cookie
+						if tombstone.AppendAtNs != 0 {
+							fakeDelNeedle.AppendAtNs = tombstone.AppendAtNs
+						}
+					}
+				}
+			}
+			newOffset, _, _, err = fakeDelNeedle.Append(dstDatBackend, version)
 			if err != nil {
 				return fmt.Errorf("append deleted %d failed: %v", key, err)
 			}
-			util.Uint32toBytes(idxEntryBytes[8:12], uint32(0))
+			size = TombstoneFileSize
 		}
 
-		if _, err := idx.Seek(0, 2); err != nil {
-			return fmt.Errorf("cannot seek end of indexfile %s: %v",
-				newIdxFileName, err)
+		if _, err := idx.Write(needle_map.ToBytes(key, ToOffset(int64(newOffset)), size)); err != nil {
+			return fmt.Errorf("write %s: %v", newIdxFileName, err)
 		}
-		_, err = idx.Write(idxEntryBytes)
-	}
-
-	return nil
+		return nil
+	})
 }
 
 type VolumeFileScanner4Vacuum struct {
@@ -354,11 +408,11 @@ func (scanner *VolumeFileScanner4Vacuum) VisitNeedle(n *needle.Needle, offset in
 	return nil
 }
 
-func (v *Volume) copyDataAndGenerateIndexFile(dstName, idxName string, preallocate int64, compactionBytePerSecond int64) (err error) {
+func (v *Volume) copyDataAndGenerateIndexFile(dstName, idxName string, preallocation backend.Preallocation, compactionBytePerSecond int64) (err error) {
 	var (
 		dst backend.BackendStorageFile
 	)
-	if dst, err = backend.CreateVolumeFile(dstName, preallocate, 0); err != nil {
+	if dst, err = backend.CreateVolumeFile(dstName, preallocation, 0); err != nil {
 		return
 	}
 	defer dst.Close()
@@ -382,12 +436,13 @@ func (v *Volume) copyDataAndGenerateIndexFile(dstName, idxName string, prealloca
 	return
 }
 
-func copyDataBasedOnIndexFile(srcDatName, srcIdxName, dstDatName, datIdxName string, sb super_block.SuperBlock, version needle.Version, preallocate int64, compactionBytePerSecond int64) (err error) {
+// copyDataBasedOnIndexFile copies the needles in the first srcIdxSize bytes of the .idx file
+func copyDataBasedOnIndexFile(srcDatName, srcIdxName string, srcIdxSize int64, dstDatName, datIdxName string, sb super_block.SuperBlock, version needle.Version, preallocation backend.Preallocation, compactionBytePerSecond int64) (err error) {
 	var (
 		srcDatBackend, dstDatBackend backend.BackendStorageFile
-		dataFile                     *os.File
+		dataFile, idxFile            *os.File
 	)
-	if dstDatBackend, err = backend.CreateVolumeFile(dstDatName, preallocate, 0); err != nil {
+	if dstDatBackend, err = backend.CreateVolumeFile(dstDatName, preallocation, 0); err != nil {
 		return
 	}
 	defer dstDatBackend.Close()
@@ -396,7 +451,11 @@ func copyDataBasedOnIndexFile(srcDatName, srcIdxName, dstDatName, datIdxName str
 	defer oldNm.Close()
 	newNm := needle_map.NewMemDb()
 	defer newNm.Close()
-	if err = oldNm.LoadFromIdx(srcIdxName); err != nil {
+	if idxFile, err = os.Open(srcIdxName); err != nil {
+		return err
+	}
+	defer idxFile.Close()
+	if err = oldNm.LoadFromReaderAt(io.NewSectionReader(idxFile, 0, srcIdxSize)); err != nil {
 		return
 	}
 	if dataFile, err = os.Open(srcDatName); err != nil {
@@ -422,7 +481,7 @@ func copyDataBasedOnIndexFile(srcDatName, srcIdxName, dstDatName, datIdxName str
 		}
 
 		n := new(needle.Needle)
-		err := n.ReadData(srcDatBackend, offset.ToActualOffset(), size, version)
+		err := n.ReadData(srcDatBackend, offset.ToActualOffset(), size, version, sb.ChecksumAlgorithm())
 		if err != nil {
 			return nil
 		}
@@ -449,3 +508,116 @@ func copyDataBasedOnIndexFile(srcDatName, srcIdxName, dstDatName, datIdxName str
 
 	return
 }
+
+// keepRecentlyDeletedNeedles appends the needles deleted within the grace period to the compacted files,
+// followed by their tombstones with the original deletion time, so they can be undeleted until a later vacuum.
+// The kept needles are not counted as garbage until they expire, not to vacuum the volume again for them.
+func (v *Volume) keepRecentlyDeletedNeedles(dstDatName, dstIdxName string, deleteGracePeriod time.Duration) (err error) {
+	v.compactRetainedSize, v.compactRetainedUntil = 0, time.Time{}
+	if deleteGracePeriod <= 0 {
+		return nil
+	}
+	version := v.Version()
+	if version < needle.Version3 {
+		glog.V(0).Infof("volume %d version %d has no deletion time, the deleted needles are not kept", v.Id, version)
+		return nil
+	}
+
+	// the deletion entries in the .idx file point to the tombstones, which have the deletion time.
+	// the entries after lastCompactIndexOffset are applied by makeupDiff() when committing.
+	tombstones := make(map[NeedleId]Offset)
+	oldIdxFile, err := os.Open(v.FileName(".idx"))
+	if err != nil {
+		return fmt.Errorf("open %s: %v", v.FileName(".idx"), err)
+	}
+	defer oldIdxFile.Close()
+	err = idx2.WalkIndexFile(io.NewSectionReader(oldIdxFile, 0, int64(v.lastCompactIndexOffset)), func(key NeedleId, offset Offset, size Size) error {
+		if offset.IsZero() || size.IsDeleted() {
+			tombstones[key] = offset
+		} else {
+			delete(tombstones, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("walk %s: %v", v.FileName(".idx"), err)
+	}
+	if len(tombstones) == 0 {
+		return nil
+	}
+
+	dst, err := os.OpenFile(dstDatName, os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("open %s: %v", dstDatName, err)
+	}
+	dstDatBackend := backend.NewDiskFile(dst)
+	defer dstDatBackend.Close()
+	idxFile, err := os.OpenFile(dstIdxName, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open %s: %v", dstIdxName, err)
+	}
+	defer idxFile.Close()
+
+	now := time.Now()
+	var keptCount int
+	for key, tombstoneOffset := range tombstones {
+		nv, ok := v.nm.Get(key)
+		if !ok || nv.Offset.IsZero() || !nv.Size.IsDeleted() || nv.Size == TombstoneFileSize {
+			// undeleted or written again, or the data is not known
+			continue
+		}
+
+		deletedAtNs := uint64(now.UnixNano())
+		if !tombstoneOffset.IsZero() {
+			tombstone := new(needle.Needle)
+			if tombstoneBlob, readErr := v.ReadNeedleBlob(tombstoneOffset.ToActualOffset(), 0); readErr != nil {
+				glog.V(0).Infof("read tombstone of needle %d in volume %d: %v", key, v.Id, readErr)
+			} else if parseErr := tombstone.ReadBytes(tombstoneBlob, tombstoneOffset.ToActualOffset(), 0, version, v.ChecksumAlgorithm()); parseErr != nil {
+				glog.V(0).Infof("parse tombstone of needle %d in volume %d: %v", key, v.Id, parseErr)
+			} else {
+				deletedAtNs = tombstone.AppendAtNs
+			}
+		}
+		if now.Sub(time.Unix(0, int64(deletedAtNs))) > deleteGracePeriod {
+			continue
+		}
+
+		size := -nv.Size
+		n := new(needle.Needle)
+		blob, err := v.ReadNeedleBlob(nv.Offset.ToActualOffset(), size)
+		if err == nil {
+			err = n.ReadBytes(blob, nv.Offset.ToActualOffset(), size, version, v.ChecksumAlgorithm())
+		}
+		if err != nil {
+			glog.V(0).Infof("read deleted needle %d in volume %d: %v", key, v.Id, err)
+			continue
+		}
+		if n.HasTtl() && uint64(now.Unix()) >= n.LastModified+uint64(v.Ttl.Minutes()*60) {
+			continue
+		}
+
+		offset, _, _, err := n.Append(dstDatBackend, version)
+		if err != nil {
+			return fmt.Errorf("append deleted needle %d: %v", key, err)
+		}
+		tombstone := &needle.Needle{Id: key, Cookie: n.Cookie, AppendAtNs: deletedAtNs}
+		newTombstoneOffset, _, _, err := tombstone.Append(dstDatBackend, version)
+		if err != nil {
+			return fmt.Errorf("append tombstone of needle %d: %v", key, err)
+		}
+		if _, err = idxFile.Write(needle_map.ToBytes(key, ToOffset(int64(offset)), size)); err != nil {
+			return fmt.Errorf("write %s: %v", dstIdxName, err)
+		}
+		if _, err = idxFile.Write(needle_map.ToBytes(key, ToOffset(int64(newTombstoneOffset)), TombstoneFileSize)); err != nil {
+			return fmt.Errorf("write %s: %v", dstIdxName, err)
+		}
+		keptCount++
+		v.compactRetainedSize += uint64(size)
+		if expireAt := time.Unix(0, int64(deletedAtNs)).Add(deleteGracePeriod); expireAt.After(v.compactRetainedUntil) {
+			v.compactRetainedUntil = expireAt
+		}
+	}
+	glog.V(1).Infof("volume %d keeps %d needles deleted within %v", v.Id, keptCount, deleteGracePeriod)
+
+	return nil
+}
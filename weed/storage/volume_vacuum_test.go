@@ -1,13 +1,16 @@
 package storage
 
 import (
+	"bytes"
 	"io/ioutil"
 	"math/rand"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/chrislusf/seaweedfs/weed/storage/backend"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle_map"
 	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
 	"github.com/chrislusf/seaweedfs/weed/storage/types"
 )
@@ -69,7 +72,7 @@ func TestCompaction(t *testing.T) {
 	}
 	defer os.RemoveAll(dir) // clean up
 
-	v, err := NewVolume(dir, dir, "", 1, NeedleMapInMemory, &super_block.ReplicaPlacement{}, &needle.TTL{}, 0, 0)
+	v, err := NewVolume(dir, dir, "", 1, NeedleMapInMemory, &super_block.ReplicaPlacement{}, &needle.TTL{}, needle.ChecksumCrc32c, 0, 0)
 	if err != nil {
 		t.Fatalf("volume creation: %v", err)
 	}
@@ -84,7 +87,7 @@ func TestCompaction(t *testing.T) {
 	}
 
 	startTime := time.Now()
-	v.Compact2(0, 0)
+	v.Compact2(backend.Preallocation{}, 0, 0)
 	speed := float64(v.ContentSize()) / time.Now().Sub(startTime).Seconds()
 	t.Logf("compaction speed: %.2f bytes/s", speed)
 
@@ -96,7 +99,7 @@ func TestCompaction(t *testing.T) {
 
 	v.Close()
 
-	v, err = NewVolume(dir, dir, "", 1, NeedleMapInMemory, nil, nil, 0, 0)
+	v, err = NewVolume(dir, dir, "", 1, NeedleMapInMemory, nil, nil, needle.ChecksumCrc32c, 0, 0)
 	if err != nil {
 		t.Fatalf("volume reloading: %v", err)
 	}
@@ -127,6 +130,270 @@ func TestCompaction(t *testing.T) {
 	}
 
 }
+func TestCompactionKeepsRecentlyDeleted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "example")
+	if err != nil {
+		t.Fatalf("temp dir creation: %v", err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	v, err := NewVolume(dir, dir, "", 1, NeedleMapInMemory, &super_block.ReplicaPlacement{}, &needle.TTL{}, needle.ChecksumCrc32c, 0, 0)
+	if err != nil {
+		t.Fatalf("volume creation: %v", err)
+	}
+	defer v.Close()
+
+	written := make(map[uint64]*needle.Needle)
+	for i := uint64(1); i <= 3; i++ {
+		n := newRandomNeedle(i)
+		n.Data = append(n.Data, byte(i))
+		n.Checksum = needle.NewCRC(n.Data)
+		if _, _, _, err := v.writeNeedle2(n, false); err != nil {
+			t.Fatalf("write file %d: %v", i, err)
+		}
+		written[i] = n
+	}
+	for i := uint64(2); i <= 3; i++ {
+		if _, err := v.deleteNeedle2(newEmptyNeedle(i)); err != nil {
+			t.Fatalf("delete file %d: %v", i, err)
+		}
+	}
+
+	compact := func(compactFn func(preallocation backend.Preallocation, compactionBytePerSecond int64, deleteGracePeriod time.Duration) error, deleteGracePeriod time.Duration) {
+		if err := compactFn(backend.Preallocation{}, 0, deleteGracePeriod); err != nil {
+			t.Fatalf("compact: %v", err)
+		}
+		if err := v.CommitCompact(); err != nil {
+			t.Fatalf("commit compact: %v", err)
+		}
+	}
+	checkRead := func(i uint64, expectedErr error) {
+		n := newEmptyNeedle(i)
+		_, err := v.readNeedle(n, nil)
+		if err != expectedErr {
+			t.Fatalf("read file %d: %v, expected %v", i, err, expectedErr)
+		}
+		if err == nil && n.Checksum != written[i].Checksum {
+			t.Fatalf("read file %d checksum mismatch expected %d found %d", i, written[i].Checksum, n.Checksum)
+		}
+	}
+
+	compact(v.Compact2, time.Hour)
+	checkRead(1, nil)
+	checkRead(2, ErrorDeleted)
+	checkRead(3, ErrorDeleted)
+
+	if _, err := v.undeleteNeedle(newEmptyNeedle(2)); err != nil {
+		t.Fatalf("undelete file 2: %v", err)
+	}
+	checkRead(2, nil)
+
+	// kept again, with the original deletion time
+	compact(v.Compact, time.Hour)
+	checkRead(2, nil)
+	checkRead(3, ErrorDeleted)
+	if level := v.garbageLevel(); level != 0 {
+		t.Fatalf("garbage level %f of the kept needles", level)
+	}
+
+	compact(v.Compact2, 0)
+	checkRead(3, ErrorNotFound)
+	if _, err := v.undeleteNeedle(newEmptyNeedle(3)); err != ErrorNotFound {
+		t.Fatalf("undelete vacuumed file 3: %v", err)
+	}
+}
+
+func TestCompactionReplaysChangesDuringCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "example")
+	if err != nil {
+		t.Fatalf("temp dir creation: %v", err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	v, err := NewVolume(dir, dir, "", 1, NeedleMapInMemory, &super_block.ReplicaPlacement{}, &needle.TTL{}, needle.ChecksumCrc32c, 0, 0)
+	if err != nil {
+		t.Fatalf("volume creation: %v", err)
+	}
+	defer v.Close()
+
+	written := make(map[uint64]*needle.Needle)
+	write := func(n *needle.Needle) {
+		if _, _, _, err := v.writeNeedle2(n, false); err != nil {
+			t.Fatalf("write file %d: %v", n.Id, err)
+		}
+		written[uint64(n.Id)] = n
+	}
+	for i := uint64(1); i <= 3; i++ {
+		write(newRandomNeedle(i))
+	}
+
+	if err := v.Compact2(backend.Preallocation{}, 0, time.Hour); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+
+	// changes during the compaction
+	write(newRandomNeedle(2))
+	write(newRandomNeedle(4))
+	write(newRandomNeedle(5))
+	if _, err := v.deleteNeedle2(newEmptyNeedle(3)); err != nil {
+		t.Fatalf("delete file 3: %v", err)
+	}
+	write(newRandomNeedle(6))
+	if _, err := v.deleteNeedle2(newEmptyNeedle(6)); err != nil {
+		t.Fatalf("delete file 6: %v", err)
+	}
+	write(newRandomNeedle(6))
+
+	if err := v.CommitCompact(); err != nil {
+		t.Fatalf("commit compact: %v", err)
+	}
+
+	checkRead := func(i uint64, expectedErr error) {
+		n := newEmptyNeedle(i)
+		_, err := v.readNeedle(n, nil)
+		if err != expectedErr {
+			t.Fatalf("read file %d: %v, expected %v", i, err, expectedErr)
+		}
+		if err == nil && n.Checksum != written[i].Checksum {
+			t.Fatalf("read file %d checksum mismatch expected %d found %d", i, written[i].Checksum, n.Checksum)
+		}
+	}
+	for _, i := range []uint64{1, 2, 4, 5, 6} {
+		checkRead(i, nil)
+	}
+	checkRead(3, ErrorDeleted)
+
+	// the replayed deletion keeps its deletion time, so it is still within the grace period
+	if err := v.Compact2(backend.Preallocation{}, 0, time.Hour); err != nil {
+		t.Fatalf("compact again: %v", err)
+	}
+	if err := v.CommitCompact(); err != nil {
+		t.Fatalf("commit compact again: %v", err)
+	}
+	checkRead(3, ErrorDeleted)
+	if _, err := v.undeleteNeedle(newEmptyNeedle(3)); err != nil {
+		t.Fatalf("undelete file 3: %v", err)
+	}
+	checkRead(3, nil)
+}
+
+func TestCompactionWithXxHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "example")
+	if err != nil {
+		t.Fatalf("temp dir creation: %v", err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	v, err := NewVolume(dir, dir, "", 1, NeedleMapInMemory, &super_block.ReplicaPlacement{}, &needle.TTL{}, needle.ChecksumXxHash, 0, 0)
+	if err != nil {
+		t.Fatalf("volume creation: %v", err)
+	}
+
+	written := make(map[uint64]*needle.Needle)
+	for i := uint64(1); i <= 10; i++ {
+		n := newRandomNeedle(i)
+		if _, _, _, err := v.writeNeedle2(n, false); err != nil {
+			t.Fatalf("write file %d: %v", i, err)
+		}
+		written[i] = n
+	}
+	if _, err := v.deleteNeedle2(newEmptyNeedle(10)); err != nil {
+		t.Fatalf("delete file 10: %v", err)
+	}
+
+	checkRead := func(v *Volume) {
+		for i := uint64(1); i < 10; i++ {
+			n := newEmptyNeedle(i)
+			if _, err := v.readNeedle(n, nil); err != nil {
+				t.Fatalf("read file %d: %v", i, err)
+			}
+			if !bytes.Equal(n.Data, written[i].Data) || n.Checksum != needle.ChecksumXxHash.Checksum(n.Data) {
+				t.Fatalf("read file %d: unexpected content", i)
+			}
+		}
+	}
+	checkRead(v)
+
+	for _, compactFn := range []func(preallocation backend.Preallocation, compactionBytePerSecond int64, deleteGracePeriod time.Duration) error{v.Compact, v.Compact2} {
+		if err := compactFn(backend.Preallocation{}, 0, 0); err != nil {
+			t.Fatalf("compact: %v", err)
+		}
+		if err := v.CommitCompact(); err != nil {
+			t.Fatalf("commit compact: %v", err)
+		}
+		checkRead(v)
+	}
+	v.Close()
+
+	// the checksum algorithm is loaded from the super block
+	v, err = NewVolume(dir, dir, "", 1, NeedleMapInMemory, nil, nil, needle.ChecksumCrc32c, 0, 0)
+	if err != nil {
+		t.Fatalf("volume reloading: %v", err)
+	}
+	defer v.Close()
+	if v.ChecksumAlgorithm() != needle.ChecksumXxHash {
+		t.Fatalf("checksum algorithm %v", v.ChecksumAlgorithm())
+	}
+	checkRead(v)
+}
+
+func TestVerifyCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "example")
+	if err != nil {
+		t.Fatalf("temp dir creation: %v", err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	v, err := NewVolume(dir, dir, "", 1, NeedleMapInMemory, &super_block.ReplicaPlacement{}, &needle.TTL{}, needle.ChecksumCrc32c, 0, 0)
+	if err != nil {
+		t.Fatalf("volume creation: %v", err)
+	}
+	defer v.Close()
+
+	for i := uint64(1); i <= 3; i++ {
+		n := newRandomNeedle(i)
+		n.Data = append(n.Data, byte(i))
+		n.Checksum = needle.NewCRC(n.Data)
+		if _, _, _, err := v.writeNeedle2(n, false); err != nil {
+			t.Fatalf("write file %d: %v", i, err)
+		}
+	}
+	if _, err := v.deleteNeedle2(newEmptyNeedle(3)); err != nil {
+		t.Fatalf("delete file 3: %v", err)
+	}
+
+	// the sibling replica has the same needles, and one more
+	siblingNm := needle_map.NewMemDb()
+	defer siblingNm.Close()
+	if err := siblingNm.LoadFromIdx(v.FileName(".idx")); err != nil {
+		t.Fatalf("load index: %v", err)
+	}
+	siblingNm.Set(types.NeedleId(100), types.ToOffset(8), 10)
+
+	if err := v.Compact2(backend.Preallocation{}, 0, 0); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	checkedCount, inconsistentCount, err := v.VerifyCompact(siblingNm)
+	if err != nil || checkedCount != 3 || inconsistentCount != 1 {
+		t.Fatalf("verify compact: checked %d inconsistent %d: %v", checkedCount, inconsistentCount, err)
+	}
+	if err := v.cleanupCompact(); err != nil {
+		t.Fatalf("cleanup compact: %v", err)
+	}
+
+	// a corrupted needle is dropped by the compaction
+	nv, _ := v.nm.Get(types.NeedleId(2))
+	if _, err := v.DataBackend.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, nv.Offset.ToActualOffset()+types.NeedleHeaderSize+4); err != nil {
+		t.Fatalf("corrupt file 2: %v", err)
+	}
+	if err := v.Compact2(backend.Preallocation{}, 0, 0); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if _, _, err := v.VerifyCompact(siblingNm); err == nil {
+		t.Fatalf("verify compact should fail for the missing needle 2")
+	}
+}
+
 func doSomeWritesDeletes(i int, v *Volume, t *testing.T, infos []*needleInfo) {
 	n := newRandomNeedle(uint64(i))
 	_, size, _, err := v.writeNeedle2(n, false)
@@ -39,7 +39,7 @@ func (v *Volume) isFileUnchanged(n *needle.Needle) bool {
 	nv, ok := v.nm.Get(n.Id)
 	if ok && !nv.Offset.IsZero() && nv.Size.IsValid() {
 		oldNeedle := new(needle.Needle)
-		err := oldNeedle.ReadData(v.DataBackend, nv.Offset.ToActualOffset(), nv.Size, v.Version())
+		err := oldNeedle.ReadData(v.DataBackend, nv.Offset.ToActualOffset(), nv.Size, v.Version(), v.ChecksumAlgorithm())
 		if err != nil {
 			glog.V(0).Infof("Failed to check updated file at offset %d size %d: %v", nv.Offset.ToActualOffset(), nv.Size, err)
 			return false
@@ -83,6 +83,8 @@ func removeVolumeFiles(filename string) {
 	os.Remove(filename + ".cpx")
 	// level db indx file
 	os.RemoveAll(filename + ".ldb")
+	// boltdb index file
+	os.Remove(filename + ".bdb")
 	// marker for damaged or incomplete volume
 	os.Remove(filename + ".note")
 }
@@ -112,6 +114,7 @@ func (v *Volume) writeNeedle2(n *needle.Needle, fsync bool) (offset uint64, size
 		n.SetHasTtl()
 		n.Ttl = v.Ttl
 	}
+	n.Checksum = v.ChecksumAlgorithm().Checksum(n.Data)
 
 	if !fsync {
 		return v.syncWrite(n)
@@ -134,6 +137,7 @@ func (v *Volume) doWriteRequest(n *needle.Needle) (offset uint64, size Size, isU
 		isUnchanged = true
 		return
 	}
+	v.touch()
 
 	// check whether existing needle cookie matches
 	nv, ok := v.nm.Get(n.Id)
@@ -186,6 +190,17 @@ func (v *Volume) syncDelete(n *needle.Needle) (Size, error) {
 	return v.doDeleteRequest(n)
 }
 
+// WriteTailedNeedle applies a needle tailed from another replica of the volume.
+// A needle with empty size is a deletion.
+func (v *Volume) WriteTailedNeedle(n *needle.Needle) (err error) {
+	if n.Size == 0 {
+		_, err = v.deleteNeedle2(n)
+		return
+	}
+	_, _, _, err = v.writeNeedle2(n, false)
+	return
+}
+
 func (v *Volume) deleteNeedle2(n *needle.Needle) (Size, error) {
 	// todo: delete info is always appended no fsync, it may need fsync in future
 	fsync := false
@@ -205,6 +220,7 @@ func (v *Volume) deleteNeedle2(n *needle.Needle) (Size, error) {
 
 func (v *Volume) doDeleteRequest(n *needle.Needle) (Size, error) {
 	glog.V(4).Infof("delete needle %s", needle.NewFileIdFromNeedle(v.Id, n).String())
+	v.touch()
 	nv, ok := v.nm.Get(n.Id)
 	// fmt.Println("key", n.Id, "volume offset", nv.Offset, "data_size", n.Size, "cached size", nv.Size)
 	if ok && nv.Size.IsValid() {
@@ -305,6 +321,11 @@ func (v *Volume) WriteNeedleBlob(needleId NeedleId, needleBlob []byte, size Size
 	v.dataFileAccessLock.Lock()
 	defer v.dataFileAccessLock.Unlock()
 
+	return v.doWriteNeedleBlob(needleId, needleBlob, size)
+}
+
+func (v *Volume) doWriteNeedleBlob(needleId NeedleId, needleBlob []byte, size Size) error {
+
 	if MaxPossibleVolumeSize < v.nm.ContentSize()+uint64(len(needleBlob)) {
 		return fmt.Errorf("volume size limit %d exceeded! current size is %d", MaxPossibleVolumeSize, v.nm.ContentSize())
 	}
@@ -325,3 +346,40 @@ func (v *Volume) WriteNeedleBlob(needleId NeedleId, needleBlob []byte, size Size
 
 	return err
 }
+
+// undeleteNeedle appends a copy of a deleted needle, which is still in the .dat file before vacuum
+func (v *Volume) undeleteNeedle(n *needle.Needle) (Size, error) {
+	v.dataFileAccessLock.Lock()
+	defer v.dataFileAccessLock.Unlock()
+
+	nv, ok := v.nm.Get(n.Id)
+	if !ok || nv.Offset.IsZero() {
+		return 0, ErrorNotFound
+	}
+	if !nv.Size.IsDeleted() {
+		// already undeleted
+		return nv.Size, nil
+	}
+	if nv.Size == TombstoneFileSize {
+		return 0, fmt.Errorf("needle %d has unknown size", n.Id)
+	}
+
+	size := -nv.Size
+	blob, err := needle.ReadNeedleBlob(v.DataBackend, nv.Offset.ToActualOffset(), size, v.Version())
+	if err != nil {
+		return 0, err
+	}
+	deleted := new(needle.Needle)
+	if err = deleted.ReadBytes(blob, nv.Offset.ToActualOffset(), size, v.Version(), v.ChecksumAlgorithm()); err != nil {
+		return 0, err
+	}
+	if n.Cookie != 0 && n.Cookie != deleted.Cookie {
+		return 0, fmt.Errorf("unexpected cookie %x", n.Cookie)
+	}
+
+	if err = v.doWriteNeedleBlob(n.Id, blob, size); err != nil {
+		return 0, err
+	}
+	glog.V(0).Infof("undelete needle %s", needle.NewFileIdFromNeedle(v.Id, deleted).String())
+	return size, nil
+}
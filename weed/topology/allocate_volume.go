@@ -13,7 +13,7 @@ type AllocateVolumeResult struct {
 	Error string
 }
 
-func AllocateVolume(dn *DataNode, grpcDialOption grpc.DialOption, vid needle.VolumeId, option *VolumeGrowOption) error {
+func AllocateVolume(dn *DataNode, grpcDialOption grpc.DialOption, vid needle.VolumeId, option *VolumeGrowOption, checksumAlgorithm needle.ChecksumAlgorithm, version needle.Version, volumeUuid string) error {
 
 	return operation.WithVolumeServerClient(dn.Url(), grpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
 
@@ -25,6 +25,9 @@ func AllocateVolume(dn *DataNode, grpcDialOption grpc.DialOption, vid needle.Vol
 			Preallocate:        option.Preallocate,
 			MemoryMapMaxSizeMb: option.MemoryMapMaxSizeMb,
 			DiskType:           string(option.DiskType),
+			ChecksumAlgorithm:  uint32(checksumAlgorithm),
+			Uuid:               volumeUuid,
+			Version:            uint32(version),
 		})
 		return deleteErr
 	})
@@ -3,6 +3,7 @@ package topology
 import (
 	"github.com/chrislusf/raft"
 	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/sequence"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 )
 
@@ -29,3 +30,34 @@ func (c *MaxVolumeIdCommand) Apply(server raft.Server) (interface{}, error) {
 
 	return nil, nil
 }
+
+// MaxFileKeyCommand reserves the file keys up to MaxFileKey for the leader Reserver to assign.
+// Reserver is the incarnation of the raft sequencer, different after a restart.
+type MaxFileKeyCommand struct {
+	MaxFileKey uint64 `json:"maxFileKey"`
+	Reserver   string `json:"reserver"`
+}
+
+func NewMaxFileKeyCommand(maxFileKey uint64, reserver string) *MaxFileKeyCommand {
+	return &MaxFileKeyCommand{
+		MaxFileKey: maxFileKey,
+		Reserver:   reserver,
+	}
+}
+
+func (c *MaxFileKeyCommand) CommandName() string {
+	return "MaxFileKey"
+}
+
+func (c *MaxFileKeyCommand) Apply(server raft.Server) (interface{}, error) {
+	topo := server.Context().(*Topology)
+	if seq, ok := topo.Sequence.(*sequence.RaftSequencer); ok {
+		seq.ApplyReservation(c.MaxFileKey, c.Reserver)
+	} else {
+		topo.Sequence.SetMax(c.MaxFileKey)
+	}
+
+	glog.V(1).Infoln("max file key", c.MaxFileKey, "reserved by", c.Reserver)
+
+	return nil, nil
+}
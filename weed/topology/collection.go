@@ -66,6 +66,18 @@ func (c *Collection) Lookup(vid needle.VolumeId) []*DataNode {
 	return nil
 }
 
+// Epoch is the replica membership epoch of the volume, or 0 if not found
+func (c *Collection) Epoch(vid needle.VolumeId) uint64 {
+	for _, vl := range c.storageType2VolumeLayout.Items() {
+		if vl != nil {
+			if epoch := vl.(*VolumeLayout).Epoch(vid); epoch > 0 {
+				return epoch
+			}
+		}
+	}
+	return 0
+}
+
 func (c *Collection) ListVolumeServers() (nodes []*DataNode) {
 	for _, vl := range c.storageType2VolumeLayout.Items() {
 		if vl != nil {
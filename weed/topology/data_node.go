@@ -6,7 +6,6 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/storage/types"
 	"github.com/chrislusf/seaweedfs/weed/util"
-	"strconv"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/storage"
@@ -18,12 +17,22 @@ type DataNode struct {
 	Port      int
 	PublicUrl string
 	LastSeen  int64 // unix time in seconds
+
+	state       string // liveness state, guarded by the node lock
+	connections int    // number of heartbeat streams, more than one if reconnected before the old stream ends
+
+	quarantinedVolumes map[uint32]string             // colliding volume ids to the reasons, guarded by the node lock
+	collidingVolumes   map[uint32]storage.VolumeInfo // the unregistered colliding volumes, guarded by the node lock
+
+	collectionCaps         map[string]*master_pb.CollectionCap // the caps reported by the volume server, guarded by the node lock
+	collectionsOverDiskCap map[string]bool                     // guarded by the node lock
 }
 
 func NewDataNode(id string) *DataNode {
 	dn := &DataNode{}
 	dn.id = NodeId(id)
 	dn.nodeType = "DataNode"
+	dn.state = NodeStateActive
 	dn.diskUsages = newDiskUsages()
 	dn.children = make(map[NodeId]Node)
 	dn.NodeImpl.value = dn
@@ -109,6 +118,11 @@ func (dn *DataNode) DeltaUpdateVolumes(newVolumes, deletedVolumes []storage.Volu
 
 	for _, v := range deletedVolumes {
 		disk := dn.getOrCreateDisk(v.DiskType)
+		if _, found := disk.volumes[v.Id]; !found {
+			// e.g., a colliding volume, never registered
+			delete(dn.collidingVolumes, uint32(v.Id))
+			continue
+		}
 		delete(disk.volumes, v.Id)
 
 		deltaDiskUsages := newDiskUsages()
@@ -206,7 +220,7 @@ func (dn *DataNode) MatchLocation(ip string, port int) bool {
 }
 
 func (dn *DataNode) Url() string {
-	return dn.Ip + ":" + strconv.Itoa(dn.Port)
+	return util.JoinHostPort(dn.Ip, dn.Port)
 }
 
 func (dn *DataNode) ToMap() interface{} {
@@ -232,6 +246,10 @@ func (dn *DataNode) ToMap() interface{} {
 	ret["EcShards"] = ecShardCount
 	ret["Max"] = maxVolumeCount
 	ret["VolumeIds"] = volumeIds
+	ret["State"] = dn.GetState()
+	if collectionCaps := dn.collectionCapsToMap(); len(collectionCaps) > 0 {
+		ret["CollectionCaps"] = collectionCaps
+	}
 
 	return ret
 }
@@ -240,6 +258,7 @@ func (dn *DataNode) ToDataNodeInfo() *master_pb.DataNodeInfo {
 	m := &master_pb.DataNodeInfo{
 		Id:        string(dn.Id()),
 		DiskInfos: make(map[string]*master_pb.DiskInfo),
+		State:     dn.GetState(),
 	}
 	for _, c := range dn.Children() {
 		disk := c.(*Disk)
@@ -0,0 +1,111 @@
+package topology
+
+import (
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+)
+
+// Collection caps limit the volumes of a collection on a volume server shared by several tenants.
+// The caps are configured on the volume server and reported in its heartbeats.
+// A volume server at the volume count cap of a collection gets no new volumes of the collection,
+// and the volumes of a collection at the disk usage cap are not writable on the volume server.
+
+// SyncDataNodeCollectionCaps sets the collection caps reported by the volume server, and updates the writable volumes
+// of the collections going over or back under the disk usage caps
+func (t *Topology) SyncDataNodeCollectionCaps(collectionCaps []*master_pb.CollectionCap, dn *DataNode) {
+	changedCollections := dn.setCollectionCaps(collectionCaps)
+	if len(changedCollections) == 0 {
+		return
+	}
+	for _, v := range dn.GetVolumes() {
+		if changedCollections[v.Collection] {
+			vl := t.GetVolumeLayout(v.Collection, v.ReplicaPlacement, v.Ttl, types.ToDiskType(v.DiskType))
+			vl.EnsureCorrectWritables(&v)
+		}
+	}
+}
+
+// setCollectionCaps returns the collections going over or back under the disk usage caps
+func (dn *DataNode) setCollectionCaps(collectionCaps []*master_pb.CollectionCap) (changedCollections map[string]bool) {
+	diskUsages := make(map[string]uint64)
+	for _, v := range dn.GetVolumes() {
+		diskUsages[v.Collection] += v.Size
+	}
+
+	caps := make(map[string]*master_pb.CollectionCap)
+	overDiskCap := make(map[string]bool)
+	for _, c := range collectionCaps {
+		caps[c.Collection] = c
+		if c.MaxDiskUsage > 0 && diskUsages[c.Collection] >= c.MaxDiskUsage {
+			overDiskCap[c.Collection] = true
+		}
+	}
+
+	dn.Lock()
+	defer dn.Unlock()
+	changedCollections = make(map[string]bool)
+	for collection := range overDiskCap {
+		if !dn.collectionsOverDiskCap[collection] {
+			glog.V(0).Infof("collection %q on %s uses %d bytes, reaching the cap of %d bytes", collection, dn.Url(), diskUsages[collection], caps[collection].MaxDiskUsage)
+			changedCollections[collection] = true
+		}
+	}
+	for collection := range dn.collectionsOverDiskCap {
+		if !overDiskCap[collection] {
+			glog.V(0).Infof("collection %q on %s uses %d bytes, under the disk usage cap", collection, dn.Url(), diskUsages[collection])
+			changedCollections[collection] = true
+		}
+	}
+	dn.collectionCaps, dn.collectionsOverDiskCap = caps, overDiskCap
+	return
+}
+
+// IsCollectionOverDiskCap is true if the volumes of the collection on the volume server reach its disk usage cap
+func (dn *DataNode) IsCollectionOverDiskCap(collection string) bool {
+	dn.RLock()
+	defer dn.RUnlock()
+	return dn.collectionsOverDiskCap[collection]
+}
+
+// AvailableSpaceFor is the free volume slots of the disk type, limited by the caps of the collection
+func (dn *DataNode) AvailableSpaceFor(option *VolumeGrowOption) int64 {
+	freeVolumeSlotCount := dn.NodeImpl.AvailableSpaceFor(option)
+
+	dn.RLock()
+	collectionCap, found := dn.collectionCaps[option.Collection]
+	isOverDiskCap := dn.collectionsOverDiskCap[option.Collection]
+	dn.RUnlock()
+	if !found {
+		return freeVolumeSlotCount
+	}
+	if isOverDiskCap {
+		return 0
+	}
+	if collectionCap.MaxVolumeCount > 0 {
+		var volumeCount int64
+		for _, v := range dn.GetVolumes() {
+			if v.Collection == option.Collection {
+				volumeCount++
+			}
+		}
+		if left := int64(collectionCap.MaxVolumeCount) - volumeCount; left < freeVolumeSlotCount {
+			freeVolumeSlotCount = left
+		}
+	}
+	return freeVolumeSlotCount
+}
+
+func (dn *DataNode) collectionCapsToMap() map[string]interface{} {
+	dn.RLock()
+	defer dn.RUnlock()
+	ret := make(map[string]interface{})
+	for collection, c := range dn.collectionCaps {
+		ret[collection] = map[string]interface{}{
+			"MaxVolumeCount": c.MaxVolumeCount,
+			"MaxDiskUsage":   c.MaxDiskUsage,
+			"OverDiskCap":    dn.collectionsOverDiskCap[collection],
+		}
+	}
+	return ret
+}
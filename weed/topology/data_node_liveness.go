@@ -0,0 +1,124 @@
+package topology
+
+import (
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+)
+
+const (
+	// NodeStateActive means the volume server sends heartbeats regularly
+	NodeStateActive = "active"
+	// NodeStateSuspect means the volume server is disconnected or misses heartbeats.
+	// Its volumes are not writable, but are still returned in lookups.
+	NodeStateSuspect = "suspect"
+	// NodeStateDead means the volume server is not seen for the grace period, and is removed from the topology
+	NodeStateDead = "dead"
+)
+
+// SetNodeTimeouts sets how long a volume server can miss heartbeats before it becomes suspect,
+// and before it becomes dead and its volume locations are removed from lookups
+func (t *Topology) SetNodeTimeouts(suspectTimeout, deadTimeout time.Duration) {
+	t.nodeSuspectTimeout = suspectTimeout
+	t.nodeDeadTimeout = deadTimeout
+}
+
+// DataNodeConnected is called when a heartbeat stream from the volume server starts
+func (t *Topology) DataNodeConnected(dn *DataNode) {
+	dn.Lock()
+	dn.connections++
+	dn.Unlock()
+	t.DataNodeHeartbeat(dn)
+}
+
+// DataNodeDisconnected is called when a heartbeat stream from the volume server ends.
+// The volume server becomes suspect unless it has already reconnected.
+func (t *Topology) DataNodeDisconnected(dn *DataNode) {
+	dn.Lock()
+	dn.connections--
+	isSuspect := dn.connections <= 0 && dn.state == NodeStateActive
+	if isSuspect {
+		dn.state = NodeStateSuspect
+	}
+	dn.Unlock()
+	if isSuspect {
+		glog.V(0).Infof("volume server %s disconnected, becomes %s", dn.Url(), NodeStateSuspect)
+		t.ensureCorrectWritables(dn)
+	}
+}
+
+// DataNodeHeartbeat records a heartbeat from the volume server, and makes a suspect volume server active again
+func (t *Topology) DataNodeHeartbeat(dn *DataNode) {
+	dn.Lock()
+	dn.LastSeen = time.Now().Unix()
+	wasSuspect := dn.state == NodeStateSuspect
+	if wasSuspect {
+		dn.state = NodeStateActive
+	}
+	dn.Unlock()
+	if wasSuspect {
+		glog.V(0).Infof("volume server %s becomes %s", dn.Url(), NodeStateActive)
+		t.ensureCorrectWritables(dn)
+	}
+}
+
+// CollectDeadDataNodes moves the volume servers without heartbeats to the suspect or dead state,
+// and unregisters the dead ones, which are returned
+func (t *Topology) CollectDeadDataNodes(now time.Time) (deadNodes []*DataNode) {
+	suspectThreshold := now.Add(-t.nodeSuspectTimeout).Unix()
+	deadThreshold := now.Add(-t.nodeDeadTimeout).Unix()
+	for _, dn := range t.getDataNodes() {
+		dn.Lock()
+		previousState := dn.state
+		if dn.LastSeen < deadThreshold {
+			dn.state = NodeStateDead
+		} else if dn.LastSeen < suspectThreshold && dn.state == NodeStateActive {
+			dn.state = NodeStateSuspect
+		}
+		state := dn.state
+		dn.Unlock()
+
+		switch {
+		case state == NodeStateDead && previousState != NodeStateDead:
+			glog.V(0).Infof("volume server %s not seen for %v, becomes %s", dn.Url(), t.nodeDeadTimeout, NodeStateDead)
+			t.notifyDataNodeEvent(EventNodeLeave, dn)
+			t.UnRegisterDataNode(dn)
+			deadNodes = append(deadNodes, dn)
+		case state == NodeStateSuspect && previousState == NodeStateActive:
+			glog.V(0).Infof("volume server %s not seen for %v, becomes %s", dn.Url(), t.nodeSuspectTimeout, NodeStateSuspect)
+			t.ensureCorrectWritables(dn)
+		}
+	}
+	return
+}
+
+// ensureCorrectWritables updates the writable volumes after the volume server state changes
+func (t *Topology) ensureCorrectWritables(dn *DataNode) {
+	for _, v := range dn.GetVolumes() {
+		vl := t.GetVolumeLayout(v.Collection, v.ReplicaPlacement, v.Ttl, types.ToDiskType(v.DiskType))
+		vl.EnsureCorrectWritables(&v)
+	}
+}
+
+func (t *Topology) getDataNodes() (dataNodes []*DataNode) {
+	for _, c := range t.Children() {
+		for _, r := range c.(*DataCenter).Children() {
+			for _, n := range r.(*Rack).Children() {
+				dataNodes = append(dataNodes, n.(*DataNode))
+			}
+		}
+	}
+	return
+}
+
+// GetState returns the liveness state of the volume server
+func (dn *DataNode) GetState() string {
+	dn.RLock()
+	defer dn.RUnlock()
+	return dn.state
+}
+
+func (dn *DataNode) IsActive() bool {
+	return dn.GetState() == NodeStateActive
+}
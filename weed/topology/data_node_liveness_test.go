@@ -0,0 +1,105 @@
+package topology
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/sequence"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+)
+
+func TestDataNodeLiveness(t *testing.T) {
+	topo := NewTopology("weedfs", sequence.NewMemorySequencer(), 32*1024, 5, false)
+	topo.SetNodeTimeouts(15*time.Second, 60*time.Second)
+
+	rack := topo.GetOrCreateDataCenter("dc1").GetOrCreateRack("rack1")
+	dn := rack.GetOrCreateDataNode("127.0.0.1", 34534, "127.0.0.1", map[string]uint32{"": 25})
+	topo.DataNodeConnected(dn)
+	topo.SyncDataNodeRegistration([]*master_pb.VolumeInformationMessage{
+		{Id: 1, Size: 100, Version: uint32(needle.CurrentVersion)},
+	}, dn)
+
+	rp, _ := super_block.NewReplicaPlacementFromString("000")
+	vl := topo.GetVolumeLayout("", rp, needle.EMPTY_TTL, types.HardDriveType)
+	writables := func() int {
+		vl.accessLock.RLock()
+		defer vl.accessLock.RUnlock()
+		return len(vl.writables)
+	}
+	assert(t, "writables", writables(), 1)
+
+	// a disconnected volume server is not written to, but still found in lookups
+	topo.DataNodeDisconnected(dn)
+	if dn.GetState() != NodeStateSuspect {
+		t.Fatalf("unexpected state %s after disconnect", dn.GetState())
+	}
+	assert(t, "suspect writables", writables(), 0)
+	assert(t, "suspect lookups", len(topo.Lookup("", 1)), 1)
+
+	// reconnecting within the grace period makes it active again
+	topo.DataNodeConnected(dn)
+	if dn.GetState() != NodeStateActive {
+		t.Fatalf("unexpected state %s after reconnect", dn.GetState())
+	}
+	assert(t, "reconnected writables", writables(), 1)
+
+	// missing heartbeats
+	now := time.Now()
+	if dead := topo.CollectDeadDataNodes(now.Add(20 * time.Second)); len(dead) != 0 || dn.GetState() != NodeStateSuspect {
+		t.Fatalf("unexpected state %s, dead nodes %v", dn.GetState(), dead)
+	}
+	assert(t, "missing heartbeats writables", writables(), 0)
+	assert(t, "missing heartbeats lookups", len(topo.Lookup("", 1)), 1)
+
+	if dead := topo.CollectDeadDataNodes(now.Add(70 * time.Second)); len(dead) != 1 || dn.GetState() != NodeStateDead {
+		t.Fatalf("unexpected state %s, dead nodes %v", dn.GetState(), dead)
+	}
+	assert(t, "dead lookups", len(topo.Lookup("", 1)), 0)
+
+	// a dead volume server stays dead until it registers again
+	topo.DataNodeHeartbeat(dn)
+	if dn.GetState() != NodeStateDead {
+		t.Fatalf("unexpected state %s after heartbeat of a dead node", dn.GetState())
+	}
+}
+
+func TestDataNodeLeaveEvents(t *testing.T) {
+	topo := NewTopology("weedfs", sequence.NewMemorySequencer(), 32*1024, 5, false)
+	topo.SetNodeTimeouts(15*time.Second, 60*time.Second)
+	var events []*TopologyEvent
+	topo.SetEventListener(func(event *TopologyEvent) {
+		events = append(events, event)
+	})
+
+	rack := topo.GetOrCreateDataCenter("dc1").GetOrCreateRack("rack1")
+	var dns []*DataNode
+	for _, port := range []int{34534, 34535} {
+		dn := rack.GetOrCreateDataNode("127.0.0.1", port, "127.0.0.1", map[string]uint32{"": 25})
+		topo.DataNodeConnected(dn)
+		topo.SyncDataNodeRegistration([]*master_pb.VolumeInformationMessage{
+			{Id: 1, Size: 100, ReplicaPlacement: 1, Version: uint32(needle.CurrentVersion)},
+		}, dn)
+		dns = append(dns, dn)
+	}
+
+	// only the first volume server misses the heartbeats
+	now := time.Now()
+	topo.DataNodeHeartbeat(dns[1])
+	dns[1].LastSeen = now.Add(65 * time.Second).Unix()
+	if dead := topo.CollectDeadDataNodes(now.Add(70 * time.Second)); len(dead) != 1 || dead[0] != dns[0] {
+		t.Fatalf("unexpected dead nodes %v", dead)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if e := events[0]; e.Type != EventNodeLeave || e.DataNode != dns[0].Url() || e.DataCenter != "dc1" || e.Rack != "rack1" {
+		t.Errorf("unexpected node leave event %+v", e)
+	}
+	if e := events[1]; e.Type != EventReplicaLost || e.VolumeId != 1 || e.Replicas != 1 || e.ExpectedReplicas != 2 {
+		t.Errorf("unexpected replica lost event %+v", e)
+	}
+}
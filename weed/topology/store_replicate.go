@@ -16,20 +16,28 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/storage/types"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 )
 
-func ReplicatedWrite(masterFn operation.GetMasterFn, s *storage.Store, volumeId needle.VolumeId, n *needle.Needle, r *http.Request) (isUnchanged bool, err error) {
+// ReplicatedWrite writes the needle locally, and to the other replicas if this is the initial request.
+// With the asyncReplicator, the replicas in the other data centers are written in the background.
+func ReplicatedWrite(masterFn operation.GetMasterFn, s *storage.Store, volumeId needle.VolumeId, n *needle.Needle, r *http.Request, asyncReplicator *AsyncReplicator) (isUnchanged bool, err error) {
 
 	//check JWT
 	jwt := security.GetJwt(r)
 
+	if err = checkWriteEpoch(s, volumeId, r); err != nil {
+		glog.V(0).InfofCtx(r.Context(), "%v", err)
+		return
+	}
+
 	// check whether this is a replicated write request
 	var remoteLocations []operation.Location
 	if r.FormValue("type") != "replicate" {
 		// this is the initial request
 		remoteLocations, err = getWritableRemoteReplications(s, volumeId, masterFn)
 		if err != nil {
-			glog.V(0).Infoln(err)
+			glog.V(0).InfofCtx(r.Context(), "%v", err)
 			return
 		}
 	}
@@ -44,61 +52,114 @@ func ReplicatedWrite(masterFn operation.GetMasterFn, s *storage.Store, volumeId
 		isUnchanged, err = s.WriteVolumeNeedle(volumeId, n, fsync)
 		if err != nil {
 			err = fmt.Errorf("failed to write to local disk: %v", err)
-			glog.V(0).Infoln(err)
+			glog.V(0).InfofCtx(r.Context(), "%v", err)
 			return
 		}
 	}
 
+	if len(remoteLocations) > 0 && asyncReplicator != nil {
+		// the queued needle can not keep the request buffer, which is reused by the next request
+		queuedNeedle := *n
+		queuedNeedle.Data = append([]byte(nil), n.Data...)
+		remoteLocations = asyncReplicator.replicateToOtherDataCenters(s.GetDataCenter(), remoteLocations, volumeId,
+			needle.NewFileIdFromNeedle(volumeId, n).String(), replicateNeedleFn(r.URL.Path, &queuedNeedle, s.GetVolumeEpoch(volumeId), request_id.Get(r.Context())))
+	}
+
 	if len(remoteLocations) > 0 { //send to other replica locations
-		if err = distributedOperation(remoteLocations, s, func(location operation.Location) error {
-			u := url.URL{
-				Scheme: "http",
-				Host:   location.Url,
-				Path:   r.URL.Path,
-			}
-			q := url.Values{
-				"type": {"replicate"},
-				"ttl":  {n.Ttl.String()},
+		requestId := request_id.Get(r.Context())
+		if err = distributedEpochOperation(masterFn, s, volumeId, remoteLocations, func(location operation.Location, epoch uint64) error {
+			return replicateNeedleFn(r.URL.Path, n, epoch, requestId)(location, jwt)
+		}); err != nil {
+			err = fmt.Errorf("failed to write to replicas for volume %d: %v", volumeId, err)
+			glog.V(0).InfofCtx(r.Context(), "%v", err)
+		}
+	}
+	return
+}
+
+// checkWriteEpoch rejects the write carrying an older replica membership epoch than the local volume,
+// before anything is written locally
+func checkWriteEpoch(s *storage.Store, volumeId needle.VolumeId, r *http.Request) error {
+	epochString := r.FormValue("epoch")
+	if epochString == "" {
+		return nil
+	}
+	epoch, err := strconv.ParseUint(epochString, 10, 64)
+	if err != nil {
+		return fmt.Errorf("parse epoch %s: %v", epochString, err)
+	}
+	return s.CheckVolumeEpoch(volumeId, epoch)
+}
+
+// replicateNeedleFn sends the needle to a replica, with the epoch of this replica to be checked by the other replica,
+// and the request id of the initial request
+func replicateNeedleFn(path string, n *needle.Needle, epoch uint64, requestId string) replicateFunc {
+	return func(location operation.Location, jwt security.EncodedJwt) error {
+		u := url.URL{
+			Scheme: "http",
+			Host:   location.Url,
+			Path:   path,
+		}
+		q := url.Values{
+			"type": {"replicate"},
+			"ttl":  {n.Ttl.String()},
+		}
+		if n.LastModified > 0 {
+			q.Set("ts", strconv.FormatUint(n.LastModified, 10))
+		}
+		if n.IsChunkedManifest() {
+			q.Set("cm", "true")
+		}
+		if epoch > 0 {
+			q.Set("epoch", strconv.FormatUint(epoch, 10))
+		}
+		u.RawQuery = q.Encode()
+
+		pairMap := make(map[string]string)
+		if n.HasPairs() {
+			tmpMap := make(map[string]string)
+			err := json.Unmarshal(n.Pairs, &tmpMap)
+			if err != nil {
+				glog.V(0).Infoln("Unmarshal pairs error:", err)
 			}
-			if n.LastModified > 0 {
-				q.Set("ts", strconv.FormatUint(n.LastModified, 10))
+			for k, v := range tmpMap {
+				pairMap[needle.PairNamePrefix+k] = v
 			}
-			if n.IsChunkedManifest() {
-				q.Set("cm", "true")
+		}
+		if n.HasMetadata() {
+			metadata, err := n.GetMetadata()
+			if err != nil {
+				glog.V(0).Infoln("decode needle metadata error:", err)
 			}
-			u.RawQuery = q.Encode()
-
-			pairMap := make(map[string]string)
-			if n.HasPairs() {
-				tmpMap := make(map[string]string)
-				err := json.Unmarshal(n.Pairs, &tmpMap)
-				if err != nil {
-					glog.V(0).Infoln("Unmarshal pairs error:", err)
-				}
-				for k, v := range tmpMap {
-					pairMap[needle.PairNamePrefix+k] = v
-				}
+			for k, v := range metadata {
+				pairMap[needle.MetadataNamePrefix+k] = v
 			}
-
-			// volume server do not know about encryption
-			// TODO optimize here to compress data only once
-			_, err := operation.UploadData(u.String(), string(n.Name), false, n.Data, n.IsCompressed(), string(n.Mime), pairMap, jwt)
-			return err
-		}); err != nil {
-			err = fmt.Errorf("failed to write to replicas for volume %d: %v", volumeId, err)
-			glog.V(0).Infoln(err)
 		}
+		if requestId != "" {
+			pairMap[request_id.Header] = requestId
+		}
+
+		// volume server do not know about encryption
+		// TODO optimize here to compress data only once
+		_, err := operation.UploadData(u.String(), string(n.Name), false, n.Data, n.IsCompressed(), string(n.Mime), pairMap, jwt)
+		return err
 	}
-	return
 }
 
+// ReplicatedDelete deletes the needle locally, and from the other replicas if this is the initial request.
+// With the asyncReplicator, the replicas in the other data centers are deleted in the background.
 func ReplicatedDelete(masterFn operation.GetMasterFn, store *storage.Store,
 	volumeId needle.VolumeId, n *needle.Needle,
-	r *http.Request) (size types.Size, err error) {
+	r *http.Request, asyncReplicator *AsyncReplicator) (size types.Size, err error) {
 
 	//check JWT
 	jwt := security.GetJwt(r)
 
+	if err = checkWriteEpoch(store, volumeId, r); err != nil {
+		glog.V(0).Infoln(err)
+		return
+	}
+
 	var remoteLocations []operation.Location
 	if r.FormValue("type") != "replicate" {
 		remoteLocations, err = getWritableRemoteReplications(store, volumeId, masterFn)
@@ -114,9 +175,24 @@ func ReplicatedDelete(masterFn operation.GetMasterFn, store *storage.Store,
 		return
 	}
 
+	replicateFn := func(epoch uint64) replicateFunc {
+		path := r.URL.Path + "?type=replicate"
+		if epoch > 0 {
+			path += "&epoch=" + strconv.FormatUint(epoch, 10)
+		}
+		return func(location operation.Location, jwt security.EncodedJwt) error {
+			return util.Delete("http://"+location.Url+path, string(jwt))
+		}
+	}
+
+	if len(remoteLocations) > 0 && asyncReplicator != nil {
+		remoteLocations = asyncReplicator.replicateToOtherDataCenters(store.GetDataCenter(), remoteLocations, volumeId,
+			needle.NewFileIdFromNeedle(volumeId, n).String(), replicateFn(store.GetVolumeEpoch(volumeId)))
+	}
+
 	if len(remoteLocations) > 0 { //send to other replica locations
-		if err = distributedOperation(remoteLocations, store, func(location operation.Location) error {
-			return util.Delete("http://"+location.Url+r.URL.Path+"?type=replicate", string(jwt))
+		if err = distributedEpochOperation(masterFn, store, volumeId, remoteLocations, func(location operation.Location, epoch uint64) error {
+			return replicateFn(epoch)(location, jwt)
 		}); err != nil {
 			size = 0
 		}
@@ -161,6 +237,28 @@ func distributedOperation(locations []operation.Location, store *storage.Store,
 	return ret.Error()
 }
 
+// distributedEpochOperation runs the operation on the replicas with the replica membership epoch of this volume server.
+// The replicas can adopt a newer epoch from the master earlier than this volume server, and reject the operation,
+// so the operation is retried once after this volume server also adopts the newer epoch from the master.
+func distributedEpochOperation(masterFn operation.GetMasterFn, s *storage.Store, volumeId needle.VolumeId, locations []operation.Location, op func(location operation.Location, epoch uint64) error) error {
+	epoch := s.GetVolumeEpoch(volumeId)
+	err := distributedOperation(locations, s, func(location operation.Location) error {
+		return op(location, epoch)
+	})
+	if err == nil || epoch == 0 {
+		return err
+	}
+	lookupResult, lookupErr := operation.LookupNoCache(masterFn, volumeId.String())
+	if lookupErr != nil || lookupResult.Epoch <= epoch {
+		return err
+	}
+	glog.V(0).Infof("volume %d retries the replication with the newer epoch %d than %d: %v", volumeId, lookupResult.Epoch, epoch, err)
+	s.SetVolumeEpoch(volumeId, lookupResult.Epoch)
+	return distributedOperation(locations, s, func(location operation.Location) error {
+		return op(location, lookupResult.Epoch)
+	})
+}
+
 func getWritableRemoteReplications(s *storage.Store, volumeId needle.VolumeId, masterFn operation.GetMasterFn) (
 	remoteLocations []operation.Location, err error) {
 
@@ -172,7 +270,9 @@ func getWritableRemoteReplications(s *storage.Store, volumeId needle.VolumeId, m
 	// not on local store, or has replications
 	lookupResult, lookupErr := operation.Lookup(masterFn, volumeId.String())
 	if lookupErr == nil {
-		selfUrl := s.Ip + ":" + strconv.Itoa(s.Port)
+		// adopt the newer epoch before writing locally, not to be rejected by the replicas knowing it
+		s.SetVolumeEpoch(volumeId, lookupResult.Epoch)
+		selfUrl := util.JoinHostPort(s.Ip, s.Port)
 		for _, location := range lookupResult.Locations {
 			if location.Url != selfUrl {
 				remoteLocations = append(remoteLocations, location)
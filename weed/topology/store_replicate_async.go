@@ -0,0 +1,126 @@
+package topology
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+)
+
+const asyncReplicationRetries = 5
+
+// replicateFunc sends one write or delete to the replica location
+type replicateFunc func(location operation.Location, jwt security.EncodedJwt) error
+
+type asyncReplication struct {
+	volumeId  needle.VolumeId
+	fileId    string
+	replicate replicateFunc
+}
+
+// AsyncReplicator replicates the writes and deletes to the replicas in the other data centers in the background,
+// after the replicas in the local data center are written.
+// Each replica location has a queue of queueSize, and the writes wait when the queue is full,
+// so the replicas in the other data centers lag behind by at most queueSize writes.
+// The volume failing to replicate after the retries is marked by markOutOfSyncFn, to be synced by volume.check.disk.
+type AsyncReplicator struct {
+	queueSize       int
+	signingKeyFn    func() (security.SigningKey, int)
+	markOutOfSyncFn func(volumeId needle.VolumeId) error
+	retryWait       time.Duration
+	queues          map[string]chan *asyncReplication
+	queuesLock      sync.Mutex
+}
+
+// NewAsyncReplicator creates the replicator, which signs the jwt of each replication with the current signing key,
+// since the jwt of the original request may expire while queued
+func NewAsyncReplicator(queueSize int, signingKeyFn func() (security.SigningKey, int), markOutOfSyncFn func(volumeId needle.VolumeId) error) *AsyncReplicator {
+	return &AsyncReplicator{
+		queueSize:       queueSize,
+		signingKeyFn:    signingKeyFn,
+		markOutOfSyncFn: markOutOfSyncFn,
+		retryWait:       time.Second,
+		queues:          make(map[string]chan *asyncReplication),
+	}
+}
+
+// splitByDataCenter separates the replica locations in the other data centers, which can be replicated asynchronously.
+// The locations without a known data center are treated as local.
+func splitByDataCenter(dataCenter string, locations []operation.Location) (localLocations, otherLocations []operation.Location) {
+	for _, location := range locations {
+		if dataCenter != "" && location.DataCenter != "" && location.DataCenter != dataCenter {
+			otherLocations = append(otherLocations, location)
+		} else {
+			localLocations = append(localLocations, location)
+		}
+	}
+	return
+}
+
+// replicateToOtherDataCenters queues the replications to the locations in the other data centers,
+// and returns the locations in the local data center to replicate synchronously
+func (ar *AsyncReplicator) replicateToOtherDataCenters(dataCenter string, locations []operation.Location, volumeId needle.VolumeId, fileId string, replicate replicateFunc) (localLocations []operation.Location) {
+	localLocations, otherLocations := splitByDataCenter(dataCenter, locations)
+	for _, location := range otherLocations {
+		ar.enqueue(location, &asyncReplication{volumeId: volumeId, fileId: fileId, replicate: replicate})
+	}
+	return
+}
+
+// enqueue waits when the queue of the location is full, instead of replicating synchronously,
+// to keep the replications in the same order as the local writes
+func (ar *AsyncReplicator) enqueue(location operation.Location, replication *asyncReplication) {
+	queue := ar.getQueue(location)
+	select {
+	case queue <- replication:
+	default:
+		stats.VolumeServerAsyncReplicationCounter.WithLabelValues("queueFull").Inc()
+		queue <- replication
+	}
+	stats.VolumeServerAsyncReplicationQueueGauge.WithLabelValues(location.Url).Set(float64(len(queue)))
+}
+
+func (ar *AsyncReplicator) getQueue(location operation.Location) chan *asyncReplication {
+	ar.queuesLock.Lock()
+	defer ar.queuesLock.Unlock()
+	queue, found := ar.queues[location.Url]
+	if !found {
+		queue = make(chan *asyncReplication, ar.queueSize)
+		ar.queues[location.Url] = queue
+		go ar.loopReplicating(location, queue)
+	}
+	return queue
+}
+
+// loopReplicating replicates to one location in the queued order, so a later delete is not overtaken by an earlier write.
+// The replication still failing after the retries is not kept, but its volume is marked for repair and reported to the master,
+// instead of blocking the replications of the other volumes to the same location.
+func (ar *AsyncReplicator) loopReplicating(location operation.Location, queue chan *asyncReplication) {
+	for replication := range queue {
+		stats.VolumeServerAsyncReplicationQueueGauge.WithLabelValues(location.Url).Set(float64(len(queue)))
+		waitTime := ar.retryWait
+		var err error
+		for i := 0; i < asyncReplicationRetries; i++ {
+			signingKey, expiresAfterSec := ar.signingKeyFn()
+			if err = replication.replicate(location, security.GenJwt(signingKey, expiresAfterSec, replication.fileId)); err == nil {
+				break
+			}
+			glog.V(1).Infof("async replicate %s to %s: %v", replication.fileId, location.Url, err)
+			time.Sleep(waitTime)
+			waitTime *= 2
+		}
+		if err != nil {
+			glog.Errorf("failed to async replicate %s to %s: %v", replication.fileId, location.Url, err)
+			stats.VolumeServerAsyncReplicationCounter.WithLabelValues("failed").Inc()
+			if markErr := ar.markOutOfSyncFn(replication.volumeId); markErr != nil {
+				glog.Errorf("mark volume %d replicas out of sync: %v", replication.volumeId, markErr)
+			}
+			continue
+		}
+		stats.VolumeServerAsyncReplicationCounter.WithLabelValues("replicated").Inc()
+	}
+}
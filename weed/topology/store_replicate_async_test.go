@@ -0,0 +1,98 @@
+package topology
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+)
+
+func TestSplitByDataCenter(t *testing.T) {
+	locations := []operation.Location{
+		{Url: "a:8080", DataCenter: "dc1"},
+		{Url: "b:8080", DataCenter: "dc2"},
+		{Url: "c:8080"},
+	}
+
+	local, other := splitByDataCenter("dc1", locations)
+	if !reflect.DeepEqual(local, []operation.Location{locations[0], locations[2]}) || !reflect.DeepEqual(other, locations[1:2]) {
+		t.Errorf("unexpected split: %v, %v", local, other)
+	}
+
+	local, other = splitByDataCenter("", locations)
+	if !reflect.DeepEqual(local, locations) || len(other) != 0 {
+		t.Errorf("unexpected split without data center: %v, %v", local, other)
+	}
+}
+
+func TestAsyncReplicatorKeepsOrder(t *testing.T) {
+	ar := NewAsyncReplicator(2, func() (security.SigningKey, int) {
+		return security.SigningKey("secret"), 10
+	}, func(volumeId needle.VolumeId) error {
+		t.Errorf("volume %d marked out of sync", volumeId)
+		return nil
+	})
+	locations := []operation.Location{
+		{Url: "a:8080", DataCenter: "dc1"},
+		{Url: "b:8080", DataCenter: "dc2"},
+	}
+
+	var replicated []string
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	for i := 0; i < 10; i++ {
+		fileId := fmt.Sprintf("3,%02x", i)
+		wg.Add(1)
+		syncLocations := ar.replicateToOtherDataCenters("dc1", locations, 3, fileId, func(location operation.Location, jwt security.EncodedJwt) error {
+			defer wg.Done()
+			if location.Url != "b:8080" || jwt == "" {
+				t.Errorf("unexpected replication of %s to %s with jwt %q", fileId, location.Url, jwt)
+			}
+			lock.Lock()
+			replicated = append(replicated, fileId)
+			lock.Unlock()
+			return nil
+		})
+		if !reflect.DeepEqual(syncLocations, locations[:1]) {
+			t.Errorf("unexpected synchronous locations: %v", syncLocations)
+		}
+	}
+	wg.Wait()
+
+	expected := []string{"3,00", "3,01", "3,02", "3,03", "3,04", "3,05", "3,06", "3,07", "3,08", "3,09"}
+	if !reflect.DeepEqual(replicated, expected) {
+		t.Errorf("replicated out of order: %v", replicated)
+	}
+}
+
+func TestAsyncReplicatorMarksOutOfSync(t *testing.T) {
+	marked := make(chan needle.VolumeId, 1)
+	ar := NewAsyncReplicator(2, func() (security.SigningKey, int) {
+		return security.SigningKey("secret"), 10
+	}, func(volumeId needle.VolumeId) error {
+		marked <- volumeId
+		return nil
+	})
+	ar.retryWait = time.Millisecond
+	locations := []operation.Location{{Url: "b:8080", DataCenter: "dc2"}}
+
+	attempts := 0
+	ar.replicateToOtherDataCenters("dc1", locations, 3, "3,01", func(location operation.Location, jwt security.EncodedJwt) error {
+		attempts++
+		return fmt.Errorf("replica down")
+	})
+
+	select {
+	case volumeId := <-marked:
+		if volumeId != 3 || attempts != asyncReplicationRetries {
+			t.Errorf("marked volume %d after %d attempts", volumeId, attempts)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("volume not marked out of sync after the failed replication")
+	}
+}
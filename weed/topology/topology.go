@@ -21,6 +21,7 @@ import (
 
 type Topology struct {
 	vacuumLockCounter int64
+	isVacuumDisabled  int32
 	NodeImpl
 
 	collectionMap  *util.ConcurrentReadMap
@@ -29,8 +30,16 @@ type Topology struct {
 
 	pulse int64
 
-	volumeSizeLimit  uint64
-	replicationAsMin bool
+	nodeSuspectTimeout time.Duration
+	nodeDeadTimeout    time.Duration
+
+	volumeSizeLimit   uint64
+	replicationAsMin  bool
+	checksumAlgorithm needle.ChecksumAlgorithm
+	volumeVersion     needle.Version
+
+	quarantineCollisions    bool
+	collisionsDeferredUntil int64 // unix nanoseconds, accessed atomically
 
 	Sequence sequence.Sequencer
 
@@ -40,6 +49,8 @@ type Topology struct {
 	Configuration *Configuration
 
 	RaftServer raft.Server
+
+	eventListener func(event *TopologyEvent)
 }
 
 func NewTopology(id string, seq sequence.Sequencer, volumeSizeLimit uint64, pulse int, replicationAsMin bool) *Topology {
@@ -52,8 +63,11 @@ func NewTopology(id string, seq sequence.Sequencer, volumeSizeLimit uint64, puls
 	t.collectionMap = util.NewConcurrentReadMap()
 	t.ecShardMap = make(map[needle.VolumeId]*EcShardLocations)
 	t.pulse = int64(pulse)
+	t.nodeSuspectTimeout = time.Duration(3*pulse) * time.Second
+	t.nodeDeadTimeout = time.Duration(12*pulse) * time.Second
 	t.volumeSizeLimit = volumeSizeLimit
 	t.replicationAsMin = replicationAsMin
+	t.volumeVersion = needle.CurrentVersion
 
 	t.Sequence = seq
 
@@ -65,6 +79,16 @@ func NewTopology(id string, seq sequence.Sequencer, volumeSizeLimit uint64, puls
 	return t
 }
 
+// SetChecksumAlgorithm sets the needle checksum algorithm of the new volumes
+func (t *Topology) SetChecksumAlgorithm(checksumAlgorithm needle.ChecksumAlgorithm) {
+	t.checksumAlgorithm = checksumAlgorithm
+}
+
+// SetVolumeVersion sets the needle version of the new volumes
+func (t *Topology) SetVolumeVersion(version needle.Version) {
+	t.volumeVersion = version
+}
+
 func (t *Topology) IsLeader() bool {
 	if t.RaftServer != nil {
 		if t.RaftServer.State() == raft.Leader {
@@ -120,6 +144,20 @@ func (t *Topology) Lookup(collection string, vid needle.VolumeId) (dataNodes []*
 	return nil
 }
 
+// LookupEpoch finds the replica membership epoch of the volume, or 0 if not found
+func (t *Topology) LookupEpoch(collection string, vid needle.VolumeId) uint64 {
+	if collection == "" {
+		for _, c := range t.collectionMap.Items() {
+			if epoch := c.(*Collection).Epoch(vid); epoch > 0 {
+				return epoch
+			}
+		}
+	} else if c, ok := t.collectionMap.Find(collection); ok {
+		return c.(*Collection).Epoch(vid)
+	}
+	return 0
+}
+
 func (t *Topology) NextVolumeId() (needle.VolumeId, error) {
 	vid := t.GetMaxVolumeId()
 	next := vid.Next()
@@ -129,6 +167,16 @@ func (t *Topology) NextVolumeId() (needle.VolumeId, error) {
 	return next, nil
 }
 
+// ReserveFileKeys reserves the file keys up to maxFileKey through the raft log, for the raft sequencer
+func (t *Topology) ReserveFileKeys(maxFileKey uint64) error {
+	seq, ok := t.Sequence.(*sequence.RaftSequencer)
+	if !ok {
+		return fmt.Errorf("sequencer %T does not reserve file keys", t.Sequence)
+	}
+	_, err := t.RaftServer.Do(NewMaxFileKeyCommand(maxFileKey, seq.Incarnation()))
+	return err
+}
+
 // deprecated
 func (t *Topology) HasWritableVolume(option *VolumeGrowOption) bool {
 	vl := t.GetVolumeLayout(option.Collection, option.ReplicaPlacement, option.Ttl, option.DiskType)
@@ -145,9 +193,39 @@ func (t *Topology) PickForWrite(count uint64, option *VolumeGrowOption) (string,
 		return "", 0, nil, fmt.Errorf("no writable volumes available for collection:%s replication:%s ttl:%s", option.Collection, option.ReplicaPlacement.String(), option.Ttl.String())
 	}
 	fileId := t.Sequence.NextFileId(count)
+	if fileId == 0 {
+		return "", 0, nil, fmt.Errorf("failed to get file id sequence")
+	}
 	return needle.NewFileId(*vid, fileId, rand.Uint32()).String(), count, datanodes.Head(), nil
 }
 
+// MaxAssignBatchCount limits the file ids assigned in one call
+const MaxAssignBatchCount = 1000
+
+// PickForWriteBatch assigns batchCount file ids, spread over different volumes if possible.
+// Each file id can be used count times.
+func (t *Topology) PickForWriteBatch(count uint64, batchCount int, option *VolumeGrowOption) (fids []string, dns []*DataNode, err error) {
+	if batchCount > MaxAssignBatchCount {
+		return nil, nil, fmt.Errorf("batch count %d exceeds the limit %d", batchCount, MaxAssignBatchCount)
+	}
+	vids, locationLists, err := t.GetVolumeLayout(option.Collection, option.ReplicaPlacement, option.Ttl, option.DiskType).PickForWriteBatch(batchCount, option)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find writable volumes for collection:%s replication:%s ttl:%s error: %v", option.Collection, option.ReplicaPlacement.String(), option.Ttl.String(), err)
+	}
+	for i, vid := range vids {
+		if locationLists[i].Length() == 0 {
+			return nil, nil, fmt.Errorf("no writable volumes available for collection:%s replication:%s ttl:%s", option.Collection, option.ReplicaPlacement.String(), option.Ttl.String())
+		}
+		fileId := t.Sequence.NextFileId(count)
+		if fileId == 0 {
+			return nil, nil, fmt.Errorf("failed to get file id sequence")
+		}
+		fids = append(fids, needle.NewFileId(vid, fileId, rand.Uint32()).String())
+		dns = append(dns, locationLists[i].Head())
+	}
+	return
+}
+
 func (t *Topology) GetVolumeLayout(collectionName string, rp *super_block.ReplicaPlacement, ttl *needle.TTL, diskType types.DiskType) *VolumeLayout {
 	return t.collectionMap.Get(collectionName, func() interface{} {
 		return NewCollection(collectionName, t.volumeSizeLimit, t.replicationAsMin)
@@ -236,6 +314,7 @@ func (t *Topology) SyncDataNodeRegistration(volumes []*master_pb.VolumeInformati
 			glog.V(0).Infof("Fail to convert joined volume information: %v", err)
 		}
 	}
+	volumeInfos = t.filterCollidingVolumes(volumeInfos, dn)
 	// find out the delta volumes
 	var changedVolumes []storage.VolumeInfo
 	newVolumes, deletedVolumes, changedVolumes = dn.UpdateVolumes(volumeInfos)
@@ -253,6 +332,46 @@ func (t *Topology) SyncDataNodeRegistration(volumes []*master_pb.VolumeInformati
 	return
 }
 
+// NewerVolumeEpochs finds the volumes on the data node with a newer replica membership epoch than the data node reported,
+// to be sent back to the data node
+func (t *Topology) NewerVolumeEpochs(dn *DataNode) (epochs map[uint32]uint64) {
+	for _, v := range dn.GetVolumes() {
+		vl := t.GetVolumeLayout(v.Collection, v.ReplicaPlacement, v.Ttl, types.ToDiskType(v.DiskType))
+		if epoch := vl.Epoch(v.Id); epoch > v.Epoch {
+			if epochs == nil {
+				epochs = make(map[uint32]uint64)
+			}
+			epochs[uint32(v.Id)] = epoch
+		}
+	}
+	return
+}
+
+// IncrementalSyncDataNodeVolumes applies the volumes with changed status in an incremental heartbeat
+func (t *Topology) IncrementalSyncDataNodeVolumes(updatedVolumes []*master_pb.VolumeInformationMessage, dn *DataNode) (newVolumes []storage.VolumeInfo) {
+	for _, v := range updatedVolumes {
+		vi, err := storage.NewVolumeInfo(v)
+		if err != nil {
+			glog.V(0).Infof("Fail to convert updated volume information: %v", err)
+			continue
+		}
+		if t.isCollidingVolume(vi, dn) {
+			continue
+		}
+		isNew, isChangedRO := dn.AddOrUpdateVolume(vi)
+		if isNew {
+			t.RegisterVolumeLayout(vi, dn)
+			newVolumes = append(newVolumes, vi)
+		}
+		if isChangedRO {
+			diskType := types.ToDiskType(vi.DiskType)
+			vl := t.GetVolumeLayout(vi.Collection, vi.ReplicaPlacement, vi.Ttl, diskType)
+			vl.EnsureCorrectWritables(&vi)
+		}
+	}
+	return
+}
+
 func (t *Topology) IncrementalSyncDataNodeRegistration(newVolumes, deletedVolumes []*master_pb.VolumeShortInformationMessage, dn *DataNode) {
 	var newVis, oldVis []storage.VolumeInfo
 	for _, v := range newVolumes {
@@ -263,6 +382,7 @@ func (t *Topology) IncrementalSyncDataNodeRegistration(newVolumes, deletedVolume
 		}
 		newVis = append(newVis, vi)
 	}
+	newVis = t.filterCollidingVolumes(newVis, dn)
 	for _, v := range deletedVolumes {
 		vi, err := storage.NewVolumeInfoFromShort(v)
 		if err != nil {
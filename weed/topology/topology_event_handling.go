@@ -10,7 +10,9 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/storage"
 )
 
-func (t *Topology) StartRefreshWritableVolumes(grpcDialOption grpc.DialOption, garbageThreshold float64, growThreshold float64, preallocate int64) {
+// isAdminLocked tells whether the volumes are being changed by the admin shell, e.g., copied to other servers.
+// The periodic vacuum is skipped meanwhile.
+func (t *Topology) StartRefreshWritableVolumes(grpcDialOption grpc.DialOption, garbageThreshold float64, growThreshold float64, preallocate int64, isAdminLocked func() (clientName string, isLocked bool)) {
 	go func() {
 		for {
 			if t.IsLeader() {
@@ -23,9 +25,14 @@ func (t *Topology) StartRefreshWritableVolumes(grpcDialOption grpc.DialOption, g
 	go func(garbageThreshold float64) {
 		c := time.Tick(15 * time.Minute)
 		for _ = range c {
-			if t.IsLeader() {
-				t.Vacuum(grpcDialOption, garbageThreshold, preallocate)
+			if !t.IsLeader() {
+				continue
+			}
+			if clientName, isLocked := isAdminLocked(); isLocked {
+				glog.V(0).Infof("skip vacuum while the admin shell is locked by %s", clientName)
+				continue
 			}
+			t.Vacuum(grpcDialOption, garbageThreshold, preallocate)
 		}
 	}(garbageThreshold)
 	go func() {
@@ -45,6 +52,11 @@ func (t *Topology) SetVolumeCapacityFull(volumeInfo storage.VolumeInfo) bool {
 	if !vl.SetVolumeCapacityFull(volumeInfo.Id) {
 		return false
 	}
+	t.NotifyEvent(&TopologyEvent{
+		Type:       EventVolumeFull,
+		VolumeId:   uint32(volumeInfo.Id),
+		Collection: volumeInfo.Collection,
+	})
 
 	vl.accessLock.RLock()
 	defer vl.accessLock.RUnlock()
@@ -80,6 +92,16 @@ func (t *Topology) UnRegisterDataNode(dn *DataNode) {
 		diskType := types.ToDiskType(v.DiskType)
 		vl := t.GetVolumeLayout(v.Collection, v.ReplicaPlacement, v.Ttl, diskType)
 		vl.SetVolumeUnavailable(dn, v.Id)
+		if replicas, expected := len(vl.Lookup(v.Id)), v.ReplicaPlacement.GetCopyCount(); replicas < expected {
+			t.NotifyEvent(&TopologyEvent{
+				Type:             EventReplicaLost,
+				DataNode:         dn.Url(),
+				VolumeId:         uint32(v.Id),
+				Collection:       v.Collection,
+				Replicas:         replicas,
+				ExpectedReplicas: expected,
+			})
+		}
 	}
 
 	negativeUsages := dn.GetDiskUsages().negative()
@@ -0,0 +1,68 @@
+package topology
+
+import (
+	"time"
+)
+
+const (
+	// EventNodeJoin is a new volume server registering to the master
+	EventNodeJoin = "node_join"
+	// EventNodeLeave is a volume server not seen for the grace period, and removed from the topology
+	EventNodeLeave = "node_leave"
+	// EventVolumeFull is a volume reaching the size limit, and no longer writable
+	EventVolumeFull = "volume_full"
+	// EventReplicaLost is a volume having fewer replicas than its replica placement after a volume server leaves
+	EventReplicaLost = "replica_lost"
+	// EventVolumeCollision is a volume reported with the same id as a registered volume, but different data
+	EventVolumeCollision = "volume_collision"
+)
+
+// TopologyEvent is a significant change of the topology, for the operators to be alerted about
+type TopologyEvent struct {
+	Type             string `json:"type"`
+	Time             int64  `json:"time"`
+	DataNode         string `json:"dataNode,omitempty"`
+	DataCenter       string `json:"dataCenter,omitempty"`
+	Rack             string `json:"rack,omitempty"`
+	VolumeId         uint32 `json:"volumeId,omitempty"`
+	Collection       string `json:"collection,omitempty"`
+	Replicas         int    `json:"replicas,omitempty"`
+	ExpectedReplicas int    `json:"expectedReplicas,omitempty"`
+	Reason           string `json:"reason,omitempty"`
+}
+
+// SetEventListener sets the function called for the topology events.
+// It is called synchronously, and should not block.
+func (t *Topology) SetEventListener(fn func(event *TopologyEvent)) {
+	t.eventListener = fn
+}
+
+// NotifyEvent sends the event to the event listener, if any
+func (t *Topology) NotifyEvent(event *TopologyEvent) {
+	if t.eventListener == nil {
+		return
+	}
+	if event.Time == 0 {
+		event.Time = time.Now().Unix()
+	}
+	t.eventListener(event)
+}
+
+func (t *Topology) notifyDataNodeEvent(eventType string, dn *DataNode) {
+	event := &TopologyEvent{
+		Type:     eventType,
+		DataNode: dn.Url(),
+	}
+	if dn.Parent() != nil {
+		event.Rack = string(dn.GetRack().Id())
+		if dc := dn.GetDataCenter(); dc != nil {
+			event.DataCenter = string(dc.Id())
+		}
+	}
+	t.NotifyEvent(event)
+}
+
+// NotifyDataNodeJoin sends the node_join event for a newly registered volume server
+func (t *Topology) NotifyDataNodeJoin(dn *DataNode) {
+	t.notifyDataNodeEvent(EventNodeJoin, dn)
+}
@@ -62,8 +62,10 @@ func (t *Topology) ToVolumeLocations() (volumeLocations []*master_pb.VolumeLocat
 			for _, d := range rack.Children() {
 				dn := d.(*DataNode)
 				volumeLocation := &master_pb.VolumeLocation{
-					Url:       dn.Url(),
-					PublicUrl: dn.PublicUrl,
+					Url:        dn.Url(),
+					PublicUrl:  dn.PublicUrl,
+					DataCenter: string(dc.Id()),
+					Rack:       string(rack.Id()),
 				}
 				for _, v := range dn.GetVolumes() {
 					volumeLocation.NewVids = append(volumeLocation.NewVids, uint32(v.Id))
@@ -208,3 +208,209 @@ func TestAddRemoveVolume(t *testing.T) {
 	}
 
 }
+
+func TestVolumeEpochOnReplicaChanges(t *testing.T) {
+
+	topo := NewTopology("weedfs", sequence.NewMemorySequencer(), 32*1024, 5, false)
+
+	rack := topo.GetOrCreateDataCenter("dc1").GetOrCreateRack("rack1")
+	maxVolumeCounts := map[string]uint32{"": 25}
+	dn1 := rack.GetOrCreateDataNode("127.0.0.1", 34534, "127.0.0.1", maxVolumeCounts)
+	dn2 := rack.GetOrCreateDataNode("127.0.0.1", 34535, "127.0.0.1", maxVolumeCounts)
+
+	volumeMessage := func(epoch uint64) *master_pb.VolumeInformationMessage {
+		return &master_pb.VolumeInformationMessage{
+			Id:               1,
+			ReplicaPlacement: uint32(1),
+			Version:          uint32(needle.CurrentVersion),
+			Epoch:            epoch,
+		}
+	}
+
+	// the epoch known to the replicas is kept, e.g., after the master restarts
+	topo.SyncDataNodeRegistration([]*master_pb.VolumeInformationMessage{volumeMessage(5)}, dn1)
+	rp, _ := super_block.NewReplicaPlacementFromString("001")
+	vl := topo.GetVolumeLayout("", rp, needle.EMPTY_TTL, types.HardDriveType)
+	assert(t, "epoch after first replica", int(vl.Epoch(1)), 6)
+
+	topo.SyncDataNodeRegistration([]*master_pb.VolumeInformationMessage{volumeMessage(0)}, dn2)
+	assert(t, "epoch after second replica", int(vl.Epoch(1)), 7)
+
+	epochs := topo.NewerVolumeEpochs(dn1)
+	assert(t, "newer epoch for dn1", int(epochs[1]), 7)
+
+	// the same replica reported again does not change the epoch
+	topo.SyncDataNodeRegistration([]*master_pb.VolumeInformationMessage{volumeMessage(7)}, dn1)
+	assert(t, "epoch after reporting again", int(vl.Epoch(1)), 7)
+	assert(t, "newer epochs for dn1", len(topo.NewerVolumeEpochs(dn1)), 0)
+
+	topo.SyncDataNodeRegistration(nil, dn2)
+	assert(t, "epoch after removing a replica", int(vl.Epoch(1)), 8)
+	assert(t, "looked up epoch", int(topo.LookupEpoch("", 1)), 8)
+	assert(t, "looked up epoch of unknown volume", int(topo.LookupEpoch("", 2)), 0)
+}
+
+func TestVolumeCollisionQuarantine(t *testing.T) {
+
+	topo := NewTopology("weedfs", sequence.NewMemorySequencer(), 32*1024, 5, false)
+
+	rack := topo.GetOrCreateDataCenter("dc1").GetOrCreateRack("rack1")
+	maxVolumeCounts := map[string]uint32{"": 25}
+	dn1 := rack.GetOrCreateDataNode("127.0.0.1", 34534, "127.0.0.1", maxVolumeCounts)
+	dn2 := rack.GetOrCreateDataNode("127.0.0.1", 34535, "127.0.0.1", maxVolumeCounts)
+	dn3 := rack.GetOrCreateDataNode("127.0.0.1", 34536, "127.0.0.1", maxVolumeCounts)
+	topo.SetVolumeCollisionQuarantine(true)
+
+	volumeMessage := func(collection, uuid string) *master_pb.VolumeInformationMessage {
+		return &master_pb.VolumeInformationMessage{
+			Id:               1,
+			Collection:       collection,
+			ReplicaPlacement: uint32(1),
+			Version:          uint32(needle.CurrentVersion),
+			Uuid:             uuid,
+		}
+	}
+
+	topo.SyncDataNodeRegistration([]*master_pb.VolumeInformationMessage{volumeMessage("", "uuid-a")}, dn1)
+
+	// the replica with the same uuid, or without a uuid, is registered
+	topo.SyncDataNodeRegistration([]*master_pb.VolumeInformationMessage{volumeMessage("", "uuid-a")}, dn2)
+	assert(t, "replica locations", len(topo.Lookup("", 1)), 2)
+	assert(t, "quarantined on dn2", len(dn2.TakeQuarantinedVolumes()), 0)
+
+	// the volume of the same id allocated by another master is quarantined
+	newVolumes, _ := topo.SyncDataNodeRegistration([]*master_pb.VolumeInformationMessage{volumeMessage("", "uuid-b")}, dn3)
+	assert(t, "new volumes on dn3", len(newVolumes), 0)
+	assert(t, "locations after uuid collision", len(topo.Lookup("", 1)), 2)
+	quarantined := dn3.TakeQuarantinedVolumes()
+	if _, found := quarantined[1]; !found {
+		t.Errorf("volume 1 on dn3 not quarantined: %v", quarantined)
+	}
+	assert(t, "quarantined taken", len(dn3.TakeQuarantinedVolumes()), 0)
+	assert(t, "volumes on dn3", len(dn3.GetVolumes()), 0)
+
+	// a different collection collides, even without the uuids
+	topo.IncrementalSyncDataNodeVolumes([]*master_pb.VolumeInformationMessage{volumeMessage("other", "")}, dn3)
+	assert(t, "quarantined by collection", len(dn3.TakeQuarantinedVolumes()), 1)
+
+	// deleting the unregistered volume does not change the disk usage
+	topo.IncrementalSyncDataNodeRegistration(nil, []*master_pb.VolumeShortInformationMessage{{Id: 1, ReplicaPlacement: 1}}, dn3)
+	assert(t, "volume count on dn3", int(dn3.diskUsages.getOrCreateDisk(types.HardDriveType).volumeCount), 0)
+	assert(t, "locations after deleting the quarantined volume", len(topo.Lookup("", 1)), 2)
+}
+
+func TestVolumeCollisionAlerting(t *testing.T) {
+
+	topo := NewTopology("weedfs", sequence.NewMemorySequencer(), 32*1024, 5, false)
+	var events []*TopologyEvent
+	topo.SetEventListener(func(event *TopologyEvent) {
+		events = append(events, event)
+	})
+
+	rack := topo.GetOrCreateDataCenter("dc1").GetOrCreateRack("rack1")
+	maxVolumeCounts := map[string]uint32{"": 25}
+	dn1 := rack.GetOrCreateDataNode("127.0.0.1", 34534, "127.0.0.1", maxVolumeCounts)
+	dn2 := rack.GetOrCreateDataNode("127.0.0.1", 34535, "127.0.0.1", maxVolumeCounts)
+
+	volumeMessage := func(uuid string) []*master_pb.VolumeInformationMessage {
+		return []*master_pb.VolumeInformationMessage{{
+			Id:               1,
+			ReplicaPlacement: uint32(1),
+			Version:          uint32(needle.CurrentVersion),
+			Uuid:             uuid,
+		}}
+	}
+
+	// deferred after a leader change, neither alerted nor quarantined
+	topo.SetVolumeCollisionQuarantine(true)
+	topo.DeferVolumeCollisions()
+	topo.SyncDataNodeRegistration(volumeMessage("uuid-a"), dn1)
+	topo.SyncDataNodeRegistration(volumeMessage("uuid-b"), dn2)
+	assert(t, "locations while deferred", len(topo.Lookup("", 1)), 1)
+	assert(t, "events while deferred", len(events), 0)
+	assert(t, "quarantined while deferred", len(dn2.TakeQuarantinedVolumes()), 0)
+
+	// one copy on each side, not quarantined without a majority, but alerted once
+	topo.collisionsDeferredUntil = 0
+	for i := 0; i < 2; i++ {
+		topo.SyncDataNodeRegistration(volumeMessage("uuid-b"), dn2)
+	}
+	assert(t, "collision events", len(events), 1)
+	if events[0].Type != EventVolumeCollision || events[0].DataNode != dn2.Url() {
+		t.Errorf("collision event %+v", events[0])
+	}
+	assert(t, "quarantined without majority", len(dn2.TakeQuarantinedVolumes()), 0)
+
+	// only alerted by default
+	topo.SetVolumeCollisionQuarantine(false)
+	topo.SyncDataNodeRegistration(volumeMessage("uuid-c"), dn2)
+	assert(t, "collision events of another volume", len(events), 2)
+	assert(t, "quarantined by default", len(dn2.TakeQuarantinedVolumes()), 0)
+	assert(t, "locations after collisions", len(topo.Lookup("", 1)), 1)
+}
+
+func TestCollectionCaps(t *testing.T) {
+
+	topo := NewTopology("weedfs", sequence.NewMemorySequencer(), 32*1024, 5, false)
+
+	rack := topo.GetOrCreateDataCenter("dc1").GetOrCreateRack("rack1")
+	maxVolumeCounts := map[string]uint32{"": 25}
+	dn1 := rack.GetOrCreateDataNode("127.0.0.1", 34534, "127.0.0.1", maxVolumeCounts)
+	dn2 := rack.GetOrCreateDataNode("127.0.0.1", 34535, "127.0.0.1", maxVolumeCounts)
+
+	var volumeMessages []*master_pb.VolumeInformationMessage
+	for vid := uint32(1); vid <= 2; vid++ {
+		volumeMessages = append(volumeMessages, &master_pb.VolumeInformationMessage{
+			Id:         vid,
+			Size:       1000,
+			Collection: "logs",
+			Version:    uint32(needle.CurrentVersion),
+		})
+	}
+	topo.SyncDataNodeRegistration(volumeMessages, dn1)
+
+	logsOption := &VolumeGrowOption{Collection: "logs", ReplicaPlacement: &super_block.ReplicaPlacement{}}
+	otherOption := &VolumeGrowOption{Collection: "other", ReplicaPlacement: &super_block.ReplicaPlacement{}}
+	assert(t, "free slots without caps", int(dn1.AvailableSpaceFor(logsOption)), 23)
+
+	// the volume count cap
+	topo.SyncDataNodeCollectionCaps([]*master_pb.CollectionCap{{Collection: "logs", MaxVolumeCount: 3, MaxDiskUsage: 5000}}, dn1)
+	assert(t, "free slots under the volume count cap", int(dn1.AvailableSpaceFor(logsOption)), 1)
+	assert(t, "free slots of the other collection", int(dn1.AvailableSpaceFor(otherOption)), 23)
+	topo.SyncDataNodeCollectionCaps([]*master_pb.CollectionCap{{Collection: "logs", MaxVolumeCount: 2}}, dn1)
+	assert(t, "free slots at the volume count cap", int(dn1.AvailableSpaceFor(logsOption)), 0)
+	for i := 0; i < 10; i++ {
+		servers, err := NewDefaultVolumeGrowth().findEmptySlotsForOneVolume(topo, logsOption)
+		if err != nil || len(servers) != 1 || servers[0] != dn2 {
+			t.Fatalf("grow on %v: %v", servers, err)
+		}
+	}
+
+	vl := topo.GetVolumeLayout("logs", &super_block.ReplicaPlacement{}, needle.EMPTY_TTL, types.HardDriveType)
+	active, _ := vl.GetActiveVolumeCount(logsOption)
+	assert(t, "writable volumes under the disk usage cap", active, 2)
+
+	// the disk usage cap
+	topo.SyncDataNodeCollectionCaps([]*master_pb.CollectionCap{{Collection: "logs", MaxDiskUsage: 2000}}, dn1)
+	if !dn1.IsCollectionOverDiskCap("logs") {
+		t.Errorf("logs on dn1 is not over the disk usage cap")
+	}
+	assert(t, "free slots at the disk usage cap", int(dn1.AvailableSpaceFor(logsOption)), 0)
+	active, _ = vl.GetActiveVolumeCount(logsOption)
+	assert(t, "writable volumes at the disk usage cap", active, 0)
+	if _, _, _, err := vl.PickForWrite(1, logsOption); err == nil {
+		t.Errorf("picked a volume at the disk usage cap")
+	}
+
+	// the cap is raised
+	topo.SyncDataNodeCollectionCaps([]*master_pb.CollectionCap{{Collection: "logs", MaxDiskUsage: 3000}}, dn1)
+	active, _ = vl.GetActiveVolumeCount(logsOption)
+	assert(t, "writable volumes after raising the cap", active, 2)
+
+	// the caps are removed
+	topo.SyncDataNodeCollectionCaps([]*master_pb.CollectionCap{{Collection: "logs", MaxDiskUsage: 2000}}, dn1)
+	topo.SyncDataNodeCollectionCaps(nil, dn1)
+	active, _ = vl.GetActiveVolumeCount(logsOption)
+	assert(t, "writable volumes without caps", active, 2)
+	assert(t, "free slots after removing the caps", int(dn1.AvailableSpaceFor(logsOption)), 23)
+}
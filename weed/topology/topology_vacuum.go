@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 
@@ -58,94 +60,188 @@ func (t *Topology) batchVacuumVolumeCheck(grpcDialOption grpc.DialOption, vid ne
 	}
 	return vacuumLocationList, errCount == 0 && len(vacuumLocationList.list) > 0
 }
-func (t *Topology) batchVacuumVolumeCompact(grpcDialOption grpc.DialOption, vl *VolumeLayout, vid needle.VolumeId,
-	locationlist *VolumeLocationList, preallocate int64) bool {
-	vl.accessLock.Lock()
-	vl.removeFromWritable(vid)
-	vl.accessLock.Unlock()
-
-	ch := make(chan bool, locationlist.Length())
-	for index, dn := range locationlist.list {
-		go func(index int, url string, vid needle.VolumeId) {
-			glog.V(0).Infoln(index, "Start vacuuming", vid, "on", url)
-			err := operation.WithVolumeServerClient(url, grpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) error {
-				_, err := volumeServerClient.VacuumVolumeCompact(context.Background(), &volume_server_pb.VacuumVolumeCompactRequest{
-					VolumeId:    uint32(vid),
-					Preallocate: preallocate,
-				})
-				return err
-			})
-			if err != nil {
-				glog.Errorf("Error when vacuuming %d on %s: %v", vid, url, err)
-				ch <- false
-			} else {
-				glog.V(0).Infof("Complete vacuuming %d on %s", vid, url)
-				ch <- true
-			}
-		}(index, dn.Url(), vid)
+func (t *Topology) vacuumVolumeCompact(grpcDialOption grpc.DialOption, vid needle.VolumeId, dn *DataNode, preallocate int64) bool {
+	glog.V(0).Infoln("Start vacuuming", vid, "on", dn.Url())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute*time.Duration(t.volumeSizeLimit/1024/1024/1000+1))
+	defer cancel()
+	err := operation.WithVolumeServerClient(dn.Url(), grpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) error {
+		_, err := volumeServerClient.VacuumVolumeCompact(ctx, &volume_server_pb.VacuumVolumeCompactRequest{
+			VolumeId:    uint32(vid),
+			Preallocate: preallocate,
+		})
+		return err
+	})
+	if err != nil {
+		glog.Errorf("Error when vacuuming %d on %s: %v", vid, dn.Url(), err)
+		return false
 	}
-	isVacuumSuccess := true
+	glog.V(0).Infof("Complete vacuuming %d on %s", vid, dn.Url())
+	return true
+}
 
-	waitTimeout := time.NewTimer(3 * time.Minute * time.Duration(t.volumeSizeLimit/1024/1024/1000+1))
-	defer waitTimeout.Stop()
+// vacuumVolumeVerify compares the compacted index with the index of another replica, before committing
+func (t *Topology) vacuumVolumeVerify(grpcDialOption grpc.DialOption, vid needle.VolumeId, dn *DataNode, sibling *DataNode) bool {
+	if sibling == nil {
+		return true
+	}
+	glog.V(0).Infoln("Start verifying vacuum", vid, "on", dn.Url(), "with", sibling.Url())
+	err := operation.WithVolumeServerClient(dn.Url(), grpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) error {
+		resp, err := volumeServerClient.VacuumVolumeVerify(context.Background(), &volume_server_pb.VacuumVolumeVerifyRequest{
+			VolumeId:        uint32(vid),
+			SiblingDataNode: sibling.Url(),
+		})
+		if status.Code(err) == codes.Unimplemented {
+			glog.V(0).Infof("skip verifying vacuum %d on %s: %v", vid, dn.Url(), err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if resp.InconsistentCount > 0 {
+			glog.Warningf("volume %d: %d of %d needles on %s are not on %s", vid, resp.InconsistentCount, resp.CheckedCount, sibling.Url(), dn.Url())
+		}
+		return nil
+	})
+	if err != nil {
+		glog.Errorf("Error when verifying vacuum %d on %s with %s: %v", vid, dn.Url(), sibling.Url(), err)
+		return false
+	}
+	glog.V(0).Infof("Complete verifying vacuum %d on %s", vid, dn.Url())
+	return true
+}
 
-	for range locationlist.list {
-		select {
-		case canCommit := <-ch:
-			isVacuumSuccess = isVacuumSuccess && canCommit
-		case <-waitTimeout.C:
-			return false
+func (t *Topology) vacuumVolumeCommit(grpcDialOption grpc.DialOption, vid needle.VolumeId, dn *DataNode) (isReadOnly bool, isCommitSuccess bool) {
+	glog.V(0).Infoln("Start Committing vacuum", vid, "on", dn.Url())
+	err := operation.WithVolumeServerClient(dn.Url(), grpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) error {
+		resp, err := volumeServerClient.VacuumVolumeCommit(context.Background(), &volume_server_pb.VacuumVolumeCommitRequest{
+			VolumeId: uint32(vid),
+		})
+		if resp != nil && resp.IsReadOnly {
+			isReadOnly = true
 		}
+		return err
+	})
+	if err != nil {
+		glog.Errorf("Error when committing vacuum %d on %s: %v", vid, dn.Url(), err)
+		return isReadOnly, false
 	}
-	return isVacuumSuccess
+	glog.V(0).Infof("Complete Committing vacuum %d on %s", vid, dn.Url())
+	return isReadOnly, true
 }
-func (t *Topology) batchVacuumVolumeCommit(grpcDialOption grpc.DialOption, vl *VolumeLayout, vid needle.VolumeId, locationlist *VolumeLocationList) bool {
-	isCommitSuccess := true
-	isReadOnly := false
-	for _, dn := range locationlist.list {
-		glog.V(0).Infoln("Start Committing vacuum", vid, "on", dn.Url())
-		err := operation.WithVolumeServerClient(dn.Url(), grpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) error {
-			resp, err := volumeServerClient.VacuumVolumeCommit(context.Background(), &volume_server_pb.VacuumVolumeCommitRequest{
-				VolumeId: uint32(vid),
-			})
-			if resp != nil && resp.IsReadOnly {
-				isReadOnly = true
-			}
-			return err
+
+func (t *Topology) vacuumVolumeCleanup(grpcDialOption grpc.DialOption, vid needle.VolumeId, dn *DataNode) {
+	glog.V(0).Infoln("Start cleaning up", vid, "on", dn.Url())
+	err := operation.WithVolumeServerClient(dn.Url(), grpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) error {
+		_, err := volumeServerClient.VacuumVolumeCleanup(context.Background(), &volume_server_pb.VacuumVolumeCleanupRequest{
+			VolumeId: uint32(vid),
 		})
-		if err != nil {
-			glog.Errorf("Error when committing vacuum %d on %s: %v", vid, dn.Url(), err)
-			isCommitSuccess = false
-		} else {
-			glog.V(0).Infof("Complete Committing vacuum %d on %s", vid, dn.Url())
+		return err
+	})
+	if err != nil {
+		glog.Errorf("Error when cleaning up vacuum %d on %s: %v", vid, dn.Url(), err)
+	} else {
+		glog.V(0).Infof("Complete cleaning up vacuum %d on %s", vid, dn.Url())
+	}
+}
+
+// vacuumVolumeReplicas compacts and verifies one replica at a time,
+// so the other replicas are not changed while they may be read or copied from.
+// The replicas are only committed after all of them are compacted and verified.
+// The volume stays writable, since the writes and deletes during the compaction are replayed at commit.
+// If a commit fails, the replicas may differ, and the volume is kept read only for volume.check.disk to repair.
+func (t *Topology) vacuumVolumeReplicas(grpcDialOption grpc.DialOption, vl *VolumeLayout, vid needle.VolumeId,
+	locationList, vacuumLocationList *VolumeLocationList, preallocate int64) bool {
+	var compacted []*DataNode
+	for _, dn := range vacuumLocationList.list {
+		if t.IsVacuumDisabled() {
+			glog.V(0).Infof("vacuum is disabled, stop vacuuming %d", vid)
+			t.vacuumVolumeCleanupAll(grpcDialOption, vid, compacted)
+			return false
 		}
+		sibling := siblingLocation(locationList, dn)
+		if !t.vacuumVolumeCompact(grpcDialOption, vid, dn, preallocate) || !t.vacuumVolumeVerify(grpcDialOption, vid, dn, sibling) {
+			t.vacuumVolumeCleanupAll(grpcDialOption, vid, append(compacted, dn))
+			return false
+		}
+		compacted = append(compacted, dn)
 	}
-	if isCommitSuccess {
-		for _, dn := range locationlist.list {
-			vl.SetVolumeAvailable(dn, vid, isReadOnly)
+
+	isReadOnly := false
+	for i, dn := range compacted {
+		readOnly, isCommitSuccess := t.vacuumVolumeCommit(grpcDialOption, vid, dn)
+		if !isCommitSuccess {
+			t.vacuumVolumeCleanupAll(grpcDialOption, vid, compacted[i+1:])
+			t.markVolumeForRepair(grpcDialOption, vl, vid, locationList)
+			return false
 		}
+		isReadOnly = isReadOnly || readOnly
+	}
+
+	for _, dn := range vacuumLocationList.list {
+		vl.SetVolumeAvailable(dn, vid, isReadOnly)
+	}
+	return true
+}
+
+func (t *Topology) vacuumVolumeCleanupAll(grpcDialOption grpc.DialOption, vid needle.VolumeId, dataNodes []*DataNode) {
+	for _, dn := range dataNodes {
+		t.vacuumVolumeCleanup(grpcDialOption, vid, dn)
 	}
-	return isCommitSuccess
 }
-func (t *Topology) batchVacuumVolumeCleanup(grpcDialOption grpc.DialOption, vl *VolumeLayout, vid needle.VolumeId, locationlist *VolumeLocationList) {
-	for _, dn := range locationlist.list {
-		glog.V(0).Infoln("Start cleaning up", vid, "on", dn.Url())
+
+// markVolumeForRepair stops writing to the volume, and marks its replicas out of sync for volume.check.disk.
+// The volume can be marked writable by volume.mark after the repair.
+func (t *Topology) markVolumeForRepair(grpcDialOption grpc.DialOption, vl *VolumeLayout, vid needle.VolumeId, locationList *VolumeLocationList) {
+	glog.Warningf("volume %d failed to commit vacuum on some replicas, marked read only for volume.check.disk to repair", vid)
+	vl.SetVolumeUnwritable(vid)
+	for _, dn := range locationList.list {
 		err := operation.WithVolumeServerClient(dn.Url(), grpcDialOption, func(volumeServerClient volume_server_pb.VolumeServerClient) error {
-			_, err := volumeServerClient.VacuumVolumeCleanup(context.Background(), &volume_server_pb.VacuumVolumeCleanupRequest{
+			if _, err := volumeServerClient.VolumeMarkReadonly(context.Background(), &volume_server_pb.VolumeMarkReadonlyRequest{
+				VolumeId: uint32(vid),
+			}); err != nil {
+				return err
+			}
+			_, err := volumeServerClient.VolumeMarkReplicasOutOfSync(context.Background(), &volume_server_pb.VolumeMarkReplicasOutOfSyncRequest{
 				VolumeId: uint32(vid),
 			})
 			return err
 		})
 		if err != nil {
-			glog.Errorf("Error when cleaning up vacuum %d on %s: %v", vid, dn.Url(), err)
-		} else {
-			glog.V(0).Infof("Complete cleaning up vacuum %d on %s", vid, dn.Url())
+			glog.Errorf("Error when marking volume %d on %s for repair: %v", vid, dn.Url(), err)
+		}
+	}
+}
+
+func siblingLocation(locationList *VolumeLocationList, dn *DataNode) *DataNode {
+	for _, location := range locationList.list {
+		if location != dn {
+			return location
 		}
 	}
+	return nil
+}
+
+func (t *Topology) DisableVacuum() {
+	glog.V(0).Infof("DisableVacuum")
+	atomic.StoreInt32(&t.isVacuumDisabled, 1)
+}
+
+func (t *Topology) EnableVacuum() {
+	glog.V(0).Infof("EnableVacuum")
+	atomic.StoreInt32(&t.isVacuumDisabled, 0)
+}
+
+func (t *Topology) IsVacuumDisabled() bool {
+	return atomic.LoadInt32(&t.isVacuumDisabled) == 1
 }
 
 func (t *Topology) Vacuum(grpcDialOption grpc.DialOption, garbageThreshold float64, preallocate int64) {
 
+	if t.IsVacuumDisabled() {
+		glog.V(1).Infof("vacuum is disabled")
+		return
+	}
+
 	// if there is vacuum going on, return immediately
 	swapped := atomic.CompareAndSwapInt64(&t.vacuumLockCounter, 0, 1)
 	if !swapped {
@@ -178,6 +274,10 @@ func (t *Topology) vacuumOneVolumeLayout(grpcDialOption grpc.DialOption, volumeL
 
 	for vid, locationList := range tmpMap {
 
+		if t.IsVacuumDisabled() {
+			return
+		}
+
 		volumeLayout.accessLock.RLock()
 		isReadOnly := volumeLayout.readonlyVolumes.IsTrue(vid)
 		volumeLayout.accessLock.RUnlock()
@@ -188,11 +288,7 @@ func (t *Topology) vacuumOneVolumeLayout(grpcDialOption grpc.DialOption, volumeL
 
 		glog.V(2).Infof("check vacuum on collection:%s volume:%d", c.Name, vid)
 		if vacuumLocationList, needVacuum := t.batchVacuumVolumeCheck(grpcDialOption, vid, locationList, garbageThreshold); needVacuum {
-			if t.batchVacuumVolumeCompact(grpcDialOption, volumeLayout, vid, vacuumLocationList, preallocate) {
-				t.batchVacuumVolumeCommit(grpcDialOption, volumeLayout, vid, vacuumLocationList)
-			} else {
-				t.batchVacuumVolumeCleanup(grpcDialOption, volumeLayout, vid, vacuumLocationList)
-			}
+			t.vacuumVolumeReplicas(grpcDialOption, volumeLayout, vid, locationList, vacuumLocationList, preallocate)
 		}
 	}
 }
@@ -0,0 +1,152 @@
+package topology
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/storage"
+)
+
+// Volume id collisions happen when two masters allocate the same volume id during a split brain,
+// or when a volume is brought back from an old backup. The colliding volume is not registered,
+// so the volume registered first keeps serving, and the collision is alerted as a volume_collision event.
+// After a leader change, the decisions are deferred until all the volume servers have reported,
+// instead of depending on the order of their heartbeats. With -volumeCollisionQuarantine, the colliding volume
+// is also quarantined by its volume server, but only if the registered volume has more replicas.
+
+// SetVolumeCollisionQuarantine enables quarantining the colliding volumes, which only alerts by default
+func (t *Topology) SetVolumeCollisionQuarantine(enabled bool) {
+	t.quarantineCollisions = enabled
+}
+
+// DeferVolumeCollisions defers the decisions on the colliding volumes until the volume servers have reported,
+// e.g., after this master becomes the leader with an empty topology
+func (t *Topology) DeferVolumeCollisions() {
+	atomic.StoreInt64(&t.collisionsDeferredUntil, time.Now().Add(t.nodeSuspectTimeout).UnixNano())
+}
+
+// filterCollidingVolumes removes the volumes colliding with the volumes of the same ids registered on other data nodes
+func (t *Topology) filterCollidingVolumes(volumes []storage.VolumeInfo, dn *DataNode) (kept []storage.VolumeInfo) {
+	for _, v := range volumes {
+		if !t.isCollidingVolume(v, dn) {
+			kept = append(kept, v)
+		}
+	}
+	return
+}
+
+func (t *Topology) isCollidingVolume(v storage.VolumeInfo, dn *DataNode) bool {
+	reason := t.findVolumeCollision(v, dn)
+	if reason == "" {
+		return false
+	}
+	if time.Now().UnixNano() < atomic.LoadInt64(&t.collisionsDeferredUntil) {
+		// reported again in the next full heartbeat
+		glog.Warningf("volume %d on %s collides with the registered volume, to be decided after all volume servers report: %s", v.Id, dn.Url(), reason)
+		return true
+	}
+	if !dn.addCollidingVolume(v) {
+		// already alerted
+		return true
+	}
+	glog.Errorf("volume %d on %s collides with the registered volume: %s", v.Id, dn.Url(), reason)
+	t.NotifyEvent(&TopologyEvent{
+		Type:       EventVolumeCollision,
+		DataNode:   dn.Url(),
+		VolumeId:   uint32(v.Id),
+		Collection: v.Collection,
+		Reason:     reason,
+	})
+	if !t.quarantineCollisions {
+		return true
+	}
+	registered, colliding := len(t.Lookup("", v.Id)), t.countCollidingCopies(v)
+	if registered <= colliding {
+		glog.Errorf("volume %d on %s is not quarantined, %d registered copies are not more than %d colliding copies", v.Id, dn.Url(), registered, colliding)
+		return true
+	}
+	dn.addQuarantinedVolume(v, reason)
+	return true
+}
+
+// countCollidingCopies counts the unregistered copies of the same colliding volume
+func (t *Topology) countCollidingCopies(v storage.VolumeInfo) (count int) {
+	for _, dn := range t.getDataNodes() {
+		dn.RLock()
+		other, found := dn.collidingVolumes[uint32(v.Id)]
+		dn.RUnlock()
+		if found && compareVolumeIdentity(v, other) == "" {
+			count++
+		}
+	}
+	return
+}
+
+// findVolumeCollision compares the volume newly reported by the data node with the volumes of the same id
+// registered on the other data nodes. The replication and the disk type are not compared, since they change
+// when the volume is reconfigured or moved between the disk types.
+func (t *Topology) findVolumeCollision(v storage.VolumeInfo, dn *DataNode) (reason string) {
+	if dn.HasVolumesById(v.Id) {
+		return ""
+	}
+	for _, other := range t.Lookup("", v.Id) {
+		if other == dn {
+			continue
+		}
+		otherVolume, err := other.GetVolumesById(v.Id)
+		if err != nil {
+			// erasure coded volume
+			continue
+		}
+		if reason = compareVolumeIdentity(v, otherVolume); reason != "" {
+			return fmt.Sprintf("%s on %s", reason, other.Url())
+		}
+	}
+	return ""
+}
+
+func compareVolumeIdentity(v, other storage.VolumeInfo) string {
+	if v.Collection != other.Collection {
+		return fmt.Sprintf("collection %q differs from %q", v.Collection, other.Collection)
+	}
+	if v.Ttl.String() != other.Ttl.String() {
+		return fmt.Sprintf("ttl %q differs from %q", v.Ttl.String(), other.Ttl.String())
+	}
+	// the volumes allocated by older versions have no uuid
+	if v.Uuid != "" && other.Uuid != "" && v.Uuid != other.Uuid {
+		return fmt.Sprintf("uuid %s differs from %s", v.Uuid, other.Uuid)
+	}
+	return ""
+}
+
+// addCollidingVolume remembers the unregistered colliding volume, and returns whether it is new
+func (dn *DataNode) addCollidingVolume(v storage.VolumeInfo) bool {
+	dn.Lock()
+	defer dn.Unlock()
+	if dn.collidingVolumes == nil {
+		dn.collidingVolumes = make(map[uint32]storage.VolumeInfo)
+	}
+	old, found := dn.collidingVolumes[uint32(v.Id)]
+	dn.collidingVolumes[uint32(v.Id)] = v
+	return !found || compareVolumeIdentity(old, v) != ""
+}
+
+func (dn *DataNode) addQuarantinedVolume(v storage.VolumeInfo, reason string) {
+	dn.Lock()
+	defer dn.Unlock()
+	if dn.quarantinedVolumes == nil {
+		dn.quarantinedVolumes = make(map[uint32]string)
+	}
+	dn.quarantinedVolumes[uint32(v.Id)] = reason
+}
+
+// TakeQuarantinedVolumes returns the colliding volumes found since the last call, to be sent back to the data node.
+// A volume failed to be quarantined is found again in the next full heartbeat.
+func (dn *DataNode) TakeQuarantinedVolumes() (volumes map[uint32]string) {
+	dn.Lock()
+	defer dn.Unlock()
+	volumes, dn.quarantinedVolumes = dn.quarantinedVolumes, nil
+	return
+}
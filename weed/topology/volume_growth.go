@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"sync"
 
+	"github.com/google/uuid"
 	"google.golang.org/grpc"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
@@ -219,16 +220,19 @@ func (vg *VolumeGrowth) findEmptySlotsForOneVolume(topo *Topology, option *Volum
 }
 
 func (vg *VolumeGrowth) grow(grpcDialOption grpc.DialOption, topo *Topology, vid needle.VolumeId, option *VolumeGrowOption, servers ...*DataNode) error {
+	// the same for all the replicas, to tell apart the volumes of the same id allocated by another master
+	volumeUuid := uuid.New().String()
 	for _, server := range servers {
-		if err := AllocateVolume(server, grpcDialOption, vid, option); err == nil {
+		if err := AllocateVolume(server, grpcDialOption, vid, option, topo.checksumAlgorithm, topo.volumeVersion, volumeUuid); err == nil {
 			vi := storage.VolumeInfo{
 				Id:               vid,
 				Size:             0,
 				Collection:       option.Collection,
 				ReplicaPlacement: option.ReplicaPlacement,
 				Ttl:              option.Ttl,
-				Version:          needle.CurrentVersion,
+				Version:          topo.volumeVersion,
 				DiskType:         string(option.DiskType),
+				Uuid:             volumeUuid,
 			}
 			server.AddOrUpdateVolume(vi)
 			topo.RegisterVolumeLayout(vi, server)
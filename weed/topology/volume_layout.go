@@ -152,7 +152,10 @@ func (vl *VolumeLayout) RegisterVolume(v *storage.VolumeInfo, dn *DataNode) {
 	if _, ok := vl.vid2location[v.Id]; !ok {
 		vl.vid2location[v.Id] = NewVolumeLocationList()
 	}
-	vl.vid2location[v.Id].Set(dn)
+	vl.vid2location[v.Id].AdoptEpoch(v.Epoch)
+	if vl.vid2location[v.Id].Set(dn) {
+		glog.V(1).Infof("volume %d added on %s, epoch %d", v.Id, dn.Id(), vl.vid2location[v.Id].Epoch())
+	}
 	// glog.V(4).Infof("volume %d added to %s len %d copy %d", v.Id, dn.Id(), vl.vid2location[v.Id].Length(), v.ReplicaPlacement.GetCopyCount())
 	for _, dn := range vl.vid2location[v.Id].list {
 		if vInfo, err := dn.GetVolumesById(v.Id); err == nil {
@@ -205,6 +208,14 @@ func (vl *VolumeLayout) UnRegisterVolume(v *storage.VolumeInfo, dn *DataNode) {
 	}
 }
 
+// Epoch is the replica membership epoch of the volume
+func (vl *VolumeLayout) Epoch(vid needle.VolumeId) uint64 {
+	vl.accessLock.RLock()
+	defer vl.accessLock.RUnlock()
+
+	return vl.vid2location[vid].Epoch()
+}
+
 func (vl *VolumeLayout) EnsureCorrectWritables(v *storage.VolumeInfo) {
 	vl.accessLock.Lock()
 	defer vl.accessLock.Unlock()
@@ -224,10 +235,17 @@ func (vl *VolumeLayout) ensureCorrectWritables(vid needle.VolumeId) {
 
 func (vl *VolumeLayout) isAllWritable(vid needle.VolumeId) bool {
 	for _, dn := range vl.vid2location[vid].list {
+		if !dn.IsActive() {
+			// the suspect volume server may not receive the replicated writes
+			return false
+		}
 		if v, getError := dn.GetVolumesById(vid); getError == nil {
 			if v.ReadOnly {
 				return false
 			}
+			if dn.IsCollectionOverDiskCap(v.Collection) {
+				return false
+			}
 		}
 	}
 	return true
@@ -239,7 +257,7 @@ func (vl *VolumeLayout) isOversized(v *storage.VolumeInfo) bool {
 
 func (vl *VolumeLayout) isWritable(v *storage.VolumeInfo) bool {
 	return !vl.isOversized(v) &&
-		v.Version == needle.CurrentVersion &&
+		v.Version >= needle.Version3 &&
 		!v.ReadOnly
 }
 
@@ -279,35 +297,111 @@ func (vl *VolumeLayout) PickForWrite(count uint64, option *VolumeGrowOption) (*n
 		//glog.V(0).Infoln("No more writable volumes!")
 		return nil, 0, nil, errors.New("No more writable volumes!")
 	}
-	if option.DataCenter == "" {
-		vid := vl.writables[rand.Intn(lenWriters)]
-		locationList := vl.vid2location[vid]
-		if locationList != nil {
-			return &vid, count, locationList, nil
-		}
-		return nil, 0, nil, errors.New("Strangely vid " + vid.String() + " is on no machine!")
+	candidates := vl.writeCandidates(option)
+	if len(candidates) == 0 {
+		return nil, 0, nil, fmt.Errorf("no writable volumes for %s", option.String())
 	}
-	var vid needle.VolumeId
-	var locationList *VolumeLocationList
-	counter := 0
+	picked := pickWriteCandidates(candidates, 1)[0]
+	return &picked.vid, count, picked.locationList, nil
+}
+
+// PickForWriteBatch picks batchCount volumes to write, all different if there are enough writable volumes
+func (vl *VolumeLayout) PickForWriteBatch(batchCount int, option *VolumeGrowOption) ([]needle.VolumeId, []*VolumeLocationList, error) {
+	vl.accessLock.RLock()
+	defer vl.accessLock.RUnlock()
+
+	if len(vl.writables) <= 0 {
+		return nil, nil, errors.New("No more writable volumes!")
+	}
+	candidates := vl.writeCandidates(option)
+	if len(candidates) == 0 {
+		return nil, nil, fmt.Errorf("no writable volumes for %s", option.String())
+	}
+	var vids []needle.VolumeId
+	var locationLists []*VolumeLocationList
+	for _, picked := range pickWriteCandidates(candidates, batchCount) {
+		vids = append(vids, picked.vid)
+		locationLists = append(locationLists, picked.locationList)
+	}
+	return vids, locationLists, nil
+}
+
+type writeCandidate struct {
+	vid          needle.VolumeId
+	locationList *VolumeLocationList
+	weight       float64
+}
+
+// writeCandidates lists the writable volumes in the data center, rack and data node of the option, if specified
+func (vl *VolumeLayout) writeCandidates(option *VolumeGrowOption) (candidates []writeCandidate) {
 	for _, v := range vl.writables {
 		volumeLocationList := vl.vid2location[v]
+		if volumeLocationList == nil {
+			continue
+		}
+		isMatched := option.DataCenter == ""
 		for _, dn := range volumeLocationList.list {
-			if dn.GetDataCenter().Id() == NodeId(option.DataCenter) {
-				if option.Rack != "" && dn.GetRack().Id() != NodeId(option.Rack) {
-					continue
-				}
-				if option.DataNode != "" && dn.Id() != NodeId(option.DataNode) {
-					continue
-				}
-				counter++
-				if rand.Intn(counter) < 1 {
-					vid, locationList = v, volumeLocationList
+			if isMatched {
+				break
+			}
+			if dn.GetDataCenter().Id() != NodeId(option.DataCenter) {
+				continue
+			}
+			if option.Rack != "" && dn.GetRack().Id() != NodeId(option.Rack) {
+				continue
+			}
+			if option.DataNode != "" && dn.Id() != NodeId(option.DataNode) {
+				continue
+			}
+			isMatched = true
+		}
+		if isMatched {
+			candidates = append(candidates, writeCandidate{
+				vid:          v,
+				locationList: volumeLocationList,
+				weight:       writeWeight(v, volumeLocationList),
+			})
+		}
+	}
+	return
+}
+
+// pickWriteCandidates randomly picks n candidates by their weights, without picking any candidate twice
+// until all candidates are picked.
+func pickWriteCandidates(candidates []writeCandidate, n int) (picked []writeCandidate) {
+	for len(picked) < n {
+		remaining := append([]writeCandidate(nil), candidates...)
+		for len(remaining) > 0 && len(picked) < n {
+			totalWeight := 0.0
+			for _, c := range remaining {
+				totalWeight += c.weight
+			}
+			x := rand.Float64() * totalWeight
+			i := 0
+			for ; i < len(remaining)-1; i++ {
+				x -= remaining[i].weight
+				if x < 0 {
+					break
 				}
 			}
+			picked = append(picked, remaining[i])
+			remaining = append(remaining[:i], remaining[i+1:]...)
+		}
+	}
+	return
+}
+
+// writeWeight biases the writes towards the volumes with fewer concurrent writers, as reported in the heartbeats.
+// The writes are spread randomly, instead of always picking the least loaded volume,
+// since the writer counts are only updated every heartbeat.
+func writeWeight(vid needle.VolumeId, locationList *VolumeLocationList) float64 {
+	var writers uint32
+	for _, dn := range locationList.list {
+		if info, err := dn.GetVolumesById(vid); err == nil && info.ConcurrentWriters > writers {
+			writers = info.ConcurrentWriters
 		}
 	}
-	return &vid, count, locationList, nil
+	return 1 / float64(1+writers)
 }
 
 func (vl *VolumeLayout) GetActiveVolumeCount(option *VolumeGrowOption) (active, crowded int) {
@@ -391,7 +485,7 @@ func (vl *VolumeLayout) SetVolumeAvailable(dn *DataNode, vid needle.VolumeId, is
 
 	vl.vid2location[vid].Set(dn)
 
-	if vInfo.ReadOnly || isReadOnly {
+	if vInfo.ReadOnly || isReadOnly || dn.IsCollectionOverDiskCap(vInfo.Collection) {
 		return false
 	}
 
@@ -415,6 +509,14 @@ func (vl *VolumeLayout) SetVolumeCapacityFull(vid needle.VolumeId) bool {
 	return vl.removeFromWritable(vid)
 }
 
+// SetVolumeUnwritable stops assigning writes to the volume, until the volume servers report it writable again
+func (vl *VolumeLayout) SetVolumeUnwritable(vid needle.VolumeId) bool {
+	vl.accessLock.Lock()
+	defer vl.accessLock.Unlock()
+
+	return vl.removeFromWritable(vid)
+}
+
 func (vl *VolumeLayout) removeFromCrowded(vid needle.VolumeId) {
 	delete(vl.crowded, vid)
 }
@@ -3,8 +3,11 @@ package topology
 import (
 	"testing"
 
+	"github.com/chrislusf/seaweedfs/weed/sequence"
+	"github.com/chrislusf/seaweedfs/weed/storage"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
 )
 
 func TestVolumesBinaryState(t *testing.T) {
@@ -114,3 +117,95 @@ func TestVolumesBinaryState(t *testing.T) {
 		})
 	}
 }
+
+// setupTestVolumeLayout registers the volumes on one data node, and returns their volume layout
+func setupTestVolumeLayout(volumeInfos []storage.VolumeInfo) *VolumeLayout {
+	topo := NewTopology("weedfs", sequence.NewMemorySequencer(), 32*1024, 5, false)
+
+	dc := topo.GetOrCreateDataCenter("dc1")
+	rack := dc.GetOrCreateRack("rack1")
+	maxVolumeCounts := make(map[string]uint32)
+	maxVolumeCounts[""] = 25
+	dn := rack.GetOrCreateDataNode("127.0.0.1", 34534, "127.0.0.1", maxVolumeCounts)
+
+	dn.UpdateVolumes(volumeInfos)
+	for _, v := range volumeInfos {
+		topo.RegisterVolumeLayout(v, dn)
+	}
+
+	return topo.GetVolumeLayout("", &super_block.ReplicaPlacement{}, needle.EMPTY_TTL, types.HardDriveType)
+}
+
+func TestPickForWriteSpreadsConcurrentWriters(t *testing.T) {
+
+	var volumeInfos []storage.VolumeInfo
+	for i, writers := range []uint32{9, 0} {
+		volumeInfos = append(volumeInfos, storage.VolumeInfo{
+			Id:                needle.VolumeId(i + 1),
+			Size:              100,
+			Version:           needle.CurrentVersion,
+			ReplicaPlacement:  &super_block.ReplicaPlacement{},
+			Ttl:               needle.EMPTY_TTL,
+			ConcurrentWriters: writers,
+		})
+	}
+	vl := setupTestVolumeLayout(volumeInfos)
+	option := &VolumeGrowOption{}
+	picked := make(map[needle.VolumeId]int)
+	for i := 0; i < 10000; i++ {
+		vid, _, _, err := vl.PickForWrite(1, option)
+		if err != nil {
+			t.Fatalf("pick for write: %v", err)
+		}
+		picked[*vid]++
+	}
+
+	// expecting about 1/10 of the writes to the volume with 9 concurrent writers
+	if picked[1] == 0 || picked[1] > 2000 {
+		t.Errorf("volume with 9 concurrent writers picked %d times, the idle volume %d times", picked[1], picked[2])
+	}
+
+}
+
+func TestPickForWriteBatchDistinctVolumes(t *testing.T) {
+
+	var volumeInfos []storage.VolumeInfo
+	for i := 0; i < 3; i++ {
+		volumeInfos = append(volumeInfos, storage.VolumeInfo{
+			Id:               needle.VolumeId(i + 1),
+			Size:             100,
+			Version:          needle.CurrentVersion,
+			ReplicaPlacement: &super_block.ReplicaPlacement{},
+			Ttl:              needle.EMPTY_TTL,
+		})
+	}
+	vl := setupTestVolumeLayout(volumeInfos)
+	option := &VolumeGrowOption{}
+
+	for _, batchCount := range []int{2, 3, 5} {
+		vids, locationLists, err := vl.PickForWriteBatch(batchCount, option)
+		if err != nil {
+			t.Fatalf("pick %d for write: %v", batchCount, err)
+		}
+		if len(vids) != batchCount || len(locationLists) != batchCount {
+			t.Fatalf("picked %d volumes, expected %d", len(vids), batchCount)
+		}
+		picked := make(map[needle.VolumeId]int)
+		for _, vid := range vids {
+			picked[vid]++
+		}
+		expected := batchCount
+		if expected > len(volumeInfos) {
+			expected = len(volumeInfos)
+		}
+		if len(picked) != expected {
+			t.Errorf("batch %d picked volumes %v, expected %d different volumes", batchCount, vids, expected)
+		}
+	}
+
+	topo := NewTopology("weedfs", sequence.NewMemorySequencer(), 32*1024, 5, false)
+	if _, _, err := topo.PickForWriteBatch(1, MaxAssignBatchCount+1, &VolumeGrowOption{}); err == nil {
+		t.Errorf("picked a batch over the limit")
+	}
+
+}
@@ -7,7 +7,8 @@ import (
 )
 
 type VolumeLocationList struct {
-	list []*DataNode
+	list  []*DataNode
+	epoch uint64 // increased when a location is added or removed
 }
 
 func NewVolumeLocationList() *VolumeLocationList {
@@ -22,7 +23,8 @@ func (dnll *VolumeLocationList) Copy() *VolumeLocationList {
 	list := make([]*DataNode, len(dnll.list))
 	copy(list, dnll.list)
 	return &VolumeLocationList{
-		list: list,
+		list:  list,
+		epoch: dnll.epoch,
 	}
 }
 
@@ -38,26 +40,45 @@ func (dnll *VolumeLocationList) Length() int {
 	return len(dnll.list)
 }
 
-func (dnll *VolumeLocationList) Set(loc *DataNode) {
+// Set adds or updates the location, and returns whether it is added
+func (dnll *VolumeLocationList) Set(loc *DataNode) bool {
 	for i := 0; i < len(dnll.list); i++ {
 		if loc.Ip == dnll.list[i].Ip && loc.Port == dnll.list[i].Port {
 			dnll.list[i] = loc
-			return
+			return false
 		}
 	}
 	dnll.list = append(dnll.list, loc)
+	dnll.epoch++
+	return true
 }
 
 func (dnll *VolumeLocationList) Remove(loc *DataNode) bool {
 	for i, dnl := range dnll.list {
 		if loc.Ip == dnl.Ip && loc.Port == dnl.Port {
 			dnll.list = append(dnll.list[:i], dnll.list[i+1:]...)
+			dnll.epoch++
 			return true
 		}
 	}
 	return false
 }
 
+// Epoch is the replica membership epoch, to reject the writes from the replicas not knowing the latest locations
+func (dnll *VolumeLocationList) Epoch() uint64 {
+	if dnll == nil {
+		return 0
+	}
+	return dnll.epoch
+}
+
+// AdoptEpoch keeps the epoch not older than the one known to the replicas, e.g., after the master restarts
+func (dnll *VolumeLocationList) AdoptEpoch(epoch uint64) {
+	if dnll.epoch < epoch {
+		dnll.epoch = epoch
+	}
+}
+
 func (dnll *VolumeLocationList) Refresh(freshThreshHold int64) {
 	var changed bool
 	for _, dnl := range dnll.list {
@@ -74,6 +95,7 @@ func (dnll *VolumeLocationList) Refresh(freshThreshHold int64) {
 			}
 		}
 		dnll.list = l
+		dnll.epoch++
 	}
 }
 
@@ -29,6 +29,16 @@ func BytesToHumanReadable(b uint64) string {
 	return fmt.Sprintf("%.2f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
 }
 
+// IsZeroBytes returns true if all the bytes are zero, e.g., to keep the data as a hole in a sparse file.
+func IsZeroBytes(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // big endian
 
 func BytesToUint64(b []byte) (v uint64) {
@@ -112,7 +112,7 @@ func (c *TieredChunkCache) doGetChunkSlice(fileId string, offset, length uint64)
 		if err != nil {
 			glog.Errorf("failed to read from memcache: %s", err)
 		}
-		if len(data) >= int(minSize) {
+		if len(data) >= int(length) {
 			return data
 		}
 	}
@@ -125,19 +125,19 @@ func (c *TieredChunkCache) doGetChunkSlice(fileId string, offset, length uint64)
 
 	if minSize <= c.onDiskCacheSizeLimit0 {
 		data = c.diskCaches[0].getChunkSlice(fid.Key, offset, length)
-		if len(data) >= int(minSize) {
+		if len(data) >= int(length) {
 			return data
 		}
 	}
 	if minSize <= c.onDiskCacheSizeLimit1 {
 		data = c.diskCaches[1].getChunkSlice(fid.Key, offset, length)
-		if len(data) >= int(minSize) {
+		if len(data) >= int(length) {
 			return data
 		}
 	}
 	{
 		data = c.diskCaches[2].getChunkSlice(fid.Key, offset, length)
-		if len(data) >= int(minSize) {
+		if len(data) >= int(length) {
 			return data
 		}
 	}
@@ -52,7 +52,7 @@ func LoadOrCreateChunkCacheVolume(fileName string, preallocate int64) (*ChunkCac
 			v.fileSize = fileSize
 		}
 	} else {
-		if v.DataBackend, err = backend.CreateVolumeFile(v.fileName+".dat", preallocate, 0); err != nil {
+		if v.DataBackend, err = backend.CreateVolumeFile(v.fileName+".dat", backend.Preallocation{Size: preallocate}, 0); err != nil {
 			return nil, fmt.Errorf("cannot create cache file %s.dat: %v", v.fileName, err)
 		}
 		v.lastModTime = time.Now()
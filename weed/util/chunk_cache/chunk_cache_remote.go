@@ -0,0 +1,123 @@
+package chunk_cache
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/cache_pb"
+)
+
+const remoteChunkCacheTimeout = 10 * time.Second
+
+// RemoteChunkCache uses the chunk cache of a "weed cache" process on the same host, via its unix socket.
+// The errors are treated as cache misses, so the reads fall back to the volume servers.
+type RemoteChunkCache struct {
+	socketPath string
+	sync.Mutex
+	grpcConnection *grpc.ClientConn
+}
+
+var _ ChunkCache = &RemoteChunkCache{}
+
+func NewRemoteChunkCache(socketPath string) *RemoteChunkCache {
+	return &RemoteChunkCache{
+		socketPath: socketPath,
+	}
+}
+
+func (c *RemoteChunkCache) GetChunk(fileId string, minSize uint64) (data []byte) {
+	c.withClient(func(ctx context.Context, client cache_pb.SeaweedCacheClient) error {
+		resp, err := client.GetChunk(ctx, &cache_pb.GetChunkRequest{
+			FileId:  fileId,
+			MinSize: minSize,
+		})
+		if err != nil {
+			return err
+		}
+		if len(resp.Data) > 0 {
+			data = resp.Data
+		}
+		return nil
+	})
+	return
+}
+
+func (c *RemoteChunkCache) GetChunkSlice(fileId string, offset, length uint64) (data []byte) {
+	c.withClient(func(ctx context.Context, client cache_pb.SeaweedCacheClient) error {
+		resp, err := client.GetChunkSlice(ctx, &cache_pb.GetChunkSliceRequest{
+			FileId: fileId,
+			Offset: offset,
+			Length: length,
+		})
+		if err != nil {
+			return err
+		}
+		if len(resp.Data) > 0 {
+			data = resp.Data
+		}
+		return nil
+	})
+	return
+}
+
+func (c *RemoteChunkCache) SetChunk(fileId string, data []byte) {
+	c.withClient(func(ctx context.Context, client cache_pb.SeaweedCacheClient) error {
+		_, err := client.SetChunk(ctx, &cache_pb.SetChunkRequest{
+			FileId: fileId,
+			Data:   data,
+		})
+		return err
+	})
+}
+
+func (c *RemoteChunkCache) withClient(fn func(ctx context.Context, client cache_pb.SeaweedCacheClient) error) {
+	grpcConnection, err := c.getConnection()
+	if err != nil {
+		glog.V(1).Infof("connect to chunk cache %s: %v", c.socketPath, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), remoteChunkCacheTimeout)
+	defer cancel()
+	if err = fn(ctx, cache_pb.NewSeaweedCacheClient(grpcConnection)); err != nil {
+		glog.V(1).Infof("chunk cache %s: %v", c.socketPath, err)
+	}
+}
+
+func (c *RemoteChunkCache) getConnection() (*grpc.ClientConn, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.grpcConnection != nil {
+		return c.grpcConnection, nil
+	}
+	// the connection reconnects by itself after the cache process restarts
+	grpcConnection, err := pb.GrpcDial(context.Background(), c.socketPath, grpc.WithInsecure(),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.Config{BaseDelay: 100 * time.Millisecond, Multiplier: 1.6, Jitter: 0.2, MaxDelay: 3 * time.Second},
+			MinConnectTimeout: time.Second,
+		}),
+		grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", address)
+		}))
+	if err != nil {
+		return nil, err
+	}
+	c.grpcConnection = grpcConnection
+	return grpcConnection, nil
+}
+
+func (c *RemoteChunkCache) Shutdown() {
+	c.Lock()
+	defer c.Unlock()
+	if c.grpcConnection != nil {
+		c.grpcConnection.Close()
+		c.grpcConnection = nil
+	}
+}
@@ -0,0 +1,74 @@
+package chunk_cache
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/cache_pb"
+)
+
+type testCacheServer struct {
+	cache *TieredChunkCache
+}
+
+func (s *testCacheServer) GetChunk(ctx context.Context, req *cache_pb.GetChunkRequest) (*cache_pb.GetChunkResponse, error) {
+	return &cache_pb.GetChunkResponse{Data: s.cache.GetChunk(req.FileId, req.MinSize)}, nil
+}
+
+func (s *testCacheServer) GetChunkSlice(ctx context.Context, req *cache_pb.GetChunkSliceRequest) (*cache_pb.GetChunkResponse, error) {
+	return &cache_pb.GetChunkResponse{Data: s.cache.GetChunkSlice(req.FileId, req.Offset, req.Length)}, nil
+}
+
+func (s *testCacheServer) SetChunk(ctx context.Context, req *cache_pb.SetChunkRequest) (*cache_pb.SetChunkResponse, error) {
+	s.cache.SetChunk(req.FileId, req.Data)
+	return &cache_pb.SetChunkResponse{}, nil
+}
+
+func TestRemoteChunkCache(t *testing.T) {
+
+	tmpDir, _ := ioutil.TempDir("", "c")
+	defer os.RemoveAll(tmpDir)
+
+	socketPath := filepath.Join(tmpDir, "cache.sock")
+	cache := NewRemoteChunkCache(socketPath)
+	defer cache.Shutdown()
+
+	// without the cache process, it is just a cache miss
+	if data := cache.GetChunk("1,0102030405", 1); data != nil {
+		t.Fatalf("unexpected data without the cache process")
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	grpcS := pb.NewGrpcServer()
+	cache_pb.RegisterSeaweedCacheServer(grpcS, &testCacheServer{cache: NewTieredChunkCache(2, tmpDir, 32, 1024)})
+	go grpcS.Serve(listener)
+	defer grpcS.Stop()
+
+	// wait for the reconnection
+	data := []byte("some chunk data")
+	for start := time.Now(); ; time.Sleep(100 * time.Millisecond) {
+		cache.SetChunk("1,0102030405", data)
+		if got := cache.GetChunk("1,0102030405", uint64(len(data))); bytes.Equal(got, data) {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("can not use the cache process after it starts")
+		}
+	}
+	if got := cache.GetChunkSlice("1,0102030405", 5, 5); !bytes.Equal(got, data[5:10]) {
+		t.Fatalf("get chunk slice: %q", got)
+	}
+	if got := cache.GetChunk("1,0607080910", 1); got != nil {
+		t.Fatalf("unexpected data for a missing chunk: %q", got)
+	}
+}
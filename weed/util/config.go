@@ -1,6 +1,9 @@
 package util
 
 import (
+	"fmt"
+	"os"
+	"sort"
 	"strings"
 	"sync"
 
@@ -19,6 +22,9 @@ type Configuration interface {
 
 func LoadConfiguration(configFileName string, required bool) (loaded bool) {
 
+	// set up the environment variable overrides
+	GetViper()
+
 	// find a filer store
 	viper.SetConfigName(configFileName)              // name of config file (without extension)
 	viper.AddConfigPath(".")                         // optionally look for config in the working directory
@@ -42,10 +48,58 @@ func LoadConfiguration(configFileName string, required bool) (loaded bool) {
 		}
 	}
 	glog.V(1).Infof("Reading %s.toml from %s", configFileName, viper.ConfigFileUsed())
+	logEnvironmentOverrides(configFileName)
 
 	return true
 }
 
+// EnvironmentVariableName is the environment variable overriding the configuration key,
+// e.g., WEED_MYSQL_PASSWORD for mysql.password
+func EnvironmentVariableName(key string) string {
+	return "WEED_" + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+}
+
+var (
+	loggedEnvironmentOverrides     = make(map[string]bool)
+	loggedEnvironmentOverridesLock sync.Mutex
+)
+
+// logEnvironmentOverrides reports the options in the configuration files which are overridden by environment variables
+func logEnvironmentOverrides(configFileName string) {
+	loggedEnvironmentOverridesLock.Lock()
+	defer loggedEnvironmentOverridesLock.Unlock()
+	keys := viper.AllKeys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := EnvironmentVariableName(key)
+		if _, found := os.LookupEnv(name); !found || loggedEnvironmentOverrides[key] {
+			continue
+		}
+		loggedEnvironmentOverrides[key] = true
+		glog.V(0).Infof("%s.toml %s is overridden by environment variable %s", configFileName, key, name)
+	}
+}
+
+// ReloadConfiguration reads the configuration file again, e.g., when receiving SIGHUP.
+// The values in the file replace the loaded values, and the values removed from the file are kept.
+// Unlike LoadConfiguration, an invalid file is reported as an error, and the loaded values are not changed.
+func ReloadConfiguration(configFileName string) (loaded bool, err error) {
+	v := GetViper()
+	v.Lock()
+	defer v.Unlock()
+
+	viper.SetConfigName(configFileName)
+	if err = viper.MergeInConfig(); err != nil {
+		if strings.Contains(err.Error(), "Not Found") {
+			return false, nil
+		}
+		return false, fmt.Errorf("reading %s: %v", viper.ConfigFileUsed(), err)
+	}
+	glog.V(0).Infof("Reloaded %s.toml from %s", configFileName, viper.ConfigFileUsed())
+
+	return true, nil
+}
+
 type ViperProxy struct {
 	*viper.Viper
 	sync.Mutex
@@ -79,9 +133,19 @@ func (vp *ViperProxy) GetInt(key string) int {
 	return vp.Viper.GetInt(key)
 }
 
+// GetStringSlice also accepts a comma-separated list, e.g., from an environment variable
 func (vp *ViperProxy) GetStringSlice(key string) []string {
 	vp.Lock()
 	defer vp.Unlock()
+	if value, ok := vp.Viper.Get(key).(string); ok {
+		var list []string
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
 	return vp.Viper.GetStringSlice(key)
 }
 
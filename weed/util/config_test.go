@@ -0,0 +1,28 @@
+package util
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestEnvironmentVariableName(t *testing.T) {
+	if name := EnvironmentVariableName("filer.options.recursive_delete"); name != "WEED_FILER_OPTIONS_RECURSIVE_DELETE" {
+		t.Errorf("environment variable name %s", name)
+	}
+}
+
+func TestGetStringSliceFromEnvironment(t *testing.T) {
+	v := GetViper()
+
+	os.Setenv("WEED_TEST_CONFIG_URLS", "http://a:1, http://b:2,")
+	defer os.Unsetenv("WEED_TEST_CONFIG_URLS")
+	if urls := v.GetStringSlice("test_config.urls"); !reflect.DeepEqual(urls, []string{"http://a:1", "http://b:2"}) {
+		t.Errorf("urls from environment variable: %v", urls)
+	}
+
+	v.SetDefault("test_config.types", []string{"x", "y"})
+	if types := v.GetStringSlice("test_config.types"); !reflect.DeepEqual(types, []string{"x", "y"}) {
+		t.Errorf("types: %v", types)
+	}
+}
@@ -1,4 +1,4 @@
-// +build !5BytesOffset
+// +build !5BytesOffset,!8BytesOffset
 
 package util
 
@@ -0,0 +1,8 @@
+// +build 8BytesOffset
+
+package util
+
+const (
+	sizeLimit         = "1PB"
+	VolumeSizeLimitGB = 1000000
+)
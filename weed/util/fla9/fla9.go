@@ -69,11 +69,14 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/spf13/viper"
 )
 
 // ErrHelp is the error returned if the -help or -h flag is invoked
@@ -886,7 +889,7 @@ func (f *FlagSet) parseOne() (bool, error) {
 // The return value will be ErrHelp if -help or -h were set but not defined.
 func (f *FlagSet) Parse(arguments []string) error {
 	if _, ok := f.formal[DefaultConfigFlagName]; !ok {
-		f.String(DefaultConfigFlagName, "", "a file of command line options, each line in optionName=optionValue format")
+		f.String(DefaultConfigFlagName, "", "a file of command line options, each line in optionName=optionValue format, or a .toml, .yaml or .json file")
 	}
 
 	f.parsed = true
@@ -1013,6 +1016,21 @@ func (f *FlagSet) Init(name string, errorHandling ErrorHandling) {
 // flag name before looking it up in the environment variables.
 var EnvPrefix = "WEED"
 
+// SetEnvPrefix sets the prefix of the environment variable names, e.g., "WEED_MASTER".
+func (f *FlagSet) SetEnvPrefix(prefix string) {
+	f.envPrefix = prefix
+}
+
+// EnvName returns the environment variable name to set the flag,
+// upper cased with the "-" and "." replaced by "_", e.g., "WEED_SERVER_MASTER_PORT" for "master.port".
+func (f *FlagSet) EnvName(name string) string {
+	envKey := strings.ToUpper(name)
+	if f.envPrefix != "" {
+		envKey = f.envPrefix + "_" + envKey
+	}
+	return strings.NewReplacer("-", "_", ".", "_").Replace(envKey)
+}
+
 // ParseEnv parses flags from environment variables.
 // Flags already set will be ignored.
 func (f *FlagSet) ParseEnv(environ []string) error {
@@ -1039,11 +1057,7 @@ func (f *FlagSet) ParseEnv(environ []string) error {
 			return f.failf("environment variable provided but not defined: %s", name)
 		}
 
-		envKey := strings.ToUpper(flag.Name)
-		if f.envPrefix != "" {
-			envKey = f.envPrefix + "_" + envKey
-		}
-		envKey = strings.Replace(envKey, "-", "_", -1)
+		envKey := f.EnvName(flag.Name)
 
 		value, isSet := env[envKey]
 		if !isSet {
@@ -1084,7 +1098,13 @@ var DefaultConfigFlagName = "options"
 // ParseFile parses flags from the file in path.
 // Same format as commandline arguments, newlines and lines beginning with a
 // "#" character are ignored. Flags already set will be ignored.
+// Files ending with .toml, .yaml, .yml or .json are parsed by ParseStructuredFile.
 func (f *FlagSet) ParseFile(path string, ignoreUndefinedConf bool) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml", ".yaml", ".yml", ".json":
+		return f.ParseStructuredFile(path, ignoreUndefinedConf)
+	}
+
 	fp, err := os.Open(path) // Extract arguments from file
 	if err != nil {
 		return err
@@ -1147,3 +1167,76 @@ func (f *FlagSet) ParseFile(path string, ignoreUndefinedConf bool) error {
 
 	return scanner.Err()
 }
+
+// ParseStructuredFile parses flags from a toml, yaml or json file, shared by several commands.
+// The keys in the table named after the flag set, e.g., [master] for "weed master",
+// take precedence over the top level keys. Nested keys are joined by ".", so the
+// [server.master] table or the top level "master.port" key sets the -master.port flag.
+// Lists are joined by ",". Flags already set will be ignored.
+func (f *FlagSet) ParseStructuredFile(path string, ignoreUndefinedConf bool) error {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+
+	// the keys are case insensitive
+	formal := make(map[string]*Flag)
+	for name, flag := range f.formal {
+		formal[strings.ToLower(name)] = flag
+	}
+
+	var sectionKeys, topLevelKeys []string
+	sectionPrefix := strings.ToLower(f.name) + "."
+	for _, key := range v.AllKeys() {
+		if f.name != "" && strings.HasPrefix(key, sectionPrefix) {
+			sectionKeys = append(sectionKeys, key)
+		} else {
+			topLevelKeys = append(topLevelKeys, key)
+		}
+	}
+	sort.Strings(sectionKeys)
+	sort.Strings(topLevelKeys)
+
+	for _, key := range append(sectionKeys, topLevelKeys...) {
+		name := key
+		if _, found := formal[name]; !found && strings.HasPrefix(key, sectionPrefix) {
+			name = key[len(sectionPrefix):]
+		}
+		flag, alreadyThere := formal[name]
+		if !alreadyThere {
+			if ignoreUndefinedConf {
+				continue
+			}
+			return f.failf("configuration variable provided but not defined: %s", key)
+		}
+
+		// Ignore flag when already set; arguments and the section have precedence
+		if f.actual[flag.Name] != nil {
+			continue
+		}
+
+		var value string
+		switch val := v.Get(key).(type) {
+		case []interface{}:
+			var values []string
+			for _, x := range val {
+				values = append(values, fmt.Sprint(x))
+			}
+			value = strings.Join(values, ",")
+		default:
+			value = fmt.Sprint(val)
+		}
+
+		if err := flag.Value.Set(value); err != nil {
+			return f.failf("invalid value %q for configuration variable %s: %v", value, key, err)
+		}
+
+		if f.actual == nil {
+			f.actual = make(map[string]*Flag)
+		}
+		f.actual[flag.Name] = flag
+	}
+
+	return nil
+}
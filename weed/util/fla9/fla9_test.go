@@ -0,0 +1,75 @@
+package fla9
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestFlagSet() (*FlagSet, *int, *string, *string, *bool) {
+	f := NewFlagSet("server", ContinueOnError)
+	f.SetEnvPrefix("WEED_SERVER")
+	port := f.Int("master.port", 9333, "")
+	ip := f.String("ip", "", "")
+	peers := f.String("master.peers", "", "")
+	s3 := f.Bool("s3", false, "")
+	return f, port, ip, peers, s3
+}
+
+func TestEnvName(t *testing.T) {
+	f, _, _, _, _ := newTestFlagSet()
+	if name := f.EnvName("master.volumeSizeLimitMB"); name != "WEED_SERVER_MASTER_VOLUMESIZELIMITMB" {
+		t.Errorf("env name %s", name)
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	f, port, ip, _, s3 := newTestFlagSet()
+	if err := f.Parse([]string{"-ip=10.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.ParseEnv([]string{"WEED_SERVER_MASTER_PORT=9334", "WEED_SERVER_IP=10.0.0.2", "WEED_SERVER_S3="}); err != nil {
+		t.Fatal(err)
+	}
+	if *port != 9334 || !*s3 {
+		t.Errorf("port %d, s3 %v", *port, *s3)
+	}
+	if *ip != "10.0.0.1" {
+		t.Errorf("the argument is overridden by the environment variable: %s", *ip)
+	}
+}
+
+func TestParseStructuredFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "weed.toml")
+	if err := os.WriteFile(path, []byte(`
+ip = "10.0.0.1"
+undefined = 1
+
+[master]
+port = 9334
+peers = ["10.0.0.1:9333", "10.0.0.2:9333"]
+
+[server]
+ip = "10.0.0.2"
+s3 = true
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, port, ip, peers, s3 := newTestFlagSet()
+	if err := f.Parse([]string{"-options=" + path}); err != nil {
+		t.Fatal(err)
+	}
+	if *port != 9334 || *peers != "10.0.0.1:9333,10.0.0.2:9333" || !*s3 {
+		t.Errorf("port %d, peers %s, s3 %v", *port, *peers, *s3)
+	}
+	if *ip != "10.0.0.2" {
+		t.Errorf("the [server] table should have precedence: ip %s", *ip)
+	}
+
+	f, _, _, _, _ = newTestFlagSet()
+	if err := f.ParseStructuredFile(path, false); err == nil {
+		t.Errorf("expect error on undefined option")
+	}
+}
@@ -13,9 +13,14 @@ var signalChan chan os.Signal
 var hooks = make([]func(), 0)
 var hookLock sync.Mutex
 
+var reloadChan chan os.Signal
+var reloadHooks = make([]func(), 0)
+
 func init() {
 	signalChan = make(chan os.Signal, 1)
-	signal.Ignore(syscall.SIGHUP)
+	// SIGHUP does not exit the process, but reloads the configuration
+	reloadChan = make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
 	signal.Notify(signalChan,
 		os.Interrupt,
 		os.Kill,
@@ -33,6 +38,16 @@ func init() {
 			os.Exit(0)
 		}
 	}()
+	go func() {
+		for _ = range reloadChan {
+			hookLock.Lock()
+			fns := reloadHooks
+			hookLock.Unlock()
+			for _, hook := range fns {
+				hook()
+			}
+		}
+	}()
 }
 
 func OnInterrupt(fn func()) {
@@ -44,3 +59,11 @@ func OnInterrupt(fn func()) {
 	// controlling terminal close, daemon not exit
 	hooks = append(hooks, fn)
 }
+
+// OnReload registers a function to reload the configuration when receiving SIGHUP
+func OnReload(fn func()) {
+	hookLock.Lock()
+	defer hookLock.Unlock()
+
+	reloadHooks = append(reloadHooks, fn)
+}
@@ -327,7 +327,8 @@ func ReadUrlAsStream(fileUrl string, cipherKey []byte, isContentGzipped bool, is
 			return false, nil
 		}
 		if err != nil {
-			return false, err
+			// the connection may be broken, can retry with other replicas
+			return true, err
 		}
 	}
 
@@ -1,10 +1,12 @@
 package util
 
 import (
+	"context"
 	"math/rand"
 	"reflect"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // initial version comes from https://github.com/korovkin/limiter/blob/master/limiter.go
@@ -112,3 +114,56 @@ func (c *LimitedOutOfOrderProcessor) Execute(request OperationRequest) {
 	index := rand.Uint32() % c.processorSlots
 	c.processors[index] <- request
 }
+
+// ConcurrencyLimiter limits the number of operations running at the same time.
+// The operations over the limit wait in the queue, for at most the queue timeout.
+// A nil limiter does not limit anything.
+type ConcurrencyLimiter struct {
+	tokens       chan struct{}
+	queueTimeout time.Duration
+}
+
+// NewConcurrencyLimiter returns nil if the limit is not positive
+func NewConcurrencyLimiter(limit int, queueTimeout time.Duration) *ConcurrencyLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &ConcurrencyLimiter{
+		tokens:       make(chan struct{}, limit),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// Acquire waits for a slot to run the operation. It returns false if the wait times out, or the context is done.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context) bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.tokens <- struct{}{}:
+		return true
+	default:
+	}
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case l.tokens <- struct{}{}:
+		return true
+	case <-timeout:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Release frees the slot of a finished operation
+func (l *ConcurrencyLimiter) Release() {
+	if l == nil {
+		return
+	}
+	<-l.tokens
+}
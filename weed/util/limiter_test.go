@@ -0,0 +1,44 @@
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+
+	unlimited := NewConcurrencyLimiter(0, time.Second)
+	if unlimited != nil || !unlimited.Acquire(context.Background()) {
+		t.Fatalf("a zero limit should not limit")
+	}
+	unlimited.Release()
+
+	limiter := NewConcurrencyLimiter(2, 20*time.Millisecond)
+	ctx := context.Background()
+	if !limiter.Acquire(ctx) || !limiter.Acquire(ctx) {
+		t.Fatalf("acquire under the limit")
+	}
+
+	start := time.Now()
+	if limiter.Acquire(ctx) {
+		t.Fatalf("acquired over the limit")
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Errorf("queue timeout after %v", time.Since(start))
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		limiter.Release()
+	}()
+	if !limiter.Acquire(ctx) {
+		t.Fatalf("acquire after a release")
+	}
+
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if limiter.Acquire(cancelledCtx) {
+		t.Fatalf("acquired with a cancelled context")
+	}
+}
@@ -36,6 +36,7 @@ type LogBuffer struct {
 	notifyFn      func()
 	isStopping    bool
 	flushChan     chan *dataToFlush
+	flushDone     chan struct{}
 	lastTsNs      int64
 	sync.RWMutex
 }
@@ -50,6 +51,7 @@ func NewLogBuffer(name string, flushInterval time.Duration, flushFn func(startTi
 		flushFn:       flushFn,
 		notifyFn:      notifyFn,
 		flushChan:     make(chan *dataToFlush, 256),
+		flushDone:     make(chan struct{}),
 	}
 	go lb.loopFlush()
 	go lb.loopInterval()
@@ -116,18 +118,22 @@ func (m *LogBuffer) AddToBuffer(partitionKey, data []byte, eventTsNs int64) {
 
 func (m *LogBuffer) Shutdown() {
 	m.Lock()
-	defer m.Unlock()
-
 	if m.isStopping {
+		m.Unlock()
 		return
 	}
 	m.isStopping = true
 	toFlush := m.copyToFlush()
 	m.flushChan <- toFlush
 	close(m.flushChan)
+	m.Unlock()
+
+	// wait for the remaining data to be flushed, before the caller closes the storage
+	<-m.flushDone
 }
 
 func (m *LogBuffer) loopFlush() {
+	defer close(m.flushDone)
 	for d := range m.flushChan {
 		if d != nil {
 			// glog.V(4).Infof("%s flush [%v, %v] size %d", m.name, d.startTime, d.stopTime, len(d.data.Bytes()))
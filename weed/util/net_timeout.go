@@ -2,6 +2,7 @@ package util
 
 import (
 	"net"
+	"sync"
 	"time"
 
 	"github.com/chrislusf/seaweedfs/weed/stats"
@@ -36,11 +37,29 @@ type Conn struct {
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	isClosed     bool
+
+	readDeadlineLock sync.Mutex
+	readDeadline     time.Time
+}
+
+// SetReadDeadline keeps the deadline set by the caller, e.g., net/http aborting a pending read,
+// from being extended by the read timeout
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadlineLock.Lock()
+	defer c.readDeadlineLock.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(t)
 }
 
 func (c *Conn) Read(b []byte) (count int, e error) {
 	if c.ReadTimeout != 0 {
-		err := c.Conn.SetReadDeadline(time.Now().Add(c.ReadTimeout))
+		c.readDeadlineLock.Lock()
+		deadline := time.Now().Add(c.ReadTimeout)
+		if !c.readDeadline.IsZero() && c.readDeadline.Before(deadline) {
+			deadline = c.readDeadline
+		}
+		err := c.Conn.SetReadDeadline(deadline)
+		c.readDeadlineLock.Unlock()
 		if err != nil {
 			return 0, err
 		}
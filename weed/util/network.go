@@ -1,7 +1,10 @@
 package util
 
 import (
+	"fmt"
 	"net"
+	"strconv"
+	"strings"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
 )
@@ -13,6 +16,8 @@ func DetectedHostAddress() string {
 		return ""
 	}
 
+	// prefer IPv4, and fall back to the global IPv6 address on the IPv6-only hosts
+	var ipv6Address string
 	for _, netInterface := range netInterfaces {
 		if (netInterface.Flags & net.FlagUp) == 0 {
 			continue
@@ -27,9 +32,104 @@ func DetectedHostAddress() string {
 				if ipNet.IP.To4() != nil {
 					return ipNet.IP.String()
 				}
+				if ipv6Address == "" && ipNet.IP.IsGlobalUnicast() {
+					ipv6Address = ipNet.IP.String()
+				}
 			}
 		}
 	}
 
+	if ipv6Address != "" {
+		return ipv6Address
+	}
 	return "localhost"
 }
+
+// JoinHostPort makes the "host:port" address, with the IPv6 literal in brackets, e.g., "[::1]:8080".
+// The host may be given with or without the brackets. An empty host listens on all the IPv4 and IPv6 addresses.
+func JoinHostPort(host string, port int) string {
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), strconv.Itoa(port))
+}
+
+// SplitHostPort splits the "host:port" or "[ipv6]:port" address, with the brackets removed from the host
+func SplitHostPort(address string) (host string, port int, err error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, fmt.Errorf("server should have hostname:port or [ipv6]:port format: %v", err)
+	}
+	if port, err = strconv.Atoi(portString); err != nil {
+		return "", 0, fmt.Errorf("server port parse error: %v", err)
+	}
+	return host, port, nil
+}
+
+// ParseNetworks parses the comma separated CIDR list, e.g., "10.0.0.0/8,192.168.0.0/16"
+func ParseNetworks(cidrs string) (networks []*net.IPNet, err error) {
+	for _, cidr := range strings.Split(cidrs, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		_, network, parseErr := net.ParseCIDR(cidr)
+		if parseErr != nil {
+			return nil, fmt.Errorf("parse network %s: %v", cidr, parseErr)
+		}
+		networks = append(networks, network)
+	}
+	return
+}
+
+// IsInNetworks tells whether the ip of the "ip" or "ip:port" address is in any of the networks
+func IsInNetworks(address string, networks []*net.IPNet) bool {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveServerAddresses expands the server addresses discovered by DNS, so
+// servers can be referred to by Kubernetes headless services instead of fixed ip addresses.
+// "dnssrv+_http._tcp.name" resolves to the host:port of each SRV record, and
+// "dns+name:port" resolves to ip:port for each ip address of the name.
+// Other addresses are kept as they are. It should be called again
+// after failing to reach the resolved servers, since the servers may have moved.
+func ResolveServerAddresses(addresses []string) (resolved []string) {
+	for _, address := range addresses {
+		switch {
+		case strings.HasPrefix(address, "dnssrv+"):
+			_, records, err := net.LookupSRV("", "", strings.TrimPrefix(address, "dnssrv+"))
+			if err != nil {
+				glog.V(0).Infof("resolve %s: %v", address, err)
+				continue
+			}
+			for _, record := range records {
+				resolved = append(resolved, JoinHostPort(strings.TrimSuffix(record.Target, "."), int(record.Port)))
+			}
+		case strings.HasPrefix(address, "dns+"):
+			host, port, err := net.SplitHostPort(strings.TrimPrefix(address, "dns+"))
+			if err != nil {
+				glog.V(0).Infof("resolve %s: %v", address, err)
+				continue
+			}
+			ips, err := net.LookupHost(host)
+			if err != nil {
+				glog.V(0).Infof("resolve %s: %v", address, err)
+				continue
+			}
+			for _, ip := range ips {
+				resolved = append(resolved, net.JoinHostPort(ip, port))
+			}
+		default:
+			resolved = append(resolved, address)
+		}
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package util
+
+import "testing"
+
+func TestIsInNetworks(t *testing.T) {
+	networks, err := ParseNetworks("10.0.0.0/8, 192.168.1.0/24")
+	if err != nil {
+		t.Fatalf("parse networks: %v", err)
+	}
+	for address, expected := range map[string]bool{
+		"10.1.2.3":          true,
+		"10.1.2.3:8080":     true,
+		"192.168.1.200:80":  true,
+		"192.168.2.1:80":    false,
+		"127.0.0.1":         false,
+		"[::1]:8080":        false,
+		"not-an-ip-address": false,
+	} {
+		if actual := IsInNetworks(address, networks); actual != expected {
+			t.Errorf("IsInNetworks(%s) = %v, expected %v", address, actual, expected)
+		}
+	}
+	if _, err = ParseNetworks("10.0.0.0"); err == nil {
+		t.Errorf("expected error for network without mask")
+	}
+}
+
+func TestResolveServerAddresses(t *testing.T) {
+	resolved := ResolveServerAddresses([]string{"master1:9333", "dns+localhost:9333", "dns+:bad"})
+	if len(resolved) < 2 || resolved[0] != "master1:9333" {
+		t.Fatalf("unexpected resolved addresses %v", resolved)
+	}
+	for _, address := range resolved[1:] {
+		if address != "127.0.0.1:9333" && address != "[::1]:9333" {
+			t.Errorf("unexpected resolved localhost address %s", address)
+		}
+	}
+}
+
+func TestJoinAndSplitHostPort(t *testing.T) {
+	for host, expected := range map[string]string{
+		"localhost":     "localhost:8080",
+		"10.0.0.1":      "10.0.0.1:8080",
+		"::1":           "[::1]:8080",
+		"[::1]":         "[::1]:8080",
+		"2001:db8::a:b": "[2001:db8::a:b]:8080",
+		"":              ":8080",
+	} {
+		address := JoinHostPort(host, 8080)
+		if address != expected {
+			t.Errorf("JoinHostPort(%s) = %s, expected %s", host, address, expected)
+		}
+		splitHost, port, err := SplitHostPort(address)
+		if err != nil || port != 8080 || JoinHostPort(splitHost, port) != expected {
+			t.Errorf("SplitHostPort(%s) = %s, %d, %v", address, splitHost, port, err)
+		}
+	}
+	for _, address := range []string{"localhost", "::1:8080", "[::1]", "localhost:port"} {
+		if _, _, err := SplitHostPort(address); err == nil {
+			t.Errorf("SplitHostPort(%s) expected error", address)
+		}
+	}
+	if host, port, err := ParseHostPort("[fd00::1]:8888"); err != nil || host != "fd00::1" || port != 8888 {
+		t.Errorf("ParseHostPort = %s, %d, %v", host, port, err)
+	}
+}
@@ -48,16 +48,10 @@ func ParseFilerUrl(entryPath string) (filerServer string, filerPort int64, path
 }
 
 func ParseHostPort(hostPort string) (filerServer string, filerPort int64, err error) {
-	parts := strings.Split(hostPort, ":")
-	if len(parts) != 2 {
-		err = fmt.Errorf("failed to parse %s\n", hostPort)
+	host, port, err := SplitHostPort(hostPort)
+	if err != nil {
+		err = fmt.Errorf("failed to parse %s: %v", hostPort, err)
 		return
 	}
-
-	filerPort, err = strconv.ParseInt(parts[1], 10, 64)
-	if err == nil {
-		filerServer = parts[0]
-	}
-
-	return
+	return host, int64(port), nil
 }
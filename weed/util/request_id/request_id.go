@@ -0,0 +1,88 @@
+package request_id
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/metadata"
+)
+
+// The request id is generated when a request enters the cluster, at the filer, the s3 gateway, or the volume server,
+// and passed along to the downstream http requests in the header, and to the grpc calls in the metadata,
+// so the log lines and the error responses of one request can be correlated across the servers.
+
+const (
+	Header = "X-Request-Id"
+	// the grpc metadata keys are lower case
+	metadataKey = "x-request-id"
+	// longer request ids from the clients are replaced
+	maxLength = 128
+)
+
+type contextKey struct{}
+
+// New generates a request id
+func New() string {
+	return uuid.New().String()
+}
+
+// Set returns a context carrying the request id
+func Set(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// Get returns the request id of the context, or empty if none
+func Get(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// FromHttpRequest returns the request id passed along by the upstream server or client, or else a new one
+func FromHttpRequest(r *http.Request) string {
+	if id := r.Header.Get(Header); id != "" && len(id) <= maxLength {
+		return id
+	}
+	return New()
+}
+
+// InjectToRequest passes along the request id of the context to the downstream http request
+func InjectToRequest(ctx context.Context, req *http.Request) {
+	if id := Get(ctx); id != "" {
+		req.Header.Set(Header, id)
+	}
+}
+
+// Middleware sets the request id to the request context and the response header
+func Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := FromHttpRequest(r)
+		w.Header().Set(Header, id)
+		h.ServeHTTP(w, r.WithContext(Set(r.Context(), id)))
+	})
+}
+
+// OutgoingContext passes along the request id of the context to the grpc calls
+func OutgoingContext(ctx context.Context) context.Context {
+	id := Get(ctx)
+	if id == "" {
+		return ctx
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(metadataKey)) > 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, metadataKey, id)
+}
+
+// FromIncomingContext returns a context carrying the request id from the grpc metadata, if any
+func FromIncomingContext(ctx context.Context) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(metadataKey); len(ids) > 0 && ids[0] != "" && len(ids[0]) <= maxLength {
+			return Set(ctx, ids[0])
+		}
+	}
+	return ctx
+}
@@ -0,0 +1,58 @@
+package request_id
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestMiddleware(t *testing.T) {
+	var handledId string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handledId = Get(r.Context())
+	}))
+
+	// a new request id at the entry point
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/a", nil))
+	if handledId == "" || w.Header().Get(Header) != handledId {
+		t.Errorf("request id %q, response header %q", handledId, w.Header().Get(Header))
+	}
+
+	// the request id passed along by the upstream server
+	r := httptest.NewRequest("GET", "/a", nil)
+	r.Header.Set(Header, "upstream-id")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if handledId != "upstream-id" || w.Header().Get(Header) != "upstream-id" {
+		t.Errorf("request id %q, response header %q", handledId, w.Header().Get(Header))
+	}
+
+	downstream := httptest.NewRequest("PUT", "/b", nil)
+	InjectToRequest(Set(context.Background(), "upstream-id"), downstream)
+	if downstream.Header.Get(Header) != "upstream-id" {
+		t.Errorf("downstream request id %q", downstream.Header.Get(Header))
+	}
+}
+
+func TestGrpcMetadata(t *testing.T) {
+	ctx := OutgoingContext(Set(context.Background(), "grpc-id"))
+	md, _ := metadata.FromOutgoingContext(ctx)
+
+	incoming := FromIncomingContext(metadata.NewIncomingContext(context.Background(), md))
+	if id := Get(incoming); id != "grpc-id" {
+		t.Errorf("incoming request id %q", id)
+	}
+	if id := Get(FromIncomingContext(context.Background())); id != "" {
+		t.Errorf("unexpected request id %q", id)
+	}
+
+	// passed along only once
+	md, _ = metadata.FromOutgoingContext(OutgoingContext(ctx))
+	if ids := md.Get(metadataKey); len(ids) != 1 {
+		t.Errorf("outgoing request ids %v", ids)
+	}
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"context"
 	"strings"
 	"time"
 
@@ -32,6 +33,51 @@ func Retry(name string, job func() error) (err error) {
 	return err
 }
 
+// RetryPolicy retries a job failed with retriable errors, waiting longer after each attempt
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	IsRetriable    func(err error) bool
+}
+
+// Backoff is the wait time after the attempt, counted from 1
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff = time.Duration(float64(backoff) * p.Multiplier)
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff
+}
+
+// Do runs the job at most MaxAttempts times, and stops waiting for the next attempt once the ctx is done
+func (p RetryPolicy) Do(ctx context.Context, name string, job func() error) (err error) {
+	for attempt := 1; ; attempt++ {
+		if err = job(); err == nil {
+			if attempt > 1 {
+				glog.V(0).Infof("retry %s successfully", name)
+			}
+			return nil
+		}
+		if attempt >= p.MaxAttempts || p.IsRetriable == nil || !p.IsRetriable(err) {
+			return err
+		}
+		backoff := p.Backoff(attempt)
+		glog.V(0).Infof("retry %s in %v: err: %v", name, backoff, err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
 // return the first non empty string
 func Nvl(values ...string) string {
 	for _, s := range values {
@@ -0,0 +1,83 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	errRetriable = errors.New("retriable")
+	errPermanent = errors.New("permanent")
+)
+
+func testRetryPolicy(maxAttempts int) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     4 * time.Millisecond,
+		Multiplier:     2,
+		IsRetriable: func(err error) bool {
+			return err == errRetriable
+		},
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := testRetryPolicy(10)
+	for attempt, expected := range []time.Duration{1, 2, 4, 4, 4} {
+		if backoff := p.Backoff(attempt + 1); backoff != expected*time.Millisecond {
+			t.Errorf("backoff after attempt %d: %v, expected %v", attempt+1, backoff, expected*time.Millisecond)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+
+	tests := []struct {
+		name             string
+		maxAttempts      int
+		errs             []error
+		expectedAttempts int
+		expectedErr      error
+	}{
+		{"succeed at once", 3, []error{nil}, 1, nil},
+		{"succeed after retries", 3, []error{errRetriable, errRetriable, nil}, 3, nil},
+		{"give up after max attempts", 3, []error{errRetriable, errRetriable, errRetriable, nil}, 3, errRetriable},
+		{"not retriable", 3, []error{errPermanent, nil}, 1, errPermanent},
+	}
+	for _, tt := range tests {
+		attempts := 0
+		err := testRetryPolicy(tt.maxAttempts).Do(context.Background(), tt.name, func() error {
+			err := tt.errs[attempts]
+			attempts++
+			return err
+		})
+		if attempts != tt.expectedAttempts {
+			t.Errorf("%s: %d attempts, expected %d", tt.name, attempts, tt.expectedAttempts)
+		}
+		if err != tt.expectedErr {
+			t.Errorf("%s: %v, expected %v", tt.name, err, tt.expectedErr)
+		}
+	}
+}
+
+func TestRetryPolicyDoCancelled(t *testing.T) {
+	p := testRetryPolicy(100)
+	p.InitialBackoff, p.MaxBackoff = time.Hour, time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	err := p.Do(ctx, "cancelled", func() error {
+		attempts++
+		return errRetriable
+	})
+	if err != errRetriable || attempts != 1 {
+		t.Errorf("cancelled after %d attempts: %v", attempts, err)
+	}
+}
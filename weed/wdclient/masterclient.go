@@ -2,7 +2,10 @@ package wdclient
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/chrislusf/seaweedfs/weed/util"
@@ -40,6 +43,22 @@ func (mc *MasterClient) GetMaster() string {
 	return mc.currentMaster
 }
 
+// SetReplicaSelection sets how to choose among the replicas of a volume to read from,
+// one of ReplicaSelectionNearest, ReplicaSelectionRandom, or ReplicaSelectionLatency
+func (mc *MasterClient) SetReplicaSelection(strategy string, rack string) error {
+	selector, err := NewReplicaSelector(strategy, mc.DataCenter, rack)
+	if err != nil {
+		return err
+	}
+	mc.setReplicaSelector(selector)
+	return nil
+}
+
+// GetCurrentMaster returns the connected master without waiting, or empty if not connected
+func (mc *MasterClient) GetCurrentMaster() string {
+	return mc.currentMaster
+}
+
 func (mc *MasterClient) WaitUntilConnected() {
 	for mc.currentMaster == "" {
 		time.Sleep(time.Duration(rand.Int31n(200)) * time.Millisecond)
@@ -55,7 +74,7 @@ func (mc *MasterClient) KeepConnectedToMaster() {
 }
 
 func (mc *MasterClient) FindLeaderFromOtherPeers(myMasterAddress string) (leader string) {
-	for _, master := range mc.masters {
+	for _, master := range util.ResolveServerAddresses(mc.masters) {
 		if master == myMasterAddress {
 			continue
 		}
@@ -82,15 +101,16 @@ func (mc *MasterClient) FindLeaderFromOtherPeers(myMasterAddress string) (leader
 
 func (mc *MasterClient) tryAllMasters() {
 	nextHintedLeader := ""
-	for _, master := range mc.masters {
+	// resolve the masters again for each round, in case the masters have moved
+	for _, master := range util.ResolveServerAddresses(mc.masters) {
 
 		nextHintedLeader = mc.tryConnectToMaster(master)
 		for nextHintedLeader != "" {
 			nextHintedLeader = mc.tryConnectToMaster(nextHintedLeader)
 		}
 
+		// keep the volume locations until connected to the next leader, to read during the leader change
 		mc.currentMaster = ""
-		mc.vidMap = newVidMap("")
 	}
 }
 
@@ -101,6 +121,21 @@ func (mc *MasterClient) tryConnectToMaster(master string) (nextHintedLeader stri
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
+		// only the leader knows the volume locations and can assign file ids
+		resp, err := client.GetMasterConfiguration(ctx, &master_pb.GetMasterConfigurationRequest{})
+		if err != nil {
+			glog.V(1).Infof("%s masterClient failed to get configuration from %s: %v", mc.clientType, master, err)
+			return err
+		}
+		if resp.Leader == "" {
+			return fmt.Errorf("master %s has no leader", master)
+		}
+		if resp.Leader != master {
+			glog.V(0).Infof("%s masterClient redirected from %s to leader %v", mc.clientType, master, resp.Leader)
+			nextHintedLeader = resp.Leader
+			return nil
+		}
+
 		stream, err := client.KeepConnected(ctx)
 		if err != nil {
 			glog.V(1).Infof("%s masterClient failed to keep connected to %s: %v", mc.clientType, master, err)
@@ -113,6 +148,7 @@ func (mc *MasterClient) tryConnectToMaster(master string) (nextHintedLeader stri
 		}
 
 		glog.V(1).Infof("%s masterClient Connected to %v", mc.clientType, master)
+		mc.clearLocations()
 		mc.currentMaster = master
 
 		for {
@@ -134,6 +170,7 @@ func (mc *MasterClient) tryConnectToMaster(master string) (nextHintedLeader stri
 				Url:        volumeLocation.Url,
 				PublicUrl:  volumeLocation.PublicUrl,
 				DataCenter: volumeLocation.DataCenter,
+				Rack:       volumeLocation.Rack,
 			}
 			for _, newVid := range volumeLocation.NewVids {
 				glog.V(1).Infof("%s: %s masterClient adds volume %d", mc.clientType, loc.Url, newVid)
@@ -162,3 +199,74 @@ func (mc *MasterClient) WithClient(fn func(client master_pb.SeaweedClient) error
 		})
 	})
 }
+
+// LookupVolumeIds looks up the volume ids missing in the vid map with one request to the master,
+// and adds the found locations to the vid map.
+func (mc *MasterClient) LookupVolumeIds(vids []uint32) error {
+	var unknownVids []string
+	for _, vid := range vids {
+		if _, found := mc.GetLocations(vid); !found {
+			unknownVids = append(unknownVids, strconv.FormatUint(uint64(vid), 10))
+		}
+	}
+	if len(unknownVids) == 0 {
+		return nil
+	}
+	return mc.WithClient(func(client master_pb.SeaweedClient) error {
+		resp, err := client.LookupVolumeBatch(context.Background(), &master_pb.LookupVolumeBatchRequest{
+			VolumeOrFileIds: unknownVids,
+		})
+		if err != nil {
+			return err
+		}
+		for vidString, volumeIdLocation := range resp.VolumeIdLocations {
+			vid, parseErr := strconv.ParseUint(vidString, 10, 32)
+			if parseErr != nil || volumeIdLocation.Error != "" {
+				continue
+			}
+			for _, loc := range volumeIdLocation.Locations {
+				mc.addLocation(uint32(vid), Location{
+					Url:       loc.Url,
+					PublicUrl: loc.PublicUrl,
+				})
+			}
+		}
+		return nil
+	})
+}
+
+// RefreshFileIdLocations looks up the volume of the file id from the master again,
+// and replaces the cached volume locations, which may be stale after the volume is moved.
+func (mc *MasterClient) RefreshFileIdLocations(fileId string) error {
+	commaIndex := strings.Index(fileId, ",")
+	if commaIndex <= 0 {
+		return fmt.Errorf("invalid fileId %s", fileId)
+	}
+	vid, err := strconv.ParseUint(fileId[:commaIndex], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid volume id in fileId %s: %v", fileId, err)
+	}
+	return mc.WithClient(func(client master_pb.SeaweedClient) error {
+		resp, err := client.LookupVolumeBatch(context.Background(), &master_pb.LookupVolumeBatchRequest{
+			VolumeOrFileIds: []string{fileId[:commaIndex]},
+		})
+		if err != nil {
+			return err
+		}
+		var locations []Location
+		for _, volumeIdLocation := range resp.VolumeIdLocations {
+			if volumeIdLocation.Error != "" {
+				mc.setLocations(uint32(vid), nil)
+				return fmt.Errorf("lookup volume %d: %s", vid, volumeIdLocation.Error)
+			}
+			for _, loc := range volumeIdLocation.Locations {
+				locations = append(locations, Location{
+					Url:       loc.Url,
+					PublicUrl: loc.PublicUrl,
+				})
+			}
+		}
+		mc.setLocations(uint32(vid), locations)
+		return nil
+	})
+}
@@ -0,0 +1,155 @@
+package wdclient
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// ReplicaSelectionNearest prefers the replicas in the same data center, and then in the same rack
+	ReplicaSelectionNearest = "nearest"
+	// ReplicaSelectionRandom spreads the reads evenly over all replicas
+	ReplicaSelectionRandom = "random"
+	// ReplicaSelectionLatency prefers the replicas with the lowest connection latency, measured by probing
+	ReplicaSelectionLatency = "latency"
+
+	latencyProbeInterval = 10 * time.Second
+	latencyProbeTimeout  = 3 * time.Second
+	latencyEwmaWeight    = 0.3
+)
+
+// ReplicaSelector orders the replicas of a volume to read from
+type ReplicaSelector struct {
+	strategy   string
+	dataCenter string
+	rack       string
+	latencies  *latencyTracker
+}
+
+func NewReplicaSelector(strategy, dataCenter, rack string) (*ReplicaSelector, error) {
+	rs := &ReplicaSelector{
+		strategy:   strategy,
+		dataCenter: dataCenter,
+		rack:       rack,
+	}
+	switch strategy {
+	case "":
+		rs.strategy = ReplicaSelectionNearest
+	case ReplicaSelectionNearest, ReplicaSelectionRandom:
+	case ReplicaSelectionLatency:
+		rs.latencies = newLatencyTracker(probeConnectLatency)
+	default:
+		return nil, fmt.Errorf("unknown replica selection %q, expecting %s, %s, or %s",
+			strategy, ReplicaSelectionNearest, ReplicaSelectionRandom, ReplicaSelectionLatency)
+	}
+	return rs, nil
+}
+
+// Sort returns a copy of the locations, in the order to read from
+func (rs *ReplicaSelector) Sort(locations []Location) []Location {
+	sorted := make([]Location, len(locations))
+	copy(sorted, locations)
+
+	if rs.strategy == ReplicaSelectionRandom {
+		rand.Shuffle(len(sorted), func(i, j int) {
+			sorted[i], sorted[j] = sorted[j], sorted[i]
+		})
+		return sorted
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return rs.distance(sorted[i]) < rs.distance(sorted[j])
+	})
+
+	if rs.latencies != nil {
+		// the replicas not probed yet are kept after the probed ones, in the nearest order
+		latencies := rs.latencies.get(sorted)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			li, iFound := latencies[sorted[i].Url]
+			lj, jFound := latencies[sorted[j].Url]
+			if iFound != jFound {
+				return iFound
+			}
+			return li < lj
+		})
+	}
+
+	return sorted
+}
+
+func (rs *ReplicaSelector) distance(loc Location) int {
+	if rs.dataCenter == "" || loc.DataCenter != rs.dataCenter {
+		return 2
+	}
+	if rs.rack == "" || loc.Rack != rs.rack {
+		return 1
+	}
+	return 0
+}
+
+// latencyTracker keeps the exponentially weighted moving average of the latency to each server,
+// and probes the servers again in the background when the measurement is older than latencyProbeInterval
+type latencyTracker struct {
+	sync.Mutex
+	ewma      map[string]time.Duration
+	probedAt  map[string]time.Time
+	probeFunc func(url string) (time.Duration, error)
+}
+
+func newLatencyTracker(probeFunc func(url string) (time.Duration, error)) *latencyTracker {
+	return &latencyTracker{
+		ewma:      make(map[string]time.Duration),
+		probedAt:  make(map[string]time.Time),
+		probeFunc: probeFunc,
+	}
+}
+
+// get returns the known latencies of the locations, and starts probing the stale ones
+func (lt *latencyTracker) get(locations []Location) map[string]time.Duration {
+	latencies := make(map[string]time.Duration)
+	now := time.Now()
+
+	lt.Lock()
+	defer lt.Unlock()
+	for _, loc := range locations {
+		if latency, found := lt.ewma[loc.Url]; found {
+			latencies[loc.Url] = latency
+		}
+		if now.Sub(lt.probedAt[loc.Url]) > latencyProbeInterval {
+			lt.probedAt[loc.Url] = now
+			go lt.probe(loc.Url)
+		}
+	}
+	return latencies
+}
+
+func (lt *latencyTracker) probe(url string) {
+	latency, err := lt.probeFunc(url)
+	if err != nil {
+		latency = latencyProbeTimeout
+	}
+	lt.update(url, latency)
+}
+
+func (lt *latencyTracker) update(url string, latency time.Duration) {
+	lt.Lock()
+	defer lt.Unlock()
+	if previous, found := lt.ewma[url]; found {
+		latency = time.Duration(latencyEwmaWeight*float64(latency) + (1-latencyEwmaWeight)*float64(previous))
+	}
+	lt.ewma[url] = latency
+}
+
+func probeConnectLatency(url string) (time.Duration, error) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", url, latencyProbeTimeout)
+	if err != nil {
+		return 0, err
+	}
+	conn.Close()
+	return time.Since(start), nil
+}
@@ -0,0 +1,82 @@
+package wdclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testReplicas = []Location{
+	{Url: "a:8080", DataCenter: "dc2", Rack: "r1"},
+	{Url: "b:8080", DataCenter: "dc1", Rack: "r2"},
+	{Url: "c:8080", DataCenter: "dc1", Rack: "r1"},
+	{Url: "d:8080"},
+}
+
+func replicaUrls(locations []Location) (urls []string) {
+	for _, loc := range locations {
+		urls = append(urls, loc.Url)
+	}
+	return
+}
+
+func TestReplicaSelectionNearest(t *testing.T) {
+	rs, err := NewReplicaSelector(ReplicaSelectionNearest, "dc1", "r1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"c:8080", "b:8080", "a:8080", "d:8080"}, replicaUrls(rs.Sort(testReplicas)))
+
+	rs, _ = NewReplicaSelector("", "dc1", "")
+	assert.Equal(t, []string{"b:8080", "c:8080", "a:8080", "d:8080"}, replicaUrls(rs.Sort(testReplicas)))
+
+	rs, _ = NewReplicaSelector("", "", "r1")
+	assert.Equal(t, replicaUrls(testReplicas), replicaUrls(rs.Sort(testReplicas)))
+}
+
+func TestReplicaSelectionRandom(t *testing.T) {
+	rs, err := NewReplicaSelector(ReplicaSelectionRandom, "dc1", "r1")
+	assert.Equal(t, nil, err)
+	firsts := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		sorted := rs.Sort(testReplicas)
+		assert.ElementsMatch(t, testReplicas, sorted)
+		firsts[sorted[0].Url] = true
+	}
+	assert.Equal(t, len(testReplicas), len(firsts))
+}
+
+func TestReplicaSelectionLatency(t *testing.T) {
+	rs, err := NewReplicaSelector(ReplicaSelectionLatency, "dc1", "r1")
+	assert.Equal(t, nil, err)
+
+	probed := make(chan string, len(testReplicas))
+	rs.latencies.probeFunc = func(url string) (time.Duration, error) {
+		probed <- url
+		return time.Hour, nil
+	}
+
+	// not probed yet, in the nearest order
+	assert.Equal(t, []string{"c:8080", "b:8080", "a:8080", "d:8080"}, replicaUrls(rs.Sort(testReplicas)))
+	for range testReplicas {
+		<-probed
+	}
+
+	rs.latencies.Lock()
+	rs.latencies.ewma = map[string]time.Duration{
+		"a:8080": 2 * time.Millisecond,
+		"b:8080": 5 * time.Millisecond,
+	}
+	rs.latencies.Unlock()
+	assert.Equal(t, []string{"a:8080", "b:8080", "c:8080", "d:8080"}, replicaUrls(rs.Sort(testReplicas)))
+
+	// the moving average follows the new measurements
+	for i := 0; i < 10; i++ {
+		rs.latencies.update("a:8080", 10*time.Millisecond)
+	}
+	assert.Equal(t, []string{"b:8080", "a:8080", "c:8080", "d:8080"}, replicaUrls(rs.Sort(testReplicas)))
+}
+
+func TestReplicaSelectionUnknown(t *testing.T) {
+	_, err := NewReplicaSelector("fastest", "", "")
+	assert.NotEqual(t, nil, err)
+}
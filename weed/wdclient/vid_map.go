@@ -21,10 +21,17 @@ type HasLookupFileIdFunction interface {
 
 type LookupFileIdFunctionType func(fileId string) (targetUrls []string, err error)
 
+// HasRefreshFileIdLocationsFunction is implemented by the lookups caching the volume locations,
+// to refresh the cached locations after reading from them failed, e.g., the volume has moved.
+type HasRefreshFileIdLocationsFunction interface {
+	RefreshFileIdLocations(fileId string) error
+}
+
 type Location struct {
 	Url        string `json:"url,omitempty"`
 	PublicUrl  string `json:"publicUrl,omitempty"`
 	DataCenter string `json:"dataCenter,omitempty"`
+	Rack       string `json:"rack,omitempty"`
 }
 
 type vidMap struct {
@@ -32,16 +39,26 @@ type vidMap struct {
 	vid2Locations map[uint32][]Location
 	DataCenter    string
 	cursor        int32
+	selector      *ReplicaSelector
 }
 
 func newVidMap(dataCenter string) vidMap {
+	selector, _ := NewReplicaSelector(ReplicaSelectionNearest, dataCenter, "")
 	return vidMap{
 		vid2Locations: make(map[uint32][]Location),
 		DataCenter:    dataCenter,
 		cursor:        -1,
+		selector:      selector,
 	}
 }
 
+// clearLocations forgets all volume locations, to be refilled by the new master
+func (vc *vidMap) clearLocations() {
+	vc.Lock()
+	defer vc.Unlock()
+	vc.vid2Locations = make(map[uint32][]Location)
+}
+
 func (vc *vidMap) getLocationIndex(length int) (int, error) {
 	if length <= 0 {
 		return 0, fmt.Errorf("invalid length: %d", length)
@@ -63,16 +80,24 @@ func (vc *vidMap) LookupVolumeServerUrl(vid string) (serverUrls []string, err er
 	if !found {
 		return nil, fmt.Errorf("volume %d not found", id)
 	}
-	for _, loc := range locations {
-		if vc.DataCenter == "" || loc.DataCenter == "" || vc.DataCenter != loc.DataCenter {
-			serverUrls = append(serverUrls, loc.Url)
-		} else {
-			serverUrls = append([]string{loc.Url}, serverUrls...)
-		}
+	for _, loc := range vc.getReplicaSelector().Sort(locations) {
+		serverUrls = append(serverUrls, loc.Url)
 	}
 	return
 }
 
+func (vc *vidMap) getReplicaSelector() *ReplicaSelector {
+	vc.RLock()
+	defer vc.RUnlock()
+	return vc.selector
+}
+
+func (vc *vidMap) setReplicaSelector(selector *ReplicaSelector) {
+	vc.Lock()
+	defer vc.Unlock()
+	vc.selector = selector
+}
+
 func (vc *vidMap) GetLookupFileIdFunction() LookupFileIdFunctionType {
 	return vc.LookupFileId
 }
@@ -133,6 +158,18 @@ func (vc *vidMap) addLocation(vid uint32, location Location) {
 
 }
 
+// setLocations replaces all the locations of the volume
+func (vc *vidMap) setLocations(vid uint32, locations []Location) {
+	vc.Lock()
+	defer vc.Unlock()
+
+	if len(locations) == 0 {
+		delete(vc.vid2Locations, vid)
+		return
+	}
+	vc.vid2Locations[vid] = locations
+}
+
 func (vc *vidMap) deleteLocation(vid uint32, location Location) {
 	vc.Lock()
 	defer vc.Unlock()
@@ -67,6 +67,8 @@ func main() {
 	for _, cmd := range commands {
 		if cmd.Name() == args[0] && cmd.Run != nil {
 			cmd.Flag.Usage = func() { cmd.Usage() }
+			cmd.Flag.Init(cmd.Name(), flag.ContinueOnError)
+			cmd.Flag.SetEnvPrefix(flag.EnvPrefix + "_" + strings.ToUpper(cmd.Name()))
 			cmd.Flag.Parse(args[1:])
 			args = cmd.Flag.Args()
 			IsDebug = cmd.IsDebug
@@ -99,6 +101,17 @@ The commands are:
 
 Use "weed help [command]" for more information about a command.
 
+The command options can also be set, with lower precedence than the arguments, by
+	* environment variables WEED_<COMMAND>_<OPTION>, upper cased with "." and "-" replaced by "_",
+	  e.g., WEED_SERVER_MASTER_PORT=9333 for "weed server -master.port=9333"
+	* -options=<file>, either lines of optionName=optionValue, or a .toml, .yaml or .json file
+	  shared by the commands, where the table named after the command has precedence, e.g.,
+	    ip = "10.0.0.1"
+	    [master]
+	    port = 9333
+	    peers = ["10.0.0.1:9333", "10.0.0.2:9333", "10.0.0.3:9333"]
+	  The file can also be set by WEED_<COMMAND>_OPTIONS.
+
 `
 
 var helpTemplate = `{{if .Runnable}}Usage: weed {{.UsageLine}}